@@ -0,0 +1,169 @@
+package acl
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"github.com/GrappigPanda/Olivia/config"
+	"strings"
+)
+
+// The roles a user can be given. Each allows a set of commands, and a user
+// with several roles may run any command one of them allows.
+const (
+	ReadOnly    = "read-only"
+	ReadWrite   = "read-write"
+	Replication = "replication"
+	Admin       = "admin"
+)
+
+func commandSet(commands ...string) map[string]bool {
+	set := make(map[string]bool, len(commands))
+	for _, command := range commands {
+		set[command] = true
+	}
+
+	return set
+}
+
+// connectionCommands only affect the connection sending them, so every user
+// may run them.
+var connectionCommands = commandSet(
+	"AUTH", "PING", "ECHO", "QUIT", "SELECT", "PIPELINE", "COMMAND", "CLIENT",
+)
+
+var readCommands = commandSet(
+	"GET", "MGET", "BGET", "TTL", "EXISTS", "SCAN", "KEYS", "DBSIZE", "RANGE",
+	"WATCH", "UNWATCH", "SUBSCRIBE", "UNSUBSCRIBE", "LRANGE", "HGET",
+	"HGETALL",
+)
+
+var writeCommands = commandSet(
+	"SET", "SETEX", "MSET", "DEL", "EXPIRE", "PERSIST", "INCR", "DECR",
+	"INCRBY", "DECRBY", "CAS", "PUBLISH", "SETNX", "LOCK", "UNLOCK",
+	"LPUSH", "RPUSH", "LPOP", "HSET",
+)
+
+// replicationCommands are what other nodes send us, besides reads.
+var replicationCommands = commandSet(
+	"REPLICATE", "REPLICATELIST", "REPLICATEHASH", "TOMBSTONE", "VGET",
+	"REPAIR", "REQUEST", "GOSSIP", "PROBE", "BLOOMADD", "RELAY",
+)
+
+// roles maps each role to the command sets it allows. Admin isn't listed as
+// it allows everything.
+var roles = map[string][]map[string]bool{
+	ReadOnly:    {readCommands},
+	ReadWrite:   {readCommands, writeCommands},
+	Replication: {readCommands, replicationCommands},
+}
+
+// Permissions are the commands a connection may run.
+type Permissions struct {
+	all      bool
+	commands map[string]bool
+}
+
+// All allows every command. It's what the cluster secret grants, and what
+// connections get when authentication is off.
+var All = &Permissions{all: true}
+
+// NewPermissions returns the permissions `roleNames` grant together.
+func NewPermissions(roleNames []string) (*Permissions, error) {
+	if len(roleNames) == 0 {
+		return nil, fmt.Errorf("No roles given")
+	}
+
+	permissions := &Permissions{commands: make(map[string]bool)}
+	for _, role := range roleNames {
+		if role == Admin {
+			permissions.all = true
+			continue
+		}
+
+		sets, ok := roles[role]
+		if !ok {
+			return nil, fmt.Errorf("Unknown role %v", role)
+		}
+
+		for _, set := range sets {
+			for command := range set {
+				permissions.commands[command] = true
+			}
+		}
+	}
+
+	return permissions, nil
+}
+
+// Allows reports whether `command` may be run. Nil permissions, those of a
+// connection which hasn't authenticated, only allow connection commands.
+func (p *Permissions) Allows(command string) bool {
+	command = strings.ToUpper(command)
+	if connectionCommands[command] {
+		return true
+	}
+	if p == nil {
+		return false
+	}
+
+	return p.all || p.commands[command]
+}
+
+type user struct {
+	secret      string
+	permissions *Permissions
+}
+
+// List holds the users clients can authenticate as.
+type List struct {
+	users map[string]user
+}
+
+// NewList creates a list of `users`, checking that every one of them has a
+// unique name, a secret and known roles. Names and secrets can't contain
+// spaces, commas or colons, as AUTH sends them as `name:secret`.
+func NewList(users []config.User) (*List, error) {
+	list := &List{users: make(map[string]user, len(users))}
+
+	for _, u := range users {
+		if u.Name == "" || u.Secret == "" {
+			return nil, fmt.Errorf("Every user needs a name and a secret")
+		}
+		if strings.ContainsAny(u.Name+u.Secret, " ,:") {
+			return nil, fmt.Errorf("User %v's name or secret contains a space, comma or colon", u.Name)
+		}
+		if _, ok := list.users[u.Name]; ok {
+			return nil, fmt.Errorf("User %v is declared twice", u.Name)
+		}
+
+		permissions, err := NewPermissions(u.Roles)
+		if err != nil {
+			return nil, fmt.Errorf("User %v: %v", u.Name, err)
+		}
+
+		list.users[u.Name] = user{u.Secret, permissions}
+	}
+
+	return list, nil
+}
+
+// HasUsers reports whether any users are declared, in which case clients
+// have to authenticate.
+func (l *List) HasUsers() bool {
+	return l != nil && len(l.users) > 0
+}
+
+// Authenticate checks `secret` against user `name`'s, returning their
+// permissions if it matches.
+func (l *List) Authenticate(name string, secret string) (*Permissions, bool) {
+	if l == nil {
+		return nil, false
+	}
+
+	u, ok := l.users[name]
+	if !ok || subtle.ConstantTimeCompare([]byte(secret), []byte(u.secret)) != 1 {
+		return nil, false
+	}
+
+	return u.permissions, true
+}
@@ -0,0 +1,111 @@
+package acl
+
+import (
+	"github.com/GrappigPanda/Olivia/config"
+	"testing"
+)
+
+func TestRolesAllowTheirCommands(t *testing.T) {
+	var tests = []struct {
+		roles    []string
+		allowed  []string
+		disabled []string
+	}{
+		{[]string{ReadOnly}, []string{"GET", "mget", "SCAN", "PING"}, []string{"SET", "DEL", "REPLICATE", "SAVE"}},
+		{[]string{ReadWrite}, []string{"GET", "SET", "incr", "DEL"}, []string{"REPLICATE", "REQUEST", "BGSAVE"}},
+		{[]string{Replication}, []string{"GET", "REPLICATE", "REPAIR", "REQUEST"}, []string{"SET", "STATS"}},
+		{[]string{ReadOnly, Replication}, []string{"RANGE", "REPAIR"}, []string{"CAS"}},
+		{[]string{Admin}, []string{"GET", "SET", "SAVE", "STATS", "ANYTHING"}, nil},
+	}
+
+	for _, test := range tests {
+		permissions, err := NewPermissions(test.roles)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		for _, command := range test.allowed {
+			if !permissions.Allows(command) {
+				t.Fatalf("Expected %v to allow %v", test.roles, command)
+			}
+		}
+		for _, command := range test.disabled {
+			if permissions.Allows(command) {
+				t.Fatalf("Expected %v not to allow %v", test.roles, command)
+			}
+		}
+	}
+}
+
+func TestUnauthenticatedPermissions(t *testing.T) {
+	var permissions *Permissions
+
+	if !permissions.Allows("PING") || !permissions.Allows("AUTH") {
+		t.Fatalf("Expected connection commands to be allowed")
+	}
+	if permissions.Allows("GET") {
+		t.Fatalf("Expected GET not to be allowed")
+	}
+}
+
+func TestNewPermissionsErrors(t *testing.T) {
+	if _, err := NewPermissions(nil); err == nil {
+		t.Fatalf("Expected no roles to fail")
+	}
+	if _, err := NewPermissions([]string{ReadOnly, "root"}); err == nil {
+		t.Fatalf("Expected an unknown role to fail")
+	}
+}
+
+func TestList(t *testing.T) {
+	list, err := NewList([]config.User{
+		{Name: "reader", Secret: "pw1", Roles: []string{ReadOnly}},
+		{Name: "writer", Secret: "pw2", Roles: []string{ReadWrite}},
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !list.HasUsers() {
+		t.Fatalf("Expected the list to have users")
+	}
+
+	permissions, ok := list.Authenticate("writer", "pw2")
+	if !ok || !permissions.Allows("SET") {
+		t.Fatalf("Expected writer to be allowed to SET, got %v %v", permissions, ok)
+	}
+
+	for _, credentials := range [][2]string{{"reader", "pw2"}, {"writer", ""}, {"nobody", "pw1"}} {
+		if _, ok := list.Authenticate(credentials[0], credentials[1]); ok {
+			t.Fatalf("Expected %v to be rejected", credentials)
+		}
+	}
+
+	var empty *List
+	if empty.HasUsers() {
+		t.Fatalf("Expected a nil list to have no users")
+	}
+	if _, ok := empty.Authenticate("reader", "pw1"); ok {
+		t.Fatalf("Expected a nil list to reject everyone")
+	}
+}
+
+func TestNewListErrors(t *testing.T) {
+	var tests = [][]config.User{
+		{{Name: "", Secret: "pw", Roles: []string{ReadOnly}}},
+		{{Name: "reader", Secret: "", Roles: []string{ReadOnly}}},
+		{{Name: "reader", Secret: "p:w", Roles: []string{ReadOnly}}},
+		{{Name: "reader", Secret: "pw", Roles: []string{"root"}}},
+		{{Name: "reader", Secret: "pw"}},
+		{
+			{Name: "reader", Secret: "pw1", Roles: []string{ReadOnly}},
+			{Name: "reader", Secret: "pw2", Roles: []string{ReadOnly}},
+		},
+	}
+
+	for _, users := range tests {
+		if _, err := NewList(users); err == nil {
+			t.Fatalf("Expected %v to be refused", users)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package bloomfilter
+
+import (
+	"math/bits"
+	"sync/atomic"
+)
+
+// AtomicBitset is a fixed-size Bitset whose words are set and cleared with
+// atomic operations rather than under a lock, so concurrent adds and lookups
+// never wait on each other. Bits past its size are ignored. It's serialized
+// like a WFBitset of the same size.
+type AtomicBitset struct {
+	words  []uint64
+	length uint
+}
+
+// NewAtomicBitset constructs an AtomicBitset of `maxSize` bits.
+func NewAtomicBitset(maxSize uint) *AtomicBitset {
+	return &AtomicBitset{
+		words:  make([]uint64, (maxSize+63)/64),
+		length: maxSize,
+	}
+}
+
+// Add sets a bit, retrying until no other writer changed its word in between.
+func (b *AtomicBitset) Add(index uint) {
+	if index >= b.length {
+		return
+	}
+
+	word, mask := &b.words[index/64], uint64(1)<<(index%64)
+	for {
+		old := atomic.LoadUint64(word)
+		if old&mask != 0 || atomic.CompareAndSwapUint64(word, old, old|mask) {
+			return
+		}
+	}
+}
+
+// Remove clears a bit.
+func (b *AtomicBitset) Remove(index uint) {
+	if index >= b.length {
+		return
+	}
+
+	word, mask := &b.words[index/64], uint64(1)<<(index%64)
+	for {
+		old := atomic.LoadUint64(word)
+		if old&mask == 0 || atomic.CompareAndSwapUint64(word, old, old&^mask) {
+			return
+		}
+	}
+}
+
+// Contains reports whether a bit is set.
+func (b *AtomicBitset) Contains(index uint) bool {
+	if index >= b.length {
+		return false
+	}
+
+	return atomic.LoadUint64(&b.words[index/64])&(uint64(1)<<(index%64)) != 0
+}
+
+// IsSet is Contains.
+func (b *AtomicBitset) IsSet(index uint) bool {
+	return b.Contains(index)
+}
+
+// Len returns the bitset's size in bits.
+func (b *AtomicBitset) Len() uint {
+	return b.length
+}
+
+// Count returns how many bits are set.
+func (b *AtomicBitset) Count() uint {
+	var count int
+	for i := range b.words {
+		count += bits.OnesCount64(atomic.LoadUint64(&b.words[i]))
+	}
+
+	return uint(count)
+}
+
+// toWF copies the bitset into a WFBitset.
+func (b *AtomicBitset) toWF() *WFBitset {
+	wf := NewWFBitset(b.length)
+	for i := range b.words {
+		word := atomic.LoadUint64(&b.words[i])
+		for word != 0 {
+			wf.bs.Set(uint(i*64 + bits.TrailingZeros64(word)))
+			word &= word - 1
+		}
+	}
+
+	return wf
+}
+
+// ToString converts the bitset to the string a WFBitset of the same size and
+// bits converts to.
+func (b *AtomicBitset) ToString() string {
+	return b.toWF().ToString()
+}
+
+// FromString reads what ToString wrote, resizing the bitset to the size it
+// was written at. It mustn't race with other changes to the bitset.
+func (b *AtomicBitset) FromString(inputString string) {
+	wf := NewWFBitset(0)
+	wf.FromString(inputString)
+
+	words := make([]uint64, (wf.bs.Len()+63)/64)
+	copy(words, wf.bs.Bytes())
+
+	b.words, b.length = words, wf.bs.Len()
+}
+
+// Compare returns if the two bitsets have the same size and bits set.
+func (b *AtomicBitset) Compare(compareTo interface{}) bool {
+	switch other := compareTo.(type) {
+	case *AtomicBitset:
+		if other.length != b.length {
+			return false
+		}
+		for i := range b.words {
+			if atomic.LoadUint64(&b.words[i]) != atomic.LoadUint64(&other.words[i]) {
+				return false
+			}
+		}
+
+		return true
+	case *WFBitset:
+		return b.toWF().Compare(other)
+	}
+
+	return false
+}
@@ -0,0 +1,188 @@
+package bloomfilter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+)
+
+// binaryMagic starts every binary serialized bloom filter.
+const binaryMagic = "OB"
+
+// binaryGzip is set in a binary filter's flags when its bits are gzipped.
+const binaryGzip byte = 1 << 0
+
+// binaryVersion is the header of a binary filter sent as text, base64'd.
+var binaryVersion = fmt.Sprintf("v%db", SerializationVersion)
+
+// Encoding picks how bloom filters are serialized for peers.
+type Encoding int
+
+const (
+	// TextEncoding is Serialize's RLE'd base64, which every node reads.
+	TextEncoding Encoding = iota
+	// BinaryEncoding sends the raw bits, base64'd.
+	BinaryEncoding
+	// GzipEncoding sends the bits gzipped, then base64'd. Sparse filters
+	// shrink the most.
+	GzipEncoding
+)
+
+// ParseEncoding converts the config representation of an Encoding.
+// Anything unrecognized falls back to TextEncoding.
+func ParseEncoding(encoding string) Encoding {
+	switch strings.ToLower(encoding) {
+	case "binary":
+		return BinaryEncoding
+	case "gzip":
+		return GzipEncoding
+	default:
+		return TextEncoding
+	}
+}
+
+// SerializeAs serializes the filter with `encoding`. The binary encodings
+// are only written for filters with a plain bitset (counting filters send
+// only their bits); anything else is serialized as text. Deserialize reads
+// all of them.
+func SerializeAs(bf BloomFilter, encoding Encoding) string {
+	var simple *SimpleBloomFilter
+	switch filter := bf.(type) {
+	case *SimpleBloomFilter:
+		simple = filter
+	case *CountingBloomFilter:
+		simple = filter.SimpleBloomFilter
+	}
+
+	if encoding == TextEncoding || simple == nil {
+		return bf.Serialize()
+	}
+	if _, ok := simple.filter.(*WFBitset); !ok {
+		return bf.Serialize()
+	}
+
+	return fmt.Sprintf(
+		"%s.%s",
+		binaryVersion,
+		base64.RawURLEncoding.EncodeToString(simple.ConvertToBytes(encoding == GzipEncoding)),
+	)
+}
+
+// ConvertToBytes converts the bloom filter to its binary form: a header of
+// "OB", the serialization version, flags and the name of the hash provider,
+// followed by the bitset, gzipped if `compress` is set. Counting filters only
+// write their bits.
+func (bf *SimpleBloomFilter) ConvertToBytes(compress bool) []byte {
+	var flags byte
+	if compress {
+		flags |= binaryGzip
+	}
+
+	hashName := MixedHashes.Name()
+	if bf.hashProvider != nil {
+		hashName = bf.hashProvider.Name()
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(binaryMagic)
+	buf.WriteByte(SerializationVersion)
+	buf.WriteByte(flags)
+	buf.WriteByte(byte(len(hashName)))
+	buf.WriteString(hashName)
+
+	if !compress {
+		bf.filter.(*WFBitset).writeTo(&buf)
+		return buf.Bytes()
+	}
+
+	zipped := gzip.NewWriter(&buf)
+	bf.filter.(*WFBitset).writeTo(zipped)
+	zipped.Close()
+
+	return buf.Bytes()
+}
+
+// ConvertBytesToBF converts a bloom filter in its binary form back into a
+// SimpleBloomFilter hashed with `provider`. Like DeserializeWithHash, a filter
+// of another version or hashed with another provider is handled by `policy`.
+func ConvertBytesToBF(input []byte, maxSize uint, policy VersionPolicy, provider HashProvider) (*SimpleBloomFilter, error) {
+	bf := NewByFailRate(maxSize, 0.01)
+	bf.hashProvider = provider
+
+	if len(input) < len(binaryMagic)+3 || string(input[:len(binaryMagic)]) != binaryMagic {
+		return nil, fmt.Errorf("Invalid binary bloomfilter header")
+	}
+	input = input[len(binaryMagic):]
+
+	version, flags, nameLength := input[0], input[1], int(input[2])
+	input = input[3:]
+	if len(input) < nameLength {
+		return nil, fmt.Errorf("Invalid binary bloomfilter header")
+	}
+	hashName := string(input[:nameLength])
+	input = input[nameLength:]
+
+	var err error
+	if version != SerializationVersion {
+		err = &VersionMismatchError{fmt.Sprintf("v%d", version)}
+	} else if hashName != provider.Name() {
+		err = &HashMismatchError{hashName, provider.Name()}
+	}
+	if err != nil {
+		if policy == IgnoreMismatch {
+			log.Println(err)
+			return bf, nil
+		}
+		return nil, err
+	}
+
+	var bits io.Reader = bytes.NewReader(input)
+	if flags&binaryGzip != 0 {
+		unzipped, err := gzip.NewReader(bits)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid binary bloomfilter: %v", err)
+		}
+		defer unzipped.Close()
+		bits = unzipped
+	}
+
+	if err := bf.filter.(*WFBitset).readFrom(bits); err != nil {
+		return nil, fmt.Errorf("Invalid binary bloomfilter: %v", err)
+	}
+	if err := drain(bits); err != nil {
+		return nil, fmt.Errorf("Invalid binary bloomfilter: %v", err)
+	}
+
+	return bf, nil
+}
+
+// deserializeBinary reads what SerializeAs wrote with a binary encoding,
+// without its header.
+func deserializeBinary(encoded string, maxSize uint, policy VersionPolicy, provider HashProvider) (*SimpleBloomFilter, error) {
+	input, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid binary bloomfilter: %v", err)
+	}
+
+	return ConvertBytesToBF(input, maxSize, policy, provider)
+}
+
+// drain makes sure a reader was read to its end, so trailing garbage isn't
+// taken for a valid filter. Reaching the end of gzipped bits verifies their
+// checksum too.
+func drain(r io.Reader) error {
+	var extra [1]byte
+	read, err := io.ReadFull(r, extra[:])
+	if read > 0 {
+		return fmt.Errorf("Trailing bytes after the bitset")
+	}
+	if err != io.EOF {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package bloomfilter
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestBinaryRoundTrip(t *testing.T) {
+	bf := NewByFailRateWithHash(1000, 0.01, IndependentHashes, XXHashes)
+	for i := 0; i < 100; i++ {
+		bf.AddKey([]byte(fmt.Sprintf("key%d", i)))
+	}
+
+	for _, compress := range []bool{false, true} {
+		decoded, err := ConvertBytesToBF(bf.ConvertToBytes(compress), 1000, RejectMismatch, XXHashes)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if !decoded.Compare(bf) {
+			t.Fatalf("Expected the filter to survive a round trip (compressed %v)", compress)
+		}
+		if ok, _ := decoded.HasKey([]byte("key42")); !ok {
+			t.Fatalf("Expected key42 to be in the decoded filter")
+		}
+	}
+}
+
+func TestSerializeAsIsReadByDeserialize(t *testing.T) {
+	bf := NewCountingByFailRate(1000, 0.01)
+	bf.AddKey([]byte("key"))
+
+	for _, encoding := range []Encoding{TextEncoding, BinaryEncoding, GzipEncoding} {
+		serialized := SerializeAs(bf, encoding)
+		if (encoding != TextEncoding) != strings.HasPrefix(serialized, "v1b.") {
+			t.Fatalf("Expected %v to be written with its own header, got %q", encoding, serialized[:4])
+		}
+
+		decoded, err := Deserialize(serialized, 1000)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if !decoded.GetStorage().Compare(bf.GetStorage()) {
+			t.Fatalf("Expected the bits to survive encoding %v", encoding)
+		}
+	}
+}
+
+func TestGzipShrinksSparseFilters(t *testing.T) {
+	bf := NewByFailRate(100000, 0.01)
+	for i := 0; i < 10000; i++ {
+		bf.AddKey([]byte(fmt.Sprintf("key%d", i)))
+	}
+
+	text := len(bf.Serialize())
+	binary := len(SerializeAs(bf, BinaryEncoding))
+	gzipped := len(SerializeAs(bf, GzipEncoding))
+	if gzipped >= binary || gzipped >= text {
+		t.Fatalf("Expected gzip to be smallest, got text %d, binary %d, gzip %d", text, binary, gzipped)
+	}
+}
+
+func TestConvertBytesToBFRefusesMismatches(t *testing.T) {
+	encoded := NewByFailRateWithHash(1000, 0.01, IndependentHashes, FNVHashes).ConvertToBytes(true)
+
+	_, err := ConvertBytesToBF(encoded, 1000, RejectMismatch, MixedHashes)
+	if _, ok := err.(*HashMismatchError); !ok {
+		t.Fatalf("Expected a HashMismatchError, got %v", err)
+	}
+
+	encoded[len(binaryMagic)] = SerializationVersion + 1
+	_, err = ConvertBytesToBF(encoded, 1000, RejectMismatch, FNVHashes)
+	if _, ok := err.(*VersionMismatchError); !ok {
+		t.Fatalf("Expected a VersionMismatchError, got %v", err)
+	}
+
+	bf, err := ConvertBytesToBF(encoded, 1000, IgnoreMismatch, FNVHashes)
+	if err != nil || bf.GetStorage().Count() != 0 {
+		t.Fatalf("Expected an empty filter, got %v", err)
+	}
+}
+
+func TestConvertBytesToBFRefusesCorruptInput(t *testing.T) {
+	encoded := NewByFailRate(1000, 0.01).ConvertToBytes(false)
+
+	for _, corrupt := range [][]byte{
+		nil,
+		[]byte("XX\x01\x00\x00"),
+		encoded[:len(encoded)-3],
+		append(append([]byte{}, encoded...), 0),
+	} {
+		if _, err := ConvertBytesToBF(corrupt, 1000, RejectMismatch, MixedHashes); err == nil {
+			t.Fatalf("Expected %q to be refused", corrupt)
+		}
+	}
+}
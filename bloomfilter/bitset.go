@@ -1,45 +1,74 @@
 package bloomfilter
 
 import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
 	"github.com/willf/bitset"
+	"io"
 	"log"
+	"sync"
 )
 
+// maxBinaryBits caps the size of a bitset readFrom accepts, so a corrupt (or
+// gzip bomb of a) length doesn't allocate without bound.
+const maxBinaryBits = 1 << 30
+
 type Bitset interface {
 	Add(uint)
+	Remove(uint)
 	Contains(uint) bool
 	ToString() string
 	FromString(string)
 	Compare(interface{}) bool
 	IsSet(uint) bool
 	Len() uint
+	Count() uint
 }
 
-// WFBitset is a simple wrapper around the willf bitset library.
+// WFBitset is a simple wrapper around the willf bitset library. It's safe for
+// concurrent use: changes take its lock, reads share it.
 type WFBitset struct {
-	bs *bitset.BitSet
+	bs   *bitset.BitSet
+	lock sync.RWMutex
 }
 
 // NewWFBitset constructs a new bitset to be used with bloom filters.
 func NewWFBitset(maxSize uint) *WFBitset {
 	return &WFBitset{
-		bitset.New(maxSize),
+		bs: bitset.New(maxSize),
 	}
 }
 
 // Add handles adding a new hashed index into the bitset.
 func (b *WFBitset) Add(index uint) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
 	b.bs.Set(index)
 }
 
+// Remove handles clearing a hashed index from the bitset.
+func (b *WFBitset) Remove(index uint) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.bs.Clear(index)
+}
+
 // Contains verifies if a hash index is actually in the bitset or not.
 func (b *WFBitset) Contains(index uint) bool {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
 	return b.bs.Test(index)
 }
 
 // ToString handles converting the bitset to a RLE usable string.
 func (b *WFBitset) ToString() string {
+	b.lock.RLock()
 	json, err := b.bs.MarshalJSON()
+	b.lock.RUnlock()
 	if err != nil {
 		panic(err)
 	}
@@ -50,20 +79,116 @@ func (b *WFBitset) ToString() string {
 // FromString handles converting a (valid json) string to a valid underlying
 // bitset.
 func (b *WFBitset) FromString(inputString string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
 	err := b.bs.UnmarshalJSON([]byte(inputString))
 	if err != nil {
 		log.Println("Invalid bloomfilter received: ", err)
 	}
 }
 
+// encode returns the bitset's base64 without the framing ToString drops, which
+// assumes exactly one byte of padding and so only fits some sizes.
+func (b *WFBitset) encode() string {
+	b.lock.RLock()
+	json, err := b.bs.MarshalJSON()
+	b.lock.RUnlock()
+	if err != nil {
+		panic(err)
+	}
+
+	return string(json[1 : len(json)-1])
+}
+
+// decode reads what encode wrote.
+func (b *WFBitset) decode(encoded string) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.bs.UnmarshalJSON([]byte(fmt.Sprintf("%q", encoded)))
+}
+
+// writeTo writes the bitset in binary: its length in bits, then its words,
+// all big-endian.
+func (b *WFBitset) writeTo(w io.Writer) error {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	_, err := b.bs.WriteTo(w)
+	return err
+}
+
+// readFrom reads what writeTo wrote.
+func (b *WFBitset) readFrom(r io.Reader) error {
+	var length [8]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return err
+	}
+	if bits := binary.BigEndian.Uint64(length[:]); bits > maxBinaryBits {
+		return fmt.Errorf("Bitset of %d bits is too large", bits)
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	_, err := b.bs.ReadFrom(io.MultiReader(bytes.NewReader(length[:]), r))
+	return err
+}
+
 func (b *WFBitset) Compare(compareTo interface{}) bool {
-	return b.bs.Equal(compareTo.(*WFBitset).bs)
+	other := compareTo.(*WFBitset)
+	if other == b {
+		return true
+	}
+
+	// Only one bitset is locked at a time, so comparing or merging two
+	// bitsets both ways at once can't deadlock.
+	copied := other.clone()
+
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	return b.bs.Equal(copied)
 }
 
 func (b *WFBitset) IsSet(bitIndex uint) bool {
-	return b.bs.Test(bitIndex)
+	return b.Contains(bitIndex)
 }
 
 func (b *WFBitset) Len() uint {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
 	return b.bs.Len()
 }
+
+// Count returns how many bits are set.
+func (b *WFBitset) Count() uint {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	return b.bs.Count()
+}
+
+// unionWith sets every bit which is set in `other`.
+func (b *WFBitset) unionWith(other *WFBitset) {
+	if other == b {
+		return
+	}
+
+	copied := other.clone()
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.bs.InPlaceUnion(copied)
+}
+
+// clone returns a copy of the underlying bitset.
+func (b *WFBitset) clone() *bitset.BitSet {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	return b.bs.Clone()
+}
@@ -0,0 +1,106 @@
+package bloomfilter
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentAddsAndLookups(t *testing.T) {
+	bf := NewCountingByFailRate(1000, 0.01)
+
+	var wg sync.WaitGroup
+	for writer := 0; writer < 4; writer++ {
+		wg.Add(2)
+		go func(writer int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				bf.AddKey([]byte(fmt.Sprintf("key%d-%d", writer, i)))
+			}
+		}(writer)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				bf.HasKey([]byte(fmt.Sprintf("key%d", i)))
+				if i%50 == 0 {
+					bf.Serialize()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for writer := 0; writer < 4; writer++ {
+		for i := 0; i < 200; i++ {
+			if ok, _ := bf.HasKey([]byte(fmt.Sprintf("key%d-%d", writer, i))); !ok {
+				t.Fatalf("Expected key%d-%d to be in the filter", writer, i)
+			}
+		}
+	}
+}
+
+func TestAtomicBitsetMatchesWFBitset(t *testing.T) {
+	atomicBits := NewAtomicBitset(1000)
+	wfBits := NewWFBitset(1000)
+
+	var wg sync.WaitGroup
+	for writer := uint(0); writer < 4; writer++ {
+		wg.Add(1)
+		go func(writer uint) {
+			defer wg.Done()
+			for index := writer; index < 1000; index += 7 {
+				atomicBits.Add(index)
+			}
+		}(writer)
+	}
+	wg.Wait()
+
+	for writer := uint(0); writer < 4; writer++ {
+		for index := writer; index < 1000; index += 7 {
+			wfBits.Add(index)
+		}
+	}
+	atomicBits.Add(5000)
+
+	if atomicBits.Count() != wfBits.Count() || !atomicBits.Compare(wfBits) {
+		t.Fatalf("Expected %d bits set like the WFBitset's, got %d", wfBits.Count(), atomicBits.Count())
+	}
+	if atomicBits.ToString() != wfBits.ToString() {
+		t.Fatalf("Expected the bitsets to serialize alike")
+	}
+
+	decoded := NewAtomicBitset(0)
+	decoded.FromString(fmt.Sprintf("\"%s=\"", wfBits.ToString()))
+	if !decoded.Compare(atomicBits) {
+		t.Fatalf("Expected the bitset to survive a round trip")
+	}
+
+	atomicBits.Remove(7)
+	if atomicBits.Contains(7) || !atomicBits.Contains(14) {
+		t.Fatalf("Expected only bit 7 to be cleared")
+	}
+}
+
+// benchmarkBitset adds and looks up bits from every core at once, one add to
+// every ten lookups.
+func benchmarkBitset(b *testing.B, bits Bitset) {
+	b.RunParallel(func(pb *testing.PB) {
+		index := uint(0)
+		for pb.Next() {
+			index = (index + 7919) % 100000
+			if index%10 == 0 {
+				bits.Add(index)
+			} else {
+				bits.Contains(index)
+			}
+		}
+	})
+}
+
+func BenchmarkMutexBitset(b *testing.B) {
+	benchmarkBitset(b, NewWFBitset(100000))
+}
+
+func BenchmarkAtomicBitset(b *testing.B) {
+	benchmarkBitset(b, NewAtomicBitset(100000))
+}
@@ -6,17 +6,92 @@ import (
 	"github.com/mtchavez/jenkins"
 	"github.com/spaolacci/murmur3"
 	"hash/fnv"
+	"log"
 	"math"
+	"strings"
 )
 
+// SerializationVersion is the format version this node writes into the header
+// of every serialized bloom filter. Bump it whenever the wire format changes.
+const SerializationVersion = 1
+
+// VersionPolicy decides what Deserialize does with a bloom filter that was
+// serialized with a version this node doesn't understand.
+type VersionPolicy int
+
+const (
+	// RejectMismatch returns a VersionMismatchError to the caller.
+	RejectMismatch VersionPolicy = iota
+	// IgnoreMismatch logs the mismatch and hands back an empty filter, so the
+	// remote peer simply won't be routed to until it speaks our version.
+	IgnoreMismatch
+)
+
+// ParseVersionPolicy converts the config representation of a VersionPolicy.
+// Anything unrecognized falls back to RejectMismatch.
+func ParseVersionPolicy(policy string) VersionPolicy {
+	switch strings.ToLower(policy) {
+	case "ignore":
+		return IgnoreMismatch
+	default:
+		return RejectMismatch
+	}
+}
+
+// VersionMismatchError is returned when a serialized bloom filter carries a
+// version header which this node cannot decode.
+type VersionMismatchError struct {
+	Version string
+}
+
+func (e *VersionMismatchError) Error() string {
+	return fmt.Sprintf(
+		"bloomfilter serialized with unsupported version %q (expected v%d)",
+		e.Version,
+		SerializationVersion,
+	)
+}
+
+// HashScheme decides how a bloom filter derives a key's bit indices. Every
+// node in a cluster has to use the same scheme, as the indices of a key are
+// computed locally and looked up in remote nodes' filters.
+type HashScheme int
+
+const (
+	// IndependentHashes runs a separate hash function per bit index.
+	IndependentHashes HashScheme = iota
+	// DoubleHashing derives every bit index from two base hashes as
+	// h1 + i*h2 (Kirsch-Mitzenmacher), so only two hashes are computed no
+	// matter how many hash functions the filter has.
+	DoubleHashing
+)
+
+// ParseHashScheme converts the config representation of a HashScheme.
+// Anything unrecognized falls back to IndependentHashes.
+func ParseHashScheme(scheme string) HashScheme {
+	switch strings.ToLower(scheme) {
+	case "double":
+		return DoubleHashing
+	default:
+		return IndependentHashes
+	}
+}
+
 type BloomFilter interface {
 	AddKey(key []byte) (bool, []uint)
+	AddKeys(keys [][]byte)
 	HasKey(key []byte) (bool, []uint)
+	RemoveKey(key []byte) bool
 	Serialize() string
 	GetMaxSize() uint
 	GetStorage() Bitset
 	Compare(interface{}) bool
 	HashKey([]byte) []uint
+	Merge(other BloomFilter) error
+	SetBits() uint
+	FillRatio() float64
+	EstimatedCount() uint
+	EstimatedFalsePositiveRate() float64
 }
 
 type SimpleBloomFilter struct {
@@ -26,6 +101,8 @@ type SimpleBloomFilter struct {
 	HashFunctions uint
 	filter        Bitset
 	HashCache     *lru.LRUCacheInt32Array
+	hashScheme    HashScheme
+	hashProvider  HashProvider
 }
 
 // New Returns a pointer to a newly allocated `SimpleBloomFilter` object
@@ -35,6 +112,8 @@ func NewSimpleBF(maxSize uint, hashFuns uint) *SimpleBloomFilter {
 		hashFuns,
 		NewWFBitset(maxSize),
 		lru.NewInt32Array(int((float64(maxSize) * float64(0.1)))),
+		IndependentHashes,
+		MixedHashes,
 	}
 }
 
@@ -46,6 +125,22 @@ func NewByFailRate(items uint, probability float64) *SimpleBloomFilter {
 	return NewSimpleBF(m, k)
 }
 
+// NewByFailRateWithScheme works like NewByFailRate, but lets the caller pick
+// how bit indices are derived.
+func NewByFailRateWithScheme(items uint, probability float64, scheme HashScheme) *SimpleBloomFilter {
+	return NewByFailRateWithHash(items, probability, scheme, MixedHashes)
+}
+
+// NewByFailRateWithHash works like NewByFailRateWithScheme, but lets the
+// caller pick what keys are hashed with too.
+func NewByFailRateWithHash(items uint, probability float64, scheme HashScheme, provider HashProvider) *SimpleBloomFilter {
+	bf := NewByFailRate(items, probability)
+	bf.hashScheme = scheme
+	bf.hashProvider = provider
+
+	return bf
+}
+
 // GetMaxSize returns the max size. Just an ugly getter.
 func (bf *SimpleBloomFilter) GetMaxSize() uint {
 	return bf.maxSize
@@ -65,6 +160,26 @@ func (bf *SimpleBloomFilter) AddKey(key []byte) (bool, []uint) {
 	return true, hashIndexes
 }
 
+// AddKeys adds many keys to the bloom filter at once, e.g. when a snapshot is
+// loaded. The hash indices of every key are computed into the same scratch
+// space rather than allocated per key.
+func (bf *SimpleBloomFilter) AddKeys(keys [][]byte) {
+	scratch := make([]uint, bf.HashFunctions)
+
+	for _, key := range keys {
+		for _, index := range bf.hashKeyInto(key, scratch) {
+			bf.filter.Add(index)
+		}
+	}
+}
+
+// RemoveKey can't take keys out of a plain bloom filter, as a bit may be
+// shared with other keys. It always returns false; use a CountingBloomFilter
+// when keys need to be removed.
+func (bf *SimpleBloomFilter) RemoveKey(key []byte) bool {
+	return false
+}
+
 // HasKey verifies if a key is or isn't in the bloom filter.
 func (bf *SimpleBloomFilter) HasKey(key []byte) (bool, []uint) {
 	hashIndexes := bf.HashKey(key)
@@ -82,14 +197,69 @@ func (bf *SimpleBloomFilter) HasKey(key []byte) (bool, []uint) {
 
 // ConvertToString handles conversion of a bloom filter to a string. Moreover,
 // it enforces RLE encoding, so that fewer bytes are transferred per request.
+// The encoded filter is prefixed with a version header (e.g., "v1."), which
+// names the hash provider unless it's MixedHashes (e.g., "v1-xxhash.").
 func (bf *SimpleBloomFilter) Serialize() string {
-	return Encode(bf.filter.ToString())
+	return fmt.Sprintf(
+		"%s.%s",
+		withHash(fmt.Sprintf("v%d", SerializationVersion), bf.hashProvider),
+		Encode(bf.filter.ToString()),
+	)
 }
 
 // ConvertStringToBF Decodes the RLE'd bloom filter and then converts it to
-// an actual bloom filter in-memory.
+// an actual bloom filter in-memory. Filters with an unknown version header are
+// rejected with a VersionMismatchError.
 func Deserialize(inputString string, maxSize uint) (*SimpleBloomFilter, error) {
+	return DeserializeWithPolicy(inputString, maxSize, RejectMismatch)
+}
+
+// DeserializeWithPolicy works like Deserialize, but lets the caller decide how
+// a version mismatch is handled. Payloads without any version header were
+// written before versioning existed and share the v1 layout, so they're
+// always accepted. Counting filters are read as plain ones, without their
+// counters.
+func DeserializeWithPolicy(inputString string, maxSize uint, policy VersionPolicy) (*SimpleBloomFilter, error) {
+	return DeserializeWithHash(inputString, maxSize, policy, MixedHashes)
+}
+
+// DeserializeWithHash works like DeserializeWithPolicy, for filters hashed
+// with `provider`. A filter hashed with another provider is handled like a
+// version mismatch, with a HashMismatchError. Filters SerializeAs wrote with
+// a binary encoding are read too.
+func DeserializeWithHash(inputString string, maxSize uint, policy VersionPolicy, provider HashProvider) (*SimpleBloomFilter, error) {
 	bf := NewByFailRate(maxSize, 0.01)
+	bf.hashProvider = provider
+
+	inputString = strings.TrimSpace(inputString)
+	// '.' never shows up in RLE'd base64, so it unambiguously ends a header.
+	if headerEnd := strings.Index(inputString, "."); headerEnd >= 0 {
+		version, hashName := splitHeader(inputString[:headerEnd])
+		inputString = inputString[headerEnd+1:]
+
+		if version == binaryVersion {
+			return deserializeBinary(inputString, maxSize, policy, provider)
+		}
+
+		var err error
+		if version == countingVersion {
+			// Only the bits are needed here, the counters trail them.
+			inputString = strings.SplitN(inputString, ".", 2)[0]
+		} else if version != fmt.Sprintf("v%d", SerializationVersion) {
+			err = &VersionMismatchError{version}
+		}
+		if err == nil && hashName != provider.Name() {
+			err = &HashMismatchError{hashName, provider.Name()}
+		}
+
+		if err != nil {
+			if policy == IgnoreMismatch {
+				log.Println(err)
+				return bf, nil
+			}
+			return nil, err
+		}
+	}
 
 	sz := fmt.Sprintf("\"%s=\"", Decode(inputString))
 	bf.filter.FromString(sz)
@@ -133,10 +303,36 @@ func calculateHash(key []byte, offSet int) uint {
 // HashKey Takes a string in as an argument and hashes it several times to
 // create usable indexes for the bloom filter.
 func (bf *SimpleBloomFilter) HashKey(key []byte) []uint {
-	hashes := make([]uint, bf.HashFunctions)
+	return bf.hashKeyInto(key, make([]uint, bf.HashFunctions))
+}
+
+// hashKeyInto works like HashKey, but writes the indexes into `hashes`, which
+// must hold HashFunctions indexes.
+func (bf *SimpleBloomFilter) hashKeyInto(key []byte, hashes []uint) []uint {
+	if bf.hashScheme == DoubleHashing {
+		return bf.doubleHashKey(key, hashes)
+	}
+
+	for index := range hashes {
+		hashes[index] = bf.hashProvider.Hash(key, uint(index)) % uint(bf.GetMaxSize())
+	}
+
+	return hashes
+}
+
+// doubleHashKey derives every bit index from two base hashes.
+func (bf *SimpleBloomFilter) doubleHashKey(key []byte, hashes []uint) []uint {
+	maxSize := uint64(bf.GetMaxSize())
+
+	h1 := uint64(bf.hashProvider.Hash(key, 0)) % maxSize
+	h2 := uint64(bf.hashProvider.Hash(key, 1)) % maxSize
+	// A step of zero would put every index on the same bit.
+	if h2 == 0 {
+		h2 = 1
+	}
 
 	for index := range hashes {
-		hashes[index] = calculateHash(key, index) % uint(bf.GetMaxSize())
+		hashes[index] = uint((h1 + uint64(index)*h2) % maxSize)
 	}
 
 	return hashes
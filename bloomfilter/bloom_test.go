@@ -1,7 +1,9 @@
 package bloomfilter
 
 import (
+	"fmt"
 	"github.com/GrappigPanda/Olivia/config"
+	"strings"
 	"testing"
 )
 
@@ -110,3 +112,169 @@ func TestConvertWithContainedValues(t *testing.T) {
 		t.Fatalf("Two bfs are not equal")
 	}
 }
+
+func TestDeserializeUnknownVersion(t *testing.T) {
+	_, err := Deserialize("v99.A8JXEA95", uint(CONFIG.BloomfilterSize))
+	if err == nil {
+		t.Fatalf("Expected a version mismatch error, got nil")
+	}
+
+	mismatch, ok := err.(*VersionMismatchError)
+	if !ok {
+		t.Fatalf("Expected *VersionMismatchError, got %T: %v", err, err)
+	}
+
+	if mismatch.Version != "v99" {
+		t.Fatalf("Expected version v99, got %v", mismatch.Version)
+	}
+
+	if !strings.Contains(err.Error(), "unsupported version") {
+		t.Fatalf("Expected a descriptive error, got %v", err)
+	}
+}
+
+func TestDeserializeUnknownVersionIgnored(t *testing.T) {
+	bf, err := DeserializeWithPolicy(
+		"v99.A8JXEA95",
+		uint(CONFIG.BloomfilterSize),
+		IgnoreMismatch,
+	)
+	if err != nil {
+		t.Fatalf("Expected mismatch to be ignored, got %v", err)
+	}
+
+	if !bf.Compare(NewByFailRate(uint(CONFIG.BloomfilterSize), 0.01)) {
+		t.Fatalf("Expected an empty bloomfilter for an ignored mismatch")
+	}
+}
+
+func TestDeserializeUnversioned(t *testing.T) {
+	bf := NewByFailRate(uint(CONFIG.BloomfilterSize), 0.01)
+	bf.AddKey([]byte("key1"))
+
+	legacy := Encode(bf.filter.ToString())
+
+	new_bf, err := Deserialize(legacy, uint(CONFIG.BloomfilterSize))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !new_bf.Compare(bf) {
+		t.Fatalf("Two bfs are not equal")
+	}
+}
+
+func TestDoubleHashingMembership(t *testing.T) {
+	bf := NewByFailRateWithScheme(1000, 0.01, DoubleHashing)
+
+	for i := 0; i < 1000; i++ {
+		bf.AddKey([]byte(fmt.Sprintf("key%d", i)))
+	}
+
+	for i := 0; i < 1000; i++ {
+		if found, _ := bf.HasKey([]byte(fmt.Sprintf("key%d", i))); !found {
+			t.Fatalf("Expected key%d to be found", i)
+		}
+	}
+
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if found, _ := bf.HasKey([]byte(fmt.Sprintf("absent%d", i))); found {
+			falsePositives++
+		}
+	}
+
+	// Sized for a 1% false-positive rate, leave some slack.
+	if falsePositives > 300 {
+		t.Fatalf("Expected at most %v false positives, got %v", 300, falsePositives)
+	}
+}
+
+func TestDoubleHashingIndicesInRange(t *testing.T) {
+	bf := NewByFailRateWithScheme(1000, 0.01, DoubleHashing)
+
+	indices := bf.HashKey([]byte("key1"))
+	if uint(len(indices)) != bf.HashFunctions {
+		t.Fatalf("Expected %v indices, got %v", bf.HashFunctions, len(indices))
+	}
+
+	for _, index := range indices {
+		if index >= bf.GetMaxSize() {
+			t.Fatalf("Expected indices below %v, got %v", bf.GetMaxSize(), index)
+		}
+	}
+}
+
+func benchmarkHashScheme(b *testing.B, scheme HashScheme) {
+	bf := NewSimpleBF(100000, 20)
+	bf.hashScheme = scheme
+	key := []byte("a reasonably sized benchmark key")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bf.AddKey(key)
+		bf.HasKey(key)
+	}
+}
+
+func BenchmarkIndependentHashes(b *testing.B) {
+	benchmarkHashScheme(b, IndependentHashes)
+}
+
+func BenchmarkDoubleHashing(b *testing.B) {
+	benchmarkHashScheme(b, DoubleHashing)
+}
+
+func bulkKeys(count int) [][]byte {
+	keys := make([][]byte, count)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("key%d", i))
+	}
+
+	return keys
+}
+
+func TestAddKeysMatchesAddKey(t *testing.T) {
+	keys := bulkKeys(1000)
+
+	for _, scheme := range []HashScheme{IndependentHashes, DoubleHashing} {
+		bulk := NewByFailRateWithScheme(uint(CONFIG.BloomfilterSize), 0.01, scheme)
+		individual := NewByFailRateWithScheme(uint(CONFIG.BloomfilterSize), 0.01, scheme)
+
+		bulk.AddKeys(keys)
+		for _, key := range keys {
+			individual.AddKey(key)
+		}
+
+		if !bulk.Compare(individual) {
+			t.Fatalf("Expected AddKeys to set the same bits as AddKey")
+		}
+
+		for _, key := range keys {
+			if hasKey, _ := bulk.HasKey(key); !hasKey {
+				t.Fatalf("Expected %s to be in the bloom filter", key)
+			}
+		}
+	}
+}
+
+func BenchmarkAddKeys(b *testing.B) {
+	keys := bulkKeys(100000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NewByFailRate(100000, 0.01).AddKeys(keys)
+	}
+}
+
+func BenchmarkAddKeyIndividually(b *testing.B) {
+	keys := bulkKeys(100000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bf := NewByFailRate(100000, 0.01)
+		for _, key := range keys {
+			bf.AddKey(key)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package bloomfilter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxCount is the highest value a counter reaches: counters are 4 bits wide.
+// Saturated counters are never decremented again, as we no longer know how
+// many keys share the bit.
+const maxCount = 15
+
+// countingVersion is the header written by counting bloom filters. Nodes which
+// only want the bits (e.g., to route to the peer) read the payload like a v1
+// filter and disregard the counters.
+var countingVersion = fmt.Sprintf("v%dc", SerializationVersion)
+
+// counters packs a 4-bit counter per bit index, two to a byte.
+type counters []uint8
+
+func newCounters(size uint) counters {
+	return make(counters, (size+1)/2)
+}
+
+func (c counters) get(index uint) uint8 {
+	if index%2 == 0 {
+		return c[index/2] & 0x0f
+	}
+
+	return c[index/2] >> 4
+}
+
+func (c counters) set(index uint, count uint8) {
+	if index%2 == 0 {
+		c[index/2] = c[index/2]&0xf0 | count
+	} else {
+		c[index/2] = c[index/2]&0x0f | count<<4
+	}
+}
+
+// increment counts one more key against `index`, up to maxCount.
+func (c counters) increment(index uint) {
+	if count := c.get(index); count < maxCount {
+		c.set(index, count+1)
+	}
+}
+
+// CountingBloomFilter is a bloom filter which keeps a counter per bit index,
+// which allows keys to be removed again. A bit is cleared once the last key
+// hashing onto it is removed.
+type CountingBloomFilter struct {
+	*SimpleBloomFilter
+	counts counters
+	// countsLock guards the counters, which are packed two to a byte, and
+	// keeps a bit and its counter in step.
+	countsLock sync.Mutex
+}
+
+// NewCountingByFailRate works like NewByFailRate, but returns a bloom filter
+// which supports RemoveKey.
+func NewCountingByFailRate(items uint, probability float64) *CountingBloomFilter {
+	return NewCountingByFailRateWithScheme(items, probability, IndependentHashes)
+}
+
+// NewCountingByFailRateWithScheme works like NewCountingByFailRate, but lets
+// the caller pick how bit indices are derived.
+func NewCountingByFailRateWithScheme(items uint, probability float64, scheme HashScheme) *CountingBloomFilter {
+	return NewCountingByFailRateWithHash(items, probability, scheme, MixedHashes)
+}
+
+// NewCountingByFailRateWithHash works like NewCountingByFailRateWithScheme,
+// but lets the caller pick what keys are hashed with too.
+func NewCountingByFailRateWithHash(items uint, probability float64, scheme HashScheme, provider HashProvider) *CountingBloomFilter {
+	bf := NewByFailRateWithHash(items, probability, scheme, provider)
+
+	return &CountingBloomFilter{
+		SimpleBloomFilter: bf,
+		counts:            newCounters(bf.GetMaxSize()),
+	}
+}
+
+// AddKey adds a new key to the bloom filter, counting it against each of its
+// bit indices.
+func (bf *CountingBloomFilter) AddKey(key []byte) (bool, []uint) {
+	hashIndexes := bf.HashKey(key)
+
+	bf.countsLock.Lock()
+	defer bf.countsLock.Unlock()
+
+	for _, index := range hashIndexes {
+		bf.filter.Add(index)
+		bf.counts.increment(index)
+	}
+
+	return true, hashIndexes
+}
+
+// AddKeys adds many keys to the bloom filter at once, sharing the scratch
+// space for their hash indices.
+func (bf *CountingBloomFilter) AddKeys(keys [][]byte) {
+	scratch := make([]uint, bf.HashFunctions)
+
+	bf.countsLock.Lock()
+	defer bf.countsLock.Unlock()
+
+	for _, key := range keys {
+		for _, index := range bf.hashKeyInto(key, scratch) {
+			bf.filter.Add(index)
+			bf.counts.increment(index)
+		}
+	}
+}
+
+// RemoveKey takes a key back out of the bloom filter, clearing every bit no
+// other key hashes onto anymore. It returns false if the key wasn't in the
+// filter to begin with.
+func (bf *CountingBloomFilter) RemoveKey(key []byte) bool {
+	bf.countsLock.Lock()
+	defer bf.countsLock.Unlock()
+
+	hasKey, hashIndexes := bf.HasKey(key)
+	if !hasKey {
+		return false
+	}
+
+	for _, index := range hashIndexes {
+		count := bf.counts.get(index)
+		switch count {
+		case 0, maxCount:
+			continue
+		case 1:
+			bf.filter.Remove(index)
+		}
+		bf.counts.set(index, count-1)
+	}
+
+	return true
+}
+
+// Serialize converts the bloom filter to a string like SimpleBloomFilter does,
+// followed by the non-zero counters as `index_count` pairs in base 36.
+func (bf *CountingBloomFilter) Serialize() string {
+	bf.countsLock.Lock()
+	defer bf.countsLock.Unlock()
+
+	var counts []string
+	for index := uint(0); index < bf.GetMaxSize(); index++ {
+		count := bf.counts.get(index)
+		if count == 0 {
+			continue
+		}
+
+		counts = append(counts, fmt.Sprintf(
+			"%s_%s",
+			strconv.FormatUint(uint64(index), 36),
+			strconv.FormatUint(uint64(count), 36),
+		))
+	}
+
+	return fmt.Sprintf(
+		"%s.%s.%s",
+		withHash(countingVersion, bf.hashProvider),
+		Encode(bf.filter.ToString()),
+		strings.Join(counts, "-"),
+	)
+}
+
+// Compare returns if the two bloomfilters have the same bits set.
+func (bf *CountingBloomFilter) Compare(remote interface{}) bool {
+	return bf.filter.Compare(remote.(BloomFilter).GetStorage())
+}
+
+// DeserializeCounting converts a serialized counting bloom filter back into a
+// CountingBloomFilter. A plain v1 filter is accepted too, with every set bit
+// counted once.
+func DeserializeCounting(inputString string, maxSize uint) (*CountingBloomFilter, error) {
+	return DeserializeCountingWithHash(inputString, maxSize, MixedHashes)
+}
+
+// DeserializeCountingWithHash works like DeserializeCounting, for filters
+// hashed with `provider`.
+func DeserializeCountingWithHash(inputString string, maxSize uint, provider HashProvider) (*CountingBloomFilter, error) {
+	inputString = strings.TrimSpace(inputString)
+
+	counts := ""
+	parts := strings.SplitN(inputString, ".", 3)
+	if version, hashName := splitHeader(parts[0]); len(parts) > 1 && version == countingVersion {
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("Counting bloomfilter is missing its counters")
+		}
+		inputString = fmt.Sprintf(
+			"%s-%s.%s",
+			fmt.Sprintf("v%d", SerializationVersion),
+			hashName,
+			parts[1],
+		)
+		counts = parts[2]
+	}
+
+	simple, err := DeserializeWithHash(inputString, maxSize, RejectMismatch, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	bf := &CountingBloomFilter{
+		SimpleBloomFilter: simple,
+		counts:            newCounters(simple.GetMaxSize()),
+	}
+
+	if counts == "" {
+		for index := uint(0); index < bf.GetMaxSize(); index++ {
+			if bf.filter.IsSet(index) {
+				bf.counts.set(index, 1)
+			}
+		}
+
+		return bf, nil
+	}
+
+	for _, pair := range strings.Split(counts, "-") {
+		fields := strings.Split(pair, "_")
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("Invalid bloomfilter counter %q", pair)
+		}
+
+		index, err := strconv.ParseUint(fields[0], 36, 64)
+		if err != nil || index >= uint64(bf.GetMaxSize()) {
+			return nil, fmt.Errorf("Invalid bloomfilter counter %q", pair)
+		}
+
+		count, err := strconv.ParseUint(fields[1], 36, 8)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid bloomfilter counter %q", pair)
+		}
+
+		// Nodes with wider counters may send counts we can't hold,
+		// which we keep saturated.
+		if count > maxCount {
+			count = maxCount
+		}
+		bf.counts.set(uint(index), uint8(count))
+	}
+
+	return bf, nil
+}
@@ -0,0 +1,182 @@
+package bloomfilter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCountingRemoveKey(t *testing.T) {
+	bf := NewCountingByFailRate(uint(CONFIG.BloomfilterSize), 0.01)
+
+	bf.AddKey([]byte("TestKey"))
+	if hasKey, _ := bf.HasKey([]byte("TestKey")); !hasKey {
+		t.Fatalf("Expected TestKey to be in the bloom filter")
+	}
+
+	if !bf.RemoveKey([]byte("TestKey")) {
+		t.Fatalf("Expected RemoveKey to remove TestKey")
+	}
+
+	if hasKey, _ := bf.HasKey([]byte("TestKey")); hasKey {
+		t.Fatalf("Expected TestKey to be removed from the bloom filter")
+	}
+
+	if count := bf.GetStorage().Count(); count != 0 {
+		t.Fatalf("Expected 0, got %v", count)
+	}
+
+	if bf.RemoveKey([]byte("TestKey")) {
+		t.Fatalf("Expected removing a missing key to fail")
+	}
+}
+
+func TestCountingRemoveKeepsSharedBits(t *testing.T) {
+	bf := NewCountingByFailRateWithScheme(uint(CONFIG.BloomfilterSize), 0.01, DoubleHashing)
+
+	bf.AddKey([]byte("key1"))
+	bf.AddKey([]byte("key2"))
+	bf.AddKey([]byte("key2"))
+
+	bf.RemoveKey([]byte("key2"))
+	if hasKey, _ := bf.HasKey([]byte("key2")); !hasKey {
+		t.Fatalf("Expected key2 to be kept after removing one of two adds")
+	}
+
+	bf.RemoveKey([]byte("key2"))
+	if hasKey, _ := bf.HasKey([]byte("key1")); !hasKey {
+		t.Fatalf("Expected key1 to be kept after removing key2")
+	}
+}
+
+func TestSimpleRemoveKeyIsNoop(t *testing.T) {
+	bf := NewByFailRate(uint(CONFIG.BloomfilterSize), 0.01)
+
+	bf.AddKey([]byte("TestKey"))
+	if bf.RemoveKey([]byte("TestKey")) {
+		t.Fatalf("Expected a plain bloom filter not to remove keys")
+	}
+
+	if hasKey, _ := bf.HasKey([]byte("TestKey")); !hasKey {
+		t.Fatalf("Expected TestKey to be kept")
+	}
+}
+
+func TestCountingSerializationRoundTrip(t *testing.T) {
+	bf := NewCountingByFailRate(uint(CONFIG.BloomfilterSize), 0.01)
+
+	bf.AddKey([]byte("key1"))
+	bf.AddKey([]byte("key2"))
+	bf.AddKey([]byte("key2"))
+
+	result, err := DeserializeCounting(bf.Serialize(), uint(CONFIG.BloomfilterSize))
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+
+	if !bf.Compare(result) {
+		t.Fatalf("Expected the bits to round-trip")
+	}
+	for index := uint(0); index < bf.GetMaxSize(); index++ {
+		if bf.counts.get(index) != result.counts.get(index) {
+			t.Fatalf("Expected count %v at %d, got %v", bf.counts.get(index), index, result.counts.get(index))
+		}
+	}
+
+	result.RemoveKey([]byte("key2"))
+	result.RemoveKey([]byte("key2"))
+	if hasKey, _ := result.HasKey([]byte("key2")); hasKey {
+		t.Fatalf("Expected key2 to be removable after a round trip")
+	}
+	if hasKey, _ := result.HasKey([]byte("key1")); !hasKey {
+		t.Fatalf("Expected key1 to survive a round trip")
+	}
+}
+
+func TestDeserializeCountingAsPlain(t *testing.T) {
+	bf := NewCountingByFailRate(uint(CONFIG.BloomfilterSize), 0.01)
+	bf.AddKey([]byte("key1"))
+
+	result, err := Deserialize(bf.Serialize(), uint(CONFIG.BloomfilterSize))
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+
+	if !result.Compare(bf.SimpleBloomFilter) {
+		t.Fatalf("Expected a plain filter to read a counting filter's bits")
+	}
+}
+
+func TestCountingAddKeysMatchesAddKey(t *testing.T) {
+	keys := [][]byte{[]byte("key1"), []byte("key2"), []byte("key2")}
+
+	bulk := NewCountingByFailRate(uint(CONFIG.BloomfilterSize), 0.01)
+	individual := NewCountingByFailRate(uint(CONFIG.BloomfilterSize), 0.01)
+
+	bulk.AddKeys(keys)
+	for _, key := range keys {
+		individual.AddKey(key)
+	}
+
+	if bulk.Serialize() != individual.Serialize() {
+		t.Fatalf("Expected AddKeys to count keys like AddKey")
+	}
+}
+
+func TestCountersSaturate(t *testing.T) {
+	bf := NewCountingByFailRate(uint(CONFIG.BloomfilterSize), 0.01)
+	if size := uint(len(bf.counts)); size != (bf.GetMaxSize()+1)/2 {
+		t.Fatalf("Expected %v, got %v", (bf.GetMaxSize()+1)/2, size)
+	}
+
+	for i := 0; i < maxCount+2; i++ {
+		bf.AddKey([]byte("key1"))
+	}
+	_, indices := bf.HasKey([]byte("key1"))
+	for _, index := range indices {
+		if count := bf.counts.get(index); count != maxCount {
+			t.Fatalf("Expected %v, got %v", maxCount, count)
+		}
+	}
+
+	// A saturated key can't be removed, as its count is lost.
+	for i := 0; i < maxCount+2; i++ {
+		bf.RemoveKey([]byte("key1"))
+	}
+	if hasKey, _ := bf.HasKey([]byte("key1")); !hasKey {
+		t.Fatalf("Expected a saturated key to be kept")
+	}
+}
+
+func TestCountersDontSpillIntoNeighbours(t *testing.T) {
+	c := newCounters(4)
+	c.set(0, maxCount)
+	c.increment(1)
+	c.set(2, 3)
+
+	if c.get(0) != maxCount || c.get(1) != 1 || c.get(2) != 3 || c.get(3) != 0 {
+		t.Fatalf("Expected [15 1 3 0], got [%v %v %v %v]", c.get(0), c.get(1), c.get(2), c.get(3))
+	}
+}
+
+func TestDeserializeCountingClampsWideCounters(t *testing.T) {
+	bf := NewCountingByFailRate(uint(CONFIG.BloomfilterSize), 0.01)
+	bf.AddKey([]byte("key1"))
+	_, indices := bf.HasKey([]byte("key1"))
+
+	serialized := bf.Serialize()
+	serialized = serialized[:strings.LastIndex(serialized, ".")+1] + fmt.Sprintf(
+		"%s_%s",
+		strconv.FormatUint(uint64(indices[0]), 36),
+		strconv.FormatUint(200, 36),
+	)
+
+	result, err := DeserializeCounting(serialized, uint(CONFIG.BloomfilterSize))
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	if count := result.counts.get(indices[0]); count != maxCount {
+		t.Fatalf("Expected %v, got %v", maxCount, count)
+	}
+}
@@ -0,0 +1,288 @@
+package bloomfilter
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+const (
+	// cuckooBucketSize is how many fingerprints a bucket holds.
+	cuckooBucketSize = 4
+	// cuckooMaxKicks is how many fingerprints an insert relocates before
+	// giving up on the filter being full.
+	cuckooMaxKicks = 500
+	// cuckooLoadFactor is how full a cuckoo filter is sized to get.
+	cuckooLoadFactor = 0.95
+)
+
+// cuckooVersion is the header written by cuckoo filters.
+var cuckooVersion = fmt.Sprintf("v%dk", SerializationVersion)
+
+// CuckooFilter is a cuckoo filter (Fan et al., "Cuckoo Filter: Practically
+// Better Than Bloom"): every key is stored as a short fingerprint in one of two
+// buckets, either of which can be found from the other and the fingerprint.
+// Unlike a bloom filter, keys can be deleted without counters, and for false
+// positive rates below about 3% it takes less space.
+type CuckooFilter struct {
+	buckets [][cuckooBucketSize]uint16
+	// fingerprintBits is how many bits of every fingerprint are kept.
+	fingerprintBits uint
+	count           uint
+	// victim holds the fingerprint an insert couldn't place, so it isn't
+	// lost. The filter takes no more keys while it's held.
+	victim       uint16
+	victimBucket uint
+}
+
+// NewCuckooByFailRate returns a cuckoo filter sized for `items` keys with a
+// false positive rate of about `probability`. Fingerprints are at most 16
+// bits, so rates below about 0.01% aren't reached.
+func NewCuckooByFailRate(items uint, probability float64) *CuckooFilter {
+	// A lookup compares against 2 * cuckooBucketSize fingerprints.
+	bits := uint(math.Ceil(math.Log2(2 * cuckooBucketSize / probability)))
+	if bits < 4 {
+		bits = 4
+	}
+	if bits > 16 {
+		bits = 16
+	}
+
+	buckets := uint(1)
+	for float64(buckets*cuckooBucketSize)*cuckooLoadFactor < float64(items) {
+		buckets *= 2
+	}
+
+	return newCuckooFilter(buckets, bits)
+}
+
+func newCuckooFilter(buckets uint, fingerprintBits uint) *CuckooFilter {
+	return &CuckooFilter{
+		buckets:         make([][cuckooBucketSize]uint16, buckets),
+		fingerprintBits: fingerprintBits,
+	}
+}
+
+// locate returns the key's fingerprint and the two buckets it may be in.
+func (cf *CuckooFilter) locate(key []byte) (uint16, uint, uint) {
+	hasher := fnv.New64a()
+	hasher.Write(key)
+	hash := hasher.Sum64()
+
+	fingerprint := uint16(hash>>32) & uint16(uint32(1)<<cf.fingerprintBits-1)
+	// An empty slot is a zero fingerprint.
+	if fingerprint == 0 {
+		fingerprint = 1
+	}
+
+	first := uint(hash) & uint(len(cf.buckets)-1)
+	return fingerprint, first, cf.alternate(first, fingerprint)
+}
+
+// alternate returns the other bucket `fingerprint` may be in. It's its own
+// inverse, so either bucket leads to the other.
+func (cf *CuckooFilter) alternate(bucket uint, fingerprint uint16) uint {
+	// The fingerprint is mixed like murmur3 finishes its hashes, so every
+	// bit of it moves the bucket.
+	mixed := uint32(fingerprint) * 0x5bd1e995
+	mixed ^= mixed >> 15
+
+	return (bucket ^ uint(mixed)) & uint(len(cf.buckets)-1)
+}
+
+func (cf *CuckooFilter) place(bucket uint, fingerprint uint16) bool {
+	for slot, stored := range cf.buckets[bucket] {
+		if stored == 0 {
+			cf.buckets[bucket][slot] = fingerprint
+			return true
+		}
+	}
+
+	return false
+}
+
+func (cf *CuckooFilter) holds(bucket uint, fingerprint uint16) bool {
+	for _, stored := range cf.buckets[bucket] {
+		if stored == fingerprint {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Insert adds a key to the filter, relocating the fingerprints in its way.
+// It returns false once the filter is too full to take the key, in which case
+// the filter should be rebuilt larger. Inserting a key twice stores it twice.
+func (cf *CuckooFilter) Insert(key []byte) bool {
+	if cf.victim != 0 {
+		return false
+	}
+
+	fingerprint, first, second := cf.locate(key)
+	if cf.place(first, fingerprint) || cf.place(second, fingerprint) {
+		cf.count++
+		return true
+	}
+
+	bucket := first
+	if rand.Intn(2) == 1 {
+		bucket = second
+	}
+	for kick := 0; kick < cuckooMaxKicks; kick++ {
+		slot := rand.Intn(cuckooBucketSize)
+		fingerprint, cf.buckets[bucket][slot] = cf.buckets[bucket][slot], fingerprint
+
+		bucket = cf.alternate(bucket, fingerprint)
+		if cf.place(bucket, fingerprint) {
+			cf.count++
+			return true
+		}
+	}
+
+	// Whichever fingerprint was kicked out last is kept aside, so every key
+	// inserted so far is still found.
+	cf.victim = fingerprint
+	cf.victimBucket = bucket
+	cf.count++
+
+	return true
+}
+
+// Lookup reports whether the key is probably in the filter.
+func (cf *CuckooFilter) Lookup(key []byte) bool {
+	fingerprint, first, second := cf.locate(key)
+	if cf.holds(first, fingerprint) || cf.holds(second, fingerprint) {
+		return true
+	}
+
+	return cf.victim == fingerprint &&
+		(cf.victimBucket == first || cf.victimBucket == second)
+}
+
+// Delete takes a key which was inserted back out of the filter. Deleting a
+// key which never was may delete another key sharing its fingerprint.
+func (cf *CuckooFilter) Delete(key []byte) bool {
+	fingerprint, first, second := cf.locate(key)
+
+	for _, bucket := range []uint{first, second} {
+		for slot, stored := range cf.buckets[bucket] {
+			if stored == fingerprint {
+				cf.buckets[bucket][slot] = 0
+				cf.count--
+				cf.reinsertVictim()
+				return true
+			}
+		}
+	}
+
+	if cf.victim == fingerprint && (cf.victimBucket == first || cf.victimBucket == second) {
+		cf.victim = 0
+		cf.count--
+		return true
+	}
+
+	return false
+}
+
+// reinsertVictim tries to place the fingerprint kept aside again, now a slot
+// was freed.
+func (cf *CuckooFilter) reinsertVictim() {
+	if cf.victim == 0 {
+		return
+	}
+
+	fingerprint, bucket := cf.victim, cf.victimBucket
+	if cf.place(bucket, fingerprint) || cf.place(cf.alternate(bucket, fingerprint), fingerprint) {
+		cf.victim = 0
+	}
+}
+
+// Count returns how many keys the filter holds.
+func (cf *CuckooFilter) Count() uint {
+	return cf.count
+}
+
+// Capacity returns how many fingerprints the filter has room for.
+func (cf *CuckooFilter) Capacity() uint {
+	return uint(len(cf.buckets)) * cuckooBucketSize
+}
+
+// Serialize converts the filter to a string: its bucket count, fingerprint
+// size, key count and victim, followed by its fingerprints in base64 (e.g.,
+// "v1k.400.a.2s.0-0.<fingerprints>").
+func (cf *CuckooFilter) Serialize() string {
+	fingerprints := make([]byte, len(cf.buckets)*cuckooBucketSize*2)
+	for i, bucket := range cf.buckets {
+		for slot, fingerprint := range bucket {
+			binary.LittleEndian.PutUint16(fingerprints[(i*cuckooBucketSize+slot)*2:], fingerprint)
+		}
+	}
+
+	return fmt.Sprintf(
+		"%s.%s.%s.%s.%s-%s.%s",
+		cuckooVersion,
+		strconv.FormatUint(uint64(len(cf.buckets)), 36),
+		strconv.FormatUint(uint64(cf.fingerprintBits), 36),
+		strconv.FormatUint(uint64(cf.count), 36),
+		strconv.FormatUint(uint64(cf.victim), 36),
+		strconv.FormatUint(uint64(cf.victimBucket), 36),
+		base64.RawURLEncoding.EncodeToString(fingerprints),
+	)
+}
+
+// DeserializeCuckoo converts a serialized cuckoo filter back into a
+// CuckooFilter.
+func DeserializeCuckoo(inputString string) (*CuckooFilter, error) {
+	parts := strings.Split(strings.TrimSpace(inputString), ".")
+	if parts[0] != cuckooVersion {
+		return nil, &VersionMismatchError{parts[0]}
+	}
+	if len(parts) != 6 {
+		return nil, fmt.Errorf("Invalid cuckoo filter")
+	}
+
+	victim := strings.Split(parts[4], "-")
+	if len(victim) != 2 {
+		return nil, fmt.Errorf("Invalid cuckoo filter victim %q", parts[4])
+	}
+
+	var fields [5]uint64
+	for i, field := range []string{parts[1], parts[2], parts[3], victim[0], victim[1]} {
+		value, err := strconv.ParseUint(field, 36, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid cuckoo filter field %q", field)
+		}
+		fields[i] = value
+	}
+
+	buckets, bits := uint(fields[0]), uint(fields[1])
+	if buckets == 0 || buckets&(buckets-1) != 0 || bits == 0 || bits > 16 {
+		return nil, fmt.Errorf("Invalid cuckoo filter shape %d buckets of %d bits", buckets, bits)
+	}
+	if fields[3] > math.MaxUint16 || fields[4] >= uint64(buckets) {
+		return nil, fmt.Errorf("Invalid cuckoo filter victim %q", parts[4])
+	}
+
+	fingerprints, err := base64.RawURLEncoding.DecodeString(parts[5])
+	if err != nil || uint(len(fingerprints)) != buckets*cuckooBucketSize*2 {
+		return nil, fmt.Errorf("Invalid cuckoo filter fingerprints")
+	}
+
+	cf := newCuckooFilter(buckets, bits)
+	for i := range cf.buckets {
+		for slot := range cf.buckets[i] {
+			cf.buckets[i][slot] = binary.LittleEndian.Uint16(fingerprints[(i*cuckooBucketSize+slot)*2:])
+		}
+	}
+	cf.count = uint(fields[2])
+	cf.victim = uint16(fields[3])
+	cf.victimBucket = uint(fields[4])
+
+	return cf, nil
+}
@@ -0,0 +1,102 @@
+package bloomfilter
+
+import (
+	"fmt"
+	"testing"
+)
+
+var _ Filter = NewCuckooByFailRate(100, 0.01)
+var _ Filter = NewCountingByFailRate(100, 0.01)
+
+func TestCuckooInsertLookupDelete(t *testing.T) {
+	cf := NewCuckooByFailRate(1000, 0.01)
+
+	for i := 0; i < 1000; i++ {
+		if !cf.Insert([]byte(fmt.Sprintf("key%d", i))) {
+			t.Fatalf("Expected key%d to fit", i)
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		if !cf.Lookup([]byte(fmt.Sprintf("key%d", i))) {
+			t.Fatalf("Expected key%d to be in the cuckoo filter", i)
+		}
+	}
+
+	for i := 0; i < 500; i++ {
+		if !cf.Delete([]byte(fmt.Sprintf("key%d", i))) {
+			t.Fatalf("Expected key%d to be deleted", i)
+		}
+	}
+	if cf.Count() != 500 {
+		t.Fatalf("Expected %v, got %v", 500, cf.Count())
+	}
+	for i := 500; i < 1000; i++ {
+		if !cf.Lookup([]byte(fmt.Sprintf("key%d", i))) {
+			t.Fatalf("Expected key%d to be kept", i)
+		}
+	}
+
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if cf.Lookup([]byte(fmt.Sprintf("missing%d", i))) {
+			falsePositives++
+		}
+	}
+	if rate := float64(falsePositives) / 10000; rate > 0.01 {
+		t.Fatalf("Expected a false positive rate below %v, got %v", 0.01, rate)
+	}
+}
+
+func TestCuckooRefusesKeysOnceFull(t *testing.T) {
+	cf := NewCuckooByFailRate(8, 0.01)
+
+	inserted := 0
+	for ; inserted < 1000; inserted++ {
+		if !cf.Insert([]byte(fmt.Sprintf("key%d", inserted))) {
+			break
+		}
+	}
+	if inserted == 1000 || inserted > int(cf.Capacity())+1 {
+		t.Fatalf("Expected the filter to fill up around %v keys, took %v", cf.Capacity(), inserted)
+	}
+
+	// Every key it took is still found.
+	for i := 0; i < inserted; i++ {
+		if !cf.Lookup([]byte(fmt.Sprintf("key%d", i))) {
+			t.Fatalf("Expected key%d to be in the cuckoo filter", i)
+		}
+	}
+}
+
+func TestCuckooSerializationRoundTrip(t *testing.T) {
+	cf := NewCuckooByFailRate(100, 0.01)
+	for i := 0; i < 100; i++ {
+		cf.Insert([]byte(fmt.Sprintf("key%d", i)))
+	}
+
+	result, err := DeserializeCuckoo(cf.Serialize())
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	if result.Serialize() != cf.Serialize() {
+		t.Fatalf("Expected the filter to round-trip")
+	}
+	for i := 0; i < 100; i++ {
+		if !result.Lookup([]byte(fmt.Sprintf("key%d", i))) {
+			t.Fatalf("Expected key%d to survive a round trip", i)
+		}
+	}
+
+	if _, err := DeserializeCuckoo(NewByFailRate(100, 0.01).Serialize()); err == nil {
+		t.Fatalf("Expected a bloom filter to be refused")
+	}
+}
+
+func TestParseFilterKind(t *testing.T) {
+	if kind := ParseFilterKind("Cuckoo"); kind != CuckooFilterKind {
+		t.Fatalf("Expected %v, got %v", CuckooFilterKind, kind)
+	}
+	if kind := ParseFilterKind("anything"); kind != BloomFilterKind {
+		t.Fatalf("Expected %v, got %v", BloomFilterKind, kind)
+	}
+}
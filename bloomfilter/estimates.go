@@ -0,0 +1,113 @@
+package bloomfilter
+
+import (
+	"math"
+)
+
+// mixedDistinctHashes is how many distinct hash functions MixedHashes has:
+// every hash function past the third is FNV again.
+const mixedDistinctHashes = 3
+
+// distinctHashes returns how many distinct bits a key sets at most, which is
+// fewer than HashFunctions when MixedHashes hashes every index on its own.
+func (bf *SimpleBloomFilter) distinctHashes() uint {
+	if bf.hashScheme == IndependentHashes &&
+		(bf.hashProvider == nil || bf.hashProvider.Name() == MixedHashes.Name()) &&
+		bf.HashFunctions > mixedDistinctHashes {
+		return mixedDistinctHashes
+	}
+
+	return bf.HashFunctions
+}
+
+// SetBits returns how many of the filter's bits are set.
+func (bf *SimpleBloomFilter) SetBits() uint {
+	return bf.filter.Count()
+}
+
+// FillRatio returns which fraction of the filter's bits are set.
+func (bf *SimpleBloomFilter) FillRatio() float64 {
+	size := bf.filter.Len()
+	if size == 0 {
+		return 0
+	}
+
+	return float64(bf.SetBits()) / float64(size)
+}
+
+// EstimatedCount estimates how many distinct keys the filter holds from how
+// many of its bits are set (Swamidass & Baldi): -m/k * ln(1 - X/m).
+func (bf *SimpleBloomFilter) EstimatedCount() uint {
+	fill := bf.FillRatio()
+	hashes := bf.distinctHashes()
+	if fill == 0 || hashes == 0 {
+		return 0
+	}
+	if fill == 1 {
+		// Past here the estimate diverges, any number of keys fit.
+		fill = float64(bf.filter.Len()-1) / float64(bf.filter.Len())
+	}
+
+	size := float64(bf.filter.Len())
+	return uint(math.Round(-size / float64(hashes) * math.Log(1-fill)))
+}
+
+// EstimatedFalsePositiveRate estimates the chance that a key the filter
+// doesn't hold is claimed anyway, from how many of its bits are set: every
+// one of the key's bits has to be set already.
+func (bf *SimpleBloomFilter) EstimatedFalsePositiveRate() float64 {
+	return math.Pow(bf.FillRatio(), float64(bf.distinctHashes()))
+}
+
+// SetBits returns how many bits are set across every stage.
+func (bf *ScalableBloomFilter) SetBits() uint {
+	stages, _ := bf.snapshot()
+
+	var setBits uint
+	for _, stage := range stages {
+		setBits += stage.SetBits()
+	}
+
+	return setBits
+}
+
+// FillRatio returns which fraction of the bits of every stage are set.
+func (bf *ScalableBloomFilter) FillRatio() float64 {
+	stages, _ := bf.snapshot()
+
+	var size, setBits uint
+	for _, stage := range stages {
+		size += stage.filter.Len()
+		setBits += stage.SetBits()
+	}
+	if size == 0 {
+		return 0
+	}
+
+	return float64(setBits) / float64(size)
+}
+
+// EstimatedCount adds up the estimates of every stage.
+func (bf *ScalableBloomFilter) EstimatedCount() uint {
+	stages, _ := bf.snapshot()
+
+	var count uint
+	for _, stage := range stages {
+		count += stage.EstimatedCount()
+	}
+
+	return count
+}
+
+// EstimatedFalsePositiveRate estimates the chance that any stage claims a
+// key the filter doesn't hold.
+func (bf *ScalableBloomFilter) EstimatedFalsePositiveRate() float64 {
+	stages, _ := bf.snapshot()
+
+	missed := 1.0
+	for _, stage := range stages {
+		missed *= 1 - stage.EstimatedFalsePositiveRate()
+	}
+
+	return 1 - missed
+}
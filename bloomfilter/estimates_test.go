@@ -0,0 +1,63 @@
+package bloomfilter
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestEstimatedCount(t *testing.T) {
+	for _, scheme := range []HashScheme{IndependentHashes, DoubleHashing} {
+		bf := NewByFailRateWithScheme(1000, 0.01, scheme)
+		if bf.EstimatedCount() != 0 || bf.EstimatedFalsePositiveRate() != 0 {
+			t.Fatalf("Expected an empty filter to be estimated empty")
+		}
+
+		for i := 0; i < 500; i++ {
+			bf.AddKey([]byte(fmt.Sprintf("key%d", i)))
+		}
+
+		if estimate := bf.EstimatedCount(); estimate < 450 || estimate > 550 {
+			t.Fatalf("Expected about 500 keys, got %d (scheme %v)", estimate, scheme)
+		}
+		if bf.SetBits() == 0 || bf.FillRatio() != float64(bf.SetBits())/float64(bf.GetMaxSize()) {
+			t.Fatalf("Expected %d of %d bits to be set, got a ratio of %v", bf.SetBits(), bf.GetMaxSize(), bf.FillRatio())
+		}
+	}
+}
+
+func TestEstimatedFalsePositiveRateMatchesMeasured(t *testing.T) {
+	bf := NewByFailRateWithScheme(1000, 0.01, DoubleHashing)
+	for i := 0; i < 2000; i++ {
+		bf.AddKey([]byte(fmt.Sprintf("key%d", i)))
+	}
+
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if ok, _ := bf.HasKey([]byte(fmt.Sprintf("absent%d", i))); ok {
+			falsePositives++
+		}
+	}
+
+	measured := float64(falsePositives) / 10000
+	if estimate := bf.EstimatedFalsePositiveRate(); math.Abs(estimate-measured) > 0.03 {
+		t.Fatalf("Expected about %v, got %v", measured, estimate)
+	}
+	if bf.EstimatedFalsePositiveRate() < 0.05 {
+		t.Fatalf("Expected an overfilled filter's rate to be past what it was sized for, got %v", bf.EstimatedFalsePositiveRate())
+	}
+}
+
+func TestScalableEstimates(t *testing.T) {
+	bf := NewScalableByFailRateWithScheme(100, 0.01, DoubleHashing)
+	for i := 0; i < 1000; i++ {
+		bf.AddKey([]byte(fmt.Sprintf("key%d", i)))
+	}
+
+	if estimate := bf.EstimatedCount(); estimate < 900 || estimate > 1100 {
+		t.Fatalf("Expected about 1000 keys, got %d", estimate)
+	}
+	if rate := bf.EstimatedFalsePositiveRate(); rate <= 0 || rate > 0.02 {
+		t.Fatalf("Expected a rate below 0.02, got %v", rate)
+	}
+}
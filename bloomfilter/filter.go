@@ -0,0 +1,80 @@
+package bloomfilter
+
+import (
+	"strings"
+)
+
+// Filter is what bloom filters and cuckoo filters share: a set of keys which
+// may claim to hold keys it doesn't, but never misses a key it was given.
+type Filter interface {
+	Insert(key []byte) bool
+	Lookup(key []byte) bool
+	Delete(key []byte) bool
+	Serialize() string
+}
+
+// FilterKind picks which Filter nodes exchange to route remote gets by.
+type FilterKind int
+
+const (
+	// BloomFilterKind routes by bloom filters, searched by bit index.
+	BloomFilterKind FilterKind = iota
+	// CuckooFilterKind routes by cuckoo filters, looked up per peer.
+	CuckooFilterKind
+)
+
+// ParseFilterKind converts the config representation of a FilterKind.
+// Anything unrecognized falls back to BloomFilterKind.
+func ParseFilterKind(kind string) FilterKind {
+	switch strings.ToLower(kind) {
+	case "cuckoo":
+		return CuckooFilterKind
+	default:
+		return BloomFilterKind
+	}
+}
+
+// Insert adds a key to the bloom filter, see AddKey.
+func (bf *SimpleBloomFilter) Insert(key []byte) bool {
+	added, _ := bf.AddKey(key)
+	return added
+}
+
+// Lookup reports whether the key is probably in the bloom filter.
+func (bf *SimpleBloomFilter) Lookup(key []byte) bool {
+	hasKey, _ := bf.HasKey(key)
+	return hasKey
+}
+
+// Delete is RemoveKey, which a plain bloom filter can't do.
+func (bf *SimpleBloomFilter) Delete(key []byte) bool {
+	return bf.RemoveKey(key)
+}
+
+// Insert adds a key to the bloom filter, see AddKey.
+func (bf *CountingBloomFilter) Insert(key []byte) bool {
+	added, _ := bf.AddKey(key)
+	return added
+}
+
+// Delete takes a key back out of the bloom filter, see RemoveKey.
+func (bf *CountingBloomFilter) Delete(key []byte) bool {
+	return bf.RemoveKey(key)
+}
+
+// Insert adds a key to the bloom filter, see AddKey.
+func (bf *ScalableBloomFilter) Insert(key []byte) bool {
+	added, _ := bf.AddKey(key)
+	return added
+}
+
+// Lookup reports whether the key is probably in the bloom filter.
+func (bf *ScalableBloomFilter) Lookup(key []byte) bool {
+	hasKey, _ := bf.HasKey(key)
+	return hasKey
+}
+
+// Delete is RemoveKey, which a scalable bloom filter can't do.
+func (bf *ScalableBloomFilter) Delete(key []byte) bool {
+	return bf.RemoveKey(key)
+}
@@ -0,0 +1,131 @@
+package bloomfilter
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/spaolacci/murmur3"
+	"hash/fnv"
+	"strings"
+)
+
+// HashProvider hashes keys for a bloom filter. A key's successive hash
+// functions are Hash with seeds 0, 1, 2 and so on (only 0 and 1 with
+// DoubleHashing). Every node in a cluster has to hash alike, so a filter's
+// provider is named in its serialized header.
+type HashProvider interface {
+	// Name is how the provider is configured and named in serialized
+	// filters.
+	Name() string
+	Hash(key []byte, seed uint) uint
+}
+
+var (
+	// MixedHashes hashes with FNV, murmur3 and Jenkins for the first three
+	// hash functions and FNV past them. It's what filters hash with unless
+	// told otherwise, and its filters are serialized without a hash name,
+	// like every filter was before providers existed.
+	MixedHashes HashProvider = mixedHashes{}
+	// Murmur3Hashes hashes with 32-bit murmur3, seeded per hash function.
+	Murmur3Hashes HashProvider = murmur3Hashes{}
+	// XXHashes hashes with XXH64, seeded per hash function.
+	XXHashes HashProvider = xxHashes{}
+	// FNVHashes hashes with 64-bit FNV-1a over the seed and the key.
+	FNVHashes HashProvider = fnvHashes{}
+)
+
+var hashProviders = map[string]HashProvider{
+	MixedHashes.Name():   MixedHashes,
+	Murmur3Hashes.Name(): Murmur3Hashes,
+	XXHashes.Name():      XXHashes,
+	FNVHashes.Name():     FNVHashes,
+}
+
+// ParseHashProvider converts the config representation of a HashProvider.
+// Anything unrecognized falls back to MixedHashes.
+func ParseHashProvider(name string) HashProvider {
+	if provider, ok := hashProviders[strings.ToLower(name)]; ok {
+		return provider
+	}
+
+	return MixedHashes
+}
+
+// HashMismatchError is returned when a serialized bloom filter was hashed with
+// another provider than the one expected, so its bits don't line up with the
+// indices we'd look up.
+type HashMismatchError struct {
+	Hash     string
+	Expected string
+}
+
+func (e *HashMismatchError) Error() string {
+	return fmt.Sprintf(
+		"bloomfilter hashed with %q (expected %q)",
+		e.Hash,
+		e.Expected,
+	)
+}
+
+// withHash appends the provider's name to a serialized filter's version
+// header, unless it's MixedHashes.
+func withHash(version string, provider HashProvider) string {
+	if provider == nil || provider.Name() == MixedHashes.Name() {
+		return version
+	}
+
+	return fmt.Sprintf("%s-%s", version, provider.Name())
+}
+
+// splitHeader splits a serialized filter's header into its version and the
+// name of the hash provider, MixedHashes' when none is named.
+func splitHeader(header string) (string, string) {
+	if dash := strings.Index(header, "-"); dash >= 0 {
+		return header[:dash], header[dash+1:]
+	}
+
+	return header, MixedHashes.Name()
+}
+
+type mixedHashes struct{}
+
+func (mixedHashes) Name() string { return "mixed" }
+
+func (mixedHashes) Hash(key []byte, seed uint) uint {
+	return calculateHash(key, int(seed))
+}
+
+type murmur3Hashes struct{}
+
+func (murmur3Hashes) Name() string { return "murmur3" }
+
+func (murmur3Hashes) Hash(key []byte, seed uint) uint {
+	// Sum32WithSeed walks the key with uintptr arithmetic, which the race
+	// detector's pointer checks refuse.
+	hasher := murmur3.New32WithSeed(uint32(seed))
+	hasher.Write(key)
+
+	return uint(hasher.Sum32())
+}
+
+type xxHashes struct{}
+
+func (xxHashes) Name() string { return "xxhash" }
+
+func (xxHashes) Hash(key []byte, seed uint) uint {
+	return uint(xxHash64(key, uint64(seed)))
+}
+
+type fnvHashes struct{}
+
+func (fnvHashes) Name() string { return "fnv" }
+
+func (fnvHashes) Hash(key []byte, seed uint) uint {
+	var seedBytes [8]byte
+	binary.LittleEndian.PutUint64(seedBytes[:], uint64(seed))
+
+	hasher := fnv.New64a()
+	hasher.Write(seedBytes[:])
+	hasher.Write(key)
+
+	return uint(hasher.Sum64())
+}
@@ -0,0 +1,87 @@
+package bloomfilter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestXXHash64(t *testing.T) {
+	// Reference values from the xxHash test suite.
+	cases := []struct {
+		input    string
+		seed     uint64
+		expected uint64
+	}{
+		{"", 0, 0xef46db3751d8e999},
+		{"a", 0, 0xd24ec4f1a98c6e5b},
+		{"abc", 0, 0x44bc2cf5ad770999},
+		{"Nobody inspects the spammish repetition", 0, 0xfbcea83c8a378bf1},
+	}
+
+	for _, c := range cases {
+		if got := xxHash64([]byte(c.input), c.seed); got != c.expected {
+			t.Fatalf("Expected %x for %q, got %x", c.expected, c.input, got)
+		}
+	}
+}
+
+func TestHashProvidersRoundTrip(t *testing.T) {
+	for _, provider := range []HashProvider{MixedHashes, Murmur3Hashes, XXHashes, FNVHashes} {
+		for _, scheme := range []HashScheme{IndependentHashes, DoubleHashing} {
+			bf := NewCountingByFailRateWithHash(uint(CONFIG.BloomfilterSize), 0.01, scheme, provider)
+			bf.AddKey([]byte("key1"))
+
+			result, err := DeserializeWithHash(bf.Serialize(), uint(CONFIG.BloomfilterSize), RejectMismatch, provider)
+			if err != nil {
+				t.Fatalf("Expected nil, got %v", err)
+			}
+			result.hashScheme = scheme
+			if !result.Lookup([]byte("key1")) {
+				t.Fatalf("Expected key1 to survive a round trip with %v", provider.Name())
+			}
+
+			counting, err := DeserializeCountingWithHash(bf.Serialize(), uint(CONFIG.BloomfilterSize), provider)
+			if err != nil || !counting.Compare(bf) {
+				t.Fatalf("Expected the counting filter to round-trip with %v (%v)", provider.Name(), err)
+			}
+		}
+	}
+}
+
+func TestHashProviderNamedInHeader(t *testing.T) {
+	if header := NewByFailRate(100, 0.01).Serialize(); !strings.HasPrefix(header, "v1.") {
+		t.Fatalf("Expected the mixed hashes not to be named, got %v", header[:4])
+	}
+
+	bf := NewByFailRateWithHash(100, 0.01, IndependentHashes, XXHashes)
+	if header := bf.Serialize(); !strings.HasPrefix(header, "v1-xxhash.") {
+		t.Fatalf("Expected %v, got %v", "v1-xxhash.", header[:10])
+	}
+}
+
+func TestHashMismatchIsRefused(t *testing.T) {
+	bf := NewByFailRateWithHash(uint(CONFIG.BloomfilterSize), 0.01, IndependentHashes, XXHashes)
+	bf.AddKey([]byte("key1"))
+
+	_, err := DeserializeWithHash(bf.Serialize(), uint(CONFIG.BloomfilterSize), RejectMismatch, Murmur3Hashes)
+	if _, ok := err.(*HashMismatchError); !ok {
+		t.Fatalf("Expected a HashMismatchError, got %v", err)
+	}
+	if _, err := Deserialize(bf.Serialize(), uint(CONFIG.BloomfilterSize)); err == nil {
+		t.Fatalf("Expected a filter hashed with xxhash to be refused by default")
+	}
+
+	ignored, err := DeserializeWithHash(bf.Serialize(), uint(CONFIG.BloomfilterSize), IgnoreMismatch, Murmur3Hashes)
+	if err != nil || ignored.GetStorage().Count() != 0 {
+		t.Fatalf("Expected an empty filter, got %v set bits (%v)", ignored.GetStorage().Count(), err)
+	}
+}
+
+func TestParseHashProvider(t *testing.T) {
+	if provider := ParseHashProvider("XXHash"); provider != XXHashes {
+		t.Fatalf("Expected %v, got %v", XXHashes.Name(), provider.Name())
+	}
+	if provider := ParseHashProvider("anything"); provider != MixedHashes {
+		t.Fatalf("Expected %v, got %v", MixedHashes.Name(), provider.Name())
+	}
+}
@@ -0,0 +1,131 @@
+package bloomfilter
+
+import (
+	"fmt"
+)
+
+// checkMergeable refuses to merge filters with a different number of bits, as
+// their indices don't line up.
+func checkMergeable(bf BloomFilter, other BloomFilter) error {
+	if other == nil {
+		return fmt.Errorf("Can't merge a nil bloomfilter")
+	}
+
+	if size, otherSize := bf.GetStorage().Len(), other.GetStorage().Len(); size != otherSize {
+		return fmt.Errorf(
+			"Can't merge a bloomfilter of %d bits into one of %d bits",
+			otherSize,
+			size,
+		)
+	}
+
+	return nil
+}
+
+// union sets every bit of `into` which is set in `from`.
+func union(into Bitset, from Bitset) {
+	wfInto, ok := into.(*WFBitset)
+	wfFrom, fromOk := from.(*WFBitset)
+	if ok && fromOk {
+		wfInto.unionWith(wfFrom)
+		return
+	}
+
+	for index := uint(0); index < from.Len(); index++ {
+		if from.IsSet(index) {
+			into.Add(index)
+		}
+	}
+}
+
+// Merge sets every bit which is set in `other`, so the filter claims every key
+// either of them held. Both filters have to hash keys alike, and filters of a
+// different size are refused.
+func (bf *SimpleBloomFilter) Merge(other BloomFilter) error {
+	if err := checkMergeable(bf, other); err != nil {
+		return err
+	}
+
+	union(bf.filter, other.GetStorage())
+	return nil
+}
+
+// Merge sets every bit which is set in `other`, adding its counters to ours
+// (up to where they saturate), so keys of either filter can still be
+// removed. A plain filter's bits count once each.
+func (bf *CountingBloomFilter) Merge(other BloomFilter) error {
+	if err := checkMergeable(bf, other); err != nil {
+		return err
+	}
+
+	// The other filter's counters are copied first, so only one filter is
+	// locked at a time.
+	var otherCounts counters
+	if counting, ok := other.(*CountingBloomFilter); ok {
+		if counting == bf {
+			return fmt.Errorf("Can't merge a bloomfilter into itself")
+		}
+
+		counting.countsLock.Lock()
+		otherCounts = append(counters(nil), counting.counts...)
+		counting.countsLock.Unlock()
+	}
+	storage := other.GetStorage()
+
+	bf.countsLock.Lock()
+	defer bf.countsLock.Unlock()
+
+	for index := uint(0); index < storage.Len(); index++ {
+		if !storage.IsSet(index) {
+			continue
+		}
+
+		added := uint8(1)
+		if otherCounts != nil {
+			added = otherCounts.get(index)
+		}
+
+		count := bf.counts.get(index)
+		if count+added > maxCount {
+			bf.counts.set(index, maxCount)
+		} else {
+			bf.counts.set(index, count+added)
+		}
+		bf.filter.Add(index)
+	}
+
+	return nil
+}
+
+// Merge merges every stage of `other` into ours, growing ours to as many
+// stages. Only scalable filters created with the same capacity and false
+// positive rate can be merged, as only their stages are of the same size.
+func (bf *ScalableBloomFilter) Merge(other BloomFilter) error {
+	scalable, ok := other.(*ScalableBloomFilter)
+	if !ok {
+		return fmt.Errorf("Can't merge a %T into a scalable bloomfilter", other)
+	}
+	if scalable.items != bf.items || scalable.probability != bf.probability {
+		return fmt.Errorf("Can't merge scalable bloomfilters of different shapes")
+	}
+
+	if scalable == bf {
+		return fmt.Errorf("Can't merge a bloomfilter into itself")
+	}
+	stages, counts := scalable.snapshot()
+
+	bf.lock.Lock()
+	defer bf.lock.Unlock()
+
+	for len(bf.stages) < len(stages) {
+		bf.grow()
+	}
+	for i, stage := range stages {
+		if err := bf.stages[i].Merge(stage); err != nil {
+			return err
+		}
+		bf.counts[i] += counts[i]
+	}
+
+	return nil
+}
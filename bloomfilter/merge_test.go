@@ -0,0 +1,80 @@
+package bloomfilter
+
+import (
+	"testing"
+)
+
+func TestMergeIsUnion(t *testing.T) {
+	first := NewByFailRate(1000, 0.01)
+	first.AddKey([]byte("first"))
+	second := NewByFailRate(1000, 0.01)
+	second.AddKey([]byte("second"))
+
+	if err := first.Merge(second); err != nil {
+		t.Fatalf("%v", err)
+	}
+	for _, key := range []string{"first", "second"} {
+		if ok, _ := first.HasKey([]byte(key)); !ok {
+			t.Fatalf("Expected %v to be in the merged filter", key)
+		}
+	}
+	if ok, _ := second.HasKey([]byte("first")); ok {
+		t.Fatalf("Expected the merged-in filter to be left untouched")
+	}
+}
+
+func TestMergeRefusesOtherSizes(t *testing.T) {
+	if err := NewByFailRate(1000, 0.01).Merge(NewByFailRate(2000, 0.01)); err == nil {
+		t.Fatalf("Expected filters of different sizes not to merge")
+	}
+	if err := NewByFailRate(1000, 0.01).Merge(nil); err == nil {
+		t.Fatalf("Expected a nil filter not to merge")
+	}
+}
+
+func TestMergeCountingAddsCounters(t *testing.T) {
+	first := NewCountingByFailRate(1000, 0.01)
+	first.AddKey([]byte("shared"))
+	second := NewCountingByFailRate(1000, 0.01)
+	second.AddKey([]byte("shared"))
+	second.AddKey([]byte("second"))
+
+	if err := first.Merge(second); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// Both filters held the key, so it takes two removals to clear it.
+	first.RemoveKey([]byte("shared"))
+	if ok, _ := first.HasKey([]byte("shared")); !ok {
+		t.Fatalf("Expected the key to still be counted once")
+	}
+	first.RemoveKey([]byte("shared"))
+	if ok, _ := first.HasKey([]byte("shared")); ok {
+		t.Fatalf("Expected the key to be removed")
+	}
+	if ok, _ := first.HasKey([]byte("second")); !ok {
+		t.Fatalf("Expected the merged key to be kept")
+	}
+}
+
+func TestMergeScalableGrowsStages(t *testing.T) {
+	first := NewScalableByFailRate(10, 0.01)
+	second := NewScalableByFailRate(10, 0.01)
+	for i := 0; i < 30; i++ {
+		second.AddKey([]byte{byte(i)})
+	}
+
+	if err := first.Merge(second); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if first.Stages() != second.Stages() || first.Count() != second.Count() {
+		t.Fatalf("Expected %d stages of %d keys, got %d of %d", second.Stages(), second.Count(), first.Stages(), first.Count())
+	}
+	if !first.Compare(second) {
+		t.Fatalf("Expected the merged filter to match the one merged in")
+	}
+
+	if err := first.Merge(NewScalableByFailRate(20, 0.01)); err == nil {
+		t.Fatalf("Expected scalable filters of another shape not to merge")
+	}
+}
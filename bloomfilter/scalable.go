@@ -0,0 +1,284 @@
+package bloomfilter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// scalableGrowth is how much larger every stage of a scalable bloom
+	// filter is than the one before it.
+	scalableGrowth = 2
+	// scalableTightening is how much lower every stage's false positive
+	// rate is than the one before it, so the rates of all the stages add
+	// up to at most the filter's.
+	scalableTightening = 0.5
+)
+
+// scalableVersion is the header written by scalable bloom filters.
+var scalableVersion = fmt.Sprintf("v%ds", SerializationVersion)
+
+// ScalableBloomFilter is a bloom filter which grows as keys are added rather
+// than having its capacity fixed up front. Keys go into the last of a chain
+// of stages; once it holds as many keys as it was sized for, a new stage
+// twice as large with half the false positive rate is chained on, so the
+// filter's false positive rate stays below the one it was created with
+// however many keys it holds.
+//
+// The index-level methods (HashKey, GetStorage, GetMaxSize) refer to the
+// stage keys are currently added to.
+type ScalableBloomFilter struct {
+	items       uint
+	probability float64
+	scheme      HashScheme
+	stages      []*SimpleBloomFilter
+	// counts holds how many keys every stage was given.
+	counts []uint
+	// lock guards the chain of stages, as adding a key may grow it.
+	lock sync.RWMutex
+}
+
+// NewScalableByFailRate returns a scalable bloom filter whose first stage
+// holds `items` keys and which keeps a false positive rate below
+// `probability` as it grows.
+func NewScalableByFailRate(items uint, probability float64) *ScalableBloomFilter {
+	return NewScalableByFailRateWithScheme(items, probability, IndependentHashes)
+}
+
+// NewScalableByFailRateWithScheme works like NewScalableByFailRate, but lets
+// the caller pick how bit indices are derived.
+func NewScalableByFailRateWithScheme(items uint, probability float64, scheme HashScheme) *ScalableBloomFilter {
+	bf := &ScalableBloomFilter{
+		items:       items,
+		probability: probability,
+		scheme:      scheme,
+	}
+	bf.grow()
+
+	return bf
+}
+
+// stageBounds returns the capacity and false positive rate of stage `stage`.
+func (bf *ScalableBloomFilter) stageBounds(stage int) (uint, float64) {
+	items := bf.items
+	probability := bf.probability * (1 - scalableTightening)
+	for i := 0; i < stage; i++ {
+		items *= scalableGrowth
+		probability *= scalableTightening
+	}
+
+	return items, probability
+}
+
+// grow chains on a new stage.
+func (bf *ScalableBloomFilter) grow() {
+	items, probability := bf.stageBounds(len(bf.stages))
+
+	bf.stages = append(bf.stages, NewByFailRateWithScheme(items, probability, bf.scheme))
+	bf.counts = append(bf.counts, 0)
+}
+
+// snapshot returns the filter's stages and how many keys each was given, so
+// they can be read without holding its lock.
+func (bf *ScalableBloomFilter) snapshot() ([]*SimpleBloomFilter, []uint) {
+	bf.lock.RLock()
+	defer bf.lock.RUnlock()
+
+	return append([]*SimpleBloomFilter(nil), bf.stages...), append([]uint(nil), bf.counts...)
+}
+
+// current returns the stage keys are added to.
+func (bf *ScalableBloomFilter) current() *SimpleBloomFilter {
+	return bf.stages[len(bf.stages)-1]
+}
+
+// AddKey adds a new key to the bloom filter, growing it first if the current
+// stage is full. Keys the filter already holds aren't added again, so they
+// don't fill up the stage. It returns the indices of the key in the stage it
+// was added to.
+func (bf *ScalableBloomFilter) AddKey(key []byte) (bool, []uint) {
+	bf.lock.Lock()
+	defer bf.lock.Unlock()
+
+	if hasKey, _ := bf.hasKey(key); hasKey {
+		return true, bf.current().HashKey(key)
+	}
+
+	if capacity, _ := bf.stageBounds(len(bf.stages) - 1); bf.counts[len(bf.counts)-1] >= capacity {
+		bf.grow()
+	}
+	bf.counts[len(bf.counts)-1]++
+
+	return bf.current().AddKey(key)
+}
+
+// AddKeys adds many keys to the bloom filter at once.
+func (bf *ScalableBloomFilter) AddKeys(keys [][]byte) {
+	for _, key := range keys {
+		bf.AddKey(key)
+	}
+}
+
+// HasKey checks whether any stage holds the key. The indices returned are
+// the key's in the current stage.
+func (bf *ScalableBloomFilter) HasKey(key []byte) (bool, []uint) {
+	bf.lock.RLock()
+	defer bf.lock.RUnlock()
+
+	return bf.hasKey(key)
+}
+
+func (bf *ScalableBloomFilter) hasKey(key []byte) (bool, []uint) {
+	for _, stage := range bf.stages[:len(bf.stages)-1] {
+		if hasKey, _ := stage.HasKey(key); hasKey {
+			return true, bf.current().HashKey(key)
+		}
+	}
+
+	return bf.current().HasKey(key)
+}
+
+// RemoveKey is a no-op: a scalable bloom filter can't take keys back out. It
+// always returns false.
+func (bf *ScalableBloomFilter) RemoveKey(key []byte) bool {
+	return false
+}
+
+// Stages returns how many stages the filter grew to.
+func (bf *ScalableBloomFilter) Stages() int {
+	bf.lock.RLock()
+	defer bf.lock.RUnlock()
+
+	return len(bf.stages)
+}
+
+// Count returns how many distinct keys were added to the filter, as far as
+// it can tell them apart.
+func (bf *ScalableBloomFilter) Count() uint {
+	bf.lock.RLock()
+	defer bf.lock.RUnlock()
+
+	var count uint
+	for _, stageCount := range bf.counts {
+		count += stageCount
+	}
+
+	return count
+}
+
+// HashKey returns the key's indices in the current stage.
+func (bf *ScalableBloomFilter) HashKey(key []byte) []uint {
+	bf.lock.RLock()
+	defer bf.lock.RUnlock()
+
+	return bf.current().HashKey(key)
+}
+
+// GetMaxSize returns the size of the current stage.
+func (bf *ScalableBloomFilter) GetMaxSize() uint {
+	bf.lock.RLock()
+	defer bf.lock.RUnlock()
+
+	return bf.current().GetMaxSize()
+}
+
+// GetStorage returns the bitset of the current stage.
+func (bf *ScalableBloomFilter) GetStorage() Bitset {
+	bf.lock.RLock()
+	defer bf.lock.RUnlock()
+
+	return bf.current().GetStorage()
+}
+
+// Compare returns if the two scalable bloom filters have the same stages with
+// the same bits set.
+func (bf *ScalableBloomFilter) Compare(remote interface{}) bool {
+	other, ok := remote.(*ScalableBloomFilter)
+	if !ok {
+		return false
+	}
+	if other == bf {
+		return true
+	}
+
+	otherStages, _ := other.snapshot()
+	stages, _ := bf.snapshot()
+	if len(otherStages) != len(stages) {
+		return false
+	}
+
+	for i, stage := range stages {
+		if !stage.Compare(otherStages[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Serialize converts the bloom filter to a string: how many keys every stage
+// was given, then every stage's bits in base64 (e.g., "v1s.2s-1c.<bits>.<bits>").
+// The bits aren't RLE'd, as run lengths can't be told apart from the digits
+// of base64.
+func (bf *ScalableBloomFilter) Serialize() string {
+	bf.lock.RLock()
+	defer bf.lock.RUnlock()
+
+	counts := make([]string, len(bf.counts))
+	for i, count := range bf.counts {
+		counts[i] = strconv.FormatUint(uint64(count), 36)
+	}
+
+	stages := make([]string, len(bf.stages))
+	for i, stage := range bf.stages {
+		stages[i] = stage.filter.(*WFBitset).encode()
+	}
+
+	return fmt.Sprintf(
+		"%s.%s.%s",
+		scalableVersion,
+		strings.Join(counts, "-"),
+		strings.Join(stages, "."),
+	)
+}
+
+// DeserializeScalable converts a serialized scalable bloom filter back into a
+// ScalableBloomFilter. `items` and `probability` must be the ones the filter
+// was created with, as the size of every stage follows from them.
+func DeserializeScalable(inputString string, items uint, probability float64, scheme HashScheme) (*ScalableBloomFilter, error) {
+	parts := strings.Split(strings.TrimSpace(inputString), ".")
+	if parts[0] != scalableVersion {
+		return nil, &VersionMismatchError{parts[0]}
+	}
+	if len(parts) < 3 {
+		return nil, fmt.Errorf("Scalable bloomfilter is missing its stages")
+	}
+
+	counts := strings.Split(parts[1], "-")
+	stages := parts[2:]
+	if len(counts) != len(stages) {
+		return nil, fmt.Errorf("Scalable bloomfilter has %d counts for %d stages", len(counts), len(stages))
+	}
+
+	bf := &ScalableBloomFilter{
+		items:       items,
+		probability: probability,
+		scheme:      scheme,
+	}
+	for i, encoded := range stages {
+		count, err := strconv.ParseUint(counts[i], 36, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid scalable bloomfilter count %q", counts[i])
+		}
+
+		bf.grow()
+		bf.counts[i] = uint(count)
+		if err := bf.stages[i].filter.(*WFBitset).decode(encoded); err != nil {
+			return nil, fmt.Errorf("Invalid scalable bloomfilter stage: %v", err)
+		}
+	}
+
+	return bf, nil
+}
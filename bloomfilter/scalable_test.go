@@ -0,0 +1,79 @@
+package bloomfilter
+
+import (
+	"fmt"
+	"testing"
+)
+
+var _ BloomFilter = NewScalableByFailRate(100, 0.01)
+
+func TestScalableGrowsAndKeepsFailRate(t *testing.T) {
+	bf := NewScalableByFailRateWithScheme(100, 0.01, DoubleHashing)
+
+	for i := 0; i < 2000; i++ {
+		bf.AddKey([]byte(fmt.Sprintf("key%d", i)))
+	}
+	if bf.Stages() < 2 {
+		t.Fatalf("Expected the filter to grow, got %v stages", bf.Stages())
+	}
+
+	for i := 0; i < 2000; i++ {
+		if hasKey, _ := bf.HasKey([]byte(fmt.Sprintf("key%d", i))); !hasKey {
+			t.Fatalf("Expected key%d to be in the bloom filter", i)
+		}
+	}
+
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if hasKey, _ := bf.HasKey([]byte(fmt.Sprintf("missing%d", i))); hasKey {
+			falsePositives++
+		}
+	}
+	// Leave some slack over 1%, as the hash function count is rounded down.
+	if rate := float64(falsePositives) / 10000; rate > 0.02 {
+		t.Fatalf("Expected a false positive rate below %v, got %v", 0.02, rate)
+	}
+}
+
+func TestScalableDoesntCountKeysTwice(t *testing.T) {
+	bf := NewScalableByFailRate(10, 0.01)
+
+	for i := 0; i < 20; i++ {
+		bf.AddKey([]byte("key1"))
+	}
+	if bf.Count() != 1 || bf.Stages() != 1 {
+		t.Fatalf("Expected 1 key in 1 stage, got %v in %v", bf.Count(), bf.Stages())
+	}
+	if bf.RemoveKey([]byte("key1")) {
+		t.Fatalf("Expected a scalable bloom filter not to remove keys")
+	}
+}
+
+func TestScalableSerializationRoundTrip(t *testing.T) {
+	bf := NewScalableByFailRateWithScheme(50, 0.01, DoubleHashing)
+	for i := 0; i < 200; i++ {
+		bf.AddKey([]byte(fmt.Sprintf("key%d", i)))
+	}
+
+	result, err := DeserializeScalable(bf.Serialize(), 50, 0.01, DoubleHashing)
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	if !bf.Compare(result) || result.Count() != bf.Count() {
+		t.Fatalf("Expected the stages to round-trip")
+	}
+
+	// The round-tripped filter keeps growing from where it was.
+	for i := 200; i < 400; i++ {
+		result.AddKey([]byte(fmt.Sprintf("key%d", i)))
+	}
+	for i := 0; i < 400; i++ {
+		if hasKey, _ := result.HasKey([]byte(fmt.Sprintf("key%d", i))); !hasKey {
+			t.Fatalf("Expected key%d to be in the bloom filter", i)
+		}
+	}
+
+	if _, err := DeserializeScalable(NewByFailRate(50, 0.01).Serialize(), 50, 0.01, DoubleHashing); err == nil {
+		t.Fatalf("Expected a plain filter to be refused")
+	}
+}
@@ -1,7 +1,9 @@
 package bfsearch
 
 import (
+	"github.com/GrappigPanda/Olivia/bloomfilter"
 	"github.com/GrappigPanda/Olivia/dht"
+	"sync"
 )
 
 type bloomfilterNode struct {
@@ -11,6 +13,9 @@ type bloomfilterNode struct {
 
 type Search struct {
 	nodes []*bloomfilterNode
+	// RWMutex guards swapping in recalculated nodes while searches are
+	// running.
+	sync.RWMutex
 }
 
 type BloomSearch interface {
@@ -22,12 +27,21 @@ func NewSearch(peerList dht.PeerList) *Search {
 	return calculateSearchArray(peerList)
 }
 
+// Recalculate rebuilds the search from `peerList`, e.g. after peers were
+// added, replaced, or sent updated bloom filters.
 func (b *Search) Recalculate(peerList dht.PeerList) {
-	b = calculateSearchArray(peerList)
+	nodes := calculateSearchArray(peerList).nodes
+
+	b.Lock()
+	b.nodes = nodes
+	b.Unlock()
 }
 
 func (b *Search) Get(bitIndex uint) []*dht.Peer {
-	if bitIndex > uint(len(b.nodes)) {
+	b.RLock()
+	defer b.RUnlock()
+
+	if bitIndex >= uint(len(b.nodes)) {
 		return nil
 	}
 
@@ -41,8 +55,11 @@ func (b *Search) Get(bitIndex uint) []*dht.Peer {
 }
 
 func (b *Search) GetFromIndices(bitIndex []uint) []*dht.Peer {
+	b.RLock()
+	defer b.RUnlock()
+
 	for _, index := range bitIndex {
-		if index > uint(len(b.nodes)) {
+		if index >= uint(len(b.nodes)) {
 			return nil
 		}
 
@@ -56,6 +73,25 @@ func (b *Search) GetFromIndices(bitIndex []uint) []*dht.Peer {
 	return nil
 }
 
+// IndexPeers returns which peers have set which bit indices. Indices no peer
+// has set are left out. Handy for reasoning about why a key was routed to a
+// peer, since keys with overlapping indices can match peers which never held
+// them.
+func (b *Search) IndexPeers() map[uint][]*dht.Peer {
+	b.RLock()
+	defer b.RUnlock()
+
+	indexPeers := make(map[uint][]*dht.Peer)
+
+	for _, node := range b.nodes {
+		if node != nil && len(node.refs) > 0 {
+			indexPeers[node.bitIndex] = node.refs
+		}
+	}
+
+	return indexPeers
+}
+
 func unionPeerLists(peerLists ...[]*dht.Peer) []*dht.Peer {
 	peerListRefCounter := make(map[string]int)
 	peerListAllPeers := make(map[string]*dht.Peer)
@@ -88,26 +124,49 @@ func unionPeerLists(peerLists ...[]*dht.Peer) []*dht.Peer {
 }
 
 func calculateSearchArray(peerList dht.PeerList) *Search {
-	var bfNodes []*bloomfilterNode
-
-	if peerList.Peers[0] == nil || len(peerList.Peers) == 0 {
-		return &Search{
-			nodes: bfNodes,
+	// Slots of peers which were dropped are left empty, so the size is
+	// taken from the first peer there is.
+	for _, peer := range peerList.Peers {
+		if peer == nil {
+			continue
 		}
+
+		return calculateSearchArrayFor(
+			peerList.Peers,
+			peer.GetRemoteFilter(),
+			func(peer *dht.Peer) bloomfilter.BloomFilter {
+				return peer.GetRemoteFilter()
+			},
+		)
 	}
 
-	peerBF := peerList.Peers[0].BloomFilter
+	return &Search{}
+}
+
+// calculateSearchArrayFor builds the bit index -> peers lookup from whichever
+// of each peer's bloom filters `filterOf` picks. `sizeFrom` decides how many
+// bits are indexed. Peers without the filter are left out.
+func calculateSearchArrayFor(
+	peers []*dht.Peer,
+	sizeFrom bloomfilter.BloomFilter,
+	filterOf func(*dht.Peer) bloomfilter.BloomFilter,
+) *Search {
+	var bfNodes []*bloomfilterNode
+
 	bfSize := uint(0)
-	if peerBF != nil {
-		bfSize = peerBF.GetMaxSize()
+	if sizeFrom != nil {
+		bfSize = sizeFrom.GetMaxSize()
 	}
 
 	for i := uint(0); i <= bfSize; i++ {
 		var nodes []*dht.Peer
 
-		for _, peer := range peerList.Peers {
+		for _, peer := range peers {
 			if peer != nil {
-				bf := peer.BloomFilter
+				bf := filterOf(peer)
+				if bf == nil {
+					continue
+				}
 				bitset := bf.GetStorage()
 
 				if bitset.IsSet(i) {
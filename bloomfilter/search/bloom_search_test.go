@@ -1,6 +1,7 @@
 package bfsearch
 
 import (
+	"github.com/GrappigPanda/Olivia/bloomfilter"
 	"github.com/GrappigPanda/Olivia/config"
 	"github.com/GrappigPanda/Olivia/dht"
 	"testing"
@@ -79,3 +80,62 @@ func createFakePeers(i int) []*dht.Peer {
 
 	return peers
 }
+
+func TestIndexPeers(t *testing.T) {
+	first := &dht.Peer{
+		IPPort:      "first",
+		BloomFilter: bloomfilter.NewByFailRate(1000, 0.01),
+	}
+	second := &dht.Peer{
+		IPPort:      "second",
+		BloomFilter: bloomfilter.NewByFailRate(1000, 0.01),
+	}
+
+	first.BloomFilter.AddKey([]byte("key1"))
+	second.BloomFilter.AddKey([]byte("key1"))
+	second.BloomFilter.AddKey([]byte("key2"))
+
+	peerList := dht.NewPeerList(nil, *CONFIG)
+	peerList.Peers = []*dht.Peer{first, second}
+
+	indexPeers := NewSearch(*peerList).IndexPeers()
+
+	expected := make(map[uint][]*dht.Peer)
+	for _, peer := range peerList.Peers {
+		for _, key := range []string{"key1", "key2"} {
+			if found, indices := peer.BloomFilter.HasKey([]byte(key)); found {
+				for _, index := range indices {
+					if !containsPeer(expected[index], peer) {
+						expected[index] = append(expected[index], peer)
+					}
+				}
+			}
+		}
+	}
+
+	if len(indexPeers) != len(expected) {
+		t.Fatalf("Expected %v indices, got %v", len(expected), len(indexPeers))
+	}
+
+	for index, peers := range expected {
+		if len(indexPeers[index]) != len(peers) {
+			t.Fatalf("Expected %v at index %d, got %v", peers, index, indexPeers[index])
+		}
+
+		for i := range peers {
+			if indexPeers[index][i] != peers[i] {
+				t.Fatalf("Expected %v at index %d, got %v", peers, index, indexPeers[index])
+			}
+		}
+	}
+}
+
+func containsPeer(peers []*dht.Peer, peer *dht.Peer) bool {
+	for _, p := range peers {
+		if p == peer {
+			return true
+		}
+	}
+
+	return false
+}
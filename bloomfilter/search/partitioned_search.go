@@ -0,0 +1,56 @@
+package bfsearch
+
+import (
+	"github.com/GrappigPanda/Olivia/bloomfilter"
+	"github.com/GrappigPanda/Olivia/dht"
+)
+
+// PartitionedSearch is a Search per hash-range partition, built from each
+// peer's partition bloom filters. A peer which only holds keys in some
+// partitions is then only routed to for keys in those partitions.
+type PartitionedSearch struct {
+	partitions []*Search
+}
+
+// NewPartitionedSearch builds a search for every one of `partitions`
+// partitions over `peers`.
+func NewPartitionedSearch(peers []*dht.Peer, partitions int) *PartitionedSearch {
+	search := &PartitionedSearch{
+		partitions: make([]*Search, partitions),
+	}
+
+	for i := range search.partitions {
+		partition := i
+		filterOf := func(peer *dht.Peer) bloomfilter.BloomFilter {
+			return peer.GetPartitionFilter(partition)
+		}
+
+		var sizeFrom bloomfilter.BloomFilter
+		for _, peer := range peers {
+			if peer != nil {
+				if bf := filterOf(peer); bf != nil {
+					sizeFrom = bf
+					break
+				}
+			}
+		}
+
+		search.partitions[i] = calculateSearchArrayFor(
+			peers,
+			sizeFrom,
+			filterOf,
+		)
+	}
+
+	return search
+}
+
+// GetFromIndices returns the peers which probably hold a key with the given
+// bit indices in `partition`.
+func (p *PartitionedSearch) GetFromIndices(partition int, bitIndex []uint) []*dht.Peer {
+	if partition < 0 || partition >= len(p.partitions) {
+		return nil
+	}
+
+	return p.partitions[partition].GetFromIndices(bitIndex)
+}
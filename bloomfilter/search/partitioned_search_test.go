@@ -0,0 +1,61 @@
+package bfsearch
+
+import (
+	"github.com/GrappigPanda/Olivia/bloomfilter"
+	"github.com/GrappigPanda/Olivia/dht"
+	"testing"
+)
+
+func createPartitionedPeer(ipPort string, partitions int, keysByPartition map[int][]string) *dht.Peer {
+	peer := &dht.Peer{
+		IPPort:           ipPort,
+		BloomFilter:      bloomfilter.NewByFailRate(1000, 0.01),
+		PartitionFilters: make([]bloomfilter.BloomFilter, partitions),
+	}
+
+	for i := range peer.PartitionFilters {
+		bf := bloomfilter.NewByFailRate(dht.PartitionItems(1000, partitions), 0.01)
+		for _, key := range keysByPartition[i] {
+			bf.AddKey([]byte(key))
+			peer.BloomFilter.AddKey([]byte(key))
+		}
+		peer.PartitionFilters[i] = bf
+	}
+
+	return peer
+}
+
+func TestPartitionedSearchDistinguishesPartitions(t *testing.T) {
+	// Both peers hold "key1" as far as their whole-node filters are
+	// concerned, but in different partitions.
+	first := createPartitionedPeer("first", 2, map[int][]string{0: {"key1"}})
+	second := createPartitionedPeer("second", 2, map[int][]string{1: {"key1"}})
+
+	peerList := dht.NewPeerList(nil, *CONFIG)
+	peerList.Peers = []*dht.Peer{first, second}
+
+	search := NewPartitionedSearch(peerList.Peers, 2)
+	indices := bloomfilter.NewByFailRate(dht.PartitionItems(1000, 2), 0.01).HashKey([]byte("key1"))
+
+	for partition, expected := range []*dht.Peer{first, second} {
+		found := search.GetFromIndices(partition, indices)
+		if len(found) != 1 || found[0] != expected {
+			t.Fatalf("Expected only %v in partition %d, got %v", expected.IPPort, partition, found)
+		}
+	}
+
+	if found := NewSearch(*peerList).GetFromIndices(first.BloomFilter.HashKey([]byte("key1"))); len(found) != 2 {
+		t.Fatalf("Expected the whole-node search to find both peers, got %v", found)
+	}
+}
+
+func TestPartitionedSearchWithoutFilters(t *testing.T) {
+	search := NewPartitionedSearch([]*dht.Peer{{IPPort: "nofilters"}}, 2)
+	if found := search.GetFromIndices(0, []uint{1, 2, 3}); len(found) != 0 {
+		t.Fatalf("Expected no peers, got %v", found)
+	}
+
+	if found := search.GetFromIndices(5, []uint{1}); found != nil {
+		t.Fatalf("Expected no peers for an unknown partition, got %v", found)
+	}
+}
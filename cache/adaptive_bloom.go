@@ -0,0 +1,142 @@
+package cache
+
+import (
+	"github.com/GrappigPanda/Olivia/bloomfilter"
+	"github.com/GrappigPanda/Olivia/config"
+	"github.com/GrappigPanda/Olivia/dht"
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+// fpWindowsToResize is how many windows in a row the measured false-positive
+// rate has to be over the target before our bloom filters are grown.
+var fpWindowsToResize = 3
+
+// fpWindow measures the false-positive rate of remote lookups over a window
+// of lookups.
+type fpWindow struct {
+	lookups int
+	wasted  int
+	// overTarget counts the windows in a row which were over the target.
+	overTarget int
+	sync.Mutex
+}
+
+// recordRemoteLookup counts a GET sent to a peer whose bloom filter claimed
+// the key. `wasted` means the peer didn't have it, so its filter gave a false
+// positive.
+func (c *Cache) recordRemoteLookup(wasted bool) {
+	atomic.AddUint64(&c.counters.remoteLookups, 1)
+	if wasted {
+		atomic.AddUint64(&c.counters.wastedRemoteLookups, 1)
+	}
+
+	if !c.config.AdaptiveBloomfilter || c.config.BloomfilterFPWindow <= 0 {
+		return
+	}
+
+	if c.fpWindow.record(wasted, c.config) {
+		go c.growBloomFilters()
+	}
+}
+
+// record adds a lookup to the window and returns whether the rate stayed over
+// the target for long enough that the filters should be grown.
+func (w *fpWindow) record(wasted bool, config config.Cfg) bool {
+	w.Lock()
+	defer w.Unlock()
+
+	w.lookups++
+	if wasted {
+		w.wasted++
+	}
+
+	if w.lookups < config.BloomfilterFPWindow {
+		return false
+	}
+
+	rate := float64(w.wasted) / float64(w.lookups)
+	w.lookups, w.wasted = 0, 0
+
+	if rate <= config.BloomfilterTargetFPRate*(1+config.BloomfilterFPMargin) {
+		w.overTarget = 0
+		return false
+	}
+
+	w.overTarget++
+	if w.overTarget < fpWindowsToResize {
+		return false
+	}
+
+	w.overTarget = 0
+	return true
+}
+
+// growBloomFilters doubles the capacity of our bloom filters and re-adds
+// every key we hold, which also drops the bits of keys long since removed.
+func (c *Cache) growBloomFilters() {
+	c.Lock()
+	defer c.Unlock()
+
+	c.bloomGrowth *= 2
+	scheme := bloomfilter.ParseHashScheme(c.config.BloomfilterHashScheme)
+	hashes := bloomfilter.ParseHashProvider(c.config.BloomfilterHash)
+
+	c.bloomFilter = bloomfilter.NewCountingByFailRateWithHash(
+		baseBloomItems*c.bloomGrowth,
+		0.01,
+		scheme,
+		hashes,
+	)
+	c.partitionFilters = newPartitionFilters(
+		c.config.BloomfilterSize*c.bloomGrowth,
+		len(c.partitionFilters),
+		scheme,
+		hashes,
+	)
+	// Our cuckoo filter is refilled along, so keys aren't added twice.
+	if c.routesByCuckoo() {
+		c.cuckoo.resize(c.cuckoo.items)
+	}
+
+	keys := make([]string, 0, c.keyCount())
+	c.forEachEntry(func(key string, _ string) {
+		keys = append(keys, key)
+	})
+	c.addKeysToBloomFilters(keys)
+
+	atomic.AddUint64(&c.counters.bloomfilterResizes, 1)
+	log.Printf(
+		"Grew our bloom filter to %d bits after a sustained false-positive rate over %v",
+		c.bloomFilter.GetMaxSize(),
+		c.config.BloomfilterTargetFPRate,
+	)
+}
+
+// routingIndices hashes `key` into the indices peers' filters are searched
+// by. They're derived from the filters' initial shape, as growing our own
+// filters doesn't grow our peers'.
+func (c *Cache) routingIndices(key string, partitioned bool) []uint {
+	if partitioned {
+		return c.partitionRouting.HashKey([]byte(key))
+	}
+
+	return c.routing.HashKey([]byte(key))
+}
+
+// newRoutingFilters creates the filters `routingIndices` hashes keys with.
+// They never hold keys.
+func newRoutingFilters(bloomfilterSize uint, partitions int, scheme bloomfilter.HashScheme, provider bloomfilter.HashProvider) (bloomfilter.BloomFilter, bloomfilter.BloomFilter) {
+	routing := bloomfilter.NewByFailRateWithHash(baseBloomItems, 0.01, scheme, provider)
+	if partitions <= 1 {
+		return routing, nil
+	}
+
+	return routing, bloomfilter.NewByFailRateWithHash(
+		dht.PartitionItems(bloomfilterSize, partitions),
+		0.01,
+		scheme,
+		provider,
+	)
+}
@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func newAdaptiveCache(t *testing.T, stub *stubPeer) *Cache {
+	cache := newCacheWithStubPeers(t, stub)
+	cache.config.AdaptiveBloomfilter = true
+	cache.config.BloomfilterTargetFPRate = 0.01
+	cache.config.BloomfilterFPMargin = 0.5
+	cache.config.BloomfilterFPWindow = 10
+
+	return cache
+}
+
+func TestSustainedFalsePositivesGrowBloomFilter(t *testing.T) {
+	stub := newStubPeer(t, map[string]string{"gone": "value"})
+	defer stub.Close()
+
+	cache := newAdaptiveCache(t, stub)
+	cache.Set("local", "value")
+	initialSize := cache.GetBloomFilter().GetMaxSize()
+
+	// The stub's filter still claims the key, but every GET for it is now
+	// wasted.
+	stub.Lock()
+	delete(stub.values, "gone")
+	stub.Unlock()
+
+	for i := 0; i < fpWindowsToResize*cache.config.BloomfilterFPWindow; i++ {
+		if _, err := cache.Get("gone"); err == nil {
+			t.Fatalf("Expected the stub not to have the key")
+		}
+	}
+
+	for attempt := 0; cache.Stats().BloomfilterResizes == 0; attempt++ {
+		if attempt == 100 {
+			t.Fatalf("Expected a sustained false-positive rate to grow the bloom filter")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	stats := cache.Stats()
+	if stats.RemoteLookups != stats.WastedRemoteLookups || stats.RemoteLookups == 0 {
+		t.Fatalf("Expected every remote lookup to be wasted, got %+v", stats)
+	}
+
+	bf := cache.GetBloomFilter()
+	if bf.GetMaxSize() <= initialSize {
+		t.Fatalf("Expected the bloom filter to grow past %v bits, got %v", initialSize, bf.GetMaxSize())
+	}
+
+	if ok, _ := bf.HasKey([]byte("local")); !ok {
+		t.Fatalf("Expected the grown bloom filter to still hold our keys")
+	}
+
+	// Lookups are still routed by the peers' filters, which didn't grow.
+	if value, err := cache.Get("gone"); err == nil {
+		t.Fatalf("Expected no value, got %v", value)
+	}
+	if stats.RemoteLookups == cache.Stats().RemoteLookups {
+		t.Fatalf("Expected the stub to still be asked after resizing")
+	}
+}
+
+func TestAccurateLookupsDontGrowBloomFilter(t *testing.T) {
+	stub := newStubPeer(t, map[string]string{"key": "value"})
+	defer stub.Close()
+
+	cache := newAdaptiveCache(t, stub)
+	for i := 0; i < fpWindowsToResize*cache.config.BloomfilterFPWindow; i++ {
+		if _, err := cache.Get("key"); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+
+	stats := cache.Stats()
+	if stats.BloomfilterResizes != 0 || stats.WastedRemoteLookups != 0 {
+		t.Fatalf("Expected no wasted lookups nor resizes, got %+v", stats)
+	}
+}
+
+func TestFPWindowNeedsSustainedRate(t *testing.T) {
+	var window fpWindow
+	cfg := stubConfig()
+	cfg.BloomfilterTargetFPRate = 0.1
+	cfg.BloomfilterFPMargin = 0.5
+	cfg.BloomfilterFPWindow = 2
+
+	// A window under the target in between resets the streak.
+	wasted := []bool{true, true, true, true, false, false, true, true, true, true, true, true}
+	for i, w := range wasted {
+		grow := window.record(w, *cfg)
+		if grow != (i == len(wasted)-1) {
+			t.Fatalf("Expected growing only after %d sustained windows, got %v at lookup %d", fpWindowsToResize, grow, i)
+		}
+	}
+}
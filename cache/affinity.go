@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"github.com/GrappigPanda/Olivia/dht"
+	"hash/fnv"
+	"sort"
+)
+
+// affinityOrder orders candidate peers for a single key. Each peer is scored
+// by hashing it together with the key (rendezvous hashing), so every lookup
+// for the same key prefers the same peer for as long as it's healthy, which
+// keeps that key hot in a single remote node. When the preferred peer goes
+// away, the key falls through to the next highest scoring peer rather than
+// getting shuffled across all of them.
+type affinityOrder struct {
+	peers  []*dht.Peer
+	scores []uint64
+}
+
+// orderByAffinity returns the candidate peers for `key` in the order they
+// should be tried.
+func orderByAffinity(key string, peers []*dht.Peer) []*dht.Peer {
+	order := &affinityOrder{
+		peers:  make([]*dht.Peer, 0, len(peers)),
+		scores: make([]uint64, 0, len(peers)),
+	}
+
+	for _, peer := range peers {
+		if peer == nil {
+			continue
+		}
+
+		order.peers = append(order.peers, peer)
+		order.scores = append(order.scores, affinityScore(key, peer.IPPort))
+	}
+
+	sort.Sort(order)
+
+	return order.peers
+}
+
+// affinityScore hashes a key and a peer address into a single score.
+func affinityScore(key string, ipPort string) uint64 {
+	hasher := fnv.New64a()
+	hasher.Write([]byte(key))
+	hasher.Write([]byte{0})
+	hasher.Write([]byte(ipPort))
+
+	return hasher.Sum64()
+}
+
+func (a *affinityOrder) Len() int {
+	return len(a.peers)
+}
+
+// Less sorts the highest score first.
+func (a *affinityOrder) Less(i, j int) bool {
+	return a.scores[i] > a.scores[j]
+}
+
+func (a *affinityOrder) Swap(i, j int) {
+	a.peers[i], a.peers[j] = a.peers[j], a.peers[i]
+	a.scores[i], a.scores[j] = a.scores[j], a.scores[i]
+}
@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"github.com/GrappigPanda/Olivia/dht"
+	"testing"
+)
+
+func TestRemoteGetPrefersSamePeer(t *testing.T) {
+	values := map[string]string{"hotkey": "hotvalue"}
+	first := newStubPeer(t, values)
+	defer first.Close()
+	second := newStubPeer(t, values)
+	defer second.Close()
+
+	cache := newCacheWithStubPeers(t, first, second)
+
+	for i := 0; i < 20; i++ {
+		value, err := cache.Get("hotkey")
+		if err != nil || value != "hotvalue" {
+			t.Fatalf("Expected hotvalue, got %v (%v)", value, err)
+		}
+	}
+
+	preferred, other := first, second
+	if second.Gets() > first.Gets() {
+		preferred, other = second, first
+	}
+
+	if preferred.Gets() != 20 || other.Gets() != 0 {
+		t.Fatalf(
+			"Expected every get to hit one peer, got %v and %v",
+			preferred.Gets(),
+			other.Gets(),
+		)
+	}
+
+	cache.DisconnectPeer(preferred.Addr())
+
+	for i := 0; i < 20; i++ {
+		value, err := cache.Get("hotkey")
+		if err != nil || value != "hotvalue" {
+			t.Fatalf("Expected hotvalue, got %v (%v)", value, err)
+		}
+	}
+
+	if preferred.Gets() != 20 || other.Gets() != 20 {
+		t.Fatalf(
+			"Expected gets to move to the other peer, got %v and %v",
+			preferred.Gets(),
+			other.Gets(),
+		)
+	}
+}
+
+func TestOrderByAffinityIsStable(t *testing.T) {
+	peers := createStubPeerObjects("127.0.0.1:1", "127.0.0.1:2", "127.0.0.1:3")
+
+	expected := orderByAffinity("key", peers)
+	reversed := []*dht.Peer{peers[2], peers[1], peers[0]}
+
+	for i := 0; i < 10; i++ {
+		ordered := orderByAffinity("key", reversed)
+		for j := range ordered {
+			if ordered[j] != expected[j] {
+				t.Fatalf("Expected a stable order, got %v and %v", expected, ordered)
+			}
+		}
+	}
+}
+
+func createStubPeerObjects(ipPorts ...string) []*dht.Peer {
+	peers := make([]*dht.Peer, len(ipPorts))
+	for i, ipPort := range ipPorts {
+		peers[i] = dht.NewPeerByIP(ipPort, nil, *stubConfig())
+	}
+
+	return peers
+}
@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"github.com/GrappigPanda/Olivia/acl"
+)
+
+// SetClusterSecrets replaces the cluster secrets at runtime. `current` is
+// what we authenticate to remote nodes with, while remote nodes may use
+// either `current` or `next`. Rotating the secret without downtime goes:
+//
+//	SetClusterSecrets(old, new) on every node, one at a time
+//	SetClusterSecrets(new, old) on every node, one at a time
+//	SetClusterSecrets(new, "") on every node, retiring the old secret
+func (c *Cache) SetClusterSecrets(current string, next string) {
+	c.secrets.Set(current, next)
+}
+
+// RequiresAuth reports whether remote nodes and clients have to
+// authenticate before sending commands, which they do once there's a cluster
+// secret or any users.
+func (c *Cache) RequiresAuth() bool {
+	if c.root != nil {
+		return c.root.RequiresAuth()
+	}
+
+	return c.secrets.Required() || c.users.HasUsers()
+}
+
+// AuthenticatePeer checks a secret sent by a remote node, or a client with
+// full access.
+func (c *Cache) AuthenticatePeer(secret string) bool {
+	if c.root != nil {
+		return c.root.AuthenticatePeer(secret)
+	}
+
+	if !c.secrets.Required() {
+		// Without a cluster secret there's nothing to check against, which
+		// only lets everyone in if there aren't any users either.
+		return !c.users.HasUsers()
+	}
+
+	return c.secrets.Accepts(secret)
+}
+
+// Authenticate checks the secret of user `name`, returning the commands
+// they may run. An empty name checks the cluster secret, which allows every
+// command.
+func (c *Cache) Authenticate(name string, secret string) (*acl.Permissions, bool) {
+	if c.root != nil {
+		return c.root.Authenticate(name, secret)
+	}
+
+	if name == "" {
+		if c.AuthenticatePeer(secret) {
+			return acl.All, true
+		}
+		return nil, false
+	}
+
+	return c.users.Authenticate(name, secret)
+}
@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"github.com/GrappigPanda/Olivia/config"
+	"testing"
+)
+
+func TestAuthenticateWithoutSecretAcceptsAnything(t *testing.T) {
+	cache := NewCache(nil, nil)
+
+	if cache.RequiresAuth() {
+		t.Fatalf("Expected no authentication without a secret")
+	}
+
+	if !cache.AuthenticatePeer("anything") {
+		t.Fatalf("Expected any secret to be accepted")
+	}
+}
+
+func TestRotateClusterSecret(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{IsTesting: true, ClusterSecret: "old"})
+
+	if !cache.AuthenticatePeer("old") || cache.AuthenticatePeer("new") {
+		t.Fatalf("Expected only the configured secret to be accepted")
+	}
+
+	// During the rotation window both secrets are accepted.
+	cache.SetClusterSecrets("old", "new")
+	for _, secret := range []string{"old", "new"} {
+		if !cache.AuthenticatePeer(secret) {
+			t.Fatalf("Expected %v to be accepted during the rotation", secret)
+		}
+	}
+	if cache.AuthenticatePeer("bad") || cache.AuthenticatePeer("") {
+		t.Fatalf("Expected unknown secrets to be rejected")
+	}
+
+	if cache.PeerList.Secrets().Current() != "old" {
+		t.Fatalf("Expected %v, got %v", "old", cache.PeerList.Secrets().Current())
+	}
+
+	// Retiring the old secret.
+	cache.SetClusterSecrets("new", "")
+	if cache.AuthenticatePeer("old") {
+		t.Fatalf("Expected the retired secret to be rejected")
+	}
+	if !cache.AuthenticatePeer("new") {
+		t.Fatalf("Expected the new secret to be accepted")
+	}
+	if cache.PeerList.Secrets().Current() != "new" {
+		t.Fatalf("Expected %v, got %v", "new", cache.PeerList.Secrets().Current())
+	}
+}
+
+func TestAuthenticateUsers(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{
+		IsTesting:     true,
+		MaxNamespaces: 1,
+		Users: []config.User{
+			{Name: "reader", Secret: "pw", Roles: []string{"read-only"}},
+		},
+	})
+
+	if !cache.RequiresAuth() {
+		t.Fatalf("Expected users to require authentication")
+	}
+
+	// Without a cluster secret, nothing authenticates with full access.
+	if cache.AuthenticatePeer("anything") || cache.AuthenticatePeer("") {
+		t.Fatalf("Expected no secret to be accepted")
+	}
+	if _, ok := cache.Authenticate("", "anything"); ok {
+		t.Fatalf("Expected no secret to be accepted")
+	}
+
+	if _, ok := cache.Authenticate("reader", "wrong"); ok {
+		t.Fatalf("Expected a wrong secret to be rejected")
+	}
+
+	// Namespaces authenticate against the same users.
+	namespace, err := cache.Namespace("other")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	permissions, ok := namespace.Authenticate("reader", "pw")
+	if !ok || !permissions.Allows("GET") || permissions.Allows("SET") {
+		t.Fatalf("Expected reader to only be allowed to read, got %v %v", permissions, ok)
+	}
+}
@@ -0,0 +1,111 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// keyWaiters holds the channels of the BlockingGets waiting on each key to be
+// set.
+type keyWaiters struct {
+	waiting map[string][]chan string
+	// count is how many BlockingGets are waiting, so sets don't take the
+	// lock when none are. It's only ever touched atomically.
+	count int32
+	sync.Mutex
+}
+
+// BlockingGet retrieves a value like GetContext, but if the key isn't found
+// it waits for the key to be set on this node until `ctx` is done. Only sets
+// which land on this node wake it up, i.e. keys it owns or replicates: with
+// a ReplicationFactor, sets of a key we don't own are placed on its owners,
+// so waiting for it here only ends with `ctx`.
+func (c *Cache) BlockingGet(ctx context.Context, key string) (string, error) {
+	// The waiter is registered before looking the key up under its shard's
+	// lock, which sets wake waiters under, so a set in between isn't missed.
+	waiter := c.waitForKey(key)
+	defer c.stopWaiting(key, waiter)
+
+	var value string
+	var ok bool
+	var err error
+	c.readKey(key, func(shard *cacheShard) {
+		value, ok, err = shard.stringOf(key)
+	})
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		return value, nil
+	}
+
+	if value, err := c.GetContext(ctx, key); err == nil || err == ErrWrongType {
+		return value, err
+	}
+
+	select {
+	case value := <-waiter:
+		return value, nil
+	case <-ctx.Done():
+		return "", fmt.Errorf("Timed out waiting for %v", key)
+	case <-c.stopped:
+		return "", fmt.Errorf("Cache stopped waiting for %v", key)
+	}
+}
+
+// waitForKey registers a channel which receives `key`'s value once it's set.
+func (c *Cache) waitForKey(key string) chan string {
+	c.waiters.Lock()
+	defer c.waiters.Unlock()
+
+	if c.waiters.waiting == nil {
+		c.waiters.waiting = make(map[string][]chan string)
+	}
+
+	waiter := make(chan string, 1)
+	c.waiters.waiting[key] = append(c.waiters.waiting[key], waiter)
+	atomic.AddInt32(&c.waiters.count, 1)
+
+	return waiter
+}
+
+// stopWaiting unregisters a channel waitForKey registered, if it wasn't
+// woken up already.
+func (c *Cache) stopWaiting(key string, waiter chan string) {
+	c.waiters.Lock()
+	defer c.waiters.Unlock()
+
+	waiting := c.waiters.waiting[key]
+	for i, registered := range waiting {
+		if registered == waiter {
+			waiting = append(waiting[:i:i], waiting[i+1:]...)
+			atomic.AddInt32(&c.waiters.count, -1)
+			break
+		}
+	}
+
+	if len(waiting) == 0 {
+		delete(c.waiters.waiting, key)
+	} else {
+		c.waiters.waiting[key] = waiting
+	}
+}
+
+// wakeWaiters hands a key's new value to everything waiting on it to be set.
+// The caller must hold the lock of the key's shard.
+func (c *Cache) wakeWaiters(key string, value string) {
+	if atomic.LoadInt32(&c.waiters.count) == 0 {
+		return
+	}
+
+	c.waiters.Lock()
+	defer c.waiters.Unlock()
+
+	for _, waiter := range c.waiters.waiting[key] {
+		waiter <- value
+		atomic.AddInt32(&c.waiters.count, -1)
+	}
+	delete(c.waiters.waiting, key)
+}
@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"context"
+	"github.com/GrappigPanda/Olivia/config"
+	"testing"
+	"time"
+)
+
+func TestBlockingGetReturnsSetKeysRightAway(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{IsTesting: true})
+	cache.Set("key1", "value1")
+
+	value, err := cache.BlockingGet(context.Background(), "key1")
+	if err != nil || value != "value1" {
+		t.Fatalf("Expected %v, got %v (%v)", "value1", value, err)
+	}
+}
+
+func TestBlockingGetWaitsForTheKeyToBeSet(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{IsTesting: true})
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cache.Set("other", "value")
+		cache.Set("key1", "value1")
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	value, err := cache.BlockingGet(ctx, "key1")
+	if err != nil || value != "value1" {
+		t.Fatalf("Expected %v, got %v (%v)", "value1", value, err)
+	}
+
+	if count := cache.waiters.count; count != 0 {
+		t.Fatalf("Expected no waiters left, got %v", count)
+	}
+}
+
+func TestBlockingGetTimesOut(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{IsTesting: true})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if value, err := cache.BlockingGet(ctx, "key1"); err == nil {
+		t.Fatalf("Expected a timeout, got %v", value)
+	}
+
+	if _, ok := cache.waiters.waiting["key1"]; ok {
+		t.Fatalf("Expected the waiter to be dropped")
+	}
+	if count := cache.waiters.count; count != 0 {
+		t.Fatalf("Expected no waiters left, got %v", count)
+	}
+}
@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"github.com/GrappigPanda/Olivia/dht"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// bloomDelta collects the bit indices our whole-node bloom filter gained
+// since we last pushed them to our peers. It's guarded by bloomLock.
+type bloomDelta struct {
+	indices map[uint]struct{}
+	sets    int
+}
+
+// recordBloomDelta notes the indices a key added to our bloom filter,
+// returning the indices to push once BloomfilterDeltaSets keys were added,
+// nil otherwise. The caller must hold bloomLock.
+func (c *Cache) recordBloomDelta(indices []uint) []uint {
+	if c.config.BloomfilterDeltaSets <= 0 || c.PeerList == nil {
+		return nil
+	}
+
+	if c.bloomDelta.indices == nil {
+		c.bloomDelta.indices = make(map[uint]struct{})
+	}
+	for _, index := range indices {
+		c.bloomDelta.indices[index] = struct{}{}
+	}
+
+	c.bloomDelta.sets++
+	if c.bloomDelta.sets < c.config.BloomfilterDeltaSets {
+		return nil
+	}
+
+	pending := make([]uint, 0, len(c.bloomDelta.indices))
+	for index := range c.bloomDelta.indices {
+		pending = append(pending, index)
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i] < pending[j] })
+	c.bloomDelta = bloomDelta{}
+
+	return pending
+}
+
+// pushBloomDelta sends the indices our bloom filter gained to every peer
+// we're connected to, so they route reads of our new keys to us without
+// waiting on the next full exchange.
+func (c *Cache) pushBloomDelta(indices []uint) {
+	request := encodeBloomDelta(c.selfAddress, indices)
+
+	for _, peer := range c.connectablePeers() {
+		ctx, cancel := context.WithTimeout(context.Background(), replicationTimeout)
+		_, err := peer.Request(ctx, request)
+		cancel()
+
+		if err != nil {
+			log.Printf("Failed to send our bloom filter delta to %v: %v", peer.IPPort, err)
+		}
+	}
+}
+
+// ApplyBloomDelta adds the indices the peer at `address` sent to the bloom
+// filter we hold for it, reporting whether we hold one.
+func (c *Cache) ApplyBloomDelta(address string, indices []uint) bool {
+	if c.PeerList == nil {
+		return false
+	}
+
+	peer := c.findPeer(address)
+	if peer == nil {
+		return false
+	}
+
+	return peer.AddToFilter(indices)
+}
+
+// encodeBloomDelta builds a `BLOOMADD host_port:index-index-...` command.
+func encodeBloomDelta(address string, indices []uint) string {
+	encoded := make([]string, len(indices))
+	for i, index := range indices {
+		encoded[i] = strconv.FormatUint(uint64(index), 10)
+	}
+
+	return fmt.Sprintf(
+		"BLOOMADD %s:%s",
+		dht.EscapeAddress(address),
+		strings.Join(encoded, "-"),
+	)
+}
+
+// ParseBloomDelta decodes the `index-index-...` indices of a BLOOMADD.
+func ParseBloomDelta(encoded string) ([]uint, error) {
+	var indices []uint
+	for _, field := range strings.Split(encoded, "-") {
+		index, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid bloom filter index %v", field)
+		}
+		indices = append(indices, uint(index))
+	}
+
+	return indices, nil
+}
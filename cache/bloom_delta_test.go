@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"fmt"
+	"github.com/GrappigPanda/Olivia/dht"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBloomDeltaPushedEverySets(t *testing.T) {
+	stub := newStubPeer(t, map[string]string{})
+	defer stub.Close()
+
+	cache := newCacheWithStubPeers(t, stub)
+	cache.config.BloomfilterDeltaSets = 3
+
+	for i := 0; i < 2; i++ {
+		cache.setLocal(fmt.Sprintf("key%d", i), "value")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if adds := stub.BloomAdds(); len(adds) != 0 {
+		t.Fatalf("Expected no deltas yet, got %v", adds)
+	}
+
+	cache.setLocal("key2", "value")
+	for attempt := 0; len(stub.BloomAdds()) == 0; attempt++ {
+		if attempt == 100 {
+			t.Fatalf("Never sent a bloom filter delta to %v", stub.Addr())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	delta := stub.BloomAdds()[0]
+	address := dht.EscapeAddress(cache.selfAddress) + ":"
+	if !strings.HasPrefix(delta, address) {
+		t.Fatalf("Expected %v, got %v", address, delta)
+	}
+	indices, err := ParseBloomDelta(strings.TrimPrefix(delta, address))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	sent := make(map[uint]bool)
+	for _, index := range indices {
+		sent[index] = true
+	}
+	for i := 0; i < 3; i++ {
+		for _, index := range cache.bloomFilter.HashKey([]byte(fmt.Sprintf("key%d", i))) {
+			if !sent[index] {
+				t.Fatalf("Expected index %v of key%d to be sent", index, i)
+			}
+		}
+	}
+}
+
+func TestAppliedBloomDeltaRoutesGets(t *testing.T) {
+	stub := newStubPeer(t, map[string]string{})
+	defer stub.Close()
+
+	cache := newCacheWithStubPeers(t, stub)
+	stub.Lock()
+	stub.values["fresh"] = "value"
+	stub.Unlock()
+
+	if candidates := cache.remoteCandidates("fresh"); len(candidates) != 0 {
+		t.Fatalf("Expected no candidates, got %v", len(candidates))
+	}
+
+	indices := cache.bloomFilter.HashKey([]byte("fresh"))
+	if !cache.ApplyBloomDelta(stub.Addr(), indices) {
+		t.Fatalf("Expected a filter to be held for %v", stub.Addr())
+	}
+
+	if value, err := cache.Get("fresh"); err != nil || value != "value" {
+		t.Fatalf("Expected %v, got %v (%v)", "value", value, err)
+	}
+
+	if cache.ApplyBloomDelta("127.0.0.1:1", indices) {
+		t.Fatalf("Expected no filter to be held for an unknown peer")
+	}
+}
+
+func TestBloomDeltaEncoding(t *testing.T) {
+	encoded := encodeBloomDelta("127.0.0.1:5454", []uint{3, 17, 22})
+	if encoded != "BLOOMADD 127.0.0.1_5454:3-17-22" {
+		t.Fatalf("Expected %v, got %v", "BLOOMADD 127.0.0.1_5454:3-17-22", encoded)
+	}
+
+	indices, err := ParseBloomDelta("3-17-22")
+	if err != nil || !reflect.DeepEqual(indices, []uint{3, 17, 22}) {
+		t.Fatalf("Expected %v, got %v (%v)", []uint{3, 17, 22}, indices, err)
+	}
+
+	if _, err := ParseBloomDelta("3-x"); err == nil {
+		t.Fatalf("Expected an invalid delta to be refused")
+	}
+}
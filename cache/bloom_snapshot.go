@@ -0,0 +1,48 @@
+package cache
+
+// BloomSnapshot returns a copy of our bloom filter's bits, packed eight to a
+// byte with bit i in byte i/8 at position i%8, along with the filter's size in
+// bits and how many of them are set. It's meant for diagnostics and never
+// modifies the filter, so it only holds the cache lock shared, and bloomLock
+// so no key is added halfway through the copy.
+func (c *Cache) BloomSnapshot() ([]byte, uint, uint) {
+	c.RLock()
+	defer c.RUnlock()
+	c.bloomLock.Lock()
+	defer c.bloomLock.Unlock()
+
+	storage := c.bloomFilter.GetStorage()
+	maxSize := c.bloomFilter.GetMaxSize()
+
+	bits := make([]byte, (maxSize+7)/8)
+	for i := uint(0); i < maxSize; i++ {
+		if storage.IsSet(i) {
+			bits[i/8] |= 1 << (i % 8)
+		}
+	}
+
+	return bits, maxSize, storage.Count()
+}
+
+// BloomFillRatio returns which fraction of our bloom filter's bits are set.
+// The false-positive rate climbs quickly as it approaches one.
+func (c *Cache) BloomFillRatio() float64 {
+	_, maxSize, setBits := c.BloomSnapshot()
+	if maxSize == 0 {
+		return 0
+	}
+
+	return float64(setBits) / float64(maxSize)
+}
+
+// bloomEstimates returns how many of our bloom filter's bits are set, how many
+// keys it's estimated to hold, and its estimated false-positive rate. Once the
+// rate creeps past the one the filter was sized for, it needs to grow.
+func (c *Cache) bloomEstimates() (uint, uint, float64) {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.bloomFilter.SetBits(),
+		c.bloomFilter.EstimatedCount(),
+		c.bloomFilter.EstimatedFalsePositiveRate()
+}
@@ -0,0 +1,41 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+)
+
+func popcount(bits []byte) uint {
+	count := uint(0)
+	for _, b := range bits {
+		for ; b != 0; b &= b - 1 {
+			count++
+		}
+	}
+
+	return count
+}
+
+func TestBloomSnapshot(t *testing.T) {
+	cache := NewCache(nil, nil)
+
+	_, maxSize, before := cache.BloomSnapshot()
+	if before != 0 {
+		t.Fatalf("Expected an empty filter, got %v set bits", before)
+	}
+
+	for i := 0; i < 20; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), "value")
+	}
+
+	bits, size, after := cache.BloomSnapshot()
+	if size != maxSize || uint(len(bits)) != (size+7)/8 {
+		t.Fatalf("Expected %v bytes for %v bits, got %v", (size+7)/8, size, len(bits))
+	}
+	if after <= before {
+		t.Fatalf("Expected more than %v set bits, got %v", before, after)
+	}
+	if popcount(bits) != after {
+		t.Fatalf("Expected %v, got %v", popcount(bits), after)
+	}
+}
@@ -0,0 +1,33 @@
+package cache
+
+import (
+	"testing"
+)
+
+func TestBroadcastOnBloomMissFindsUnfilteredKey(t *testing.T) {
+	first := newStubPeer(t, map[string]string{})
+	defer first.Close()
+	second := newStubPeer(t, map[string]string{})
+	defer second.Close()
+
+	cache := newCacheWithStubPeers(t, first, second)
+
+	// The key lands on the peer after its bloom filter was fetched, so no
+	// filter claims it.
+	second.Lock()
+	second.values["stalekey"] = "value"
+	second.Unlock()
+
+	if _, err := cache.Get("stalekey"); err == nil {
+		t.Fatalf("Expected the stale filters to miss the key")
+	}
+
+	cache.config.BroadcastOnBloomMiss = true
+
+	if value, err := cache.Get("stalekey"); err != nil || value != "value" {
+		t.Fatalf("Expected %v, got %v (%v)", "value", value, err)
+	}
+	if second.Gets() != 1 {
+		t.Fatalf("Expected %v, got %v", 1, second.Gets())
+	}
+}
@@ -1,16 +1,20 @@
 package cache
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"github.com/GrappigPanda/Olivia/acl"
 	"github.com/GrappigPanda/Olivia/bloomfilter"
 	"github.com/GrappigPanda/Olivia/bloomfilter/search"
 	"github.com/GrappigPanda/Olivia/config"
 	"github.com/GrappigPanda/Olivia/dht"
 	"github.com/GrappigPanda/Olivia/network/message_handler"
+	"github.com/GrappigPanda/Olivia/parser"
 	binheap "github.com/GrappigPanda/Olivia/shared"
 	"log"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -18,37 +22,201 @@ type Cache struct {
 	PeerList          *dht.PeerList
 	bloomfilterSearch *bfsearch.Search
 	MessageBus        *message_handler.MessageHandler
-	cache             *map[string]string
-	binHeap           *binheap.Heap
-	bloomFilter       bloomfilter.BloomFilter
-	sync.Mutex
+	// shards hold the keys, split by key hash. See withKey for how they're
+	// locked.
+	shards      [cacheShards]*cacheShard
+	bloomFilter bloomfilter.BloomFilter
+	// bloomLock guards adding keys to and removing them from our bloom
+	// filters while only holding the cache lock shared.
+	bloomLock sync.Mutex
+	// bloomDelta holds what our bloom filter gained since it was last
+	// pushed to our peers.
+	bloomDelta bloomDelta
+	// cuckoo is our cuckoo filter, only kept when PeerFilter is cuckoo.
+	cuckoo      cuckooFilter
+	config      config.Cfg
+	counters    counters
+	maintenance maintenance
+	// wal is the write-ahead log, nil unless a WALPath is configured.
+	wal *writeAheadLog
+	// partitionFilters holds a bloom filter per hash-range partition, nil
+	// unless BloomfilterPartitions is configured.
+	partitionFilters []bloomfilter.BloomFilter
+	// partitionedSearch routes remote gets at partition granularity.
+	partitionedSearch     *bfsearch.PartitionedSearch
+	partitionedSearchLock sync.RWMutex
+	// searchLock serializes rebuilding the searches, as peers' bloom
+	// filters arrive concurrently.
+	searchLock sync.Mutex
+	// clusterFilter is the union of our peers' bloom filters, so keys no
+	// peer holds are turned away before any network call.
+	clusterFilter     bloomfilter.BloomFilter
+	clusterFilterLock sync.RWMutex
+	// secrets are the cluster secrets remote nodes authenticate with.
+	secrets *dht.ClusterSecrets
+	// users are the clients which authenticate with their own secrets.
+	users *acl.List
+	// replaceLock serializes replacing peers, as heartbeats, failovers and
+	// gossip may all replace the same one at once.
+	replaceLock sync.Mutex
+	// replicationRetries holds the failed replication writes per replica.
+	replicationRetries retryQueues
+	// membership is the cluster's membership, as gossiped between nodes.
+	membership *dht.Membership
+	// hints holds the writes owed to owners which are down.
+	hints hints
+	// forwarding holds the writes waiting to be forwarded to their owners
+	// when AsyncReplication is on.
+	forwarding forwardQueue
+	// rebalancing moves the keys we no longer own to their owners when
+	// the hash ring changes.
+	rebalancing rebalancer
+	// clock versions our writes.
+	clock lamportClock
+	// ring decides which node owns a key.
+	ring *dht.Ring
+	// selfAddress identifies us on the ring.
+	selfAddress string
+	// readPreference is the read preference used by Get.
+	readPreference ReadPreference
+	// expireStreams receive an event for every key the eviction sweep
+	// removes.
+	expireStreams []chan<- ExpireEvent
+	// changeStreams receive an event for every key written or removed.
+	changeStreams []chan<- ChangeEvent
+	// subscriptions receive an event for every key matching their patterns
+	// which is set, deleted, expires or is evicted.
+	subscriptions []*Subscription
+	// waiters are the BlockingGets waiting on keys to be set.
+	waiters keyWaiters
+	// bloomGrowth is how many times over its initial capacity adaptive
+	// resizing has grown our bloom filter.
+	bloomGrowth uint
+	// routing and partitionRouting hash keys into peers' bloom filters. See
+	// routingIndices.
+	routing          bloomfilter.BloomFilter
+	partitionRouting bloomfilter.BloomFilter
+	// fpWindow measures the false-positive rate of remote lookups.
+	fpWindow fpWindow
+	// snapshots keeps snapshots from running concurrently.
+	snapshots snapshotState
+	// eviction picks which keys to evict, nil unless MaxEntries or
+	// MaxBytes is configured.
+	eviction EvictionPolicy
+	// usedBytes is the approximate memory our keys and values take up (see
+	// entrySize), and entryCount how many keys we hold. Both are only ever
+	// touched atomically.
+	usedBytes  int64
+	entryCount int64
+	// namespaces holds the keyspaces SELECT has opened, by name. Only the
+	// default keyspace's cache holds them; a namespace's cache points back
+	// to it through root.
+	namespaces namespaces
+	root       *Cache
+	// stopped is closed by Stop to shut down the background loops, which
+	// loops tracks.
+	stopped  chan bool
+	stopOnce sync.Once
+	loops    sync.WaitGroup
+	// expirySchedule wakes the eviction loop up when the next key expires.
+	expirySchedule expirySchedule
+	// requests counts the client requests being served, for Shutdown to
+	// wait on.
+	requests requestTracker
+	sync.RWMutex
 }
 
+// baseBloomItems is how many items our whole-node bloom filter is sized for
+// before any adaptive resizing.
+const baseBloomItems = 1000
+
+// remoteGetTimeout is how long a remote GET waits on a single peer before
+// moving on to the next candidate.
+var remoteGetTimeout = 2 * time.Second
+
+// ErrValueTooLarge is returned when a value is larger than the configured
+// MaxValueBytes.
+var ErrValueTooLarge = errors.New("Value exceeds the maximum value size")
+
 // NewCache creates a new cache and internal ReadCache.
 func NewCache(mh *message_handler.MessageHandler, config *config.Cfg) *Cache {
-	cacheMap := make(map[string]string)
 	cache := &Cache{
 		PeerList:          nil,
 		bloomfilterSearch: nil,
 		MessageBus:        mh,
-		cache:             &cacheMap,
-		binHeap:           binheap.NewHeapReallocate(100),
-		bloomFilter:       bloomfilter.NewByFailRate(1000, 0.01),
+		bloomFilter:       bloomfilter.NewCountingByFailRate(baseBloomItems, 0.01),
+		bloomGrowth:       1,
+		routing:           bloomfilter.NewByFailRate(baseBloomItems, 0.01),
+		secrets:           dht.NewClusterSecrets(""),
+		ring:              dht.NewRing(0),
+		membership:        dht.NewMembership("", nil),
+		stopped:           make(chan bool),
+		expirySchedule:    newExpirySchedule(),
 	}
+	cache.shards = newCacheShards(cache.config, nil)
 
 	if config != nil {
+		cache.config = *config
+		cache.shards = newCacheShards(*config, nil)
+		cache.readPreference = ParseReadPreference(config.ReadPreference)
+		hashScheme := bloomfilter.ParseHashScheme(config.BloomfilterHashScheme)
+		hashes := bloomfilter.ParseHashProvider(config.BloomfilterHash)
+		cache.bloomFilter = bloomfilter.NewCountingByFailRateWithHash(baseBloomItems, 0.01, hashScheme, hashes)
+		cache.partitionFilters = newPartitionFilters(
+			config.BloomfilterSize,
+			config.BloomfilterPartitions,
+			hashScheme,
+			hashes,
+		)
+		cache.routing, cache.partitionRouting = newRoutingFilters(
+			config.BloomfilterSize,
+			config.BloomfilterPartitions,
+			hashScheme,
+			hashes,
+		)
+		if cache.routesByCuckoo() {
+			cache.cuckoo.resize(baseBloomItems)
+		}
+		if config.MaxEntries > 0 || config.MaxBytes > 0 {
+			cache.eviction = newEvictionPolicy(
+				config.EvictionPolicy,
+				cache.soonestExpiring,
+			)
+		}
+		cache.selfAddress = selfAddress(*config)
+		cache.ring.Add(cache.selfAddress)
+		cache.membership = dht.NewMembership(cache.selfAddress, cache.memberChanged)
+		cache.restore()
+		cache.evictRestored()
 		cache.PeerList = dht.NewPeerList(mh, *config)
-		for index, peerIP := range config.RemotePeers {
-			peer := dht.NewPeerByIP(peerIP, mh, *config)
-			cache.PeerList.Peers[index] = peer
-			(*cache.PeerList.PeerMap)[peerIP] = true
+		cache.secrets = cache.PeerList.Secrets()
+		cache.PeerList.OnStatusChange(cache.peerStatusChanged)
+		cache.PeerList.OnFilterChange(cache.peerFilterChanged)
+		users, err := acl.NewList(config.Users)
+		if err != nil {
+			log.Fatalf("Invalid Users: %v", err)
 		}
+		cache.users = users
+		for _, peerIP := range config.RemotePeers {
+			if dht.IsSelf(peerIP, *config) {
+				log.Printf("Skipping our own address %v in RemotePeers", peerIP)
+				continue
+			}
+
+			cache.PeerList.InsertPeer(cache.PeerList.NewPeer(peerIP))
+			cache.ring.Add(peerIP)
+		}
+		cache.resumeRetryQueues()
+		// Keys restored from disk may belong to other nodes by now.
+		cache.ringChanged()
 
 		if !config.IsTesting && !config.BaseNode {
+			backoff := dht.ReconnectBackoff(*config)
 			err := cache.PeerList.ConnectAllPeers()
 			for err != nil {
-				log.Println("Sleeping for 60 seconds and attempting to reconnect")
-				time.Sleep(time.Second * 2)
+				wait := backoff.Next()
+				log.Printf("Sleeping for %v and attempting to reconnect", wait)
+				time.Sleep(wait)
 				err = cache.PeerList.ConnectAllPeers()
 			}
 		}
@@ -59,149 +227,813 @@ func NewCache(mh *message_handler.MessageHandler, config *config.Cfg) *Cache {
 	return cache
 }
 
+// defaultHeapCapacity is the expiration heaps' initial capacity, across all
+// shards, when none is configured.
+const defaultHeapCapacity = 100
+
+// newExpirationHeap creates a shard's heap tracking key expirations, sized for
+// its share of HeapInitialCapacity and for at least `pending` expirations.
+func newExpirationHeap(config config.Cfg, pending int) *binheap.Heap {
+	capacity := config.HeapInitialCapacity
+	if capacity <= 0 {
+		capacity = defaultHeapCapacity
+	}
+	capacity = (capacity + cacheShards - 1) / cacheShards
+	if capacity < minShardHeapCapacity {
+		capacity = minShardHeapCapacity
+	}
+	if pending > capacity {
+		capacity = pending
+	}
+
+	return binheap.NewHeapReallocateWithGrowth(capacity, config.HeapGrowthFactor)
+}
+
+// restore loads the latest snapshot, replays the write-ahead log on top of it
+// and then opens the log for new writes. A node which is configured to be
+// durable but can't restore its state refuses to start.
+func (c *Cache) restore() {
+	if c.config.SnapshotPath != "" {
+		if err := c.loadSnapshot(c.config.SnapshotPath); err != nil {
+			log.Fatalf("Failed to load snapshot: %v", err)
+		}
+	}
+
+	if c.config.WALPath == "" {
+		return
+	}
+
+	if err := c.replayWAL(c.config.WALPath); err != nil {
+		log.Fatalf("Failed to replay the write-ahead log: %v", err)
+	}
+
+	wal, err := openWAL(c.config.WALPath, ParseFsyncPolicy(c.config.WALFsync))
+	if err != nil {
+		log.Fatalf("Failed to open the write-ahead log: %v", err)
+	}
+	c.wal = wal
+}
+
 // Get handles retrieving a value by its key from the internal cache. It reads
 // from the ReadCache which is for copy-on-write optimizations so that
-// reading doesn't lock the cache.
+// reading doesn't lock the cache and never waits on writers. Where the value
+// is read from is decided by the configured ReadPreference.
 func (c *Cache) Get(key string) (string, error) {
-	if value, ok := (*c.cache)[key]; !ok {
-		if c.PeerList != nil && len(c.PeerList.Peers) > 0 {
-			return c.getFromRemotePeers(key)
+	return c.GetContext(context.Background(), key)
+}
+
+// GetContext retrieves a value like Get, but gives up on remote lookups once
+// `ctx` is done.
+func (c *Cache) GetContext(ctx context.Context, key string) (string, error) {
+	value, _, err := c.getWithSource(ctx, key, c.readPreference)
+	return value, err
+}
+
+// GetWithPreference retrieves a value like Get, but with a read preference
+// for just this request.
+func (c *Cache) GetWithPreference(key string, preference ReadPreference) (string, error) {
+	value, _, err := c.getWithSource(context.Background(), key, preference)
+	return value, err
+}
+
+// GetWithSource retrieves a value like Get, but also reports where it was
+// read from: the IPPort of the peer which served a remote hit, or an empty
+// string for a local hit.
+func (c *Cache) GetWithSource(key string) (string, string, error) {
+	return c.getWithSource(context.Background(), key, c.readPreference)
+}
+
+func (c *Cache) getWithSource(ctx context.Context, key string, preference ReadPreference) (string, string, error) {
+	value, source, err := c.readWithPreference(ctx, key, preference)
+	c.countRead(err == nil, source != "")
+
+	return value, source, err
+}
+
+// readWithPreference reads a key from wherever `preference` says to, without
+// counting the read.
+func (c *Cache) readWithPreference(ctx context.Context, key string, preference ReadPreference) (string, string, error) {
+	// Placed keys live on their owners, so that's where they're looked for
+	// first whatever the preference.
+	if preference == OwnerFirst || c.placing() {
+		value, source, err := c.getFromOwner(ctx, key)
+		if err == nil || err == ErrWrongType {
+			return value, source, err
+		}
+		log.Printf("Falling back to a local-first read of %v: %v", key, err)
+	}
+
+	return c.getLocalFirst(ctx, key)
+}
+
+// getLocalFirst returns our own copy of a key if we have one, and otherwise
+// asks the peers which probably have it.
+func (c *Cache) getLocalFirst(ctx context.Context, key string) (string, string, error) {
+	if value, ok, err := c.readString(key); err != nil {
+		return "", "", err
+	} else if !ok {
+		if c.PeerList != nil && len(c.PeerList.GetPeers()) > 0 {
+			return c.getFromRemotePeers(ctx, key)
 		}
 	} else {
-		return value, nil
+		return value, "", nil
 	}
-	return "", fmt.Errorf("Key not found in cache")
+	return "", "", fmt.Errorf("Key not found in cache")
 }
 
-func (c *Cache) getFromRemotePeers(key string) (string, error) {
-	responseChannel := make(chan string)
+// getFromOwner reads a key from the nodes owning it on the hash ring, which
+// may include ourselves, asking each in turn until one has it. With
+// ReadRepair, every owner is read and repaired instead.
+func (c *Cache) getFromOwner(ctx context.Context, key string) (string, string, error) {
+	owners := c.Owners(key)
+	if len(owners) == 0 {
+		owners = []string{c.selfAddress}
+	}
 
-	if c.bloomfilterSearch == nil {
-		return "", fmt.Errorf("bloomfilterSearch is uninitialized")
+	if c.config.ReadRepair && len(owners) > 1 {
+		// Lists and hashes aren't read, nor repaired, as strings.
+		if _, _, err := c.readString(key); err != nil {
+			return "", "", err
+		}
+
+		return c.readRepaired(key, c.readOwners(ctx, key, owners), true)
 	}
-	indices := c.bloomFilter.HashKey([]byte(key))
-	foundPeers := c.bloomfilterSearch.GetFromIndices(indices)
 
-	for _, peer := range foundPeers {
-		// TODO(ian): Pull out the dht.Timeout and dht.Disconnected to an `isConnectable` function.
-		if peer == nil || peer.Status == dht.Timeout || peer.Status == dht.Disconnected {
+	err := fmt.Errorf("Key not found in cache")
+	for _, owner := range owners {
+		if owner == c.selfAddress {
+			value, ok, readErr := c.readString(key)
+			if readErr == ErrWrongType {
+				return "", "", readErr
+			}
+			if ok {
+				return value, "", nil
+			}
 			continue
 		}
 
-		peer.SendRequest(
-			fmt.Sprintf("GET %s", key),
-			responseChannel,
-			c.MessageBus,
-		)
+		peer := c.findPeer(owner)
+		if peer == nil || !peer.IsConnectable() {
+			err = fmt.Errorf("Owner %v of %v is unreachable", owner, key)
+			continue
+		}
 
-		value := <-responseChannel
-		if value != "" {
-			splitString := strings.Split(value, " ")
-			splitString = strings.Split(splitString[1], ":")
-			if len(splitString) > 1 {
-				return fmt.Sprintf("%s:%s", key, splitString[1]), nil
-			} else {
-				return fmt.Sprintf("%s:%s", key, ""), nil
-			}
+		value, peerErr := c.getFromPeer(ctx, peer, key)
+		if peerErr != nil {
+			err = peerErr
+			continue
 		}
+
+		return value, peer.IPPort, nil
 	}
-	return "", fmt.Errorf("Key not found in cache")
+
+	return "", "", err
 }
 
-// copyCache handles creating a copy of the cache
-func (c *Cache) copyCache() {
-	c.Lock()
-	for k, v := range *c.cache {
-		(*c.cache)[k] = v
+// findPeer returns the peer with the given address, if we know it.
+func (c *Cache) findPeer(ipPort string) *dht.Peer {
+	if c.PeerList == nil {
+		return nil
 	}
-	c.Unlock()
+
+	for _, peer := range c.PeerList.GetPeers() {
+		if peer != nil && peer.IPPort == ipPort {
+			return peer
+		}
+	}
+
+	return nil
+}
+
+func (c *Cache) getFromRemotePeers(ctx context.Context, key string) (string, string, error) {
+	if c.bloomfilterSearch == nil && !c.routesByCuckoo() {
+		return "", "", fmt.Errorf("bloomfilterSearch is uninitialized")
+	}
+	if !c.clusterMayHold(key) && !c.config.BroadcastOnBloomMiss {
+		return "", "", fmt.Errorf("Key not found in cache")
+	}
+	foundPeers := orderByAffinity(key, c.remoteCandidates(key))
+
+	if len(foundPeers) == 0 && c.config.BroadcastOnBloomMiss {
+		return c.broadcastGet(ctx, key)
+	}
+
+	if c.config.ReadRepair && len(foundPeers) > 1 {
+		return c.readRepaired(key, c.readReplicas(ctx, key, foundPeers), false)
+	}
+
+	return c.getFromCandidates(ctx, key, foundPeers)
+}
+
+// getFromCandidates asks each of `candidates` for `key` in turn, until one has
+// it. With ParallelRemoteGets, they're all asked at once instead.
+func (c *Cache) getFromCandidates(ctx context.Context, key string, candidates []*dht.Peer) (string, string, error) {
+	if c.config.ParallelRemoteGets {
+		return c.getFromFirstResponder(ctx, key, candidates)
+	}
+
+	for _, peer := range candidates {
+		if ctx.Err() != nil {
+			return "", "", ctx.Err()
+		}
+		if !peer.IsConnectable() {
+			continue
+		}
+
+		value, found, err := c.readFromPeer(ctx, peer, key)
+		c.recordRemoteLookup(err == nil && !found)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		if !found {
+			log.Printf("%v doesn't have %v", peer.IPPort, key)
+			continue
+		}
+
+		return value, peer.IPPort, nil
+	}
+	return "", "", fmt.Errorf("Key not found in cache")
+}
+
+// broadcastGet asks every connectable peer for a key at once, for when no
+// peer's bloom filter claims it. The filters may simply be stale, so this
+// finds keys a filter lookup would miss, at the cost of a GET per peer.
+func (c *Cache) broadcastGet(ctx context.Context, key string) (string, string, error) {
+	var peers []*dht.Peer
+	for _, peer := range c.PeerList.GetPeers() {
+		if peer != nil && peer.IsConnectable() {
+			peers = append(peers, peer)
+		}
+	}
+
+	type result struct {
+		value  string
+		source string
+		err    error
+	}
+	results := make(chan result, len(peers))
+
+	for _, peer := range peers {
+		go func(peer *dht.Peer) {
+			value, err := c.getFromPeer(ctx, peer, key)
+			results <- result{value, peer.IPPort, err}
+		}(peer)
+	}
+
+	for range peers {
+		if res := <-results; res.err == nil {
+			return res.value, res.source, nil
+		}
+	}
+
+	return "", "", fmt.Errorf("Key not found in cache")
+}
+
+// getFromPeer sends a GET for a single key to a remote peer and waits (up to
+// remoteGetTimeout, or until `ctx` is done) on its answer.
+func (c *Cache) getFromPeer(ctx context.Context, peer *dht.Peer, key string) (string, error) {
+	value, found, err := c.readFromPeer(ctx, peer, key)
+	if err != nil {
+		return "", err
+	}
+
+	if !found {
+		return "", fmt.Errorf("%v doesn't have %v", peer.IPPort, key)
+	}
+
+	return value, nil
+}
+
+// readFromPeer works like getFromPeer, but tells the peer not having the key
+// apart from the peer not answering.
+func (c *Cache) readFromPeer(ctx context.Context, peer *dht.Peer, key string) (string, bool, error) {
+	response, err := c.readRequest(ctx, peer, fmt.Sprintf("GET %s", key))
+	if err != nil {
+		return "", false, err
+	}
+
+	remoteValue, found := response.Args[key]
+	return remoteValue, found, nil
+}
+
+// readRequest sends a read to a remote peer and parses its answer,
+// waiting on it up to remoteGetTimeout, or until `ctx` is done.
+func (c *Cache) readRequest(ctx context.Context, peer *dht.Peer, request string) (*parser.CommandData, error) {
+	ctx, cancel := context.WithTimeout(ctx, remoteGetTimeout)
+	defer cancel()
+
+	value, err := peer.Request(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	// Responses may carry framed (binary-safe) values, so they're parsed
+	// rather than split on spaces and colons.
+	return parser.NewParser(nil).Parse(value, nil)
+}
+
+// readValue reads a key from its shard's read copy without taking any lock.
+func (c *Cache) readValue(key string) (string, bool) {
+	value, ok := c.shardOf(key).get(key)
+	if ok {
+		c.touchKey(key)
+	}
+
+	return value, ok
+}
+
+// readString reads a key holding a string like readValue, returning
+// ErrWrongType if it holds a list or hash instead.
+func (c *Cache) readString(key string) (string, bool, error) {
+	entry, ok := c.shardOf(key).readEntry(key)
+	if ok && entry.kind != KindString {
+		return "", false, ErrWrongType
+	}
+	if ok {
+		c.touchKey(key)
+	}
+
+	return entry.value, ok, nil
 }
 
 // Set handles adding a key/value pair to the cache and updating the internal
-// ReadCache.
+// ReadCache. With a ReplicationFactor, the write goes to the key's owners
+// instead, see placeWrites.
 func (c *Cache) Set(key string, value string) error {
-	c.Lock()
-	(*c.cache)[key] = value
-	c.bloomFilter.AddKey([]byte(key))
-	c.Unlock()
+	return c.SetContext(context.Background(), key, value)
+}
+
+// SetContext sets a key like Set, but gives up waiting on the key's other
+// owners once `ctx` is done, in which case the write is kept and retried as
+// if they had failed to apply it.
+func (c *Cache) SetContext(ctx context.Context, key string, value string) error {
+	if c.placing() {
+		return c.placeWrites(ctx, map[string]string{key: value}, nil)
+	}
+
+	return c.setLocal(key, value)
+}
+
+// setLocal is Set without placing the write on the key's owners.
+func (c *Cache) setLocal(key string, value string) error {
+	if err := c.validateValue(value); err != nil {
+		return err
+	}
+
+	return c.withKey(key, func(shard *cacheShard) error {
+		written, err := c.set(shard, key, value)
+		if written {
+			c.publishShard(shard)
+		}
+
+		return err
+	})
+}
 
-	c.copyCache()
+// set stores `value` for `key` under a new version and returns whether
+// anything was written. The caller must hold the lock of the key's shard,
+// publish it and evict whatever is over the limits afterwards.
+func (c *Cache) set(shard *cacheShard, key string, value string) (bool, error) {
+	return c.setAt(shard, key, value, c.clock.next())
+}
+
+// setAt is set with the version the value is stored under.
+func (c *Cache) setAt(shard *cacheShard, key string, value string, version uint64) (bool, error) {
+	old, ok := shard.entries[key]
+	if ok && old == value && shard.typed[key] == nil && !c.clearsExpiration(shard, key) {
+		atomic.AddUint64(&c.counters.redundantSets, 1)
+		if c.config.SkipRedundantSets {
+			shard.versions[key] = version
+			// Nothing changes, so there's nothing to log, add to the
+			// bloom filter, or rebuild.
+			return false, nil
+		}
+	}
+
+	if err := c.logWrite(walRecord{Op: walSet, Key: key, Value: value}); err != nil {
+		return false, err
+	}
+	if c.clearsExpiration(shard, key) {
+		shard.expirations.Remove(key)
+	}
+	c.storeEntry(shard, key, value)
+	shard.versions[key] = version
+	atomic.AddUint64(&c.counters.sets, 1)
+
+	return true, nil
+}
+
+// clearsExpiration checks whether a plain Set of `key` removes its pending
+// expiration, which it does when OverwriteClearsTTL is configured. The caller
+// must hold the lock of the key's shard.
+func (c *Cache) clearsExpiration(shard *cacheShard, key string) bool {
+	if !c.config.OverwriteClearsTTL {
+		return false
+	}
+
+	_, pending := shard.expirations.Get(key)
+	return pending
+}
+
+// storeEntry writes a key into its shard, adding it to our bloom filters if
+// it's new. The caller must hold the lock of the key's shard.
+func (c *Cache) storeEntry(shard *cacheShard, key string, value string) {
+	c.putEntry(shard, key, value)
+	c.publishChange(key, ChangeSet, value)
+	c.notifyKeyspace(key, KeyspaceSet)
+	c.wakeWaiters(key, value)
+}
+
+// putEntry is storeEntry without announcing the write, replacing a list or
+// hash `key` held with the string.
+func (c *Cache) putEntry(shard *cacheShard, key string, value string) {
+	c.dropTyped(shard, key)
+	if old, ok := shard.entries[key]; !ok {
+		c.addToBloomFilters(key)
+		atomic.AddInt64(&c.entryCount, 1)
+	} else {
+		atomic.AddInt64(&c.usedBytes, -int64(entrySize(key, old)))
+	}
+	shard.entries[key] = value
+	atomic.AddInt64(&c.usedBytes, int64(entrySize(key, value)))
+	shard.written[key] = struct{}{}
+	delete(shard.tombstones, key)
+	c.touchKey(key)
+}
+
+// deleteEntry takes a key out of its shard, the shard's expiration heap and
+// our bloom filters. The caller must hold the lock of the key's shard.
+func (c *Cache) deleteEntry(shard *cacheShard, key string) {
+	value, ok := shard.entries[key]
+	if !ok {
+		return
+	}
+
+	c.dropTyped(shard, key)
+	delete(shard.entries, key)
+	delete(shard.versions, key)
+	shard.written[key] = struct{}{}
+	atomic.AddInt64(&c.entryCount, -1)
+	atomic.AddInt64(&c.usedBytes, -int64(entrySize(key, value)))
+	shard.expirations.Remove(key)
+	c.removeFromBloomFilters(key)
+	if c.eviction != nil {
+		c.eviction.Remove(key)
+	}
+	c.publishChange(key, ChangeDelete, "")
+}
+
+// Update atomically applies `fn` to the current value of `key` while holding
+// the lock of its shard, so read-modify-write operations don't race other
+// writers. `fn` receives the current value and whether the key existed, and
+// returns the new value and whether the key should be kept. Returning false
+// deletes the key.
+func (c *Cache) Update(key string, fn func(old string, existed bool) (string, bool)) error {
+	return c.mutateKey(key, func(shard *cacheShard) error {
+		old, existed, err := shard.stringOf(key)
+		if err != nil {
+			return err
+		}
+		value, keep := fn(old, existed)
+		if !keep {
+			if !existed {
+				return nil
+			}
+			err := c.removeEntry(shard, key, c.clock.next())
+			c.publishShard(shard)
+			return err
+		}
+
+		if err := c.validateValue(value); err != nil {
+			return err
+		}
+
+		if err := c.logWrite(walRecord{Op: walSet, Key: key, Value: value}); err != nil {
+			return err
+		}
+
+		c.storeEntry(shard, key, value)
+		shard.versions[key] = c.clock.next()
+		atomic.AddUint64(&c.counters.sets, 1)
+		c.publishShard(shard)
+
+		return nil
+	})
+}
+
+// Delete removes a key from the cache along with its pending expiration,
+// leaving a tombstone until it's set again. The key is taken out of our bloom
+// filters as well, so peers stop routing reads of it to us once they've
+// refreshed our filter.
+func (c *Cache) Delete(key string) error {
+	return c.mutateKey(key, func(shard *cacheShard) error {
+		if _, ok := shard.entries[key]; !ok {
+			return fmt.Errorf("Key not found in cache")
+		}
+
+		err := c.removeEntry(shard, key, c.clock.next())
+		c.publishShard(shard)
+
+		return err
+	})
+}
+
+// removeEntry deletes `key` at `version`, leaving a tombstone which keeps the
+// version, so replicated writes of the key older than the delete are skipped.
+// The caller must hold the lock of the key's shard and publish it afterwards.
+func (c *Cache) removeEntry(shard *cacheShard, key string, version uint64) error {
+	if err := c.logWrite(walRecord{Op: walDelete, Key: key}); err != nil {
+		return err
+	}
+	c.tombstoneEntry(shard, key, version)
 
 	return nil
 }
 
-// SetExpiration handles setting a key with an expiration time.
+// tombstoneEntry is removeEntry without logging the delete, for writes whose
+// own record already implies it. The caller must hold the lock of the key's
+// shard and publish it afterwards.
+func (c *Cache) tombstoneEntry(shard *cacheShard, key string, version uint64) {
+	_, existed := shard.entries[key]
+	c.deleteEntry(shard, key)
+	shard.tombstones[key] = struct{}{}
+	shard.versions[key] = version
+	if existed {
+		c.notifyKeyspace(key, KeyspaceDel)
+	}
+}
+
+// validateValue checks a value against the configured limits before it's
+// written.
+func (c *Cache) validateValue(value string) error {
+	if c.config.MaxValueBytes > 0 && len(value) > c.config.MaxValueBytes {
+		return ErrValueTooLarge
+	}
+
+	return nil
+}
+
+// SetExpiration handles setting a key with an expiration time. With a
+// ReplicationFactor, the write goes to the key's owners instead, see
+// placeWrites.
 func (c *Cache) SetExpiration(key string, value string, timeout int) error {
-	err := c.Set(key, value)
-	if err != nil {
+	if c.placing() {
+		return c.placeWrites(
+			context.Background(),
+			map[string]string{key: value},
+			map[string]int{key: timeout},
+		)
+	}
+
+	return c.setExpirationLocal(key, value, timeout)
+}
+
+// setExpirationLocal is SetExpiration without placing the write on the key's
+// owners.
+func (c *Cache) setExpirationLocal(key string, value string, timeout int) error {
+	if err := c.validateValue(value); err != nil {
 		return err
 	}
+	timeout = c.clampTTL(key, timeout)
+
+	return c.withKey(key, func(shard *cacheShard) error {
+		written, err := c.set(shard, key, value)
+		if written {
+			c.publishShard(shard)
+		}
+		if err != nil {
+			return err
+		}
 
+		return c.expire(shard, key, timeout)
+	})
+}
+
+// expire makes `key` expire `timeout` seconds from now. The caller must hold
+// the lock of the key's shard.
+func (c *Cache) expire(shard *cacheShard, key string, timeout int) error {
 	duration := time.Duration(timeout) * time.Second
-	c.binHeap.Insert(binheap.NewNode(key, time.Now().UTC().Add(duration)))
+	expiresAt := time.Now().UTC().Add(duration)
+
+	err := c.logWrite(walRecord{
+		Op:        walExpire,
+		Key:       key,
+		ExpiresAt: expiresAt.UnixNano(),
+	})
+	if err != nil {
+		return err
+	}
+	// Re-expiring a key moves its expiration rather than adding a second
+	// node for it.
+	shard.expirations.Insert(binheap.NewNode(key, expiresAt))
+	c.expirationScheduled(expiresAt)
+
+	return nil
+}
 
-	c.copyCache()
-	return err
+// clampTTL cuts a requested TTL (in seconds) down to the configured
+// MaxTTLSeconds, if there is one.
+func (c *Cache) clampTTL(key string, timeout int) int {
+	maxTTL := c.config.MaxTTLSeconds
+	if maxTTL <= 0 || timeout <= maxTTL {
+		return timeout
+	}
+
+	log.Printf("Clamping TTL for %v from %ds to %ds", key, timeout, maxTTL)
+	atomic.AddUint64(&c.counters.clampedTTLs, 1)
+
+	return maxTTL
 }
 
 // EvictExpiredKeys handles
 func (c *Cache) EvictExpiredkeys(expirationDate time.Time) {
-	keysToExpire := make([]string, len(c.binHeap.Tree))
+	if c.maintenancePaused() {
+		return
+	}
 
-	i := 0
+	var keysToExpire []string
+	max := c.evictionCap()
 
 	c.Lock()
 	for {
-		node, err := c.binHeap.Peek(i)
-		if err != nil {
+		if max > 0 && len(keysToExpire) >= max {
 			break
 		}
 
+		// Keys are swept in order of expiration across every shard, so
+		// a capped sweep always takes the longest expired keys.
+		shard := c.soonestExpiringShard()
+		if shard == nil {
+			break
+		}
+
+		node := shard.expirations.MinNode()
 		if expirationDate.Sub(node.Timeout) < 0 {
 			break
-		} else {
-			keysToExpire = append(keysToExpire, node.Key)
 		}
 
-		i++
+		// Expired nodes are popped off the heap as they're swept, so
+		// the next sweep starts at the first node which hasn't expired.
+		shard.expirations.EvictMinNode()
+		if _, ok := shard.entries[node.Key]; ok {
+			keysToExpire = append(keysToExpire, node.Key)
+		}
 	}
 
 	for _, key := range keysToExpire {
-		c.expireKey(key)
+		c.expireKey(c.shardOf(key), key)
+	}
+	if len(keysToExpire) > 0 {
+		c.copyCache()
 	}
 	c.Unlock()
+
+	c.sweptEvictions(len(keysToExpire), max)
+}
+
+// soonestExpiringShard returns the shard whose next expiration is the
+// soonest, or nil if no key expires. The caller must hold the cache lock
+// exclusively.
+func (c *Cache) soonestExpiringShard() *cacheShard {
+	var soonest *cacheShard
+	for _, shard := range c.shards {
+		node := shard.expirations.MinNode()
+		if node == nil {
+			continue
+		}
+
+		if soonest == nil || node.Timeout.Before(soonest.expirations.MinNode().Timeout) {
+			soonest = shard
+		}
+	}
+
+	return soonest
 }
 
-func (c *Cache) expireKey(key string) {
-	delete(*c.cache, key)
-	// TODO(ian): We need to also remove the the key from the binary heap.
+func (c *Cache) expireKey(shard *cacheShard, key string) {
+	if _, ok := shard.entries[key]; !ok {
+		return
+	}
+
+	if err := c.logWrite(walRecord{Op: walDelete, Key: key}); err != nil {
+		log.Printf("Failed to log the expiration of %v: %v", key, err)
+	}
+	c.deleteEntry(shard, key)
+	c.publishExpiration(key, ExpiredTTL)
+	atomic.AddUint64(&c.counters.expirations, 1)
 }
 
 func (c *Cache) DisconnectPeer(peerIPPort string) string {
 	outString := "Peer not found in peer list."
-	for _, peer := range c.PeerList.Peers {
-		if peer.IPPort != peerIPPort {
+	for _, peer := range c.PeerList.GetPeers() {
+		if peer == nil || peer.IPPort != peerIPPort {
 			continue
 		}
 
-		if peer != nil && peer.Status == dht.Connected {
+		// The peer gives up its slot before disconnecting, so dropping
+		// it doesn't also fail over from it.
+		c.replacePeer(peer.IPPort)
+
+		if peer.GetStatus() == dht.Connected {
 			peer.Disconnect()
 			outString = "Peer has been disconnected."
 		}
-
-		// TODO(ian): Connect a backup node after one node has forced itself to be evicted.
 	}
 
 	return outString
 }
 
+// replacePeer drops an active peer and promotes a backup peer into its slot,
+// so remote gets keep the same coverage.
+func (c *Cache) replacePeer(peerIPPort string) {
+	c.replaceLock.Lock()
+	defer c.replaceLock.Unlock()
+
+	c.replacePeerLocked(peerIPPort)
+}
+
+// replacePeerLocked is replacePeer for callers holding replaceLock.
+func (c *Cache) replacePeerLocked(peerIPPort string) {
+	c.PeerList.RemovePeer(peerIPPort)
+	c.ring.Remove(peerIPPort)
+
+	if promoted := c.PeerList.PromoteBackupPeer(); promoted != nil {
+		log.Printf("Promoted backup peer %v to replace %v", promoted.IPPort, peerIPPort)
+		c.ring.Add(promoted.IPPort)
+	}
+
+	c.recalculateSearches()
+	c.ringChanged()
+}
+
+// failOver promotes a backup peer into the slot of an active peer which
+// dropped, without waiting on the next heartbeat to notice. With no backup
+// peers to promote the peer keeps its slot and its place on the hash ring, so
+// writes it owns are hinted until it reconnects.
+func (c *Cache) failOver(peer *dht.Peer) {
+	select {
+	case <-c.stopped:
+		return
+	default:
+	}
+
+	c.replaceLock.Lock()
+	defer c.replaceLock.Unlock()
+
+	// The peer may have reconnected, or been replaced already.
+	if c.findPeer(peer.IPPort) != peer || peer.IsConnectable() || !c.hasBackupPeers() {
+		return
+	}
+
+	log.Printf("Failing over from %v", peer.IPPort)
+	c.replacePeerLocked(peer.IPPort)
+}
+
+func (c *Cache) hasBackupPeers() bool {
+	for _, backup := range c.PeerList.GetBackupPeers() {
+		if backup != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (c *Cache) AddPeer(peerIPPort string) {
 	c.PeerList.AddPeer(peerIPPort)
+	if !dht.IsSelf(peerIPPort, c.config) {
+		c.ring.Add(peerIPPort)
+	}
+
+	c.recalculateSearches()
+	c.ringChanged()
+}
+
+// recalculateSearches rebuilds remote get routing from the current peers.
+func (c *Cache) recalculateSearches() {
+	c.searchLock.Lock()
+	defer c.searchLock.Unlock()
 
 	if c.bloomfilterSearch == nil {
-		c.bloomfilterSearch = bfsearch.NewSearch(*c.PeerList)
+		c.bloomfilterSearch = bfsearch.NewSearch(*c.PeerList.Snapshot())
 	} else {
-		c.bloomfilterSearch.Recalculate(*c.PeerList)
+		c.bloomfilterSearch.Recalculate(*c.PeerList.Snapshot())
+	}
+
+	c.recalculatePartitionedSearch()
+	c.recalculateClusterFilter()
+}
+
+// peerFilterChanged rebuilds remote get routing as soon as a peer's bloom
+// filter changes, once there's routing to rebuild.
+func (c *Cache) peerFilterChanged(peer *dht.Peer) {
+	c.searchLock.Lock()
+	built := c.bloomfilterSearch != nil
+	c.searchLock.Unlock()
+
+	if built {
+		c.recalculateSearches()
 	}
 }
 
@@ -209,7 +1041,7 @@ func (c *Cache) ListPeers(requestHash string) string {
 	count := 0
 	outString := fmt.Sprintf("%s:FULFILLED ", requestHash)
 
-	for _, peer := range c.PeerList.Peers {
+	for _, peer := range c.PeerList.GetPeers() {
 		if peer == nil {
 			continue
 		}
@@ -231,7 +1063,7 @@ func (c *Cache) ListPeers(requestHash string) string {
 		}
 	}
 
-	for _, peer := range c.PeerList.BackupPeers {
+	for _, peer := range c.PeerList.GetBackupPeers() {
 		if peer == nil {
 			continue
 		}
@@ -249,6 +1081,45 @@ func (c *Cache) ListPeers(requestHash string) string {
 	)
 }
 
+// PeerInfo describes every known peer, backups included, along with its
+// connection metrics.
+func (c *Cache) PeerInfo() []dht.PeerInfo {
+	if c.PeerList == nil {
+		return nil
+	}
+
+	var infos []dht.PeerInfo
+	for _, peer := range append(c.PeerList.GetPeers(), c.PeerList.GetBackupPeers()...) {
+		if peer != nil {
+			infos = append(infos, peer.PeerInfo())
+		}
+	}
+
+	return infos
+}
+
+// EffectiveConfig returns the config the cache is running with, after the
+// config file and environment overrides were applied, with its secrets
+// redacted.
+func (c *Cache) EffectiveConfig() config.Cfg {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.config.Redacted()
+}
+
 func (c *Cache) GetBloomFilter() bloomfilter.BloomFilter {
+	c.Lock()
+	defer c.Unlock()
+
 	return c.bloomFilter
 }
+
+// SerializeForPeers serializes one of our bloom filters the way
+// BloomfilterEncoding says it's sent to peers.
+func (c *Cache) SerializeForPeers(bf bloomfilter.BloomFilter) string {
+	return bloomfilter.SerializeAs(
+		bf,
+		bloomfilter.ParseEncoding(c.config.BloomfilterEncoding),
+	)
+}
@@ -2,6 +2,9 @@ package cache
 
 import (
 	"fmt"
+	"github.com/GrappigPanda/Olivia/config"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 )
@@ -71,3 +74,505 @@ func TestCache_SetExpiration(t *testing.T) {
 	}
 
 }
+
+func TestEvictExpiredKeysIsCapped(t *testing.T) {
+	cache := NewCache(nil, stubConfig())
+	cache.config.MaxEvictionsPerSweep = 3
+
+	for i := 0; i < 10; i++ {
+		if err := cache.SetExpiration(fmt.Sprintf("key%d", i), "value", 1); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+
+	future := time.Now().UTC().Add(time.Hour)
+	remaining := 10
+	for sweep := 0; remaining > 0; sweep++ {
+		if sweep == 4 {
+			t.Fatalf("Expected the keys to be evicted within 4 sweeps, %d are left", remaining)
+		}
+
+		cache.EvictExpiredkeys(future)
+
+		left := cache.keyCount()
+		if evicted := remaining - left; evicted > 3 {
+			t.Fatalf("Expected at most %v evictions, got %v", 3, evicted)
+		}
+		remaining = left
+	}
+}
+
+func TestUpdateConcurrent(t *testing.T) {
+	cache := NewCache(nil, nil)
+
+	key := "TestUpdateKey"
+	increment := func(old string, existed bool) (string, bool) {
+		count := 0
+		if existed {
+			count, _ = strconv.Atoi(old)
+		}
+
+		return strconv.Itoa(count + 1), true
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if err := cache.Update(key, increment); err != nil {
+					t.Errorf("Got error Update'ing: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	value, err := cache.Get(key)
+	if err != nil {
+		t.Fatalf("Got error from GETing key: %v", err)
+	}
+
+	if value != "1000" {
+		t.Fatalf("Expected %v, got %v", "1000", value)
+	}
+}
+
+func TestUpdateDelete(t *testing.T) {
+	cache := NewCache(nil, nil)
+
+	key := "TestUpdateDeleteKey"
+	cache.Set(key, "1024")
+
+	err := cache.Update(key, func(old string, existed bool) (string, bool) {
+		if !existed || old != "1024" {
+			t.Errorf("Expected existing value 1024, got %v (%v)", old, existed)
+		}
+		return "", false
+	})
+	if err != nil {
+		t.Fatalf("Got error Update'ing: %v", err)
+	}
+
+	if value, err := cache.Get(key); err == nil {
+		t.Fatalf("Expected key to be deleted, got %v", value)
+	}
+}
+
+func TestSetExpirationClampsTTL(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{IsTesting: true, MaxTTLSeconds: 60})
+
+	key := "TestClampedKey"
+	before := time.Now().UTC()
+	if err := cache.SetExpiration(key, "1024", 60*60*24*365); err != nil {
+		t.Fatalf("Got an error SetExpiration'ing: %v", err)
+	}
+	after := time.Now().UTC()
+
+	node, ok := cache.shardOf(key).expirations.Get(key)
+	if !ok {
+		t.Fatalf("Expected %v to have an expiration", key)
+	}
+
+	if node.Timeout.Before(before.Add(60*time.Second)) ||
+		node.Timeout.After(after.Add(60*time.Second)) {
+		t.Fatalf("Expected expiration to be clamped to 60s, got %v", node.Timeout.Sub(before))
+	}
+
+	if clamped := cache.Stats().ClampedTTLs; clamped != 1 {
+		t.Fatalf("Expected 1 clamped TTL, got %v", clamped)
+	}
+
+	cache.SetExpiration("TestUnclampedKey", "1024", 30)
+	if clamped := cache.Stats().ClampedTTLs; clamped != 1 {
+		t.Fatalf("Expected TTLs under the cap to be left alone, got %v clamped", clamped)
+	}
+}
+
+func TestNewCacheSkipsOwnAddress(t *testing.T) {
+	cfg := &config.Cfg{
+		IsTesting:   true,
+		ListenPort:  5999,
+		RemotePeers: []string{"127.0.0.1:5999", "127.0.0.1:6000"},
+	}
+
+	cache := NewCache(nil, cfg)
+
+	if _, ok := (*cache.PeerList.PeerMap)["127.0.0.1:5999"]; ok {
+		t.Fatalf("Expected our own address to be skipped")
+	}
+
+	if cache.PeerList.Peers[0] == nil || cache.PeerList.Peers[0].IPPort != "127.0.0.1:6000" {
+		t.Fatalf("Expected %v, got %v", "127.0.0.1:6000", cache.PeerList.Peers[0])
+	}
+}
+
+func TestGetEmptyValueFromPeer(t *testing.T) {
+	peer := newStubPeer(t, map[string]string{"emptykey": ""})
+	defer peer.Close()
+
+	cache := newCacheWithStubPeers(t, peer)
+
+	value, err := cache.Get("emptykey")
+	if err != nil {
+		t.Fatalf("Expected the empty value to be found, got %v", err)
+	}
+	if value != "" {
+		t.Fatalf("Expected %q, got %q", "", value)
+	}
+
+	if _, err := cache.Get("missingkey"); err == nil {
+		t.Fatalf("Expected an error for a missing key")
+	}
+}
+
+func TestRedundantSetsSkipRebuild(t *testing.T) {
+	cfg := stubConfig()
+	cfg.SkipRedundantSets = true
+	cache := NewCache(nil, cfg)
+
+	cache.Set("key1", "value1")
+	rebuilds := cache.Stats().ReadCacheRebuilds
+
+	for i := 0; i < 5; i++ {
+		cache.Set("key1", "value1")
+	}
+
+	stats := cache.Stats()
+	if stats.RedundantSets != 5 {
+		t.Fatalf("Expected %v, got %v", 5, stats.RedundantSets)
+	}
+	if stats.ReadCacheRebuilds != rebuilds {
+		t.Fatalf("Expected %v rebuilds, got %v", rebuilds, stats.ReadCacheRebuilds)
+	}
+
+	cache.Set("key1", "value2")
+	if cache.Stats().ReadCacheRebuilds != rebuilds+1 {
+		t.Fatalf("Expected a changed value to rebuild the read cache")
+	}
+}
+
+func TestPlainSetClearsExpiration(t *testing.T) {
+	for _, clears := range []bool{true, false} {
+		cfg := stubConfig()
+		cfg.OverwriteClearsTTL = clears
+		cache := NewCache(nil, cfg)
+
+		cache.SetExpiration("key1", "value1", 1)
+		cache.Set("key1", "value2")
+		cache.EvictExpiredkeys(time.Now().UTC().Add(time.Hour))
+
+		_, err := cache.Get("key1")
+		if clears && err != nil {
+			t.Fatalf("Expected the overwritten key to be kept, got %v", err)
+		}
+		if !clears && err == nil {
+			t.Fatalf("Expected the overwritten key to still expire")
+		}
+	}
+}
+
+func TestEvictionDrainsHeap(t *testing.T) {
+	cache := NewCache(nil, stubConfig())
+
+	for i := 0; i < 10; i++ {
+		cache.SetExpiration(fmt.Sprintf("key%d", i), "value", 1)
+	}
+	// A key which is deleted before it expires takes its node along.
+	cache.Update("key0", func(string, bool) (string, bool) { return "", false })
+
+	cache.EvictExpiredkeys(time.Now().UTC().Add(time.Hour))
+
+	if !cache.noExpirations() {
+		t.Fatalf("Expected the heap to be drained")
+	}
+	if cache.keyCount() != 0 {
+		t.Fatalf("Expected every key to be evicted, %v keys are left", cache.keyCount())
+	}
+}
+
+func TestReExpiringKeyMovesItsExpiration(t *testing.T) {
+	cache := NewCache(nil, stubConfig())
+	sweepAt := time.Now().UTC().Add(10 * time.Second)
+
+	cache.SetExpiration("shorter", "value", 100)
+	cache.SetExpiration("shorter", "value", 1)
+	cache.SetExpiration("longer", "value", 1)
+	cache.SetExpiration("longer", "value", 100)
+
+	cache.EvictExpiredkeys(sweepAt)
+
+	if _, err := cache.Get("shorter"); err == nil {
+		t.Fatalf("Expected the shortened TTL to expire the key")
+	}
+	if _, err := cache.Get("longer"); err != nil {
+		t.Fatalf("Expected the lengthened TTL to keep the key, got %v", err)
+	}
+
+	expirations := cache.shardOf("longer").expirations
+	node, err := expirations.Peek(0)
+	if err != nil || node.Key != "longer" {
+		t.Fatalf("Expected only longer's node to be left, got %v (%v)", node, err)
+	}
+	if _, err := expirations.Peek(1); err == nil {
+		t.Fatalf("Expected a single node per key")
+	}
+	if _, pending := cache.shardOf("shorter").expirations.Get("shorter"); pending {
+		t.Fatalf("Expected shorter's node to be swept")
+	}
+}
+
+func TestDelete(t *testing.T) {
+	cache := NewCache(nil, stubConfig())
+
+	cache.SetExpiration("key1", "value1", 100)
+	cache.Set("key2", "value2")
+
+	if err := cache.Delete("key1"); err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+
+	if _, err := cache.Get("key1"); err == nil {
+		t.Fatalf("Expected the deleted key to be gone")
+	}
+	if hasKey, _ := cache.GetBloomFilter().HasKey([]byte("key1")); hasKey {
+		t.Fatalf("Expected the deleted key to be removed from the bloom filter")
+	}
+	if _, pending := cache.shardOf("key1").expirations.Get("key1"); pending {
+		t.Fatalf("Expected the deleted key's expiration to be removed")
+	}
+
+	if hasKey, _ := cache.GetBloomFilter().HasKey([]byte("key2")); !hasKey {
+		t.Fatalf("Expected key2 to still be in the bloom filter")
+	}
+
+	if err := cache.Delete("key1"); err == nil {
+		t.Fatalf("Expected an error deleting a missing key")
+	}
+}
+
+func TestOverwriteDoesNotPinBloomFilter(t *testing.T) {
+	cache := NewCache(nil, stubConfig())
+
+	cache.Set("key1", "value1")
+	cache.Set("key1", "value2")
+	cache.Delete("key1")
+
+	if hasKey, _ := cache.GetBloomFilter().HasKey([]byte("key1")); hasKey {
+		t.Fatalf("Expected an overwritten key to be counted once")
+	}
+}
+
+func TestConcurrentGetAndSet(t *testing.T) {
+	cache := NewCache(nil, stubConfig())
+	for i := 0; i < 10; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), "0")
+	}
+
+	var wg sync.WaitGroup
+	for writer := 0; writer < 8; writer++ {
+		wg.Add(1)
+		go func(writer int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				cache.Set(fmt.Sprintf("key%d", i%10), strconv.Itoa(writer*1000+i))
+			}
+		}(writer)
+	}
+
+	for reader := 0; reader < 8; reader++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				value, err := cache.Get(fmt.Sprintf("key%d", i%10))
+				if err != nil {
+					t.Errorf("Expected nil, got %v", err)
+					return
+				}
+				if _, err := strconv.Atoi(value); err != nil {
+					t.Errorf("Expected a number, got %q", value)
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+func TestGetSeesEveryWrite(t *testing.T) {
+	cache := NewCache(nil, stubConfig())
+
+	cache.Set("key1", "value1")
+	cache.Update("key1", func(string, bool) (string, bool) { return "value2", true })
+	if value, _ := cache.Get("key1"); value != "value2" {
+		t.Fatalf("Expected %v, got %v", "value2", value)
+	}
+
+	cache.Delete("key1")
+	if _, err := cache.Get("key1"); err == nil {
+		t.Fatalf("Expected the deleted key to be gone from the read cache")
+	}
+
+	cache.SetExpiration("key2", "value2", 1)
+	cache.EvictExpiredkeys(time.Now().UTC().Add(time.Hour))
+	if _, err := cache.Get("key2"); err == nil {
+		t.Fatalf("Expected the expired key to be gone from the read cache")
+	}
+}
+
+func benchmarkGet(b *testing.B, withWriter bool) {
+	cache := NewCache(nil, stubConfig())
+	for i := 0; i < 100; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), "value")
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	if withWriter {
+		go func() {
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+					cache.Set(fmt.Sprintf("key%d", i%100), strconv.Itoa(i))
+				}
+			}
+		}()
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			cache.Get(fmt.Sprintf("key%d", i%100))
+			i++
+		}
+	})
+}
+
+func BenchmarkGet(b *testing.B) {
+	benchmarkGet(b, false)
+}
+
+func BenchmarkGetDuringSets(b *testing.B) {
+	benchmarkGet(b, true)
+}
+
+// benchmarkSet measures a Set into a cache already holding `keys` keys, which
+// includes republishing the read cache.
+func benchmarkSet(b *testing.B, keys int) {
+	cache := NewCache(nil, stubConfig())
+	for i := 0; i < keys; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), "value")
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cache.Set(fmt.Sprintf("key%d", i%keys), strconv.Itoa(i))
+	}
+}
+
+func BenchmarkSet1K(b *testing.B) {
+	benchmarkSet(b, 1000)
+}
+
+func BenchmarkSet10K(b *testing.B) {
+	benchmarkSet(b, 10000)
+}
+
+func TestDisconnectPeerPromotesBackup(t *testing.T) {
+	var stubs []*stubPeer
+	for i := 0; i < 3; i++ {
+		stub := newStubPeer(t, map[string]string{})
+		defer stub.Close()
+		stubs = append(stubs, stub)
+	}
+	backup := newStubPeer(t, map[string]string{"backupkey": "backupvalue"})
+	defer backup.Close()
+
+	cache := newCacheWithStubPeers(t, stubs...)
+	cache.AddPeer(backup.Addr())
+	if peers := cache.PeerList.GetBackupPeers(); peers[0] == nil || peers[0].IPPort != backup.Addr() {
+		t.Fatalf("Expected %v to be a backup peer, got %v", backup.Addr(), peers)
+	}
+
+	cache.DisconnectPeer(stubs[0].Addr())
+
+	promoted := cache.PeerList.GetPeers()[0]
+	if promoted == nil || promoted.IPPort != backup.Addr() {
+		t.Fatalf("Expected %v to take the freed slot, got %v", backup.Addr(), promoted)
+	}
+	if cache.PeerList.HasPeer(stubs[0].Addr()) || !cache.PeerList.HasPeer(backup.Addr()) {
+		t.Fatalf("Expected the peer map to follow the promotion")
+	}
+
+	// The promoted peer's bloom filter is fetched asynchronously, and is
+	// routed on once the searches are next recalculated.
+	for attempt := 0; ; attempt++ {
+		if ok, _ := promoted.GetRemoteFilter().HasKey([]byte("backupkey")); ok {
+			break
+		}
+		if attempt == 100 {
+			t.Fatalf("Never received a bloom filter from %v", backup.Addr())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cache.recalculateSearches()
+
+	if value, err := cache.Get("backupkey"); err != nil || value != "backupvalue" {
+		t.Fatalf("Expected %v, got %v (%v)", "backupvalue", value, err)
+	}
+}
+
+func TestDroppedPeerFailsOverToBackup(t *testing.T) {
+	active := newStubPeer(t, map[string]string{})
+	defer active.Close()
+	backup := newStubPeer(t, map[string]string{})
+	defer backup.Close()
+
+	cache := newCacheWithStubPeers(t, active)
+	for _, address := range []string{"127.0.0.1:1", "127.0.0.1:2", backup.Addr()} {
+		cache.AddPeer(address)
+	}
+
+	// The connection dropping is enough, without waiting on a heartbeat.
+	cache.findPeer(active.Addr()).Disconnect()
+
+	for attempt := 0; !cache.PeerList.HasPeer(backup.Addr()) || cache.findPeer(backup.Addr()) == nil; attempt++ {
+		if attempt == 100 {
+			t.Fatalf("Expected %v to be promoted", backup.Addr())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if cache.findPeer(active.Addr()) != nil {
+		t.Fatalf("Expected %v to give up its slot", active.Addr())
+	}
+}
+
+func TestEffectiveConfig(t *testing.T) {
+	t.Setenv("OLIVIA_MAXRANGEKEYS", "42")
+	t.Setenv("OLIVIA_CLUSTERSECRET", "s3cret")
+
+	cfg := config.ReadConfig()
+	cfg.IsTesting = true
+	cfg.SkipRedundantSets = false
+	cache := NewCache(nil, cfg)
+
+	effective := cache.EffectiveConfig()
+	if effective.HeartbeatLoop != 30 {
+		t.Fatalf("Expected the config file's 30, got %v", effective.HeartbeatLoop)
+	}
+	if effective.MaxRangeKeys != 42 {
+		t.Fatalf("Expected the environment's 42, got %v", effective.MaxRangeKeys)
+	}
+	if !effective.IsTesting || effective.SkipRedundantSets {
+		t.Fatalf("Expected the values set in code, got %+v", effective)
+	}
+	if effective.ClusterSecret == "s3cret" || effective.ClusterSecret == "" {
+		t.Fatalf("Expected the secret to be redacted, got %v", effective.ClusterSecret)
+	}
+}
@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// ChangeOp is how a key changed.
+type ChangeOp int
+
+const (
+	// ChangeSet signifies that the key was written.
+	ChangeSet ChangeOp = iota
+	// ChangeDelete signifies that the key was removed, whether it was
+	// deleted, expired or evicted.
+	ChangeDelete
+)
+
+// String returns a human readable op.
+func (o ChangeOp) String() string {
+	switch o {
+	case ChangeSet:
+		return "set"
+	case ChangeDelete:
+		return "delete"
+	}
+
+	return "unknown"
+}
+
+// ChangeEvent is sent to every change stream whenever a key is written or
+// removed. Value is empty for a ChangeDelete.
+type ChangeEvent struct {
+	Key   string
+	Op    ChangeOp
+	Value string
+	At    time.Time
+}
+
+// OnChangeStream registers a channel which receives a ChangeEvent for every
+// key written to or removed from the cache. Like expiration streams, events
+// are never waited on: if the channel is full, the event is dropped and
+// counted in Stats().DroppedChangeEvents.
+func (c *Cache) OnChangeStream(ch chan<- ChangeEvent) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.changeStreams = append(c.changeStreams, ch)
+}
+
+// RemoveChangeStream unregisters a channel OnChangeStream registered. Once
+// it returns, the channel receives no more events.
+func (c *Cache) RemoveChangeStream(ch chan<- ChangeEvent) {
+	c.Lock()
+	defer c.Unlock()
+
+	for i, stream := range c.changeStreams {
+		if stream == ch {
+			c.changeStreams = append(c.changeStreams[:i:i], c.changeStreams[i+1:]...)
+			return
+		}
+	}
+}
+
+// publishChange sends a change to every registered stream. The caller must
+// hold the cache lock, shared or not.
+func (c *Cache) publishChange(key string, op ChangeOp, value string) {
+	if len(c.changeStreams) == 0 {
+		return
+	}
+
+	event := ChangeEvent{
+		Key:   key,
+		Op:    op,
+		Value: value,
+		At:    time.Now().UTC(),
+	}
+
+	for _, stream := range c.changeStreams {
+		select {
+		case stream <- event:
+		default:
+			atomic.AddUint64(&c.counters.droppedChangeEvents, 1)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChangeStreamReceivesEvents(t *testing.T) {
+	cache := NewCache(nil, nil)
+	events := make(chan ChangeEvent, 10)
+	cache.OnChangeStream(events)
+
+	cache.Set("key1", "value1")
+	cache.Delete("key1")
+	cache.Delete("key1")
+
+	var expected = []ChangeEvent{
+		{Key: "key1", Op: ChangeSet, Value: "value1"},
+		{Key: "key1", Op: ChangeDelete},
+	}
+
+	for _, want := range expected {
+		select {
+		case event := <-events:
+			if event.Key != want.Key || event.Op != want.Op || event.Value != want.Value {
+				t.Fatalf("Expected %v, got %v", want, event)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected %v, got nothing", want)
+		}
+	}
+
+	// Deleting a missing key changes nothing.
+	select {
+	case event := <-events:
+		t.Fatalf("Expected no more events, got %v", event)
+	default:
+	}
+}
+
+func TestChangeStreamSeesExpirations(t *testing.T) {
+	cache := NewCache(nil, nil)
+	cache.SetExpiration("key1", "value1", 1)
+
+	events := make(chan ChangeEvent, 10)
+	cache.OnChangeStream(events)
+
+	time.Sleep(1100 * time.Millisecond)
+	cache.EvictExpiredkeys(time.Now().UTC())
+
+	select {
+	case event := <-events:
+		if event.Key != "key1" || event.Op != ChangeDelete {
+			t.Fatalf("Expected %v, got %v", ChangeDelete, event)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected an event, got nothing")
+	}
+}
+
+func TestRemoveChangeStream(t *testing.T) {
+	cache := NewCache(nil, nil)
+	removed := make(chan ChangeEvent, 1)
+	kept := make(chan ChangeEvent, 1)
+	cache.OnChangeStream(removed)
+	cache.OnChangeStream(kept)
+	cache.RemoveChangeStream(removed)
+
+	cache.Set("key1", "value1")
+
+	if len(removed) != 0 {
+		t.Fatalf("Expected %v, got %v", 0, len(removed))
+	}
+	if len(kept) != 1 {
+		t.Fatalf("Expected %v, got %v", 1, len(kept))
+	}
+
+	cache.Set("key2", "value2")
+	if dropped := cache.Stats().DroppedChangeEvents; dropped != 1 {
+		t.Fatalf("Expected %v, got %v", 1, dropped)
+	}
+}
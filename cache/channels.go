@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"github.com/GrappigPanda/Olivia/parser"
+	"log"
+	"strings"
+)
+
+// Publish sends `message` to the subscribers of `channel` across the
+// cluster: ours right away, and our peers' through a RELAY sent in the
+// background. It returns how many of our own subscribers received it.
+// Channels are shared by every namespace.
+func (c *Cache) Publish(channel string, message string) (int, error) {
+	if c.root != nil {
+		return c.root.Publish(channel, message)
+	}
+
+	if channel == "" || strings.ContainsAny(channel, " ,:\r\n") {
+		return 0, fmt.Errorf("Invalid channel %q", channel)
+	}
+
+	if c.PeerList != nil {
+		go c.relayToPeers(channel, message)
+	}
+
+	return c.Relay(channel, message), nil
+}
+
+// Relay sends a message a peer published to our own subscribers of
+// `channel` only, so it isn't relayed any further. It returns how many
+// received it.
+func (c *Cache) Relay(channel string, message string) int {
+	if c.MessageBus == nil {
+		return 0
+	}
+
+	return c.MessageBus.Publish(channel, message)
+}
+
+// relayToPeers sends a published message to every peer we're connected to.
+func (c *Cache) relayToPeers(channel string, message string) {
+	token, payload, framed := parser.FrameValue(message)
+	var payloads []string
+	if framed {
+		payloads = append(payloads, payload)
+	}
+	request := parser.FrameCommand(fmt.Sprintf("RELAY %s:%s", channel, token), payloads)
+
+	for _, peer := range c.connectablePeers() {
+		ctx, cancel := context.WithTimeout(context.Background(), replicationTimeout)
+		_, err := peer.Request(ctx, request)
+		cancel()
+
+		if err != nil {
+			log.Printf("Failed to relay a message on %v to %v: %v", channel, peer.IPPort, err)
+		}
+	}
+}
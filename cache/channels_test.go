@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"github.com/GrappigPanda/Olivia/network/message_handler"
+	"testing"
+	"time"
+)
+
+func TestPublishDeliversLocallyAndRelaysToPeers(t *testing.T) {
+	stub := newStubPeer(t, map[string]string{})
+	defer stub.Close()
+
+	cache := newCacheWithStubPeers(t, stub)
+	messages := make(chan message_handler.ChannelMessage, 1)
+	cache.MessageBus.Subscribe("news", messages)
+
+	received, err := cache.Publish("news", "hello world")
+	if err != nil || received != 1 {
+		t.Fatalf("Expected 1, got %v (%v)", received, err)
+	}
+	if message := <-messages; message.Message != "hello world" {
+		t.Fatalf("Expected %v, got %v", "hello world", message.Message)
+	}
+
+	for attempt := 0; len(stub.Relays()) == 0; attempt++ {
+		if attempt == 100 {
+			t.Fatalf("Never relayed the message to %v", stub.Addr())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if relays := stub.Relays(); relays[0] != "news:hello world" {
+		t.Fatalf("Expected %v, got %v", "news:hello world", relays[0])
+	}
+
+	// Relayed messages only reach our own subscribers.
+	if received := cache.Relay("news", "again"); received != 1 {
+		t.Fatalf("Expected 1, got %v", received)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if relays := stub.Relays(); len(relays) != 1 {
+		t.Fatalf("Expected a single relay, got %v", relays)
+	}
+}
+
+func TestPublishRefusesInvalidChannels(t *testing.T) {
+	cache := NewCache(message_handler.NewMessageHandler(), nil)
+
+	for _, channel := range []string{"", "a:b", "a,b", "a b"} {
+		if _, err := cache.Publish(channel, "message"); err == nil {
+			t.Fatalf("Expected %q to be refused", channel)
+		}
+	}
+}
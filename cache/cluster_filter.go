@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"github.com/GrappigPanda/Olivia/bloomfilter"
+	"log"
+)
+
+// recalculateClusterFilter rebuilds the union of our peers' whole-node bloom
+// filters. Peers whose filters are shaped otherwise than ours are left out of
+// it, so it's only consulted while every peer made it in.
+func (c *Cache) recalculateClusterFilter() {
+	if c.PeerList == nil || c.routesByCuckoo() {
+		return
+	}
+
+	cluster := bloomfilter.NewByFailRate(baseBloomItems, 0.01)
+	complete := true
+	for _, peer := range c.PeerList.GetPeers() {
+		if peer == nil {
+			continue
+		}
+
+		peer.Lock()
+		var err error
+		if peer.BloomFilter != nil {
+			err = cluster.Merge(peer.BloomFilter)
+		}
+		peer.Unlock()
+
+		if err != nil {
+			log.Printf("Leaving %v out of the cluster filter: %v", peer.IPPort, err)
+			complete = false
+		}
+	}
+
+	if !complete {
+		cluster = nil
+	}
+
+	c.clusterFilterLock.Lock()
+	c.clusterFilter = cluster
+	c.clusterFilterLock.Unlock()
+}
+
+// clusterMayHold reports whether any peer's bloom filter may hold `key`, as
+// far as the cluster filter tells. Without a cluster filter every key may be
+// held.
+func (c *Cache) clusterMayHold(key string) bool {
+	c.clusterFilterLock.RLock()
+	cluster := c.clusterFilter
+	c.clusterFilterLock.RUnlock()
+
+	if cluster == nil {
+		return true
+	}
+
+	storage := cluster.GetStorage()
+	for _, index := range c.routingIndices(key, false) {
+		if !storage.IsSet(index) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,35 @@
+package cache
+
+import (
+	"testing"
+)
+
+func TestClusterFilterTurnsAwayUnheldKeys(t *testing.T) {
+	first := newStubPeer(t, map[string]string{"first": "value"})
+	defer first.Close()
+	second := newStubPeer(t, map[string]string{"second": "value"})
+	defer second.Close()
+
+	cache := newCacheWithStubPeers(t, first, second)
+	cache.recalculateSearches()
+
+	for _, key := range []string{"first", "second"} {
+		if !cache.clusterMayHold(key) {
+			t.Fatalf("Expected the cluster filter to hold %v", key)
+		}
+		if value, err := cache.Get(key); err != nil || value != "value" {
+			t.Fatalf("Expected value, got %v (%v)", value, err)
+		}
+	}
+
+	if cache.clusterMayHold("nowhere") {
+		t.Fatalf("Expected the cluster filter not to hold nowhere")
+	}
+	gets := first.Gets() + second.Gets()
+	if _, err := cache.Get("nowhere"); err == nil {
+		t.Fatalf("Expected no peer to hold the key")
+	}
+	if after := first.Gets() + second.Gets(); after != gets {
+		t.Fatalf("Expected %d GETs, got %d", gets, after)
+	}
+}
@@ -0,0 +1,40 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrValueMismatch is returned by CompareAndSwap when the key no longer holds
+// the value the caller expected.
+var ErrValueMismatch = errors.New("Value doesn't match the expected value")
+
+// CompareAndSwap sets `key` to `value`, but only if it currently holds
+// `expected`, checking and writing under the lock of the key's shard so no
+// other write can land in between. It returns ErrValueMismatch if the key
+// holds anything else.
+func (c *Cache) CompareAndSwap(key string, expected string, value string) error {
+	if err := c.validateValue(value); err != nil {
+		return err
+	}
+
+	return c.mutateKey(key, func(shard *cacheShard) error {
+		current, ok, err := shard.stringOf(key)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("Key not found in cache")
+		}
+		if current != expected {
+			return ErrValueMismatch
+		}
+
+		written, err := c.set(shard, key, value)
+		if written {
+			c.publishShard(shard)
+		}
+
+		return err
+	})
+}
@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCompareAndSwap(t *testing.T) {
+	cache := NewCache(nil, stubConfig())
+	cache.Set("key1", "value1")
+
+	if err := cache.CompareAndSwap("key1", "other", "value2"); err != ErrValueMismatch {
+		t.Fatalf("Expected %v, got %v", ErrValueMismatch, err)
+	}
+	if value, _ := cache.Get("key1"); value != "value1" {
+		t.Fatalf("Expected value1, got %v", value)
+	}
+
+	if err := cache.CompareAndSwap("key1", "value1", "value2"); err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	if value, _ := cache.Get("key1"); value != "value2" {
+		t.Fatalf("Expected value2, got %v", value)
+	}
+
+	if err := cache.CompareAndSwap("missing", "", "value"); err == nil || err == ErrValueMismatch {
+		t.Fatalf("Expected a missing key error, got %v", err)
+	}
+}
+
+func TestConcurrentCompareAndSwapHasOneWinner(t *testing.T) {
+	cache := NewCache(nil, stubConfig())
+	cache.Set("key1", "initial")
+
+	var wins int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if cache.CompareAndSwap("key1", "initial", string(rune('a'+i))) == nil {
+				atomic.AddInt32(&wins, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if wins != 1 {
+		t.Fatalf("Expected a single winner, got %v", wins)
+	}
+}
@@ -0,0 +1,38 @@
+package cache
+
+// SetIf sets `key` only if whether we hold it matches `exists`, like Redis's
+// SET with XX (true) or NX (false), and reports whether it was written. A
+// non-negative `timeout` expires the key after that many seconds, applied
+// along with the write.
+func (c *Cache) SetIf(key string, value string, exists bool, timeout int) (bool, error) {
+	if err := c.validateValue(value); err != nil {
+		return false, err
+	}
+	if timeout >= 0 {
+		timeout = c.clampTTL(key, timeout)
+	}
+
+	written := false
+	err := c.mutateKey(key, func(shard *cacheShard) error {
+		if _, ok := shard.entries[key]; ok != exists {
+			return nil
+		}
+
+		wrote, err := c.set(shard, key, value)
+		if wrote {
+			c.publishShard(shard)
+		}
+		if err != nil {
+			return err
+		}
+		written = true
+
+		if timeout < 0 {
+			return nil
+		}
+
+		return c.expire(shard, key, timeout)
+	})
+
+	return written, err
+}
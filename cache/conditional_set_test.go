@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"testing"
+)
+
+func TestSetIfMissing(t *testing.T) {
+	cache := NewCache(nil, stubConfig())
+
+	if written, err := cache.SetIf("key", "first", false, -1); err != nil || !written {
+		t.Fatalf("Expected a missing key to be written, got %v (%v)", written, err)
+	}
+
+	if written, _ := cache.SetIf("key", "second", false, -1); written {
+		t.Fatalf("Expected an existing key not to be overwritten")
+	}
+
+	if value, _ := cache.Get("key"); value != "first" {
+		t.Fatalf("Expected %v, got %v", "first", value)
+	}
+
+	if sets := cache.Stats().Sets; sets != 1 {
+		t.Fatalf("Expected %v, got %v", 1, sets)
+	}
+}
+
+func TestSetIfExists(t *testing.T) {
+	cache := NewCache(nil, stubConfig())
+
+	if written, _ := cache.SetIf("key", "value", true, -1); written {
+		t.Fatalf("Expected a missing key not to be written")
+	}
+	if _, err := cache.Get("key"); err == nil {
+		t.Fatalf("Expected the key to stay missing")
+	}
+
+	cache.Set("key", "first")
+	if written, err := cache.SetIf("key", "second", true, 30); err != nil || !written {
+		t.Fatalf("Expected an existing key to be overwritten, got %v (%v)", written, err)
+	}
+
+	if value, _ := cache.Get("key"); value != "second" {
+		t.Fatalf("Expected %v, got %v", "second", value)
+	}
+	if ttl, _ := cache.GetTTL("key"); ttl != 30 {
+		t.Fatalf("Expected %v, got %v", 30, ttl)
+	}
+}
@@ -0,0 +1,96 @@
+package cache
+
+import (
+	"fmt"
+	"github.com/GrappigPanda/Olivia/bloomfilter"
+	"github.com/GrappigPanda/Olivia/dht"
+	"log"
+	"sync/atomic"
+)
+
+// cuckooFilter is the cuckoo filter we keep of our keys for our peers to
+// route by, when the cluster routes by cuckoo filters.
+type cuckooFilter struct {
+	filter *bloomfilter.CuckooFilter
+	// items is how many keys the filter is sized for. It's doubled every
+	// time the filter fills up.
+	items uint
+	// growing is set while the filter is being rebuilt larger.
+	growing int32
+}
+
+// resize replaces the filter with an empty one sized for `items` keys.
+func (f *cuckooFilter) resize(items uint) {
+	f.filter = bloomfilter.NewCuckooByFailRate(items, 0.01)
+	f.items = items
+}
+
+// routesByCuckoo reports whether remote gets are routed by our peers' cuckoo
+// filters rather than their bloom filters.
+func (c *Cache) routesByCuckoo() bool {
+	return bloomfilter.ParseFilterKind(c.config.PeerFilter) == bloomfilter.CuckooFilterKind
+}
+
+// addToCuckooFilter adds a key to our cuckoo filter, rebuilding it larger in
+// the background once it's full. The caller must hold bloomLock, or the cache
+// lock exclusively.
+func (c *Cache) addToCuckooFilter(key string) {
+	if !c.routesByCuckoo() {
+		return
+	}
+
+	if !c.cuckoo.filter.Insert([]byte(key)) && atomic.CompareAndSwapInt32(&c.cuckoo.growing, 0, 1) {
+		go c.growCuckooFilter()
+	}
+}
+
+// removeFromCuckooFilter takes a key back out of our cuckoo filter. The
+// caller must hold bloomLock, or the cache lock exclusively.
+func (c *Cache) removeFromCuckooFilter(key string) {
+	if c.routesByCuckoo() {
+		c.cuckoo.filter.Delete([]byte(key))
+	}
+}
+
+// growCuckooFilter doubles the capacity of our cuckoo filter and re-adds
+// every key we hold, including the ones the full filter couldn't take.
+func (c *Cache) growCuckooFilter() {
+	c.Lock()
+	defer c.Unlock()
+	defer atomic.StoreInt32(&c.cuckoo.growing, 0)
+
+	c.cuckoo.resize(c.cuckoo.items * 2)
+	c.forEachEntry(func(key string, _ string) {
+		c.cuckoo.filter.Insert([]byte(key))
+	})
+
+	log.Printf("Grew our cuckoo filter to %d keys", c.cuckoo.items)
+}
+
+// SerializedCuckooFilter returns our cuckoo filter, serialized for a peer.
+func (c *Cache) SerializedCuckooFilter() (string, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if !c.routesByCuckoo() {
+		return "", fmt.Errorf("No cuckoo filter is kept, PeerFilter is bloom")
+	}
+
+	return c.cuckoo.filter.Serialize(), nil
+}
+
+// cuckooCandidates returns the peers whose cuckoo filters claim `key`.
+func (c *Cache) cuckooCandidates(key string) []*dht.Peer {
+	var candidates []*dht.Peer
+	for _, peer := range c.PeerList.GetPeers() {
+		if peer == nil {
+			continue
+		}
+
+		if filter := peer.GetCuckooFilter(); filter != nil && filter.Lookup([]byte(key)) {
+			candidates = append(candidates, peer)
+		}
+	}
+
+	return candidates
+}
@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"fmt"
+	"github.com/GrappigPanda/Olivia/bloomfilter"
+	"github.com/GrappigPanda/Olivia/network/message_handler"
+	"testing"
+	"time"
+)
+
+func newCuckooCache(t *testing.T, stubs ...*stubPeer) *Cache {
+	cfg := stubConfig()
+	cfg.PeerFilter = "cuckoo"
+	for _, stub := range stubs {
+		cfg.RemotePeers = append(cfg.RemotePeers, stub.Addr())
+	}
+
+	cache := NewCache(message_handler.NewMessageHandler(), cfg)
+	for i, stub := range stubs {
+		peer := cache.PeerList.Peers[i]
+		if err := peer.Connect(); err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		for attempt := 0; peer.GetCuckooFilter() == nil; attempt++ {
+			if attempt == 100 {
+				t.Fatalf("Never received a cuckoo filter from %v", stub.Addr())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	return cache
+}
+
+// ownCuckooFilter decodes the cuckoo filter we'd send our peers.
+func ownCuckooFilter(t *testing.T, cache *Cache) *bloomfilter.CuckooFilter {
+	serialized, err := cache.SerializedCuckooFilter()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	cf, err := bloomfilter.DeserializeCuckoo(serialized)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	return cf
+}
+
+func TestGetsRoutedByCuckooFilters(t *testing.T) {
+	stub := newStubPeer(t, map[string]string{"remotekey": "remotevalue"})
+	defer stub.Close()
+
+	cache := newCuckooCache(t, stub)
+
+	if value, err := cache.Get("remotekey"); err != nil || value != "remotevalue" {
+		t.Fatalf("Expected %v, got %v (%v)", "remotevalue", value, err)
+	}
+
+	if _, err := cache.Get("missingkey"); err == nil {
+		t.Fatalf("Expected missingkey not to be found")
+	}
+	if gets := stub.Gets(); gets != 1 {
+		t.Fatalf("Expected only the key the peer holds to be asked for, got %v gets", gets)
+	}
+}
+
+func TestCuckooFilterTracksOurKeys(t *testing.T) {
+	cache := newCuckooCache(t)
+
+	cache.setLocal("key1", "value")
+	cache.setLocal("key2", "value")
+	cache.Delete("key1")
+
+	cf := ownCuckooFilter(t, cache)
+	if cf.Lookup([]byte("key1")) || !cf.Lookup([]byte("key2")) {
+		t.Fatalf("Expected only key2 to be in our cuckoo filter")
+	}
+
+	if _, err := newCacheWithStubPeers(t).SerializedCuckooFilter(); err == nil {
+		t.Fatalf("Expected no cuckoo filter to be kept when routing by bloom filters")
+	}
+}
+
+func TestCuckooFilterGrowsOnceFull(t *testing.T) {
+	cache := newCuckooCache(t)
+
+	keys := 3 * baseBloomItems
+	for i := 0; i < keys; i++ {
+		cache.setLocal(fmt.Sprintf("key%d", i), "value")
+	}
+
+	for attempt := 0; ; attempt++ {
+		cf := ownCuckooFilter(t, cache)
+		if cf.Count() == uint(keys) {
+			for i := 0; i < keys; i++ {
+				if !cf.Lookup([]byte(fmt.Sprintf("key%d", i))) {
+					t.Fatalf("Expected key%d to be in our cuckoo filter", i)
+				}
+			}
+			break
+		}
+		if attempt == 100 {
+			t.Fatalf("Expected %v keys, got %v", keys, cf.Count())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
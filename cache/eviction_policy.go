@@ -0,0 +1,223 @@
+package cache
+
+import (
+	"container/list"
+	"math/rand"
+	"strings"
+	"sync"
+)
+
+// EvictionPolicy picks which keys are evicted once MaxEntries or MaxBytes is
+// reached. Reads touch keys without taking the cache lock, so policies do
+// their own locking.
+type EvictionPolicy interface {
+	// Touch records that `key` was just read or written.
+	Touch(key string)
+	// Remove forgets about `key`.
+	Remove(key string)
+	// Victim returns the next key to evict other than `keep`, or false if
+	// there's none.
+	Victim(keep string) (string, bool)
+}
+
+// newEvictionPolicy creates the policy named by the EvictionPolicy config:
+// "allkeys-lru", "allkeys-lfu", "volatile-ttl" or "allkeys-random". Anything
+// else is allkeys-lru. `soonest` returns the key closest to expiring other than
+// the one given, which volatile-ttl evicts.
+func newEvictionPolicy(name string, soonest func(keep string) (string, bool)) EvictionPolicy {
+	switch strings.ToLower(name) {
+	case "allkeys-lfu":
+		return newFrequency()
+	case "volatile-ttl":
+		return soonestExpiring(soonest)
+	case "allkeys-random":
+		return newRandomKeys()
+	}
+
+	return newRecency()
+}
+
+// frequency evicts the least frequently used key, and the least recently used
+// among keys used equally often. It's the allkeys-lfu EvictionPolicy.
+type frequency struct {
+	entries map[string]*list.Element
+	// buckets holds the keys used a given number of times, most recently
+	// used first.
+	buckets map[uint64]*list.List
+	// minUses is how often the least frequently used key was used.
+	minUses uint64
+	sync.Mutex
+}
+
+type frequencyEntry struct {
+	key  string
+	uses uint64
+}
+
+func newFrequency() *frequency {
+	return &frequency{
+		entries: make(map[string]*list.Element),
+		buckets: make(map[uint64]*list.List),
+	}
+}
+
+// Touch counts a use of `key`.
+func (f *frequency) Touch(key string) {
+	f.Lock()
+	defer f.Unlock()
+
+	uses := uint64(1)
+	if element, ok := f.entries[key]; ok {
+		uses = f.unlink(element) + 1
+		// If `key` was the last key used that rarely, the minimum
+		// moved up with it.
+		if _, ok := f.buckets[f.minUses]; !ok {
+			f.minUses = uses
+		}
+	} else {
+		f.minUses = 1
+	}
+
+	bucket, ok := f.buckets[uses]
+	if !ok {
+		bucket = list.New()
+		f.buckets[uses] = bucket
+	}
+	f.entries[key] = bucket.PushFront(&frequencyEntry{key, uses})
+}
+
+// Remove forgets about `key`.
+func (f *frequency) Remove(key string) {
+	f.Lock()
+	defer f.Unlock()
+
+	element, ok := f.entries[key]
+	if !ok {
+		return
+	}
+
+	f.unlink(element)
+	delete(f.entries, key)
+	if _, ok := f.buckets[f.minUses]; !ok {
+		f.minUses = f.lowestUsesOver(0)
+	}
+}
+
+// Victim returns the least frequently used key other than `keep`.
+func (f *frequency) Victim(keep string) (string, bool) {
+	f.Lock()
+	defer f.Unlock()
+
+	for uses := f.minUses; uses != 0; uses = f.lowestUsesOver(uses) {
+		bucket := f.buckets[uses]
+		for element := bucket.Back(); element != nil; element = element.Prev() {
+			if key := element.Value.(*frequencyEntry).key; key != keep {
+				return key, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// unlink takes `element` out of its bucket and returns how often its key was
+// used. The caller must hold the lock.
+func (f *frequency) unlink(element *list.Element) uint64 {
+	uses := element.Value.(*frequencyEntry).uses
+	bucket := f.buckets[uses]
+	bucket.Remove(element)
+
+	if bucket.Len() == 0 {
+		delete(f.buckets, uses)
+	}
+
+	return uses
+}
+
+// lowestUsesOver returns the lowest use count over `uses` any key has, or zero
+// if there's none. Buckets are few compared to keys, so they're just scanned.
+// The caller must hold the lock.
+func (f *frequency) lowestUsesOver(uses uint64) uint64 {
+	lowest := uint64(0)
+	for bucketUses := range f.buckets {
+		if bucketUses > uses && (lowest == 0 || bucketUses < lowest) {
+			lowest = bucketUses
+		}
+	}
+
+	return lowest
+}
+
+// soonestExpiring evicts the key closest to expiring, as found in the cache's
+// expiration heaps. Keys without a TTL are never evicted. It's the
+// volatile-ttl EvictionPolicy.
+type soonestExpiring func(keep string) (string, bool)
+
+// Touch does nothing, as only the keys' expirations count.
+func (s soonestExpiring) Touch(key string) {}
+
+// Remove does nothing, as deleting a key takes its expiration along.
+func (s soonestExpiring) Remove(key string) {}
+
+// Victim returns the key closest to expiring other than `keep`.
+func (s soonestExpiring) Victim(keep string) (string, bool) {
+	return s(keep)
+}
+
+// randomKeys evicts keys at random. It's the allkeys-random EvictionPolicy.
+type randomKeys struct {
+	keys    []string
+	indices map[string]int
+	sync.Mutex
+}
+
+func newRandomKeys() *randomKeys {
+	return &randomKeys{indices: make(map[string]int)}
+}
+
+// Touch adds `key` to the keys which can be evicted.
+func (r *randomKeys) Touch(key string) {
+	r.Lock()
+	defer r.Unlock()
+
+	if _, ok := r.indices[key]; ok {
+		return
+	}
+
+	r.indices[key] = len(r.keys)
+	r.keys = append(r.keys, key)
+}
+
+// Remove forgets about `key`, moving the last key into its place.
+func (r *randomKeys) Remove(key string) {
+	r.Lock()
+	defer r.Unlock()
+
+	index, ok := r.indices[key]
+	if !ok {
+		return
+	}
+
+	last := r.keys[len(r.keys)-1]
+	r.keys[index] = last
+	r.indices[last] = index
+	r.keys = r.keys[:len(r.keys)-1]
+	delete(r.indices, key)
+}
+
+// Victim returns a random key other than `keep`.
+func (r *randomKeys) Victim(keep string) (string, bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	if len(r.keys) == 0 || (len(r.keys) == 1 && r.keys[0] == keep) {
+		return "", false
+	}
+
+	index := rand.Intn(len(r.keys))
+	if r.keys[index] == keep {
+		index = (index + 1) % len(r.keys)
+	}
+
+	return r.keys[index], true
+}
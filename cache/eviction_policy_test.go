@@ -0,0 +1,114 @@
+package cache
+
+import (
+	"fmt"
+	"github.com/GrappigPanda/Olivia/config"
+	"testing"
+)
+
+func TestLFUEvictsLeastFrequentlyUsed(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{
+		IsTesting:      true,
+		MaxEntries:     3,
+		EvictionPolicy: "allkeys-lfu",
+	})
+
+	cache.Set("key1", "value1")
+	cache.Set("key2", "value2")
+	cache.Set("key3", "value3")
+	cache.Get("key1")
+	cache.Get("key1")
+	cache.Get("key3")
+
+	// key4 is used the least, but was just written.
+	cache.Set("key4", "value4")
+	if _, err := cache.Get("key2"); err == nil {
+		t.Fatalf("Expected key2 to be evicted")
+	}
+
+	cache.Set("key5", "value5")
+	if _, err := cache.Get("key4"); err == nil {
+		t.Fatalf("Expected key4 to be evicted")
+	}
+
+	for _, key := range []string{"key1", "key3", "key5"} {
+		if _, err := cache.Get(key); err != nil {
+			t.Fatalf("Expected %v to be kept, got %v", key, err)
+		}
+	}
+}
+
+func TestVolatileTTLEvictsSoonestExpiring(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{
+		IsTesting:      true,
+		MaxEntries:     2,
+		EvictionPolicy: "volatile-ttl",
+	})
+
+	cache.SetExpiration("key1", "value1", 60)
+	cache.Set("key2", "value2")
+	cache.SetExpiration("key3", "value3", 10)
+
+	if _, err := cache.Get("key1"); err == nil {
+		t.Fatalf("Expected key1 to be evicted")
+	}
+
+	cache.Set("key4", "value4")
+	if _, err := cache.Get("key3"); err == nil {
+		t.Fatalf("Expected key3 to be evicted")
+	}
+
+	// Without any key left to expire, nothing can be evicted.
+	cache.Set("key5", "value5")
+	for _, key := range []string{"key2", "key4", "key5"} {
+		if _, err := cache.Get(key); err != nil {
+			t.Fatalf("Expected %v to be kept, got %v", key, err)
+		}
+	}
+}
+
+func TestRandomEvictionKeepsWrittenKey(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{
+		IsTesting:      true,
+		MaxEntries:     5,
+		EvictionPolicy: "allkeys-random",
+	})
+
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("key%d", i)
+		cache.Set(key, "value")
+
+		if _, err := cache.Get(key); err != nil {
+			t.Fatalf("Expected %v to be kept, got %v", key, err)
+		}
+	}
+
+	if evictions := cache.Stats().LRUEvictions; evictions != 45 {
+		t.Fatalf("Expected %v evictions, got %v", 45, evictions)
+	}
+}
+
+func TestFrequencyTracksMinimumAfterRemove(t *testing.T) {
+	policy := newFrequency()
+	policy.Touch("key1")
+	policy.Touch("key2")
+	policy.Touch("key2")
+	policy.Touch("key3")
+	policy.Touch("key3")
+	policy.Touch("key3")
+
+	policy.Remove("key1")
+	if key, ok := policy.Victim(""); !ok || key != "key2" {
+		t.Fatalf("Expected %v, got %v", "key2", key)
+	}
+
+	if key, ok := policy.Victim("key2"); !ok || key != "key3" {
+		t.Fatalf("Expected %v, got %v", "key3", key)
+	}
+
+	policy.Remove("key2")
+	policy.Remove("key3")
+	if key, ok := policy.Victim(""); ok {
+		t.Fatalf("Expected no victim, got %v", key)
+	}
+}
@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// ExpireReason is why a key was removed by the eviction sweep or evicted to
+// make room.
+type ExpireReason int
+
+const (
+	// ExpiredTTL signifies that the key's TTL ran out.
+	ExpiredTTL ExpireReason = iota
+	// EvictedLRU signifies that the key was evicted by the EvictionPolicy
+	// when MaxEntries or MaxBytes was reached. The name predates policies
+	// other than least recently used.
+	EvictedLRU
+)
+
+// String returns a human readable reason.
+func (r ExpireReason) String() string {
+	switch r {
+	case ExpiredTTL:
+		return "expired"
+	case EvictedLRU:
+		return "evicted"
+	}
+
+	return "unknown"
+}
+
+// ExpireEvent is sent to every expiration stream whenever a key is removed
+// by the eviction sweep or evicted to make room.
+type ExpireEvent struct {
+	Key    string
+	Reason ExpireReason
+	At     time.Time
+}
+
+// OnExpireStream registers a channel which receives an ExpireEvent for every
+// key removed by the eviction sweep or evicted to make room. Events are never
+// waited on: if the channel is full, the event is dropped and counted in
+// Stats().DroppedExpireEvents, so a slow consumer can't stall eviction.
+func (c *Cache) OnExpireStream(ch chan<- ExpireEvent) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.expireStreams = append(c.expireStreams, ch)
+}
+
+// publishExpiration sends an expiration to every registered stream. The
+// caller must hold the cache lock.
+func (c *Cache) publishExpiration(key string, reason ExpireReason) {
+	if reason == EvictedLRU {
+		c.notifyKeyspace(key, KeyspaceEvicted)
+	} else {
+		c.notifyKeyspace(key, KeyspaceExpired)
+	}
+
+	if len(c.expireStreams) == 0 {
+		return
+	}
+
+	event := ExpireEvent{
+		Key:    key,
+		Reason: reason,
+		At:     time.Now().UTC(),
+	}
+
+	for _, stream := range c.expireStreams {
+		select {
+		case stream <- event:
+		default:
+			atomic.AddUint64(&c.counters.droppedExpireEvents, 1)
+		}
+	}
+}
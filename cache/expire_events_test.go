@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestExpireStreamReceivesEvents(t *testing.T) {
+	cache := NewCache(nil, nil)
+	events := make(chan ExpireEvent, 10)
+	cache.OnExpireStream(events)
+
+	for i := 0; i < 3; i++ {
+		cache.SetExpiration(fmt.Sprintf("key%d", i), "value", 1)
+	}
+	cache.Set("persistent", "value")
+
+	time.Sleep(1100 * time.Millisecond)
+	cache.EvictExpiredkeys(time.Now().UTC())
+
+	expired := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		select {
+		case event := <-events:
+			if event.Reason != ExpiredTTL {
+				t.Fatalf("Expected %v, got %v", ExpiredTTL, event.Reason)
+			}
+			expired[event.Key] = true
+		case <-time.After(time.Second):
+			t.Fatalf("Expected 3 events, got %v", expired)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		if !expired[fmt.Sprintf("key%d", i)] {
+			t.Fatalf("Expected an event for key%d, got %v", i, expired)
+		}
+	}
+
+	select {
+	case event := <-events:
+		t.Fatalf("Expected no more events, got %v", event)
+	default:
+	}
+}
+
+func TestExpireStreamDropsWhenFull(t *testing.T) {
+	cache := NewCache(nil, nil)
+	events := make(chan ExpireEvent, 1)
+	cache.OnExpireStream(events)
+
+	cache.SetExpiration("key1", "value", 1)
+	cache.SetExpiration("key2", "value", 1)
+
+	time.Sleep(1100 * time.Millisecond)
+	cache.EvictExpiredkeys(time.Now().UTC())
+
+	if dropped := cache.Stats().DroppedExpireEvents; dropped != 1 {
+		t.Fatalf("Expected %v, got %v", 1, dropped)
+	}
+}
@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// expirySchedule lets the eviction loop sleep until the next key expires,
+// rather than waking up on a fixed interval.
+type expirySchedule struct {
+	// next is when the eviction loop is due to wake up, in Unix
+	// nanoseconds. It's only ever touched atomically.
+	next int64
+	// wake is signalled when a key is set to expire before next.
+	wake chan struct{}
+}
+
+func newExpirySchedule() expirySchedule {
+	return expirySchedule{next: math.MaxInt64, wake: make(chan struct{}, 1)}
+}
+
+// expirationScheduled wakes the eviction loop up if a key was set to expire
+// before it's due to, so it can go back to sleep until then.
+func (c *Cache) expirationScheduled(expiresAt time.Time) {
+	if expiresAt.UnixNano() >= atomic.LoadInt64(&c.expirySchedule.next) {
+		return
+	}
+
+	select {
+	case c.expirySchedule.wake <- struct{}{}:
+	default:
+	}
+}
+
+// nextExpiration returns the soonest time a key we hold expires, and whether
+// any does.
+func (c *Cache) nextExpiration() (time.Time, bool) {
+	c.RLock()
+	defer c.RUnlock()
+
+	var soonest time.Time
+	found := false
+	for _, shard := range c.shards {
+		node, ok := shard.expirations.PeekMin()
+		if ok && (!found || node.Timeout.Before(soonest)) {
+			soonest, found = node.Timeout, true
+		}
+	}
+
+	return soonest, found
+}
+
+// untilNextSweep returns how long the eviction loop sleeps for, noting when
+// it's due to wake up. It sleeps until the next key expires, or until woken
+// when no key does. While maintenance is paused, or keys are left over from a
+// capped sweep, it waits `interval` instead so a backlog is evicted over
+// several sweeps.
+func (c *Cache) untilNextSweep(interval time.Duration) (time.Duration, bool) {
+	// A key set to expire from here on wakes the loop up, so it's never
+	// missed while the next expiration is being looked up.
+	atomic.StoreInt64(&c.expirySchedule.next, math.MinInt64)
+
+	now := time.Now().UTC()
+	expiresAt, ok := c.nextExpiration()
+	switch {
+	case c.maintenancePaused():
+		expiresAt = now.Add(interval)
+	case !ok:
+		atomic.StoreInt64(&c.expirySchedule.next, math.MaxInt64)
+		return 0, false
+	case !expiresAt.After(now) && c.evictionCap() > 0:
+		expiresAt = now.Add(interval)
+	}
+
+	atomic.StoreInt64(&c.expirySchedule.next, expiresAt.UnixNano())
+	return expiresAt.Sub(now), true
+}
+
+// evictOnSchedule evicts expired keys as they expire, waking up only when
+// the soonest one does rather than polling.
+func (c *Cache) evictOnSchedule(interval time.Duration) {
+	sweep := time.After(0)
+	for {
+		select {
+		case <-sweep:
+			c.EvictExpiredkeys(time.Now().UTC())
+		case <-c.expirySchedule.wake:
+		case <-c.stopped:
+			return
+		}
+
+		// With no key expiring, sweep stays nil and the loop waits to
+		// be woken.
+		sweep = nil
+		if wait, ok := c.untilNextSweep(interval); ok {
+			sweep = time.After(wait)
+		}
+	}
+}
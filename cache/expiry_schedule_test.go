@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"github.com/GrappigPanda/Olivia/config"
+	"testing"
+	"time"
+)
+
+func TestUntilNextSweepWaitsForTheSoonestExpiration(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{IsTesting: true})
+
+	if _, ok := cache.untilNextSweep(time.Second); ok {
+		t.Fatalf("Expected no sweep to be scheduled without expirations")
+	}
+
+	cache.SetExpiration("later", "value", 60)
+	cache.SetExpiration("sooner", "value", 30)
+	select {
+	case <-cache.expirySchedule.wake:
+	default:
+		t.Fatalf("Expected setting an expiration to wake the eviction loop")
+	}
+
+	wait, ok := cache.untilNextSweep(time.Second)
+	if !ok || wait < 29*time.Second || wait > 30*time.Second {
+		t.Fatalf("Expected to wait about 30s, got %v (%v)", wait, ok)
+	}
+
+	cache.SetExpiration("latest", "value", 90)
+	select {
+	case <-cache.expirySchedule.wake:
+		t.Fatalf("Expected a later expiration not to wake the eviction loop")
+	default:
+	}
+}
+
+func TestUntilNextSweepSpreadsOutABacklog(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{IsTesting: true, MaxEvictionsPerSweep: 1})
+	cache.SetExpiration("key1", "value1", 0)
+
+	if wait, ok := cache.untilNextSweep(time.Second); !ok || wait != time.Second {
+		t.Fatalf("Expected to wait 1s, got %v (%v)", wait, ok)
+	}
+
+	cache.PauseMaintenance()
+	cache.Delete("key1")
+	if wait, ok := cache.untilNextSweep(time.Second); !ok || wait != time.Second {
+		t.Fatalf("Expected to wait 1s while paused, got %v (%v)", wait, ok)
+	}
+}
+
+func TestKeysAreEvictedAsTheyExpire(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{IsTesting: true, EvictionIntervalMillis: 60000})
+	defer cache.Stop()
+
+	// The loop has nothing to wait on until the key is set, and polling
+	// every minute would miss its expiration by far.
+	time.Sleep(10 * time.Millisecond)
+	cache.SetExpiration("key1", "value1", 1)
+
+	time.Sleep(1500 * time.Millisecond)
+	if _, err := cache.Get("key1"); err == nil {
+		t.Fatalf("Expected key1 to be evicted as it expired")
+	}
+}
@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"github.com/GrappigPanda/Olivia/dht"
+	"log"
+	"time"
+)
+
+// fanOutTimeout returns how long a fanned out remote GET waits on all of its
+// candidates together.
+func (c *Cache) fanOutTimeout() time.Duration {
+	if c.config.RemoteGetTimeoutMillis <= 0 {
+		return remoteGetTimeout
+	}
+
+	return time.Duration(c.config.RemoteGetTimeoutMillis) * time.Millisecond
+}
+
+// getFromFirstResponder asks every one of `candidates` for `key` at once and
+// takes the first value found, rather than waiting on each in turn. The
+// lookups still outstanding are cancelled once a value is found, once the
+// fan out timeout runs out, or once `ctx` is done.
+func (c *Cache) getFromFirstResponder(ctx context.Context, key string, candidates []*dht.Peer) (string, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.fanOutTimeout())
+	defer cancel()
+
+	type result struct {
+		value  string
+		source string
+		found  bool
+		err    error
+	}
+	results := make(chan result, len(candidates))
+
+	asked := 0
+	for _, peer := range candidates {
+		if !peer.IsConnectable() {
+			continue
+		}
+		asked++
+
+		go func(peer *dht.Peer) {
+			value, found, err := c.readFromPeer(ctx, peer, key)
+			results <- result{value, peer.IPPort, found, err}
+		}(peer)
+	}
+
+	for ; asked > 0; asked-- {
+		select {
+		case res := <-results:
+			c.recordRemoteLookup(res.err == nil && !res.found)
+			if res.err != nil {
+				log.Println(res.err)
+				continue
+			}
+			if res.found {
+				return res.value, res.source, nil
+			}
+		case <-ctx.Done():
+			return "", "", fmt.Errorf("Timed out waiting on the peers for %v", key)
+		}
+	}
+
+	return "", "", fmt.Errorf("Key not found in cache")
+}
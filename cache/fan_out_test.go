@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParallelGetTakesFirstResponder(t *testing.T) {
+	slow := newStubPeer(t, map[string]string{"key": "slow"})
+	defer slow.Close()
+	slow.delayGets(time.Second)
+	fast := newStubPeer(t, map[string]string{"key": "fast"})
+	defer fast.Close()
+
+	cache := newCacheWithStubPeers(t, slow, fast)
+	cache.config.ParallelRemoteGets = true
+
+	start := time.Now()
+	value, source, err := cache.GetWithSource("key")
+	if err != nil || value != "fast" || source != fast.Addr() {
+		t.Fatalf("Expected %v from %v, got %v from %v (%v)", "fast", fast.Addr(), value, source, err)
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Fatalf("Expected not to wait on the slow peer, took %v", elapsed)
+	}
+}
+
+func TestParallelGetTimesOut(t *testing.T) {
+	slow := newStubPeer(t, map[string]string{"key": "slow"})
+	defer slow.Close()
+	slow.delayGets(time.Second)
+
+	cache := newCacheWithStubPeers(t, slow)
+	cache.config.ParallelRemoteGets = true
+	cache.config.RemoteGetTimeoutMillis = 50
+
+	start := time.Now()
+	if _, err := cache.Get("key"); err == nil {
+		t.Fatalf("Expected the get to time out")
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Fatalf("Expected to give up after the timeout, took %v", elapsed)
+	}
+}
+
+func TestGetContextGivesUpWithTheContext(t *testing.T) {
+	slow := newStubPeer(t, map[string]string{"key": "slow"})
+	defer slow.Close()
+	slow.delayGets(time.Second)
+
+	cache := newCacheWithStubPeers(t, slow)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := cache.GetContext(ctx, "key"); err == nil {
+		t.Fatalf("Expected the get to give up")
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Fatalf("Expected to give up with the context, took %v", elapsed)
+	}
+}
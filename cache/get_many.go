@@ -0,0 +1,144 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"github.com/GrappigPanda/Olivia/dht"
+	"github.com/GrappigPanda/Olivia/parser"
+	"log"
+	"strings"
+	"time"
+)
+
+// GetMany retrieves every key of `keys` it can find, leaving out the rest.
+// Keys we hold are read locally; the others are asked for with a single GET
+// per peer, rather than one per key. A key its peer turns out not to have
+// goes through the rest of its candidates like a regular Get. Keys holding
+// lists or hashes are left out too.
+func (c *Cache) GetMany(keys []string) map[string]string {
+	found := make(map[string]string, len(keys))
+
+	// Owner-first reads, and reads of placed keys, go to a different node
+	// per key anyway.
+	if c.readPreference == OwnerFirst || c.placing() {
+		for _, key := range keys {
+			if value, err := c.Get(key); err == nil {
+				found[key] = value
+			}
+		}
+
+		return found
+	}
+
+	var missing []string
+	for _, key := range keys {
+		value, ok, err := c.readString(key)
+		if err != nil {
+			continue
+		}
+		if ok {
+			found[key] = value
+			c.countRead(true, false)
+		} else {
+			missing = append(missing, key)
+		}
+	}
+
+	// Keys we didn't hold can only have been found on a peer.
+	defer func() {
+		for _, key := range missing {
+			_, ok := found[key]
+			c.countRead(ok, true)
+		}
+	}()
+
+	if len(missing) == 0 || (c.bloomfilterSearch == nil && !c.routesByCuckoo()) ||
+		c.PeerList == nil || len(c.PeerList.GetPeers()) == 0 {
+		return found
+	}
+
+	byPeer := make(map[*dht.Peer][]string)
+	rest := make(map[string][]*dht.Peer)
+	var unrouted []string
+	for _, key := range missing {
+		candidates := orderByAffinity(key, c.remoteCandidates(key))
+
+		index := firstConnectable(candidates)
+		if index < 0 {
+			unrouted = append(unrouted, key)
+			continue
+		}
+
+		byPeer[candidates[index]] = append(byPeer[candidates[index]], key)
+		rest[key] = candidates[index+1:]
+	}
+
+	for peer, peerKeys := range byPeer {
+		values, err := c.readManyFromPeer(peer, peerKeys)
+		if err != nil {
+			log.Println(err)
+		}
+
+		for _, key := range peerKeys {
+			value, ok := values[key]
+			c.recordRemoteLookup(err == nil && !ok)
+			if !ok {
+				value, _, err = c.getFromCandidates(context.Background(), key, rest[key])
+				ok = err == nil
+			}
+
+			if ok {
+				found[key] = value
+			}
+		}
+	}
+
+	// Keys no peer's filter claims may still be broadcast for.
+	for _, key := range unrouted {
+		if value, _, err := c.getFromRemotePeers(context.Background(), key); err == nil {
+			found[key] = value
+		}
+	}
+
+	return found
+}
+
+// firstConnectable returns the index of the first connectable peer, or -1 if
+// there's none.
+func firstConnectable(peers []*dht.Peer) int {
+	for i, peer := range peers {
+		if peer.IsConnectable() {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// readManyFromPeer asks `peer` for every key of `keys` with a single GET and
+// returns the ones it has.
+func (c *Cache) readManyFromPeer(peer *dht.Peer, keys []string) (map[string]string, error) {
+	responseChannel := make(chan string)
+	err := peer.SendRequest(
+		fmt.Sprintf("GET %s", strings.Join(keys, ",")),
+		responseChannel,
+		c.MessageBus,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var value string
+	select {
+	case value = <-responseChannel:
+	case <-time.After(remoteGetTimeout):
+		return nil, fmt.Errorf("Timed out waiting on %v for %d keys", peer.IPPort, len(keys))
+	}
+
+	response, err := parser.NewParser(nil).Parse(value, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return response.Args, nil
+}
@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"testing"
+)
+
+func TestGetManyBatchesRemoteKeysPerPeer(t *testing.T) {
+	first := newStubPeer(t, map[string]string{"first1": "value1", "first2": "value2"})
+	defer first.Close()
+	second := newStubPeer(t, map[string]string{"second1": "value3"})
+	defer second.Close()
+
+	cache := newCacheWithStubPeers(t, first, second)
+	cache.Set("local", "value0")
+
+	found := cache.GetMany([]string{"local", "first1", "first2", "second1", "missing"})
+
+	expected := map[string]string{
+		"local":   "value0",
+		"first1":  "value1",
+		"first2":  "value2",
+		"second1": "value3",
+	}
+	if len(found) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, found)
+	}
+	for key, value := range expected {
+		if found[key] != value {
+			t.Fatalf("Expected %v for %v, got %v", value, key, found[key])
+		}
+	}
+
+	if first.Gets() != 1 || second.Gets() != 1 {
+		t.Fatalf("Expected a single GET per peer, got %v and %v", first.Gets(), second.Gets())
+	}
+}
+
+func TestGetManyFallsBackToOtherCandidates(t *testing.T) {
+	stub := newStubPeer(t, map[string]string{"gone": "value1", "kept": "value2"})
+	defer stub.Close()
+
+	cache := newCacheWithStubPeers(t, stub)
+
+	// The stub's filter still claims the key, so it's asked for it, but
+	// there's no one else to fall back to.
+	stub.Lock()
+	delete(stub.values, "gone")
+	stub.Unlock()
+
+	found := cache.GetMany([]string{"gone", "kept"})
+	if len(found) != 1 || found["kept"] != "value2" {
+		t.Fatalf("Expected only kept, got %v", found)
+	}
+
+	if stats := cache.Stats(); stats.WastedRemoteLookups != 1 {
+		t.Fatalf("Expected the missing key to count as a wasted lookup, got %+v", stats)
+	}
+}
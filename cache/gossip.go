@@ -0,0 +1,233 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"github.com/GrappigPanda/Olivia/dht"
+	"github.com/GrappigPanda/Olivia/parser"
+	"log"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// gossipTimeout is how long a gossip exchange or an indirect probe waits on
+// its answer.
+var gossipTimeout = time.Second
+
+// indirectProbes is how many other peers are asked to probe a peer which
+// failed a direct probe, before it's suspected.
+const indirectProbes = 2
+
+// gossiping reports whether cluster membership is gossiped, which it is once
+// a GossipIntervalMillis is configured.
+func (c *Cache) gossiping() bool {
+	return c.config.GossipIntervalMillis > 0 && c.PeerList != nil
+}
+
+// Members returns every member of the cluster we know of, ourselves included.
+func (c *Cache) Members() []dht.Member {
+	return c.membership.Members()
+}
+
+// gossipRepeatedly runs a round of gossip on a timed interval.
+func (c *Cache) gossipRepeatedly(interval time.Duration) {
+	c.executeRepeatedly(interval, c.gossipRound, c.stopped, nil)
+}
+
+// gossipRound exchanges what we know of the cluster with a random peer, which
+// doubles as probing it. A peer which doesn't answer is probed indirectly
+// through other peers, and suspected if none of them reach it either.
+// Suspects which haven't refuted it in time are declared dead.
+func (c *Cache) gossipRound() {
+	defer c.membership.ExpireSuspects(
+		time.Duration(c.config.SuspicionTimeoutMillis) * time.Millisecond,
+	)
+
+	peers := c.connectablePeers()
+	if len(peers) == 0 {
+		return
+	}
+
+	rand.Shuffle(len(peers), func(i, j int) { peers[i], peers[j] = peers[j], peers[i] })
+	target, others := peers[0], peers[1:]
+
+	err := c.exchangeMembers(target)
+	if err == nil {
+		return
+	}
+	log.Printf("Gossip with %v failed: %v", target.IPPort, err)
+
+	if len(others) > indirectProbes {
+		others = others[:indirectProbes]
+	}
+	for _, peer := range others {
+		if c.probeThrough(peer, target.IPPort) {
+			return
+		}
+	}
+
+	log.Printf("Suspecting %v", target.IPPort)
+	c.membership.Suspect(target.IPPort)
+}
+
+// connectablePeers returns the important peers we're connected to.
+func (c *Cache) connectablePeers() []*dht.Peer {
+	var peers []*dht.Peer
+	for _, peer := range c.PeerList.GetPeers() {
+		if peer != nil && peer.IsConnectable() {
+			peers = append(peers, peer)
+		}
+	}
+
+	return peers
+}
+
+// exchangeMembers sends a peer everything we know of the cluster and merges
+// what it knows back in.
+func (c *Cache) exchangeMembers(peer *dht.Peer) error {
+	response, err := c.requestFromPeer(peer, encodeMembers("GOSSIP", c.membership.Members()))
+	if err != nil {
+		return err
+	}
+
+	members, err := parseMembers(response)
+	if err != nil {
+		return err
+	}
+	c.membership.Merge(members)
+
+	return nil
+}
+
+// probeThrough asks `peer` to probe `target` for us, reporting whether it
+// reached the target.
+func (c *Cache) probeThrough(peer *dht.Peer, target string) bool {
+	response, err := c.requestFromPeer(
+		peer,
+		fmt.Sprintf("PROBE %s", dht.EscapeAddress(target)),
+	)
+	if err != nil {
+		log.Printf("Indirect probe of %v through %v failed: %v", target, peer.IPPort, err)
+		return false
+	}
+
+	return strings.HasSuffix(strings.TrimSpace(response), ":OK")
+}
+
+// Probe checks whether the member at `address` answers a gossip exchange, on
+// behalf of a peer which couldn't reach it. Members we aren't connected to
+// are dialed for the probe.
+func (c *Cache) Probe(address string) bool {
+	if c.PeerList == nil {
+		return false
+	}
+
+	peer := c.findPeer(address)
+	if peer == nil || !peer.IsConnectable() {
+		peer = c.PeerList.NewPeer(address)
+		if err := peer.Connect(); err != nil {
+			return false
+		}
+		defer peer.Disconnect()
+	}
+
+	return c.exchangeMembers(peer) == nil
+}
+
+// MergeGossip merges what a peer knows of the cluster into what we know,
+// returning what we know for the peer to merge in turn.
+func (c *Cache) MergeGossip(members []dht.Member) []dht.Member {
+	c.membership.Merge(members)
+	return c.membership.Members()
+}
+
+// memberChanged keeps our peers in line with the cluster's membership: new
+// members are added as peers, while dead and departed ones are dropped, along
+// with their place on the hash ring and in the bloom filter search. Either
+// can mean connecting to a peer, so it's done in the background rather than
+// holding up the gossip which brought the change.
+func (c *Cache) memberChanged(member dht.Member) {
+	switch member.State {
+	case dht.Alive:
+		if !c.PeerList.HasPeer(member.Address) {
+			log.Printf("%v joined the cluster", member.Address)
+			go c.AddPeer(member.Address)
+		}
+	case dht.Suspect:
+		log.Printf("%v is suspected to have failed", member.Address)
+	case dht.Dead, dht.Left:
+		log.Printf("%v is %v, dropping it", member.Address, member.State)
+		go c.dropMember(member.Address)
+	}
+}
+
+// dropMember disconnects from a member which is gone and gives up its place.
+func (c *Cache) dropMember(address string) {
+	peer := c.findPeer(address)
+	if c.PeerList.HasPeer(address) {
+		c.replacePeer(address)
+	}
+	if peer != nil {
+		peer.Disconnect()
+	}
+}
+
+// leaveCluster tells our peers we're leaving, so they drop us right away
+// rather than after suspecting us.
+func (c *Cache) leaveCluster() {
+	left := c.membership.Leave()
+
+	for _, peer := range c.connectablePeers() {
+		if _, err := c.requestFromPeer(peer, encodeMembers("GOSSIP", []dht.Member{left})); err != nil {
+			log.Printf("Failed to tell %v we're leaving: %v", peer.IPPort, err)
+		}
+	}
+}
+
+// requestFromPeer sends a request to a peer and waits up to gossipTimeout on
+// its answer.
+func (c *Cache) requestFromPeer(peer *dht.Peer, request string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), gossipTimeout)
+	defer cancel()
+
+	return peer.Request(ctx, request)
+}
+
+// encodeMembers builds a `command` of `host_port:state:incarnation`
+// arguments.
+func encodeMembers(command string, members []dht.Member) string {
+	args := make([]string, len(members))
+	for i, member := range members {
+		args[i] = member.Format()
+	}
+
+	return fmt.Sprintf("%s %s", command, strings.Join(args, ","))
+}
+
+// parseMembers parses a `GOSSIPED host_port:state:incarnation,...` response.
+func parseMembers(response string) ([]dht.Member, error) {
+	command, err := parser.NewParser(nil).Parse(strings.TrimSpace(response), nil)
+	if err != nil {
+		return nil, err
+	}
+	if command.Command != "GOSSIPED" {
+		return nil, fmt.Errorf("Invalid gossip response: %v", response)
+	}
+
+	return ParseMembers(command)
+}
+
+// ParseMembers decodes the members of a parsed GOSSIP command or response.
+func ParseMembers(command *parser.CommandData) ([]dht.Member, error) {
+	members := make([]dht.Member, 0, len(command.Args))
+	for address, state := range command.Args {
+		member, err := dht.ParseMember(address, state, command.Expiration[address])
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+
+	return members, nil
+}
@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"github.com/GrappigPanda/Olivia/dht"
+	"testing"
+	"time"
+)
+
+func waitForPeer(t *testing.T, cache *Cache, address string, expected bool) {
+	for attempt := 0; attempt < 100; attempt++ {
+		if cache.PeerList.HasPeer(address) == expected {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("Expected HasPeer(%v) to be %v", address, expected)
+}
+
+func TestGossipAddsJoiningMembers(t *testing.T) {
+	joining := newStubPeer(t, map[string]string{})
+	defer joining.Close()
+	seed := newStubPeer(t, map[string]string{})
+	defer seed.Close()
+	seed.members = []string{dht.Member{Address: joining.Addr(), State: dht.Alive}.Format()}
+
+	cache := newCacheWithStubPeers(t, seed)
+	cache.gossipRound()
+
+	if member, ok := cache.membership.Member(joining.Addr()); !ok || member.State != dht.Alive {
+		t.Fatalf("Expected %v to be alive, got %v", joining.Addr(), member)
+	}
+	waitForPeer(t, cache, joining.Addr(), true)
+
+	// The seed learned of us in the exchange.
+	if !seed.Gossiped(cache.membership.Self()) {
+		t.Fatalf("Expected the seed to have been gossiped to")
+	}
+}
+
+func TestGossipDropsDeadMembers(t *testing.T) {
+	stub := newStubPeer(t, map[string]string{})
+	defer stub.Close()
+
+	cache := newCacheWithStubPeers(t, stub)
+	cache.MergeGossip([]dht.Member{{Address: stub.Addr(), State: dht.Alive}})
+	cache.MergeGossip([]dht.Member{{Address: stub.Addr(), State: dht.Dead}})
+
+	waitForPeer(t, cache, stub.Addr(), false)
+}
+
+func TestGossipSuspectsUnreachablePeers(t *testing.T) {
+	stub := newStubPeer(t, map[string]string{})
+	defer stub.Close()
+
+	cache := newCacheWithStubPeers(t, stub)
+	cache.config.SuspicionTimeoutMillis = 60000
+	// Swallow the next gossip, so the exchange times out.
+	stub.silenceGossip()
+
+	oldTimeout := gossipTimeout
+	gossipTimeout = 50 * time.Millisecond
+	defer func() { gossipTimeout = oldTimeout }()
+
+	cache.gossipRound()
+
+	if member, _ := cache.membership.Member(stub.Addr()); member.State != dht.Suspect {
+		t.Fatalf("Expected %v, got %v", dht.Suspect, member.State)
+	}
+}
+
+func TestLeavingIsGossiped(t *testing.T) {
+	stub := newStubPeer(t, map[string]string{})
+	defer stub.Close()
+
+	cache := newCacheWithStubPeers(t, stub)
+	cache.leaveCluster()
+
+	left := dht.Member{Address: cache.selfAddress, State: dht.Left}
+	if !stub.Gossiped(left) {
+		t.Fatalf("Expected %v to have been gossiped", left)
+	}
+}
@@ -0,0 +1,148 @@
+package cache
+
+import (
+	"errors"
+)
+
+// setField sets `field` of a hash to `value`, reporting whether the field is
+// new to the hash.
+func (v *typedValue) setField(field string, value string) bool {
+	old, ok := v.fields[field]
+	if ok {
+		v.bytes -= len(old)
+	} else {
+		v.bytes += len(field)
+	}
+	v.fields[field] = value
+	v.bytes += len(value)
+
+	return !ok
+}
+
+// HSet sets `fields` in the hash at `key`, creating it if it's missing and
+// keeping the fields it holds already. It returns how many of the fields are
+// new to the hash. Only the fields set are logged, so a write costs the same
+// however many fields the hash holds.
+func (c *Cache) HSet(key string, fields map[string]string) (int, error) {
+	if len(fields) == 0 {
+		return 0, errors.New("Nothing to set")
+	}
+
+	added := 0
+	err := c.mutateKey(key, func(shard *cacheShard) error {
+		hash, err := shard.typedOf(key, KindHash)
+		if err != nil {
+			return err
+		}
+
+		grown := 0
+		for field, value := range fields {
+			grown += len(value)
+			if old, ok := hash.fieldOf(field); ok {
+				grown -= len(old)
+			} else {
+				grown += len(field)
+			}
+		}
+		if err := c.validateTyped(hash, grown); err != nil {
+			return err
+		}
+
+		if err := c.logWrite(walRecord{Op: walHSet, Key: key, Fields: fields}); err != nil {
+			return err
+		}
+
+		added = c.setFields(shard, key, fields, c.clock.next())
+		c.publishShard(shard)
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return added, nil
+}
+
+// fieldOf returns the value of `field` in a hash, which may be nil.
+func (v *typedValue) fieldOf(field string) (string, bool) {
+	if v == nil {
+		return "", false
+	}
+
+	value, ok := v.fields[field]
+	return value, ok
+}
+
+// setFields sets `fields` in the hash at `key` at `version`, like HSet, and
+// returns how many of them are new. The caller must hold the lock of the
+// key's shard, have checked the key doesn't hold another type of value and
+// have logged the write.
+func (c *Cache) setFields(shard *cacheShard, key string, fields map[string]string, version uint64) int {
+	hash := shard.typed[key]
+	if hash == nil {
+		hash = newTypedValue(KindHash)
+		c.storeTyped(shard, key, hash)
+	}
+	before := hash.size()
+
+	added := 0
+	for field, value := range fields {
+		if hash.setField(field, value) {
+			added++
+		}
+	}
+	c.typedWritten(shard, key, hash.size()-before, version)
+
+	return added
+}
+
+// HGet returns the value of `field` in the hash at `key`. It returns an
+// error if the hash or the field is missing.
+func (c *Cache) HGet(key string, field string) (string, error) {
+	var value string
+	var ok bool
+	var err error
+	c.readKey(key, func(shard *cacheShard) {
+		var hash *typedValue
+		if hash, err = shard.typedOf(key, KindHash); err == nil {
+			value, ok = hash.fieldOf(field)
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if !ok {
+		return "", errors.New("Field not found in hash")
+	}
+	c.touchKey(key)
+
+	return value, nil
+}
+
+// HGetAll returns every field of the hash at `key`. A missing key is an
+// empty hash.
+func (c *Cache) HGetAll(key string) (map[string]string, error) {
+	fields := make(map[string]string)
+	var err error
+	c.readKey(key, func(shard *cacheShard) {
+		var hash *typedValue
+		if hash, err = shard.typedOf(key, KindHash); err != nil || hash == nil {
+			return
+		}
+
+		for field, value := range hash.fields {
+			fields[field] = value
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fields) > 0 {
+		c.touchKey(key)
+	}
+
+	return fields, nil
+}
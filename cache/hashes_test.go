@@ -0,0 +1,144 @@
+package cache
+
+import (
+	"github.com/GrappigPanda/Olivia/config"
+	"reflect"
+	"testing"
+)
+
+func TestHashSetAndGet(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{IsTesting: true})
+
+	if added, err := cache.HSet("user1", map[string]string{"name": "ian", "age": "29"}); err != nil || added != 2 {
+		t.Fatalf("Expected 2, got %v (%v)", added, err)
+	}
+	if added, err := cache.HSet("user1", map[string]string{"age": "30", "city": "a:b,c"}); err != nil || added != 1 {
+		t.Fatalf("Expected 1, got %v (%v)", added, err)
+	}
+
+	if value, err := cache.HGet("user1", "age"); err != nil || value != "30" {
+		t.Fatalf("Expected %v, got %v (%v)", "30", value, err)
+	}
+	if _, err := cache.HGet("user1", "missing"); err == nil {
+		t.Fatalf("Expected a missing field to be an error")
+	}
+
+	expected := map[string]string{"name": "ian", "age": "30", "city": "a:b,c"}
+	if fields, err := cache.HGetAll("user1"); err != nil || !reflect.DeepEqual(fields, expected) {
+		t.Fatalf("Expected %v, got %v (%v)", expected, fields, err)
+	}
+	if fields, err := cache.HGetAll("missing"); err != nil || len(fields) != 0 {
+		t.Fatalf("Expected an empty hash, got %v (%v)", fields, err)
+	}
+}
+
+func TestHashesAndOtherTypesDontMix(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{IsTesting: true})
+	cache.Set("string", "value")
+	cache.RPush("list", 0, "item")
+	cache.HSet("hash", map[string]string{"field": "value"})
+
+	for _, key := range []string{"string", "list"} {
+		if _, err := cache.HSet(key, map[string]string{"field": "value"}); err != ErrWrongType {
+			t.Fatalf("Expected %v, got %v", ErrWrongType, err)
+		}
+		if _, err := cache.HGetAll(key); err != ErrWrongType {
+			t.Fatalf("Expected %v, got %v", ErrWrongType, err)
+		}
+	}
+
+	if _, err := cache.RPush("hash", 0, "item"); err != ErrWrongType {
+		t.Fatalf("Expected %v, got %v", ErrWrongType, err)
+	}
+	if _, err := cache.Get("hash"); err != ErrWrongType {
+		t.Fatalf("Expected %v, got %v", ErrWrongType, err)
+	}
+}
+
+func TestEqualHashesEncodeEqually(t *testing.T) {
+	first := newTypedValue(KindHash)
+	second := newTypedValue(KindHash)
+	for _, field := range []string{"a", "b", "c"} {
+		first.setField(field, "value of "+field)
+	}
+	for _, field := range []string{"c", "a", "b"} {
+		second.setField(field, "value of "+field)
+	}
+
+	if first.encode() != second.encode() {
+		t.Fatalf("Expected %q, got %q", first.encode(), second.encode())
+	}
+}
+
+func TestHashesHoldSeparators(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{IsTesting: true})
+
+	fields := map[string]string{
+		"a:b":        "c:d",
+		"e,f":        "g,h",
+		"with space": "and\nnewline",
+		"":           "",
+		"5:x":        "\x00hash:",
+	}
+	if added, err := cache.HSet("hash", fields); err != nil || added != len(fields) {
+		t.Fatalf("Expected %v, got %v (%v)", len(fields), added, err)
+	}
+
+	if all, err := cache.HGetAll("hash"); err != nil || !reflect.DeepEqual(all, fields) {
+		t.Fatalf("Expected %v, got %v (%v)", fields, all, err)
+	}
+
+	var state ReplicationEntry
+	cache.readKey("hash", func(shard *cacheShard) {
+		state = cache.replicationState(shard, "hash")
+	})
+	decoded, err := decodeTypedValue(state.Kind, state.Value)
+	if err != nil || !reflect.DeepEqual(decoded.fields, fields) {
+		t.Fatalf("Expected %v, got %v (%v)", fields, decoded, err)
+	}
+}
+
+func TestStringsNeverTurnIntoHashes(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{IsTesting: true})
+
+	value := "\x00hash:" + encodeItems([]string{"field", "value"})
+	cache.Set("key", value)
+
+	if got, err := cache.Get("key"); err != nil || got != value {
+		t.Fatalf("Expected %q, got %q (%v)", value, got, err)
+	}
+	if _, err := cache.HGetAll("key"); err != ErrWrongType {
+		t.Fatalf("Expected %v, got %v", ErrWrongType, err)
+	}
+}
+
+func TestHashesSurviveRestarts(t *testing.T) {
+	cfg, cleanup := durableConfig(t)
+	defer cleanup()
+
+	cache := NewCache(nil, cfg)
+	cache.HSet("user1", map[string]string{"name": "ian", "age": "29"})
+	if err := cache.Snapshot(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// Fields set since the snapshot are replayed from the log.
+	cache.HSet("user1", map[string]string{"age": "30"})
+	cache.HSet("user2", map[string]string{"city": "a:b,c"})
+	cache.wal.Close()
+
+	restarted := NewCache(nil, cfg)
+
+	var hashes = []struct {
+		key      string
+		expected map[string]string
+	}{
+		{"user1", map[string]string{"name": "ian", "age": "30"}},
+		{"user2", map[string]string{"city": "a:b,c"}},
+	}
+	for _, h := range hashes {
+		if fields, err := restarted.HGetAll(h.key); err != nil || !reflect.DeepEqual(fields, h.expected) {
+			t.Fatalf("Expected %v, got %v (%v)", h.expected, fields, err)
+		}
+	}
+}
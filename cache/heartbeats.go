@@ -1,12 +1,15 @@
 package cache
 
 import (
+	"github.com/GrappigPanda/Olivia/dht"
+	"log"
 	"time"
 )
 
 // executeRepeatedly Allows repeated calls to any function which doesn't accept
 // arguments. Allows for remote stopping of the execution and passing back
-// total number of executions.
+// total number of executions. Executions are skipped while maintenance is
+// paused.
 func (c *Cache) executeRepeatedly(
 	sleepDuration time.Duration,
 	toExecute func(),
@@ -15,8 +18,10 @@ func (c *Cache) executeRepeatedly(
 ) {
 	for {
 		select {
-		default:
-			time.Sleep(sleepDuration)
+		case <-time.After(sleepDuration):
+			if c.maintenancePaused() {
+				break
+			}
 			toExecute()
 
 			if responseChannel != nil {
@@ -36,39 +41,58 @@ func (c *Cache) heartbeatRemoteNodes(interval time.Duration) {
 		interval,
 		func() {
 			if c.PeerList != nil {
-				for _, peer := range c.PeerList.Peers {
-					if peer != nil {
+				for _, peer := range c.PeerList.GetPeers() {
+					if peer == nil {
+						continue
+					}
+
+					switch {
+					case peer.GetStatus() == dht.Timeout && c.hasBackupPeers():
+						// Peers which stopped answering
+						// heartbeats give up their slot to
+						// a backup peer.
+						c.replacePeer(peer.IPPort)
+					case !peer.IsConnectable():
+						// With no backup peer to promote,
+						// they're reconnected to instead.
+						go peer.Reconnect()
+					default:
 						go peer.TestConnection()
 					}
 				}
 			}
 		},
-		nil,
+		c.stopped,
 		nil,
 	)
 }
 
-// getRemoteBloomFilters requests a remote node's peer list on a timed
-// interval.
+// getRemoteBloomFilters fetches our peers' bloom filters again on a timed
+// interval. Routing is rebuilt as each one arrives.
 func (c *Cache) getRemoteBloomFilters(interval time.Duration) {
 	c.executeRepeatedly(
 		interval,
 		func() {
 			if c.PeerList != nil {
-				for _, peer := range c.PeerList.Peers {
-					if peer != nil {
-						go peer.GetBloomFilter()
-					}
-				}
+				c.PeerList.RefreshBloomFilters()
+				c.recalculateSearches()
 			}
-
-			c.bloomfilterSearch.Recalculate(*c.PeerList)
 		},
-		nil,
+		c.stopped,
 		nil,
 	)
 }
 
+// bloomFilterInterval returns how often our peers' bloom filters are fetched
+// again, every HeartbeatLoop seconds.
+func (c *Cache) bloomFilterInterval() time.Duration {
+	if c.config.HeartbeatLoop <= 0 {
+		return 30 * time.Second
+	}
+
+	return time.Duration(c.config.HeartbeatLoop) * time.Second
+}
+
 // Heartbeat handles time-critical events, such as sending a heartbeat to a
 // remote node or expiring keys. heartbeatInterval is the rate at which we need
 // to send heartbeat updates to important remote nodes and cycleDuration is the
@@ -78,6 +102,73 @@ func (c *Cache) getRemoteBloomFilters(interval time.Duration) {
 // pre-emptively select any keys which will expire the following second.
 // Adjusting the heartbeatinterval may have strange, unintended side effects.
 func (c *Cache) Heartbeat() {
-	go c.heartbeatRemoteNodes(time.Duration(200) * time.Millisecond)
-	go c.getRemoteBloomFilters(time.Duration(30) * time.Second)
+	heartbeatInterval := dht.HeartbeatInterval(c.config)
+	bloomFilterInterval := c.bloomFilterInterval()
+
+	c.runInBackground(func() {
+		c.heartbeatRemoteNodes(heartbeatInterval)
+	})
+	c.runInBackground(func() {
+		c.getRemoteBloomFilters(bloomFilterInterval)
+	})
+
+	if c.gossiping() {
+		c.runInBackground(func() {
+			c.gossipRepeatedly(
+				time.Duration(c.config.GossipIntervalMillis) * time.Millisecond,
+			)
+		})
+	}
+
+	if c.config.SnapshotPath != "" && c.config.SnapshotIntervalSeconds > 0 {
+		c.runInBackground(func() {
+			c.snapshotRepeatedly(
+				time.Duration(c.config.SnapshotIntervalSeconds) * time.Second,
+			)
+		})
+	}
+
+	if c.wal != nil && c.wal.policy == FsyncEverySecond {
+		c.runInBackground(c.syncWALRepeatedly)
+	}
+
+	if c.config.EvictionIntervalMillis > 0 {
+		c.runInBackground(func() {
+			c.evictOnSchedule(
+				time.Duration(c.config.EvictionIntervalMillis) * time.Millisecond,
+			)
+		})
+	}
+}
+
+// runInBackground runs one of the cache's background loops on its own
+// goroutine. Stop waits on it to return.
+func (c *Cache) runInBackground(loop func()) {
+	c.loops.Add(1)
+	go func() {
+		defer c.loops.Done()
+		loop()
+	}()
+}
+
+// Stop shuts down the cache's background loops (heartbeats, bloom filter
+// syncing, gossip, snapshots, write-ahead log syncing and expired key
+// eviction) and waits for them to return, along with every namespace's. When
+// gossiping, our peers are told we're leaving first. Whatever the write-ahead
+// log hasn't synced yet is synced. Calling it again does nothing.
+func (c *Cache) Stop() {
+	c.stopOnce.Do(func() {
+		if c.gossiping() {
+			c.leaveCluster()
+		}
+		close(c.stopped)
+	})
+	c.loops.Wait()
+	c.stopNamespaces()
+
+	if c.wal != nil {
+		if err := c.wal.Sync(); err != nil {
+			log.Printf("Failed to sync the write-ahead log: %v", err)
+		}
+	}
 }
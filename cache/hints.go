@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"github.com/GrappigPanda/Olivia/dht"
+	"log"
+	"sync"
+)
+
+// hints holds the writes owed to owners which were down when the writes were
+// placed, by the owner's address, until the owner connects again. Only the
+// latest write per key is kept.
+type hints struct {
+	entries map[string][]ReplicationEntry
+	sync.Mutex
+}
+
+// storeHints keeps `entries` to hand off to `owner` once it connects again,
+// reporting whether they were kept, which they aren't when HintedHandoffLimit
+// is zero. Beyond the limit the oldest hints for the owner are dropped.
+func (c *Cache) storeHints(owner string, entries []ReplicationEntry) bool {
+	limit := c.config.HintedHandoffLimit
+	if limit <= 0 {
+		return false
+	}
+
+	c.hints.Lock()
+	defer c.hints.Unlock()
+
+	if c.hints.entries == nil {
+		c.hints.entries = make(map[string][]ReplicationEntry)
+	}
+
+	pending := c.hints.entries[owner]
+	for _, entry := range entries {
+		for i, hinted := range pending {
+			if hinted.Key == entry.Key {
+				pending = append(pending[:i], pending[i+1:]...)
+				break
+			}
+		}
+		pending = append(pending, entry)
+	}
+
+	if overflow := len(pending) - limit; overflow > 0 {
+		log.Printf("Too many hints for %v, dropping %d writes", owner, overflow)
+		pending = pending[overflow:]
+	}
+	c.hints.entries[owner] = pending
+
+	return true
+}
+
+// takeHints removes and returns the hints held for `owner`.
+func (c *Cache) takeHints(owner string) []ReplicationEntry {
+	c.hints.Lock()
+	defer c.hints.Unlock()
+
+	pending := c.hints.entries[owner]
+	delete(c.hints.entries, owner)
+
+	return pending
+}
+
+// hintCount returns how many hinted writes are waiting across every owner.
+func (c *Cache) hintCount() uint64 {
+	c.hints.Lock()
+	defer c.hints.Unlock()
+
+	count := 0
+	for _, pending := range c.hints.entries {
+		count += len(pending)
+	}
+
+	return uint64(count)
+}
+
+// peerStatusChanged hands off a peer's hints once it connects, along with
+// any keys an earlier rebalance couldn't move, and fails over to a backup
+// peer as soon as a connected peer drops.
+func (c *Cache) peerStatusChanged(peer *dht.Peer, from dht.State, to dht.State) {
+	switch to {
+	case dht.Connected:
+		go c.handOffHints(peer)
+		c.retryRebalance()
+	case dht.Timeout, dht.Disconnected:
+		if from == dht.Connected {
+			go c.failOver(peer)
+		}
+	}
+}
+
+// handOffHints replays the hints held for `peer`. The hints the peer didn't
+// answer for, as it couldn't be reached after all, are kept for its next
+// connection, but writes it refuses are dropped, as they'd be refused again.
+func (c *Cache) handOffHints(peer *dht.Peer) {
+	pending := c.takeHints(peer.IPPort)
+	if len(pending) == 0 {
+		return
+	}
+
+	acks, err := c.ReplicateBatch(peer, pending)
+
+	refused := 0
+	var unanswered []ReplicationEntry
+	for _, entry := range pending {
+		if applied, answered := acks[entry.Key]; !answered {
+			unanswered = append(unanswered, entry)
+		} else if !applied {
+			refused++
+		}
+	}
+
+	if err != nil {
+		log.Printf("Failed to hand off %d hints to %v: %v", len(unanswered), peer.IPPort, err)
+		c.storeHints(peer.IPPort, unanswered)
+	}
+	if refused > 0 {
+		log.Printf("%v refused %d of %d hints", peer.IPPort, refused, len(pending))
+	}
+}
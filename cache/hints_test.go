@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"testing"
+)
+
+func TestHintedHandoffToReconnectingOwner(t *testing.T) {
+	owner := newStubPeer(t, map[string]string{})
+	defer owner.Close()
+
+	cache := newPlacingCache(t, 1, owner)
+	cache.config.HintedHandoffLimit = 10
+	key := keyOwnedBy(t, cache, owner.Addr())
+
+	peer := cache.findPeer(owner.Addr())
+	peer.Disconnect()
+
+	if err := cache.Set(key, "hinted"); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if hints := cache.Stats().Hints; hints != 1 {
+		t.Fatalf("Expected %v, got %v", 1, hints)
+	}
+
+	// Until the owner is back, we hold on to the key ourselves.
+	if value, ok := cache.readValue(key); !ok || value != "hinted" {
+		t.Fatalf("Expected %v, got %v", "hinted", value)
+	}
+
+	if err := peer.Connect(); err != nil {
+		t.Fatalf("%v", err)
+	}
+	waitForValue(t, owner, key, "hinted")
+
+	if hints := cache.Stats().Hints; hints != 0 {
+		t.Fatalf("Expected %v, got %v", 0, hints)
+	}
+}
+
+func TestHintsKeepTheLatestWritePerKey(t *testing.T) {
+	cache := newPlacingCache(t, 1)
+	cache.config.HintedHandoffLimit = 2
+
+	cache.storeHints("owner", []ReplicationEntry{{Key: "a", Value: "1"}, {Key: "b", Value: "1"}})
+	cache.storeHints("owner", []ReplicationEntry{{Key: "a", Value: "2"}, {Key: "c", Value: "1"}})
+
+	// b is the oldest once a is rewritten, so it's dropped to stay within
+	// the limit.
+	hinted := cache.takeHints("owner")
+	if len(hinted) != 2 || hinted[0].Key != "a" || hinted[0].Value != "2" || hinted[1].Key != "c" {
+		t.Fatalf("Expected a:2 and c:1, got %v", hinted)
+	}
+}
+
+func TestHintedHandoffOff(t *testing.T) {
+	cache := newPlacingCache(t, 1)
+
+	if cache.storeHints("owner", []ReplicationEntry{{Key: "a", Value: "1"}}) {
+		t.Fatalf("Expected no hints to be kept")
+	}
+}
@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"errors"
+	"math"
+	"strconv"
+)
+
+// ErrNotAnInteger is returned when incrementing or decrementing a key whose
+// value isn't an integer.
+var ErrNotAnInteger = errors.New("Value is not an integer")
+
+// ErrIntegerOverflow is returned when incrementing or decrementing a key would
+// take it past the range of an int64.
+var ErrIntegerOverflow = errors.New("Increment would overflow")
+
+// Increment adds `delta` to the integer stored at `key` under the lock of the
+// key's shard, so concurrent increments never lose an update, and returns the
+// new value. A missing key counts as zero.
+func (c *Cache) Increment(key string, delta int64) (int64, error) {
+	next := int64(0)
+	err := c.mutateKey(key, func(shard *cacheShard) error {
+		current := int64(0)
+		old, ok, err := shard.stringOf(key)
+		if err != nil {
+			return err
+		}
+		if ok {
+			parsed, err := strconv.ParseInt(old, 10, 64)
+			if err != nil {
+				return ErrNotAnInteger
+			}
+			current = parsed
+		}
+
+		if (delta > 0 && current > math.MaxInt64-delta) ||
+			(delta < 0 && current < math.MinInt64-delta) {
+			return ErrIntegerOverflow
+		}
+
+		next = current + delta
+		written, err := c.set(shard, key, strconv.FormatInt(next, 10))
+		if written {
+			c.publishShard(shard)
+		}
+
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return next, nil
+}
+
+// Decrement subtracts `delta` from the integer stored at `key`, like
+// Increment.
+func (c *Cache) Decrement(key string, delta int64) (int64, error) {
+	if delta == math.MinInt64 {
+		return 0, ErrIntegerOverflow
+	}
+
+	return c.Increment(key, -delta)
+}
+
+// AdjustUnsigned adds `delta` to the unsigned integer stored at `key`, or
+// subtracts it if `decrement` is set, the way memcached's incr and decr do:
+// incrementing wraps around past the range of a uint64, decrementing stops at
+// zero, and a missing key isn't created. It returns the new value and whether
+// the key was found.
+func (c *Cache) AdjustUnsigned(key string, delta uint64, decrement bool) (uint64, bool, error) {
+	next := uint64(0)
+	found := false
+	err := c.mutateKey(key, func(shard *cacheShard) error {
+		old, ok, err := shard.stringOf(key)
+		if err != nil || !ok {
+			return err
+		}
+		found = true
+
+		current, err := strconv.ParseUint(old, 10, 64)
+		if err != nil {
+			return ErrNotAnInteger
+		}
+
+		switch {
+		case !decrement:
+			next = current + delta
+		case delta < current:
+			next = current - delta
+		}
+
+		written, err := c.set(shard, key, strconv.FormatUint(next, 10))
+		if written {
+			c.publishShard(shard)
+		}
+
+		return err
+	})
+	if err != nil {
+		return 0, found, err
+	}
+
+	return next, found, nil
+}
@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestIncrementAndDecrement(t *testing.T) {
+	cache := NewCache(nil, stubConfig())
+
+	if value, err := cache.Increment("counter", 5); err != nil || value != 5 {
+		t.Fatalf("Expected 5, got %v (%v)", value, err)
+	}
+	if value, err := cache.Decrement("counter", 7); err != nil || value != -2 {
+		t.Fatalf("Expected -2, got %v (%v)", value, err)
+	}
+
+	if value, err := cache.Get("counter"); err != nil || value != "-2" {
+		t.Fatalf("Expected -2, got %v (%v)", value, err)
+	}
+}
+
+func TestIncrementNonInteger(t *testing.T) {
+	cache := NewCache(nil, stubConfig())
+	cache.Set("key1", "value1")
+
+	if _, err := cache.Increment("key1", 1); err != ErrNotAnInteger {
+		t.Fatalf("Expected %v, got %v", ErrNotAnInteger, err)
+	}
+	if value, _ := cache.Get("key1"); value != "value1" {
+		t.Fatalf("Expected value1 to be left alone, got %v", value)
+	}
+}
+
+func TestIncrementOverflow(t *testing.T) {
+	cache := NewCache(nil, stubConfig())
+	cache.Set("max", strconv.FormatInt(math.MaxInt64, 10))
+	cache.Set("min", strconv.FormatInt(math.MinInt64, 10))
+
+	if _, err := cache.Increment("max", 1); err != ErrIntegerOverflow {
+		t.Fatalf("Expected %v, got %v", ErrIntegerOverflow, err)
+	}
+	if _, err := cache.Decrement("min", 1); err != ErrIntegerOverflow {
+		t.Fatalf("Expected %v, got %v", ErrIntegerOverflow, err)
+	}
+	if _, err := cache.Decrement("zero", math.MinInt64); err != ErrIntegerOverflow {
+		t.Fatalf("Expected %v, got %v", ErrIntegerOverflow, err)
+	}
+}
+
+func TestConcurrentIncrements(t *testing.T) {
+	cache := NewCache(nil, stubConfig())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cache.Increment("counter", 2)
+		}()
+	}
+	wg.Wait()
+
+	if value, err := cache.Get("counter"); err != nil || value != "100" {
+		t.Fatalf("Expected 100, got %v (%v)", value, err)
+	}
+}
+
+func TestAdjustUnsigned(t *testing.T) {
+	cache := NewCache(nil, stubConfig())
+
+	if _, found, err := cache.AdjustUnsigned("missing", 1, false); found || err != nil {
+		t.Fatalf("Expected a missing key not to be found, got %v (%v)", found, err)
+	}
+	if _, err := cache.Get("missing"); err == nil {
+		t.Fatalf("Expected a missing key not to be created")
+	}
+
+	cache.Set("counter", "18446744073709551615")
+	if next, _, _ := cache.AdjustUnsigned("counter", 2, false); next != 1 {
+		t.Fatalf("Expected incrementing to wrap around to %v, got %v", 1, next)
+	}
+
+	if next, _, _ := cache.AdjustUnsigned("counter", 5, true); next != 0 {
+		t.Fatalf("Expected decrementing to stop at %v, got %v", 0, next)
+	}
+
+	cache.Set("text", "value")
+	if _, found, err := cache.AdjustUnsigned("text", 1, false); !found || err != ErrNotAnInteger {
+		t.Fatalf("Expected %v, got %v", ErrNotAnInteger, err)
+	}
+}
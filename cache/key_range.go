@@ -0,0 +1,98 @@
+package cache
+
+import (
+	"github.com/GrappigPanda/Olivia/dht"
+	"sort"
+)
+
+// defaultMaxRangeKeys is how many keys a single RANGE answers with when
+// MaxRangeKeys isn't configured.
+const defaultMaxRangeKeys = 1000
+
+// KeysInRange returns our keys whose hash (see dht.KeyHash) falls in
+// [start, end), ordered by hash. A range whose start is past its end wraps
+// around the ring, and a range whose start equals its end covers every key.
+func (c *Cache) KeysInRange(start, end uint64) []string {
+	c.Lock()
+	defer c.Unlock()
+
+	keys := byRangeOffset{start: start}
+	c.forEachEntry(func(key string, _ string) {
+		hash := dht.KeyHash(key)
+		if inRange(hash, start, end) {
+			keys.keys = append(keys.keys, hashedKey{key, hash})
+		}
+	})
+	sort.Sort(keys)
+
+	sorted := make([]string, len(keys.keys))
+	for i, key := range keys.keys {
+		sorted[i] = key.key
+	}
+
+	return sorted
+}
+
+// MaxRangeKeys is how many keys are sent in reply to a single RANGE.
+func (c *Cache) MaxRangeKeys() int {
+	if c.config.MaxRangeKeys > 0 {
+		return c.config.MaxRangeKeys
+	}
+
+	return defaultMaxRangeKeys
+}
+
+// PageKeys cuts hash-ordered keys down to at most `limit`. Keys sharing a hash
+// are never split across pages, as the next page starts after the last hash
+// sent; only if a single hash has more than `limit` keys is it cut.
+func PageKeys(keys []string, limit int) []string {
+	if len(keys) <= limit {
+		return keys
+	}
+
+	page := keys[:limit]
+	lastHash := dht.KeyHash(keys[limit])
+	for len(page) > 0 && dht.KeyHash(page[len(page)-1]) == lastHash {
+		page = page[:len(page)-1]
+	}
+
+	if len(page) == 0 {
+		return keys[:limit]
+	}
+
+	return page
+}
+
+func inRange(hash, start, end uint64) bool {
+	switch {
+	case start < end:
+		return hash >= start && hash < end
+	case start > end:
+		return hash >= start || hash < end
+	default:
+		return true
+	}
+}
+
+type hashedKey struct {
+	key  string
+	hash uint64
+}
+
+// byRangeOffset orders keys by how far past the start of a range their hash
+// is, so wrapped ranges run from the start of the range onwards.
+type byRangeOffset struct {
+	keys  []hashedKey
+	start uint64
+}
+
+func (b byRangeOffset) Len() int      { return len(b.keys) }
+func (b byRangeOffset) Swap(i, j int) { b.keys[i], b.keys[j] = b.keys[j], b.keys[i] }
+func (b byRangeOffset) Less(i, j int) bool {
+	offsetI, offsetJ := b.keys[i].hash-b.start, b.keys[j].hash-b.start
+	if offsetI != offsetJ {
+		return offsetI < offsetJ
+	}
+
+	return b.keys[i].key < b.keys[j].key
+}
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"fmt"
+	"github.com/GrappigPanda/Olivia/dht"
+	"testing"
+)
+
+func TestKeysInRange(t *testing.T) {
+	cache := NewCache(nil, nil)
+	for i := 0; i < 200; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), "value")
+	}
+
+	const quarter = uint64(1) << 30
+
+	for _, bounds := range [][2]uint64{
+		{quarter, 3 * quarter},
+		// Wraps around the end of the ring.
+		{3 * quarter, quarter},
+	} {
+		start, end := bounds[0], bounds[1]
+		keys := cache.KeysInRange(start, end)
+
+		expected := 0
+		for i := 0; i < 200; i++ {
+			if inRange(dht.KeyHash(fmt.Sprintf("key%d", i)), start, end) {
+				expected++
+			}
+		}
+		if len(keys) != expected || expected == 0 {
+			t.Fatalf("Expected %v keys in [%v, %v), got %v", expected, start, end, len(keys))
+		}
+
+		for i, key := range keys {
+			hash := dht.KeyHash(key)
+			if !inRange(hash, start, end) {
+				t.Fatalf("Expected %v (%v) to be in [%v, %v)", key, hash, start, end)
+			}
+			if i > 0 && hash-start < dht.KeyHash(keys[i-1])-start {
+				t.Fatalf("Expected keys ordered by hash, got %v after %v", key, keys[i-1])
+			}
+		}
+	}
+}
+
+func TestPageKeys(t *testing.T) {
+	cache := NewCache(nil, nil)
+	for i := 0; i < 50; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), "value")
+	}
+
+	var seen []string
+	start := uint64(0)
+	for {
+		page := PageKeys(cache.KeysInRange(start, 1<<32), 10)
+		if len(page) > 10 {
+			t.Fatalf("Expected at most %v keys, got %v", 10, len(page))
+		}
+
+		seen = append(seen, page...)
+		if len(page) < 10 {
+			break
+		}
+		start = dht.KeyHash(page[len(page)-1]) + 1
+	}
+
+	if len(seen) != 50 {
+		t.Fatalf("Expected %v keys across every page, got %v", 50, len(seen))
+	}
+}
@@ -0,0 +1,49 @@
+package cache
+
+// KeyState tells a key which holds a value apart from one which was deleted
+// and one which was never set.
+type KeyState int
+
+const (
+	// Absent means the key was never set, or isn't known to us anymore.
+	Absent KeyState = iota
+	// Present means the key holds a value.
+	Present
+	// Deleted means the key was explicitly deleted, leaving a tombstone.
+	Deleted
+)
+
+// GetState retrieves a value like Get, but also reports the state of the key.
+// A key with a local tombstone is reported as Deleted without asking any
+// peers; otherwise a miss is Absent, along with the error Get would return.
+func (c *Cache) GetState(key string) (string, KeyState, error) {
+	if value, ok, err := c.readString(key); err != nil {
+		return "", Present, err
+	} else if ok {
+		c.countRead(true, false)
+		return value, Present, nil
+	}
+
+	if c.isTombstoned(key) {
+		c.countRead(false, false)
+		return "", Deleted, nil
+	}
+
+	value, err := c.Get(key)
+	if err != nil {
+		return "", Absent, err
+	}
+
+	return value, Present, nil
+}
+
+// isTombstoned checks whether a key was explicitly deleted and hasn't been
+// set since.
+func (c *Cache) isTombstoned(key string) bool {
+	tombstoned := false
+	c.readKey(key, func(shard *cacheShard) {
+		_, tombstoned = shard.tombstones[key]
+	})
+
+	return tombstoned
+}
@@ -0,0 +1,51 @@
+package cache
+
+import (
+	"testing"
+)
+
+func TestGetState(t *testing.T) {
+	cache := NewCache(nil, stubConfig())
+	cache.Set("present", "value")
+	cache.Set("deleted", "value")
+	cache.Delete("deleted")
+
+	expected := map[string]KeyState{
+		"present": Present,
+		"deleted": Deleted,
+		"absent":  Absent,
+	}
+
+	for key, expectedState := range expected {
+		_, state, _ := cache.GetState(key)
+		if state != expectedState {
+			t.Fatalf("Expected %v for %v, got %v", expectedState, key, state)
+		}
+	}
+
+	if value, _, err := cache.GetState("present"); err != nil || value != "value" {
+		t.Fatalf("Expected %v, got %v (%v)", "value", value, err)
+	}
+	if _, _, err := cache.GetState("absent"); err == nil {
+		t.Fatalf("Expected an error for an absent key")
+	}
+	if _, err := cache.Get("deleted"); err == nil {
+		t.Fatalf("Expected Get to treat a tombstone as a miss")
+	}
+}
+
+func TestSetClearsTombstone(t *testing.T) {
+	cache := NewCache(nil, stubConfig())
+	cache.Set("key1", "value1")
+	cache.Delete("key1")
+	cache.Set("key1", "value2")
+
+	if value, state, _ := cache.GetState("key1"); state != Present || value != "value2" {
+		t.Fatalf("Expected %v to be present again, got %v (%v)", "value2", value, state)
+	}
+
+	cache.Update("missing", func(string, bool) (string, bool) { return "", false })
+	if _, state, _ := cache.GetState("missing"); state != Absent {
+		t.Fatalf("Expected deleting a missing key to leave no tombstone, got %v", state)
+	}
+}
@@ -0,0 +1,187 @@
+package cache
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// KeyspaceOp is what happened to a key a subscription is notified of.
+type KeyspaceOp int
+
+const (
+	// KeyspaceSet signifies that the key was written.
+	KeyspaceSet KeyspaceOp = iota
+	// KeyspaceDel signifies that the key was deleted.
+	KeyspaceDel
+	// KeyspaceExpired signifies that the key's TTL ran out.
+	KeyspaceExpired
+	// KeyspaceEvicted signifies that the key was evicted to make room.
+	KeyspaceEvicted
+)
+
+// String returns a human readable op.
+func (o KeyspaceOp) String() string {
+	switch o {
+	case KeyspaceSet:
+		return "set"
+	case KeyspaceDel:
+		return "del"
+	case KeyspaceExpired:
+		return "expired"
+	case KeyspaceEvicted:
+		return "evicted"
+	}
+
+	return "unknown"
+}
+
+// KeyspaceEvent is sent to every subscription with a pattern matching Key.
+type KeyspaceEvent struct {
+	Key string
+	Op  KeyspaceOp
+	At  time.Time
+}
+
+// subscriptionBuffer is how many events a subscription holds before it
+// starts missing them.
+const subscriptionBuffer = 256
+
+// Subscription receives a KeyspaceEvent for every key matching one of its
+// glob patterns which is set, deleted, expires or is evicted. Like change
+// streams, events are never waited on: a subscriber which falls more than
+// subscriptionBuffer events behind misses the events in between, which
+// Stats().DroppedKeyspaceEvents counts.
+type Subscription struct {
+	events   chan KeyspaceEvent
+	patterns map[string]bool
+	lock     sync.RWMutex
+}
+
+// Subscribe opens a subscription to the keys matching any of `patterns`,
+// which are globs like SCAN's. Call Unsubscribe once done with it.
+func (c *Cache) Subscribe(patterns ...string) (*Subscription, error) {
+	subscription := &Subscription{
+		events:   make(chan KeyspaceEvent, subscriptionBuffer),
+		patterns: make(map[string]bool),
+	}
+	if err := subscription.AddPatterns(patterns...); err != nil {
+		return nil, err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.subscriptions = append(c.subscriptions, subscription)
+	return subscription, nil
+}
+
+// Unsubscribe closes a subscription Subscribe opened. Once it returns, the
+// subscription receives no more events.
+func (c *Cache) Unsubscribe(subscription *Subscription) {
+	c.Lock()
+	defer c.Unlock()
+
+	for i, subscribed := range c.subscriptions {
+		if subscribed == subscription {
+			c.subscriptions = append(c.subscriptions[:i:i], c.subscriptions[i+1:]...)
+			return
+		}
+	}
+}
+
+// Events returns the channel the subscription's events are sent to.
+func (s *Subscription) Events() <-chan KeyspaceEvent {
+	return s.events
+}
+
+// AddPatterns subscribes to the keys matching `patterns` as well. Either
+// every pattern is added or, if one of them is invalid, none are.
+func (s *Subscription) AddPatterns(patterns ...string) error {
+	for _, pattern := range patterns {
+		if _, err := MatchGlob(pattern, ""); err != nil {
+			return err
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, pattern := range patterns {
+		s.patterns[pattern] = true
+	}
+
+	return nil
+}
+
+// RemovePatterns stops subscribing to `patterns`, returning those which were
+// subscribed to.
+func (s *Subscription) RemovePatterns(patterns ...string) []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var removed []string
+	for _, pattern := range patterns {
+		if s.patterns[pattern] {
+			delete(s.patterns, pattern)
+			removed = append(removed, pattern)
+		}
+	}
+
+	return removed
+}
+
+// Patterns returns the patterns subscribed to, sorted.
+func (s *Subscription) Patterns() []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	patterns := make([]string, 0, len(s.patterns))
+	for pattern := range s.patterns {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	return patterns
+}
+
+// matches checks whether `key` matches any of the subscription's patterns.
+func (s *Subscription) matches(key string) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	for pattern := range s.patterns {
+		if ok, _ := MatchGlob(pattern, key); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// notifyKeyspace sends an event to every subscription matching `key`. The
+// caller must hold the cache lock, shared or not.
+func (c *Cache) notifyKeyspace(key string, op KeyspaceOp) {
+	if len(c.subscriptions) == 0 {
+		return
+	}
+
+	event := KeyspaceEvent{
+		Key: key,
+		Op:  op,
+		At:  time.Now().UTC(),
+	}
+
+	for _, subscription := range c.subscriptions {
+		if !subscription.matches(key) {
+			continue
+		}
+
+		select {
+		case subscription.events <- event:
+		default:
+			atomic.AddUint64(&c.counters.droppedKeyspaceEvents, 1)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"github.com/GrappigPanda/Olivia/config"
+	"testing"
+	"time"
+)
+
+func TestSubscriptionReceivesMatchingEvents(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{IsTesting: true, MaxEntries: 2})
+	subscription, err := cache.Subscribe("user*")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	cache.Set("user1", "value1")
+	cache.Set("session1", "value1")
+	cache.Delete("user1")
+	cache.SetExpiration("user2", "value2", 0)
+	cache.EvictExpiredkeys(time.Now().UTC().Add(time.Second))
+	cache.Set("user3", "value3")
+	cache.Set("user4", "value4")
+	cache.Set("user5", "value5")
+
+	var expected = []KeyspaceEvent{
+		{Key: "user1", Op: KeyspaceSet},
+		{Key: "user1", Op: KeyspaceDel},
+		{Key: "user2", Op: KeyspaceSet},
+		{Key: "user2", Op: KeyspaceExpired},
+		{Key: "user3", Op: KeyspaceSet},
+		{Key: "user4", Op: KeyspaceSet},
+		{Key: "user5", Op: KeyspaceSet},
+		{Key: "user3", Op: KeyspaceEvicted},
+	}
+
+	for _, want := range expected {
+		select {
+		case event := <-subscription.Events():
+			if event.Key != want.Key || event.Op != want.Op {
+				t.Fatalf("Expected %v, got %v", want, event)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected %v, got nothing", want)
+		}
+	}
+
+	cache.Unsubscribe(subscription)
+	cache.Set("user6", "value6")
+	select {
+	case event := <-subscription.Events():
+		t.Fatalf("Expected no event after unsubscribing, got %v", event)
+	default:
+	}
+}
+
+func TestSubscriptionPatterns(t *testing.T) {
+	cache := NewCache(nil, nil)
+	if _, err := cache.Subscribe("[user"); err == nil {
+		t.Fatalf("Expected an invalid pattern to be refused")
+	}
+
+	subscription, _ := cache.Subscribe("user*")
+	defer cache.Unsubscribe(subscription)
+	if err := subscription.AddPatterns("session*", "[bad"); err == nil {
+		t.Fatalf("Expected an invalid pattern to be refused")
+	}
+	subscription.AddPatterns("session*")
+
+	removed := subscription.RemovePatterns("user*", "other*")
+	if len(removed) != 1 || removed[0] != "user*" {
+		t.Fatalf("Expected [user*], got %v", removed)
+	}
+
+	cache.Set("user1", "value1")
+	cache.Set("session1", "value1")
+	if event := <-subscription.Events(); event.Key != "session1" {
+		t.Fatalf("Expected session1, got %v", event.Key)
+	}
+	if patterns := subscription.Patterns(); len(patterns) != 1 || patterns[0] != "session*" {
+		t.Fatalf("Expected [session*], got %v", patterns)
+	}
+}
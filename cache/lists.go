@@ -0,0 +1,275 @@
+package cache
+
+import (
+	"errors"
+)
+
+// minListCapacity is the smallest ring a list's items are kept in.
+const minListCapacity = 4
+
+// itemList holds a list's items in a ring, so items are pushed onto and
+// popped off of either end in constant time, however long the list is.
+type itemList struct {
+	ring []string
+	head int
+	size int
+}
+
+// len returns how many items the list holds.
+func (l *itemList) len() int {
+	return l.size
+}
+
+// at returns the item at index `i`, counting from the head.
+func (l *itemList) at(i int) string {
+	return l.ring[(l.head+i)%len(l.ring)]
+}
+
+// resize moves the items into a ring of `capacity`.
+func (l *itemList) resize(capacity int) {
+	ring := make([]string, capacity)
+	for i := 0; i < l.size; i++ {
+		ring[i] = l.at(i)
+	}
+
+	l.ring = ring
+	l.head = 0
+}
+
+// grow makes room for one more item.
+func (l *itemList) grow() {
+	if l.size < len(l.ring) {
+		return
+	}
+
+	capacity := 2 * len(l.ring)
+	if capacity < minListCapacity {
+		capacity = minListCapacity
+	}
+	l.resize(capacity)
+}
+
+// shrink gives back the room of a list which has been mostly popped.
+func (l *itemList) shrink() {
+	if len(l.ring) > minListCapacity && l.size <= len(l.ring)/4 {
+		l.resize(len(l.ring) / 2)
+	}
+}
+
+func (l *itemList) pushFront(item string) {
+	l.grow()
+	l.head = (l.head + len(l.ring) - 1) % len(l.ring)
+	l.ring[l.head] = item
+	l.size++
+}
+
+func (l *itemList) pushBack(item string) {
+	l.grow()
+	l.ring[(l.head+l.size)%len(l.ring)] = item
+	l.size++
+}
+
+func (l *itemList) popFront() string {
+	item := l.ring[l.head]
+	l.ring[l.head] = ""
+	l.head = (l.head + 1) % len(l.ring)
+	l.size--
+	l.shrink()
+
+	return item
+}
+
+func (l *itemList) popBack() string {
+	tail := (l.head + l.size - 1) % len(l.ring)
+	item := l.ring[tail]
+	l.ring[tail] = ""
+	l.size--
+	l.shrink()
+
+	return item
+}
+
+// LPush pushes `values` onto the head of the list at `key`, creating it if
+// it's missing, in order, so the last of them ends up first. A positive
+// `maxLen` then trims the list down to that many items from its tail, which
+// bounds queues whose consumers fall behind. It returns the list's length.
+func (c *Cache) LPush(key string, maxLen int, values ...string) (int, error) {
+	return c.push(key, true, maxLen, values)
+}
+
+// RPush pushes `values` onto the tail of the list at `key`, like LPush, a
+// positive `maxLen` trimming it from its head instead.
+func (c *Cache) RPush(key string, maxLen int, values ...string) (int, error) {
+	return c.push(key, false, maxLen, values)
+}
+
+// push pushes onto either end of a list. Only the pushed items are logged,
+// so a push costs the same however long the list is. The list has to fit
+// MaxValueBytes before it's trimmed.
+func (c *Cache) push(key string, head bool, maxLen int, values []string) (int, error) {
+	if len(values) == 0 {
+		return 0, errors.New("Nothing to push")
+	}
+
+	grown := 0
+	for _, value := range values {
+		grown += len(value)
+	}
+
+	op := walRPush
+	if head {
+		op = walLPush
+	}
+
+	length := 0
+	err := c.mutateKey(key, func(shard *cacheShard) error {
+		list, err := shard.typedOf(key, KindList)
+		if err != nil {
+			return err
+		}
+		if err := c.validateTyped(list, grown); err != nil {
+			return err
+		}
+
+		record := walRecord{Op: op, Key: key, Items: values, MaxLen: maxLen}
+		if err := c.logWrite(record); err != nil {
+			return err
+		}
+
+		length = c.pushItems(shard, key, head, maxLen, values, c.clock.next())
+		c.publishShard(shard)
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return length, nil
+}
+
+// pushItems pushes `values` onto the list at `key` at `version`, like push,
+// and returns the list's length. The caller must hold the lock of the key's
+// shard, have checked the key doesn't hold another type of value and have
+// logged the push.
+func (c *Cache) pushItems(shard *cacheShard, key string, head bool, maxLen int, values []string, version uint64) int {
+	list := shard.typed[key]
+	if list == nil {
+		list = newTypedValue(KindList)
+		c.storeTyped(shard, key, list)
+	}
+	before := list.size()
+
+	for _, value := range values {
+		if head {
+			list.items.pushFront(value)
+		} else {
+			list.items.pushBack(value)
+		}
+		list.bytes += len(value)
+	}
+
+	for maxLen > 0 && list.items.len() > maxLen {
+		var trimmed string
+		if head {
+			trimmed = list.items.popBack()
+		} else {
+			trimmed = list.items.popFront()
+		}
+		list.bytes -= len(trimmed)
+	}
+
+	c.typedWritten(shard, key, list.size()-before, version)
+
+	return list.items.len()
+}
+
+// LPop removes and returns the first item of the list at `key`, deleting
+// the list once it's empty. It returns an error if there's no list to pop.
+func (c *Cache) LPop(key string) (string, error) {
+	var popped string
+	err := c.mutateKey(key, func(shard *cacheShard) error {
+		list, err := shard.typedOf(key, KindList)
+		if err != nil {
+			return err
+		}
+		if list == nil {
+			return errors.New("Key not found in cache")
+		}
+
+		if err := c.logWrite(walRecord{Op: walLPop, Key: key}); err != nil {
+			return err
+		}
+
+		popped = c.popItem(shard, key, c.clock.next())
+		c.publishShard(shard)
+
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return popped, nil
+}
+
+// popItem pops the first item of the list at `key` at `version`, deleting
+// the list once it's empty. The caller must hold the lock of the key's
+// shard, have checked the key holds a list and have logged the pop.
+func (c *Cache) popItem(shard *cacheShard, key string, version uint64) string {
+	list := shard.typed[key]
+	before := list.size()
+
+	popped := list.items.popFront()
+	list.bytes -= len(popped)
+
+	if list.items.len() == 0 {
+		c.tombstoneEntry(shard, key, version)
+		return popped
+	}
+	c.typedWritten(shard, key, list.size()-before, version)
+
+	return popped
+}
+
+// LRange returns the items of the list at `key` from `start` to `stop`,
+// inclusive. Negative indices count from the end of the list, -1 being its
+// last item, and indices past either end are cut down to the list, so
+// LRange(key, 0, -1) returns the whole of it. A missing key is an empty list.
+func (c *Cache) LRange(key string, start int, stop int) ([]string, error) {
+	var items []string
+	var err error
+	c.readKey(key, func(shard *cacheShard) {
+		var list *typedValue
+		if list, err = shard.typedOf(key, KindList); err != nil || list == nil {
+			return
+		}
+
+		length := list.items.len()
+		if start < 0 {
+			start += length
+		}
+		if stop < 0 {
+			stop += length
+		}
+		if start < 0 {
+			start = 0
+		}
+		if stop >= length {
+			stop = length - 1
+		}
+
+		for i := start; i <= stop; i++ {
+			items = append(items, list.items.at(i))
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(items) > 0 {
+		c.touchKey(key)
+	}
+
+	return items, nil
+}
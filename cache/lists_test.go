@@ -0,0 +1,220 @@
+package cache
+
+import (
+	"github.com/GrappigPanda/Olivia/config"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestPushPopAndRange(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{IsTesting: true})
+
+	if length, err := cache.RPush("list", 0, "b", "c"); err != nil || length != 2 {
+		t.Fatalf("Expected 2, got %v (%v)", length, err)
+	}
+	if length, err := cache.LPush("list", 0, "a", "z"); err != nil || length != 4 {
+		t.Fatalf("Expected 4, got %v (%v)", length, err)
+	}
+
+	var ranges = []struct {
+		start    int
+		stop     int
+		expected []string
+	}{
+		{0, -1, []string{"z", "a", "b", "c"}},
+		{1, 2, []string{"a", "b"}},
+		{-2, -1, []string{"b", "c"}},
+		{-10, 10, []string{"z", "a", "b", "c"}},
+		{3, 1, nil},
+		{5, 10, nil},
+	}
+	for _, r := range ranges {
+		items, err := cache.LRange("list", r.start, r.stop)
+		if err != nil || !reflect.DeepEqual(items, r.expected) {
+			t.Fatalf("Expected %v, got %v (%v)", r.expected, items, err)
+		}
+	}
+
+	for _, expected := range []string{"z", "a", "b", "c"} {
+		if value, err := cache.LPop("list"); err != nil || value != expected {
+			t.Fatalf("Expected %v, got %v (%v)", expected, value, err)
+		}
+	}
+
+	// An emptied list is deleted.
+	if _, err := cache.LPop("list"); err == nil {
+		t.Fatalf("Expected popping an empty list to fail")
+	}
+	if _, ok := cache.readValue("list"); ok {
+		t.Fatalf("Expected the emptied list to be deleted")
+	}
+}
+
+func TestPushTrimsToMaxLen(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{IsTesting: true})
+
+	for _, value := range []string{"1", "2", "3", "4"} {
+		cache.LPush("recent", 3, value)
+		cache.RPush("queue", 3, value)
+	}
+
+	if items, _ := cache.LRange("recent", 0, -1); !reflect.DeepEqual(items, []string{"4", "3", "2"}) {
+		t.Fatalf("Expected %v, got %v", []string{"4", "3", "2"}, items)
+	}
+	if items, _ := cache.LRange("queue", 0, -1); !reflect.DeepEqual(items, []string{"2", "3", "4"}) {
+		t.Fatalf("Expected %v, got %v", []string{"2", "3", "4"}, items)
+	}
+}
+
+func TestListsAndStringsDontMix(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{IsTesting: true})
+	cache.Set("string", "value")
+	cache.RPush("list", 0, "item")
+
+	if _, err := cache.RPush("string", 0, "item"); err != ErrWrongType {
+		t.Fatalf("Expected %v, got %v", ErrWrongType, err)
+	}
+	if _, err := cache.LRange("string", 0, -1); err != ErrWrongType {
+		t.Fatalf("Expected %v, got %v", ErrWrongType, err)
+	}
+	if _, err := cache.Get("list"); err != ErrWrongType {
+		t.Fatalf("Expected %v, got %v", ErrWrongType, err)
+	}
+	if found := cache.GetMany([]string{"string", "list"}); len(found) != 1 {
+		t.Fatalf("Expected only the string, got %v", found)
+	}
+}
+
+func TestListItemsRoundTrip(t *testing.T) {
+	items := []string{"", "a:b", "12:x", "\x00list:", "with\nnewline"}
+
+	decoded, err := decodeItems(encodeItems(items))
+	if err != nil || !reflect.DeepEqual(decoded, items) {
+		t.Fatalf("Expected %v, got %v (%v)", items, decoded, err)
+	}
+
+	if _, err := decodeItems("5:abc"); err == nil {
+		t.Fatalf("Expected a malformed list to be refused")
+	}
+}
+
+func TestStringsNeverTurnIntoLists(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{IsTesting: true})
+
+	// Strings are kept apart from lists by their type, not their contents,
+	// so one spelling out an encoded list is still a string.
+	value := "\x00list:1:a" + encodeItems([]string{"b"})
+	cache.Set("key", value)
+
+	if got, err := cache.Get("key"); err != nil || got != value {
+		t.Fatalf("Expected %q, got %q (%v)", value, got, err)
+	}
+	if _, err := cache.LRange("key", 0, -1); err != ErrWrongType {
+		t.Fatalf("Expected %v, got %v", ErrWrongType, err)
+	}
+}
+
+func TestItemListWrapsAround(t *testing.T) {
+	var list itemList
+	var expected []string
+
+	// Pushing onto and popping off of both ends moves the head around the
+	// ring, growing and shrinking it along the way.
+	for i := 0; i < 100; i++ {
+		item := strconv.Itoa(i)
+		if i%2 == 0 {
+			list.pushFront(item)
+			expected = append([]string{item}, expected...)
+		} else {
+			list.pushBack(item)
+			expected = append(expected, item)
+		}
+
+		if i%3 == 0 {
+			if popped := list.popFront(); popped != expected[0] {
+				t.Fatalf("Expected %v, got %v", expected[0], popped)
+			}
+			expected = expected[1:]
+		}
+	}
+
+	for len(expected) > 0 {
+		last := expected[len(expected)-1]
+		if popped := list.popBack(); popped != last {
+			t.Fatalf("Expected %v, got %v", last, popped)
+		}
+		expected = expected[:len(expected)-1]
+
+		for i := range expected {
+			if item := list.at(i); item != expected[i] {
+				t.Fatalf("Expected %v, got %v", expected[i], item)
+			}
+		}
+	}
+
+	if list.len() != 0 || len(list.ring) != minListCapacity {
+		t.Fatalf("Expected an empty ring of %v, got %v items in %v", minListCapacity, list.len(), len(list.ring))
+	}
+}
+
+func TestListsSurviveRestarts(t *testing.T) {
+	cfg, cleanup := durableConfig(t)
+	defer cleanup()
+
+	cache := NewCache(nil, cfg)
+	cache.RPush("snapshotted", 0, "a", "b")
+	if err := cache.Snapshot(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// Pushes and pops since the snapshot are replayed from the log.
+	cache.RPush("snapshotted", 0, "c")
+	cache.LPop("snapshotted")
+	cache.LPush("logged", 2, "1", "2", "3")
+	cache.RPush("popped", 0, "x")
+	cache.LPop("popped")
+	cache.wal.Close()
+
+	restarted := NewCache(nil, cfg)
+
+	var lists = []struct {
+		key      string
+		expected []string
+	}{
+		{"snapshotted", []string{"b", "c"}},
+		{"logged", []string{"3", "2"}},
+		{"popped", nil},
+	}
+	for _, l := range lists {
+		if items, err := restarted.LRange(l.key, 0, -1); err != nil || !reflect.DeepEqual(items, l.expected) {
+			t.Fatalf("Expected %v, got %v (%v)", l.expected, items, err)
+		}
+	}
+	if _, ok := restarted.readValue("popped"); ok {
+		t.Fatalf("Expected the emptied list to stay deleted")
+	}
+}
+
+func TestListsReplicateWhole(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{IsTesting: true})
+	cache.RPush("list", 0, "a", "b c")
+
+	var state ReplicationEntry
+	cache.readKey("list", func(shard *cacheShard) {
+		state = cache.replicationState(shard, "list")
+	})
+	if state.Kind != KindList || state.Value != encodeItems([]string{"a", "b c"}) {
+		t.Fatalf("Expected the encoded list, got %v", state)
+	}
+
+	replica := NewCache(nil, &config.Cfg{IsTesting: true})
+	replica.ApplyReplicationBatch([]ReplicationEntry{state})
+
+	if items, err := replica.LRange("list", 0, -1); err != nil || !reflect.DeepEqual(items, []string{"a", "b c"}) {
+		t.Fatalf("Expected %v, got %v (%v)", []string{"a", "b c"}, items, err)
+	}
+	if version, _ := replica.Version("list"); version != state.Version {
+		t.Fatalf("Expected %v, got %v", state.Version, version)
+	}
+}
@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// ErrLockHeld is returned by AcquireLock when someone else holds the lock.
+var ErrLockHeld = errors.New("Lock is already held")
+
+// ErrLockNotHeld is returned by ReleaseLock when the lock isn't held under
+// the given token, i.e. it was released already or its lease ran out.
+var ErrLockNotHeld = errors.New("Lock isn't held with that token")
+
+// AcquireLock takes the lock named `key`, holding it for a lease of `ttl`
+// seconds unless it's released before, and returns its fencing token.
+// Tokens are the lock's version, so every acquisition of a lock hands out a
+// greater token than the ones before it, even across restarts; resources the
+// lock guards can refuse writes carrying a token older than the last they
+// saw. The lock is held by the key existing, holding its token, so it lives
+// on the node it's acquired on, or on its owners while placing, and every
+// party has to lock through the same one. It returns ErrLockHeld while
+// someone else holds it.
+func (c *Cache) AcquireLock(key string, ttl int) (uint64, error) {
+	if ttl <= 0 {
+		return 0, errors.New("Lock leases must be positive")
+	}
+	ttl = c.clampTTL(key, ttl)
+
+	var token uint64
+	err := c.mutateKey(key, func(shard *cacheShard) error {
+		if _, ok := shard.entries[key]; ok && !c.leaseExpired(shard, key) {
+			return ErrLockHeld
+		}
+
+		token = c.clock.next()
+		written, err := c.setAt(shard, key, strconv.FormatUint(token, 10), token)
+		if written {
+			c.publishShard(shard)
+		}
+		if err != nil {
+			return err
+		}
+
+		return c.expire(shard, key, ttl)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return token, nil
+}
+
+// ReleaseLock releases the lock named `key`, but only if it's still held
+// under `token`, so a holder whose lease ran out can't release the lock
+// someone else has taken since. It returns ErrLockNotHeld otherwise.
+func (c *Cache) ReleaseLock(key string, token uint64) error {
+	return c.mutateKey(key, func(shard *cacheShard) error {
+		value, ok, _ := shard.stringOf(key)
+		if !ok || value != strconv.FormatUint(token, 10) || c.leaseExpired(shard, key) {
+			return ErrLockNotHeld
+		}
+
+		err := c.removeEntry(shard, key, c.clock.next())
+		c.publishShard(shard)
+
+		return err
+	})
+}
+
+// leaseExpired checks whether `key`'s expiration has passed, though the
+// eviction loop hasn't gotten to it yet. The caller must hold the lock of
+// the key's shard.
+func (c *Cache) leaseExpired(shard *cacheShard, key string) bool {
+	node, ok := shard.expirations.Get(key)
+	return ok && !node.Timeout.After(time.Now().UTC())
+}
@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"github.com/GrappigPanda/Olivia/config"
+	"testing"
+	"time"
+)
+
+func TestAcquireAndReleaseLock(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{IsTesting: true})
+
+	token, err := cache.AcquireLock("lock", 30)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := cache.AcquireLock("lock", 30); err != ErrLockHeld {
+		t.Fatalf("Expected %v, got %v", ErrLockHeld, err)
+	}
+	if ttl, err := cache.GetTTL("lock"); err != nil || ttl <= 0 {
+		t.Fatalf("Expected the lock to carry its lease, got %v (%v)", ttl, err)
+	}
+
+	if err := cache.ReleaseLock("lock", token+1); err != ErrLockNotHeld {
+		t.Fatalf("Expected %v, got %v", ErrLockNotHeld, err)
+	}
+	if err := cache.ReleaseLock("lock", token); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := cache.ReleaseLock("lock", token); err != ErrLockNotHeld {
+		t.Fatalf("Expected %v, got %v", ErrLockNotHeld, err)
+	}
+
+	next, err := cache.AcquireLock("lock", 30)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if next <= token {
+		t.Fatalf("Expected a token greater than %v, got %v", token, next)
+	}
+}
+
+func TestLockLeaseExpires(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{IsTesting: true})
+
+	token, err := cache.AcquireLock("lock", 1)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// The lock frees up as its lease runs out, before the eviction loop
+	// removes the key.
+	time.Sleep(1100 * time.Millisecond)
+	if err := cache.ReleaseLock("lock", token); err != ErrLockNotHeld {
+		t.Fatalf("Expected %v, got %v", ErrLockNotHeld, err)
+	}
+
+	next, err := cache.AcquireLock("lock", 30)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if next <= token {
+		t.Fatalf("Expected a token greater than %v, got %v", token, next)
+	}
+}
+
+func TestAcquireLockRefusesBadLeases(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{IsTesting: true})
+
+	if _, err := cache.AcquireLock("lock", 0); err == nil {
+		t.Fatalf("Expected an error")
+	}
+}
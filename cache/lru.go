@@ -0,0 +1,139 @@
+package cache
+
+import (
+	binheap "github.com/GrappigPanda/Olivia/shared"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// recency tracks when each key was last read or written, so the least
+// recently used keys can be evicted once MaxEntries or MaxBytes is reached.
+// It's the allkeys-lru EvictionPolicy.
+type recency struct {
+	heap *binheap.Heap
+	sync.Mutex
+}
+
+func newRecency() *recency {
+	return &recency{heap: binheap.NewHeapReallocate(defaultHeapCapacity)}
+}
+
+// Touch marks `key` as just used.
+func (r *recency) Touch(key string) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.heap.Insert(binheap.NewNode(key, time.Now().UTC()))
+}
+
+// Remove forgets about `key`.
+func (r *recency) Remove(key string) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.heap.Remove(key)
+}
+
+// Victim returns the least recently used key other than `keep`.
+func (r *recency) Victim(keep string) (string, bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	node := earliestNode(r.heap, keep)
+	if node == nil {
+		return "", false
+	}
+
+	return node.Key, true
+}
+
+// earliestNode returns the heap's earliest node other than `keep`, or nil if
+// there's none. As the heap is kept sorted, that's one of its first two nodes.
+func earliestNode(heap *binheap.Heap, keep string) *binheap.Node {
+	for index := 0; index < 2; index++ {
+		node, err := heap.Peek(index)
+		if err != nil || node == nil {
+			return nil
+		}
+
+		if node.Key != keep {
+			return node
+		}
+	}
+
+	return nil
+}
+
+// touchKey marks `key` as just used, if keys are evicted at all.
+func (c *Cache) touchKey(key string) {
+	if c.eviction != nil {
+		c.eviction.Touch(key)
+	}
+}
+
+// overLimits checks whether the cache holds more keys or bytes than it's
+// configured to.
+func (c *Cache) overLimits() bool {
+	if c.config.MaxEntries > 0 && c.keyCount() > c.config.MaxEntries {
+		return true
+	}
+
+	return c.config.MaxBytes > 0 && atomic.LoadInt64(&c.usedBytes) > int64(c.config.MaxBytes)
+}
+
+// evictLeastRecent evicts the keys the eviction policy picks until the cache
+// is back within MaxEntries and MaxBytes. `keep`, the key just written, is
+// never evicted, even if it alone exceeds MaxBytes. The caller must hold the
+// cache lock, shared or exclusively, but no shard lock: each victim's shard is
+// locked in turn.
+func (c *Cache) evictLeastRecent(keep string) {
+	if c.eviction == nil {
+		return
+	}
+
+	for c.overLimits() {
+		key, ok := c.eviction.Victim(keep)
+		if !ok {
+			return
+		}
+
+		shard := c.shardOf(key)
+		shard.Lock()
+		c.evictKey(shard, key)
+		shard.Unlock()
+	}
+}
+
+// evictKey evicts `key` to make room. The caller must hold the lock of the
+// key's shard.
+func (c *Cache) evictKey(shard *cacheShard, key string) {
+	// A read may have touched a key just as it was removed, or another
+	// writer may have evicted it first, leaving it behind in the policy.
+	if _, ok := shard.entries[key]; !ok {
+		c.eviction.Remove(key)
+		shard.expirations.Remove(key)
+		return
+	}
+
+	if err := c.logWrite(walRecord{Op: walDelete, Key: key}); err != nil {
+		log.Printf("Failed to log the eviction of %v: %v", key, err)
+	}
+	c.deleteEntry(shard, key)
+	shard.publish()
+	c.publishExpiration(key, EvictedLRU)
+	atomic.AddUint64(&c.counters.lruEvictions, 1)
+}
+
+// evictRestored evicts whatever a restore left over the limits, e.g. after
+// they were lowered.
+func (c *Cache) evictRestored() {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.overLimits() {
+		c.evictLeastRecent("")
+		c.copyCache()
+	}
+}
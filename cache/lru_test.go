@@ -0,0 +1,98 @@
+package cache
+
+import (
+	"github.com/GrappigPanda/Olivia/config"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMaxEntriesEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{IsTesting: true, MaxEntries: 3})
+	events := make(chan ExpireEvent, 10)
+	cache.OnExpireStream(events)
+
+	cache.Set("key1", "value1")
+	cache.Set("key2", "value2")
+	cache.Set("key3", "value3")
+
+	// Reading key1 makes key2 the least recently used.
+	if _, err := cache.Get("key1"); err != nil {
+		t.Fatalf("%v", err)
+	}
+	cache.Set("key4", "value4")
+
+	if _, err := cache.Get("key2"); err == nil {
+		t.Fatalf("Expected key2 to be evicted")
+	}
+	for _, key := range []string{"key1", "key3", "key4"} {
+		if _, err := cache.Get(key); err != nil {
+			t.Fatalf("Expected %v to be kept, got %v", key, err)
+		}
+	}
+
+	if evictions := cache.Stats().LRUEvictions; evictions != 1 {
+		t.Fatalf("Expected 1 eviction, got %v", evictions)
+	}
+
+	select {
+	case event := <-events:
+		if event.Key != "key2" || event.Reason != EvictedLRU {
+			t.Fatalf("Expected key2 to be evicted, got %+v", event)
+		}
+	default:
+		t.Fatalf("Expected an eviction event")
+	}
+
+	if ok, _ := cache.GetBloomFilter().HasKey([]byte("key2")); ok {
+		t.Fatalf("Expected key2 to be taken out of the bloom filter")
+	}
+}
+
+func TestMaxBytesEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{
+		IsTesting: true,
+		MaxBytes:  2 * entrySize("key1", "value1"),
+	})
+
+	cache.Set("key1", "value1")
+	cache.Set("key2", "value2")
+	cache.Set("key1", "value1!")
+
+	if _, err := cache.Get("key2"); err == nil {
+		t.Fatalf("Expected key2 to be evicted")
+	}
+	if value, err := cache.Get("key1"); err != nil || value != "value1!" {
+		t.Fatalf("Expected value1!, got %v (%v)", value, err)
+	}
+
+	if usedBytes := int(atomic.LoadInt64(&cache.usedBytes)); usedBytes != entrySize("key1", "value1!") {
+		t.Fatalf("Expected %v used bytes, got %v", entrySize("key1", "value1!"), usedBytes)
+	}
+}
+
+func TestOversizeEntryIsKept(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{IsTesting: true, MaxBytes: 1})
+
+	cache.Set("key1", "value1")
+	cache.Set("key2", "value2")
+
+	if _, err := cache.Get("key1"); err == nil {
+		t.Fatalf("Expected key1 to be evicted")
+	}
+	if _, err := cache.Get("key2"); err != nil {
+		t.Fatalf("Expected the key just set to be kept, got %v", err)
+	}
+}
+
+func TestDeletedKeysArentEvicted(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{IsTesting: true, MaxEntries: 2})
+
+	cache.Set("key1", "value1")
+	cache.Set("key2", "value2")
+	cache.Delete("key1")
+	cache.Set("key3", "value3")
+
+	if evictions := cache.Stats().LRUEvictions; evictions != 0 {
+		t.Fatalf("Expected no evictions, got %v", evictions)
+	}
+}
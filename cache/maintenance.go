@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"sync/atomic"
+)
+
+// maintenanceDrainBatch caps how many keys an expiration sweep evicts while
+// the backlog built up during a pause is being worked off, so resuming
+// maintenance doesn't evict everything that expired in the meantime at once.
+var maintenanceDrainBatch = 100
+
+// maintenance gates the background loops. Both fields are only ever touched
+// atomically.
+type maintenance struct {
+	paused int32
+	// draining is set while the expirations which piled up during a pause
+	// are being evicted.
+	draining int32
+}
+
+// PauseMaintenance stops the background loops (heartbeats, bloom filter
+// syncing, snapshots) and expiration sweeps from doing any work until
+// ResumeMaintenance is called. The loops keep running, they just skip their
+// work while paused.
+func (c *Cache) PauseMaintenance() {
+	atomic.StoreInt32(&c.maintenance.paused, 1)
+}
+
+// ResumeMaintenance picks the background loops back up. Expirations which
+// piled up while paused are evicted over several sweeps rather than in one go.
+func (c *Cache) ResumeMaintenance() {
+	if atomic.CompareAndSwapInt32(&c.maintenance.paused, 1, 0) {
+		atomic.StoreInt32(&c.maintenance.draining, 1)
+	}
+}
+
+// maintenancePaused checks whether background work should be skipped.
+func (c *Cache) maintenancePaused() bool {
+	return atomic.LoadInt32(&c.maintenance.paused) == 1
+}
+
+// evictionCap returns how many keys the next expiration sweep may evict, zero
+// meaning no cap.
+func (c *Cache) evictionCap() int {
+	max := c.config.MaxEvictionsPerSweep
+	if atomic.LoadInt32(&c.maintenance.draining) == 1 {
+		if max <= 0 || max > maintenanceDrainBatch {
+			max = maintenanceDrainBatch
+		}
+	}
+
+	return max
+}
+
+// sweptEvictions ends draining once a sweep no longer hits its cap, meaning
+// the backlog is gone.
+func (c *Cache) sweptEvictions(evicted int, max int) {
+	if max <= 0 || evicted < max {
+		atomic.StoreInt32(&c.maintenance.draining, 0)
+	}
+}
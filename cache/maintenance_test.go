@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"fmt"
+	"github.com/GrappigPanda/Olivia/config"
+	"testing"
+	"time"
+)
+
+func TestPausedMaintenanceSkipsEvictions(t *testing.T) {
+	cache := NewCache(nil, stubConfig())
+	for i := 0; i < 10; i++ {
+		cache.SetExpiration(fmt.Sprintf("key%d", i), "value", 1)
+	}
+	future := time.Now().UTC().Add(time.Hour)
+
+	cache.PauseMaintenance()
+	cache.EvictExpiredkeys(future)
+	if cache.keyCount() != 10 {
+		t.Fatalf("Expected no evictions while paused, %v keys are left", cache.keyCount())
+	}
+
+	cache.ResumeMaintenance()
+	cache.EvictExpiredkeys(future)
+	if cache.keyCount() != 0 {
+		t.Fatalf("Expected every key to be evicted, %v keys are left", cache.keyCount())
+	}
+}
+
+func TestResumedMaintenanceDrainsGradually(t *testing.T) {
+	defer func(batch int) { maintenanceDrainBatch = batch }(maintenanceDrainBatch)
+	maintenanceDrainBatch = 4
+
+	cache := NewCache(nil, stubConfig())
+	for i := 0; i < 10; i++ {
+		cache.SetExpiration(fmt.Sprintf("key%d", i), "value", 1)
+	}
+	future := time.Now().UTC().Add(time.Hour)
+
+	cache.PauseMaintenance()
+	cache.ResumeMaintenance()
+
+	for _, expected := range []int{6, 2, 0} {
+		cache.EvictExpiredkeys(future)
+		if cache.keyCount() != expected {
+			t.Fatalf("Expected %v keys to be left, got %v", expected, cache.keyCount())
+		}
+	}
+
+	// Once the backlog is gone, sweeps are uncapped again.
+	for i := 0; i < 10; i++ {
+		cache.SetExpiration(fmt.Sprintf("key%d", i), "value", 1)
+	}
+	cache.EvictExpiredkeys(future)
+	if cache.keyCount() != 0 {
+		t.Fatalf("Expected every key to be evicted, %v keys are left", cache.keyCount())
+	}
+}
+
+func TestPausedMaintenanceSkipsBackgroundLoops(t *testing.T) {
+	cache := NewCache(nil, nil)
+	executions := make(chan int, 100)
+	stop := make(chan bool)
+
+	cache.PauseMaintenance()
+	go cache.executeRepeatedly(time.Millisecond, func() {}, stop, executions)
+
+	time.Sleep(20 * time.Millisecond)
+	if len(executions) != 0 {
+		t.Fatalf("Expected no executions while paused, got %v", len(executions))
+	}
+
+	cache.ResumeMaintenance()
+	select {
+	case <-executions:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the loop to resume")
+	}
+	stop <- true
+}
+
+func TestExpiredKeysAreEvictedInTheBackground(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{IsTesting: true, EvictionIntervalMillis: 5})
+	defer cache.Stop()
+
+	cache.SetExpiration("key1", "value1", 0)
+	for attempt := 0; ; attempt++ {
+		if _, err := cache.Get("key1"); err != nil {
+			break
+		}
+		if attempt == 100 {
+			t.Fatalf("Expected key1 to be evicted in the background")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStopEndsBackgroundEviction(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{IsTesting: true, EvictionIntervalMillis: 5})
+
+	stopped := make(chan bool)
+	go func() {
+		cache.Stop()
+		stopped <- true
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected Stop to return promptly")
+	}
+	cache.Stop()
+
+	cache.SetExpiration("key1", "value1", 0)
+	time.Sleep(50 * time.Millisecond)
+	if _, err := cache.Get("key1"); err != nil {
+		t.Fatalf("Expected no eviction after Stop, got %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"fmt"
+	binheap "github.com/GrappigPanda/Olivia/shared"
+	"unsafe"
+)
+
+// Rough per-entry overheads on top of the raw key and value bytes. These are
+// estimates of Go's runtime layout rather than exact measurements.
+var (
+	// entryOverhead covers the key and value string headers in the cache map
+	// plus a share of the map's bucket bookkeeping.
+	entryOverhead = 2*int(unsafe.Sizeof("")) + 16
+	// expirationOverhead covers a key's binary heap node, the node pointer
+	// in the heap's tree and the node's entry in the heap's key lookup.
+	expirationOverhead = int(unsafe.Sizeof(binheap.Node{})) +
+		int(unsafe.Sizeof(&binheap.Node{})) +
+		int(unsafe.Sizeof("")) + int(unsafe.Sizeof(0))
+)
+
+// MemoryUsage returns an approximate number of bytes `key` takes up in the
+// cache: the key and value bytes plus an estimate of the bookkeeping around
+// them, similar to Redis's `MEMORY USAGE`.
+func (c *Cache) MemoryUsage(key string) (int, error) {
+	var value string
+	var typedSize int
+	var ok, expires bool
+	c.readKey(key, func(shard *cacheShard) {
+		value, ok = shard.entries[key]
+		if typed, isTyped := shard.typed[key]; isTyped {
+			typedSize = typed.size()
+		}
+		_, expires = shard.expirations.Get(key)
+	})
+
+	if !ok {
+		return 0, fmt.Errorf("Key not found in cache")
+	}
+
+	usage := entrySize(key, value) + typedSize
+	if expires {
+		usage += expirationOverhead
+	}
+
+	return usage, nil
+}
+
+// entrySize is the approximate number of bytes a key and its value take up in
+// the cache map, leaving out any expiration.
+func entrySize(key string, value string) int {
+	return len(key) + len(value) + entryOverhead
+}
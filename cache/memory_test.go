@@ -0,0 +1,51 @@
+package cache
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMemoryUsageScalesWithValue(t *testing.T) {
+	cache := NewCache(nil, nil)
+
+	cache.Set("small", strings.Repeat("a", 10))
+	cache.Set("large", strings.Repeat("a", 1000))
+
+	small, err := cache.MemoryUsage("small")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	large, err := cache.MemoryUsage("large")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if large-small != 990 {
+		t.Fatalf("Expected %v, got %v", 990, large-small)
+	}
+
+	if small <= len("small")+10 {
+		t.Fatalf("Expected more than %v bytes, got %v", len("small")+10, small)
+	}
+}
+
+func TestMemoryUsageCountsExpiration(t *testing.T) {
+	cache := NewCache(nil, nil)
+
+	cache.Set("key1", "value")
+	cache.SetExpiration("key2", "value", 60)
+
+	persistent, _ := cache.MemoryUsage("key1")
+	expiring, _ := cache.MemoryUsage("key2")
+	if expiring <= persistent {
+		t.Fatalf("Expected %v to be more than %v", expiring, persistent)
+	}
+}
+
+func TestMemoryUsageMissingKey(t *testing.T) {
+	cache := NewCache(nil, nil)
+
+	if _, err := cache.MemoryUsage("missing"); err == nil {
+		t.Fatalf("Expected an error for a missing key")
+	}
+}
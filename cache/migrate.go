@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"fmt"
+	"github.com/GrappigPanda/Olivia/dht"
+	"sort"
+)
+
+// Migrate moves the keys matching the glob `pattern` (see MatchGlob) from us
+// to the node at `destination`, for operators rebalancing by hand, returning
+// the keys moved, sorted. Each key is set on the destination with its
+// version and remaining TTL, and only deleted here once the destination has
+// acked it and if it wasn't written in the meantime, so a key is never lost
+// midway: it's either still here, or on the destination, or both if the
+// destination refused it. A destination we aren't connected to is dialed for
+// the migration.
+//
+// Keys are moved RebalanceBatchSize at a time. Migrating keys we own on the
+// hash ring doesn't change who owns them, so reads routed by owner won't find
+// them on the destination.
+func (c *Cache) Migrate(pattern string, destination string) ([]string, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("No keys given to migrate")
+	}
+	if err := checkGlob(pattern); err != nil {
+		return nil, err
+	}
+	if c.PeerList == nil || dht.IsSelf(destination, c.config) || destination == c.selfAddress {
+		return nil, fmt.Errorf("Can't migrate keys to %v", destination)
+	}
+
+	peer := c.findPeer(destination)
+	if peer == nil || !peer.IsConnectable() {
+		peer = c.PeerList.NewPeer(destination)
+		if err := peer.Connect(); err != nil {
+			return nil, fmt.Errorf("Failed to connect to %v: %v", destination, err)
+		}
+		defer peer.Disconnect()
+	}
+
+	keys := c.matchingKeys(pattern)
+	batchSize := c.config.RebalanceBatchSize
+	if batchSize <= 0 {
+		batchSize = len(keys)
+	}
+
+	moved := []string{}
+	for start := 0; start < len(keys); start += batchSize {
+		end := start + batchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		migrated, err := c.migrateBatch(peer, keys[start:end])
+		moved = append(moved, migrated...)
+		if err != nil {
+			sort.Strings(moved)
+			return moved, err
+		}
+	}
+	sort.Strings(moved)
+
+	return moved, nil
+}
+
+// matchingKeys returns the keys we hold matching a glob.
+func (c *Cache) matchingKeys(pattern string) []string {
+	c.Lock()
+	defer c.Unlock()
+
+	var keys []string
+	c.forEachEntry(func(key string, _ string) {
+		if ok, _ := MatchGlob(pattern, key); ok {
+			keys = append(keys, key)
+		}
+	})
+
+	return keys
+}
+
+// migrateBatch sends keys to `peer`, deleting those it acked, and returns the
+// keys moved, even if sending part of the batch failed.
+func (c *Cache) migrateBatch(peer *dht.Peer, keys []string) ([]string, error) {
+	var entries, sent []ReplicationEntry
+	for _, key := range keys {
+		if entry, ok := c.replicationEntry(key); ok {
+			entries = append(entries, entry)
+			sent = append(sent, outgoing(entry))
+		}
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	acks, err := c.ReplicateBatch(peer, sent)
+
+	var moved []string
+	for _, entry := range entries {
+		if acks[entry.Key] && c.dropMoved(entry.Key, entry) {
+			moved = append(moved, entry.Key)
+		}
+	}
+
+	if err != nil {
+		return moved, fmt.Errorf("Failed to migrate keys to %v: %v", peer.IPPort, err)
+	}
+
+	return moved, nil
+}
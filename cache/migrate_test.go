@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMigrateMovesMatchingKeys(t *testing.T) {
+	destination := newStubPeer(t, map[string]string{})
+	defer destination.Close()
+
+	cache := newCacheWithStubPeers(t, destination)
+	cache.Set("user1", "alice")
+	cache.Set("user2", "bob")
+	cache.Set("session1", "abc")
+	cache.SetExpiration("user3", "carol", 60)
+
+	moved, err := cache.Migrate("user*", destination.Addr())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	expected := []string{"user1", "user2", "user3"}
+	if !reflect.DeepEqual(moved, expected) {
+		t.Fatalf("Expected %v, got %v", expected, moved)
+	}
+	for _, key := range expected {
+		if _, ok := destination.Value(key); !ok {
+			t.Fatalf("Expected %v to be set on the destination", key)
+		}
+		if _, ok := cache.readValue(key); ok {
+			t.Fatalf("Expected %v to be deleted once migrated", key)
+		}
+	}
+	if value, ok := cache.readValue("session1"); !ok || value != "abc" {
+		t.Fatalf("Expected %v, got %v", "abc", value)
+	}
+}
+
+func TestMigrateKeepsRefusedKeys(t *testing.T) {
+	destination := newStubPeer(t, map[string]string{})
+	defer destination.Close()
+
+	cache := newCacheWithStubPeers(t, destination)
+	cache.Set("key", "value")
+
+	destination.FailReplicates(1)
+	moved, err := cache.Migrate("key", destination.Addr())
+	if err != nil || len(moved) != 0 {
+		t.Fatalf("Expected nothing to be moved, got %v %v", moved, err)
+	}
+	if value, ok := cache.readValue("key"); !ok || value != "value" {
+		t.Fatalf("Expected %v, got %v", "value", value)
+	}
+}
+
+func TestMigrateDialsUnknownDestinations(t *testing.T) {
+	destination := newStubPeer(t, map[string]string{})
+	defer destination.Close()
+
+	cache := newCacheWithStubPeers(t)
+	cache.Set("key", "value")
+
+	moved, err := cache.Migrate("key", destination.Addr())
+	if err != nil || !reflect.DeepEqual(moved, []string{"key"}) {
+		t.Fatalf("Expected %v, got %v %v", []string{"key"}, moved, err)
+	}
+	if value, ok := destination.Value("key"); !ok || value != "value" {
+		t.Fatalf("Expected %v, got %v", "value", value)
+	}
+}
+
+func TestMigrateRefusesBadArguments(t *testing.T) {
+	cache := newCacheWithStubPeers(t)
+
+	if _, err := cache.Migrate("", "127.0.0.1:1"); err == nil {
+		t.Fatalf("Expected an empty pattern to be refused")
+	}
+	if _, err := cache.Migrate("[", "127.0.0.1:1"); err == nil {
+		t.Fatalf("Expected a malformed pattern to be refused")
+	}
+	if _, err := cache.Migrate("key", cache.selfAddress); err == nil {
+		t.Fatalf("Expected migrating to ourselves to be refused")
+	}
+}
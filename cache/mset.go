@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// MSet sets every key of `entries` as a single batch. Every entry is
+// validated up front, and if any of them fails, nothing is written.
+func (c *Cache) MSet(entries map[string]string) error {
+	return c.MSetEx(entries, nil)
+}
+
+// MSetEx is MSet which also expires the keys of `expirations` after their
+// number of seconds. Every expiration has to belong to an entry of the batch.
+// With a ReplicationFactor, each write goes to its key's owners instead, see
+// placeWrites.
+func (c *Cache) MSetEx(entries map[string]string, expirations map[string]int) error {
+	if c.placing() {
+		return c.placeWrites(context.Background(), entries, expirations)
+	}
+
+	if err := c.validateBatch(entries, expirations); err != nil {
+		return err
+	}
+
+	return c.msetLocal(entries, expirations, nil)
+}
+
+// msetLocal writes an already validated batch to ourselves, at the versions
+// of `versions` or under new ones for the keys it doesn't hold. Keys already
+// holding a later write are skipped.
+func (c *Cache) msetLocal(entries map[string]string, expirations map[string]int, versions map[string]uint64) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	// Only a failing write-ahead log can stop the batch from here on, and
+	// whatever made it into the log is kept in the cache as well.
+	defer c.copyCache()
+	defer c.evictLeastRecent("")
+
+	for key, value := range entries {
+		shard := c.shardOf(key)
+		if c.stale(shard, key, value, versions[key]) {
+			continue
+		}
+		if _, err := c.setVersioned(shard, key, value, versions[key]); err != nil {
+			return err
+		}
+
+		if timeout, ok := expirations[key]; ok {
+			if err := c.expire(shard, key, c.clampTTL(key, timeout)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// SetMany sets every key of `entries` under a single acquisition of the lock.
+// Unlike MSet, each entry stands on its own: entries which fail are skipped
+// while the rest are written. It returns each key's error, nil for the keys
+// which were written.
+func (c *Cache) SetMany(entries map[string]string) map[string]error {
+	results := make(map[string]error, len(entries))
+
+	c.Lock()
+	defer c.Unlock()
+
+	written := false
+	for key, value := range entries {
+		if err := c.validateValue(value); err != nil {
+			results[key] = err
+			continue
+		}
+
+		wrote, err := c.set(c.shardOf(key), key, value)
+		results[key] = err
+		written = written || wrote
+	}
+
+	if written {
+		c.evictLeastRecent("")
+		c.copyCache()
+	}
+
+	return results
+}
+
+// validateBatch checks every entry of a batch the way a single SET would,
+// returning an error naming the first (by key) which fails.
+func (c *Cache) validateBatch(entries map[string]string, expirations map[string]int) error {
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if key == "" {
+			return fmt.Errorf("Invalid entry: keys can't be empty")
+		}
+
+		if err := c.validateValue(entries[key]); err != nil {
+			return fmt.Errorf("Invalid entry %v: %v", key, err)
+		}
+	}
+
+	for key, timeout := range expirations {
+		if _, ok := entries[key]; !ok {
+			return fmt.Errorf("Invalid entry %v: expiration without a value", key)
+		}
+
+		if timeout < 0 {
+			return fmt.Errorf("Invalid entry %v: negative expiration %d", key, timeout)
+		}
+	}
+
+	return nil
+}
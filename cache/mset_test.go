@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"github.com/GrappigPanda/Olivia/config"
+	"strings"
+	"testing"
+)
+
+func TestMSetWritesNothingOnAnOversizeValue(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{IsTesting: true, MaxValueBytes: 8})
+
+	err := cache.MSet(map[string]string{
+		"key1": "value1",
+		"key2": "waytoolongvalue",
+		"key3": "value3",
+	})
+	if err == nil || !strings.Contains(err.Error(), "key2") {
+		t.Fatalf("Expected an error naming key2, got %v", err)
+	}
+
+	for _, key := range []string{"key1", "key2", "key3"} {
+		if value, err := cache.Get(key); err == nil {
+			t.Fatalf("Expected %v not to be written, got %v", key, value)
+		}
+	}
+}
+
+func TestMSetExWritesNothingOnABadExpiration(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{IsTesting: true})
+
+	entries := map[string]string{"key1": "value1", "key2": "value2"}
+	for _, expirations := range []map[string]int{
+		{"key1": 10, "key2": -1},
+		{"key1": 10, "missing": 10},
+	} {
+		if err := cache.MSetEx(entries, expirations); err == nil {
+			t.Fatalf("Expected %v to be refused", expirations)
+		}
+
+		for key := range entries {
+			if value, err := cache.Get(key); err == nil {
+				t.Fatalf("Expected %v not to be written, got %v", key, value)
+			}
+		}
+	}
+}
+
+func TestMSetEx(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{IsTesting: true})
+
+	err := cache.MSetEx(
+		map[string]string{"key1": "value1", "key2": "value2"},
+		map[string]int{"key1": 10},
+	)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for key, expected := range map[string]string{"key1": "value1", "key2": "value2"} {
+		if value, err := cache.Get(key); err != nil || value != expected {
+			t.Fatalf("Expected %v, got %v (%v)", expected, value, err)
+		}
+	}
+
+	if _, ok := cache.shardOf("key1").expirations.Get("key1"); !ok {
+		t.Fatalf("Expected key1 to expire")
+	}
+	if _, ok := cache.shardOf("key2").expirations.Get("key2"); ok {
+		t.Fatalf("Expected key2 not to expire")
+	}
+}
+
+func TestSetManyReportsEachKey(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{IsTesting: true, MaxValueBytes: 8})
+	rebuilds := cache.Stats().ReadCacheRebuilds
+
+	results := cache.SetMany(map[string]string{
+		"key1": "value1",
+		"key2": "waytoolongvalue",
+		"key3": "value3",
+	})
+
+	if results["key1"] != nil || results["key3"] != nil || results["key2"] != ErrValueTooLarge {
+		t.Fatalf("Expected only key2 to fail, got %v", results)
+	}
+
+	for key, expected := range map[string]string{"key1": "value1", "key3": "value3"} {
+		if value, err := cache.Get(key); err != nil || value != expected {
+			t.Fatalf("Expected %v, got %v (%v)", expected, value, err)
+		}
+	}
+	if _, err := cache.Get("key2"); err == nil {
+		t.Fatalf("Expected key2 not to be written")
+	}
+
+	if hasKey, _ := cache.GetBloomFilter().HasKey([]byte("key3")); !hasKey {
+		t.Fatalf("Expected key3 to be added to the bloom filter")
+	}
+
+	if cache.Stats().ReadCacheRebuilds != rebuilds+1 {
+		t.Fatalf("Expected the read cache to be rebuilt once for the batch")
+	}
+}
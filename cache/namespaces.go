@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"fmt"
+	"github.com/GrappigPanda/Olivia/config"
+	"sort"
+	"sync"
+)
+
+// DefaultNamespace names the keyspace connections start out in.
+const DefaultNamespace = "default"
+
+// maxNamespaceLength caps how long a namespace's name can be.
+const maxNamespaceLength = 64
+
+// namespaces holds the keyspaces opened besides the default one.
+type namespaces struct {
+	caches map[string]*Cache
+	sync.Mutex
+}
+
+// Namespace returns the cache holding the keyspace `name`, opening it if it
+// isn't yet. Each namespace has its own keys, expirations and bloom filter,
+// so applications sharing a node can't collide. DefaultNamespace is the
+// cache namespaces are opened from.
+//
+// Namespaces are node-local: their keys aren't routed to or replicated on
+// peers. Their write-ahead logs and snapshots, if configured, are kept next
+// to the default keyspace's, suffixed by the namespace's name, and restored
+// once the namespace is opened again.
+func (c *Cache) Namespace(name string) (*Cache, error) {
+	if c.root != nil {
+		return c.root.Namespace(name)
+	}
+
+	if name == DefaultNamespace {
+		return c, nil
+	}
+
+	if err := validateNamespace(name); err != nil {
+		return nil, err
+	}
+
+	c.namespaces.Lock()
+	defer c.namespaces.Unlock()
+
+	if namespace, ok := c.namespaces.caches[name]; ok {
+		return namespace, nil
+	}
+
+	if len(c.namespaces.caches) >= c.config.MaxNamespaces {
+		return nil, fmt.Errorf("Can't open namespace %v: %d are already open", name, len(c.namespaces.caches))
+	}
+
+	namespace := NewCache(c.MessageBus, namespaceConfig(c.config, name))
+	namespace.root = c
+	if c.namespaces.caches == nil {
+		c.namespaces.caches = make(map[string]*Cache)
+	}
+	c.namespaces.caches[name] = namespace
+
+	return namespace, nil
+}
+
+// Namespaces returns the names of the namespaces opened, sorted, along with
+// DefaultNamespace.
+func (c *Cache) Namespaces() []string {
+	if c.root != nil {
+		return c.root.Namespaces()
+	}
+
+	c.namespaces.Lock()
+	defer c.namespaces.Unlock()
+
+	names := []string{DefaultNamespace}
+	for name := range c.namespaces.caches {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+
+	return names
+}
+
+// stopNamespaces stops every namespace opened.
+func (c *Cache) stopNamespaces() {
+	c.namespaces.Lock()
+	defer c.namespaces.Unlock()
+
+	for _, namespace := range c.namespaces.caches {
+		namespace.Stop()
+	}
+}
+
+// validateNamespace checks a namespace's name is safe to suffix file paths
+// and send over the wire with.
+func validateNamespace(name string) error {
+	if name == "" || len(name) > maxNamespaceLength {
+		return fmt.Errorf("Invalid namespace %q: names are 1 to %d characters", name, maxNamespaceLength)
+	}
+
+	for _, char := range name {
+		switch {
+		case char >= 'a' && char <= 'z', char >= 'A' && char <= 'Z':
+		case char >= '0' && char <= '9', char == '-', char == '_':
+		default:
+			return fmt.Errorf("Invalid namespace %q: names are letters, digits, - and _", name)
+		}
+	}
+
+	return nil
+}
+
+// namespaceConfig derives a namespace's config from the default keyspace's.
+// The namespace gets files of its own and no peers.
+func namespaceConfig(cfg config.Cfg, name string) *config.Cfg {
+	cfg.RemotePeers = nil
+	cfg.BaseNode = true
+	cfg.ReplicationRetryQueuePath = ""
+	cfg.MaxNamespaces = 0
+	cfg.GossipIntervalMillis = 0
+	if cfg.WALPath != "" {
+		cfg.WALPath += "." + name
+	}
+	if cfg.SnapshotPath != "" {
+		cfg.SnapshotPath += "." + name
+	}
+
+	return &cfg
+}
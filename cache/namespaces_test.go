@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"github.com/GrappigPanda/Olivia/config"
+	"testing"
+)
+
+func TestNamespacesDontCollide(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{BloomfilterSize: 1000, IsTesting: true, MaxNamespaces: 4})
+	defer cache.Stop()
+
+	app, err := cache.Namespace("app")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	cache.Set("key", "default")
+	app.Set("key", "app")
+
+	if value, _ := cache.Get("key"); value != "default" {
+		t.Fatalf("Expected %v, got %v", "default", value)
+	}
+	if value, _ := app.Get("key"); value != "app" {
+		t.Fatalf("Expected %v, got %v", "app", value)
+	}
+
+	// Selecting a namespace again, even from another namespace, returns the
+	// same keyspace.
+	again, _ := app.Namespace("app")
+	if again != app {
+		t.Fatalf("Expected the namespace to be opened once")
+	}
+	if root, _ := app.Namespace(DefaultNamespace); root != cache {
+		t.Fatalf("Expected the default namespace to be the root cache")
+	}
+
+	names := cache.Namespaces()
+	if len(names) != 2 || names[0] != DefaultNamespace || names[1] != "app" {
+		t.Fatalf("Expected [%v app], got %v", DefaultNamespace, names)
+	}
+}
+
+func TestNamespacesAreCapped(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{BloomfilterSize: 1000, IsTesting: true, MaxNamespaces: 1})
+	defer cache.Stop()
+
+	if _, err := cache.Namespace("first"); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if _, err := cache.Namespace("second"); err == nil {
+		t.Fatalf("Expected opening past MaxNamespaces to fail")
+	}
+}
+
+func TestNamespaceNamesAreValidated(t *testing.T) {
+	for _, name := range []string{"", "../etc", "has space", string(make([]byte, maxNamespaceLength+1))} {
+		if err := validateNamespace(name); err == nil {
+			t.Fatalf("Expected %q to be refused", name)
+		}
+	}
+
+	if err := validateNamespace("app-1_b"); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
+
+func TestNamespacesKeepTheirOwnWAL(t *testing.T) {
+	cfg, cleanup := durableConfig(t)
+	defer cleanup()
+	cfg.MaxNamespaces = 1
+
+	cache := NewCache(nil, cfg)
+	app, _ := cache.Namespace("app")
+	app.Set("key", "app")
+	cache.Stop()
+
+	restarted := NewCache(nil, cfg)
+	defer restarted.Stop()
+	if _, err := restarted.Get("key"); err == nil {
+		t.Fatalf("Expected the namespace's key to stay out of the default keyspace")
+	}
+
+	app, _ = restarted.Namespace("app")
+	if value, _ := app.Get("key"); value != "app" {
+		t.Fatalf("Expected %v, got %v", "app", value)
+	}
+}
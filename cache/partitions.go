@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"fmt"
+	"github.com/GrappigPanda/Olivia/bloomfilter"
+	"github.com/GrappigPanda/Olivia/bloomfilter/search"
+	"github.com/GrappigPanda/Olivia/dht"
+)
+
+// newPartitionFilters creates a bloom filter per hash-range partition, or
+// none if the cache isn't partitioned.
+func newPartitionFilters(items uint, partitions int, scheme bloomfilter.HashScheme, provider bloomfilter.HashProvider) []bloomfilter.BloomFilter {
+	if partitions <= 1 {
+		return nil
+	}
+
+	filters := make([]bloomfilter.BloomFilter, partitions)
+	for i := range filters {
+		filters[i] = bloomfilter.NewCountingByFailRateWithHash(
+			dht.PartitionItems(items, partitions),
+			0.01,
+			scheme,
+			provider,
+		)
+	}
+
+	return filters
+}
+
+// addToBloomFilters adds a key to our bloom filter, to the bloom filter of the
+// partition it falls into and to our cuckoo filter, pushing what our bloom
+// filter gained to our peers every BloomfilterDeltaSets keys. The caller must
+// hold the cache lock, shared or exclusively.
+func (c *Cache) addToBloomFilters(key string) {
+	c.bloomLock.Lock()
+	defer c.bloomLock.Unlock()
+
+	_, indices := c.bloomFilter.AddKey([]byte(key))
+	if delta := c.recordBloomDelta(indices); delta != nil {
+		go c.pushBloomDelta(delta)
+	}
+
+	if len(c.partitionFilters) > 0 {
+		partition := dht.PartitionOf(key, len(c.partitionFilters))
+		c.partitionFilters[partition].AddKey([]byte(key))
+	}
+	c.addToCuckooFilter(key)
+}
+
+// addKeysToBloomFilters adds many keys to our bloom filters in bulk. The
+// caller must hold the cache lock exclusively.
+func (c *Cache) addKeysToBloomFilters(keys []string) {
+	all := make([][]byte, len(keys))
+	byPartition := make([][][]byte, len(c.partitionFilters))
+
+	for i, key := range keys {
+		all[i] = []byte(key)
+		if len(c.partitionFilters) > 0 {
+			partition := dht.PartitionOf(key, len(c.partitionFilters))
+			byPartition[partition] = append(byPartition[partition], all[i])
+		}
+	}
+
+	c.bloomFilter.AddKeys(all)
+	for partition, partitionKeys := range byPartition {
+		c.partitionFilters[partition].AddKeys(partitionKeys)
+	}
+	for _, key := range keys {
+		c.addToCuckooFilter(key)
+	}
+}
+
+// removeFromBloomFilters takes a key back out of our bloom filter, out of the
+// bloom filter of its partition and out of our cuckoo filter. The caller must
+// hold the cache lock, shared or exclusively.
+func (c *Cache) removeFromBloomFilters(key string) {
+	c.bloomLock.Lock()
+	defer c.bloomLock.Unlock()
+
+	c.bloomFilter.RemoveKey([]byte(key))
+
+	if len(c.partitionFilters) > 0 {
+		partition := dht.PartitionOf(key, len(c.partitionFilters))
+		c.partitionFilters[partition].RemoveKey([]byte(key))
+	}
+	c.removeFromCuckooFilter(key)
+}
+
+// GetPartitionBloomFilter returns our bloom filter for a single partition.
+func (c *Cache) GetPartitionBloomFilter(partition int) (bloomfilter.BloomFilter, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if partition < 0 || partition >= len(c.partitionFilters) {
+		return nil, fmt.Errorf("%d is not a valid partition", partition)
+	}
+
+	return c.partitionFilters[partition], nil
+}
+
+// remoteCandidates returns the peers which probably hold `key`. When the
+// cluster is partitioned, only the key's partition filters are consulted.
+// When it routes by cuckoo filters, those are consulted instead.
+func (c *Cache) remoteCandidates(key string) []*dht.Peer {
+	if c.routesByCuckoo() {
+		return c.cuckooCandidates(key)
+	}
+
+	c.partitionedSearchLock.RLock()
+	search := c.partitionedSearch
+	c.partitionedSearchLock.RUnlock()
+
+	partitions := c.config.BloomfilterPartitions
+	if search != nil && partitions > 1 {
+		partition := dht.PartitionOf(key, partitions)
+		indices := c.routingIndices(key, true)
+
+		return search.GetFromIndices(partition, indices)
+	}
+
+	indices := c.routingIndices(key, false)
+	return c.bloomfilterSearch.GetFromIndices(indices)
+}
+
+// recalculatePartitionedSearch rebuilds the partitioned search from the
+// partition filters our peers have most recently sent us.
+func (c *Cache) recalculatePartitionedSearch() {
+	if len(c.partitionFilters) == 0 || c.PeerList == nil {
+		return
+	}
+
+	search := bfsearch.NewPartitionedSearch(
+		c.PeerList.GetPeers(),
+		len(c.partitionFilters),
+	)
+
+	c.partitionedSearchLock.Lock()
+	c.partitionedSearch = search
+	c.partitionedSearchLock.Unlock()
+}
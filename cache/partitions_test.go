@@ -0,0 +1,47 @@
+package cache
+
+import (
+	"fmt"
+	"github.com/GrappigPanda/Olivia/dht"
+	"testing"
+)
+
+func TestPartitionFiltersOnlyHoldTheirKeys(t *testing.T) {
+	cfg := stubConfig()
+	cfg.BloomfilterPartitions = 4
+	cache := NewCache(nil, cfg)
+
+	for i := 0; i < 20; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), "value")
+	}
+
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key%d", i)
+		owner := dht.PartitionOf(key, 4)
+
+		for partition := 0; partition < 4; partition++ {
+			bf, err := cache.GetPartitionBloomFilter(partition)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+
+			if found, _ := bf.HasKey([]byte(key)); found != (partition == owner) {
+				t.Fatalf(
+					"Expected %v in partition %d to be %v, got %v",
+					key,
+					partition,
+					partition == owner,
+					found,
+				)
+			}
+		}
+	}
+}
+
+func TestUnpartitionedCacheHasNoPartitionFilters(t *testing.T) {
+	cache := NewCache(nil, stubConfig())
+
+	if _, err := cache.GetPartitionBloomFilter(0); err == nil {
+		t.Fatalf("Expected an error, got nil")
+	}
+}
@@ -0,0 +1,266 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+)
+
+// forwardQueueSize bounds how many batches can wait to be forwarded when
+// AsyncReplication is on. Writes block once it's full.
+const forwardQueueSize = 1024
+
+// ErrNotOwner is returned by mutations of a key we don't own once keys are
+// placed on their owners, see mutateKey.
+var ErrNotOwner = errors.New("Key is owned by other nodes")
+
+// placedBatch is a batch of writes split between ourselves and the other
+// nodes owning its keys.
+type placedBatch struct {
+	entries     map[string]string
+	expirations map[string]int
+	// versions holds the version each write is made at, on every owner.
+	versions map[string]uint64
+	// local holds the entries we own, remote the entries each other owner
+	// is sent, by address.
+	local  map[string]string
+	remote map[string][]ReplicationEntry
+}
+
+// forwardQueue feeds asynchronously forwarded batches to a single goroutine,
+// so they reach owners in the order they were written.
+type forwardQueue struct {
+	batches chan placedBatch
+	once    sync.Once
+}
+
+// placing reports whether keys are placed on the nodes owning them, which
+// they are once a ReplicationFactor is configured.
+func (c *Cache) placing() bool {
+	return c.config.ReplicationFactor > 0 && c.PeerList != nil
+}
+
+// Owners returns the nodes owning `key` by ip:port, our own address included
+// if we're one of them. Without a ReplicationFactor a key has a single owner.
+func (c *Cache) Owners(key string) []string {
+	n := c.config.ReplicationFactor
+	if n <= 0 {
+		n = 1
+	}
+
+	return c.ring.Owners(key, n)
+}
+
+// owns reports whether we're one of `key`'s owners.
+func (c *Cache) owns(key string) bool {
+	for _, owner := range c.Owners(key) {
+		if owner == c.selfAddress {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mutateKey is withKey for the mutations which aren't placed like a Set, as
+// they depend on what the key holds, and only its owners hold that. While
+// placing, keys we don't own are refused with ErrNotOwner, so the mutation
+// has to be sent to one of the owners instead. Once `fn` has changed a key we
+// do own, the key's new state, its deletion included, is forwarded to its
+// other owners at its new version, the same way placeWrites forwards a
+// write.
+func (c *Cache) mutateKey(key string, fn func(shard *cacheShard) error) error {
+	if !c.placing() {
+		return c.withKey(key, fn)
+	}
+	if !c.owns(key) {
+		return ErrNotOwner
+	}
+
+	changed := false
+	var state ReplicationEntry
+	err := c.withKey(key, func(shard *cacheShard) error {
+		// Every change of a key gives it a new version, deletions
+		// included, so an unchanged version means there's nothing to
+		// forward.
+		version := shard.versions[key]
+		err := fn(shard)
+		if changed = shard.versions[key] != version; changed {
+			state = c.replicationState(shard, key)
+		}
+
+		return err
+	})
+
+	if changed {
+		c.forwardMutation(state)
+	}
+
+	return err
+}
+
+// forwardMutation forwards the state a mutation left a key we own in to the
+// key's other owners.
+func (c *Cache) forwardMutation(state ReplicationEntry) {
+	batch := placedBatch{
+		entries: map[string]string{state.Key: state.Value},
+		local:   map[string]string{state.Key: state.Value},
+		remote:  make(map[string][]ReplicationEntry),
+	}
+	for _, owner := range c.Owners(state.Key) {
+		if owner != c.selfAddress {
+			batch.remote[owner] = []ReplicationEntry{state}
+		}
+	}
+
+	if len(batch.remote) == 0 {
+		return
+	}
+	if c.config.AsyncReplication {
+		c.forwardLater(batch)
+		return
+	}
+
+	c.forward(context.Background(), batch)
+}
+
+// placeWrites writes a batch to the nodes owning its keys: to ourselves for
+// the keys we own, and to each other owner as a single replicated batch. Each
+// write gets a version, the same on every owner, so owners which see writes
+// of a key in different orders still agree on the last one.
+// Writes an owner fails to apply are retried from its retry queue, writes to
+// an owner which is down are kept as hints until it connects, and a key
+// which none of its owners took is written to us after all, so it isn't lost
+// and reads still find it through our bloom filter. With AsyncReplication,
+// the other owners are written to in the background once our own share is
+// written.
+func (c *Cache) placeWrites(ctx context.Context, entries map[string]string, expirations map[string]int) error {
+	if err := c.validateBatch(entries, expirations); err != nil {
+		return err
+	}
+
+	batch := c.placeBatch(entries, expirations)
+	if c.config.AsyncReplication {
+		if len(batch.remote) > 0 {
+			c.forwardLater(batch)
+		}
+		return c.msetLocal(batch.local, expirations, batch.versions)
+	}
+
+	local := batch.local
+	for key, value := range c.forward(ctx, batch) {
+		local[key] = value
+	}
+
+	return c.msetLocal(local, expirations, batch.versions)
+}
+
+// placeBatch splits a batch between its keys' owners.
+func (c *Cache) placeBatch(entries map[string]string, expirations map[string]int) placedBatch {
+	batch := placedBatch{
+		entries:     entries,
+		expirations: expirations,
+		versions:    make(map[string]uint64, len(entries)),
+		local:       make(map[string]string),
+		remote:      make(map[string][]ReplicationEntry),
+	}
+
+	for key, value := range entries {
+		batch.versions[key] = c.clock.next()
+
+		for _, owner := range c.Owners(key) {
+			if owner == c.selfAddress {
+				batch.local[key] = value
+				continue
+			}
+
+			batch.remote[owner] = append(batch.remote[owner], ReplicationEntry{
+				Key:        key,
+				Value:      value,
+				Expiration: expirations[key],
+				Version:    batch.versions[key],
+			})
+		}
+	}
+
+	return batch
+}
+
+// forward sends a batch to its keys' other owners, returning the entries
+// which none of their owners took.
+func (c *Cache) forward(ctx context.Context, batch placedBatch) map[string]string {
+	taken := make(map[string]bool, len(batch.entries))
+	for key := range batch.local {
+		taken[key] = true
+	}
+
+	for owner, entries := range batch.remote {
+		// An owner which is down is handed its writes once it's back.
+		// Until then they don't count as taken, so a key no owner took
+		// is still kept by us.
+		peer := c.findPeer(owner)
+		if (peer == nil || !peer.IsConnectable()) && c.storeHints(owner, entries) {
+			continue
+		}
+
+		acks, err := c.replicateWithRetry(ctx, peer, entries)
+		if err != nil {
+			log.Printf("Failed to forward %d writes to %v: %v", len(entries), owner, err)
+		}
+
+		for key, applied := range acks {
+			taken[key] = taken[key] || applied
+		}
+	}
+
+	untaken := make(map[string]string)
+	for key, value := range batch.entries {
+		if !taken[key] {
+			log.Printf("No owner of %v took it, keeping it ourselves", key)
+			untaken[key] = value
+		}
+	}
+
+	return untaken
+}
+
+// forwardLater queues a batch for the forwarding goroutine, starting it on
+// the first batch.
+func (c *Cache) forwardLater(batch placedBatch) {
+	c.forwarding.once.Do(func() {
+		c.forwarding.batches = make(chan placedBatch, forwardQueueSize)
+		c.runInBackground(c.forwardRepeatedly)
+	})
+
+	c.forwarding.batches <- batch
+}
+
+// forwardRepeatedly forwards queued batches until the cache is stopped, then
+// forwards whatever is still queued.
+func (c *Cache) forwardRepeatedly() {
+	for {
+		select {
+		case batch := <-c.forwarding.batches:
+			c.forwardLogged(batch)
+		case <-c.stopped:
+			for {
+				select {
+				case batch := <-c.forwarding.batches:
+					c.forwardLogged(batch)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// forwardLogged forwards a batch in the background, keeping the writes no
+// owner took.
+func (c *Cache) forwardLogged(batch placedBatch) {
+	untaken := c.forward(context.Background(), batch)
+	if err := c.msetLocal(untaken, batch.expirations, batch.versions); err != nil {
+		log.Printf("Failed to keep writes no owner took: %v", err)
+	}
+}
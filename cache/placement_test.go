@@ -0,0 +1,211 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+)
+
+func newPlacingCache(t *testing.T, replicationFactor int, stubs ...*stubPeer) *Cache {
+	cache := newCacheWithStubPeers(t, stubs...)
+	cache.config.ReplicationFactor = replicationFactor
+
+	return cache
+}
+
+func TestSetForwardsToOwner(t *testing.T) {
+	owner := newStubPeer(t, map[string]string{})
+	defer owner.Close()
+
+	cache := newPlacingCache(t, 1, owner)
+	remote := keyOwnedBy(t, cache, owner.Addr())
+	local := keyOwnedBy(t, cache, cache.selfAddress)
+
+	if err := cache.Set(remote, "remote"); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := cache.Set(local, "local"); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if value, ok := owner.Value(remote); !ok || value != "remote" {
+		t.Fatalf("Expected %v, got %v", "remote", value)
+	}
+	if _, ok := cache.readValue(remote); ok {
+		t.Fatalf("Expected a key we don't own not to be kept locally")
+	}
+
+	if _, ok := owner.Value(local); ok {
+		t.Fatalf("Expected a key we own not to be forwarded")
+	}
+	if value, ok := cache.readValue(local); !ok || value != "local" {
+		t.Fatalf("Expected %v, got %v", "local", value)
+	}
+}
+
+func TestGetReadsFromOwner(t *testing.T) {
+	owner := newStubPeer(t, map[string]string{})
+	defer owner.Close()
+
+	cache := newPlacingCache(t, 1, owner)
+	key := keyOwnedBy(t, cache, owner.Addr())
+	cache.Set(key, "placed")
+
+	if value, err := cache.Get(key); err != nil || value != "placed" {
+		t.Fatalf("Expected %v, got %v (%v)", "placed", value, err)
+	}
+	if owner.Gets() != 1 {
+		t.Fatalf("Expected %v, got %v", 1, owner.Gets())
+	}
+}
+
+func TestSetKeepsKeyWhenOwnerRefuses(t *testing.T) {
+	owner := newStubPeer(t, map[string]string{})
+	defer owner.Close()
+
+	cache := newPlacingCache(t, 1, owner)
+	key := keyOwnedBy(t, cache, owner.Addr())
+	cache.DisconnectPeer(owner.Addr())
+
+	if err := cache.Set(key, "kept"); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if value, err := cache.Get(key); err != nil || value != "kept" {
+		t.Fatalf("Expected %v, got %v (%v)", "kept", value, err)
+	}
+}
+
+func TestReplicationFactorWritesEveryOwner(t *testing.T) {
+	peer := newStubPeer(t, map[string]string{})
+	defer peer.Close()
+
+	cache := newPlacingCache(t, 2, peer)
+	entries := map[string]string{"a": "1", "b": "2", "c": "3"}
+	if err := cache.MSet(entries); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// With two nodes and two owners per key, both hold every key.
+	for key, expected := range entries {
+		if value, ok := cache.readValue(key); !ok || value != expected {
+			t.Fatalf("Expected %v locally, got %v", expected, value)
+		}
+		if value, ok := peer.Value(key); !ok || value != expected {
+			t.Fatalf("Expected %v on the peer, got %v", expected, value)
+		}
+	}
+}
+
+func TestApplyReplicationBatchDoesNotForward(t *testing.T) {
+	owner := newStubPeer(t, map[string]string{})
+	defer owner.Close()
+
+	cache := newPlacingCache(t, 1, owner)
+	key := keyOwnedBy(t, cache, owner.Addr())
+
+	cache.ApplyReplicationBatch([]ReplicationEntry{{Key: key, Value: "replicated"}})
+
+	if _, ok := owner.Value(key); ok {
+		t.Fatalf("Expected a replicated write not to be forwarded again")
+	}
+	if value, ok := cache.readValue(key); !ok || value != "replicated" {
+		t.Fatalf("Expected %v, got %v", "replicated", value)
+	}
+}
+
+func TestAsyncReplicationForwardsInOrder(t *testing.T) {
+	owner := newStubPeer(t, map[string]string{})
+	defer owner.Close()
+
+	cache := newPlacingCache(t, 1, owner)
+	cache.config.AsyncReplication = true
+	key := keyOwnedBy(t, cache, owner.Addr())
+
+	for i := 0; i < 50; i++ {
+		if err := cache.Set(key, fmt.Sprintf("value%d", i)); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+
+	// Stopping forwards whatever is still queued.
+	cache.Stop()
+
+	if value, ok := owner.Value(key); !ok || value != "value49" {
+		t.Fatalf("Expected %v, got %v", "value49", value)
+	}
+	if _, ok := cache.readValue(key); ok {
+		t.Fatalf("Expected a key we don't own not to be kept locally")
+	}
+}
+
+func TestAsyncReplicationKeepsKeyWhenOwnerRefuses(t *testing.T) {
+	owner := newStubPeer(t, map[string]string{})
+	defer owner.Close()
+
+	cache := newPlacingCache(t, 1, owner)
+	cache.config.AsyncReplication = true
+	key := keyOwnedBy(t, cache, owner.Addr())
+	cache.DisconnectPeer(owner.Addr())
+
+	cache.Set(key, "kept")
+	cache.Stop()
+
+	if value, ok := cache.readValue(key); !ok || value != "kept" {
+		t.Fatalf("Expected %v, got %v", "kept", value)
+	}
+}
+
+func TestMutationsOfKeysWeDontOwnAreRefused(t *testing.T) {
+	owner := newStubPeer(t, map[string]string{})
+	defer owner.Close()
+
+	cache := newPlacingCache(t, 1, owner)
+	key := keyOwnedBy(t, cache, owner.Addr())
+	if err := cache.Set(key, "1"); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if _, err := cache.Increment(key, 1); err != ErrNotOwner {
+		t.Fatalf("Expected %v, got %v", ErrNotOwner, err)
+	}
+	if err := cache.Delete(key); err != ErrNotOwner {
+		t.Fatalf("Expected %v, got %v", ErrNotOwner, err)
+	}
+
+	// Neither left a value of its own behind, so reads still find the
+	// owner's.
+	if _, ok := cache.readValue(key); ok {
+		t.Fatalf("Expected a key we don't own not to be kept locally")
+	}
+	if value, ok := owner.Value(key); !ok || value != "1" {
+		t.Fatalf("Expected %v, got %v", "1", value)
+	}
+	if value, err := cache.Get(key); err != nil || value != "1" {
+		t.Fatalf("Expected %v, got %v (%v)", "1", value, err)
+	}
+}
+
+func TestMutationsForwardToOtherOwners(t *testing.T) {
+	peer := newStubPeer(t, map[string]string{})
+	defer peer.Close()
+
+	// With two nodes and two owners per key, both own every key.
+	cache := newPlacingCache(t, 2, peer)
+	if err := cache.Set("counter", "1"); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if _, err := cache.Increment("counter", 1); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if value, ok := peer.Value("counter"); !ok || value != "2" {
+		t.Fatalf("Expected %v, got %v", "2", value)
+	}
+
+	if err := cache.Delete("counter"); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if value, ok := peer.Value("counter"); ok {
+		t.Fatalf("Expected the peer's copy to be deleted, got %v", value)
+	}
+}
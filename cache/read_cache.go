@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"sync/atomic"
+)
+
+// publish republishes the keys written since the shard was last published:
+// the shard's read copy is copied, updated and swapped in, so readers holding
+// the previous copy keep a consistent view. The caller must hold the shard's
+// lock or the cache lock exclusively, which keeps copies from being swapped
+// in out of order.
+func (s *cacheShard) publish() {
+	if len(s.written) == 0 {
+		return
+	}
+
+	old, _ := s.read.Load().(map[string]readEntry)
+	updated := make(map[string]readEntry, len(old)+len(s.written))
+	for k, v := range old {
+		updated[k] = v
+	}
+
+	for key := range s.written {
+		if value, ok := s.entries[key]; ok {
+			entry := readEntry{value: value}
+			if typed, ok := s.typed[key]; ok {
+				entry.kind = typed.kind
+			}
+			updated[key] = entry
+		} else {
+			delete(updated, key)
+		}
+	}
+
+	s.written = make(map[string]struct{})
+	s.read.Store(updated)
+}
+
+// readEntry is a key's entry in its shard's read copy. Keys holding lists
+// or hashes are only read with their own operations, which lock the shard, so
+// the read copy just records their kind.
+type readEntry struct {
+	value string
+	kind  ValueKind
+}
+
+// get reads `key` from the shard's read copy.
+func (s *cacheShard) get(key string) (string, bool) {
+	entry, ok := s.readEntry(key)
+
+	return entry.value, ok
+}
+
+// readEntry reads `key`'s entry from the shard's read copy.
+func (s *cacheShard) readEntry(key string) (readEntry, bool) {
+	read, _ := s.read.Load().(map[string]readEntry)
+	entry, ok := read[key]
+
+	return entry, ok
+}
+
+// publishShard republishes a single shard after a write to it. The caller
+// must hold the shard's lock.
+func (c *Cache) publishShard(shard *cacheShard) {
+	atomic.AddUint64(&c.counters.readCacheRebuilds, 1)
+	shard.publish()
+}
+
+// copyCache republishes every shard written to since it was last published.
+// Each write only recopies the shards it touched, rather than the whole
+// cache. The caller must hold the cache lock exclusively.
+func (c *Cache) copyCache() {
+	atomic.AddUint64(&c.counters.readCacheRebuilds, 1)
+
+	for _, shard := range c.shards {
+		shard.publish()
+	}
+}
@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPublishOnlyRecopiesWrittenShard(t *testing.T) {
+	cache := NewCache(nil, stubConfig())
+	for i := 0; i < 1000; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), "value")
+	}
+
+	written := shardIndex("key1")
+	before := make([]map[string]readEntry, cacheShards)
+	for i, shard := range cache.shards {
+		before[i], _ = shard.read.Load().(map[string]readEntry)
+	}
+
+	cache.Set("key1", "updated")
+
+	for i, shard := range cache.shards {
+		after, _ := shard.read.Load().(map[string]readEntry)
+		replaced := fmt.Sprintf("%p", after) != fmt.Sprintf("%p", before[i])
+		if replaced != (i == written) {
+			t.Fatalf("Expected only shard %d to be replaced, shard %d was replaced: %v", written, i, replaced)
+		}
+	}
+
+	if value, ok := cache.readValue("key1"); !ok || value != "updated" {
+		t.Fatalf("Expected %v, got %v", "updated", value)
+	}
+	if value := before[written]["key1"].value; value != "value" {
+		t.Fatalf("Expected the previous copy to stay unchanged, got %v", value)
+	}
+}
+
+func TestPublishDropsDeletedKeys(t *testing.T) {
+	cache := NewCache(nil, stubConfig())
+	cache.Set("key1", "value1")
+	cache.Set("key2", "value2")
+
+	if err := cache.Delete("key1"); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if _, ok := cache.readValue("key1"); ok {
+		t.Fatalf("Expected key1 to be gone from the read copy")
+	}
+	if value, ok := cache.readValue("key2"); !ok || value != "value2" {
+		t.Fatalf("Expected %v, got %v", "value2", value)
+	}
+}
@@ -0,0 +1,40 @@
+package cache
+
+import (
+	"fmt"
+	"github.com/GrappigPanda/Olivia/config"
+	"strings"
+)
+
+// ReadPreference decides where a Get reads a key from when the key is cached
+// locally but owned by another node.
+type ReadPreference int
+
+const (
+	// LocalFirst returns our own copy of a key if we have one. It's the
+	// fastest, but the copy may be stale.
+	LocalFirst ReadPreference = iota
+	// OwnerFirst always consults the key's owner on the hash ring, falling
+	// back to LocalFirst if the owner can't be reached.
+	OwnerFirst
+)
+
+// ParseReadPreference parses a configured read preference. Anything other
+// than "OWNER_FIRST" is LocalFirst.
+func ParseReadPreference(preference string) ReadPreference {
+	if strings.ToUpper(preference) == "OWNER_FIRST" {
+		return OwnerFirst
+	}
+
+	return LocalFirst
+}
+
+// selfAddress is the address identifying us on the hash ring, which is the
+// same address peers use for us.
+func selfAddress(config config.Cfg) string {
+	if config.AdvertiseAddress != "" {
+		return config.AdvertiseAddress
+	}
+
+	return fmt.Sprintf("127.0.0.1:%d", config.ListenPort)
+}
@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+)
+
+// keyOwnedBy finds a key which the cache's ring places on `owner`.
+func keyOwnedBy(t *testing.T, cache *Cache, owner string) string {
+	for i := 0; i < 10000; i++ {
+		key := fmt.Sprintf("key%d", i)
+		if cache.ring.Owner(key) == owner {
+			return key
+		}
+	}
+
+	t.Fatalf("No key is owned by %v", owner)
+	return ""
+}
+
+func TestReadPreferenceWithStaleLocalCopy(t *testing.T) {
+	owner := newStubPeer(t, map[string]string{})
+	defer owner.Close()
+
+	cache := newCacheWithStubPeers(t, owner)
+	key := keyOwnedBy(t, cache, owner.Addr())
+
+	owner.Lock()
+	owner.values[key] = "fresh"
+	owner.Unlock()
+	cache.Set(key, "stale")
+
+	if value, err := cache.GetWithPreference(key, LocalFirst); err != nil || value != "stale" {
+		t.Fatalf("Expected %v, got %v (%v)", "stale", value, err)
+	}
+	if owner.Gets() != 0 {
+		t.Fatalf("Expected a local-first read to not ask the owner")
+	}
+
+	if value, err := cache.GetWithPreference(key, OwnerFirst); err != nil || value != "fresh" {
+		t.Fatalf("Expected %v, got %v (%v)", "fresh", value, err)
+	}
+	if owner.Gets() != 1 {
+		t.Fatalf("Expected %v, got %v", 1, owner.Gets())
+	}
+}
+
+func TestOwnerFirstReadsLocallyWhenWeOwnTheKey(t *testing.T) {
+	peer := newStubPeer(t, map[string]string{})
+	defer peer.Close()
+
+	cache := newCacheWithStubPeers(t, peer)
+	key := keyOwnedBy(t, cache, cache.selfAddress)
+	cache.Set(key, "local")
+
+	if value, err := cache.GetWithPreference(key, OwnerFirst); err != nil || value != "local" {
+		t.Fatalf("Expected %v, got %v (%v)", "local", value, err)
+	}
+	if peer.Gets() != 0 {
+		t.Fatalf("Expected no remote reads, got %v", peer.Gets())
+	}
+}
+
+func TestOwnerFirstFallsBackWhenOwnerIsDown(t *testing.T) {
+	owner := newStubPeer(t, map[string]string{})
+	defer owner.Close()
+
+	cache := newCacheWithStubPeers(t, owner)
+	key := keyOwnedBy(t, cache, owner.Addr())
+	cache.Set(key, "local")
+	cache.DisconnectPeer(owner.Addr())
+
+	if value, err := cache.GetWithPreference(key, OwnerFirst); err != nil || value != "local" {
+		t.Fatalf("Expected %v, got %v (%v)", "local", value, err)
+	}
+}
+
+func TestParseReadPreference(t *testing.T) {
+	if ParseReadPreference("owner_first") != OwnerFirst {
+		t.Fatalf("Expected OWNER_FIRST to parse")
+	}
+
+	if ParseReadPreference("") != LocalFirst {
+		t.Fatalf("Expected local-first to be the default")
+	}
+}
+
+func TestGetWithSource(t *testing.T) {
+	peer := newStubPeer(t, map[string]string{"remotekey": "remote"})
+	defer peer.Close()
+
+	cache := newCacheWithStubPeers(t, peer)
+	cache.Set("localkey", "local")
+
+	if value, source, err := cache.GetWithSource("remotekey"); err != nil || value != "remote" || source != peer.Addr() {
+		t.Fatalf("Expected %v from %v, got %v from %v (%v)", "remote", peer.Addr(), value, source, err)
+	}
+
+	if value, source, err := cache.GetWithSource("localkey"); err != nil || value != "local" || source != "" {
+		t.Fatalf("Expected a local hit, got %v from %q (%v)", value, source, err)
+	}
+}
@@ -0,0 +1,179 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"github.com/GrappigPanda/Olivia/dht"
+	"log"
+	"strconv"
+)
+
+// readReplicas reads a key, along with its version, from every one of
+// `peers` at once. Peers which can't be reached, or don't answer before `ctx`
+// is done, are left out.
+func (c *Cache) readReplicas(ctx context.Context, key string, peers []*dht.Peer) []replicaValue {
+	results := make(chan *replicaValue, len(peers))
+
+	for _, peer := range peers {
+		go func(peer *dht.Peer) {
+			if peer == nil || !peer.IsConnectable() {
+				results <- nil
+				return
+			}
+
+			replica, err := c.readReplica(ctx, peer, key)
+			c.recordRemoteLookup(err == nil && !replica.found)
+			if err != nil {
+				log.Println(err)
+				results <- nil
+				return
+			}
+
+			results <- &replica
+		}(peer)
+	}
+
+	var replicas []replicaValue
+	for range peers {
+		if replica := <-results; replica != nil {
+			replicas = append(replicas, *replica)
+		}
+	}
+
+	return replicas
+}
+
+// readOwners reads a key from each of its owners, ourselves included.
+func (c *Cache) readOwners(ctx context.Context, key string, owners []string) []replicaValue {
+	var replicas []replicaValue
+	var peers []*dht.Peer
+
+	for _, owner := range owners {
+		if owner == c.selfAddress {
+			replica, err := c.localReplica(key)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			replicas = append(replicas, replica)
+			continue
+		}
+
+		peers = append(peers, c.findPeer(owner))
+	}
+
+	return append(replicas, c.readReplicas(ctx, key, peers)...)
+}
+
+// localReplica reads our own copy of a key, along with its version.
+func (c *Cache) localReplica(key string) (replicaValue, error) {
+	value, version, found, err := c.GetLocalVersioned(key)
+
+	return replicaValue{
+		replica: c.selfAddress,
+		value:   value,
+		version: version,
+		found:   found,
+	}, err
+}
+
+// readReplica reads a peer's own copy of a key, along with its version, with
+// a VGET. A copy without a version is unversioned.
+func (c *Cache) readReplica(ctx context.Context, peer *dht.Peer, key string) (replicaValue, error) {
+	replica := replicaValue{replica: peer.IPPort, peer: peer}
+
+	response, err := c.readRequest(ctx, peer, fmt.Sprintf("VGET %s", key))
+	if err != nil {
+		return replica, err
+	}
+
+	if replica.value, replica.found = response.Args[key]; !replica.found {
+		return replica, nil
+	}
+	if versionString, ok := response.Versions[key]; ok {
+		if replica.version, err = strconv.ParseUint(versionString, 10, 64); err != nil {
+			return replica, fmt.Errorf("%v sent a bad version of %v: %v", peer.IPPort, key, err)
+		}
+	}
+
+	return replica, nil
+}
+
+// readRepaired returns the authoritative value among `replicas` (see
+// authoritativeReplica) and where it was read from, and rewrites the replicas
+// holding a different value or version in the background. With
+// `repairMissing`, the replicas which don't hold the key at all are written
+// to as well, which is only right for replicas meant to hold it, such as its
+// owners.
+func (c *Cache) readRepaired(key string, replicas []replicaValue, repairMissing bool) (string, string, error) {
+	latest, ok := authoritativeReplica(replicas)
+	if !ok {
+		return "", "", fmt.Errorf("Key not found in cache")
+	}
+
+	var stale []replicaValue
+	for _, replica := range replicas {
+		if latest.holdsSameWrite(replica) {
+			continue
+		}
+		if replica.found || repairMissing {
+			stale = append(stale, replica)
+		}
+	}
+
+	if len(stale) > 0 {
+		go c.repairReplicas(key, latest, stale)
+	}
+
+	return latest.value, sourceOf(replicas, latest.value), nil
+}
+
+// sourceOf returns where `value` was read from among `replicas`: an empty
+// string if we hold it ourselves, and otherwise the first peer holding it.
+func sourceOf(replicas []replicaValue, value string) string {
+	source := ""
+	for _, replica := range replicas {
+		if !replica.found || replica.value != value {
+			continue
+		}
+		if replica.peer == nil {
+			return ""
+		}
+		if source == "" {
+			source = replica.replica
+		}
+	}
+
+	return source
+}
+
+// repairReplicas rewrites `key` with the `latest` write on each of
+// `replicas`, see repairReplica.
+func (c *Cache) repairReplicas(key string, latest replicaValue, replicas []replicaValue) {
+	for _, replica := range replicas {
+		err := c.repairReplica(key, latest, replica)
+
+		if err != nil {
+			log.Printf("Failed to repair %v on %v: %v", key, replica.replica, err)
+			continue
+		}
+		log.Printf("Repaired %v on %v", key, replica.replica)
+	}
+}
+
+// repairReplica writes the `latest` write of `key` to `replica` at the
+// latest write's own version, so a replica which has since seen a later
+// write skips it, like any other replicated write.
+func (c *Cache) repairReplica(key string, latest replicaValue, replica replicaValue) error {
+	entry := ReplicationEntry{Key: key, Value: latest.value, Version: latest.version}
+	if replica.peer == nil {
+		return c.applyReplicated(entry)
+	}
+
+	acks, err := c.ReplicateBatch(replica.peer, []ReplicationEntry{entry})
+	if err == nil && !acks[key] {
+		err = fmt.Errorf("Write was refused")
+	}
+
+	return err
+}
@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+// waitForValue waits for a stub to hold `expected` for a key.
+func waitForValue(t *testing.T, stub *stubPeer, key string, expected string) {
+	for attempt := 0; attempt < 100; attempt++ {
+		if value, ok := stub.Value(key); ok && value == expected {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	value, _ := stub.Value(key)
+	t.Fatalf("Expected %v on %v, got %v", expected, stub.Addr(), value)
+}
+
+func TestReadRepairRewritesDivergentOwners(t *testing.T) {
+	stale := newStubPeer(t, map[string]string{})
+	defer stale.Close()
+	owner := newStubPeer(t, map[string]string{})
+	defer owner.Close()
+
+	cache := newPlacingCache(t, 3, stale, owner)
+	cache.config.ReadRepair = true
+	key := keyOwnedBy(t, cache, owner.Addr())
+
+	stale.Lock()
+	stale.values[key] = "old"
+	stale.versions[key] = "1"
+	stale.Unlock()
+	owner.Lock()
+	owner.values[key] = "new"
+	owner.versions[key] = "2"
+	owner.Unlock()
+
+	value, source, err := cache.GetWithSource(key)
+	if err != nil || value != "new" || source != owner.Addr() {
+		t.Fatalf("Expected %v from %v, got %v from %v (%v)", "new", owner.Addr(), value, source, err)
+	}
+
+	waitForValue(t, stale, key, "new")
+	if version := stale.Version(key); version != "2" {
+		t.Fatalf("Expected the repair at version %v, got %v", "2", version)
+	}
+
+	// We own the key as well, so our missing copy is written too.
+	for attempt := 0; ; attempt++ {
+		if local, ok := cache.readValue(key); ok && local == "new" {
+			break
+		}
+		if attempt == 100 {
+			t.Fatalf("Expected our own copy to be repaired")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReadRepairOfBloomFilterCandidates(t *testing.T) {
+	first := newStubPeer(t, map[string]string{"divergent": "new"})
+	defer first.Close()
+	second := newStubPeer(t, map[string]string{"divergent": "old", "other": "x"})
+	defer second.Close()
+
+	// The later write wins, though its value orders first.
+	first.Lock()
+	first.versions["divergent"] = "2"
+	first.Unlock()
+	second.Lock()
+	second.versions["divergent"] = "1"
+	second.Unlock()
+
+	cache := newCacheWithStubPeers(t, first, second)
+	cache.config.ReadRepair = true
+	expected := "new"
+
+	if value, err := cache.Get("divergent"); err != nil || value != expected {
+		t.Fatalf("Expected %v, got %v (%v)", expected, value, err)
+	}
+
+	waitForValue(t, first, "divergent", expected)
+	waitForValue(t, second, "divergent", expected)
+
+	// Candidates which turn out not to hold a key aren't given it.
+	if value, err := cache.Get("other"); err != nil || value != "x" {
+		t.Fatalf("Expected %v, got %v (%v)", "x", value, err)
+	}
+	if _, ok := first.Value("other"); ok {
+		t.Fatalf("Expected a bloom filter false positive not to be repaired")
+	}
+}
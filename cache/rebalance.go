@@ -0,0 +1,246 @@
+package cache
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// rebalancer moves the keys we no longer own to their owners in the
+// background whenever the hash ring changes.
+type rebalancer struct {
+	// pending wakes the rebalancing goroutine, coalescing ring changes
+	// which happen while it's busy.
+	pending chan struct{}
+	once    sync.Once
+	// incomplete is set while keys are left behind because one of their
+	// owners couldn't be reached, for the next peer connecting to retry
+	// them.
+	incomplete int32
+}
+
+// ringChanged schedules a rebalance, starting the rebalancing goroutine on
+// the first one. It does nothing unless keys are placed on their owners.
+func (c *Cache) ringChanged() {
+	if !c.placing() {
+		return
+	}
+
+	c.rebalancing.once.Do(func() {
+		c.rebalancing.pending = make(chan struct{}, 1)
+		c.runInBackground(c.rebalanceRepeatedly)
+	})
+
+	select {
+	case c.rebalancing.pending <- struct{}{}:
+	default:
+	}
+}
+
+// retryRebalance schedules a rebalance if the last one left keys behind.
+func (c *Cache) retryRebalance() {
+	if atomic.LoadInt32(&c.rebalancing.incomplete) == 1 {
+		c.ringChanged()
+	}
+}
+
+// rebalanceRepeatedly rebalances every time the ring changes until the
+// cache is stopped.
+func (c *Cache) rebalanceRepeatedly() {
+	for {
+		select {
+		case <-c.rebalancing.pending:
+			c.Rebalance()
+		case <-c.stopped:
+			return
+		}
+	}
+}
+
+// Rebalance streams the keys we hold but no longer own to the nodes owning
+// them, then deletes them here, returning how many were moved. A key is only
+// deleted once every one of its owners acked it, and only if it wasn't
+// written again in the meantime; the rest are kept and retried once another
+// peer connects or the ring changes again.
+//
+// Keys are sent RebalanceBatchSize at a time, pausing RebalanceBatchDelayMillis
+// between batches so moving a large keyspace doesn't saturate the network.
+func (c *Cache) Rebalance() int {
+	keys := c.misplacedKeys()
+	if len(keys) == 0 {
+		atomic.StoreInt32(&c.rebalancing.incomplete, 0)
+		return 0
+	}
+
+	log.Printf("Rebalancing %d keys we no longer own", len(keys))
+
+	batchSize := c.config.RebalanceBatchSize
+	if batchSize <= 0 {
+		batchSize = len(keys)
+	}
+	delay := time.Duration(c.config.RebalanceBatchDelayMillis) * time.Millisecond
+
+	moved, kept := 0, 0
+	for start := 0; start < len(keys); start += batchSize {
+		if start > 0 && delay > 0 {
+			select {
+			case <-time.After(delay):
+			case <-c.stopped:
+				atomic.StoreInt32(&c.rebalancing.incomplete, 1)
+				return moved
+			}
+		}
+
+		end := start + batchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		batchMoved, batchKept := c.moveKeys(keys[start:end])
+		moved += batchMoved
+		kept += batchKept
+	}
+
+	if kept > 0 {
+		log.Printf("Kept %d keys whose owners couldn't take them", kept)
+		atomic.StoreInt32(&c.rebalancing.incomplete, 1)
+	} else {
+		atomic.StoreInt32(&c.rebalancing.incomplete, 0)
+	}
+	log.Printf("Moved %d keys to their owners", moved)
+
+	return moved
+}
+
+// misplacedKeys returns the keys we hold which the ring places elsewhere.
+func (c *Cache) misplacedKeys() []string {
+	c.Lock()
+	defer c.Unlock()
+
+	var keys []string
+	c.forEachEntry(func(key string, _ string) {
+		if !c.ownsKey(key) {
+			keys = append(keys, key)
+		}
+	})
+
+	return keys
+}
+
+// ownsKey reports whether we're one of `key`'s owners.
+func (c *Cache) ownsKey(key string) bool {
+	for _, owner := range c.Owners(key) {
+		if owner == c.selfAddress {
+			return true
+		}
+	}
+
+	return false
+}
+
+// moveKeys sends a batch of misplaced keys to their owners and deletes the
+// ones every owner acked, returning how many were moved and how many kept.
+func (c *Cache) moveKeys(keys []string) (int, int) {
+	entries := make(map[string]ReplicationEntry, len(keys))
+	byOwner := make(map[string][]ReplicationEntry)
+	for _, key := range keys {
+		// The ring may have changed again since the keys were picked.
+		if c.ownsKey(key) {
+			continue
+		}
+
+		entry, ok := c.replicationEntry(key)
+		if !ok {
+			continue
+		}
+		entries[key] = entry
+
+		for _, owner := range c.Owners(key) {
+			byOwner[owner] = append(byOwner[owner], outgoing(entry))
+		}
+	}
+
+	taken := make(map[string]bool, len(entries))
+	for key := range entries {
+		taken[key] = true
+	}
+
+	for owner, ownerEntries := range byOwner {
+		acks, err := c.ReplicateBatch(c.findPeer(owner), ownerEntries)
+		if err != nil {
+			log.Printf("Failed to move %d keys to %v: %v", len(ownerEntries), owner, err)
+		}
+
+		for _, entry := range ownerEntries {
+			taken[entry.Key] = taken[entry.Key] && acks[entry.Key]
+		}
+	}
+
+	moved, kept := 0, 0
+	for key, entry := range entries {
+		if !taken[key] {
+			kept++
+			continue
+		}
+
+		if c.dropMoved(key, entry) {
+			moved++
+		}
+	}
+
+	return moved, kept
+}
+
+// replicationEntry reads `key` along with its version and what's left of its
+// TTL, see replicationState. Keys which are gone, or past their expiration,
+// aren't sent.
+func (c *Cache) replicationEntry(key string) (ReplicationEntry, bool) {
+	var entry ReplicationEntry
+	expired := false
+	c.readKey(key, func(shard *cacheShard) {
+		entry = c.replicationState(shard, key)
+		expired = c.leaseExpired(shard, key)
+	})
+
+	return entry, !entry.Deleted && !expired
+}
+
+// outgoing returns an entry as it's sent to the node it's moved to. Keys
+// restored from disk have no version, so they're sent at the lowest one, for
+// any value the node already holds to win.
+func outgoing(entry ReplicationEntry) ReplicationEntry {
+	if entry.Version == 0 {
+		entry.Version = 1
+	}
+
+	return entry
+}
+
+// dropMoved deletes a key the nodes it was moved to took, unless it was
+// written since it was read, reporting whether it was deleted. No tombstone
+// is left, as the key lives on elsewhere.
+func (c *Cache) dropMoved(key string, read ReplicationEntry) bool {
+	dropped := false
+	err := c.withKey(key, func(shard *cacheShard) error {
+		state := c.replicationState(shard, key)
+		if state.Deleted || state.Value != read.Value || state.Kind != read.Kind ||
+			state.Version != read.Version {
+			return nil
+		}
+
+		if err := c.logWrite(walRecord{Op: walDelete, Key: key}); err != nil {
+			return err
+		}
+		c.deleteEntry(shard, key)
+		c.publishShard(shard)
+		dropped = true
+
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to drop %v after moving it: %v", key, err)
+	}
+
+	return dropped
+}
@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRebalanceMovesKeysWeNoLongerOwn(t *testing.T) {
+	owner := newStubPeer(t, map[string]string{})
+	defer owner.Close()
+
+	cache := newPlacingCache(t, 1, owner)
+	remote := keyOwnedBy(t, cache, owner.Addr())
+	local := keyOwnedBy(t, cache, cache.selfAddress)
+
+	// Written before the ring placed them elsewhere.
+	cache.setLocal(remote, "remote")
+	cache.setLocal(local, "local")
+
+	if moved := cache.Rebalance(); moved != 1 {
+		t.Fatalf("Expected %v, got %v", 1, moved)
+	}
+
+	if value, ok := owner.Value(remote); !ok || value != "remote" {
+		t.Fatalf("Expected %v, got %v", "remote", value)
+	}
+	if _, ok := cache.readValue(remote); ok {
+		t.Fatalf("Expected %v to be deleted once moved", remote)
+	}
+	if value, ok := cache.readValue(local); !ok || value != "local" {
+		t.Fatalf("Expected %v, got %v", "local", value)
+	}
+}
+
+func TestRebalanceKeepsKeysOwnersRefuse(t *testing.T) {
+	owner := newStubPeer(t, map[string]string{})
+	defer owner.Close()
+
+	cache := newPlacingCache(t, 1, owner)
+	remote := keyOwnedBy(t, cache, owner.Addr())
+	cache.setLocal(remote, "remote")
+
+	owner.FailReplicates(1)
+	if moved := cache.Rebalance(); moved != 0 {
+		t.Fatalf("Expected %v, got %v", 0, moved)
+	}
+	if value, ok := cache.readValue(remote); !ok || value != "remote" {
+		t.Fatalf("Expected %v, got %v", "remote", value)
+	}
+
+	if moved := cache.Rebalance(); moved != 1 {
+		t.Fatalf("Expected %v, got %v", 1, moved)
+	}
+}
+
+func TestRebalanceInBatches(t *testing.T) {
+	owner := newStubPeer(t, map[string]string{})
+	defer owner.Close()
+
+	cache := newPlacingCache(t, 1, owner)
+	cache.config.RebalanceBatchSize = 2
+	cache.config.RebalanceBatchDelayMillis = 1
+
+	var keys []string
+	for i := 0; len(keys) < 5; i++ {
+		key := fmt.Sprintf("key%d", i)
+		if cache.ring.Owner(key) == owner.Addr() {
+			keys = append(keys, key)
+			cache.setLocal(key, key)
+		}
+	}
+
+	if moved := cache.Rebalance(); moved != len(keys) {
+		t.Fatalf("Expected %v, got %v", len(keys), moved)
+	}
+	for _, key := range keys {
+		if value, ok := owner.Value(key); !ok || value != key {
+			t.Fatalf("Expected %v, got %v", key, value)
+		}
+	}
+}
+
+func TestJoiningPeerTakesItsKeys(t *testing.T) {
+	joining := newStubPeer(t, map[string]string{})
+	defer joining.Close()
+
+	cache := newPlacingCache(t, 1)
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key%d", i)
+		if err := cache.Set(key, key); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+
+	cache.AddPeer(joining.Addr())
+
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key%d", i)
+		if cache.ring.Owner(key) != joining.Addr() {
+			if _, ok := cache.readValue(key); !ok {
+				t.Fatalf("Expected %v to be kept", key)
+			}
+			continue
+		}
+
+		waitForValue(t, joining, key, key)
+		for attempt := 0; ; attempt++ {
+			if _, ok := cache.readValue(key); !ok {
+				break
+			}
+			if attempt == 100 {
+				t.Fatalf("Expected %v to be deleted once moved", key)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
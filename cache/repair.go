@@ -0,0 +1,113 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"github.com/GrappigPanda/Olivia/dht"
+)
+
+// RepairSummary reports what RepairKey found and fixed.
+type RepairSummary struct {
+	Key string
+	// Value is the authoritative value every replica was brought in line
+	// with.
+	Value string
+	// Repaired holds the replicas (by ip:port) which were stale or missing
+	// the key and were rewritten.
+	Repaired []string
+	// Unreachable holds the replicas which couldn't be read from or written
+	// to, and so may still be stale.
+	Unreachable []string
+}
+
+// replicaValue is a single replica's copy of a key, along with the version
+// it was written at.
+type replicaValue struct {
+	replica string
+	peer    *dht.Peer
+	value   string
+	version uint64
+	found   bool
+}
+
+// holdsSameWrite reports whether `other` holds the same write of the key as
+// this copy, both its value and its version.
+func (r replicaValue) holdsSameWrite(other replicaValue) bool {
+	return other.found && other.value == r.value && other.version == r.version
+}
+
+// RepairKey reads a key, along with its version, from ourselves and every
+// peer, decides on the authoritative write (see authoritativeReplica), and
+// writes it at its own version to every replica that's stale or missing the
+// key.
+func (c *Cache) RepairKey(key string) (RepairSummary, error) {
+	summary := RepairSummary{Key: key}
+
+	local, err := c.localReplica(key)
+	if err != nil {
+		return summary, err
+	}
+	replicas := []replicaValue{local}
+
+	if c.PeerList != nil {
+		for _, peer := range c.PeerList.GetPeers() {
+			if peer == nil {
+				continue
+			}
+
+			if !peer.IsConnectable() {
+				summary.Unreachable = append(summary.Unreachable, peer.IPPort)
+				continue
+			}
+
+			replica, err := c.readReplica(context.Background(), peer, key)
+			if err != nil {
+				summary.Unreachable = append(summary.Unreachable, peer.IPPort)
+				continue
+			}
+
+			replicas = append(replicas, replica)
+		}
+	}
+
+	latest, ok := authoritativeReplica(replicas)
+	if !ok {
+		return summary, fmt.Errorf("No replica holds %v", key)
+	}
+	summary.Value = latest.value
+
+	for _, replica := range replicas {
+		if latest.holdsSameWrite(replica) {
+			continue
+		}
+
+		if err := c.repairReplica(key, latest, replica); err != nil {
+			if replica.peer == nil {
+				return summary, err
+			}
+			summary.Unreachable = append(summary.Unreachable, replica.replica)
+			continue
+		}
+		summary.Repaired = append(summary.Repaired, replica.replica)
+	}
+
+	return summary, nil
+}
+
+// authoritativeReplica picks the copy replicas should converge on: the latest
+// write, ties between versions broken by value like any other write (see
+// supersedes), so every coordinator picks the same one.
+func authoritativeReplica(replicas []replicaValue) (replicaValue, bool) {
+	var latest replicaValue
+	for _, replica := range replicas {
+		if !replica.found {
+			continue
+		}
+
+		if !latest.found || supersedes(replica.version, replica.value, latest.version, latest.value) {
+			latest = replica
+		}
+	}
+
+	return latest, latest.found
+}
@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRepairKeyConvergesReplicas(t *testing.T) {
+	owner := newStubPeer(t, map[string]string{})
+	defer owner.Close()
+	latest := newStubPeer(t, map[string]string{})
+	defer latest.Close()
+	missing := newStubPeer(t, map[string]string{})
+	defer missing.Close()
+
+	cache := newCacheWithStubPeers(t, owner, latest, missing)
+	key := keyOwnedBy(t, cache, owner.Addr())
+
+	cache.Set(key, "older")
+	version, _ := cache.Version(key)
+	latestVersion := fmt.Sprint(version + 1)
+
+	// The owner's copy is no more authoritative than any other, so the
+	// latest write wins.
+	owner.Lock()
+	owner.values[key] = "older"
+	owner.versions[key] = fmt.Sprint(version)
+	owner.Unlock()
+	latest.Lock()
+	latest.values[key] = "latest"
+	latest.versions[key] = latestVersion
+	latest.Unlock()
+
+	summary, err := cache.RepairKey(key)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if summary.Value != "latest" {
+		t.Fatalf("Expected %v, got %v", "latest", summary.Value)
+	}
+	if len(summary.Repaired) != 3 || len(summary.Unreachable) != 0 {
+		t.Fatalf("Expected 3 repairs, got %v (unreachable: %v)", summary.Repaired, summary.Unreachable)
+	}
+
+	for _, stub := range []*stubPeer{owner, latest, missing} {
+		if value, _ := stub.Value(key); value != "latest" {
+			t.Fatalf("Expected %v on %v, got %v", "latest", stub.Addr(), value)
+		}
+		if stubVersion := stub.Version(key); stubVersion != latestVersion {
+			t.Fatalf("Expected version %v on %v, got %v", latestVersion, stub.Addr(), stubVersion)
+		}
+	}
+
+	local, localVersion, _, err := cache.GetLocalVersioned(key)
+	if err != nil || local != "latest" || fmt.Sprint(localVersion) != latestVersion {
+		t.Fatalf("Expected %v at %v locally, got %v at %v (%v)", "latest", latestVersion, local, localVersion, err)
+	}
+}
+
+func TestAuthoritativeReplicaIsTheLatestWrite(t *testing.T) {
+	replicas := []replicaValue{
+		{replica: "owner"},
+		{replica: "a", value: "v1", version: 2, found: true},
+		{replica: "b", value: "v3", version: 1, found: true},
+		{replica: "c", value: "v2", version: 2, found: true},
+	}
+
+	// Writes at the same version are ordered by value, like any other.
+	if latest, ok := authoritativeReplica(replicas); !ok || latest.value != "v2" {
+		t.Fatalf("Expected %v, got %v", "v2", latest.value)
+	}
+
+	if _, ok := authoritativeReplica(replicas[:1]); ok {
+		t.Fatalf("Expected no authoritative replica when nobody holds the key")
+	}
+}
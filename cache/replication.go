@@ -0,0 +1,337 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"github.com/GrappigPanda/Olivia/dht"
+	"github.com/GrappigPanda/Olivia/parser"
+	"math"
+	"strings"
+	"time"
+)
+
+// replicationTimeout is how long a coordinator waits on a replica's batched
+// ack before giving up on the whole batch.
+var replicationTimeout = 5 * time.Second
+
+// ReplicationEntry is a single write shipped to a replica as part of a batch.
+type ReplicationEntry struct {
+	Key   string
+	Value string
+	// Expiration is the TTL in seconds. Zero means the key never expires,
+	// and a negative one that any expiration it has is removed as well.
+	Expiration int
+	// Version orders the write against others of the key, see
+	// lamportClock. Zero means the write is unversioned, and always
+	// applied.
+	Version uint64
+	// Deleted makes the write a deletion of the key, leaving a tombstone
+	// at its version.
+	Deleted bool
+	// Kind is the type of value the write stores, Value holding it
+	// encoded when it isn't a string.
+	Kind ValueKind
+}
+
+// replicateCommands are the commands replicating each type of value, which
+// ReplicatedKind maps back.
+var replicateCommands = map[ValueKind]string{
+	KindString: "REPLICATE",
+	KindList:   "REPLICATELIST",
+	KindHash:   "REPLICATEHASH",
+}
+
+// ReplicatedKind returns the type of value a replication command, e.g.
+// REPLICATELIST, replicates, and whether it's one at all.
+func ReplicatedKind(command string) (ValueKind, bool) {
+	for kind, replicateCommand := range replicateCommands {
+		if replicateCommand == command {
+			return kind, true
+		}
+	}
+
+	return KindString, false
+}
+
+// ReplicationAck is a replica's answer for a single entry of a batch. A nil
+// Err means the write was applied.
+type ReplicationAck struct {
+	Key string
+	Err error
+}
+
+// ApplyReplicationBatch applies every entry of a replicated batch and reports
+// back per entry. One entry failing doesn't stop the rest of the batch from
+// being applied. A versioned entry older than the value we hold is skipped,
+// but acked all the same, as we're already past it.
+func (c *Cache) ApplyReplicationBatch(entries []ReplicationEntry) []ReplicationAck {
+	acks := make([]ReplicationAck, len(entries))
+
+	for i, entry := range entries {
+		acks[i] = ReplicationAck{entry.Key, c.applyReplicated(entry)}
+	}
+
+	return acks
+}
+
+// applyReplicated applies a single replicated write. The sender already
+// placed it, so it's only applied here rather than forwarded again.
+func (c *Cache) applyReplicated(entry ReplicationEntry) error {
+	if entry.Deleted {
+		return c.withKey(entry.Key, func(shard *cacheShard) error {
+			if c.stale(shard, entry.Key, "", entry.Version) {
+				return nil
+			}
+
+			err := c.removeEntry(shard, entry.Key, entry.Version)
+			c.publishShard(shard)
+
+			return err
+		})
+	}
+
+	var typed *typedValue
+	if entry.Kind == KindString {
+		if err := c.validateValue(entry.Value); err != nil {
+			return err
+		}
+	} else {
+		var err error
+		if typed, err = decodeTypedValue(entry.Kind, entry.Value); err != nil {
+			return err
+		}
+		if err := c.validateTyped(typed, 0); err != nil {
+			return err
+		}
+	}
+	timeout := c.clampTTL(entry.Key, entry.Expiration)
+
+	return c.withKey(entry.Key, func(shard *cacheShard) error {
+		if c.stale(shard, entry.Key, entry.Value, entry.Version) {
+			return nil
+		}
+
+		var err error
+		if typed != nil {
+			err = c.replaceTyped(shard, entry, typed)
+		} else {
+			var written bool
+			written, err = c.setVersioned(shard, entry.Key, entry.Value, entry.Version)
+			if written {
+				c.publishShard(shard)
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case entry.Expiration > 0:
+			return c.expire(shard, entry.Key, timeout)
+		case entry.Expiration < 0:
+			_, err = c.persist(shard, entry.Key)
+		}
+
+		return err
+	})
+}
+
+// replaceTyped stores the whole list or hash a replicated `entry` holds,
+// decoded as `value`. The caller must hold the lock of the key's shard.
+func (c *Cache) replaceTyped(shard *cacheShard, entry ReplicationEntry, value *typedValue) error {
+	record := walRecord{Op: walSet, Key: entry.Key, Value: entry.Value, Kind: entry.Kind}
+	if err := c.logWrite(record); err != nil {
+		return err
+	}
+
+	version := entry.Version
+	if version == 0 {
+		version = c.clock.next()
+	}
+
+	c.storeTyped(shard, entry.Key, value)
+	c.typedWritten(shard, entry.Key, 0, version)
+	c.publishShard(shard)
+
+	return nil
+}
+
+// replicationState returns the state of `key` as a write which brings another
+// owner in line with it: its value at its version along with whatever is left
+// of its TTL, or its deletion if we don't hold it. The caller must hold the
+// lock of the key's shard.
+func (c *Cache) replicationState(shard *cacheShard, key string) ReplicationEntry {
+	state := ReplicationEntry{Key: key, Version: shard.versions[key]}
+
+	value, ok := shard.entries[key]
+	if !ok {
+		state.Deleted = true
+		return state
+	}
+	state.Value = value
+	if typed, ok := shard.typed[key]; ok {
+		state.Kind = typed.kind
+		state.Value = typed.encode()
+	}
+
+	node, expires := shard.expirations.Get(key)
+	if !expires {
+		state.Expiration = -1
+		return state
+	}
+
+	// A key about to expire still expires on the other owners, rather
+	// than being kept for good.
+	state.Expiration = int(math.Ceil(time.Until(node.Timeout).Seconds()))
+	if state.Expiration < 1 {
+		state.Expiration = 1
+	}
+
+	return state
+}
+
+// FormatReplicationAck turns a batch of acks into the `key:OK`/`key:ERR`
+// arguments sent back to the coordinator.
+func FormatReplicationAck(acks []ReplicationAck) []string {
+	retVals := make([]string, len(acks))
+
+	for i, ack := range acks {
+		if ack.Err != nil {
+			retVals[i] = fmt.Sprintf("%s:ERR", ack.Key)
+		} else {
+			retVals[i] = fmt.Sprintf("%s:OK", ack.Key)
+		}
+	}
+
+	return retVals
+}
+
+// ReplicateBatch sends a batch of writes to a replica in a single request and
+// waits for the replica's batched ack. The returned map holds, per key,
+// whether the replica applied the write. Writes of each type of value and
+// deletions are sent in requests of their own, so if one of them fails, the
+// acks of those before it are returned along with the error.
+func (c *Cache) ReplicateBatch(peer *dht.Peer, entries []ReplicationEntry) (map[string]bool, error) {
+	return c.ReplicateBatchContext(context.Background(), peer, entries)
+}
+
+// ReplicateBatchContext is ReplicateBatch, giving up waiting on the ack once
+// `ctx` is done.
+func (c *Cache) ReplicateBatchContext(ctx context.Context, peer *dht.Peer, entries []ReplicationEntry) (map[string]bool, error) {
+	if peer == nil || peer.GetStatus() != dht.Connected {
+		return nil, fmt.Errorf("Peer is not connected")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, replicationTimeout)
+	defer cancel()
+
+	// Deletions are sent on their own, as tombstones, and writes in a
+	// command per type of value.
+	writes := make(map[ValueKind][]ReplicationEntry)
+	var deletions []ReplicationEntry
+	for _, entry := range entries {
+		if entry.Deleted {
+			deletions = append(deletions, entry)
+		} else {
+			writes[entry.Kind] = append(writes[entry.Kind], entry)
+		}
+	}
+
+	acks := make(map[string]bool)
+	for kind := KindString; int(kind) < len(replicateCommands); kind++ {
+		if len(writes[kind]) == 0 {
+			continue
+		}
+
+		response, err := peer.Request(ctx, encodeReplicationBatch(writes[kind]))
+		if err != nil {
+			return acks, err
+		}
+		replicated, err := parseReplicationAck(response, "REPLICATED")
+		if err != nil {
+			return acks, err
+		}
+
+		for key, applied := range replicated {
+			acks[key] = applied
+		}
+	}
+
+	if len(deletions) > 0 {
+		response, err := peer.Request(ctx, encodeTombstoneBatch(deletions))
+		if err != nil {
+			return acks, err
+		}
+		tombstoned, err := parseReplicationAck(response, "TOMBSTONED")
+		if err != nil {
+			return acks, err
+		}
+
+		for key, applied := range tombstoned {
+			acks[key] = applied
+		}
+	}
+
+	return acks, nil
+}
+
+// encodeReplicationBatch builds a REPLICATE command of
+// `key:value[:expiration[:version]]` arguments, or the command replicating
+// the entries' type of value, which they must all share. Values which aren't
+// safe to send as text are framed, so any value replicates intact.
+func encodeReplicationBatch(entries []ReplicationEntry) string {
+	args := make([]string, len(entries))
+	var payloads []string
+
+	for i, entry := range entries {
+		token, payload, framed := parser.FrameValue(entry.Value)
+		if framed {
+			payloads = append(payloads, payload)
+		}
+
+		if entry.Version > 0 {
+			args[i] = fmt.Sprintf("%s:%s:%d:%d", entry.Key, token, entry.Expiration, entry.Version)
+		} else if entry.Expiration > 0 {
+			args[i] = fmt.Sprintf("%s:%s:%d", entry.Key, token, entry.Expiration)
+		} else {
+			args[i] = fmt.Sprintf("%s:%s", entry.Key, token)
+		}
+	}
+
+	return parser.FrameCommand(
+		fmt.Sprintf("%s %s", replicateCommands[entries[0].Kind], strings.Join(args, ",")),
+		payloads,
+	)
+}
+
+// encodeTombstoneBatch builds a TOMBSTONE command of `key:version` arguments,
+// deleting each key at its version.
+func encodeTombstoneBatch(entries []ReplicationEntry) string {
+	args := make([]string, len(entries))
+	for i, entry := range entries {
+		args[i] = fmt.Sprintf("%s:%d", entry.Key, entry.Version)
+	}
+
+	return fmt.Sprintf("TOMBSTONE %s", strings.Join(args, ","))
+}
+
+// parseReplicationAck parses a `<verb> key:OK,key:ERR` response, e.g. the
+// `REPLICATED` one answering a REPLICATE, REPLICATELIST or REPLICATEHASH.
+func parseReplicationAck(response string, verb string) (map[string]bool, error) {
+	splitResponse := strings.SplitN(strings.TrimSpace(response), " ", 2)
+	if len(splitResponse) != 2 || splitResponse[0] != verb {
+		return nil, fmt.Errorf("Invalid replication ack: %v", response)
+	}
+
+	acks := make(map[string]bool)
+	for _, ack := range strings.Split(splitResponse[1], ",") {
+		keyStatus := strings.Split(ack, ":")
+		if len(keyStatus) != 2 {
+			return nil, fmt.Errorf("Invalid replication ack: %v", response)
+		}
+
+		acks[keyStatus[0]] = keyStatus[1] == "OK"
+	}
+
+	return acks, nil
+}
@@ -0,0 +1,151 @@
+package cache
+
+import (
+	"github.com/GrappigPanda/Olivia/config"
+	"github.com/GrappigPanda/Olivia/parser"
+	"strings"
+	"testing"
+)
+
+func TestApplyReplicationBatchPartialFailure(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{IsTesting: true, MaxValueBytes: 8})
+
+	entries := []ReplicationEntry{
+		{"key1", "value1", 0, 0, false, KindString},
+		{"key2", strings.Repeat("x", 9), 0, 0, false, KindString},
+		{"key3", "value3", 30, 0, false, KindString},
+	}
+
+	acks := cache.ApplyReplicationBatch(entries)
+	if len(acks) != len(entries) {
+		t.Fatalf("Expected %v acks, got %v", len(entries), len(acks))
+	}
+
+	for _, ack := range acks {
+		if ack.Key == "key2" && ack.Err != ErrValueTooLarge {
+			t.Errorf("Expected key2 to fail with ErrValueTooLarge, got %v", ack.Err)
+		} else if ack.Key != "key2" && ack.Err != nil {
+			t.Errorf("Expected %v to succeed, got %v", ack.Key, ack.Err)
+		}
+	}
+
+	if _, err := cache.Get("key2"); err == nil {
+		t.Errorf("Expected the oversize entry to not be written")
+	}
+
+	for _, key := range []string{"key1", "key3"} {
+		if _, err := cache.Get(key); err != nil {
+			t.Errorf("Expected %v to be written, got %v", key, err)
+		}
+	}
+}
+
+func TestReplicationAckRoundTrip(t *testing.T) {
+	acks := []ReplicationAck{
+		{"key1", nil},
+		{"key2", ErrValueTooLarge},
+	}
+
+	response := "REPLICATED " + strings.Join(FormatReplicationAck(acks), ",")
+
+	parsed, err := parseReplicationAck(response, "REPLICATED")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !parsed["key1"] || parsed["key2"] {
+		t.Fatalf("Expected only key2 to be flagged as failed, got %v", parsed)
+	}
+}
+
+func TestParseReplicationAckInvalid(t *testing.T) {
+	if _, err := parseReplicationAck("GOT key1:value1", "REPLICATED"); err == nil {
+		t.Fatalf("Expected an error parsing a non-ack response")
+	}
+}
+
+func TestEncodeReplicationBatch(t *testing.T) {
+	expectedReturn := "REPLICATE key1:value1,key2:value2:30"
+	retVal := encodeReplicationBatch([]ReplicationEntry{
+		{"key1", "value1", 0, 0, false, KindString},
+		{"key2", "value2", 30, 0, false, KindString},
+	})
+
+	if expectedReturn != retVal {
+		t.Errorf("Expected %v, got %v", expectedReturn, retVal)
+	}
+}
+
+func TestEncodeReplicationBatchFramesValues(t *testing.T) {
+	entries := []ReplicationEntry{
+		{"plain", "value", 0, 0, false, KindString},
+		{"binary", "a value:\nwith, \x00 everything", 30, 0, false, KindString},
+		{"empty", "", 0, 0, false, KindString},
+	}
+
+	// The newline is the one SendRequest terminates the message with.
+	line, payloads, err := parser.SplitFramed(encodeReplicationBatch(entries) + "\n")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	command, err := parser.NewParser(nil).ParseFramed(line, payloads, nil)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for _, entry := range entries {
+		if value, ok := command.Args[entry.Key]; !ok || value != entry.Value {
+			t.Fatalf("Expected %q, got %q", entry.Value, value)
+		}
+	}
+
+	if command.Expiration["binary"] != "30" {
+		t.Fatalf("Expected %v, got %v", "30", command.Expiration["binary"])
+	}
+}
+
+func TestEncodeReplicationBatchWithVersions(t *testing.T) {
+	entries := []ReplicationEntry{
+		{"key1", "value1", 0, 7, false, KindString},
+		{"key2", "value2", 30, 8, false, KindString},
+	}
+
+	line, payloads, err := parser.SplitFramed(encodeReplicationBatch(entries) + "\n")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	command, err := parser.NewParser(nil).ParseFramed(line, payloads, nil)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if command.Versions["key1"] != "7" || command.Versions["key2"] != "8" {
+		t.Fatalf("Expected versions 7 and 8, got %v", command.Versions)
+	}
+	if command.Expiration["key1"] != "0" || command.Expiration["key2"] != "30" {
+		t.Fatalf("Expected expirations 0 and 30, got %v", command.Expiration)
+	}
+}
+
+func TestReplicateBatchKeepsAcksOfFailedBatch(t *testing.T) {
+	replica := newStubPeer(t, map[string]string{})
+	defer replica.Close()
+
+	cache := newCacheWithStubPeers(t, replica)
+
+	// Deletions are sent after the writes, so the writes were still
+	// applied when the deletions fail.
+	replica.FailTombstones(1)
+	acks, err := cache.ReplicateBatch(cache.PeerList.Peers[0], []ReplicationEntry{
+		{Key: "written", Value: "value"},
+		{Key: "deleted", Version: 1, Deleted: true},
+	})
+	if err == nil {
+		t.Fatalf("Expected the failed deletion to be reported")
+	}
+	if !acks["written"] || acks["deleted"] {
+		t.Fatalf("Expected only %v to be acked, got %v", "written", acks)
+	}
+}
@@ -0,0 +1,273 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/GrappigPanda/Olivia/dht"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Backoff between retries of failed replication writes. The backoff doubles
+// after every failed attempt, up to maxReplicationRetryBackoff.
+var (
+	replicationRetryBackoff    = 100 * time.Millisecond
+	maxReplicationRetryBackoff = 30 * time.Second
+)
+
+// retryQueue holds the replication writes which a single replica failed to
+// apply, until they can be re-sent. Only the latest write per key is kept.
+type retryQueue struct {
+	peer    *dht.Peer
+	entries []ReplicationEntry
+	// capacity bounds the queue. Once full, the oldest writes are dropped.
+	capacity int
+	// path is where the queue is persisted to, empty if it isn't.
+	path    string
+	running bool
+	sync.Mutex
+}
+
+// retryQueues holds a retry queue per replica, keyed by the replica's address.
+type retryQueues struct {
+	queues map[string]*retryQueue
+	sync.Mutex
+}
+
+// ReplicateWithRetry replicates a batch to a replica like ReplicateBatch, but
+// any write which the replica didn't apply is queued and retried with backoff
+// in the background, rather than being lost to the replica. Retries are only
+// made when ReplicationRetryQueueSize is configured.
+func (c *Cache) ReplicateWithRetry(peer *dht.Peer, entries []ReplicationEntry) (map[string]bool, error) {
+	return c.replicateWithRetry(context.Background(), peer, entries)
+}
+
+// replicateWithRetry is ReplicateWithRetry, giving up waiting on the replica's
+// ack once `ctx` is done.
+func (c *Cache) replicateWithRetry(ctx context.Context, peer *dht.Peer, entries []ReplicationEntry) (map[string]bool, error) {
+	acks, err := c.ReplicateBatchContext(ctx, peer, entries)
+
+	var failed []ReplicationEntry
+	for _, entry := range entries {
+		if !acks[entry.Key] {
+			failed = append(failed, entry)
+		}
+	}
+
+	if len(failed) > 0 && peer != nil && c.config.ReplicationRetryQueueSize > 0 {
+		c.retryQueue(peer).enqueue(c, failed)
+	}
+
+	return acks, err
+}
+
+// retryQueue returns the retry queue of a replica, creating (and, if
+// persistent, loading) it on first use.
+func (c *Cache) retryQueue(peer *dht.Peer) *retryQueue {
+	c.replicationRetries.Lock()
+	defer c.replicationRetries.Unlock()
+
+	if c.replicationRetries.queues == nil {
+		c.replicationRetries.queues = make(map[string]*retryQueue)
+	}
+
+	if queue, ok := c.replicationRetries.queues[peer.IPPort]; ok {
+		return queue
+	}
+
+	queue := &retryQueue{
+		peer:     peer,
+		capacity: c.config.ReplicationRetryQueueSize,
+	}
+
+	if dir := c.config.ReplicationRetryQueuePath; dir != "" {
+		queue.path = filepath.Join(
+			dir,
+			strings.Replace(peer.IPPort, ":", "_", -1)+".retry",
+		)
+		queue.load()
+		if len(queue.entries) > 0 {
+			queue.running = true
+			go queue.run(c)
+		}
+	}
+
+	c.replicationRetries.queues[peer.IPPort] = queue
+
+	return queue
+}
+
+// resumeRetryQueues picks retrying back up for every replica which has a
+// persisted retry queue.
+func (c *Cache) resumeRetryQueues() {
+	if c.config.ReplicationRetryQueuePath == "" || c.PeerList == nil {
+		return
+	}
+
+	for _, peer := range c.PeerList.GetPeers() {
+		if peer != nil {
+			c.retryQueue(peer)
+		}
+	}
+}
+
+// retryQueueDepth returns how many writes are waiting to be retried across
+// every replica.
+func (c *Cache) retryQueueDepth() uint64 {
+	c.replicationRetries.Lock()
+	defer c.replicationRetries.Unlock()
+
+	depth := 0
+	for _, queue := range c.replicationRetries.queues {
+		queue.Lock()
+		depth += len(queue.entries)
+		queue.Unlock()
+	}
+
+	return uint64(depth)
+}
+
+// enqueue adds failed writes to the queue and makes sure they're being
+// retried.
+func (q *retryQueue) enqueue(c *Cache, entries []ReplicationEntry) {
+	q.Lock()
+	defer q.Unlock()
+
+	for _, entry := range entries {
+		q.remove(entry.Key)
+		q.entries = append(q.entries, entry)
+	}
+
+	if overflow := len(q.entries) - q.capacity; overflow > 0 {
+		log.Printf(
+			"Retry queue for %v is full, dropping %d writes",
+			q.peer.IPPort,
+			overflow,
+		)
+		q.entries = q.entries[overflow:]
+	}
+	q.persist()
+
+	if !q.running {
+		q.running = true
+		go q.run(c)
+	}
+}
+
+// run retries the queued writes until the queue is empty.
+func (q *retryQueue) run(c *Cache) {
+	backoff := replicationRetryBackoff
+
+	for {
+		time.Sleep(backoff)
+
+		q.Lock()
+		batch := make([]ReplicationEntry, len(q.entries))
+		copy(batch, q.entries)
+		q.Unlock()
+
+		acks, err := c.ReplicateBatch(q.peer, batch)
+		if err != nil {
+			log.Printf("Retrying replication to %v failed: %v", q.peer.IPPort, err)
+		}
+
+		q.Lock()
+		for _, entry := range batch {
+			if acks[entry.Key] {
+				q.removeEntry(entry)
+			}
+		}
+		q.persist()
+
+		if len(q.entries) == 0 {
+			q.running = false
+			q.Unlock()
+			return
+		}
+		q.Unlock()
+
+		if err != nil || !allApplied(acks) {
+			backoff *= 2
+			if backoff > maxReplicationRetryBackoff {
+				backoff = maxReplicationRetryBackoff
+			}
+		} else {
+			backoff = replicationRetryBackoff
+		}
+	}
+}
+
+// allApplied checks whether a replica applied every write of a batch.
+func allApplied(acks map[string]bool) bool {
+	for _, applied := range acks {
+		if !applied {
+			return false
+		}
+	}
+
+	return true
+}
+
+// remove drops any queued write for `key`. The caller must hold the lock.
+func (q *retryQueue) remove(key string) {
+	for i, entry := range q.entries {
+		if entry.Key == key {
+			q.entries = append(q.entries[:i], q.entries[i+1:]...)
+			return
+		}
+	}
+}
+
+// removeEntry drops a queued write, unless it has been superseded by a newer
+// write for the same key in the meantime. The caller must hold the lock.
+func (q *retryQueue) removeEntry(sent ReplicationEntry) {
+	for i, entry := range q.entries {
+		if entry == sent {
+			q.entries = append(q.entries[:i], q.entries[i+1:]...)
+			return
+		}
+	}
+}
+
+// persist writes the queue to disk, if it's persistent. The caller must hold
+// the lock.
+func (q *retryQueue) persist() {
+	if q.path == "" {
+		return
+	}
+
+	if len(q.entries) == 0 {
+		if err := os.Remove(q.path); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove retry queue %v: %v", q.path, err)
+		}
+		return
+	}
+
+	data, err := json.Marshal(q.entries)
+	if err == nil {
+		err = ioutil.WriteFile(q.path, data, 0644)
+	}
+	if err != nil {
+		log.Printf("Failed to persist retry queue %v: %v", q.path, err)
+	}
+}
+
+// load reads a persisted queue back from disk.
+func (q *retryQueue) load() {
+	data, err := ioutil.ReadFile(q.path)
+	if os.IsNotExist(err) {
+		return
+	} else if err != nil {
+		log.Printf("Failed to load retry queue %v: %v", q.path, err)
+		return
+	}
+
+	if err := json.Unmarshal(data, &q.entries); err != nil {
+		log.Printf("Failed to load retry queue %v: %v", q.path, err)
+	}
+}
@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"github.com/GrappigPanda/Olivia/config"
+	"github.com/GrappigPanda/Olivia/dht"
+	"testing"
+	"time"
+)
+
+func TestReplicateBatchKeepsBinaryValuesIntact(t *testing.T) {
+	replica := newStubPeer(t, map[string]string{})
+	defer replica.Close()
+
+	cache := newCacheWithStubPeers(t, replica)
+	value := "spaces, colons:\nand newlines\x00"
+	acks, err := cache.ReplicateBatch(cache.PeerList.Peers[0], []ReplicationEntry{{Key: "key1", Value: value}})
+	if err != nil || !acks["key1"] {
+		t.Fatalf("Expected the write to be acked, got %v (%v)", acks, err)
+	}
+
+	if replicated, _ := replica.Value("key1"); replicated != value {
+		t.Fatalf("Expected %q, got %q", value, replicated)
+	}
+}
+
+func TestReplicationRetryEventuallyLands(t *testing.T) {
+	replica := newStubPeer(t, map[string]string{})
+	defer replica.Close()
+
+	cache := newCacheWithStubPeers(t, replica)
+	cache.config.ReplicationRetryQueueSize = 10
+
+	replica.FailReplicates(3)
+	entries := []ReplicationEntry{{Key: "key1", Value: "value1"}}
+	acks, err := cache.ReplicateWithRetry(cache.PeerList.Peers[0], entries)
+	if err != nil || acks["key1"] {
+		t.Fatalf("Expected the first attempt to fail, got %v (%v)", acks, err)
+	}
+
+	if depth := cache.Stats().RetryQueueDepth; depth != 1 {
+		t.Fatalf("Expected %v, got %v", 1, depth)
+	}
+
+	for attempt := 0; ; attempt++ {
+		if value, ok := replica.Value("key1"); ok {
+			if value != "value1" {
+				t.Fatalf("Expected %v, got %v", "value1", value)
+			}
+			break
+		}
+		if attempt == 100 {
+			t.Fatalf("The write never landed on the replica")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	for attempt := 0; cache.Stats().RetryQueueDepth != 0; attempt++ {
+		if attempt == 100 {
+			t.Fatalf("Expected the retry queue to drain")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRetryQueueIsBounded(t *testing.T) {
+	cfg := &config.Cfg{IsTesting: true, ReplicationRetryQueueSize: 2}
+	cache := NewCache(nil, cfg)
+	peer := dht.NewPeerByIP("127.0.0.1:1", nil, *cfg)
+
+	entries := []ReplicationEntry{{Key: "key1"}, {Key: "key2"}, {Key: "key3"}}
+	if _, err := cache.ReplicateWithRetry(peer, entries); err == nil {
+		t.Fatalf("Expected replicating to an unconnected peer to fail")
+	}
+
+	if depth := cache.Stats().RetryQueueDepth; depth != 2 {
+		t.Fatalf("Expected %v, got %v", 2, depth)
+	}
+
+	queue := cache.retryQueue(peer)
+	queue.Lock()
+	defer queue.Unlock()
+	if queue.entries[0].Key != "key2" || queue.entries[1].Key != "key3" {
+		t.Fatalf("Expected the oldest write to be dropped, got %v", queue.entries)
+	}
+}
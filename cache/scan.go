@@ -0,0 +1,174 @@
+package cache
+
+import (
+	"fmt"
+	"sort"
+)
+
+// defaultScanCount is how many keys a SCAN aims to return when it isn't
+// told.
+const defaultScanCount = 10
+
+// Scan returns the keys matching the glob `pattern` (see MatchGlob) from the
+// shards starting at `cursor`, along with the cursor to continue from. A scan
+// starts at cursor zero and is done once it's handed zero back.
+//
+// Shards are scanned whole, from their read copies, so no lock is held
+// between (or even during) calls and keys held throughout a scan are returned
+// exactly once. Keys written or removed during a scan may or may not be.
+// `count` is only a hint: shards are added until at least that many keys
+// were looked at, so a call may return more or fewer keys.
+func (c *Cache) Scan(cursor uint64, pattern string, count int) ([]string, uint64, error) {
+	if _, err := MatchGlob(pattern, ""); err != nil {
+		return nil, 0, err
+	}
+
+	if cursor >= cacheShards {
+		return nil, 0, fmt.Errorf("Invalid cursor %d", cursor)
+	}
+
+	if count <= 0 {
+		count = defaultScanCount
+	}
+
+	var matched []string
+	scanned := 0
+	for scanned < count && cursor < cacheShards {
+		keys := c.shards[cursor].readKeys()
+		cursor++
+
+		for _, key := range keys {
+			if ok, _ := MatchGlob(pattern, key); ok {
+				matched = append(matched, key)
+			}
+		}
+		scanned += len(keys)
+	}
+
+	if cursor == cacheShards {
+		cursor = 0
+	}
+
+	return matched, cursor, nil
+}
+
+// readKeys returns the keys of the shard's read copy, sorted.
+func (s *cacheShard) readKeys() []string {
+	read, _ := s.read.Load().(map[string]readEntry)
+
+	keys := make([]string, 0, len(read))
+	for key := range read {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// MatchGlob checks whether `key` matches the glob `pattern`, where `*`
+// matches any run of bytes, `?` any single byte, `[abc]`, `[a-z]` or
+// `[^abc]` a byte of (or not of) the class, and `\` escapes the byte after
+// it. Unlike path.Match, `/` isn't special. An empty pattern matches every
+// key.
+func MatchGlob(pattern string, key string) (bool, error) {
+	if pattern == "" {
+		return true, nil
+	}
+
+	return matchGlob(pattern, key)
+}
+
+func matchGlob(pattern string, key string) (bool, error) {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			// Runs of stars match the same as a single one.
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true, nil
+			}
+
+			for i := 0; i <= len(key); i++ {
+				ok, err := matchGlob(pattern, key[i:])
+				if ok || err != nil {
+					return ok, err
+				}
+			}
+
+			return false, nil
+		case '?':
+			if len(key) == 0 {
+				return false, nil
+			}
+			pattern, key = pattern[1:], key[1:]
+		case '[':
+			end, ok, err := matchClass(pattern, key)
+			if err != nil || !ok {
+				return false, err
+			}
+			pattern, key = pattern[end:], key[1:]
+		case '\\':
+			if len(pattern) < 2 {
+				return false, fmt.Errorf("Invalid pattern: trailing escape")
+			}
+			if len(key) == 0 || key[0] != pattern[1] {
+				return false, checkGlob(pattern[2:])
+			}
+			pattern, key = pattern[2:], key[1:]
+		default:
+			if len(key) == 0 || key[0] != pattern[0] {
+				return false, checkGlob(pattern[1:])
+			}
+			pattern, key = pattern[1:], key[1:]
+		}
+	}
+
+	return len(key) == 0, nil
+}
+
+// matchClass matches the first byte of `key` against the class `pattern`
+// starts with, returning where the class ends.
+func matchClass(pattern string, key string) (int, bool, error) {
+	i := 1
+	negated := i < len(pattern) && pattern[i] == '^'
+	if negated {
+		i++
+	}
+
+	matched := false
+	for first := true; ; first = false {
+		if i >= len(pattern) {
+			return 0, false, fmt.Errorf("Invalid pattern: unterminated class")
+		}
+		if pattern[i] == ']' && !first {
+			break
+		}
+
+		low := pattern[i]
+		if low == '\\' && i+1 < len(pattern) {
+			i++
+			low = pattern[i]
+		}
+		high := low
+		if i+2 < len(pattern) && pattern[i+1] == '-' && pattern[i+2] != ']' {
+			high = pattern[i+2]
+			i += 2
+		}
+		i++
+
+		if len(key) > 0 && low <= key[0] && key[0] <= high {
+			matched = true
+		}
+	}
+
+	return i + 1, len(key) > 0 && matched != negated, nil
+}
+
+// checkGlob reports whether the rest of a pattern is malformed, so a pattern
+// is refused the same whether or not a key fails to match before its end.
+func checkGlob(pattern string) error {
+	_, err := matchGlob(pattern, "")
+	return err
+}
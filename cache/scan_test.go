@@ -0,0 +1,111 @@
+package cache
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	for _, test := range []struct {
+		pattern string
+		key     string
+		matches bool
+	}{
+		{"", "anything", true},
+		{"*", "", true},
+		{"user:*", "user:1", true},
+		{"user:*", "user/1/name", false},
+		{"user*", "user/1/name", true},
+		{"*name", "user/1/name", true},
+		{"u?er", "user", true},
+		{"u?er", "uer", false},
+		{"key[12]", "key1", true},
+		{"key[12]", "key3", false},
+		{"key[a-c]", "keyb", true},
+		{"key[^a-c]", "keyb", false},
+		{"key[^a-c]", "keyd", true},
+		{"key\\*", "key*", true},
+		{"key\\*", "key1", false},
+		{"a*b*c", "aXXbYYc", true},
+		{"a*b*c", "aXXbYY", false},
+	} {
+		matches, err := MatchGlob(test.pattern, test.key)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		if matches != test.matches {
+			t.Fatalf("Expected %q matching %q to be %v, got %v", test.pattern, test.key, test.matches, matches)
+		}
+	}
+}
+
+func TestMatchGlobRefusesMalformedPatterns(t *testing.T) {
+	for _, pattern := range []string{"key[12", "key\\", "x[a"} {
+		if _, err := MatchGlob(pattern, "key1"); err == nil {
+			t.Fatalf("Expected %q to be refused", pattern)
+		}
+	}
+}
+
+func TestScanReturnsEveryKeyOnce(t *testing.T) {
+	cache := NewCache(nil, stubConfig())
+	for i := 0; i < 200; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), "value")
+	}
+	cache.Set("other", "value")
+
+	seen := make(map[string]int)
+	cursor, calls := uint64(0), 0
+	for {
+		keys, next, err := cache.Scan(cursor, "key*", 20)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		for _, key := range keys {
+			seen[key]++
+		}
+
+		calls++
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+
+	if len(seen) != 200 {
+		t.Fatalf("Expected %v keys, got %v", 200, len(seen))
+	}
+	for key, times := range seen {
+		if times != 1 {
+			t.Fatalf("Expected %v to be returned once, got %v", key, times)
+		}
+	}
+	if calls < 2 {
+		t.Fatalf("Expected the scan to take several calls, got %v", calls)
+	}
+}
+
+func TestScanDoesntHoldLocks(t *testing.T) {
+	cache := NewCache(nil, stubConfig())
+	cache.Set("key", "value")
+
+	shard := cache.shardOf("key")
+	shard.Lock()
+	defer shard.Unlock()
+
+	keys, _, err := cache.Scan(0, "", cacheShards*10)
+	sort.Strings(keys)
+	if err != nil || len(keys) != 1 || keys[0] != "key" {
+		t.Fatalf("Expected [key], got %v (%v)", keys, err)
+	}
+}
+
+func TestScanRefusesBadCursor(t *testing.T) {
+	cache := NewCache(nil, stubConfig())
+
+	if _, _, err := cache.Scan(cacheShards, "", 10); err == nil {
+		t.Fatalf("Expected an out of range cursor to be refused")
+	}
+}
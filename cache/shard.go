@@ -0,0 +1,175 @@
+package cache
+
+import (
+	"github.com/GrappigPanda/Olivia/config"
+	binheap "github.com/GrappigPanda/Olivia/shared"
+	"sync"
+	"sync/atomic"
+)
+
+// cacheShards is how many shards the cache is split into by key hash.
+const cacheShards = 64
+
+// minShardHeapCapacity keeps a shard's expiration heap from starting out so
+// small that it reallocates on nearly every insert.
+const minShardHeapCapacity = 8
+
+// cacheShard holds the keys hashing into it, along with their expirations and
+// tombstones. Operations on a single key only lock the key's shard (see
+// withKey), so writes to unrelated keys don't wait on each other.
+type cacheShard struct {
+	entries     map[string]string
+	expirations *binheap.Heap
+	// tombstones holds the keys which were explicitly deleted, until
+	// they're set again. See GetState.
+	tombstones map[string]struct{}
+	// versions holds the version of each key's value. Keys restored from
+	// disk have none, which orders them before any versioned write.
+	versions map[string]uint64
+	// typed holds the value of each key holding anything but a string.
+	typed map[string]*typedValue
+	// read holds an immutable copy of entries, which reads go through
+	// without taking any lock. See publish.
+	read atomic.Value
+	// written holds the keys written since the shard was last published.
+	written map[string]struct{}
+	sync.Mutex
+}
+
+// newCacheShards creates every shard, each with an expiration heap sized for
+// its share of the configured capacity and of `pending` expirations, which is
+// indexed by shard and may be nil.
+func newCacheShards(config config.Cfg, pending []int) [cacheShards]*cacheShard {
+	var shards [cacheShards]*cacheShard
+	for i := range shards {
+		shardPending := 0
+		if pending != nil {
+			shardPending = pending[i]
+		}
+
+		shards[i] = &cacheShard{
+			entries:     make(map[string]string),
+			expirations: newExpirationHeap(config, shardPending),
+			tombstones:  make(map[string]struct{}),
+			versions:    make(map[string]uint64),
+			typed:       make(map[string]*typedValue),
+			written:     make(map[string]struct{}),
+		}
+	}
+
+	return shards
+}
+
+// shardIndex picks the shard `key` lives in by its FNV-1a hash, inlined so
+// reads don't allocate a hasher.
+func shardIndex(key string) int {
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= 16777619
+	}
+
+	return int(hash % cacheShards)
+}
+
+// shardOf returns the shard `key` lives in.
+func (c *Cache) shardOf(key string) *cacheShard {
+	return c.shards[shardIndex(key)]
+}
+
+// withKey runs `fn` holding the lock of `key`'s shard, then evicts whatever
+// `fn` wrote past MaxEntries or MaxBytes, never evicting `key` itself.
+//
+// The cache lock is a RWMutex: operations on a single key share it and only
+// lock their key's shard, while operations spanning the whole cache (e.g.
+// snapshots, batches and the expiration sweep) take it exclusively and need no
+// shard locks. Shared state single-key operations touch is guarded on its own:
+// the bloom filters by bloomLock, the counters atomically and the write-ahead
+// log and eviction policy by their own locks.
+func (c *Cache) withKey(key string, fn func(shard *cacheShard) error) error {
+	c.RLock()
+	defer c.RUnlock()
+
+	shard := c.shardOf(key)
+	shard.Lock()
+	err := fn(shard)
+	shard.Unlock()
+
+	c.evictLeastRecent(key)
+
+	return err
+}
+
+// readKey runs `fn` holding the lock of `key`'s shard, for reads which need
+// a consistent view of the shard rather than its read copy.
+func (c *Cache) readKey(key string, fn func(shard *cacheShard)) {
+	c.RLock()
+	defer c.RUnlock()
+
+	shard := c.shardOf(key)
+	shard.Lock()
+	defer shard.Unlock()
+
+	fn(shard)
+}
+
+// forEachEntry calls `fn` with every key and value in the cache. The caller
+// must hold the cache lock exclusively.
+func (c *Cache) forEachEntry(fn func(key string, value string)) {
+	for _, shard := range c.shards {
+		for key, value := range shard.entries {
+			fn(key, value)
+		}
+	}
+}
+
+// noExpirations checks whether no key has a pending expiration. The caller
+// must hold the cache lock exclusively.
+func (c *Cache) noExpirations() bool {
+	for _, shard := range c.shards {
+		if !shard.expirations.IsEmpty() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ExpirationCount returns how many keys are waiting to expire, i.e. the size
+// of the expiration heaps.
+func (c *Cache) ExpirationCount() int {
+	count := 0
+	for _, shard := range c.shards {
+		shard.Lock()
+		count += shard.expirations.Size()
+		shard.Unlock()
+	}
+
+	return count
+}
+
+// keyCount returns how many keys the cache holds.
+func (c *Cache) keyCount() int {
+	return int(atomic.LoadInt64(&c.entryCount))
+}
+
+// soonestExpiring returns the key closest to expiring other than `keep`. The
+// caller must hold the cache lock, but no shard lock.
+func (c *Cache) soonestExpiring(keep string) (string, bool) {
+	var soonest *binheap.Node
+	for _, shard := range c.shards {
+		shard.Lock()
+		node := earliestNode(shard.expirations, keep)
+		shard.Unlock()
+
+		if node != nil && (soonest == nil || node.Timeout.Before(soonest.Timeout)) {
+			soonest = node
+		}
+	}
+
+	if soonest == nil {
+		return "", false
+	}
+
+	return soonest.Key, true
+}
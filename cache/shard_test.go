@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"fmt"
+	"github.com/GrappigPanda/Olivia/config"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWritesDontWaitOnOtherShards(t *testing.T) {
+	cache := NewCache(nil, stubConfig())
+
+	other := "key0"
+	for shardIndex(other) == shardIndex("held") {
+		other += "0"
+	}
+
+	held := cache.shardOf("held")
+	held.Lock()
+	defer held.Unlock()
+
+	done := make(chan error)
+	go func() { done <- cache.Set(other, "value") }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected a write to another shard not to wait on a held shard")
+	}
+}
+
+func TestConcurrentSetsStayWithinLimits(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{IsTesting: true, MaxEntries: 100})
+
+	var wg sync.WaitGroup
+	for writer := 0; writer < 8; writer++ {
+		wg.Add(1)
+		go func(writer int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				cache.Set(fmt.Sprintf("key%d-%d", writer, i), strconv.Itoa(i))
+			}
+		}(writer)
+	}
+	wg.Wait()
+
+	if count := cache.keyCount(); count > 100 {
+		t.Fatalf("Expected at most %v keys, got %v", 100, count)
+	}
+
+	entries, usedBytes := 0, 0
+	for _, shard := range cache.shards {
+		for key, value := range shard.entries {
+			entries++
+			usedBytes += entrySize(key, value)
+		}
+	}
+
+	if entries != cache.keyCount() {
+		t.Fatalf("Expected %v keys to be counted, got %v", entries, cache.keyCount())
+	}
+	if used := int(atomic.LoadInt64(&cache.usedBytes)); used != usedBytes {
+		t.Fatalf("Expected %v used bytes, got %v", usedBytes, used)
+	}
+}
+
+func BenchmarkParallelSets(b *testing.B) {
+	cache := NewCache(nil, stubConfig())
+	var writers int64
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		writer := atomic.AddInt64(&writers, 1)
+		i := 0
+		for pb.Next() {
+			cache.Set(fmt.Sprintf("key%d-%d", writer, i%1000), strconv.Itoa(i))
+			i++
+		}
+	})
+}
+
+func TestExpirationCountSumsShards(t *testing.T) {
+	cache := NewCache(nil, stubConfig())
+
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key%d", i)
+		if i%2 == 0 {
+			cache.SetExpiration(key, "value", 60)
+		} else {
+			cache.Set(key, "value")
+		}
+	}
+
+	if count := cache.ExpirationCount(); count != 10 {
+		t.Fatalf("Expected 10, got %v", count)
+	}
+}
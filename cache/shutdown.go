@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// requestTracker counts the client requests being served, so Shutdown can
+// wait for them to be answered.
+type requestTracker struct {
+	count int
+	// idle is closed once count drops to zero, nil until someone waits.
+	idle chan struct{}
+	sync.Mutex
+}
+
+func (t *requestTracker) start() {
+	t.Lock()
+	defer t.Unlock()
+
+	t.count++
+}
+
+func (t *requestTracker) finish() {
+	t.Lock()
+	defer t.Unlock()
+
+	t.count--
+	if t.count == 0 && t.idle != nil {
+		close(t.idle)
+		t.idle = nil
+	}
+}
+
+// wait blocks until no requests are being served, or `ctx` is done.
+func (t *requestTracker) wait(ctx context.Context) error {
+	t.Lock()
+	if t.count == 0 {
+		t.Unlock()
+		return nil
+	}
+	if t.idle == nil {
+		t.idle = make(chan struct{})
+	}
+	idle := t.idle
+	t.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// StartRequest records that a client request is being served, returning
+// the function to call once it's answered. Shutdown waits on every request
+// started this way. Requests to a namespace count towards the node's.
+func (c *Cache) StartRequest() func() {
+	if c.root != nil {
+		return c.root.StartRequest()
+	}
+
+	c.requests.start()
+	return c.requests.finish
+}
+
+// Shutdown stops the node without losing writes, for it to be restarted or
+// taken out of the cluster. Our listeners should already be closed, so no
+// new connections arrive. It waits for the requests being served to be
+// answered, then stops the background loops, which forwards any writes still
+// queued and tells our peers we're leaving if membership is gossiped, syncs
+// the write-ahead log and takes a final snapshot if a SnapshotPath is
+// configured, and finally disconnects from our peers.
+//
+// If `ctx` is done first, Shutdown stops waiting on requests and the
+// background loops, goes on with the rest and returns the context's error.
+func (c *Cache) Shutdown(ctx context.Context) error {
+	if err := c.requests.wait(ctx); err != nil {
+		log.Printf("Gave up waiting on requests in flight: %v", err)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		c.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		log.Printf("Gave up waiting on the background loops: %v", ctx.Err())
+	}
+
+	if c.config.SnapshotPath != "" {
+		if err := c.Snapshot(); err != nil {
+			log.Printf("Failed to snapshot while shutting down: %v", err)
+		}
+	}
+
+	if c.PeerList != nil {
+		c.PeerList.DisconnectAllPeers()
+	}
+
+	return ctx.Err()
+}
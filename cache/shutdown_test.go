@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestShutdownWaitsForRequests(t *testing.T) {
+	cache := NewCache(nil, nil)
+	done := cache.StartRequest()
+
+	shutDown := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutDown <- cache.Shutdown(ctx)
+	}()
+
+	select {
+	case err := <-shutDown:
+		t.Fatalf("Expected Shutdown to wait on the request, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	done()
+
+	select {
+	case err := <-shutDown:
+		if err != nil {
+			t.Fatalf("Expected %v, got %v", nil, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected Shutdown to return once the request finished")
+	}
+}
+
+func TestShutdownGivesUpWithTheContext(t *testing.T) {
+	cache := NewCache(nil, nil)
+	defer cache.StartRequest()()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := cache.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Expected %v, got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestShutdownSnapshots(t *testing.T) {
+	cfg, cleanup := durableConfig(t)
+	defer cleanup()
+
+	cache := NewCache(nil, cfg)
+	for i := 0; i < 10; i++ {
+		if err := cache.Set(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i)); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+
+	if err := cache.Shutdown(context.Background()); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if cache.LastSnapshot().IsZero() {
+		t.Fatalf("Expected Shutdown to take a snapshot")
+	}
+
+	restored := NewCache(nil, cfg)
+	defer restored.Stop()
+	for i := 0; i < 10; i++ {
+		value, err := restored.Get(fmt.Sprintf("key%d", i))
+		if err != nil || value != fmt.Sprintf("value%d", i) {
+			t.Fatalf("Expected %v, got %v %v", fmt.Sprintf("value%d", i), value, err)
+		}
+	}
+}
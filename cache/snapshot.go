@@ -0,0 +1,262 @@
+package cache
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	binheap "github.com/GrappigPanda/Olivia/shared"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// snapshotEntry is a single key in a snapshot. Snapshots are stored in a
+// compact binary format, see snapshotEncoder.
+type snapshotEntry struct {
+	Key   string
+	Value string
+	// ExpiresAt is the absolute expiration in unix nanoseconds. Zero means
+	// the key never expires.
+	ExpiresAt int64 `json:",omitempty"`
+	// Kind is the type of value the key holds, Value holding it encoded
+	// when it isn't a string.
+	Kind ValueKind `json:",omitempty"`
+}
+
+// ErrSnapshotInProgress is returned when a snapshot is requested while
+// another one is still being written.
+var ErrSnapshotInProgress = errors.New("A snapshot is already in progress")
+
+// snapshotState keeps snapshots from running concurrently. Both fields are
+// only ever touched atomically.
+type snapshotState struct {
+	saving int32
+	// lastSaved is when the last snapshot was written, in unix nanoseconds.
+	lastSaved int64
+}
+
+// Snapshot writes the cache's current state to the configured SnapshotPath
+// and, once the snapshot is safely on disk, truncates the write-ahead log.
+// It fails with ErrSnapshotInProgress while another snapshot is running.
+func (c *Cache) Snapshot() error {
+	if !atomic.CompareAndSwapInt32(&c.snapshots.saving, 0, 1) {
+		return ErrSnapshotInProgress
+	}
+	defer atomic.StoreInt32(&c.snapshots.saving, 0)
+
+	return c.snapshot()
+}
+
+// BackgroundSnapshot starts a snapshot without waiting on it and returns
+// when the previous snapshot was written. Failures of the snapshot itself
+// are only logged.
+func (c *Cache) BackgroundSnapshot() (time.Time, error) {
+	if c.config.SnapshotPath == "" {
+		return time.Time{}, fmt.Errorf("No snapshot path configured")
+	}
+
+	if !atomic.CompareAndSwapInt32(&c.snapshots.saving, 0, 1) {
+		return time.Time{}, ErrSnapshotInProgress
+	}
+	lastSaved := c.LastSnapshot()
+
+	go func() {
+		defer atomic.StoreInt32(&c.snapshots.saving, 0)
+
+		if err := c.snapshot(); err != nil {
+			log.Printf("Failed to snapshot in the background: %v", err)
+		}
+	}()
+
+	return lastSaved, nil
+}
+
+// LastSnapshot returns when the last snapshot was written. Before we've
+// written one, that's when the snapshot on disk was, or the zero time if
+// there's none.
+func (c *Cache) LastSnapshot() time.Time {
+	if lastSaved := atomic.LoadInt64(&c.snapshots.lastSaved); lastSaved != 0 {
+		return time.Unix(0, lastSaved).UTC()
+	}
+
+	if c.config.SnapshotPath == "" {
+		return time.Time{}
+	}
+
+	info, err := os.Stat(c.config.SnapshotPath)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return info.ModTime().UTC()
+}
+
+// snapshot does the work of Snapshot, without guarding against concurrent
+// snapshots.
+func (c *Cache) snapshot() error {
+	path := c.config.SnapshotPath
+	if path == "" {
+		return fmt.Errorf("No snapshot path configured")
+	}
+
+	// Writes are held off for the duration of the snapshot so that no write
+	// can land in the log between the snapshot and the truncation.
+	c.Lock()
+	defer c.Unlock()
+
+	if err := c.writeSnapshot(path); err != nil {
+		return err
+	}
+	atomic.StoreInt64(&c.snapshots.lastSaved, time.Now().UnixNano())
+
+	if c.wal != nil {
+		return c.wal.Truncate()
+	}
+
+	return nil
+}
+
+// writeSnapshot writes the snapshot to a temporary file and renames it into
+// place, so a crash mid-snapshot never leaves a half-written snapshot behind.
+// The caller must hold the cache lock.
+func (c *Cache) writeSnapshot(path string) error {
+	tmpPath := fmt.Sprintf("%s.tmp", path)
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	encoder, err := newSnapshotEncoder(writer)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	for _, shard := range c.shards {
+		for k, v := range shard.entries {
+			entry := snapshotEntry{
+				Key:   k,
+				Value: v,
+			}
+			if typed, ok := shard.typed[k]; ok {
+				entry.Kind = typed.kind
+				entry.Value = typed.encode()
+			}
+			if node, ok := shard.expirations.Get(k); ok && node != nil {
+				entry.ExpiresAt = node.Timeout.UnixNano()
+			}
+
+			if err := encoder.Encode(entry); err != nil {
+				file.Close()
+				return err
+			}
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// loadSnapshot loads the snapshot at `path` into the cache. A missing
+// snapshot is treated as empty. With PresizeHeapFromSnapshot set, the
+// expiration heap is sized up front for every pending expiration in the
+// snapshot.
+func (c *Cache) loadSnapshot(path string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	entries, err := decodeSnapshot(bufio.NewReader(file))
+	if err != nil {
+		return err
+	}
+
+	pending := make([]int, cacheShards)
+	for _, entry := range entries {
+		if entry.ExpiresAt != 0 {
+			pending[shardIndex(entry.Key)]++
+		}
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if c.config.PresizeHeapFromSnapshot && c.noExpirations() {
+		for i, shard := range c.shards {
+			shard.expirations = newExpirationHeap(c.config, pending[i])
+		}
+	}
+
+	// Keys are added to the bloom filters in one go, rather than one at a
+	// time as they're stored.
+	var newKeys []string
+	for _, entry := range entries {
+		var typed *typedValue
+		if entry.Kind != KindString {
+			if typed, err = decodeTypedValue(entry.Kind, entry.Value); err != nil {
+				return err
+			}
+			entry.Value = ""
+		}
+
+		shard := c.shardOf(entry.Key)
+		c.dropTyped(shard, entry.Key)
+		if old, ok := shard.entries[entry.Key]; !ok {
+			newKeys = append(newKeys, entry.Key)
+			atomic.AddInt64(&c.entryCount, 1)
+		} else {
+			atomic.AddInt64(&c.usedBytes, -int64(entrySize(entry.Key, old)))
+		}
+		shard.entries[entry.Key] = entry.Value
+		shard.written[entry.Key] = struct{}{}
+		atomic.AddInt64(&c.usedBytes, int64(entrySize(entry.Key, entry.Value)))
+		if typed != nil {
+			shard.typed[entry.Key] = typed
+			atomic.AddInt64(&c.usedBytes, int64(typed.size()))
+		}
+		c.touchKey(entry.Key)
+		if entry.ExpiresAt != 0 {
+			expiresAt := time.Unix(0, entry.ExpiresAt).UTC()
+			shard.expirations.Insert(binheap.NewNode(entry.Key, expiresAt))
+			c.expirationScheduled(expiresAt)
+		}
+	}
+	c.addKeysToBloomFilters(newKeys)
+	c.copyCache()
+
+	return nil
+}
+
+// snapshotRepeatedly takes a snapshot (truncating the write-ahead log) on a
+// timed interval.
+func (c *Cache) snapshotRepeatedly(interval time.Duration) {
+	c.executeRepeatedly(
+		interval,
+		func() {
+			// A snapshot which was asked for in the meantime does
+			// just as well.
+			if err := c.Snapshot(); err != nil && err != ErrSnapshotInProgress {
+				log.Printf("Failed to snapshot: %v", err)
+			}
+		},
+		c.stopped,
+		nil,
+	)
+}
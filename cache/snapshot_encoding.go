@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// snapshotMagic starts every binary snapshot. Snapshots starting with
+// snapshotMagicV1 are read without kinds, and snapshots with neither as the
+// JSON lines older versions wrote.
+var snapshotMagic = []byte("OLIVIASNAP\x02")
+
+// snapshotMagicV1 starts the binary snapshots of versions without lists.
+var snapshotMagicV1 = []byte("OLIVIASNAP\x01")
+
+// snapshotEncoder writes snapshot entries in the binary format: the key and
+// value, each prefixed by its length as a uvarint, followed by ExpiresAt as a
+// varint and the value's kind as a byte.
+type snapshotEncoder struct {
+	writer  *bufio.Writer
+	scratch [binary.MaxVarintLen64]byte
+}
+
+// newSnapshotEncoder writes the snapshot header to `writer` and returns an
+// encoder for the entries following it.
+func newSnapshotEncoder(writer *bufio.Writer) (*snapshotEncoder, error) {
+	if _, err := writer.Write(snapshotMagic); err != nil {
+		return nil, err
+	}
+
+	return &snapshotEncoder{writer: writer}, nil
+}
+
+// Encode appends `entry` to the snapshot.
+func (e *snapshotEncoder) Encode(entry snapshotEntry) error {
+	for _, field := range []string{entry.Key, entry.Value} {
+		n := binary.PutUvarint(e.scratch[:], uint64(len(field)))
+		if _, err := e.writer.Write(e.scratch[:n]); err != nil {
+			return err
+		}
+		if _, err := e.writer.WriteString(field); err != nil {
+			return err
+		}
+	}
+
+	n := binary.PutVarint(e.scratch[:], entry.ExpiresAt)
+	if _, err := e.writer.Write(e.scratch[:n]); err != nil {
+		return err
+	}
+
+	return e.writer.WriteByte(byte(entry.Kind))
+}
+
+// decodeSnapshot reads every entry of a snapshot, binary or JSON lines.
+func decodeSnapshot(reader *bufio.Reader) ([]snapshotEntry, error) {
+	header, err := reader.Peek(len(snapshotMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	kinds := bytes.Equal(header, snapshotMagic)
+	if !kinds && !bytes.Equal(header, snapshotMagicV1) {
+		return decodeJSONSnapshot(reader)
+	}
+	reader.Discard(len(snapshotMagic))
+
+	var entries []snapshotEntry
+	for {
+		key, err := readSnapshotField(reader)
+		if err == io.EOF {
+			return entries, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		value, err := readSnapshotField(reader)
+		if err != nil {
+			return nil, truncatedSnapshot(err)
+		}
+
+		expiresAt, err := binary.ReadVarint(reader)
+		if err != nil {
+			return nil, truncatedSnapshot(err)
+		}
+
+		var kind byte
+		if kinds {
+			if kind, err = reader.ReadByte(); err != nil {
+				return nil, truncatedSnapshot(err)
+			}
+		}
+
+		entries = append(entries, snapshotEntry{
+			Key:       key,
+			Value:     value,
+			ExpiresAt: expiresAt,
+			Kind:      ValueKind(kind),
+		})
+	}
+}
+
+// readSnapshotField reads a length-prefixed string. A clean io.EOF is only
+// returned if the snapshot ends before the field starts.
+func readSnapshotField(reader *bufio.Reader) (string, error) {
+	length, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return "", err
+	}
+
+	field := make([]byte, length)
+	if _, err := io.ReadFull(reader, field); err != nil {
+		return "", truncatedSnapshot(err)
+	}
+
+	return string(field), nil
+}
+
+// truncatedSnapshot reports a snapshot which ends mid-entry.
+func truncatedSnapshot(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("Truncated snapshot")
+	}
+
+	return err
+}
+
+// decodeJSONSnapshot reads a snapshot stored one JSON object per line.
+func decodeJSONSnapshot(reader io.Reader) ([]snapshotEntry, error) {
+	var entries []snapshotEntry
+	decoder := json.NewDecoder(reader)
+	for decoder.More() {
+		var entry snapshotEntry
+		if err := decoder.Decode(&entry); err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSnapshotEncodingRoundTrip(t *testing.T) {
+	entries := []snapshotEntry{
+		{Key: "key1", Value: "value1"},
+		{Key: "expiring", Value: "value with spaces\n", ExpiresAt: 1500000000000000000},
+		{Key: "empty", Value: ""},
+	}
+
+	var buf bytes.Buffer
+	writer := bufio.NewWriter(&buf)
+	encoder, err := newSnapshotEncoder(writer)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	writer.Flush()
+
+	decoded, err := decodeSnapshot(bufio.NewReader(bytes.NewReader(buf.Bytes())))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if !reflect.DeepEqual(decoded, entries) {
+		t.Fatalf("Expected %v, got %v", entries, decoded)
+	}
+
+	// Cutting the last entry short is an error rather than a silent loss.
+	truncated := buf.Bytes()[:buf.Len()-2]
+	if _, err := decodeSnapshot(bufio.NewReader(bytes.NewReader(truncated))); err == nil {
+		t.Fatalf("Expected a truncated snapshot to fail")
+	}
+}
+
+func TestDecodeJSONSnapshot(t *testing.T) {
+	legacy := `{"Key":"key1","Value":"value1"}
+{"Key":"key2","Value":"value2","ExpiresAt":1500000000000000000}
+`
+	entries, err := decodeSnapshot(bufio.NewReader(strings.NewReader(legacy)))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	expected := []snapshotEntry{
+		{Key: "key1", Value: "value1"},
+		{Key: "key2", Value: "value2", ExpiresAt: 1500000000000000000},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Fatalf("Expected %v, got %v", expected, entries)
+	}
+}
+
+func TestDecodeEmptySnapshot(t *testing.T) {
+	entries, err := decodeSnapshot(bufio.NewReader(strings.NewReader("")))
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("Expected no entries, got %v (%v)", entries, err)
+	}
+}
@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"sync/atomic"
+)
+
+// Stats is a point-in-time snapshot of the cache's counters.
+type Stats struct {
+	// ClampedTTLs counts expirations which were cut down to MaxTTLSeconds.
+	ClampedTTLs uint64 `json:"clamped_ttls"`
+	// RetryQueueDepth is how many replication writes are waiting to be
+	// retried, across every replica.
+	RetryQueueDepth uint64 `json:"retry_queue_depth"`
+	// Hints is how many writes are waiting for their owner to connect
+	// again, see HintedHandoffLimit.
+	Hints uint64 `json:"hints"`
+	// DroppedExpireEvents counts expiration events which were dropped
+	// because a stream's channel was full.
+	DroppedExpireEvents uint64 `json:"dropped_expire_events"`
+	// DroppedChangeEvents counts change events which were dropped because a
+	// stream's channel was full.
+	DroppedChangeEvents uint64 `json:"dropped_change_events"`
+	// DroppedKeyspaceEvents counts keyspace events which were dropped
+	// because a subscription's channel was full.
+	DroppedKeyspaceEvents uint64 `json:"dropped_keyspace_events"`
+	// RedundantSets counts SETs which wrote the value a key already held.
+	RedundantSets uint64 `json:"redundant_sets"`
+	// ReadCacheRebuilds counts how often the read cache was rebuilt.
+	ReadCacheRebuilds uint64 `json:"read_cache_rebuilds"`
+	// RemoteLookups counts GETs sent to peers whose bloom filter claimed
+	// the key.
+	RemoteLookups uint64 `json:"remote_lookups"`
+	// WastedRemoteLookups counts the RemoteLookups whose peer didn't have
+	// the key, i.e. the bloom filter's false positives.
+	WastedRemoteLookups uint64 `json:"wasted_remote_lookups"`
+	// BloomfilterResizes counts how often adaptive resizing grew our bloom
+	// filters.
+	BloomfilterResizes uint64 `json:"bloomfilter_resizes"`
+	// LRUEvictions counts keys evicted to stay within MaxEntries or
+	// MaxBytes.
+	LRUEvictions uint64 `json:"lru_evictions"`
+	// Hits counts reads which found their key, locally or on a peer.
+	Hits uint64 `json:"hits"`
+	// Misses counts reads which didn't find their key anywhere.
+	Misses uint64 `json:"misses"`
+	// RemoteFetches counts the Hits which were served by a peer.
+	RemoteFetches uint64 `json:"remote_fetches"`
+	// Sets counts writes which stored a value, redundant sets which were
+	// skipped left out.
+	Sets uint64 `json:"sets"`
+	// Expirations counts keys removed because their TTL ran out.
+	Expirations uint64 `json:"expirations"`
+	// Keys is how many keys the cache currently holds.
+	Keys uint64 `json:"keys"`
+	// BloomfilterSetBits is how many of our bloom filter's bits are set.
+	BloomfilterSetBits uint64 `json:"bloomfilter_set_bits"`
+	// BloomfilterEstimatedKeys is how many keys our bloom filter is
+	// estimated to hold, going by its set bits.
+	BloomfilterEstimatedKeys uint64 `json:"bloomfilter_estimated_keys"`
+	// BloomfilterFPRate is our bloom filter's estimated false-positive
+	// rate, going by its set bits.
+	BloomfilterFPRate float64 `json:"bloomfilter_fp_rate"`
+}
+
+// counters holds the live counters behind Stats. Every field is only ever
+// touched atomically, so the hot path never waits on the cache lock to count.
+type counters struct {
+	clampedTTLs           uint64
+	droppedExpireEvents   uint64
+	droppedChangeEvents   uint64
+	droppedKeyspaceEvents uint64
+	redundantSets         uint64
+	readCacheRebuilds     uint64
+	remoteLookups         uint64
+	wastedRemoteLookups   uint64
+	bloomfilterResizes    uint64
+	lruEvictions          uint64
+	hits                  uint64
+	misses                uint64
+	remoteFetches         uint64
+	sets                  uint64
+	expirations           uint64
+}
+
+// Stats returns a snapshot of the cache's counters.
+func (c *Cache) Stats() Stats {
+	setBits, estimatedKeys, fpRate := c.bloomEstimates()
+
+	return Stats{
+		ClampedTTLs:              atomic.LoadUint64(&c.counters.clampedTTLs),
+		RetryQueueDepth:          c.retryQueueDepth(),
+		Hints:                    c.hintCount(),
+		DroppedExpireEvents:      atomic.LoadUint64(&c.counters.droppedExpireEvents),
+		DroppedChangeEvents:      atomic.LoadUint64(&c.counters.droppedChangeEvents),
+		DroppedKeyspaceEvents:    atomic.LoadUint64(&c.counters.droppedKeyspaceEvents),
+		RedundantSets:            atomic.LoadUint64(&c.counters.redundantSets),
+		ReadCacheRebuilds:        atomic.LoadUint64(&c.counters.readCacheRebuilds),
+		RemoteLookups:            atomic.LoadUint64(&c.counters.remoteLookups),
+		WastedRemoteLookups:      atomic.LoadUint64(&c.counters.wastedRemoteLookups),
+		BloomfilterResizes:       atomic.LoadUint64(&c.counters.bloomfilterResizes),
+		LRUEvictions:             atomic.LoadUint64(&c.counters.lruEvictions),
+		Hits:                     atomic.LoadUint64(&c.counters.hits),
+		Misses:                   atomic.LoadUint64(&c.counters.misses),
+		RemoteFetches:            atomic.LoadUint64(&c.counters.remoteFetches),
+		Sets:                     atomic.LoadUint64(&c.counters.sets),
+		Expirations:              atomic.LoadUint64(&c.counters.expirations),
+		Keys:                     uint64(c.keyCount()),
+		BloomfilterSetBits:       uint64(setBits),
+		BloomfilterEstimatedKeys: uint64(estimatedKeys),
+		BloomfilterFPRate:        fpRate,
+	}
+}
+
+// countRead counts a read of a key: a hit if it was found, which `remote`
+// says was served by a peer.
+func (c *Cache) countRead(found bool, remote bool) {
+	if !found {
+		atomic.AddUint64(&c.counters.misses, 1)
+		return
+	}
+
+	atomic.AddUint64(&c.counters.hits, 1)
+	if remote {
+		atomic.AddUint64(&c.counters.remoteFetches, 1)
+	}
+}
@@ -0,0 +1,37 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStatsCountReadsAndWrites(t *testing.T) {
+	stub := newStubPeer(t, map[string]string{"remote": "value"})
+	defer stub.Close()
+
+	cache := newCacheWithStubPeers(t, stub)
+	cache.Set("key1", "value1")
+	cache.SetExpiration("key2", "value2", 1)
+	cache.Delete("key1")
+
+	cache.Get("key2")
+	cache.Get("remote")
+	cache.Get("missing")
+	cache.GetMany([]string{"key2", "remote", "missing"})
+	cache.EvictExpiredkeys(time.Now().UTC().Add(time.Minute))
+
+	stats := cache.Stats()
+	expected := Stats{Hits: 4, Misses: 2, RemoteFetches: 2, Sets: 2, Expirations: 1, Keys: 0}
+	actual := Stats{
+		Hits:          stats.Hits,
+		Misses:        stats.Misses,
+		RemoteFetches: stats.RemoteFetches,
+		Sets:          stats.Sets,
+		Expirations:   stats.Expirations,
+		Keys:          stats.Keys,
+	}
+
+	if actual != expected {
+		t.Fatalf("Expected %+v, got %+v", expected, actual)
+	}
+}
@@ -0,0 +1,359 @@
+package cache
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/GrappigPanda/Olivia/bloomfilter"
+	"github.com/GrappigPanda/Olivia/config"
+	"github.com/GrappigPanda/Olivia/dht"
+	"github.com/GrappigPanda/Olivia/network/message_handler"
+	"github.com/GrappigPanda/Olivia/parser"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// stubPeer is a tiny stand-in for a remote Olivia node. It answers GETs from
+// a fixed set of values and hands out a bloom filter containing those keys.
+type stubPeer struct {
+	listener net.Listener
+	values   map[string]string
+	// versions holds the versions of the values, as they're written on the
+	// wire. Values without one are unversioned.
+	versions map[string]string
+	gets     int32
+	// failReplicates is how many of the next REPLICATEs are refused.
+	failReplicates int32
+	// failTombstones is how many of the next TOMBSTONEs are answered with
+	// an error rather than an ack.
+	failTombstones int32
+	// silenced is how many of the next GOSSIPs go unanswered.
+	silenced int32
+	// getDelay holds up every answer to a GET.
+	getDelay time.Duration
+	// members are gossiped along with the stub itself.
+	members []string
+	// gossip holds every member gossiped to the stub.
+	gossip []string
+	// bloomAdds holds every bloom filter delta sent to the stub.
+	bloomAdds []string
+	// relays holds every published message relayed to the stub.
+	relays []string
+	sync.Mutex
+}
+
+func newStubPeer(t *testing.T, values map[string]string) *stubPeer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	stub := &stubPeer{
+		listener: listener,
+		values:   values,
+		versions: make(map[string]string),
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go stub.serve(conn)
+		}
+	}()
+
+	return stub
+}
+
+func (s *stubPeer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Gets returns how many GETs the stub has answered.
+func (s *stubPeer) Gets() int {
+	return int(atomic.LoadInt32(&s.gets))
+}
+
+// FailReplicates makes the stub refuse the next `count` REPLICATEs.
+func (s *stubPeer) FailReplicates(count int) {
+	atomic.StoreInt32(&s.failReplicates, int32(count))
+}
+
+// FailTombstones makes the stub answer the next `count` TOMBSTONEs with an
+// error.
+func (s *stubPeer) FailTombstones(count int) {
+	atomic.StoreInt32(&s.failTombstones, int32(count))
+}
+
+// delayGets holds up every answer to a GET by `delay`.
+func (s *stubPeer) delayGets(delay time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.getDelay = delay
+}
+
+// silenceGossip makes the stub leave its next GOSSIP unanswered.
+func (s *stubPeer) silenceGossip() {
+	atomic.StoreInt32(&s.silenced, 1)
+}
+
+// Gossiped reports whether `member` was gossiped to the stub.
+func (s *stubPeer) Gossiped(member dht.Member) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, gossiped := range s.gossip {
+		if gossiped == member.Format() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Value returns the value the stub holds for a key.
+func (s *stubPeer) Value(key string) (string, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	value, ok := s.values[key]
+	return value, ok
+}
+
+// Version returns the version the stub holds a key's value at.
+func (s *stubPeer) Version(key string) string {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.versions[key]
+}
+
+// BloomAdds returns the bloom filter deltas sent to the stub, as
+// `host_port:indices`.
+func (s *stubPeer) BloomAdds() []string {
+	s.Lock()
+	defer s.Unlock()
+
+	return append([]string{}, s.bloomAdds...)
+}
+
+// Relays returns the messages relayed to the stub, as `channel:message`.
+func (s *stubPeer) Relays() []string {
+	s.Lock()
+	defer s.Unlock()
+
+	return append([]string{}, s.relays...)
+}
+
+func (s *stubPeer) Close() {
+	s.listener.Close()
+}
+
+func (s *stubPeer) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	for {
+		line, payloads, err := parser.ReadFramed(reader)
+		if err != nil {
+			return
+		}
+
+		command, err := parser.NewParser(nil).ParseFramed(line, payloads, nil)
+		if err != nil {
+			continue
+		}
+
+		if strings.ToUpper(command.Command) == "GOSSIP" && atomic.AddInt32(&s.silenced, -1) >= 0 {
+			continue
+		}
+		if strings.ToUpper(command.Command) == "GET" {
+			s.Lock()
+			delay := s.getDelay
+			s.Unlock()
+			time.Sleep(delay)
+		}
+		conn.Write([]byte(s.respond(command)))
+	}
+}
+
+func (s *stubPeer) respond(command *parser.CommandData) string {
+	s.Lock()
+	defer s.Unlock()
+
+	switch strings.ToUpper(command.Command) {
+	case "GET":
+		atomic.AddInt32(&s.gets, 1)
+
+		var retVals []string
+		var payloads []string
+		for k := range command.Args {
+			if value, ok := s.values[k]; ok {
+				token, payload, framed := parser.FrameValue(value)
+				if framed {
+					payloads = append(payloads, payload)
+				}
+				retVals = append(retVals, fmt.Sprintf("%s:%s", k, token))
+			}
+		}
+
+		return parser.AppendPayloads(
+			fmt.Sprintf("%s:GOT %s\n", command.Hash, strings.Join(retVals, ",")),
+			payloads,
+		)
+	case "VGET":
+		var retVals []string
+		var payloads []string
+		for k := range command.Args {
+			if value, ok := s.values[k]; ok {
+				token, payload, framed := parser.FrameValue(value)
+				if framed {
+					payloads = append(payloads, payload)
+				}
+				version := s.versions[k]
+				if version == "" {
+					version = "0"
+				}
+				retVals = append(retVals, fmt.Sprintf("%s:%s:0:%s", k, token, version))
+			}
+		}
+
+		return parser.AppendPayloads(
+			fmt.Sprintf("%s:VGOT %s\n", command.Hash, strings.Join(retVals, ",")),
+			payloads,
+		)
+	case "REPLICATE", "REPLICATELIST", "REPLICATEHASH":
+		fail := atomic.AddInt32(&s.failReplicates, -1) >= 0
+
+		var retVals []string
+		for k, v := range command.Args {
+			if fail {
+				retVals = append(retVals, fmt.Sprintf("%s:ERR", k))
+				continue
+			}
+
+			s.values[k] = v
+			s.versions[k] = command.Versions[k]
+			retVals = append(retVals, fmt.Sprintf("%s:OK", k))
+		}
+
+		return fmt.Sprintf("%s:REPLICATED %s\n", command.Hash, strings.Join(retVals, ","))
+	case "TOMBSTONE":
+		if atomic.AddInt32(&s.failTombstones, -1) >= 0 {
+			break
+		}
+
+		var retVals []string
+		for k := range command.Args {
+			delete(s.values, k)
+			retVals = append(retVals, fmt.Sprintf("%s:OK", k))
+		}
+
+		return fmt.Sprintf("%s:TOMBSTONED %s\n", command.Hash, strings.Join(retVals, ","))
+	case "REQUEST":
+		for k := range command.Args {
+			if strings.ToUpper(k) == "CUCKOOFILTER" {
+				cf := bloomfilter.NewCuckooByFailRate(baseBloomItems, 0.01)
+				for k := range s.values {
+					cf.Insert([]byte(k))
+				}
+
+				return fmt.Sprintf("%s:FULFILLED %s\n", command.Hash, cf.Serialize())
+			}
+		}
+
+		bf := bloomfilter.NewByFailRate(uint(stubConfig().BloomfilterSize), 0.01)
+		for k := range s.values {
+			bf.AddKey([]byte(k))
+		}
+
+		return fmt.Sprintf("%s:FULFILLED %s\n", command.Hash, bf.Serialize())
+	case "GOSSIP":
+		for k, v := range command.Args {
+			s.gossip = append(s.gossip, fmt.Sprintf("%s:%s:%s", k, v, command.Expiration[k]))
+		}
+
+		// The stub only ever gossips itself, alive, along with whatever
+		// members it was told to.
+		members := append([]string{
+			dht.Member{Address: s.Addr(), State: dht.Alive}.Format(),
+		}, s.members...)
+
+		return fmt.Sprintf("%s:GOSSIPED %s\n", command.Hash, strings.Join(members, ","))
+	case "BLOOMADD":
+		var retVals []string
+		for k, v := range command.Args {
+			s.bloomAdds = append(s.bloomAdds, fmt.Sprintf("%s:%s", k, v))
+			retVals = append(retVals, fmt.Sprintf("%s:OK", k))
+		}
+
+		return fmt.Sprintf("%s:BLOOMADDED %s\n", command.Hash, strings.Join(retVals, ","))
+	case "RELAY":
+		for k, v := range command.Args {
+			s.relays = append(s.relays, fmt.Sprintf("%s:%s", k, v))
+		}
+
+		return fmt.Sprintf("%s:RELAYED 0\n", command.Hash)
+	case "PING":
+		return "0:PONG 1\n"
+	}
+
+	return fmt.Sprintf("%s:Invalid command sent in.\n", command.Hash)
+}
+
+func stubConfig() *config.Cfg {
+	return &config.Cfg{
+		BloomfilterSize: 1000,
+		IsTesting:       true,
+	}
+}
+
+// newCacheWithStubPeers creates a cache whose peer list is made up of the
+// stubs, connected and with their bloom filters already fetched.
+func newCacheWithStubPeers(t *testing.T, stubs ...*stubPeer) *Cache {
+	cfg := stubConfig()
+	for _, stub := range stubs {
+		cfg.RemotePeers = append(cfg.RemotePeers, stub.Addr())
+	}
+
+	cache := NewCache(message_handler.NewMessageHandler(), cfg)
+
+	for i, stub := range stubs {
+		peer := cache.PeerList.Peers[i]
+		if err := peer.Connect(); err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		// Bloom filters are fetched asynchronously after connecting.
+		for attempt := 0; ; attempt++ {
+			peer.Lock()
+			received := true
+			for k := range stub.values {
+				if ok, _ := peer.BloomFilter.HasKey([]byte(k)); !ok {
+					received = false
+				}
+			}
+			peer.Unlock()
+
+			if received {
+				break
+			}
+			if attempt == 100 {
+				t.Fatalf("Never received a bloom filter from %v", stub.Addr())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	if len(stubs) > 0 {
+		cache.AddPeer(stubs[0].Addr())
+	}
+
+	return cache
+}
@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"fmt"
+	binheap "github.com/GrappigPanda/Olivia/shared"
+	"math"
+	"time"
+)
+
+// NoExpiration is the TTL GetTTL returns for a key which never expires.
+const NoExpiration = -1
+
+// GetTTL returns how many seconds `key` has left before it expires, rounded
+// up, or NoExpiration if it doesn't expire. Only keys we hold are looked up;
+// peers aren't asked.
+func (c *Cache) GetTTL(key string) (int, error) {
+	var ok, expires bool
+	var expiresAt time.Time
+	c.readKey(key, func(shard *cacheShard) {
+		if _, ok = shard.entries[key]; !ok {
+			return
+		}
+
+		var node *binheap.Node
+		if node, expires = shard.expirations.Get(key); expires {
+			expiresAt = node.Timeout
+		}
+	})
+
+	if !ok {
+		return 0, fmt.Errorf("Key not found in cache")
+	}
+
+	if !expires {
+		return NoExpiration, nil
+	}
+
+	// A key past its expiration waits for the next sweep to be removed.
+	remaining := time.Until(expiresAt).Seconds()
+	if remaining <= 0 {
+		return 0, nil
+	}
+
+	return int(math.Ceil(remaining)), nil
+}
+
+// Expire makes a key we hold expire `timeout` seconds from now, replacing any
+// expiration it already had. The timeout is clamped to MaxTTLSeconds like any
+// other.
+func (c *Cache) Expire(key string, timeout int) error {
+	if timeout < 0 {
+		return fmt.Errorf("Invalid expiration %d: it can't be negative", timeout)
+	}
+	timeout = c.clampTTL(key, timeout)
+
+	return c.mutateKey(key, func(shard *cacheShard) error {
+		if _, ok := shard.entries[key]; !ok {
+			return fmt.Errorf("Key not found in cache")
+		}
+
+		// The value stays the same, but its expiration is part of the
+		// key's state owners converge on, so it's a new version of it.
+		shard.versions[key] = c.clock.next()
+		return c.expire(shard, key, timeout)
+	})
+}
+
+// Persist removes a key's expiration, so it's kept until it's deleted or
+// evicted. It returns whether the key had an expiration to remove.
+func (c *Cache) Persist(key string) (bool, error) {
+	removed := false
+	err := c.mutateKey(key, func(shard *cacheShard) error {
+		if _, ok := shard.entries[key]; !ok {
+			return fmt.Errorf("Key not found in cache")
+		}
+
+		var err error
+		if removed, err = c.persist(shard, key); removed {
+			shard.versions[key] = c.clock.next()
+		}
+
+		return err
+	})
+
+	return removed, err
+}
+
+// persist removes `key`'s expiration, reporting whether it had one. The
+// caller must hold the lock of the key's shard.
+func (c *Cache) persist(shard *cacheShard, key string) (bool, error) {
+	if _, pending := shard.expirations.Get(key); !pending {
+		return false, nil
+	}
+
+	if err := c.logWrite(walRecord{Op: walPersist, Key: key}); err != nil {
+		return false, err
+	}
+	shard.expirations.Remove(key)
+
+	return true, nil
+}
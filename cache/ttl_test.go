@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetTTL(t *testing.T) {
+	cache := NewCache(nil, stubConfig())
+	cache.Set("forever", "value")
+	cache.SetExpiration("expiring", "value", 60)
+
+	if ttl, err := cache.GetTTL("forever"); err != nil || ttl != NoExpiration {
+		t.Fatalf("Expected %v, got %v (%v)", NoExpiration, ttl, err)
+	}
+
+	if ttl, err := cache.GetTTL("expiring"); err != nil || ttl != 60 {
+		t.Fatalf("Expected %v, got %v (%v)", 60, ttl, err)
+	}
+
+	if _, err := cache.GetTTL("missing"); err == nil {
+		t.Fatalf("Expected an error for a missing key")
+	}
+}
+
+func TestGetTTLAfterOverwrite(t *testing.T) {
+	cache := NewCache(nil, stubConfig())
+	cache.SetExpiration("key", "value", 60)
+	cache.SetExpiration("key", "value", 5)
+
+	if ttl, _ := cache.GetTTL("key"); ttl != 5 {
+		t.Fatalf("Expected %v, got %v", 5, ttl)
+	}
+}
+
+func TestExpireExistingKey(t *testing.T) {
+	cache := NewCache(nil, stubConfig())
+	cache.Set("key", "value")
+
+	if err := cache.Expire("key", 30); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if ttl, _ := cache.GetTTL("key"); ttl != 30 {
+		t.Fatalf("Expected %v, got %v", 30, ttl)
+	}
+
+	// Expiring again moves the expiration rather than adding another.
+	if err := cache.Expire("key", 90); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if ttl, _ := cache.GetTTL("key"); ttl != 90 {
+		t.Fatalf("Expected %v, got %v", 90, ttl)
+	}
+	if count := cache.ExpirationCount(); count != 1 {
+		t.Fatalf("Expected %v, got %v", 1, count)
+	}
+
+	if err := cache.Expire("missing", 30); err == nil {
+		t.Fatalf("Expected an error for a missing key")
+	}
+	if err := cache.Expire("key", -1); err == nil {
+		t.Fatalf("Expected an error for a negative expiration")
+	}
+}
+
+func TestExpireZeroEvictsOnSweep(t *testing.T) {
+	cache := NewCache(nil, stubConfig())
+	cache.Set("key", "value")
+	cache.Expire("key", 0)
+	time.Sleep(10 * time.Millisecond)
+
+	cache.EvictExpiredkeys(time.Now().UTC())
+	if _, err := cache.Get("key"); err == nil {
+		t.Fatalf("Expected the key to be expired")
+	}
+}
+
+func TestPersist(t *testing.T) {
+	cache := NewCache(nil, stubConfig())
+	cache.SetExpiration("key", "value", 30)
+
+	if removed, err := cache.Persist("key"); err != nil || !removed {
+		t.Fatalf("Expected the expiration to be removed, got %v (%v)", removed, err)
+	}
+	if ttl, _ := cache.GetTTL("key"); ttl != NoExpiration {
+		t.Fatalf("Expected %v, got %v", NoExpiration, ttl)
+	}
+
+	if removed, err := cache.Persist("key"); err != nil || removed {
+		t.Fatalf("Expected nothing to remove, got %v (%v)", removed, err)
+	}
+	if _, err := cache.Persist("missing"); err == nil {
+		t.Fatalf("Expected an error for a missing key")
+	}
+}
+
+func TestExpireAndPersistSurviveReplay(t *testing.T) {
+	cfg, cleanup := durableConfig(t)
+	defer cleanup()
+
+	cache := NewCache(nil, cfg)
+	cache.Set("expiring", "value")
+	cache.Expire("expiring", 60)
+	cache.SetExpiration("persisted", "value", 60)
+	cache.Persist("persisted")
+	cache.wal.Close()
+
+	restarted := NewCache(nil, cfg)
+	if ttl, _ := restarted.GetTTL("expiring"); ttl < 50 {
+		t.Fatalf("Expected the expiration to survive the replay, got %v", ttl)
+	}
+	if ttl, _ := restarted.GetTTL("persisted"); ttl != NoExpiration {
+		t.Fatalf("Expected %v, got %v", NoExpiration, ttl)
+	}
+}
@@ -0,0 +1,221 @@
+package cache
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"unsafe"
+)
+
+// ErrWrongType is returned when a key is used as the wrong type of value,
+// e.g. pushing onto a key holding a string or getting a key holding a list.
+var ErrWrongType = errors.New("Key holds the wrong type of value")
+
+// ValueKind is the type of value a key holds.
+type ValueKind byte
+
+const (
+	// KindString is a plain string, which every key holds unless its shard
+	// holds a typedValue for it.
+	KindString ValueKind = iota
+	// KindList is a list, see LPush.
+	KindList
+	// KindHash is a hash of fields, see HSet.
+	KindHash
+)
+
+// itemOverhead is the approximate number of bytes a list item, or a hash's
+// field or value, takes up on top of its own, for its string header.
+var itemOverhead = int(unsafe.Sizeof(""))
+
+// typedValue is the value of a key holding anything but a string. The key's
+// entry holds an empty string, so the key is counted, expired, evicted and
+// deleted like any other, while its type and contents are kept here rather
+// than in a value a string could just as well hold.
+type typedValue struct {
+	kind ValueKind
+	// items are a list's items, and fields a hash's.
+	items  itemList
+	fields map[string]string
+	// bytes is the size of the contents, which MaxValueBytes limits.
+	bytes int
+}
+
+// newTypedValue creates an empty value of `kind`.
+func newTypedValue(kind ValueKind) *typedValue {
+	value := &typedValue{kind: kind}
+	if kind == KindHash {
+		value.fields = make(map[string]string)
+	}
+
+	return value
+}
+
+// size is the approximate number of bytes the value takes up on top of its
+// key's entry.
+func (v *typedValue) size() int {
+	return v.bytes + (v.items.len()+2*len(v.fields))*itemOverhead
+}
+
+// encode encodes the value as a string, to be snapshotted or replicated
+// along with its kind: a list's items in order, or a hash's fields and
+// values sorted by field, so equal hashes always encode equally.
+func (v *typedValue) encode() string {
+	if v.kind == KindHash {
+		names := make([]string, 0, len(v.fields))
+		for field := range v.fields {
+			names = append(names, field)
+		}
+		sort.Strings(names)
+
+		items := make([]string, 0, 2*len(names))
+		for _, field := range names {
+			items = append(items, field, v.fields[field])
+		}
+
+		return encodeItems(items)
+	}
+
+	items := make([]string, v.items.len())
+	for i := range items {
+		items[i] = v.items.at(i)
+	}
+
+	return encodeItems(items)
+}
+
+// decodeTypedValue decodes a value of `kind` encode encoded.
+func decodeTypedValue(kind ValueKind, encoded string) (*typedValue, error) {
+	if kind != KindList && kind != KindHash {
+		return nil, ErrWrongType
+	}
+
+	items, err := decodeItems(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if kind == KindHash && len(items)%2 != 0 {
+		return nil, errors.New("Malformed value")
+	}
+
+	value := newTypedValue(kind)
+	for i, item := range items {
+		if kind == KindHash && i%2 == 1 {
+			value.setField(items[i-1], item)
+		} else if kind == KindList {
+			value.items.pushBack(item)
+			value.bytes += len(item)
+		}
+	}
+
+	return value, nil
+}
+
+// typedOf returns the value of `kind` `key` holds, nil if the key is
+// missing, or ErrWrongType if it holds another type of value. The caller
+// must hold the shard's lock.
+func (s *cacheShard) typedOf(key string, kind ValueKind) (*typedValue, error) {
+	if value, ok := s.typed[key]; ok && value.kind == kind {
+		return value, nil
+	}
+	if _, ok := s.entries[key]; ok {
+		return nil, ErrWrongType
+	}
+
+	return nil, nil
+}
+
+// stringOf returns the string `key` holds and whether it's there, or
+// ErrWrongType if it holds another type of value. The caller must hold the
+// shard's lock.
+func (s *cacheShard) stringOf(key string) (string, bool, error) {
+	if _, ok := s.typed[key]; ok {
+		return "", false, ErrWrongType
+	}
+
+	value, ok := s.entries[key]
+	return value, ok, nil
+}
+
+// encodeItems encodes items as a single value, each prefixed by its length,
+// e.g. "5:hello3:foo".
+func encodeItems(items []string) string {
+	var builder strings.Builder
+	for _, item := range items {
+		builder.WriteString(strconv.Itoa(len(item)))
+		builder.WriteByte(':')
+		builder.WriteString(item)
+	}
+
+	return builder.String()
+}
+
+// decodeItems decodes a value encodeItems encoded.
+func decodeItems(value string) ([]string, error) {
+	var items []string
+	for rest := value; rest != ""; {
+		separator := strings.IndexByte(rest, ':')
+		if separator < 0 {
+			return nil, errors.New("Malformed value")
+		}
+
+		length, err := strconv.Atoi(rest[:separator])
+		if err != nil || length < 0 || length > len(rest)-separator-1 {
+			return nil, errors.New("Malformed value")
+		}
+
+		rest = rest[separator+1:]
+		items = append(items, rest[:length])
+		rest = rest[length:]
+	}
+
+	return items, nil
+}
+
+// storeTyped makes `value` the whole value of `key`, replacing whatever it
+// held, without announcing the write (see typedWritten). The caller must hold
+// the lock of the key's shard and have logged the write.
+func (c *Cache) storeTyped(shard *cacheShard, key string, value *typedValue) {
+	c.putEntry(shard, key, "")
+	shard.typed[key] = value
+	atomic.AddInt64(&c.usedBytes, int64(value.size()))
+}
+
+// typedWritten announces a write of the value `key` holds, at `version`,
+// which changed its size by `grown` bytes. The caller must hold the lock of
+// the key's shard and publish it afterwards.
+func (c *Cache) typedWritten(shard *cacheShard, key string, grown int, version uint64) {
+	atomic.AddInt64(&c.usedBytes, int64(grown))
+	shard.versions[key] = version
+	shard.written[key] = struct{}{}
+	c.touchKey(key)
+	atomic.AddUint64(&c.counters.sets, 1)
+	c.publishChange(key, ChangeSet, "")
+	c.notifyKeyspace(key, KeyspaceSet)
+}
+
+// dropTyped forgets the value `key` holds if it isn't a string. The caller
+// must hold the lock of the key's shard.
+func (c *Cache) dropTyped(shard *cacheShard, key string) {
+	if value, ok := shard.typed[key]; ok {
+		atomic.AddInt64(&c.usedBytes, -int64(value.size()))
+		delete(shard.typed, key)
+	}
+}
+
+// validateTyped checks a list or hash growing by `grown` bytes against
+// MaxValueBytes.
+func (c *Cache) validateTyped(value *typedValue, grown int) error {
+	bytes := grown
+	if value != nil {
+		bytes += value.bytes
+	}
+
+	if c.config.MaxValueBytes > 0 && bytes > c.config.MaxValueBytes {
+		return ErrValueTooLarge
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// lamportClock hands out the versions writes are ordered by across nodes.
+// Every version is greater than any we've handed out or received before, so
+// a write always orders after the writes its node has seen. Versions start
+// from the wall clock rather than zero, so a restarted node's writes don't
+// order before the ones it made before restarting.
+type lamportClock struct {
+	last uint64
+}
+
+// next returns a new version.
+func (l *lamportClock) next() uint64 {
+	for {
+		last := atomic.LoadUint64(&l.last)
+		next := last + 1
+		if now := uint64(time.Now().UnixNano()); now > next {
+			next = now
+		}
+
+		if atomic.CompareAndSwapUint64(&l.last, last, next) {
+			return next
+		}
+	}
+}
+
+// observe moves the clock past a version received from another node.
+func (l *lamportClock) observe(version uint64) {
+	for {
+		last := atomic.LoadUint64(&l.last)
+		if version <= last || atomic.CompareAndSwapUint64(&l.last, last, version) {
+			return
+		}
+	}
+}
+
+// supersedes reports whether a write of `value` at `version` orders after the
+// `current` one. Two nodes can hand out the same version, so ties are broken
+// by the larger value, for every node to keep the same one.
+func supersedes(version uint64, value string, current uint64, currentValue string) bool {
+	if version != current {
+		return version > current
+	}
+
+	return value > currentValue
+}
+
+// stale reports whether a write of `value` at `version` orders before the
+// one `key` already holds, moving our clock past the version either way. A
+// zero version is an unversioned write, which is never stale. The caller
+// must hold the lock of the key's shard.
+func (c *Cache) stale(shard *cacheShard, key string, value string, version uint64) bool {
+	if version == 0 {
+		return false
+	}
+
+	c.clock.observe(version)
+
+	// Ties are broken by value, so a list or hash is only encoded for one.
+	current := shard.entries[key]
+	if typed, ok := shard.typed[key]; ok && version == shard.versions[key] {
+		current = typed.encode()
+	}
+
+	return !supersedes(version, value, shard.versions[key], current)
+}
+
+// setVersioned is set at `version`, or under a new version if it's zero.
+func (c *Cache) setVersioned(shard *cacheShard, key string, value string, version uint64) (bool, error) {
+	if version == 0 {
+		return c.set(shard, key, value)
+	}
+
+	return c.setAt(shard, key, value, version)
+}
+
+// Version returns the version `key`'s value was written at, zero if it was
+// restored from disk.
+func (c *Cache) Version(key string) (uint64, bool) {
+	var version uint64
+	var ok bool
+	c.readKey(key, func(shard *cacheShard) {
+		if _, ok = shard.entries[key]; ok {
+			version = shard.versions[key]
+		}
+	})
+
+	return version, ok
+}
+
+// GetLocalVersioned reads our own copy of `key` along with the version it was
+// written at, without asking any other node, for a coordinator comparing the
+// copies replicas hold. It returns ErrWrongType if the key holds a list or
+// hash.
+func (c *Cache) GetLocalVersioned(key string) (string, uint64, bool, error) {
+	var value string
+	var version uint64
+	var ok bool
+	var err error
+	c.readKey(key, func(shard *cacheShard) {
+		if value, ok, err = shard.stringOf(key); ok {
+			version = shard.versions[key]
+		}
+	})
+
+	return value, version, ok, err
+}
@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"github.com/GrappigPanda/Olivia/config"
+	"testing"
+)
+
+func TestLamportClock(t *testing.T) {
+	var clock lamportClock
+
+	first := clock.next()
+	if second := clock.next(); second <= first {
+		t.Fatalf("Expected %v to be after %v", second, first)
+	}
+
+	clock.observe(first + 1000000000000)
+	if next := clock.next(); next <= first+1000000000000 {
+		t.Fatalf("Expected %v to be after the observed version", next)
+	}
+}
+
+func TestSupersedes(t *testing.T) {
+	if !supersedes(2, "a", 1, "b") || supersedes(1, "b", 2, "a") {
+		t.Fatalf("Expected the later version to win")
+	}
+
+	// Ties go to the larger value, whichever order they arrive in.
+	if !supersedes(1, "b", 1, "a") || supersedes(1, "a", 1, "b") {
+		t.Fatalf("Expected the larger value to win a tie")
+	}
+}
+
+func TestReplicatedWritesApplyInVersionOrder(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{IsTesting: true})
+
+	cache.ApplyReplicationBatch([]ReplicationEntry{{Key: "key", Value: "newer", Version: 20}})
+	acks := cache.ApplyReplicationBatch([]ReplicationEntry{{Key: "key", Value: "older", Version: 10}})
+
+	// The stale write is acked, as we're already past it.
+	if acks[0].Err != nil {
+		t.Fatalf("%v", acks[0].Err)
+	}
+	if value, _ := cache.Get("key"); value != "newer" {
+		t.Fatalf("Expected %v, got %v", "newer", value)
+	}
+	if version, _ := cache.Version("key"); version != 20 {
+		t.Fatalf("Expected %v, got %v", 20, version)
+	}
+
+	// Our own writes are versioned after anything we've received.
+	cache.Set("key", "local")
+	if version, _ := cache.Version("key"); version <= 20 {
+		t.Fatalf("Expected a version after %v, got %v", 20, version)
+	}
+}
+
+func TestReplicatedDeletesSkipOlderWrites(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{IsTesting: true})
+
+	cache.ApplyReplicationBatch([]ReplicationEntry{{Key: "key", Value: "value", Version: 10}})
+	cache.ApplyReplicationBatch([]ReplicationEntry{{Key: "key", Version: 20, Deleted: true}})
+	acks := cache.ApplyReplicationBatch([]ReplicationEntry{{Key: "key", Value: "older", Version: 15}})
+
+	if acks[0].Err != nil {
+		t.Fatalf("%v", acks[0].Err)
+	}
+	if value, ok := cache.readValue("key"); ok {
+		t.Fatalf("Expected the deletion to win, got %v", value)
+	}
+
+	cache.ApplyReplicationBatch([]ReplicationEntry{{Key: "key", Value: "newer", Version: 30}})
+	if value, ok := cache.readValue("key"); !ok || value != "newer" {
+		t.Fatalf("Expected %v, got %v", "newer", value)
+	}
+}
+
+func TestUnversionedReplicatedWritesAlwaysApply(t *testing.T) {
+	cache := NewCache(nil, &config.Cfg{IsTesting: true})
+
+	cache.Set("key", "local")
+	cache.ApplyReplicationBatch([]ReplicationEntry{{Key: "key", Value: "replicated"}})
+
+	if value, _ := cache.Get("key"); value != "replicated" {
+		t.Fatalf("Expected %v, got %v", "replicated", value)
+	}
+}
+
+func TestOwnersAgreeOnConcurrentWrites(t *testing.T) {
+	first := NewCache(nil, &config.Cfg{IsTesting: true})
+	second := NewCache(nil, &config.Cfg{IsTesting: true})
+
+	a := ReplicationEntry{Key: "key", Value: "a", Version: 5}
+	b := ReplicationEntry{Key: "key", Value: "b", Version: 5}
+
+	first.ApplyReplicationBatch([]ReplicationEntry{a})
+	first.ApplyReplicationBatch([]ReplicationEntry{b})
+	second.ApplyReplicationBatch([]ReplicationEntry{b})
+	second.ApplyReplicationBatch([]ReplicationEntry{a})
+
+	firstValue, _ := first.Get("key")
+	secondValue, _ := second.Get("key")
+	if firstValue != "b" || secondValue != "b" {
+		t.Fatalf("Expected both to keep %v, got %v and %v", "b", firstValue, secondValue)
+	}
+}
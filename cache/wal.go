@@ -0,0 +1,301 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/json"
+	binheap "github.com/GrappigPanda/Olivia/shared"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Operations recorded in the write-ahead log.
+const (
+	walSet     = "SET"
+	walDelete  = "DEL"
+	walExpire  = "EXPIRE"
+	walPersist = "PERSIST"
+	walLPush   = "LPUSH"
+	walRPush   = "RPUSH"
+	walLPop    = "LPOP"
+	walHSet    = "HSET"
+)
+
+// walRecord is a single write-ahead log entry. Records are stored one JSON
+// object per line, which keeps arbitrary (binary) keys and values on a single
+// line.
+type walRecord struct {
+	Op    string
+	Key   string
+	Value string `json:",omitempty"`
+	// ExpiresAt is the absolute expiration in unix nanoseconds, so a replay
+	// doesn't hand keys a fresh TTL.
+	ExpiresAt int64 `json:",omitempty"`
+	// Kind is the type of value a SET stores, Value holding it encoded
+	// when it isn't a string.
+	Kind ValueKind `json:",omitempty"`
+	// Items are the items a push pushes, and MaxLen what it trims the list
+	// down to, so pushes are logged without the rest of the list.
+	Items  []string `json:",omitempty"`
+	MaxLen int      `json:",omitempty"`
+	// Fields are the fields an HSET sets, likewise without the rest of the
+	// hash.
+	Fields map[string]string `json:",omitempty"`
+}
+
+// FsyncPolicy decides how often the write-ahead log is synced to disk.
+type FsyncPolicy int
+
+const (
+	// FsyncAlways syncs every record before its write is applied, so no
+	// acknowledged write is ever lost.
+	FsyncAlways FsyncPolicy = iota
+	// FsyncEverySecond syncs once a second, losing at most the last second
+	// of writes on a crash.
+	FsyncEverySecond
+	// FsyncNever leaves syncing to the operating system.
+	FsyncNever
+)
+
+// ParseFsyncPolicy parses a configured fsync policy: "always", "everysec" or
+// "never". Anything else is FsyncAlways.
+func ParseFsyncPolicy(policy string) FsyncPolicy {
+	switch strings.ToLower(policy) {
+	case "everysec":
+		return FsyncEverySecond
+	case "never":
+		return FsyncNever
+	}
+
+	return FsyncAlways
+}
+
+// walSyncInterval is how often an FsyncEverySecond log is synced.
+var walSyncInterval = time.Second
+
+// writeAheadLog is an append-only log of every write applied to the cache.
+type writeAheadLog struct {
+	path   string
+	file   *os.File
+	policy FsyncPolicy
+	// dirty is set while records were written which aren't synced yet.
+	dirty bool
+	sync.Mutex
+}
+
+// openWAL opens (or creates) the write-ahead log at `path` for appending.
+func openWAL(path string, policy FsyncPolicy) (*writeAheadLog, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &writeAheadLog{
+		path:   path,
+		file:   file,
+		policy: policy,
+	}, nil
+}
+
+// Append writes a record to the log and, with FsyncAlways, syncs it to disk.
+// A write is only applied to the cache once its record made it into the log.
+func (w *writeAheadLog) Append(record walRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	w.Lock()
+	defer w.Unlock()
+
+	if _, err := w.file.Write(line); err != nil {
+		return err
+	}
+
+	if w.policy != FsyncAlways {
+		w.dirty = true
+		return nil
+	}
+
+	return w.file.Sync()
+}
+
+// Sync syncs any records which were written since the last sync.
+func (w *writeAheadLog) Sync() error {
+	w.Lock()
+	defer w.Unlock()
+
+	if !w.dirty {
+		return nil
+	}
+
+	if err := w.file.Sync(); err != nil {
+		return err
+	}
+	w.dirty = false
+
+	return nil
+}
+
+// Truncate throws away every record in the log. It must only be called once
+// the records are captured elsewhere, e.g. in a snapshot.
+func (w *writeAheadLog) Truncate() error {
+	w.Lock()
+	defer w.Unlock()
+
+	if err := w.file.Truncate(0); err != nil {
+		return err
+	}
+	w.dirty = false
+
+	return w.file.Sync()
+}
+
+// Close closes the underlying log file.
+func (w *writeAheadLog) Close() error {
+	w.Lock()
+	defer w.Unlock()
+
+	return w.file.Close()
+}
+
+// readWAL reads every complete record from the log at `path`. A missing log
+// is treated as empty. A torn record at the end of the log (we crashed while
+// writing it) is dropped, as its write was never applied.
+func readWAL(path string) ([]walRecord, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []walRecord
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				log.Printf("Dropping torn record at the end of %v", path)
+			}
+			return records, nil
+		} else if err != nil {
+			return records, err
+		}
+
+		var record walRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			log.Printf("Dropping unreadable WAL record: %v", err)
+			continue
+		}
+
+		records = append(records, record)
+	}
+}
+
+// replayWAL applies every record of the log at `path` to the cache. It's run
+// before the cache starts logging, so replayed writes aren't logged twice.
+func (c *Cache) replayWAL(path string) error {
+	records, err := readWAL(path)
+	if err != nil {
+		return err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	for _, record := range records {
+		shard := c.shardOf(record.Key)
+
+		switch record.Op {
+		case walSet:
+			if err := c.replaySet(shard, record); err != nil {
+				log.Printf("Skipping the logged SET of %v: %v", record.Key, err)
+				continue
+			}
+			if c.clearsExpiration(shard, record.Key) {
+				shard.expirations.Remove(record.Key)
+			}
+		case walLPush, walRPush:
+			if _, err := shard.typedOf(record.Key, KindList); err != nil {
+				log.Printf("Skipping the logged push onto %v: %v", record.Key, err)
+				continue
+			}
+			c.pushItems(shard, record.Key, record.Op == walLPush, record.MaxLen, record.Items, 0)
+		case walLPop:
+			if list, err := shard.typedOf(record.Key, KindList); err != nil || list == nil {
+				log.Printf("Skipping the logged pop of %v, which holds no list", record.Key)
+				continue
+			}
+			c.popItem(shard, record.Key, 0)
+		case walHSet:
+			if _, err := shard.typedOf(record.Key, KindHash); err != nil {
+				log.Printf("Skipping the logged HSET of %v: %v", record.Key, err)
+				continue
+			}
+			c.setFields(shard, record.Key, record.Fields, 0)
+		case walDelete:
+			c.deleteEntry(shard, record.Key)
+		case walExpire:
+			shard.expirations.Insert(
+				binheap.NewNode(record.Key, time.Unix(0, record.ExpiresAt).UTC()),
+			)
+		case walPersist:
+			shard.expirations.Remove(record.Key)
+		}
+	}
+	c.copyCache()
+
+	return nil
+}
+
+// replaySet applies a logged SET, of a string or of a whole list or hash.
+// The caller must hold the cache lock exclusively.
+func (c *Cache) replaySet(shard *cacheShard, record walRecord) error {
+	if record.Kind == KindString {
+		c.storeEntry(shard, record.Key, record.Value)
+		return nil
+	}
+
+	value, err := decodeTypedValue(record.Kind, record.Value)
+	if err != nil {
+		return err
+	}
+	c.storeTyped(shard, record.Key, value)
+	c.typedWritten(shard, record.Key, 0, 0)
+
+	return nil
+}
+
+// logWrite appends a record to the write-ahead log, if there is one.
+func (c *Cache) logWrite(record walRecord) error {
+	if c.wal == nil {
+		return nil
+	}
+
+	return c.wal.Append(record)
+}
+
+// syncWALRepeatedly syncs an FsyncEverySecond log until the cache is stopped.
+// Unlike the other background loops it keeps going while maintenance is
+// paused, as it's what bounds how many writes a crash can lose.
+func (c *Cache) syncWALRepeatedly() {
+	ticker := time.NewTicker(walSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.wal.Sync(); err != nil {
+				log.Printf("Failed to sync the write-ahead log: %v", err)
+			}
+		case <-c.stopped:
+			return
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package cache
+
+import (
+	"fmt"
+	"github.com/GrappigPanda/Olivia/config"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func durableConfig(t *testing.T) (*config.Cfg, func()) {
+	dir, err := ioutil.TempDir("", "olivia-wal")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	cfg := &config.Cfg{
+		IsTesting:    true,
+		WALPath:      filepath.Join(dir, "olivia.wal"),
+		SnapshotPath: filepath.Join(dir, "olivia.snapshot"),
+	}
+
+	return cfg, func() { os.RemoveAll(dir) }
+}
+
+func TestWALReplayAfterCrash(t *testing.T) {
+	cfg, cleanup := durableConfig(t)
+	defer cleanup()
+
+	cache := NewCache(nil, cfg)
+	for i := 0; i < 10; i++ {
+		if err := cache.Set(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i)); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	cache.SetExpiration("expiring", "value with spaces\n", 60)
+	cache.Update("key9", func(string, bool) (string, bool) { return "", false })
+
+	// Simulate a crash: no snapshot is taken, the process just goes away.
+	cache.wal.Close()
+
+	restarted := NewCache(nil, cfg)
+	for i := 0; i < 9; i++ {
+		key := fmt.Sprintf("key%d", i)
+		value, err := restarted.Get(key)
+		if err != nil || value != fmt.Sprintf("value%d", i) {
+			t.Fatalf("Expected %v, got %v (%v)", fmt.Sprintf("value%d", i), value, err)
+		}
+	}
+
+	if _, err := restarted.Get("key9"); err == nil {
+		t.Fatalf("Expected key9 to stay deleted after replay")
+	}
+
+	if value, _ := restarted.Get("expiring"); value != "value with spaces\n" {
+		t.Fatalf("Expected %q, got %q", "value with spaces\n", value)
+	}
+
+	node, ok := restarted.shardOf("expiring").expirations.Get("expiring")
+	if !ok || node.Timeout.Sub(time.Now().UTC()) < 50*time.Second {
+		t.Fatalf("Expected the expiration to survive the replay, got %v", node)
+	}
+}
+
+func TestWALDropsTornRecord(t *testing.T) {
+	cfg, cleanup := durableConfig(t)
+	defer cleanup()
+
+	cache := NewCache(nil, cfg)
+	cache.Set("key1", "value1")
+	cache.wal.Close()
+
+	file, err := os.OpenFile(cfg.WALPath, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	file.WriteString(`{"Op":"SET","Key":"key2","Val`)
+	file.Close()
+
+	restarted := NewCache(nil, cfg)
+	if value, _ := restarted.Get("key1"); value != "value1" {
+		t.Fatalf("Expected %v, got %v", "value1", value)
+	}
+	if _, err := restarted.Get("key2"); err == nil {
+		t.Fatalf("Expected the torn record to be dropped")
+	}
+}
+
+func TestSnapshotTruncatesWAL(t *testing.T) {
+	cfg, cleanup := durableConfig(t)
+	defer cleanup()
+
+	cache := NewCache(nil, cfg)
+	cache.Set("key1", "value1")
+	if err := cache.Snapshot(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	records, err := readWAL(cfg.WALPath)
+	if err != nil || len(records) != 0 {
+		t.Fatalf("Expected an empty WAL after a snapshot, got %v (%v)", records, err)
+	}
+
+	// Writes after the snapshot only live in the log.
+	cache.Set("key2", "value2")
+	cache.wal.Close()
+
+	restarted := NewCache(nil, cfg)
+	for _, key := range []string{"key1", "key2"} {
+		if _, err := restarted.Get(key); err != nil {
+			t.Fatalf("Expected %v to be restored, got %v", key, err)
+		}
+	}
+}
+
+func TestSnapshotPresizesHeap(t *testing.T) {
+	cfg, cleanup := durableConfig(t)
+	defer cleanup()
+	cfg.HeapInitialCapacity = 10
+
+	cache := NewCache(nil, cfg)
+	for i := 0; i < 500; i++ {
+		cache.SetExpiration(fmt.Sprintf("key%d", i), "value", 60)
+	}
+	if err := cache.Snapshot(); err != nil {
+		t.Fatalf("%v", err)
+	}
+	cache.wal.Close()
+
+	cfg.PresizeHeapFromSnapshot = true
+	restarted := NewCache(nil, cfg)
+	reallocations := 0
+	for _, shard := range restarted.shards {
+		reallocations += shard.expirations.Reallocations()
+	}
+	if reallocations != 0 {
+		t.Fatalf("Expected %v, got %v", 0, reallocations)
+	}
+}
+
+func TestSnapshotRestoresBloomFilters(t *testing.T) {
+	cfg, cleanup := durableConfig(t)
+	defer cleanup()
+	cfg.BloomfilterSize = 1000
+	cfg.BloomfilterPartitions = 4
+
+	cache := NewCache(nil, cfg)
+	for i := 0; i < 100; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), "value")
+	}
+	if err := cache.Snapshot(); err != nil {
+		t.Fatalf("%v", err)
+	}
+	cache.wal.Close()
+
+	restarted := NewCache(nil, cfg)
+	if restarted.GetBloomFilter().Serialize() != cache.GetBloomFilter().Serialize() {
+		t.Fatalf("Expected the restored bloom filter to match")
+	}
+
+	for i := range cache.partitionFilters {
+		restoredFilter, _ := restarted.GetPartitionBloomFilter(i)
+		filter, _ := cache.GetPartitionBloomFilter(i)
+		if restoredFilter.Serialize() != filter.Serialize() {
+			t.Fatalf("Expected the restored filter of partition %d to match", i)
+		}
+	}
+}
+
+func TestSnapshotsDontRunConcurrently(t *testing.T) {
+	cfg, cleanup := durableConfig(t)
+	defer cleanup()
+
+	cache := NewCache(nil, cfg)
+	cache.Set("key1", "value1")
+
+	if lastSaved := cache.LastSnapshot(); !lastSaved.IsZero() {
+		t.Fatalf("Expected no previous snapshot, got %v", lastSaved)
+	}
+
+	// Holding the lock keeps the background snapshot from finishing.
+	cache.Lock()
+	lastSaved, err := cache.BackgroundSnapshot()
+	if err != nil || !lastSaved.IsZero() {
+		t.Fatalf("Expected a zero previous snapshot, got %v (%v)", lastSaved, err)
+	}
+
+	if _, err := cache.BackgroundSnapshot(); err != ErrSnapshotInProgress {
+		t.Fatalf("Expected %v, got %v", ErrSnapshotInProgress, err)
+	}
+	if err := cache.Snapshot(); err != ErrSnapshotInProgress {
+		t.Fatalf("Expected %v, got %v", ErrSnapshotInProgress, err)
+	}
+	cache.Unlock()
+
+	for attempt := 0; cache.Snapshot() == ErrSnapshotInProgress; attempt++ {
+		if attempt == 100 {
+			t.Fatalf("Expected the background snapshot to finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if cache.LastSnapshot().IsZero() {
+		t.Fatalf("Expected the snapshot's time to be recorded")
+	}
+}
+
+func TestParseFsyncPolicy(t *testing.T) {
+	policies := map[string]FsyncPolicy{
+		"always":   FsyncAlways,
+		"everysec": FsyncEverySecond,
+		"EverySec": FsyncEverySecond,
+		"never":    FsyncNever,
+		"":         FsyncAlways,
+		"bogus":    FsyncAlways,
+	}
+
+	for policy, expected := range policies {
+		if parsed := ParseFsyncPolicy(policy); parsed != expected {
+			t.Fatalf("Expected %v for %q, got %v", expected, policy, parsed)
+		}
+	}
+}
+
+func TestWALEverySecondSyncsInBackground(t *testing.T) {
+	cfg, cleanup := durableConfig(t)
+	defer cleanup()
+	cfg.WALFsync = "everysec"
+
+	defer func(interval time.Duration) { walSyncInterval = interval }(walSyncInterval)
+	walSyncInterval = 10 * time.Millisecond
+
+	cache := NewCache(nil, cfg)
+	defer cache.Stop()
+
+	if err := cache.Set("key", "value"); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for attempt := 0; ; attempt++ {
+		cache.wal.Lock()
+		dirty := cache.wal.dirty
+		cache.wal.Unlock()
+
+		if !dirty {
+			break
+		}
+		if attempt == 100 {
+			t.Fatalf("Expected the write-ahead log to be synced in the background")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWALSyncedOnStop(t *testing.T) {
+	cfg, cleanup := durableConfig(t)
+	defer cleanup()
+	cfg.WALFsync = "never"
+
+	cache := NewCache(nil, cfg)
+	cache.Set("key", "value")
+
+	if !cache.wal.dirty {
+		t.Fatalf("Expected the write to be left unsynced")
+	}
+
+	cache.Stop()
+	if cache.wal.dirty {
+		t.Fatalf("Expected stopping the cache to sync the write-ahead log")
+	}
+	cache.wal.Close()
+
+	restarted := NewCache(nil, cfg)
+	if value, err := restarted.Get("key"); err != nil || value != "value" {
+		t.Fatalf("Expected value, got %v (%v)", value, err)
+	}
+}
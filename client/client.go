@@ -0,0 +1,232 @@
+package client
+
+import (
+	"crypto/tls"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNotFound is returned by Get for a key no node holds.
+var ErrNotFound = errors.New("Key not found in cache")
+
+// ErrInvalidKey is returned for keys the wire protocol can't carry.
+var ErrInvalidKey = errors.New("Keys can't be empty or contain spaces, commas, colons or newlines")
+
+// ErrClosed is returned once the client has been closed.
+var ErrClosed = errors.New("Client is closed")
+
+// ServerError is an error a node answered a request with.
+type ServerError struct {
+	Message string
+}
+
+func (e *ServerError) Error() string {
+	return e.Message
+}
+
+// Config configures an OliviaClient.
+type Config struct {
+	// Address is the ip:port of the node to talk to.
+	Address string
+	// Secret is the cluster secret, sent with AUTH on every new connection
+	// if it's set.
+	Secret string
+	// Namespace is the namespace every connection SELECTs, the default one
+	// if it's empty.
+	Namespace string
+	// PoolSize is how many connections requests are spread over. Each one
+	// carries any number of requests at once. Defaults to 4.
+	PoolSize int
+	// DialTimeout bounds connecting. Zero means no timeout.
+	DialTimeout time.Duration
+	// TLS, if it's set, is what connections are made over TLS with.
+	TLS *tls.Config
+	// Timeout bounds each round trip, pipelines included, after which
+	// ErrTimeout is returned. Zero means no timeout.
+	Timeout time.Duration
+}
+
+const defaultPoolSize = 4
+
+// OliviaClient talks to a node over the native protocol. It's safe for
+// concurrent use: calls are spread over a pool of pipelined connections, so
+// they don't wait on each other's responses, and a connection which breaks is
+// redialed by the next call to use it.
+type OliviaClient struct {
+	config Config
+	next   uint32
+	conns  []*conn
+	closed bool
+	sync.Mutex
+}
+
+// NewOliviaClient creates a client for the node at `config.Address`.
+// Connections are only made once they're needed.
+func NewOliviaClient(config Config) *OliviaClient {
+	if config.PoolSize <= 0 {
+		config.PoolSize = defaultPoolSize
+	}
+
+	return &OliviaClient{
+		config: config,
+		conns:  make([]*conn, config.PoolSize),
+	}
+}
+
+// Get returns the value of `key`, or ErrNotFound.
+func (c *OliviaClient) Get(key string) (string, error) {
+	values, err := c.do(newRequest("GET", []string{key}, nil, nil), []string{key})
+	if err != nil {
+		return "", err
+	}
+
+	value, ok := values[key]
+	if !ok {
+		return "", ErrNotFound
+	}
+
+	return value, nil
+}
+
+// MGet returns the values of every key which was found.
+func (c *OliviaClient) MGet(keys ...string) (map[string]string, error) {
+	if len(keys) == 0 {
+		return map[string]string{}, nil
+	}
+
+	return c.do(newRequest("MGET", keys, nil, nil), keys)
+}
+
+// Set sets `key` to `value`.
+func (c *OliviaClient) Set(key string, value string) error {
+	_, err := c.do(newRequest("SET", []string{key}, []string{value}, nil), []string{key})
+	return err
+}
+
+// SetEx sets `key` to `value`, expiring it after `seconds`.
+func (c *OliviaClient) SetEx(key string, value string, seconds int) error {
+	_, err := c.do(
+		newRequest("SETEX", []string{key}, []string{value}, []int{seconds}),
+		[]string{key},
+	)
+	return err
+}
+
+// Delete deletes `key`, reporting whether it existed.
+func (c *OliviaClient) Delete(key string) (bool, error) {
+	deleted, err := c.do(newRequest("DEL", []string{key}, nil, nil), []string{key})
+	if err != nil {
+		return false, err
+	}
+
+	_, ok := deleted[key]
+	return ok, nil
+}
+
+// Close closes every connection. Calls still waiting on a response fail
+// with ErrClosed.
+func (c *OliviaClient) Close() error {
+	c.Lock()
+	defer c.Unlock()
+
+	c.closed = true
+	for i, conn := range c.conns {
+		if conn != nil {
+			conn.Close()
+			c.conns[i] = nil
+		}
+	}
+
+	return nil
+}
+
+func (c *OliviaClient) do(req request, keys []string) (map[string]string, error) {
+	if err := validateKeys(keys); err != nil {
+		return nil, err
+	}
+
+	replies, err := c.roundTrip([]request{req})
+	if err != nil {
+		return nil, err
+	}
+
+	return replies[0].values, replies[0].err
+}
+
+// roundTrip sends `requests` over the next connection in the pool. A
+// connection may have been closed by the node since it was last used, so a
+// round trip which breaks one that was already open is retried once on a new
+// connection. One which timed out isn't, as the node may still act on it.
+func (c *OliviaClient) roundTrip(requests []request) ([]reply, error) {
+	slot := int(atomic.AddUint32(&c.next, 1) % uint32(len(c.conns)))
+
+	conn, dialed, err := c.get(slot)
+	if err != nil {
+		return nil, err
+	}
+
+	replies, err := conn.send(requests, c.config.Timeout)
+	if err != nil && err != ErrTimeout && !dialed {
+		if conn, _, err = c.get(slot); err != nil {
+			return nil, err
+		}
+
+		replies, err = conn.send(requests, c.config.Timeout)
+	}
+
+	return replies, err
+}
+
+// get returns the connection in `slot`, dialing a new one if there's none
+// or it broke. It reports whether the connection was just dialed.
+func (c *OliviaClient) get(slot int) (*conn, bool, error) {
+	c.Lock()
+	if c.closed {
+		c.Unlock()
+		return nil, false, ErrClosed
+	}
+	if conn := c.conns[slot]; conn != nil && !conn.broken() {
+		c.Unlock()
+		return conn, false, nil
+	}
+	c.Unlock()
+
+	// Dialing can take a while, so it's done without holding the lock.
+	conn, err := dial(c.config)
+	if err != nil {
+		return nil, false, err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if c.closed {
+		conn.Close()
+		return nil, false, ErrClosed
+	}
+	if current := c.conns[slot]; current != nil && !current.broken() {
+		// Another call redialed the slot first.
+		conn.Close()
+		return current, false, nil
+	}
+
+	if current := c.conns[slot]; current != nil {
+		current.Close()
+	}
+	c.conns[slot] = conn
+
+	return conn, true, nil
+}
+
+func validateKeys(keys []string) error {
+	for _, key := range keys {
+		if key == "" || strings.ContainsAny(key, " ,:\r\n") {
+			return ErrInvalidKey
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,210 @@
+package client
+
+import (
+	"fmt"
+	"github.com/GrappigPanda/Olivia/cache"
+	"github.com/GrappigPanda/Olivia/config"
+	"github.com/GrappigPanda/Olivia/network/incoming"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testPort = 5460
+
+var testAddress = fmt.Sprintf("127.0.0.1:%d", testPort)
+
+var testCache *cache.Cache
+
+func TestMain(m *testing.M) {
+	cfg := &config.Cfg{
+		BloomfilterSize: 1000,
+		IsTesting:       true,
+		ListenPort:      testPort,
+		MaxNamespaces:   2,
+		MaxMessageBytes: 1 << 20,
+	}
+	testCache = cache.NewCache(nil, cfg)
+	incomingNetwork.StartNetworkRouter(nil, testCache, cfg)
+
+	// The router starts listening in the background.
+	for i := 0; ; i++ {
+		conn, err := net.Dial("tcp", testAddress)
+		if err == nil {
+			conn.Close()
+			break
+		}
+		if i == 100 {
+			fmt.Printf("Node never started listening: %v\n", err)
+			os.Exit(1)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The router only checks for a stop between connections, so it's left
+	// running until the test binary exits.
+	os.Exit(m.Run())
+}
+
+func newTestClient(t *testing.T) *OliviaClient {
+	client := NewOliviaClient(Config{Address: testAddress, PoolSize: 2, Timeout: 5 * time.Second})
+	t.Cleanup(func() { client.Close() })
+
+	return client
+}
+
+func TestSetGetAndDelete(t *testing.T) {
+	client := newTestClient(t)
+
+	var values = []string{"value1", "", "has spaces: colons,\nand a newline", "$5"}
+	for i, value := range values {
+		key := fmt.Sprintf("client%d", i)
+		if err := client.Set(key, value); err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		got, err := client.Get(key)
+		if err != nil || got != value {
+			t.Fatalf("Expected %q, got %q %v", value, got, err)
+		}
+	}
+
+	deleted, err := client.Delete("client0")
+	if err != nil || !deleted {
+		t.Fatalf("Expected %v, got %v %v", true, deleted, err)
+	}
+
+	deleted, err = client.Delete("client0")
+	if err != nil || deleted {
+		t.Fatalf("Expected %v, got %v %v", false, deleted, err)
+	}
+
+	if _, err := client.Get("client0"); err != ErrNotFound {
+		t.Fatalf("Expected %v, got %v", ErrNotFound, err)
+	}
+}
+
+func TestSetEx(t *testing.T) {
+	client := newTestClient(t)
+
+	if err := client.SetEx("expiring", "value", 60); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if ttl, err := testCache.GetTTL("expiring"); err != nil || ttl != 60 {
+		t.Fatalf("Expected %v, got %v %v", 60, ttl, err)
+	}
+}
+
+func TestMGet(t *testing.T) {
+	client := newTestClient(t)
+	client.Set("mget1", "value1")
+	client.Set("mget2", "value two")
+
+	values, err := client.MGet("mget1", "mget2", "missing")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(values) != 2 || values["mget1"] != "value1" || values["mget2"] != "value two" {
+		t.Fatalf("Expected mget1 and mget2, got %v", values)
+	}
+}
+
+func TestInvalidKeys(t *testing.T) {
+	client := newTestClient(t)
+
+	for _, key := range []string{"", "a b", "a,b", "a:b", "a\nb"} {
+		if err := client.Set(key, "value"); err != ErrInvalidKey {
+			t.Fatalf("Expected %v for %q, got %v", ErrInvalidKey, key, err)
+		}
+	}
+}
+
+func TestServerError(t *testing.T) {
+	client := newTestClient(t)
+
+	err := client.SetEx("negative", "value", -1)
+	if _, ok := err.(*ServerError); !ok {
+		t.Fatalf("Expected a ServerError, got %v", err)
+	}
+
+	// The connection is still usable afterwards.
+	if err := client.Set("afterError", "value"); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
+
+func TestReconnectsAfterNodeClosesConnection(t *testing.T) {
+	client := NewOliviaClient(Config{Address: testAddress, PoolSize: 1})
+	defer client.Close()
+	client.Set("reconnect", "value")
+
+	// Close the connection behind the client's back, as a restarting node
+	// would.
+	client.conns[0].Conn.Close()
+
+	value, err := client.Get("reconnect")
+	if err != nil || value != "value" {
+		t.Fatalf("Expected %v, got %v %v", "value", value, err)
+	}
+}
+
+func TestConcurrentRequestsShareConnections(t *testing.T) {
+	client := NewOliviaClient(Config{Address: testAddress, PoolSize: 1, Timeout: 5 * time.Second})
+	defer client.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			key := fmt.Sprintf("concurrent%d", i)
+			value := fmt.Sprintf("value %d", i)
+			if err := client.Set(key, value); err != nil {
+				errs <- err
+				return
+			}
+			if got, err := client.Get(key); err != nil || got != value {
+				errs <- fmt.Errorf("Expected %q, got %q %v", value, got, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatalf("%v", err)
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	client := NewOliviaClient(Config{Address: testAddress, Namespace: "clientns"})
+	defer client.Close()
+
+	if err := client.Set("namespaced", "value"); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if _, err := testCache.Get("namespaced"); err == nil {
+		t.Fatalf("Expected the default namespace not to have the key")
+	}
+
+	namespace, _ := testCache.Namespace("clientns")
+	if value, err := namespace.Get("namespaced"); err != nil || value != "value" {
+		t.Fatalf("Expected %v, got %v %v", "value", value, err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	client := NewOliviaClient(Config{Address: testAddress})
+	client.Close()
+
+	if err := client.Set("closed", "value"); err != ErrClosed {
+		t.Fatalf("Expected %v, got %v", ErrClosed, err)
+	}
+}
@@ -0,0 +1,321 @@
+package client
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/GrappigPanda/Olivia/parser"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// responses maps each command to the verb a successful response starts with.
+var responses = map[string]string{
+	"AUTH":     "AUTHED",
+	"SELECT":   "SELECTED",
+	"GET":      "GOT",
+	"MGET":     "GOT",
+	"SET":      "SAT",
+	"SETEX":    "SATEX",
+	"DEL":      "DELETED",
+	"PIPELINE": "PIPELINED",
+}
+
+// request is a single command along with the hash its response is matched
+// to.
+type request struct {
+	hash    string
+	command string
+	// message is the command line and its framed payloads, newline
+	// terminated.
+	message string
+}
+
+// requestCounter numbers requests so every hash is unique to its client
+// process.
+var requestCounter uint64
+
+// newRequest builds a command whose arguments are `key:value` pairs, or bare
+// keys when `values` is nil. `expirations` are appended to each pair when
+// given.
+func newRequest(command string, keys []string, values []string, expirations []int) request {
+	hash := strconv.FormatUint(atomic.AddUint64(&requestCounter, 1), 36)
+
+	args := make([]string, len(keys))
+	var payloads []string
+	for i, key := range keys {
+		args[i] = key
+		if values != nil {
+			token, payload, framed := parser.FrameValue(values[i])
+			if framed {
+				payloads = append(payloads, payload)
+			}
+			args[i] = fmt.Sprintf("%s:%s", key, token)
+		}
+		if expirations != nil {
+			args[i] = fmt.Sprintf("%s:%d", args[i], expirations[i])
+		}
+	}
+
+	line := fmt.Sprintf("%s:%s %s\n", hash, command, strings.Join(args, ","))
+	return request{hash, command, parser.AppendPayloads(line, payloads)}
+}
+
+// ErrTimeout is returned when a node doesn't answer within Config.Timeout.
+// The connection stays usable: the late response is dropped when it arrives.
+var ErrTimeout = errors.New("Timed out waiting for a response")
+
+// reply is a node's response to a request: the key/value pairs it listed,
+// or the error it answered with.
+type reply struct {
+	values map[string]string
+	err    error
+}
+
+// pending is a request waiting on its response.
+type pending struct {
+	request request
+	reply   chan reply
+}
+
+// conn is a single pipelined connection to a node. Any number of callers can
+// have requests outstanding on it at once: the node answers each as soon as
+// it's done, in whatever order, and readResponses hands every response to the
+// request with its hash.
+type conn struct {
+	net.Conn
+	reader *bufio.Reader
+	parser *parser.Parser
+
+	writeLock sync.Mutex
+
+	sync.Mutex
+	pending map[string]pending
+	// err is why the connection broke, once it has.
+	err error
+}
+
+// dial connects to a node, authenticating and selecting the namespace the
+// config asks for, then switches the connection to pipelining.
+func dial(config Config) (*conn, error) {
+	var netConn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: config.DialTimeout}
+	if config.TLS != nil {
+		netConn, err = tls.DialWithDialer(dialer, "tcp", config.Address, config.TLS)
+	} else {
+		netConn, err = dialer.Dial("tcp", config.Address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &conn{
+		Conn:    netConn,
+		reader:  bufio.NewReader(netConn),
+		parser:  &parser.Parser{},
+		pending: make(map[string]pending),
+	}
+
+	var setup []request
+	if config.Secret != "" {
+		setup = append(setup, newRequest("AUTH", []string{config.Secret}, nil, nil))
+	}
+	if config.Namespace != "" {
+		setup = append(setup, newRequest("SELECT", []string{config.Namespace}, nil, nil))
+	}
+	setup = append(setup, newRequest("PIPELINE", nil, nil, nil))
+
+	replies, err := c.roundTrip(setup, config.Timeout)
+	if err == nil {
+		for _, reply := range replies {
+			if reply.err != nil {
+				err = reply.err
+				break
+			}
+		}
+	}
+
+	if err != nil {
+		netConn.Close()
+		return nil, err
+	}
+
+	c.SetDeadline(time.Time{})
+	go c.readResponses()
+
+	return c, nil
+}
+
+// roundTrip writes every request at once, then reads their responses. It's
+// only used to set a connection up, before it's pipelined, while the node
+// still answers in order.
+func (c *conn) roundTrip(requests []request, timeout time.Duration) ([]reply, error) {
+	if timeout > 0 {
+		c.SetDeadline(time.Now().Add(timeout))
+	}
+
+	if err := c.write(requests); err != nil {
+		return nil, err
+	}
+
+	replies := make([]reply, len(requests))
+	for i, request := range requests {
+		line, payloads, err := parser.ReadFramed(c.reader)
+		if err != nil {
+			return nil, err
+		}
+
+		hash, response, found := strings.Cut(line, ":")
+		if !found || hash != request.hash {
+			return nil, fmt.Errorf("Expected a response to %v, got %q", request.hash, line)
+		}
+
+		replies[i] = c.parseResponse(request, line, response, payloads)
+	}
+
+	return replies, nil
+}
+
+// send writes every request at once and waits for their responses, which
+// can arrive in any order. An error other than ErrTimeout means the
+// connection broke and can't be used anymore.
+func (c *conn) send(requests []request, timeout time.Duration) ([]reply, error) {
+	waiting := make([]chan reply, len(requests))
+
+	c.Lock()
+	if c.err != nil {
+		c.Unlock()
+		return nil, c.err
+	}
+	for i, request := range requests {
+		waiting[i] = make(chan reply, 1)
+		c.pending[request.hash] = pending{request, waiting[i]}
+	}
+	c.Unlock()
+
+	if err := c.write(requests); err != nil {
+		c.fail(err)
+		return nil, err
+	}
+
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	replies := make([]reply, len(requests))
+	for i := range requests {
+		select {
+		case reply, ok := <-waiting[i]:
+			if !ok {
+				c.Lock()
+				err := c.err
+				c.Unlock()
+				return nil, err
+			}
+			replies[i] = reply
+		case <-deadline:
+			c.Lock()
+			for _, request := range requests {
+				delete(c.pending, request.hash)
+			}
+			c.Unlock()
+			return nil, ErrTimeout
+		}
+	}
+
+	return replies, nil
+}
+
+func (c *conn) write(requests []request) error {
+	var buffer strings.Builder
+	for _, request := range requests {
+		buffer.WriteString(request.message)
+	}
+
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	_, err := c.Write([]byte(buffer.String()))
+	return err
+}
+
+// readResponses hands each response to the request waiting on it until the
+// connection breaks. Responses nobody's waiting on anymore are dropped.
+func (c *conn) readResponses() {
+	for {
+		line, payloads, err := parser.ReadFramed(c.reader)
+		if err != nil {
+			c.fail(err)
+			return
+		}
+
+		hash, response, _ := strings.Cut(line, ":")
+
+		c.Lock()
+		waiting, ok := c.pending[hash]
+		delete(c.pending, hash)
+		c.Unlock()
+
+		if ok {
+			waiting.reply <- c.parseResponse(waiting.request, line, response, payloads)
+		}
+	}
+}
+
+// fail breaks the connection, failing every request still waiting on it.
+func (c *conn) fail(err error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.err != nil {
+		return
+	}
+
+	c.err = err
+	c.Conn.Close()
+	for hash, waiting := range c.pending {
+		close(waiting.reply)
+		delete(c.pending, hash)
+	}
+}
+
+// Close closes the connection, failing every request still waiting on it.
+func (c *conn) Close() error {
+	c.fail(ErrClosed)
+	return nil
+}
+
+// broken reports whether the connection can't be used anymore.
+func (c *conn) broken() bool {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.err != nil
+}
+
+// parseResponse turns a response into a reply. A response which doesn't
+// start with the verb the request expects is the node's error message.
+func (c *conn) parseResponse(request request, line string, response string, payloads []string) reply {
+	verb, _, _ := strings.Cut(response, " ")
+	if verb != responses[request.command] {
+		return reply{err: &ServerError{response}}
+	}
+
+	parsed, err := c.parser.ParseFramed(line, payloads, nil)
+	if err != nil {
+		return reply{err: err}
+	}
+
+	// An empty response still parses as a single empty key.
+	delete(parsed.Args, "")
+	return reply{values: parsed.Args}
+}
@@ -0,0 +1,94 @@
+package client
+
+// Pipeline queues up commands to send to a node in a single round trip. The
+// node runs them concurrently, so there's no telling which order they take
+// effect in: a command which depends on another has to go in a later Exec.
+type Pipeline struct {
+	client   *OliviaClient
+	requests []request
+	keys     [][]string
+}
+
+// Reply is a pipelined command's result. Values holds the key/value pairs
+// the node answered with: the values found for a Get or MGet, the keys
+// written for a Set or SetEx, and the keys deleted for a Delete.
+type Reply struct {
+	Values map[string]string
+	Err    error
+}
+
+// Pipeline starts a new pipeline. Nothing is sent until Exec.
+func (c *OliviaClient) Pipeline() *Pipeline {
+	return &Pipeline{client: c}
+}
+
+func (p *Pipeline) Get(key string) {
+	p.queue(newRequest("GET", []string{key}, nil, nil), []string{key})
+}
+
+func (p *Pipeline) MGet(keys ...string) {
+	p.queue(newRequest("MGET", keys, nil, nil), keys)
+}
+
+func (p *Pipeline) Set(key string, value string) {
+	p.queue(newRequest("SET", []string{key}, []string{value}, nil), []string{key})
+}
+
+func (p *Pipeline) SetEx(key string, value string, seconds int) {
+	p.queue(
+		newRequest("SETEX", []string{key}, []string{value}, []int{seconds}),
+		[]string{key},
+	)
+}
+
+func (p *Pipeline) Delete(key string) {
+	p.queue(newRequest("DEL", []string{key}, nil, nil), []string{key})
+}
+
+func (p *Pipeline) queue(req request, keys []string) {
+	p.requests = append(p.requests, req)
+	p.keys = append(p.keys, keys)
+}
+
+// Exec sends every queued command at once and returns their replies, in the
+// order they were queued. The error is only set if the round trip itself
+// failed; a command the node refused has its Reply's Err set instead. A
+// command whose keys can't be sent isn't, and is answered with
+// ErrInvalidKey. The pipeline is empty again afterwards.
+func (p *Pipeline) Exec() ([]Reply, error) {
+	requests, keys := p.requests, p.keys
+	p.requests, p.keys = nil, nil
+
+	replies := make([]Reply, len(requests))
+
+	var valid []request
+	var sent []int
+	for i, req := range requests {
+		if len(keys[i]) == 0 {
+			replies[i] = Reply{Values: map[string]string{}}
+			continue
+		}
+		if err := validateKeys(keys[i]); err != nil {
+			replies[i] = Reply{Err: err}
+			continue
+		}
+
+		valid = append(valid, req)
+		sent = append(sent, i)
+	}
+
+	if len(valid) == 0 {
+		return replies, nil
+	}
+
+	answered, err := p.client.roundTrip(valid)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, reply := range answered {
+		replies[sent[i]] = Reply{reply.values, reply.err}
+	}
+
+	return replies, nil
+}
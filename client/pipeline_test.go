@@ -0,0 +1,69 @@
+package client
+
+import (
+	"fmt"
+	"testing"
+)
+
+func expectReplies(t *testing.T, replies []Reply, expected []map[string]string) {
+	t.Helper()
+
+	if len(replies) != len(expected) {
+		t.Fatalf("Expected %v replies, got %v", len(expected), len(replies))
+	}
+
+	for i, reply := range replies {
+		if expected[i] == nil {
+			if reply.Err != ErrInvalidKey {
+				t.Fatalf("Expected %v, got %v", ErrInvalidKey, reply.Err)
+			}
+			continue
+		}
+
+		if reply.Err != nil || fmt.Sprint(reply.Values) != fmt.Sprint(expected[i]) {
+			t.Fatalf("Expected %v, got %v %v", expected[i], reply.Values, reply.Err)
+		}
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	client := newTestClient(t)
+
+	pipeline := client.Pipeline()
+	pipeline.Set("pipe1", "value1")
+	pipeline.SetEx("pipe2", "value 2", 60)
+	pipeline.Set("bad key", "value")
+	pipeline.Set("pipe3", "value3")
+
+	replies, err := pipeline.Exec()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	expectReplies(t, replies, []map[string]string{
+		{"pipe1": "value1"},
+		{"pipe2": "value 2"},
+		nil,
+		{"pipe3": "value3"},
+	})
+
+	// The commands in a pipeline run concurrently, so reads go in a second
+	// one to see the writes.
+	pipeline.Get("pipe1")
+	pipeline.MGet("pipe1", "pipe2", "missing")
+	pipeline.Delete("pipe3")
+	pipeline.MGet()
+
+	if replies, err = pipeline.Exec(); err != nil {
+		t.Fatalf("%v", err)
+	}
+	expectReplies(t, replies, []map[string]string{
+		{"pipe1": "value1"},
+		{"pipe1": "value1", "pipe2": "value 2"},
+		{"pipe3": ""},
+		{},
+	})
+
+	if replies, err := pipeline.Exec(); err != nil || len(replies) != 0 {
+		t.Fatalf("Expected an empty pipeline, got %v %v", replies, err)
+	}
+}
@@ -5,6 +5,14 @@ import (
 	"log"
 )
 
+// User is a client which authenticates with its own secret and may only run
+// the commands its roles allow, see package acl.
+type User struct {
+	Name   string
+	Secret string
+	Roles  []string
+}
+
 // Config houses information loaded from the config file.
 type Cfg struct {
 	HeartbeatInterval int
@@ -14,6 +22,207 @@ type Cfg struct {
 	RemotePeers       []string
 	ListenPort        int
 	IsTesting         bool
+	// BloomfilterVersionPolicy is either "reject" or "ignore" and decides how
+	// remote bloom filters with an unknown serialization version are handled.
+	BloomfilterVersionPolicy string
+	// MaxValueBytes caps the size of a single value. Zero means no cap.
+	MaxValueBytes int
+	// MaxTTLSeconds clamps any requested expiration. Zero means no cap.
+	MaxTTLSeconds int
+	// WALPath is where the write-ahead log lives. Empty disables the log.
+	WALPath string
+	// WALFsync is either "always", "everysec" or "never" and decides how
+	// often the write-ahead log is synced to disk.
+	WALFsync string
+	// SnapshotPath is where snapshots are written to and loaded from.
+	SnapshotPath string
+	// SnapshotIntervalSeconds is how often a snapshot is taken (truncating
+	// the write-ahead log). Zero disables periodic snapshots.
+	SnapshotIntervalSeconds int
+	// HeapInitialCapacity is how many pending expirations the expiration
+	// heaps have room for before they have to grow, split across the cache's
+	// shards.
+	HeapInitialCapacity int
+	// HeapGrowthFactor is how much of its size the expiration heap grows by
+	// once it's full.
+	HeapGrowthFactor float64
+	// PresizeHeapFromSnapshot sizes the expiration heap for every pending
+	// expiration in the snapshot loaded at startup, so loading it never grows
+	// the heap.
+	PresizeHeapFromSnapshot bool
+	// AdvertiseAddress is the ip:port other nodes reach us on. Peers with
+	// this address are never connected to.
+	AdvertiseAddress string
+	// ClusterSecret is the secret nodes authenticate to each other with,
+	// and clients send with AUTH. Empty disables authentication.
+	ClusterSecret string
+	// ReplicationRetryQueueSize bounds how many failed replication writes
+	// are kept for retrying, per replica. Zero disables retrying.
+	ReplicationRetryQueueSize int
+	// ReplicationRetryQueuePath is a directory retry queues are persisted
+	// to. Empty keeps them in memory only.
+	ReplicationRetryQueuePath string
+	// ReadPreference is either "LOCAL_FIRST" or "OWNER_FIRST" and decides
+	// whether a Get prefers our own copy of a key or its owner's.
+	ReadPreference string
+	// BloomfilterPartitions splits the keyspace into this many hash-range
+	// partitions with a bloom filter each, so peers are routed to per
+	// partition. Zero or one keeps a single filter per node.
+	BloomfilterPartitions int
+	// BroadcastOnBloomMiss sends a GET to every connected peer when no
+	// peer's bloom filter claims a key, in case the filters are stale.
+	BroadcastOnBloomMiss bool
+	// MaxEvictionsPerSweep caps how many expired keys a single sweep
+	// evicts, leaving the rest to the next sweep. Zero means no cap.
+	MaxEvictionsPerSweep int
+	// BloomfilterHashScheme is either "independent" or "double" and decides
+	// how bloom filter indices are derived. Must match across the cluster.
+	BloomfilterHashScheme string
+	// MaxRangeKeys caps how many keys a single RANGE answers with.
+	MaxRangeKeys int
+	// SkipRedundantSets makes a SET of the value a key already holds a
+	// no-op, rather than rewriting it.
+	SkipRedundantSets bool
+	// MaxMessageBytes caps the size of a single incoming message, framed
+	// payloads included. Connections exceeding it are closed. Zero means no
+	// cap.
+	MaxMessageBytes int
+	// OverwriteClearsTTL makes a plain SET of a key with a pending
+	// expiration remove that expiration, so the key is kept for good. When
+	// unset, the key still expires on its original schedule.
+	OverwriteClearsTTL bool
+	// AdaptiveBloomfilter grows our bloom filters once the measured
+	// false-positive rate of remote lookups stays above
+	// BloomfilterTargetFPRate. Peers must grow theirs alike.
+	AdaptiveBloomfilter bool
+	// BloomfilterTargetFPRate is the false-positive rate adaptive resizing
+	// aims for.
+	BloomfilterTargetFPRate float64
+	// BloomfilterFPMargin is how far, as a fraction of the target, the
+	// measured rate may exceed BloomfilterTargetFPRate before it counts
+	// against the filter.
+	BloomfilterFPMargin float64
+	// BloomfilterFPWindow is how many remote lookups the false-positive rate
+	// is measured over.
+	BloomfilterFPWindow int
+	// MaxEntries caps how many keys the cache holds, evicting keys picked by
+	// the EvictionPolicy to make room. Zero means no cap.
+	MaxEntries int
+	// MaxBytes caps the approximate memory the cache's keys and values take
+	// up (see Cache.MemoryUsage), evicting keys picked by the EvictionPolicy
+	// to make room. Zero means no cap.
+	MaxBytes int
+	// EvictionIntervalMillis is how long apart expired keys are evicted in
+	// the background while sweeps are capped or maintenance is paused;
+	// otherwise keys are evicted as they expire. Zero turns background
+	// eviction off.
+	EvictionIntervalMillis int
+	// EvictionPolicy picks which keys are evicted once MaxEntries or
+	// MaxBytes is reached: "allkeys-lru", "allkeys-lfu", "volatile-ttl" or
+	// "allkeys-random".
+	EvictionPolicy string
+	// MetricsAddress is the address, e.g. ":9090", Prometheus metrics are
+	// served on under /metrics. Empty turns the endpoint off.
+	MetricsAddress string
+	// MaxNamespaces caps how many namespaces SELECT can open besides the
+	// default one. Zero turns namespaces off.
+	MaxNamespaces int
+	// RESPPort is the port a Redis (RESP) compatible listener accepts
+	// connections on, alongside the native protocol's ListenPort. Zero
+	// turns it off.
+	RESPPort int
+	// MemcachePort is the port a memcached (text protocol) compatible
+	// listener accepts connections on. Zero turns it off.
+	MemcachePort int
+	// MemcacheUnauthenticated serves the memcached port, which has no way to
+	// authenticate, even when there's a cluster secret or any users. Without
+	// it the port refuses to start then.
+	MemcacheUnauthenticated bool
+	// GRPCPort is the port the gRPC API is served on. Zero turns it off.
+	GRPCPort int
+	// HTTPPort is the port the HTTP API is served on. Zero turns it off.
+	HTTPPort int
+	// TLSCertFile and TLSKeyFile are the PEM encoded certificate and key
+	// every listener serves TLS with, and we present to other nodes. Empty
+	// turns TLS off.
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSCAFile is a PEM encoded CA bundle other nodes' and clients'
+	// certificates are verified against. Empty uses the system's roots for
+	// other nodes and doesn't verify clients.
+	TLSCAFile string
+	// TLSRequireClientCert refuses connections which don't present a
+	// certificate signed by TLSCAFile.
+	TLSRequireClientCert bool
+	// Users are the clients which can authenticate besides with the cluster
+	// secret, each limited to the commands its roles allow. Declaring any
+	// makes clients authenticate.
+	Users []User
+	// ReplicationFactor is how many nodes own each key, picked along the
+	// hash ring. Writes go to a key's owners and reads ask them first. Zero
+	// turns placement off, leaving keys on whichever node they're sent to.
+	ReplicationFactor int
+	// AsyncReplication forwards writes to a key's other owners in the
+	// background rather than waiting on them before answering.
+	AsyncReplication bool
+	// ReadRepair reads a key from every replica rather than the first one
+	// found, and rewrites the replicas holding a different value than the
+	// authoritative one.
+	ReadRepair bool
+	// HintedHandoffLimit is how many writes are kept, per owner, for the
+	// owners which are down when the writes are placed, to hand off once
+	// they connect again. Zero turns hinted handoff off.
+	HintedHandoffLimit int
+	// GossipIntervalMillis is how often cluster membership is gossiped with
+	// a random peer, which also probes it for failures. RemotePeers are
+	// then only the seeds to join through. Zero turns gossip off, leaving
+	// the peers to RemotePeers and what they list when we connect.
+	GossipIntervalMillis int
+	// SuspicionTimeoutMillis is how long a member which failed a probe is
+	// suspected before it's declared dead and dropped, unless it refutes
+	// it.
+	SuspicionTimeoutMillis int
+	// HeartbeatFailureThreshold is how many heartbeats in a row a peer may
+	// miss before it's considered timed out.
+	HeartbeatFailureThreshold int
+	// ReconnectBackoffMaxMillis caps the wait between attempts to reconnect
+	// to a peer, which doubles after every failed attempt starting from a
+	// HeartbeatInterval.
+	ReconnectBackoffMaxMillis int
+	// PeerPoolSize is how many connections we hold to every peer, which
+	// requests are spread over so that they don't queue up behind one
+	// another.
+	PeerPoolSize int
+	// ParallelRemoteGets asks every peer whose bloom filter claims a key for
+	// it at once, taking the first value found, rather than asking them in
+	// turn starting from the one the key has affinity with.
+	ParallelRemoteGets bool
+	// RemoteGetTimeoutMillis is how long a parallel remote GET waits on its
+	// peers in all before giving up.
+	RemoteGetTimeoutMillis int
+	// ShutdownTimeoutMillis is how long a node shutting down waits for the
+	// requests it's serving and its background work to finish.
+	ShutdownTimeoutMillis int
+	// RebalanceBatchSize is how many keys are moved to their new owners at a
+	// time when the hash ring changes. Zero moves them all at once.
+	RebalanceBatchSize int
+	// RebalanceBatchDelayMillis is how long rebalancing pauses between
+	// batches, throttling how fast keys are moved.
+	RebalanceBatchDelayMillis int
+	// BloomfilterDeltaSets is how many keys are added to our bloom filter
+	// before the bits they set are pushed to our peers, between the full
+	// exchanges every HeartbeatLoop seconds. Zero only does full exchanges.
+	BloomfilterDeltaSets int
+	// PeerFilter is either "bloom" or "cuckoo" and decides which filters
+	// nodes exchange to route remote gets by. The whole cluster has to
+	// agree on it.
+	PeerFilter string
+	// BloomfilterHash is what bloom filters hash keys with: "mixed",
+	// "murmur3", "xxhash" or "fnv". Must match across the cluster.
+	BloomfilterHash string
+	// BloomfilterEncoding is how bloom filters are sent to peers: "text",
+	// "binary" or "gzip". Every node reads all of them.
+	BloomfilterEncoding string
 }
 
 // ReadConfig handles opening a file and creating a config object for use
@@ -23,6 +232,10 @@ func ReadConfig() *Cfg {
 	viper.SetConfigType("yaml")
 	viper.AddConfigPath("../")
 	viper.AddConfigPath(".")
+	// Every value can be overridden from the environment, e.g.
+	// OLIVIA_LISTENPORT=5455.
+	viper.SetEnvPrefix("olivia")
+	viper.AutomaticEnv()
 
 	viper.SetDefault("bfsize", 1000)
 	viper.SetDefault("heartbeatloop", 30)
@@ -31,6 +244,67 @@ func ReadConfig() *Cfg {
 	// By default we assume no peers because we assume we're a base node.
 	viper.SetDefault("remotepeers", []string{})
 	viper.SetDefault("listenport", 5454)
+	viper.SetDefault("bloomfilterversionpolicy", "reject")
+	viper.SetDefault("maxvaluebytes", 0)
+	viper.SetDefault("maxttlseconds", 0)
+	viper.SetDefault("walpath", "")
+	viper.SetDefault("walfsync", "always")
+	viper.SetDefault("snapshotpath", "")
+	viper.SetDefault("snapshotintervalseconds", 0)
+	viper.SetDefault("heapinitialcapacity", 100)
+	viper.SetDefault("heapgrowthfactor", 0.5)
+	viper.SetDefault("presizeheapfromsnapshot", false)
+	viper.SetDefault("advertiseaddress", "")
+	viper.SetDefault("clustersecret", "")
+	viper.SetDefault("replicationretryqueuesize", 1000)
+	viper.SetDefault("replicationretryqueuepath", "")
+	viper.SetDefault("readpreference", "LOCAL_FIRST")
+	viper.SetDefault("bloomfilterpartitions", 0)
+	viper.SetDefault("broadcastonbloommiss", false)
+	viper.SetDefault("maxevictionspersweep", 0)
+	viper.SetDefault("bloomfilterhashscheme", "independent")
+	viper.SetDefault("maxrangekeys", 1000)
+	viper.SetDefault("skipredundantsets", true)
+	viper.SetDefault("maxmessagebytes", 16777216)
+	viper.SetDefault("overwriteclearsttl", true)
+	viper.SetDefault("adaptivebloomfilter", false)
+	viper.SetDefault("bloomfiltertargetfprate", 0.01)
+	viper.SetDefault("bloomfilterfpmargin", 0.5)
+	viper.SetDefault("bloomfilterfpwindow", 1000)
+	viper.SetDefault("maxentries", 0)
+	viper.SetDefault("maxbytes", 0)
+	viper.SetDefault("evictionintervalmillis", 1000)
+	viper.SetDefault("evictionpolicy", "allkeys-lru")
+	viper.SetDefault("metricsaddress", "")
+	viper.SetDefault("maxnamespaces", 16)
+	viper.SetDefault("respport", 0)
+	viper.SetDefault("memcacheport", 0)
+	viper.SetDefault("memcacheunauthenticated", false)
+	viper.SetDefault("grpcport", 0)
+	viper.SetDefault("httpport", 0)
+	viper.SetDefault("tlscertfile", "")
+	viper.SetDefault("tlskeyfile", "")
+	viper.SetDefault("tlscafile", "")
+	viper.SetDefault("tlsrequireclientcert", false)
+	viper.SetDefault("users", []User{})
+	viper.SetDefault("replicationfactor", 0)
+	viper.SetDefault("asyncreplication", false)
+	viper.SetDefault("readrepair", false)
+	viper.SetDefault("hintedhandofflimit", 10000)
+	viper.SetDefault("gossipintervalmillis", 1000)
+	viper.SetDefault("suspiciontimeoutmillis", 5000)
+	viper.SetDefault("heartbeatfailurethreshold", 10)
+	viper.SetDefault("reconnectbackoffmaxmillis", 60000)
+	viper.SetDefault("peerpoolsize", 4)
+	viper.SetDefault("parallelremotegets", true)
+	viper.SetDefault("remotegettimeoutmillis", 2000)
+	viper.SetDefault("shutdowntimeoutmillis", 30000)
+	viper.SetDefault("rebalancebatchsize", 100)
+	viper.SetDefault("rebalancebatchdelaymillis", 100)
+	viper.SetDefault("bloomfilterdeltasets", 100)
+	viper.SetDefault("peerfilter", "bloom")
+	viper.SetDefault("bloomfilterhash", "mixed")
+	viper.SetDefault("bloomfilterencoding", "text")
 
 	err := viper.ReadInConfig()
 	if err != nil {
@@ -38,13 +312,98 @@ func ReadConfig() *Cfg {
 		log.Println("No config file found! Falling back to defaults.")
 	}
 
+	var users []User
+	if err := viper.UnmarshalKey("users", &users); err != nil {
+		// Carrying on without them could leave the node open.
+		log.Fatalf("Failed to read Users: %v", err)
+	}
+
 	return &Cfg{
-		viper.Get("heartbeatinterval").(int),
-		viper.Get("heartbeatloop").(int),
-		uint(viper.Get("bfsize").(int)),
-		viper.GetBool("basenode"),
-		viper.GetStringSlice("remotepeers"),
-		viper.GetInt("listenport"),
-		false,
+		HeartbeatInterval:         viper.Get("heartbeatinterval").(int),
+		HeartbeatLoop:             viper.Get("heartbeatloop").(int),
+		BloomfilterSize:           uint(viper.Get("bfsize").(int)),
+		BaseNode:                  viper.GetBool("basenode"),
+		RemotePeers:               viper.GetStringSlice("remotepeers"),
+		ListenPort:                viper.GetInt("listenport"),
+		IsTesting:                 false,
+		BloomfilterVersionPolicy:  viper.GetString("bloomfilterversionpolicy"),
+		MaxValueBytes:             viper.GetInt("maxvaluebytes"),
+		MaxTTLSeconds:             viper.GetInt("maxttlseconds"),
+		WALPath:                   viper.GetString("walpath"),
+		WALFsync:                  viper.GetString("walfsync"),
+		SnapshotPath:              viper.GetString("snapshotpath"),
+		SnapshotIntervalSeconds:   viper.GetInt("snapshotintervalseconds"),
+		HeapInitialCapacity:       viper.GetInt("heapinitialcapacity"),
+		HeapGrowthFactor:          viper.GetFloat64("heapgrowthfactor"),
+		PresizeHeapFromSnapshot:   viper.GetBool("presizeheapfromsnapshot"),
+		AdvertiseAddress:          viper.GetString("advertiseaddress"),
+		ClusterSecret:             viper.GetString("clustersecret"),
+		ReplicationRetryQueueSize: viper.GetInt("replicationretryqueuesize"),
+		ReplicationRetryQueuePath: viper.GetString("replicationretryqueuepath"),
+		ReadPreference:            viper.GetString("readpreference"),
+		BloomfilterPartitions:     viper.GetInt("bloomfilterpartitions"),
+		BroadcastOnBloomMiss:      viper.GetBool("broadcastonbloommiss"),
+		MaxEvictionsPerSweep:      viper.GetInt("maxevictionspersweep"),
+		BloomfilterHashScheme:     viper.GetString("bloomfilterhashscheme"),
+		MaxRangeKeys:              viper.GetInt("maxrangekeys"),
+		SkipRedundantSets:         viper.GetBool("skipredundantsets"),
+		MaxMessageBytes:           viper.GetInt("maxmessagebytes"),
+		OverwriteClearsTTL:        viper.GetBool("overwriteclearsttl"),
+		AdaptiveBloomfilter:       viper.GetBool("adaptivebloomfilter"),
+		BloomfilterTargetFPRate:   viper.GetFloat64("bloomfiltertargetfprate"),
+		BloomfilterFPMargin:       viper.GetFloat64("bloomfilterfpmargin"),
+		BloomfilterFPWindow:       viper.GetInt("bloomfilterfpwindow"),
+		MaxEntries:                viper.GetInt("maxentries"),
+		MaxBytes:                  viper.GetInt("maxbytes"),
+		EvictionIntervalMillis:    viper.GetInt("evictionintervalmillis"),
+		EvictionPolicy:            viper.GetString("evictionpolicy"),
+		MetricsAddress:            viper.GetString("metricsaddress"),
+		MaxNamespaces:             viper.GetInt("maxnamespaces"),
+		RESPPort:                  viper.GetInt("respport"),
+		MemcachePort:              viper.GetInt("memcacheport"),
+		MemcacheUnauthenticated:   viper.GetBool("memcacheunauthenticated"),
+		GRPCPort:                  viper.GetInt("grpcport"),
+		HTTPPort:                  viper.GetInt("httpport"),
+		TLSCertFile:               viper.GetString("tlscertfile"),
+		TLSKeyFile:                viper.GetString("tlskeyfile"),
+		TLSCAFile:                 viper.GetString("tlscafile"),
+		TLSRequireClientCert:      viper.GetBool("tlsrequireclientcert"),
+		Users:                     users,
+		ReplicationFactor:         viper.GetInt("replicationfactor"),
+		AsyncReplication:          viper.GetBool("asyncreplication"),
+		ReadRepair:                viper.GetBool("readrepair"),
+		HintedHandoffLimit:        viper.GetInt("hintedhandofflimit"),
+		GossipIntervalMillis:      viper.GetInt("gossipintervalmillis"),
+		SuspicionTimeoutMillis:    viper.GetInt("suspiciontimeoutmillis"),
+		HeartbeatFailureThreshold: viper.GetInt("heartbeatfailurethreshold"),
+		ReconnectBackoffMaxMillis: viper.GetInt("reconnectbackoffmaxmillis"),
+		PeerPoolSize:              viper.GetInt("peerpoolsize"),
+		ParallelRemoteGets:        viper.GetBool("parallelremotegets"),
+		RemoteGetTimeoutMillis:    viper.GetInt("remotegettimeoutmillis"),
+		ShutdownTimeoutMillis:     viper.GetInt("shutdowntimeoutmillis"),
+		RebalanceBatchSize:        viper.GetInt("rebalancebatchsize"),
+		RebalanceBatchDelayMillis: viper.GetInt("rebalancebatchdelaymillis"),
+		BloomfilterDeltaSets:      viper.GetInt("bloomfilterdeltasets"),
+		PeerFilter:                viper.GetString("peerfilter"),
+		BloomfilterHash:           viper.GetString("bloomfilterhash"),
+		BloomfilterEncoding:       viper.GetString("bloomfilterencoding"),
+	}
+}
+
+// redactedSecret replaces secrets in a redacted config.
+const redactedSecret = "<redacted>"
+
+// Redacted returns a copy of the config which is safe to show, with its
+// secrets replaced.
+func (c Cfg) Redacted() Cfg {
+	c.RemotePeers = append([]string(nil), c.RemotePeers...)
+	if c.ClusterSecret != "" {
+		c.ClusterSecret = redactedSecret
 	}
+	c.Users = append([]User(nil), c.Users...)
+	for i := range c.Users {
+		c.Users[i].Secret = redactedSecret
+	}
+
+	return c
 }
@@ -38,3 +38,35 @@ func TestConfig(t *testing.T) {
 	}
 
 }
+
+func TestEnvironmentOverridesConfigFile(t *testing.T) {
+	t.Setenv("OLIVIA_MAXRANGEKEYS", "42")
+
+	if cfg := ReadConfig(); cfg.MaxRangeKeys != 42 {
+		t.Errorf("Expected 42, got %v", cfg.MaxRangeKeys)
+	}
+}
+
+func TestRedactedHidesSecrets(t *testing.T) {
+	cfg := Cfg{ClusterSecret: "s3cret", RemotePeers: []string{"127.0.0.1:5454"}}
+	redacted := cfg.Redacted()
+
+	if redacted.ClusterSecret != redactedSecret {
+		t.Errorf("Expected %v, got %v", redactedSecret, redacted.ClusterSecret)
+	}
+
+	redacted.RemotePeers[0] = "changed"
+	if cfg.ClusterSecret != "s3cret" || cfg.RemotePeers[0] != "127.0.0.1:5454" {
+		t.Errorf("Expected the original config to be left alone, got %v", cfg)
+	}
+
+	cfg.Users = []User{{Name: "reader", Secret: "pw", Roles: []string{"read-only"}}}
+	redacted = cfg.Redacted()
+	if redacted.Users[0].Secret != redactedSecret || cfg.Users[0].Secret != "pw" {
+		t.Errorf("Expected only the copy's user secret to be redacted, got %v", redacted.Users)
+	}
+
+	if (Cfg{}).Redacted().ClusterSecret != "" {
+		t.Errorf("Expected an unset secret to stay unset")
+	}
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+)
+
+// TLSEnabled reports whether connections are encrypted, which they are once
+// a certificate is configured.
+func (c Cfg) TLSEnabled() bool {
+	return c.TLSCertFile != ""
+}
+
+// ServerTLS returns the TLS config our listeners serve with, or nil if TLS
+// is off. Client certificates are verified against TLSCAFile when it's set,
+// and required if TLSRequireClientCert is.
+func (c Cfg) ServerTLS() (*tls.Config, error) {
+	if !c.TLSEnabled() {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.TLSCertFile, c.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load TLS certificate: %v", err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if c.TLSCAFile != "" {
+		pool, err := c.caPool()
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	if c.TLSRequireClientCert {
+		if c.TLSCAFile == "" {
+			return nil, fmt.Errorf("TLSRequireClientCert needs a TLSCAFile to verify client certificates with")
+		}
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
+
+// ClientTLS returns the TLS config we connect to other nodes with, or nil if
+// TLS is off. Nodes' certificates are verified against TLSCAFile, or the
+// system's roots if it's unset, and we present our own certificate in case
+// they require one.
+func (c Cfg) ClientTLS() (*tls.Config, error) {
+	if !c.TLSEnabled() {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.TLSCertFile, c.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load TLS certificate: %v", err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if c.TLSCAFile != "" {
+		if tlsConfig.RootCAs, err = c.caPool(); err != nil {
+			return nil, err
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// Listen listens for TCP connections on `address`, over TLS if it's on.
+func (c Cfg) Listen(address string) (net.Listener, error) {
+	tlsConfig, err := c.ServerTLS()
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+
+	return listener, nil
+}
+
+func (c Cfg) caPool() (*x509.CertPool, error) {
+	pem, err := os.ReadFile(c.TLSCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read TLS CA: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("No certificates found in %v", c.TLSCAFile)
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,210 @@
+package config
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert writes a certificate for 127.0.0.1 and its key into `dir`,
+// signed by `parent` or self-signed if that's nil, and returns it.
+func writeCert(t *testing.T, dir string, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage: []x509.ExtKeyUsage{
+			x509.ExtKeyUsageServerAuth,
+			x509.ExtKeyUsageClientAuth,
+		},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	os.WriteFile(filepath.Join(dir, name+".pem"), certPEM, 0600)
+	os.WriteFile(filepath.Join(dir, name+".key"), keyPEM, 0600)
+
+	cert, _ := x509.ParseCertificate(der)
+	return cert, key
+}
+
+// tlsConfigs returns a server and a client config whose certificates are
+// signed by the same CA.
+func tlsConfigs(t *testing.T) (Cfg, Cfg) {
+	dir := t.TempDir()
+	ca, caKey := writeCert(t, dir, "ca", nil, nil)
+	writeCert(t, dir, "server", ca, caKey)
+	writeCert(t, dir, "client", ca, caKey)
+
+	server := Cfg{
+		TLSCertFile: filepath.Join(dir, "server.pem"),
+		TLSKeyFile:  filepath.Join(dir, "server.key"),
+		TLSCAFile:   filepath.Join(dir, "ca.pem"),
+	}
+	client := Cfg{
+		TLSCertFile: filepath.Join(dir, "client.pem"),
+		TLSKeyFile:  filepath.Join(dir, "client.key"),
+		TLSCAFile:   filepath.Join(dir, "ca.pem"),
+	}
+
+	return server, client
+}
+
+// echoOnce accepts a single connection and echoes a line back over it.
+func echoOnce(listener net.Listener) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err == nil {
+		conn.Write([]byte(line))
+	}
+}
+
+func dialEcho(address string, tlsConfig *tls.Config) (string, error) {
+	conn, err := tls.Dial("tcp", address, tlsConfig)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("hello\n")); err != nil {
+		return "", err
+	}
+
+	return bufio.NewReader(conn).ReadString('\n')
+}
+
+func TestTLSOffByDefault(t *testing.T) {
+	var cfg Cfg
+
+	if cfg.TLSEnabled() {
+		t.Fatalf("Expected TLS to be off")
+	}
+
+	server, err := cfg.ServerTLS()
+	if server != nil || err != nil {
+		t.Fatalf("Expected no TLS config, got %v %v", server, err)
+	}
+
+	client, err := cfg.ClientTLS()
+	if client != nil || err != nil {
+		t.Fatalf("Expected no TLS config, got %v %v", client, err)
+	}
+}
+
+func TestListenServesTLS(t *testing.T) {
+	serverCfg, clientCfg := tlsConfigs(t)
+
+	listener, err := serverCfg.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer listener.Close()
+	go echoOnce(listener)
+
+	clientTLS, err := clientCfg.ClientTLS()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	line, err := dialEcho(listener.Addr().String(), clientTLS)
+	if err != nil || line != "hello\n" {
+		t.Fatalf("Expected %q, got %q %v", "hello\n", line, err)
+	}
+}
+
+func TestClientCertificateRequired(t *testing.T) {
+	serverCfg, clientCfg := tlsConfigs(t)
+	serverCfg.TLSRequireClientCert = true
+
+	listener, err := serverCfg.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer listener.Close()
+
+	clientTLS, err := clientCfg.ClientTLS()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// Without a certificate the handshake fails.
+	go echoOnce(listener)
+	anonymous := clientTLS.Clone()
+	anonymous.Certificates = nil
+	if _, err := dialEcho(listener.Addr().String(), anonymous); err == nil {
+		t.Fatalf("Expected a client without a certificate to be refused")
+	}
+
+	go echoOnce(listener)
+	line, err := dialEcho(listener.Addr().String(), clientTLS)
+	if err != nil || line != "hello\n" {
+		t.Fatalf("Expected %q, got %q %v", "hello\n", line, err)
+	}
+}
+
+func TestTLSConfigErrors(t *testing.T) {
+	serverCfg, _ := tlsConfigs(t)
+
+	missingKey := serverCfg
+	missingKey.TLSKeyFile = filepath.Join(t.TempDir(), "missing.key")
+	if _, err := missingKey.ServerTLS(); err == nil {
+		t.Fatalf("Expected a missing key to fail")
+	}
+
+	missingCA := serverCfg
+	missingCA.TLSCAFile = filepath.Join(t.TempDir(), "missing.pem")
+	if _, err := missingCA.ClientTLS(); err == nil {
+		t.Fatalf("Expected a missing CA to fail")
+	}
+
+	badCA := serverCfg
+	badCA.TLSCAFile = serverCfg.TLSKeyFile
+	if _, err := badCA.ServerTLS(); err == nil {
+		t.Fatalf("Expected a CA file without certificates to fail")
+	}
+
+	noCA := serverCfg
+	noCA.TLSCAFile = ""
+	noCA.TLSRequireClientCert = true
+	if _, err := noCA.ServerTLS(); err == nil {
+		t.Fatalf("Expected requiring client certificates without a CA to fail")
+	}
+}
@@ -0,0 +1,75 @@
+package dht
+
+import (
+	"github.com/GrappigPanda/Olivia/config"
+	"time"
+)
+
+// The heartbeat settings used when none are configured.
+const (
+	defaultHeartbeatInterval   = time.Second
+	defaultFailureThreshold    = 10
+	defaultReconnectBackoffMax = time.Minute
+)
+
+// HeartbeatInterval returns how often peers are sent a heartbeat.
+func HeartbeatInterval(cfg config.Cfg) time.Duration {
+	if cfg.HeartbeatInterval <= 0 {
+		return defaultHeartbeatInterval
+	}
+
+	return time.Duration(cfg.HeartbeatInterval) * time.Millisecond
+}
+
+// failureThreshold returns how many heartbeats in a row a peer may miss before
+// it's considered timed out.
+func failureThreshold(cfg config.Cfg) int {
+	if cfg.HeartbeatFailureThreshold <= 0 {
+		return defaultFailureThreshold
+	}
+
+	return cfg.HeartbeatFailureThreshold
+}
+
+// Backoff spaces out retries exponentially: every wait Next hands out is
+// twice the last, starting from Min and capped at Max, until it's Reset.
+type Backoff struct {
+	Min  time.Duration
+	Max  time.Duration
+	next time.Duration
+}
+
+// ReconnectBackoff returns the backoff between attempts to reconnect to a
+// peer, starting from a heartbeat interval and capped at
+// ReconnectBackoffMaxMillis.
+func ReconnectBackoff(cfg config.Cfg) *Backoff {
+	min := HeartbeatInterval(cfg)
+	max := time.Duration(cfg.ReconnectBackoffMaxMillis) * time.Millisecond
+	if max <= 0 {
+		max = defaultReconnectBackoffMax
+	}
+	if max < min {
+		max = min
+	}
+
+	return &Backoff{Min: min, Max: max}
+}
+
+// Next returns how long to wait before the next retry.
+func (b *Backoff) Next() time.Duration {
+	if b.next < b.Min {
+		b.next = b.Min
+	}
+
+	wait := b.next
+	if b.next *= 2; b.next > b.Max {
+		b.next = b.Max
+	}
+
+	return wait
+}
+
+// Reset starts the backoff over from Min.
+func (b *Backoff) Reset() {
+	b.next = 0
+}
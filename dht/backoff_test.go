@@ -0,0 +1,35 @@
+package dht
+
+import (
+	"github.com/GrappigPanda/Olivia/config"
+	"testing"
+	"time"
+)
+
+func TestBackoffDoublesUpToMax(t *testing.T) {
+	backoff := &Backoff{Min: time.Second, Max: 5 * time.Second}
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for _, wait := range expected {
+		if got := backoff.Next(); got != wait {
+			t.Fatalf("Expected %v, got %v", wait, got)
+		}
+	}
+
+	backoff.Reset()
+	if got := backoff.Next(); got != time.Second {
+		t.Fatalf("Expected %v, got %v", time.Second, got)
+	}
+}
+
+func TestReconnectBackoffFromConfig(t *testing.T) {
+	backoff := ReconnectBackoff(config.Cfg{})
+	if backoff.Min != defaultHeartbeatInterval || backoff.Max != defaultReconnectBackoffMax {
+		t.Fatalf("Expected the defaults, got %v and %v", backoff.Min, backoff.Max)
+	}
+
+	backoff = ReconnectBackoff(config.Cfg{HeartbeatInterval: 500, ReconnectBackoffMaxMillis: 100})
+	if backoff.Min != 500*time.Millisecond || backoff.Max != 500*time.Millisecond {
+		t.Fatalf("Expected the max to be raised to the min, got %v and %v", backoff.Min, backoff.Max)
+	}
+}
@@ -0,0 +1,102 @@
+package dht
+
+import (
+	"github.com/GrappigPanda/Olivia/bloomfilter"
+)
+
+// FilterHook is called whenever a peer's bloom filters change, whether a new
+// one was received or a delta was applied to the one we hold.
+type FilterHook func(peer *Peer)
+
+// SetFilterHook makes `hook` hear of every change to the peer's bloom filters
+// from now on. It's called without the peer locked.
+func (p *Peer) SetFilterHook(hook FilterHook) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.filterHook = hook
+}
+
+func (p *Peer) notifyFilter() {
+	p.Lock()
+	hook := p.filterHook
+	p.Unlock()
+
+	if hook != nil {
+		hook(p)
+	}
+}
+
+// AddToFilter sets bit `indices` in the peer's whole-node bloom filter, as
+// sent by the peer for the keys it was written since we last fetched its
+// filter. Indices beyond the filter, which the peer's filter outgrew, are
+// skipped until the next full exchange. It reports whether we hold a filter
+// to add them to.
+func (p *Peer) AddToFilter(indices []uint) bool {
+	p.Lock()
+	if p.BloomFilter == nil {
+		p.Unlock()
+		return false
+	}
+
+	// The filter is copied rather than changed in place, as searches may
+	// be reading it.
+	updated, err := p.copyFilter()
+	if err != nil {
+		p.Unlock()
+		return false
+	}
+	for _, index := range indices {
+		if index < updated.GetMaxSize() {
+			updated.GetStorage().Add(index)
+		}
+	}
+	p.BloomFilter = updated
+	p.Unlock()
+
+	p.notifyFilter()
+	return true
+}
+
+// copyFilter returns a copy of the peer's whole-node bloom filter. The caller
+// must hold the peer locked.
+func (p *Peer) copyFilter() (bloomfilter.BloomFilter, error) {
+	copied, err := bloomfilter.DeserializeWithHash(
+		p.BloomFilter.Serialize(),
+		p.bfItems,
+		p.bfVersionPolicy,
+		p.bfHash,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return copied, nil
+}
+
+// OnFilterChange makes `hook` hear of the bloom filter changes of every peer
+// in the list, and of every peer created through NewPeer from now on.
+func (p *PeerList) OnFilterChange(hook FilterHook) {
+	p.filterHook.Store(hook)
+
+	p.Lock()
+	peers := append(append([]*Peer{}, p.Peers...), p.BackupPeers...)
+	p.Unlock()
+
+	for _, peer := range peers {
+		if peer != nil {
+			peer.SetFilterHook(hook)
+		}
+	}
+}
+
+// RefreshBloomFilters fetches the bloom filters of every active peer we're
+// connected to again, as their keys change. The filters are swapped in as
+// they arrive, each telling the filter hook.
+func (p *PeerList) RefreshBloomFilters() {
+	for _, peer := range p.GetPeers() {
+		if peer != nil && peer.IsConnectable() {
+			go peer.GetBloomFilter()
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package dht
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemberState is where a member stands in the cluster, as gossiped between
+// nodes.
+type MemberState int
+
+const (
+	// Alive members answer probes, or have refuted being suspected.
+	Alive MemberState = iota
+	// Suspect members failed a probe, and are declared dead unless they
+	// refute it before the suspicion timeout.
+	Suspect
+	// Dead members were suspected for longer than the suspicion timeout.
+	Dead
+	// Left members announced they were leaving.
+	Left
+)
+
+// String returns the state's lowercase name, which is also how it's gossiped.
+func (s MemberState) String() string {
+	switch s {
+	case Alive:
+		return "alive"
+	case Suspect:
+		return "suspect"
+	case Dead:
+		return "dead"
+	case Left:
+		return "left"
+	}
+
+	return fmt.Sprintf("unknown(%d)", int(s))
+}
+
+// Member is a node of the cluster as we last heard of it. Only the member
+// itself bumps its Incarnation, to refute being suspected or declared dead.
+type Member struct {
+	Address     string
+	State       MemberState
+	Incarnation uint64
+}
+
+// overrides reports whether gossip about a member supersedes what we already
+// know of it. A later incarnation always wins, and at the same incarnation
+// suspecting a member beats it being alive, and it being dead or gone beats
+// both.
+func (m Member) overrides(current Member) bool {
+	if m.Incarnation != current.Incarnation {
+		return m.Incarnation > current.Incarnation
+	}
+
+	return m.State > current.State && !(current.State == Dead && m.State == Left)
+}
+
+// EscapeAddress turns an address's colons into underscores, for it to be
+// sent as a key, as the protocol splits arguments on colons.
+func EscapeAddress(address string) string {
+	return strings.Replace(address, ":", "_", -1)
+}
+
+// UnescapeAddress reverses EscapeAddress.
+func UnescapeAddress(address string) string {
+	return strings.Replace(address, "_", ":", -1)
+}
+
+// Format encodes a member as a `host_port:state:incarnation` argument.
+func (m Member) Format() string {
+	return fmt.Sprintf("%s:%s:%d", EscapeAddress(m.Address), m.State, m.Incarnation)
+}
+
+// ParseMember decodes a member from the parts of a
+// `host_port:state:incarnation` argument.
+func ParseMember(address string, state string, incarnation string) (Member, error) {
+	member := Member{Address: UnescapeAddress(address)}
+
+	switch strings.ToLower(state) {
+	case "alive":
+		member.State = Alive
+	case "suspect":
+		member.State = Suspect
+	case "dead":
+		member.State = Dead
+	case "left":
+		member.State = Left
+	default:
+		return member, fmt.Errorf("Unknown member state %v", state)
+	}
+
+	var err error
+	if member.Incarnation, err = strconv.ParseUint(incarnation, 10, 64); err != nil {
+		return member, fmt.Errorf("Invalid incarnation %v", incarnation)
+	}
+
+	return member, nil
+}
+
+// Membership tracks every member of the cluster we've heard of, SWIM-style:
+// members are suspected once they fail a probe, declared dead if they don't
+// refute it in time, and what we know is merged with what others gossip to
+// us.
+type Membership struct {
+	self    Member
+	members map[string]Member
+	// suspected holds when each suspect member was first suspected.
+	suspected map[string]time.Time
+	// onChange is told of every change to another member's state.
+	onChange func(Member)
+	sync.Mutex
+}
+
+// NewMembership creates the membership of a cluster we're `self` in.
+// `onChange` hears of every change to another member's state, and is called
+// without the membership locked.
+func NewMembership(self string, onChange func(Member)) *Membership {
+	return &Membership{
+		self:      Member{Address: self, State: Alive},
+		members:   make(map[string]Member),
+		suspected: make(map[string]time.Time),
+		onChange:  onChange,
+	}
+}
+
+// Self returns how we gossip ourselves.
+func (m *Membership) Self() Member {
+	m.Lock()
+	defer m.Unlock()
+
+	return m.self
+}
+
+// Members returns every member we know of, ourselves included, sorted by
+// address.
+func (m *Membership) Members() []Member {
+	m.Lock()
+	defer m.Unlock()
+
+	members := make([]Member, 0, len(m.members)+1)
+	members = append(members, m.self)
+	for _, member := range m.members {
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].Address < members[j].Address
+	})
+
+	return members
+}
+
+// Member returns what we know of the member at `address`.
+func (m *Membership) Member(address string) (Member, bool) {
+	m.Lock()
+	defer m.Unlock()
+
+	member, ok := m.members[address]
+	return member, ok
+}
+
+// Merge applies gossip about members. Gossip suspecting us, or declaring us
+// dead, is refuted by moving on to a later incarnation.
+func (m *Membership) Merge(gossip []Member) {
+	var changed []Member
+
+	m.Lock()
+	for _, member := range gossip {
+		if member.Address == m.self.Address {
+			if member.State != Alive && member.Incarnation >= m.self.Incarnation && m.self.State == Alive {
+				m.self.Incarnation = member.Incarnation + 1
+			}
+			continue
+		}
+
+		if m.update(member) {
+			changed = append(changed, member)
+		}
+	}
+	m.Unlock()
+
+	m.notify(changed)
+}
+
+// Suspect marks a member which failed a probe as suspect.
+func (m *Membership) Suspect(address string) {
+	m.Lock()
+	member, ok := m.members[address]
+	if !ok {
+		member = Member{Address: address}
+	}
+	member.State = Suspect
+	changed := m.update(member)
+	m.Unlock()
+
+	if changed {
+		m.notify([]Member{member})
+	}
+}
+
+// ExpireSuspects declares the members suspected for longer than `timeout`
+// dead.
+func (m *Membership) ExpireSuspects(timeout time.Duration) {
+	var changed []Member
+
+	m.Lock()
+	for address, since := range m.suspected {
+		if time.Since(since) < timeout {
+			continue
+		}
+
+		member := m.members[address]
+		member.State = Dead
+		if m.update(member) {
+			changed = append(changed, member)
+		}
+	}
+	m.Unlock()
+
+	m.notify(changed)
+}
+
+// Leave marks ourselves as having left, returning how to gossip it.
+func (m *Membership) Leave() Member {
+	m.Lock()
+	defer m.Unlock()
+
+	m.self.State = Left
+	return m.self
+}
+
+// update records `member` if it overrides what we know of it, reporting
+// whether it did. The caller must hold the membership locked.
+func (m *Membership) update(member Member) bool {
+	if current, ok := m.members[member.Address]; ok && !member.overrides(current) {
+		return false
+	}
+
+	m.members[member.Address] = member
+	if member.State == Suspect {
+		if _, ok := m.suspected[member.Address]; !ok {
+			m.suspected[member.Address] = time.Now()
+		}
+	} else {
+		delete(m.suspected, member.Address)
+	}
+
+	return true
+}
+
+func (m *Membership) notify(changed []Member) {
+	if m.onChange == nil {
+		return
+	}
+
+	for _, member := range changed {
+		m.onChange(member)
+	}
+}
@@ -0,0 +1,108 @@
+package dht
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemberOverrides(t *testing.T) {
+	alive := Member{"node", Alive, 1}
+
+	var cases = []struct {
+		update    Member
+		overrides bool
+	}{
+		{Member{"node", Alive, 2}, true},
+		{Member{"node", Alive, 1}, false},
+		{Member{"node", Suspect, 1}, true},
+		{Member{"node", Suspect, 0}, false},
+		{Member{"node", Dead, 1}, true},
+		{Member{"node", Left, 1}, true},
+	}
+
+	for _, c := range cases {
+		if got := c.update.overrides(alive); got != c.overrides {
+			t.Fatalf("Expected %v for %v, got %v", c.overrides, c.update, got)
+		}
+	}
+
+	// Only a later incarnation brings a dead member back.
+	dead := Member{"node", Dead, 1}
+	if (Member{"node", Alive, 1}).overrides(dead) || (Member{"node", Left, 1}).overrides(dead) {
+		t.Fatalf("Expected a dead member to stay dead")
+	}
+	if !(Member{"node", Alive, 2}).overrides(dead) {
+		t.Fatalf("Expected a later incarnation to bring the member back")
+	}
+}
+
+func TestMemberFormatRoundTrip(t *testing.T) {
+	member := Member{"127.0.0.1:5454", Suspect, 3}
+
+	parsed, err := ParseMember("127.0.0.1_5454", "suspect", "3")
+	if err != nil || parsed != member {
+		t.Fatalf("Expected %v, got %v %v", member, parsed, err)
+	}
+	if formatted := member.Format(); formatted != "127.0.0.1_5454:suspect:3" {
+		t.Fatalf("Expected %v, got %v", "127.0.0.1_5454:suspect:3", formatted)
+	}
+
+	if _, err := ParseMember("node", "sleeping", "3"); err == nil {
+		t.Fatalf("Expected an unknown state to fail")
+	}
+	if _, err := ParseMember("node", "alive", "soon"); err == nil {
+		t.Fatalf("Expected an invalid incarnation to fail")
+	}
+}
+
+func TestMembershipRefutesSuspicion(t *testing.T) {
+	membership := NewMembership("self", nil)
+
+	membership.Merge([]Member{{"self", Suspect, 0}})
+	if self := membership.Self(); self.State != Alive || self.Incarnation != 1 {
+		t.Fatalf("Expected to refute at incarnation 1, got %v", self)
+	}
+
+	// Gossip about an earlier incarnation is already refuted.
+	membership.Merge([]Member{{"self", Dead, 0}})
+	if self := membership.Self(); self.Incarnation != 1 {
+		t.Fatalf("Expected %v, got %v", 1, self.Incarnation)
+	}
+}
+
+func TestMembershipSuspicionTimesOut(t *testing.T) {
+	var changes []Member
+	membership := NewMembership("self", func(member Member) {
+		changes = append(changes, member)
+	})
+
+	membership.Merge([]Member{{"node", Alive, 0}})
+	membership.Suspect("node")
+
+	membership.ExpireSuspects(time.Hour)
+	if member, _ := membership.Member("node"); member.State != Suspect {
+		t.Fatalf("Expected %v, got %v", Suspect, member.State)
+	}
+
+	membership.ExpireSuspects(0)
+	if member, _ := membership.Member("node"); member.State != Dead {
+		t.Fatalf("Expected %v, got %v", Dead, member.State)
+	}
+
+	if len(changes) != 3 || changes[0].State != Alive || changes[1].State != Suspect || changes[2].State != Dead {
+		t.Fatalf("Expected alive, suspect then dead, got %v", changes)
+	}
+}
+
+func TestMembershipSuspectRefuted(t *testing.T) {
+	membership := NewMembership("self", nil)
+	membership.Merge([]Member{{"node", Alive, 0}})
+	membership.Suspect("node")
+
+	membership.Merge([]Member{{"node", Alive, 1}})
+	membership.ExpireSuspects(0)
+
+	if member, _ := membership.Member("node"); member.State != Alive {
+		t.Fatalf("Expected %v, got %v", Alive, member.State)
+	}
+}
@@ -1,7 +1,9 @@
 package dht
 
 import (
+	"context"
 	"crypto/md5"
+	"crypto/tls"
 	"encoding/hex"
 	"fmt"
 	"github.com/GrappigPanda/Olivia/bloomfilter"
@@ -13,6 +15,7 @@ import (
 	"log"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -30,6 +33,23 @@ const (
 	Timeout
 )
 
+// String returns the state's lowercase name, e.g. for metric labels.
+func (s State) String() string {
+	switch s {
+	case Disconnected:
+		return "disconnected"
+	case Connected:
+		return "connected"
+	case Timeout:
+		return "timeout"
+	}
+
+	return fmt.Sprintf("unknown(%d)", int(s))
+}
+
+// StatusHook is called whenever a peer moves from one state to another.
+type StatusHook func(peer *Peer, from State, to State)
+
 // Peer Houses the state for remote Peers
 type Peer struct {
 	Status       State
@@ -39,6 +59,59 @@ type Peer struct {
 	MessageBus   *message_handler.MessageHandler
 	UniqueID     string
 	failureCount int
+	// failureThreshold is how many heartbeats in a row the peer may miss
+	// before it's timed out.
+	failureThreshold int
+	// reconnect spaces out attempts to reconnect once the peer drops, the
+	// next of which is due at reconnectAt.
+	reconnect    *Backoff
+	reconnectAt  time.Time
+	reconnecting bool
+	// bfVersionPolicy decides how a remote bloom filter with an unknown
+	// serialization version is handled.
+	bfVersionPolicy bloomfilter.VersionPolicy
+	// bfItems is the item count our bloom filters are sized for, which
+	// remote filters have to be decoded with to line up with our hashes.
+	bfItems uint
+	// receivers holds the connections a response receiver is reading
+	// from. Only a single receiver may read from a connection, otherwise
+	// framed responses get split between readers.
+	receivers map[*net.Conn]bool
+	// pool holds the connections opened besides Conn, which requests are
+	// spread over along with it. poolSize is how many connections to hold
+	// in all, and nextConn picks which one the next request goes out on.
+	pool     []*net.Conn
+	poolSize int
+	nextConn uint32
+	// PartitionFilters holds the remote node's bloom filter per hash-range
+	// partition, when the cluster is configured with partitions.
+	PartitionFilters []bloomfilter.BloomFilter
+	// partitions is how many partition filters to fetch.
+	partitions int
+	// CuckooFilter holds the remote node's cuckoo filter, when the cluster
+	// routes by cuckoo filters.
+	CuckooFilter *bloomfilter.CuckooFilter
+	// peerFilter is which filters the cluster routes by.
+	peerFilter bloomfilter.FilterKind
+	// bfHash is what the cluster's bloom filters hash keys with. Filters
+	// hashed otherwise are handled like a version mismatch.
+	bfHash bloomfilter.HashProvider
+	// secrets holds the cluster secret we authenticate with after
+	// connecting. Nil when the cluster doesn't use authentication.
+	secrets *ClusterSecrets
+	// counters tracks connection-level metrics, see PeerInfo.
+	counters peerCounters
+	// tlsConfig is what we connect over TLS with, nil when TLS is off.
+	tlsConfig *tls.Config
+	// tlsErr is why loading tlsConfig failed, in which case we refuse to
+	// connect rather than fall back to plaintext.
+	tlsErr error
+	// statusHook is told about the peer's state transitions, see
+	// SetStatusHook.
+	statusHook StatusHook
+	// filterHook is told whenever the peer's bloom filters change, see
+	// SetFilterHook.
+	filterHook FilterHook
 	sync.Mutex
 }
 
@@ -48,26 +121,57 @@ func NewPeer(conn *net.Conn, mh *message_handler.MessageHandler, config *config.
 	log.Println("New peer connected: %v", ipPort)
 
 	return &Peer{
-		Status:       Disconnected,
-		Conn:         conn,
-		IPPort:       ipPort,
-		BloomFilter:  bloomfilter.NewByFailRate(uint(config.BloomfilterSize), 0.01),
-		MessageBus:   mh,
-		UniqueID:     uuid.NewV1().String(),
-		failureCount: 0,
+		Status:           Disconnected,
+		Conn:             conn,
+		IPPort:           ipPort,
+		BloomFilter:      emptyBloomFilter(config.BloomfilterSize, config.BloomfilterHash),
+		MessageBus:       mh,
+		UniqueID:         uuid.NewV1().String(),
+		failureCount:     0,
+		failureThreshold: failureThreshold(*config),
+		reconnect:        ReconnectBackoff(*config),
+		poolSize:         config.PeerPoolSize,
+		bfVersionPolicy: bloomfilter.ParseVersionPolicy(
+			config.BloomfilterVersionPolicy,
+		),
+		bfItems:    uint(config.BloomfilterSize),
+		partitions: config.BloomfilterPartitions,
+		peerFilter: bloomfilter.ParseFilterKind(config.PeerFilter),
+		bfHash:     bloomfilter.ParseHashProvider(config.BloomfilterHash),
 	}
 }
 
+// emptyBloomFilter returns the bloom filter a peer has until its own is
+// fetched, hashed like the cluster's.
+func emptyBloomFilter(items uint, hash string) bloomfilter.BloomFilter {
+	return bloomfilter.NewByFailRateWithHash(
+		items,
+		0.01,
+		bloomfilter.IndependentHashes,
+		bloomfilter.ParseHashProvider(hash),
+	)
+}
+
 // NewPeerByIP handles creating a peer by its ip, opening a connection, &c.
 func NewPeerByIP(ipPort string, mh *message_handler.MessageHandler, config config.Cfg) *Peer {
 	newPeer := &Peer{
-		Status:       Disconnected,
-		Conn:         nil,
-		IPPort:       ipPort,
-		BloomFilter:  bloomfilter.NewByFailRate(uint(config.BloomfilterSize), 0.01),
-		MessageBus:   mh,
-		UniqueID:     uuid.NewV1().String(),
-		failureCount: 0,
+		Status:           Disconnected,
+		Conn:             nil,
+		IPPort:           ipPort,
+		BloomFilter:      emptyBloomFilter(config.BloomfilterSize, config.BloomfilterHash),
+		MessageBus:       mh,
+		UniqueID:         uuid.NewV1().String(),
+		failureCount:     0,
+		failureThreshold: failureThreshold(config),
+		reconnect:        ReconnectBackoff(config),
+		poolSize:         config.PeerPoolSize,
+		bfVersionPolicy: bloomfilter.ParseVersionPolicy(
+			config.BloomfilterVersionPolicy,
+		),
+		bfItems:    uint(config.BloomfilterSize),
+		partitions: config.BloomfilterPartitions,
+		peerFilter: bloomfilter.ParseFilterKind(config.PeerFilter),
+		bfHash:     bloomfilter.ParseHashProvider(config.BloomfilterHash),
 	}
 
 	return newPeer
@@ -75,78 +179,389 @@ func NewPeerByIP(ipPort string, mh *message_handler.MessageHandler, config confi
 
 // Connect opens a connection to a remote peer
 func (p *Peer) Connect() error {
-	conn, err := net.DialTimeout("tcp", p.IPPort, 5*time.Second)
+	return p.ConnectContext(context.Background())
+}
+
+// ConnectContext is Connect, giving up on dialing once `ctx` is done.
+func (p *Peer) ConnectContext(ctx context.Context) error {
+	if p.tlsErr != nil {
+		return p.tlsErr
+	}
+
+	conn, err := p.dial(ctx)
 	if err != nil {
-		if err, _ := err.(net.Error); err.Timeout() {
-			p.Status = Timeout
+		if err, ok := err.(net.Error); ok && err.Timeout() {
+			p.setStatus(Timeout)
 		}
 		return err
 	}
 
+	p.Lock()
+	if p.Conn != nil {
+		atomic.AddUint64(&p.counters.reconnects, 1)
+	}
 	p.Conn = &conn
+	// Receivers of connections we've since replaced are done with.
+	p.receivers = nil
+	from := p.Status
 	p.Status = Connected
+	p.failureCount = 0
+	p.reconnectAt = time.Time{}
+	if p.reconnect != nil {
+		p.reconnect.Reset()
+	}
+	p.Unlock()
+
+	// Commands on a connection are processed in order, so authenticating
+	// first is enough for every later command to be accepted.
+	if _, err := p.authenticate(&conn); err != nil {
+		return err
+	}
+	p.connectPool(ctx)
+
+	// The hook only hears of the connection once it's authenticated, so
+	// whatever it sends is accepted.
+	p.notifyStatus(from, Connected)
+
 	p.GetBloomFilter()
 
 	return nil
 }
 
-// Ping handles intelligently sending heartbeats to a remote node. After 10
-// successive failures to ping, the remote node is considered failed and the
-// status is set to Timeout
+// Ping handles intelligently sending heartbeats to a remote node. After
+// HeartbeatFailureThreshold successive failures to ping, the remote node is
+// considered failed and the status is set to Timeout
 func (p *Peer) TestConnection() {
 	_, err := p.SendCommand("0:PING 1\n")
+
+	p.Lock()
+	from := p.Status
 	if err != nil {
 		p.failureCount++
-		if p.failureCount == 10 {
+		if p.failureCount == p.threshold() {
 			p.Status = Timeout
 			log.Printf(
 				"Node %v is no longer alive",
 				p.IPPort,
 			)
 		}
+	} else {
+		p.failureCount = 0
+		p.Status = Connected
+	}
+	to := p.Status
+	p.Unlock()
+
+	p.notifyStatus(from, to)
+}
+
+// threshold returns how many heartbeats in a row the peer may miss. Peers
+// which weren't created through a constructor get the default.
+func (p *Peer) threshold() int {
+	if p.failureThreshold <= 0 {
+		return defaultFailureThreshold
+	}
+
+	return p.failureThreshold
+}
+
+// Reconnect attempts to reconnect to a peer which dropped, backing off
+// exponentially between attempts. The first attempt is due a heartbeat
+// interval after the peer is first found dropped, and calls before an attempt
+// is due do nothing, so it's meant to be called on every heartbeat.
+func (p *Peer) Reconnect() {
+	p.Lock()
+	if p.reconnect == nil {
+		p.reconnect = &Backoff{Min: defaultHeartbeatInterval, Max: defaultReconnectBackoffMax}
+	}
+	if p.reconnectAt.IsZero() {
+		p.reconnectAt = time.Now().Add(p.reconnect.Next())
+	}
+	if p.reconnecting || time.Now().Before(p.reconnectAt) {
+		p.Unlock()
 		return
 	}
+	p.reconnecting = true
+	p.Unlock()
 
-	p.failureCount = 0
-	p.Status = Connected
+	err := p.Connect()
+
+	p.Lock()
+	p.reconnecting = false
+	if err != nil {
+		wait := p.reconnect.Next()
+		p.reconnectAt = time.Now().Add(wait)
+		log.Printf("Failed to reconnect to %v, retrying in %v: %v", p.IPPort, wait, err)
+	}
+	p.Unlock()
 }
 
 // Disconnect closes a connection to a remote peer.
 func (p *Peer) Disconnect() {
-	(*p.Conn).Close()
+	if conn := p.getConn(); conn != nil {
+		(*conn).Close()
+	}
+	p.closePool()
+	p.setStatus(Disconnected)
+}
+
+// getConn returns the peer's current connection, which Connect may swap out
+// while heartbeats are using it.
+func (p *Peer) getConn() *net.Conn {
+	p.Lock()
+	defer p.Unlock()
+
+	return p.Conn
+}
+
+// GetStatus returns the peer's current state. Heartbeats update the state
+// concurrently, so this should be preferred over reading Status directly.
+func (p *Peer) GetStatus() State {
+	p.Lock()
+	defer p.Unlock()
+
+	return p.Status
+}
+
+func (p *Peer) setStatus(status State) {
+	p.Lock()
+	from := p.Status
+	p.Status = status
+	p.Unlock()
+
+	p.notifyStatus(from, status)
+}
+
+// SetStatusHook makes `hook` hear of every state transition the peer makes
+// from now on. It's called without the peer locked, on whichever goroutine
+// made the transition, so it shouldn't block.
+func (p *Peer) SetStatusHook(hook StatusHook) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.statusHook = hook
+}
+
+// notifyStatus tells the status hook about a transition, if there was one.
+func (p *Peer) notifyStatus(from State, to State) {
+	p.Lock()
+	hook := p.statusHook
+	p.Unlock()
+
+	if hook != nil && from != to {
+		hook(p, from, to)
+	}
+}
+
+// IsConnectable reports whether the peer is worth sending requests to.
+func (p *Peer) IsConnectable() bool {
+	status := p.GetStatus()
+	return status != Timeout && status != Disconnected
 }
 
 // SendCommand Handles sending a command to a remote node. Command is like this
 // "hash:Command"
 func (p *Peer) SendCommand(Command string) (int, error) {
-	return (*p.Conn).Write([]byte(Command))
+	return p.write(p.getConn(), Command)
+}
+
+// write sends a command over one of the peer's connections.
+func (p *Peer) write(conn *net.Conn, Command string) (int, error) {
+	if conn == nil {
+		atomic.AddUint64(&p.counters.errors, 1)
+		return 0, fmt.Errorf("%v has no open connection", p.IPPort)
+	}
+
+	n, err := (*conn).Write([]byte(Command))
+	if err != nil {
+		atomic.AddUint64(&p.counters.errors, 1)
+	}
+
+	return n, err
 }
 
 // SendRequest handles taking in a peer object and a command and sending a
 // command which will be responded to the calling channel once the request has
-// been fulfilled
-func (p *Peer) SendRequest(Command string, responseChannel chan string, mh *message_handler.MessageHandler) {
-	receiver := network_receiver.NewReceiver(mh, p.Conn)
+// been fulfilled. If the request couldn't be sent, nothing will ever be sent
+// to the calling channel and an error is returned. Requests are spread over
+// the peer's pooled connections, so a request sent after another may be
+// answered first; callers needing an order wait on each response in turn.
+func (p *Peer) SendRequest(Command string, responseChannel chan string, mh *message_handler.MessageHandler) error {
+	conn := p.pickConn()
+	if conn == nil {
+		atomic.AddUint64(&p.counters.errors, 1)
+		return fmt.Errorf("%v has no open connection", p.IPPort)
+	}
+	p.startReceiver(mh, conn)
+	atomic.AddUint64(&p.counters.requests, 1)
 
 	hash := hashRequest(Command)
 	addCommandToMessageHandler(hash, responseChannel, mh)
 
-	go func() {
-		receiver.Run()
-	}()
+	_, err := p.write(conn, fmt.Sprintf("%s:%s\n", hash, Command))
+	return err
+}
+
+// Request sends a request to the peer and waits on its response, giving up
+// once `ctx` is done.
+func (p *Peer) Request(ctx context.Context, command string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	// The channel is buffered so that a response arriving after we gave up
+	// on it isn't left blocking on us.
+	responseChannel := make(chan string, 1)
+	if err := p.SendRequest(command, responseChannel, p.MessageBus); err != nil {
+		return "", err
+	}
+
+	select {
+	case response := <-responseChannel:
+		return response, nil
+	case <-ctx.Done():
+		return "", fmt.Errorf("Gave up waiting on %v: %v", p.IPPort, ctx.Err())
+	}
+}
+
+// startReceiver starts reading responses off of one of the peer's
+// connections, unless a receiver is already reading from it.
+func (p *Peer) startReceiver(mh *message_handler.MessageHandler, conn *net.Conn) {
+	p.Lock()
+	defer p.Unlock()
 
-	p.SendCommand(fmt.Sprintf("%s:%s\n", hash, Command))
+	if p.receivers[conn] {
+		return
+	}
+	if p.receivers == nil {
+		p.receivers = make(map[*net.Conn]bool)
+	}
+	p.receivers[conn] = true
+
+	receiver := network_receiver.NewReceiver(mh, conn)
+	go receiver.Run()
 }
 
-// GetBloomFilter handles retrieving a remote node's bloom filter.
+// GetBloomFilter handles retrieving a remote node's bloom filter, along with
+// its partition filters if the cluster is partitioned and its cuckoo filter if
+// the cluster routes by cuckoo filters.
 func (p *Peer) GetBloomFilter() {
+	if p.peerFilter == bloomfilter.CuckooFilterKind {
+		p.requestFilter(parser.GET_REMOTE_CUCKOOFILTER, func(encoded string) error {
+			cf, err := bloomfilter.DeserializeCuckoo(encoded)
+			if err != nil {
+				return err
+			}
+			p.CuckooFilter = cf
+
+			return nil
+		})
+	}
+
+	p.requestBloomFilter(
+		parser.GET_REMOTE_BLOOMFILTER,
+		p.bfItems,
+		func(bf bloomfilter.BloomFilter) {
+			p.BloomFilter = bf
+		},
+	)
+
+	if p.partitions <= 1 {
+		return
+	}
+
+	for i := 0; i < p.partitions; i++ {
+		partition := i
+		p.requestBloomFilter(
+			fmt.Sprintf("%s:%d", parser.GET_REMOTE_BLOOMFILTER, partition),
+			PartitionItems(p.bfItems, p.partitions),
+			func(bf bloomfilter.BloomFilter) {
+				if len(p.PartitionFilters) != p.partitions {
+					p.PartitionFilters = make([]bloomfilter.BloomFilter, p.partitions)
+				}
+				p.PartitionFilters[partition] = bf
+			},
+		)
+	}
+}
+
+// GetRemoteFilter returns the remote node's whole-node bloom filter. The
+// filter is swapped out whenever a new one is received, so this should be
+// preferred over reading BloomFilter directly.
+func (p *Peer) GetRemoteFilter() bloomfilter.BloomFilter {
+	p.Lock()
+	defer p.Unlock()
+
+	return p.BloomFilter
+}
+
+// GetCuckooFilter returns the remote node's cuckoo filter, or nil if it
+// hasn't been received (yet).
+func (p *Peer) GetCuckooFilter() *bloomfilter.CuckooFilter {
+	p.Lock()
+	defer p.Unlock()
+
+	return p.CuckooFilter
+}
+
+// GetPartitionFilter returns the remote node's bloom filter for a partition,
+// or nil if it hasn't been received (yet).
+func (p *Peer) GetPartitionFilter(partition int) bloomfilter.BloomFilter {
+	p.Lock()
+	defer p.Unlock()
+
+	if partition < 0 || partition >= len(p.PartitionFilters) {
+		return nil
+	}
+
+	return p.PartitionFilters[partition]
+}
+
+// PartitionItems is how many items each partition's bloom filter is sized for.
+func PartitionItems(items uint, partitions int) uint {
+	if partitions <= 1 {
+		return items
+	}
+
+	perPartition := items / uint(partitions)
+	if perPartition == 0 {
+		return 1
+	}
+
+	return perPartition
+}
+
+// requestBloomFilter requests a bloom filter from the remote node and, once
+// it's received and decoded, hands it to `assign` while holding the peer's
+// lock, then tells the filter hook.
+func (p *Peer) requestBloomFilter(request string, items uint, assign func(bloomfilter.BloomFilter)) {
+	p.requestFilter(request, func(encoded string) error {
+		bf, err := bloomfilter.DeserializeWithHash(
+			encoded,
+			items,
+			p.bfVersionPolicy,
+			p.bfHash,
+		)
+		if err != nil {
+			return err
+		}
+		assign(bf)
+
+		return nil
+	})
+}
+
+// requestFilter requests a filter from the remote node and hands it to
+// `decode` while holding the peer's lock, then tells the filter hook if it
+// was decoded.
+func (p *Peer) requestFilter(request string, decode func(encoded string) error) {
 	responseChannel := make(chan string)
 
 	go func() {
 		parser := parser.NewParser(p.MessageBus)
 		response := <-responseChannel
 
-		responseData, err := parser.Parse(response, p.Conn)
+		responseData, err := parser.Parse(response, p.getConn())
 		if err != nil {
 			log.Println(err)
 			return
@@ -154,19 +569,23 @@ func (p *Peer) GetBloomFilter() {
 
 		for k := range responseData.Args {
 			p.Lock()
-			defer p.Unlock()
-			bf, err := bloomfilter.Deserialize(k, p.BloomFilter.GetMaxSize())
+			err := decode(k)
+			p.Unlock()
 			if err != nil {
-				p.BloomFilter = nil
+				// Keep whatever filter we had rather than routing on
+				// a filter we couldn't decode.
+				log.Printf("Bad filter from %v: %v", p.IPPort, err)
+				return
 			}
-			p.BloomFilter = bf
+
+			p.notifyFilter()
 			break
 		}
 
 	}()
 
 	p.SendRequest(
-		parser.GET_REMOTE_BLOOMFILTER,
+		request,
 		responseChannel,
 		p.MessageBus,
 	)
@@ -182,7 +601,9 @@ func (p *Peer) GetPeerList(responseChannel chan string) {
 func addCommandToMessageHandler(hash string, responseChannel chan string, mh *message_handler.MessageHandler) {
 	keyVal := message_handler.NewKeyValPair(hash, responseChannel, nil)
 
-	mh.AddKeyChannel <- keyVal
+	// The key has to be stored before the request is sent, otherwise a
+	// quick response finds no one waiting on it.
+	mh.AddKey(keyVal)
 }
 
 // hashRequest hashes the command so that later the channel can be responded to
@@ -0,0 +1,73 @@
+package dht
+
+import (
+	"net"
+	"sync/atomic"
+)
+
+// PeerMetrics is a point-in-time snapshot of a peer's connection counters.
+type PeerMetrics struct {
+	// BytesSent counts the bytes written to the peer's connections.
+	BytesSent uint64 `json:"bytes_sent"`
+	// BytesReceived counts the bytes read off of the peer's connections.
+	BytesReceived uint64 `json:"bytes_received"`
+	// Requests counts the requests sent to the peer.
+	Requests uint64 `json:"requests"`
+	// Errors counts commands which couldn't be sent to the peer.
+	Errors uint64 `json:"errors"`
+	// Reconnects counts how often a connection to the peer was replaced.
+	Reconnects uint64 `json:"reconnects"`
+}
+
+// PeerInfo describes a peer along with its connection metrics.
+type PeerInfo struct {
+	IPPort  string
+	Status  State
+	Metrics PeerMetrics
+}
+
+// peerCounters holds the live counters behind PeerMetrics. Every field is only
+// ever touched atomically, so counting never waits on the peer's lock.
+type peerCounters struct {
+	bytesSent     uint64
+	bytesReceived uint64
+	requests      uint64
+	errors        uint64
+	reconnects    uint64
+}
+
+// PeerInfo returns a snapshot of the peer's state and connection metrics.
+func (p *Peer) PeerInfo() PeerInfo {
+	return PeerInfo{
+		IPPort: p.IPPort,
+		Status: p.GetStatus(),
+		Metrics: PeerMetrics{
+			BytesSent:     atomic.LoadUint64(&p.counters.bytesSent),
+			BytesReceived: atomic.LoadUint64(&p.counters.bytesReceived),
+			Requests:      atomic.LoadUint64(&p.counters.requests),
+			Errors:        atomic.LoadUint64(&p.counters.errors),
+			Reconnects:    atomic.LoadUint64(&p.counters.reconnects),
+		},
+	}
+}
+
+// countingConn wraps a peer's connection, counting every byte read from and
+// written to it.
+type countingConn struct {
+	net.Conn
+	counters *peerCounters
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddUint64(&c.counters.bytesReceived, uint64(n))
+
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddUint64(&c.counters.bytesSent, uint64(n))
+
+	return n, err
+}
@@ -0,0 +1,97 @@
+package dht
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// dial opens a new connection to the peer, over TLS if it's on, giving up
+// once `ctx` is done. Reads and writes go through a countingConn so the peer's
+// metrics see all of its traffic.
+func (p *Peer) dial(ctx context.Context) (net.Conn, error) {
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if p.tlsConfig != nil {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: p.tlsConfig}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", p.IPPort)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", p.IPPort)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &countingConn{conn, &p.counters}, nil
+}
+
+// authenticate sends the cluster secret over a new connection, if the cluster
+// uses one.
+func (p *Peer) authenticate(conn *net.Conn) (int, error) {
+	secret := p.secrets.Current()
+	if secret == "" {
+		return 0, nil
+	}
+
+	return p.write(conn, fmt.Sprintf("0:AUTH %s\n", secret))
+}
+
+// connectPool opens the connections the peer holds besides Conn, replacing
+// any it held before. A connection which can't be opened is left out, so
+// requests are spread over fewer connections rather than failing.
+func (p *Peer) connectPool(ctx context.Context) {
+	p.closePool()
+
+	var pool []*net.Conn
+	for i := 1; i < p.poolSize; i++ {
+		conn, err := p.dial(ctx)
+		if err != nil {
+			log.Printf("Failed to open a pooled connection to %v: %v", p.IPPort, err)
+			break
+		}
+		if _, err := p.authenticate(&conn); err != nil {
+			conn.Close()
+			break
+		}
+		pool = append(pool, &conn)
+	}
+
+	p.Lock()
+	p.pool = pool
+	p.Unlock()
+}
+
+// closePool closes the connections the peer holds besides Conn.
+func (p *Peer) closePool() {
+	p.Lock()
+	pool := p.pool
+	p.pool = nil
+	p.Unlock()
+
+	for _, conn := range pool {
+		(*conn).Close()
+	}
+}
+
+// pickConn returns the connection the next request goes out on, taking Conn
+// and the pooled connections in turn. It's nil while we aren't connected.
+func (p *Peer) pickConn() *net.Conn {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.Conn == nil || len(p.pool) == 0 {
+		return p.Conn
+	}
+
+	next := atomic.AddUint32(&p.nextConn, 1) % uint32(len(p.pool)+1)
+	if next == 0 {
+		return p.Conn
+	}
+
+	return p.pool[next-1]
+}
@@ -1,8 +1,14 @@
 package dht
 
 import (
+	"context"
+	"github.com/GrappigPanda/Olivia/bloomfilter"
+	"github.com/GrappigPanda/Olivia/config"
 	"github.com/GrappigPanda/Olivia/network/message_handler"
+	"net"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestaddCommandToMessageHandler(t *testing.T) {
@@ -22,3 +28,277 @@ func TesthashRequest(t *testing.T) {
 	}
 
 }
+
+func TestPeerInfoCountsConnectionActivity(t *testing.T) {
+	node := newGossipNode(t)
+	defer node.listener.Close()
+
+	cfg := config.Cfg{BloomfilterSize: 1000, IsTesting: true}
+	peer := NewPeerByIP(node.Addr(), message_handler.NewMessageHandler(), cfg)
+	// Connecting requests the peer's bloom filter.
+	if err := peer.Connect(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		responseChannel := make(chan string)
+		peer.GetPeerList(responseChannel)
+		select {
+		case <-responseChannel:
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting on the peer list")
+		}
+	}
+
+	peer.Disconnect()
+	if _, err := peer.SendCommand("0:PING 1\n"); err == nil {
+		t.Fatalf("Expected sending on a closed connection to fail")
+	}
+	if err := peer.Connect(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	metrics := peer.PeerInfo().Metrics
+	if metrics.Requests != 5 {
+		t.Fatalf("Expected %v, got %v", 5, metrics.Requests)
+	}
+	if metrics.Errors != 1 {
+		t.Fatalf("Expected %v, got %v", 1, metrics.Errors)
+	}
+	if metrics.Reconnects != 1 {
+		t.Fatalf("Expected %v, got %v", 1, metrics.Reconnects)
+	}
+	if metrics.BytesSent == 0 || metrics.BytesReceived == 0 {
+		t.Fatalf("Expected traffic to be counted, got %+v", metrics)
+	}
+}
+
+func TestStatusHookHearsOfTransitions(t *testing.T) {
+	node := newGossipNode(t)
+	defer node.listener.Close()
+
+	cfg := config.Cfg{BloomfilterSize: 1000, IsTesting: true}
+	peer := NewPeerByIP(node.Addr(), message_handler.NewMessageHandler(), cfg)
+
+	transitions := make(chan State, 3)
+	peer.SetStatusHook(func(p *Peer, from State, to State) {
+		transitions <- to
+	})
+
+	if err := peer.Connect(); err != nil {
+		t.Fatalf("%v", err)
+	}
+	peer.Disconnect()
+	// Disconnecting again isn't a transition.
+	peer.Disconnect()
+	close(transitions)
+
+	var got []State
+	for state := range transitions {
+		got = append(got, state)
+	}
+	if len(got) != 2 || got[0] != Connected || got[1] != Disconnected {
+		t.Fatalf("Expected [connected disconnected], got %v", got)
+	}
+}
+
+func TestTestConnectionTimesOutAtThreshold(t *testing.T) {
+	cfg := config.Cfg{BloomfilterSize: 1000, IsTesting: true, HeartbeatFailureThreshold: 2}
+	// Never connected, so every heartbeat fails.
+	peer := NewPeerByIP("127.0.0.1:1", message_handler.NewMessageHandler(), cfg)
+	peer.Status = Connected
+
+	peer.TestConnection()
+	if status := peer.GetStatus(); status != Connected {
+		t.Fatalf("Expected %v, got %v", Connected, status)
+	}
+
+	peer.TestConnection()
+	if status := peer.GetStatus(); status != Timeout {
+		t.Fatalf("Expected %v, got %v", Timeout, status)
+	}
+}
+
+func TestReconnectBacksOff(t *testing.T) {
+	node := newGossipNode(t)
+	defer node.listener.Close()
+
+	cfg := config.Cfg{BloomfilterSize: 1000, IsTesting: true, HeartbeatInterval: 20}
+	peer := NewPeerByIP(node.Addr(), message_handler.NewMessageHandler(), cfg)
+
+	// The first attempt is only due a heartbeat interval later.
+	peer.Reconnect()
+	if peer.IsConnectable() {
+		t.Fatalf("Expected no attempt to have been made yet")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	peer.Reconnect()
+	if !peer.IsConnectable() {
+		t.Fatalf("Expected %v, got %v", Connected, peer.GetStatus())
+	}
+}
+
+func TestRequestsSpreadOverPool(t *testing.T) {
+	node := newGossipNode(t)
+	defer node.listener.Close()
+
+	cfg := config.Cfg{BloomfilterSize: 1000, IsTesting: true, PeerPoolSize: 3}
+	peer := NewPeerByIP(node.Addr(), message_handler.NewMessageHandler(), cfg)
+	if err := peer.Connect(); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(peer.pool) != 2 {
+		t.Fatalf("Expected %v pooled connections, got %v", 2, len(peer.pool))
+	}
+
+	used := make(map[*net.Conn]bool)
+	for i := 0; i < 3; i++ {
+		used[peer.pickConn()] = true
+	}
+	if len(used) != 3 {
+		t.Fatalf("Expected requests to go out on %v connections, got %v", 3, len(used))
+	}
+
+	// Every connection has its responses read.
+	for i := 0; i < 6; i++ {
+		responseChannel := make(chan string)
+		peer.GetPeerList(responseChannel)
+		select {
+		case <-responseChannel:
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting on the peer list")
+		}
+	}
+
+	peer.Disconnect()
+	if len(peer.pool) != 0 {
+		t.Fatalf("Expected the pool to be closed")
+	}
+}
+
+func TestRequestGivesUpWithTheContext(t *testing.T) {
+	node := newGossipNode(t)
+	defer node.listener.Close()
+
+	cfg := config.Cfg{BloomfilterSize: 1000, IsTesting: true}
+	peer := NewPeerByIP(node.Addr(), message_handler.NewMessageHandler(), cfg)
+	if err := peer.Connect(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// The node only answers REQUESTs.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := peer.Request(ctx, "GET key"); err == nil {
+		t.Fatalf("Expected the request to give up")
+	}
+
+	response, err := peer.Request(context.Background(), "REQUEST PEERS")
+	if err != nil || !strings.Contains(response, "FULFILLED") {
+		t.Fatalf("Expected a peer list, got %v %v", response, err)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := peer.ConnectContext(cancelled); err == nil {
+		t.Fatalf("Expected connecting with a cancelled context to fail")
+	}
+}
+
+func TestFilterHookHearsOfNewFiltersAndDeltas(t *testing.T) {
+	node := newGossipNode(t)
+	defer node.listener.Close()
+
+	cfg := config.Cfg{BloomfilterSize: 1000, IsTesting: true}
+	list := NewPeerList(message_handler.NewMessageHandler(), cfg)
+	changes := make(chan *Peer, 4)
+	list.OnFilterChange(func(p *Peer) {
+		changes <- p
+	})
+
+	peer := list.NewPeer(node.Addr())
+	if err := peer.Connect(); err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer peer.Disconnect()
+
+	select {
+	case changed := <-changes:
+		if changed != peer {
+			t.Fatalf("Expected %v, got %v", peer.IPPort, changed.IPPort)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Never heard of the peer's bloom filter")
+	}
+
+	peer.Lock()
+	received := peer.BloomFilter
+	indices := received.HashKey([]byte("fresh"))
+	peer.Unlock()
+
+	if !peer.AddToFilter(indices) {
+		t.Fatalf("Expected the delta to be applied")
+	}
+	select {
+	case <-changes:
+	case <-time.After(time.Second):
+		t.Fatalf("Never heard of the delta")
+	}
+
+	peer.Lock()
+	defer peer.Unlock()
+	if ok, _ := peer.BloomFilter.HasKey([]byte("fresh")); !ok {
+		t.Fatalf("Expected the delta's key to be in the filter")
+	}
+	// The filter searches were built from is left untouched.
+	if ok, _ := received.HasKey([]byte("fresh")); ok {
+		t.Fatalf("Expected the received filter to be copied, not changed")
+	}
+}
+
+func TestFiltersHashedOtherwiseAreRefused(t *testing.T) {
+	node := newGossipNode(t)
+	defer node.listener.Close()
+
+	cfg := config.Cfg{BloomfilterSize: 1000, BloomfilterHash: "xxhash", IsTesting: true}
+	list := NewPeerList(message_handler.NewMessageHandler(), cfg)
+	changes := make(chan *Peer, 4)
+	list.OnFilterChange(func(p *Peer) {
+		changes <- p
+	})
+
+	// The node hashes with the default provider, so its filter is refused.
+	peer := list.NewPeer(node.Addr())
+	if err := peer.Connect(); err != nil {
+		t.Fatalf("%v", err)
+	}
+	select {
+	case <-changes:
+		t.Fatalf("Expected a filter hashed otherwise to be refused")
+	case <-time.After(200 * time.Millisecond):
+	}
+	peer.Disconnect()
+
+	node.Lock()
+	node.hashes = bloomfilter.XXHashes
+	node.Unlock()
+
+	peer = list.NewPeer(node.Addr())
+	if err := peer.Connect(); err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer peer.Disconnect()
+
+	select {
+	case <-changes:
+	case <-time.After(time.Second):
+		t.Fatalf("Never heard of the peer's bloom filter")
+	}
+
+	peer.Lock()
+	defer peer.Unlock()
+	if ok, _ := peer.BloomFilter.HasKey([]byte("gossiped")); !ok {
+		t.Fatalf("Expected the node's key to be in its filter")
+	}
+}
@@ -1,12 +1,14 @@
 package dht
 
 import (
+	"context"
 	"fmt"
 	"github.com/GrappigPanda/Olivia/config"
 	"github.com/GrappigPanda/Olivia/network/message_handler"
 	"log"
 	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 // PeerList is a data structure which represents remote Olivia nodes.
@@ -16,6 +18,14 @@ type PeerList struct {
 	PeerMap     *map[string]bool
 	MessageBus  *message_handler.MessageHandler
 	config      config.Cfg
+	secrets     *ClusterSecrets
+	// statusHook holds the StatusHook given to every peer, see
+	// OnStatusChange. It's atomic as peers are created with the list
+	// locked.
+	statusHook atomic.Value
+	// filterHook holds the FilterHook given to every peer, see
+	// OnFilterChange.
+	filterHook atomic.Value
 	sync.Mutex
 }
 
@@ -34,60 +44,278 @@ func NewPeerList(mh *message_handler.MessageHandler, config config.Cfg) *PeerLis
 		PeerMap:     &peerMap,
 		MessageBus:  mh,
 		config:      config,
+		secrets:     NewClusterSecrets(config.ClusterSecret),
 	}
 }
 
+// NewPeer creates a peer which authenticates with the peer list's cluster
+// secrets, over TLS if it's configured. It isn't added to the peer list.
+func (p *PeerList) NewPeer(ipPort string) *Peer {
+	newPeer := NewPeerByIP(ipPort, p.MessageBus, p.config)
+	newPeer.secrets = p.secrets
+	// Certificates are loaded per peer, so rotated ones are picked up by
+	// the peers which come after.
+	newPeer.tlsConfig, newPeer.tlsErr = p.config.ClientTLS()
+	newPeer.statusHook = p.getStatusHook()
+	newPeer.filterHook, _ = p.filterHook.Load().(FilterHook)
+
+	return newPeer
+}
+
+// OnStatusChange makes `hook` hear of the state transitions of every peer in
+// the list, and of every peer created through NewPeer from now on.
+func (p *PeerList) OnStatusChange(hook StatusHook) {
+	p.statusHook.Store(hook)
+
+	p.Lock()
+	peers := append(append([]*Peer{}, p.Peers...), p.BackupPeers...)
+	p.Unlock()
+
+	for _, peer := range peers {
+		if peer != nil {
+			peer.SetStatusHook(hook)
+		}
+	}
+}
+
+func (p *PeerList) getStatusHook() StatusHook {
+	hook, _ := p.statusHook.Load().(StatusHook)
+	return hook
+}
+
+// Secrets returns the cluster secrets shared by every peer in the list.
+func (p *PeerList) Secrets() *ClusterSecrets {
+	return p.secrets
+}
+
 // AddPeer handles intelligently putting a peer into our peer list. Priority
-// of insertion is towards Peers first and then BackupPeers.
+// of insertion is towards a free slot in Peers, which is then connected, and
+// then BackupPeers, which are connected once they're promoted. It's safe to
+// call concurrently, e.g. while gossiped peers come in during ConnectAllPeers.
 func (p *PeerList) AddPeer(ipPort string) {
+	if IsSelf(ipPort, p.config) {
+		log.Printf("Refusing to peer with ourselves (%v)", ipPort)
+		return
+	}
+
+	p.Lock()
 	if _, ok := (*p.PeerMap)[ipPort]; ok {
 		// If we already have the peer stored, we don't need to
 		// add it again.
+		p.Unlock()
 		return
 	}
 
-	log.Println(p.config)
-	newPeer := NewPeerByIP(ipPort, p.MessageBus, p.config)
+	newPeer := p.NewPeer(ipPort)
+	(*p.PeerMap)[ipPort] = true
+
+	isActive := p.insertPeer(newPeer)
+	p.Unlock()
+
+	// Connecting can take a while, so it's done without holding up the
+	// rest of the peer list.
+	if isActive {
+		newPeer.Connect()
+	}
+}
 
+// InsertPeer places a peer into a free slot of Peers, or into BackupPeers
+// when every slot is taken, without connecting it. It reports whether the
+// peer got a slot in Peers.
+func (p *PeerList) InsertPeer(peer *Peer) bool {
 	p.Lock()
 	defer p.Unlock()
-	if len(p.Peers)+1 <= 3 {
-		p.Peers = append(p.Peers, newPeer)
-		return
+
+	(*p.PeerMap)[peer.IPPort] = true
+	return p.insertPeer(peer)
+}
+
+// insertPeer places a peer like InsertPeer. The caller must hold the lock.
+func (p *PeerList) insertPeer(peer *Peer) bool {
+	if slot := freeSlot(p.Peers); slot >= 0 {
+		p.Peers[slot] = peer
+		return true
 	}
 
-	if len(p.BackupPeers)+1 >= cap(p.BackupPeers) {
-		p.BackupPeers = append(
-			p.BackupPeers,
-			make([]*Peer, cap(p.BackupPeers)*2)...,
-		)
+	if slot := freeSlot(p.BackupPeers); slot >= 0 {
+		p.BackupPeers[slot] = peer
+	} else {
+		p.BackupPeers = append(p.BackupPeers, peer)
+	}
+
+	return false
+}
 
-		p.BackupPeers = append(p.BackupPeers, newPeer)
+// RemovePeer takes a peer out of the peer list, freeing its slot. It returns
+// the removed peer, or nil if the peer isn't in the list.
+func (p *PeerList) RemovePeer(ipPort string) *Peer {
+	p.Lock()
+	defer p.Unlock()
+
+	for _, peers := range [][]*Peer{p.Peers, p.BackupPeers} {
+		for i, peer := range peers {
+			if peer != nil && peer.IPPort == ipPort {
+				peers[i] = nil
+				delete(*p.PeerMap, ipPort)
+				return peer
+			}
+		}
 	}
 
-	newPeer.Connect()
+	return nil
+}
 
-	return
+// PromoteBackupPeer fills a free slot in Peers with the first backup peer we
+// can connect to. Backups we can't connect to are kept for later attempts. It
+// returns the promoted peer, or nil if no slot is free or no backup could be
+// connected to.
+func (p *PeerList) PromoteBackupPeer() *Peer {
+	p.Lock()
+	if freeSlot(p.Peers) < 0 {
+		p.Unlock()
+		return nil
+	}
+	candidates := make([]*Peer, len(p.BackupPeers))
+	copy(candidates, p.BackupPeers)
+	p.Unlock()
+
+	for _, candidate := range candidates {
+		if candidate == nil {
+			continue
+		}
+
+		// Connecting can take a while, so the peer list isn't held
+		// locked while connecting.
+		if err := candidate.Connect(); err != nil {
+			log.Printf("Couldn't promote backup peer %v: %v", candidate.IPPort, err)
+			continue
+		}
+
+		p.Lock()
+		backupSlot := indexOf(p.BackupPeers, candidate)
+		slot := freeSlot(p.Peers)
+		if backupSlot < 0 || slot < 0 {
+			// The peer list changed while we were connecting.
+			p.Unlock()
+			candidate.Disconnect()
+			return nil
+		}
+		p.BackupPeers[backupSlot] = nil
+		p.Peers[slot] = candidate
+		p.Unlock()
+
+		return candidate
+	}
+
+	return nil
+}
+
+// freeSlot returns the index of the first empty slot in `peers`, or -1 if
+// every slot is taken.
+func freeSlot(peers []*Peer) int {
+	return indexOf(peers, nil)
+}
+
+// indexOf returns the index of `peer` in `peers`, or -1 if it isn't there.
+func indexOf(peers []*Peer, peer *Peer) int {
+	for i := range peers {
+		if peers[i] == peer {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// GetPeers returns a copy of the important peers, which is safe to iterate
+// while peers are being added.
+func (p *PeerList) GetPeers() []*Peer {
+	p.Lock()
+	defer p.Unlock()
+
+	peers := make([]*Peer, len(p.Peers))
+	copy(peers, p.Peers)
+
+	return peers
+}
+
+// GetBackupPeers returns a copy of the backup peers, which is safe to iterate
+// while peers are being added.
+func (p *PeerList) GetBackupPeers() []*Peer {
+	p.Lock()
+	defer p.Unlock()
+
+	peers := make([]*Peer, len(p.BackupPeers))
+	copy(peers, p.BackupPeers)
+
+	return peers
+}
+
+// Snapshot returns a copy of the peer list which can be read (or copied)
+// without racing peers being added to the original.
+func (p *PeerList) Snapshot() *PeerList {
+	p.Lock()
+	defer p.Unlock()
+
+	peerMap := make(map[string]bool)
+	for k, v := range *p.PeerMap {
+		peerMap[k] = v
+	}
+
+	snapshot := &PeerList{
+		Peers:       make([]*Peer, len(p.Peers)),
+		BackupPeers: make([]*Peer, len(p.BackupPeers)),
+		PeerMap:     &peerMap,
+		MessageBus:  p.MessageBus,
+		config:      p.config,
+		secrets:     p.secrets,
+	}
+	copy(snapshot.Peers, p.Peers)
+	copy(snapshot.BackupPeers, p.BackupPeers)
+
+	return snapshot
+}
+
+// HasPeer checks if a peer is already known.
+func (p *PeerList) HasPeer(ipPort string) bool {
+	p.Lock()
+	defer p.Unlock()
+
+	_, ok := (*p.PeerMap)[ipPort]
+	return ok
 }
 
-// ConnectAllPeers connects all peers (or at least attempts to)
+// ConnectAllPeers connects all peers (or at least attempts to). Peers
+// gossiped back by the connected peers are added while we're connecting, so
+// the peer list isn't held locked while connecting.
 func (p *PeerList) ConnectAllPeers() error {
+	return p.ConnectAllPeersContext(context.Background())
+}
+
+// ConnectAllPeersContext is ConnectAllPeers, giving up on the peers not yet
+// connected to once `ctx` is done.
+func (p *PeerList) ConnectAllPeersContext(ctx context.Context) error {
 	responseChannel := make(chan string)
 	go p.handlePeerQueries(responseChannel)
 
 	failureCount := 0
 	successCount := 0
 
-	p.Lock()
-	defer p.Unlock()
-	for x := range p.Peers {
-		if p.Peers[x] == nil {
+	peers := p.GetPeers()
+	for x := range peers {
+		if peers[x] == nil {
+			failureCount++
+			continue
+		}
+
+		if IsSelf(peers[x].IPPort, p.config) {
+			log.Printf("Refusing to peer with ourselves (%v)", peers[x].IPPort)
 			failureCount++
 			continue
 		}
-		log.Println("Attempting connection to ", p.Peers[x].IPPort)
+		log.Println("Attempting connection to ", peers[x].IPPort)
 
-		if err := p.Peers[x].Connect(); err != nil {
+		if err := peers[x].ConnectContext(ctx); err != nil {
 			log.Println(err)
 			failureCount++
 			continue
@@ -97,17 +325,21 @@ func (p *PeerList) ConnectAllPeers() error {
 
 		log.Println(
 			"Connected to ",
-			p.Peers[x].IPPort,
+			peers[x].IPPort,
 			"Requesting peer list",
 		)
 
 		log.Println("Sending Request Connect")
-		p.Peers[x].SendCommand("0:REQUEST CONNECT\n")
-		p.Peers[x].GetPeerList(responseChannel)
-		p.Peers[x].GetBloomFilter()
+		peers[x].SendCommand("0:REQUEST CONNECT\n")
+		// With gossip on, the rest of the cluster is learned through
+		// gossip instead.
+		if p.config.GossipIntervalMillis <= 0 {
+			peers[x].GetPeerList(responseChannel)
+		}
+		peers[x].GetBloomFilter()
 	}
 
-	if failureCount == len(p.Peers) {
+	if failureCount == len(peers) {
 		log.Println("Failed to connect to any nodes.")
 		return fmt.Errorf("No connectable nodes.")
 	}
@@ -116,19 +348,17 @@ func (p *PeerList) ConnectAllPeers() error {
 	return nil
 }
 
-// DisconnectAllPeers disconnects all peers
+// DisconnectAllPeers disconnects from every peer, backups included.
 func (p *PeerList) DisconnectAllPeers() {
-	for x := range p.Peers {
-		if err := p.Peers[x].Connect(); err != nil {
-			log.Println(err)
+	for _, peer := range append(p.GetPeers(), p.GetBackupPeers()...) {
+		if peer != nil {
+			peer.Disconnect()
 		}
 	}
 }
 
 // handlePeerQueries handles the responses for each peer list.
 func (p *PeerList) handlePeerQueries(responseChannel chan string) {
-	p.Lock()
-	defer p.Unlock()
 	for response := range responseChannel {
 		splitResponse := strings.SplitN(response, " ", 2)
 		if len(splitResponse) != 2 {
@@ -1,8 +1,17 @@
 package dht
 
 import (
+	"bufio"
+	"fmt"
+	"github.com/GrappigPanda/Olivia/bloomfilter"
 	"github.com/GrappigPanda/Olivia/config"
+	"github.com/GrappigPanda/Olivia/network/message_handler"
+	"github.com/GrappigPanda/Olivia/parser"
+	"net"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 var CONFIG = config.ReadConfig()
@@ -11,3 +20,245 @@ var CONFIG = config.ReadConfig()
 func TestNewPeerList(t *testing.T) {
 	NewPeerList(nil, *CONFIG)
 }
+
+func TestAddPeerSkipsSelf(t *testing.T) {
+	cfg := config.Cfg{
+		ListenPort:       5999,
+		AdvertiseAddress: "10.0.0.1:5999",
+	}
+	peerList := NewPeerList(nil, cfg)
+	peerCount := len(peerList.Peers)
+	backupCount := len(peerList.BackupPeers)
+
+	for _, ipPort := range []string{"127.0.0.1:5999", "localhost:5999", "10.0.0.1:5999"} {
+		peerList.AddPeer(ipPort)
+		if len(peerList.Peers) != peerCount || len(peerList.BackupPeers) != backupCount {
+			t.Fatalf("Expected %v to be skipped, got %v", ipPort, peerList.Peers)
+		}
+	}
+}
+
+func TestIsSelf(t *testing.T) {
+	cfg := config.Cfg{ListenPort: 5999}
+
+	if !IsSelf("127.0.0.1:5999", cfg) {
+		t.Fatalf("Expected our loopback address to be ourselves")
+	}
+
+	if IsSelf("127.0.0.1:5998", cfg) {
+		t.Fatalf("Expected a different port to not be ourselves")
+	}
+
+	if IsSelf("not an address", cfg) {
+		t.Fatalf("Expected a malformed address to not be ourselves")
+	}
+}
+
+// gossipNode is a stand-in remote node which answers peer list requests with
+// a fixed list of other nodes.
+type gossipNode struct {
+	listener net.Listener
+	gossip   []string
+	// hashes is what the node's bloom filter hashes with, MixedHashes when
+	// nil.
+	hashes bloomfilter.HashProvider
+	sync.Mutex
+}
+
+func newGossipNode(t *testing.T) *gossipNode {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	node := &gossipNode{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go node.serve(conn)
+		}
+	}()
+
+	return node
+}
+
+func (g *gossipNode) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		command, err := parser.NewParser(nil).Parse(line, nil)
+		if err != nil || strings.ToUpper(command.Command) != "REQUEST" {
+			continue
+		}
+
+		for k := range command.Args {
+			switch strings.ToUpper(k) {
+			case "PEERS":
+				g.Lock()
+				gossip := strings.Join(g.gossip, ",")
+				g.Unlock()
+				conn.Write([]byte(fmt.Sprintf("%s:FULFILLED %s\n", command.Hash, gossip)))
+			case "BLOOMFILTER":
+				g.Lock()
+				hashes := g.hashes
+				g.Unlock()
+				if hashes == nil {
+					hashes = bloomfilter.MixedHashes
+				}
+
+				bf := bloomfilter.NewByFailRateWithHash(1000, 0.01, bloomfilter.IndependentHashes, hashes)
+				bf.AddKey([]byte("gossiped"))
+				conn.Write([]byte(fmt.Sprintf("%s:FULFILLED %s\n", command.Hash, bf.Serialize())))
+			}
+		}
+	}
+}
+
+func (g *gossipNode) Addr() string {
+	return g.listener.Addr().String()
+}
+
+func TestConnectAllPeersWithConcurrentGossip(t *testing.T) {
+	var nodes []*gossipNode
+	for i := 0; i < 6; i++ {
+		node := newGossipNode(t)
+		defer node.listener.Close()
+		nodes = append(nodes, node)
+	}
+
+	// Every node we connect to gossips every other node back.
+	var addrs []string
+	for _, node := range nodes {
+		addrs = append(addrs, node.Addr())
+	}
+	for _, node := range nodes {
+		node.gossip = addrs
+	}
+
+	cfg := config.Cfg{BloomfilterSize: 1000, IsTesting: true}
+	peerList := NewPeerList(message_handler.NewMessageHandler(), cfg)
+	for i := 0; i < 3; i++ {
+		peerList.Peers[i] = peerList.NewPeer(addrs[i])
+		(*peerList.PeerMap)[addrs[i]] = true
+	}
+
+	if err := peerList.ConnectAllPeers(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for attempt := 0; ; attempt++ {
+		known := 0
+		for _, addr := range addrs {
+			if peerList.HasPeer(addr) {
+				known++
+			}
+		}
+
+		if known == len(addrs) {
+			break
+		}
+		if attempt == 100 {
+			t.Fatalf("Expected %v known peers, got %v", len(addrs), known)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	seen := make(map[string]bool)
+	for _, peer := range append(peerList.GetPeers(), peerList.GetBackupPeers()...) {
+		if peer == nil {
+			continue
+		}
+		if seen[peer.IPPort] {
+			t.Fatalf("Expected %v to only be added once", peer.IPPort)
+		}
+		seen[peer.IPPort] = true
+	}
+}
+
+func TestAddPeerFillsSlotsBeforeBackups(t *testing.T) {
+	cfg := config.Cfg{BloomfilterSize: 1000, IsTesting: true}
+	peerList := NewPeerList(message_handler.NewMessageHandler(), cfg)
+
+	// Nothing listens on these, so active peers simply fail to connect.
+	for i := 0; i < 5; i++ {
+		peerList.AddPeer(fmt.Sprintf("127.0.0.1:%d", 1+i))
+	}
+
+	if len(peerList.Peers) != 3 {
+		t.Fatalf("Expected %v active slots, got %v", 3, len(peerList.Peers))
+	}
+	for i, peer := range peerList.Peers {
+		if peer == nil || peer.IPPort != fmt.Sprintf("127.0.0.1:%d", 1+i) {
+			t.Fatalf("Expected slot %d to be taken, got %v", i, peer)
+		}
+	}
+
+	var backups []string
+	for _, peer := range peerList.GetBackupPeers() {
+		if peer != nil {
+			backups = append(backups, peer.IPPort)
+		}
+	}
+	if len(backups) != 2 || backups[0] != "127.0.0.1:4" || backups[1] != "127.0.0.1:5" {
+		t.Fatalf("Expected the overflow in BackupPeers, got %v", backups)
+	}
+}
+
+func TestPromoteBackupPeer(t *testing.T) {
+	var nodes []*gossipNode
+	for i := 0; i < 4; i++ {
+		node := newGossipNode(t)
+		defer node.listener.Close()
+		nodes = append(nodes, node)
+	}
+
+	cfg := config.Cfg{BloomfilterSize: 1000, IsTesting: true}
+	peerList := NewPeerList(message_handler.NewMessageHandler(), cfg)
+	for _, node := range nodes {
+		peerList.AddPeer(node.Addr())
+	}
+
+	if promoted := peerList.PromoteBackupPeer(); promoted != nil {
+		t.Fatalf("Expected no promotion without a free slot, got %v", promoted.IPPort)
+	}
+
+	removed := peerList.RemovePeer(nodes[1].Addr())
+	if removed == nil || peerList.HasPeer(nodes[1].Addr()) {
+		t.Fatalf("Expected %v to be removed", nodes[1].Addr())
+	}
+
+	promoted := peerList.PromoteBackupPeer()
+	if promoted == nil || promoted.IPPort != nodes[3].Addr() {
+		t.Fatalf("Expected %v to be promoted, got %v", nodes[3].Addr(), promoted)
+	}
+	if promoted.GetStatus() != Connected {
+		t.Fatalf("Expected the promoted peer to be connected")
+	}
+
+	if peerList.Peers[1] != promoted {
+		t.Fatalf("Expected the promoted peer in the freed slot, got %v", peerList.Peers)
+	}
+	for _, peer := range peerList.GetBackupPeers() {
+		if peer == promoted {
+			t.Fatalf("Expected the promoted peer to leave BackupPeers")
+		}
+	}
+
+	for _, node := range []*gossipNode{nodes[0], nodes[2], nodes[3]} {
+		if !peerList.HasPeer(node.Addr()) {
+			t.Fatalf("Expected %v in the peer map", node.Addr())
+		}
+	}
+	if len(*peerList.PeerMap) != 3 {
+		t.Fatalf("Expected %v peers in the peer map, got %v", 3, len(*peerList.PeerMap))
+	}
+}
@@ -0,0 +1,154 @@
+package dht
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+)
+
+// DefaultVirtualNodes is how many points each node gets on the ring. More
+// points spread keys more evenly across nodes.
+const DefaultVirtualNodes = 100
+
+// Ring is a consistent hashing ring deciding which node owns a key. Nodes are
+// identified by their ip:port.
+type Ring struct {
+	virtualNodes int
+	points       []uint32
+	owners       map[uint32]string
+	nodes        map[string]bool
+	sync.RWMutex
+}
+
+// NewRing creates an empty ring placing `virtualNodes` points per node. A
+// non-positive count falls back to DefaultVirtualNodes.
+func NewRing(virtualNodes int) *Ring {
+	if virtualNodes <= 0 {
+		virtualNodes = DefaultVirtualNodes
+	}
+
+	return &Ring{
+		virtualNodes: virtualNodes,
+		owners:       make(map[uint32]string),
+		nodes:        make(map[string]bool),
+	}
+}
+
+// Add places a node on the ring. Adding a node twice is a no-op.
+func (r *Ring) Add(node string) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.nodes[node] {
+		return
+	}
+	r.nodes[node] = true
+
+	for i := 0; i < r.virtualNodes; i++ {
+		point := ringHash(fmt.Sprintf("%s#%d", node, i))
+		if _, ok := r.owners[point]; ok {
+			// On the off chance of a collision, the first node keeps
+			// the point.
+			continue
+		}
+
+		r.owners[point] = node
+		r.points = append(r.points, point)
+	}
+
+	sort.Sort(uint32Slice(r.points))
+}
+
+// Remove takes a node off the ring, handing its keys to the next nodes along
+// the ring.
+func (r *Ring) Remove(node string) {
+	r.Lock()
+	defer r.Unlock()
+
+	if !r.nodes[node] {
+		return
+	}
+	delete(r.nodes, node)
+
+	points := r.points[:0]
+	for _, point := range r.points {
+		if r.owners[point] == node {
+			delete(r.owners, point)
+			continue
+		}
+		points = append(points, point)
+	}
+	r.points = points
+}
+
+// Owner returns the node owning `key`, or an empty string for an empty ring.
+func (r *Ring) Owner(key string) string {
+	owners := r.Owners(key, 1)
+	if len(owners) == 0 {
+		return ""
+	}
+
+	return owners[0]
+}
+
+// Owners returns the `n` distinct nodes owning `key`: its owner, followed by
+// the next nodes along the ring. Fewer are returned if the ring doesn't have
+// `n` nodes.
+func (r *Ring) Owners(key string, n int) []string {
+	r.RLock()
+	defer r.RUnlock()
+
+	if n > len(r.nodes) {
+		n = len(r.nodes)
+	}
+	if n <= 0 {
+		return nil
+	}
+
+	hash := ringHash(key)
+	index := sort.Search(len(r.points), func(i int) bool {
+		return r.points[i] >= hash
+	})
+
+	owners := make([]string, 0, n)
+	seen := make(map[string]bool, n)
+	for i := 0; len(owners) < n; i++ {
+		owner := r.owners[r.points[(index+i)%len(r.points)]]
+		if !seen[owner] {
+			seen[owner] = true
+			owners = append(owners, owner)
+		}
+	}
+
+	return owners
+}
+
+// KeyHash returns a key's position on the ring. Ranges of keys, such as a
+// node's ownership slice, are expressed in these positions.
+func KeyHash(key string) uint64 {
+	return uint64(ringHash(key))
+}
+
+func ringHash(key string) uint32 {
+	hasher := fnv.New32a()
+	hasher.Write([]byte(key))
+
+	return hasher.Sum32()
+}
+
+type uint32Slice []uint32
+
+func (s uint32Slice) Len() int           { return len(s) }
+func (s uint32Slice) Less(i, j int) bool { return s[i] < s[j] }
+func (s uint32Slice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// PartitionOf returns which of `partitions` hash-range partitions `key`
+// falls into. Partitions split the ring's hash space into equal ranges.
+func PartitionOf(key string, partitions int) int {
+	if partitions <= 1 {
+		return 0
+	}
+
+	return int(uint64(ringHash(key)) * uint64(partitions) >> 32)
+}
@@ -0,0 +1,81 @@
+package dht
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRingOwnerIsStable(t *testing.T) {
+	ring := NewRing(0)
+	ring.Add("127.0.0.1:5454")
+	ring.Add("127.0.0.1:5455")
+	ring.Add("127.0.0.1:5456")
+
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%d", i)
+		if ring.Owner(key) != ring.Owner(key) {
+			t.Fatalf("Expected %v to always have the same owner", key)
+		}
+	}
+}
+
+func TestRingRemoveOnlyMovesRemovedKeys(t *testing.T) {
+	ring := NewRing(0)
+	nodes := []string{"127.0.0.1:5454", "127.0.0.1:5455", "127.0.0.1:5456"}
+	for _, node := range nodes {
+		ring.Add(node)
+	}
+
+	owners := make(map[string]string)
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key%d", i)
+		owners[key] = ring.Owner(key)
+	}
+
+	ring.Remove(nodes[0])
+
+	for key, owner := range owners {
+		newOwner := ring.Owner(key)
+		if newOwner == nodes[0] {
+			t.Fatalf("Expected %v to no longer own %v", nodes[0], key)
+		}
+		if owner != nodes[0] && newOwner != owner {
+			t.Fatalf("Expected %v to stay on %v, got %v", key, owner, newOwner)
+		}
+	}
+}
+
+func TestEmptyRingHasNoOwner(t *testing.T) {
+	if owner := NewRing(0).Owner("key"); owner != "" {
+		t.Fatalf("Expected no owner, got %v", owner)
+	}
+}
+
+func TestRingOwners(t *testing.T) {
+	ring := NewRing(0)
+	if owners := ring.Owners("key", 2); len(owners) != 0 {
+		t.Fatalf("Expected an empty ring to have no owners, got %v", owners)
+	}
+
+	nodes := []string{"127.0.0.1:5454", "127.0.0.1:5455", "127.0.0.1:5456"}
+	for _, node := range nodes {
+		ring.Add(node)
+	}
+
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%d", i)
+
+		owners := ring.Owners(key, 2)
+		if len(owners) != 2 || owners[0] == owners[1] {
+			t.Fatalf("Expected 2 distinct owners of %v, got %v", key, owners)
+		}
+		if owners[0] != ring.Owner(key) {
+			t.Fatalf("Expected %v to lead the owners of %v, got %v", ring.Owner(key), key, owners)
+		}
+
+		// Asking for more owners than there are nodes returns them all.
+		if owners := ring.Owners(key, 5); len(owners) != len(nodes) {
+			t.Fatalf("Expected %v owners, got %v", len(nodes), owners)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package dht
+
+import (
+	"crypto/subtle"
+	"sync"
+)
+
+// ClusterSecrets holds the secret nodes authenticate to each other with. To
+// rotate the secret without downtime, a second (next) secret is accepted
+// alongside the current one while nodes are switched over one at a time.
+type ClusterSecrets struct {
+	current string
+	next    string
+	sync.RWMutex
+}
+
+// NewClusterSecrets creates a new secret holder. An empty secret disables
+// authentication.
+func NewClusterSecrets(current string) *ClusterSecrets {
+	return &ClusterSecrets{
+		current: current,
+	}
+}
+
+// Set replaces both secrets. `current` is what we authenticate to remote
+// nodes with, `next` is additionally accepted from them and may be empty.
+func (s *ClusterSecrets) Set(current string, next string) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.current = current
+	s.next = next
+}
+
+// Current returns the secret we authenticate to remote nodes with. A nil
+// holder has no secret.
+func (s *ClusterSecrets) Current() string {
+	if s == nil {
+		return ""
+	}
+
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.current
+}
+
+// Required reports whether remote nodes have to authenticate at all.
+func (s *ClusterSecrets) Required() bool {
+	if s == nil {
+		return false
+	}
+
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.current != "" || s.next != ""
+}
+
+// Accepts checks a secret sent by a remote node against both the current and
+// the next secret.
+func (s *ClusterSecrets) Accepts(secret string) bool {
+	if !s.Required() {
+		return true
+	}
+
+	s.RLock()
+	defer s.RUnlock()
+
+	return secretsEqual(secret, s.current) || secretsEqual(secret, s.next)
+}
+
+// secretsEqual compares secrets in constant time. An empty secret never
+// matches.
+func secretsEqual(given string, expected string) bool {
+	if expected == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(given), []byte(expected)) == 1
+}
@@ -0,0 +1,61 @@
+package dht
+
+import (
+	"github.com/GrappigPanda/Olivia/config"
+	"net"
+	"strconv"
+)
+
+// IsSelf reports whether `ipPort` is the address of this very node, either
+// because it's the node's advertised address or because it's one of the
+// node's own interfaces on the port we listen on. Connecting to ourselves
+// wastes a connection and can loop requests back to us.
+func IsSelf(ipPort string, config config.Cfg) bool {
+	if config.AdvertiseAddress != "" && ipPort == config.AdvertiseAddress {
+		return true
+	}
+
+	host, portString, err := net.SplitHostPort(ipPort)
+	if err != nil {
+		return false
+	}
+
+	port, err := strconv.Atoi(portString)
+	if err != nil || port != config.ListenPort {
+		return false
+	}
+
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return false
+	}
+
+	for _, ip := range ips {
+		if isLocalIP(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isLocalIP checks if an IP belongs to this host. We listen on every
+// interface, so any of them reaches us.
+func isLocalIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsUnspecified() {
+		return true
+	}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return true
+		}
+	}
+
+	return false
+}
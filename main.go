@@ -1,25 +1,121 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"github.com/GrappigPanda/Olivia/cache"
 	"github.com/GrappigPanda/Olivia/config"
 	"github.com/GrappigPanda/Olivia/network"
+	"github.com/GrappigPanda/Olivia/network/httpapi"
+	"github.com/GrappigPanda/Olivia/network/memcache"
 	"github.com/GrappigPanda/Olivia/network/message_handler"
+	"github.com/GrappigPanda/Olivia/network/metrics"
+	"github.com/GrappigPanda/Olivia/network/resp"
+	"github.com/GrappigPanda/Olivia/network/rpc"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func Init() {
 	config := config.ReadConfig()
+	// Bad certificates would otherwise only surface as every listener and
+	// peer connection failing.
+	if _, err := config.ServerTLS(); err != nil {
+		log.Fatalf("Failed to load TLS config: %v", err)
+	}
 
 	messageHandler := message_handler.NewMessageHandler()
 
 	internalCache := cache.NewCache(messageHandler, config)
 
-	networkHandler.StartIncomingNetwork(
+	if config.MetricsAddress != "" {
+		metrics.Serve(config.MetricsAddress, internalCache)
+	}
+
+	// Every listener but the incoming network router's, which it closes
+	// itself, for shutting down to close.
+	var listeners []net.Listener
+
+	if config.RESPPort != 0 {
+		address := fmt.Sprintf(":%d", config.RESPPort)
+		listener, err := resp.Listen(address, internalCache, config)
+		if err != nil {
+			log.Fatalf("Failed to listen for RESP connections: %v", err)
+		}
+		listeners = append(listeners, listener)
+	}
+
+	if config.MemcachePort != 0 {
+		address := fmt.Sprintf(":%d", config.MemcachePort)
+		listener, err := memcache.Listen(address, internalCache, config)
+		if err != nil {
+			log.Fatalf("Failed to listen for memcached connections: %v", err)
+		}
+		listeners = append(listeners, listener)
+	}
+
+	if config.GRPCPort != 0 {
+		address := fmt.Sprintf(":%d", config.GRPCPort)
+		listener, err := rpc.Listen(address, internalCache, config)
+		if err != nil {
+			log.Fatalf("Failed to listen for gRPC connections: %v", err)
+		}
+		listeners = append(listeners, listener)
+	}
+
+	if config.HTTPPort != 0 {
+		address := fmt.Sprintf(":%d", config.HTTPPort)
+		listener, err := httpapi.Listen(address, internalCache, config)
+		if err != nil {
+			log.Fatalf("Failed to listen for HTTP connections: %v", err)
+		}
+		listeners = append(listeners, listener)
+	}
+
+	stopNetwork := make(chan struct{})
+	go networkHandler.StartIncomingNetwork(
 		messageHandler,
 		internalCache,
 		config,
-		nil,
+		stopNetwork,
+	)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	log.Printf("Received %v, shutting down", <-signals)
+
+	shutdown(internalCache, listeners, stopNetwork, config.ShutdownTimeoutMillis)
+}
+
+// shutdown stops accepting connections and shuts the cache down, giving it
+// `timeoutMillis` to finish what it's doing.
+func shutdown(
+	internalCache *cache.Cache,
+	listeners []net.Listener,
+	stopNetwork chan struct{},
+	timeoutMillis int,
+) {
+	close(stopNetwork)
+	for _, listener := range listeners {
+		listener.Close()
+	}
+
+	ctx, cancel := context.WithTimeout(
+		context.Background(),
+		time.Duration(timeoutMillis)*time.Millisecond,
 	)
+	defer cancel()
+
+	if err := internalCache.Shutdown(ctx); err != nil {
+		log.Printf("Shut down before everything finished: %v", err)
+		return
+	}
+
+	log.Printf("Shut down cleanly")
 }
 
 func main() {
@@ -0,0 +1,152 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"github.com/GrappigPanda/Olivia/cache"
+	"github.com/GrappigPanda/Olivia/dht"
+	"net/http"
+)
+
+// keyResponse is a key along with its value. TTL is the seconds left before
+// the key expires, -1 if it never does, and left out for a key another node
+// served.
+type keyResponse struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	TTL   *int   `json:"ttl,omitempty"`
+}
+
+// putRequest is the body of a PUT. A TTL of zero, or none, means the key
+// never expires.
+type putRequest struct {
+	Value *string `json:"value"`
+	TTL   int     `json:"ttl"`
+}
+
+type peerResponse struct {
+	Address string          `json:"address"`
+	State   string          `json:"state"`
+	Metrics dht.PeerMetrics `json:"metrics"`
+}
+
+// bloomfilterResponse describes our bloom filter. Bits holds the filter
+// itself, packed as BloomSnapshot packs it, only if it was asked for.
+type bloomfilterResponse struct {
+	SizeBits  uint    `json:"size_bits"`
+	SetBits   uint    `json:"set_bits"`
+	FillRatio float64 `json:"fill_ratio"`
+	Bits      []byte  `json:"bits,omitempty"`
+}
+
+func (a *api) getKey(w http.ResponseWriter, r *http.Request) {
+	c, err := a.namespace(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	key := r.PathValue("key")
+	value, err := c.GetContext(r.Context(), key)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Key not found in cache")
+		return
+	}
+
+	response := keyResponse{Key: key, Value: value}
+	if ttl, err := c.GetTTL(key); err == nil {
+		response.TTL = &ttl
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (a *api) putKey(w http.ResponseWriter, r *http.Request) {
+	c, err := a.namespace(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if a.maxBodyBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, a.maxBodyBytes)
+	}
+
+	var body putRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Bad request body: "+err.Error())
+		return
+	}
+	if body.Value == nil {
+		writeError(w, http.StatusBadRequest, "Missing value")
+		return
+	}
+	if body.TTL < 0 {
+		writeError(w, http.StatusBadRequest, "TTL can't be negative")
+		return
+	}
+
+	key := r.PathValue("key")
+	if body.TTL > 0 {
+		err = c.SetExpiration(key, *body.Value, body.TTL)
+	} else {
+		err = c.SetContext(r.Context(), key, *body.Value)
+	}
+
+	if err == cache.ErrValueTooLarge {
+		writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *api) deleteKey(w http.ResponseWriter, r *http.Request) {
+	c, err := a.namespace(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = c.Delete(r.PathValue("key"))
+	if err == cache.ErrNotOwner {
+		writeError(w, http.StatusMisdirectedRequest, err.Error())
+		return
+	} else if err != nil {
+		writeError(w, http.StatusNotFound, "Key not found in cache")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *api) peers(w http.ResponseWriter, r *http.Request) {
+	peers := []peerResponse{}
+	for _, info := range a.cache.PeerInfo() {
+		peers = append(peers, peerResponse{info.IPPort, info.Status.String(), info.Metrics})
+	}
+
+	writeJSON(w, http.StatusOK, peers)
+}
+
+func (a *api) stats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.cache.Stats())
+}
+
+// bloomfilter leaves the filter's bits out unless `?bits=true` asks for them,
+// as they can run to megabytes.
+func (a *api) bloomfilter(w http.ResponseWriter, r *http.Request) {
+	bits, size, setBits := a.cache.BloomSnapshot()
+
+	response := bloomfilterResponse{SizeBits: size, SetBits: setBits}
+	if size > 0 {
+		response.FillRatio = float64(setBits) / float64(size)
+	}
+	if r.URL.Query().Get("bits") == "true" {
+		response.Bits = bits
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,109 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"github.com/GrappigPanda/Olivia/cache"
+	"github.com/GrappigPanda/Olivia/config"
+	"github.com/GrappigPanda/Olivia/network/metrics"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Listen serves the HTTP API on `address` in the background, translating
+// requests into operations on `c`. Closing the returned listener stops
+// serving.
+func Listen(address string, c *cache.Cache, config *config.Cfg) (net.Listener, error) {
+	listener, err := config.Listen(address)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Accepting HTTP connections on %v", listener.Addr())
+
+	server := &http.Server{Handler: Handler(c, int64(config.MaxMessageBytes))}
+	go func() {
+		err := server.Serve(listener)
+		log.Printf("Stopped accepting HTTP connections: %v", err)
+	}()
+
+	return listener, nil
+}
+
+// Handler serves the HTTP API for `c`. Request bodies over `maxBodyBytes` are
+// refused; zero means no cap.
+func Handler(c *cache.Cache, maxBodyBytes int64) http.Handler {
+	api := &api{cache: c, maxBodyBytes: maxBodyBytes}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /keys/{key}", api.getKey)
+	mux.HandleFunc("PUT /keys/{key}", api.putKey)
+	mux.HandleFunc("DELETE /keys/{key}", api.deleteKey)
+	mux.HandleFunc("GET /peers", api.peers)
+	mux.HandleFunc("GET /stats", api.stats)
+	mux.HandleFunc("GET /bloomfilter", api.bloomfilter)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+
+		if !api.authorized(r) {
+			writeError(w, http.StatusUnauthorized, "Authentication required")
+			return
+		}
+
+		done := c.StartRequest()
+		mux.ServeHTTP(w, r)
+		done()
+
+		// The pattern keeps keys out of the metric's labels.
+		if r.Pattern != "" {
+			metrics.ObserveRequest(r.Pattern, time.Since(started))
+		}
+	})
+}
+
+type api struct {
+	cache        *cache.Cache
+	maxBodyBytes int64
+}
+
+// authorized checks the request carries the cluster secret as a bearer token,
+// if there is one.
+func (a *api) authorized(r *http.Request) bool {
+	if !a.cache.RequiresAuth() {
+		return true
+	}
+
+	secret, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && a.cache.AuthenticatePeer(secret)
+}
+
+// namespace returns the cache of the namespace the `namespace` query
+// parameter names, the default namespace if it names none.
+func (a *api) namespace(r *http.Request) (*cache.Cache, error) {
+	name := r.URL.Query().Get("namespace")
+	if name == "" {
+		return a.cache, nil
+	}
+
+	return a.cache.Namespace(name)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("Failed to write an HTTP response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, errorResponse{message})
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
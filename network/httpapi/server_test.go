@@ -0,0 +1,162 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"github.com/GrappigPanda/Olivia/cache"
+	"github.com/GrappigPanda/Olivia/config"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestServer(t *testing.T) (*httptest.Server, *cache.Cache) {
+	c := cache.NewCache(nil, &config.Cfg{BloomfilterSize: 1000, IsTesting: true, MaxNamespaces: 2})
+	server := httptest.NewServer(Handler(c, 64))
+	t.Cleanup(func() {
+		server.Close()
+		c.Stop()
+	})
+
+	return server, c
+}
+
+// do sends a request and returns the response's status and body.
+func do(t *testing.T, method string, url string, body string, header ...string) (int, string) {
+	request, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		request.Header.Set(header[i], header[i+1])
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer response.Body.Close()
+
+	read, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	return response.StatusCode, strings.TrimSpace(string(read))
+}
+
+func TestKeys(t *testing.T) {
+	server, c := newTestServer(t)
+
+	var tests = []struct {
+		method string
+		path   string
+		body   string
+		status int
+		output string
+	}{
+		{"GET", "/keys/key1", "", http.StatusNotFound, `{"error":"Key not found in cache"}`},
+		{"PUT", "/keys/key1", `{"value":"value1"}`, http.StatusNoContent, ""},
+		{"GET", "/keys/key1", "", http.StatusOK, `{"key":"key1","value":"value1","ttl":-1}`},
+		{"PUT", "/keys/key2", `{"value":"value2","ttl":60}`, http.StatusNoContent, ""},
+		{"GET", "/keys/key2", "", http.StatusOK, `{"key":"key2","value":"value2","ttl":60}`},
+		{"PUT", "/keys/key3", `{"ttl":60}`, http.StatusBadRequest, `{"error":"Missing value"}`},
+		{"PUT", "/keys/key3", `{"value":"a","ttl":-1}`, http.StatusBadRequest, `{"error":"TTL can't be negative"}`},
+		{"DELETE", "/keys/key1", "", http.StatusNoContent, ""},
+		{"DELETE", "/keys/key1", "", http.StatusNotFound, `{"error":"Key not found in cache"}`},
+		{"POST", "/keys/key1", "", http.StatusMethodNotAllowed, "Method Not Allowed"},
+	}
+
+	for _, test := range tests {
+		status, output := do(t, test.method, server.URL+test.path, test.body)
+		if status != test.status || output != test.output {
+			t.Fatalf("%v %v: Expected %v %v, got %v %v", test.method, test.path, test.status, test.output, status, output)
+		}
+	}
+
+	if value, _ := c.Get("key2"); value != "value2" {
+		t.Fatalf("Expected %v, got %v", "value2", value)
+	}
+}
+
+func TestKeysInNamespace(t *testing.T) {
+	server, c := newTestServer(t)
+
+	status, _ := do(t, "PUT", server.URL+"/keys/key1?namespace=other", `{"value":"a"}`)
+	if status != http.StatusNoContent {
+		t.Fatalf("Expected %v, got %v", http.StatusNoContent, status)
+	}
+
+	if _, err := c.Get("key1"); err == nil {
+		t.Fatalf("Expected the default namespace not to have key1")
+	}
+
+	status, output := do(t, "GET", server.URL+"/keys/key1?namespace=other", "")
+	if status != http.StatusOK || output != `{"key":"key1","value":"a","ttl":-1}` {
+		t.Fatalf("Expected key1, got %v %v", status, output)
+	}
+
+	if status, _ := do(t, "GET", server.URL+"/keys/key1?namespace=bad%20name", ""); status != http.StatusBadRequest {
+		t.Fatalf("Expected %v, got %v", http.StatusBadRequest, status)
+	}
+}
+
+func TestBodyTooLarge(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	status, _ := do(t, "PUT", server.URL+"/keys/key1", `{"value":"`+strings.Repeat("a", 64)+`"}`)
+	if status != http.StatusBadRequest {
+		t.Fatalf("Expected %v, got %v", http.StatusBadRequest, status)
+	}
+}
+
+func TestStatsPeersAndBloomfilter(t *testing.T) {
+	server, c := newTestServer(t)
+	c.Set("key1", "value1")
+
+	status, output := do(t, "GET", server.URL+"/stats", "")
+	var stats cache.Stats
+	if err := json.Unmarshal([]byte(output), &stats); status != http.StatusOK || err != nil {
+		t.Fatalf("Expected stats, got %v %v", status, output)
+	}
+	if stats.Keys != 1 || stats.Sets != 1 {
+		t.Fatalf("Expected 1 key and 1 set, got %v", output)
+	}
+
+	if status, output := do(t, "GET", server.URL+"/peers", ""); status != http.StatusOK || output != "[]" {
+		t.Fatalf("Expected %v, got %v %v", "[]", status, output)
+	}
+
+	status, output = do(t, "GET", server.URL+"/bloomfilter", "")
+	var bloom bloomfilterResponse
+	if err := json.Unmarshal([]byte(output), &bloom); status != http.StatusOK || err != nil {
+		t.Fatalf("Expected the bloom filter, got %v %v", status, output)
+	}
+	if bloom.SizeBits == 0 || bloom.SetBits == 0 || bloom.Bits != nil {
+		t.Fatalf("Expected a filter without its bits, got %v", output)
+	}
+
+	_, output = do(t, "GET", server.URL+"/bloomfilter?bits=true", "")
+	if err := json.Unmarshal([]byte(output), &bloom); err != nil || uint(len(bloom.Bits)) != (bloom.SizeBits+7)/8 {
+		t.Fatalf("Expected %v bytes of bits, got %v", (bloom.SizeBits+7)/8, len(bloom.Bits))
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	server, c := newTestServer(t)
+	c.SetClusterSecrets("secret", "")
+
+	status, output := do(t, "GET", server.URL+"/stats", "")
+	if status != http.StatusUnauthorized || output != `{"error":"Authentication required"}` {
+		t.Fatalf("Expected %v, got %v %v", http.StatusUnauthorized, status, output)
+	}
+
+	if status, _ := do(t, "GET", server.URL+"/stats", "", "Authorization", "Bearer wrong"); status != http.StatusUnauthorized {
+		t.Fatalf("Expected %v, got %v", http.StatusUnauthorized, status)
+	}
+
+	if status, _ := do(t, "GET", server.URL+"/stats", "", "Authorization", "Bearer secret"); status != http.StatusOK {
+		t.Fatalf("Expected %v, got %v", http.StatusOK, status)
+	}
+}
@@ -1,5 +1,9 @@
 package incomingNetwork
 
+import (
+	"github.com/GrappigPanda/Olivia/acl"
+)
+
 // FSMState represents The different states the conn processor will be at
 // during a network transaction.
 type FSMState int
@@ -14,6 +18,9 @@ const (
 // level, functions differently.
 type ConnProcessor struct {
 	State FSMState
+	// Permissions are the commands the connection may run once it's
+	// processing.
+	Permissions *acl.Permissions
 }
 
 // NewProcessorFSM Handles creation of a new connection processor.
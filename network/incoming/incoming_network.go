@@ -3,12 +3,17 @@ package incomingNetwork
 import (
 	"bufio"
 	"fmt"
+	"github.com/GrappigPanda/Olivia/acl"
 	"github.com/GrappigPanda/Olivia/cache"
 	"github.com/GrappigPanda/Olivia/config"
 	"github.com/GrappigPanda/Olivia/network/message_handler"
+	"github.com/GrappigPanda/Olivia/network/metrics"
 	"github.com/GrappigPanda/Olivia/parser"
 	"log"
 	"net"
+	"strings"
+	"sync"
+	"time"
 )
 
 // ConnectionCtx handles maintaining a persistent state per incoming
@@ -31,11 +36,18 @@ func StartNetworkRouter(
 	// via channels. It's overly indented, this should probably be seperated
 	// elsewhere.
 	go func(stopchan chan struct{}) {
-		listen, err := net.Listen("tcp", fmt.Sprintf(":%d", config.ListenPort))
+		listen, err := config.Listen(fmt.Sprintf(":%d", config.ListenPort))
 		if err != nil {
 			panic(err)
 		}
-		defer listen.Close()
+
+		// Accept blocks, so stopping closes the listener out from under it.
+		stopped := make(chan struct{})
+		go func() {
+			<-stopchan
+			close(stopped)
+			listen.Close()
+		}()
 
 		ctx := &ConnectionCtx{
 			parser.NewParser(mh),
@@ -45,80 +57,214 @@ func StartNetworkRouter(
 		log.Println("Starting connection router!")
 
 		for {
-			select {
-			default:
-				conn, err := listen.Accept()
-				if err != nil {
-					log.Println(err)
-					continue
+			conn, err := listen.Accept()
+			if err != nil {
+				select {
+				case <-stopped:
+					log.Printf("Stopped the network router.")
+					return
+				default:
 				}
-				log.Println("Incoming connection detected from ",
-					conn.RemoteAddr().String(),
-				)
-
-				go ctx.handleConnection(&conn)
-			case <-stopchan:
-				log.Printf("Forcefully quitting network router.")
-				return
+				log.Println(err)
+				continue
 			}
+			log.Println("Incoming connection detected from ",
+				conn.RemoteAddr().String(),
+			)
+
+			go ctx.handleConnection(&conn, config.MaxMessageBytes)
 		}
 	}(stopchan)
 
 	return stopchan
 }
 
+// maxPipelinedRequests caps how many commands a pipelined connection can have
+// executing at once. Reading from the connection stops until one finishes.
+const maxPipelinedRequests = 128
+
 // handleConnection handles handling state of the incoming network FSM,
-// verifying passwords, &c.
-func (ctx *ConnectionCtx) handleConnection(conn *net.Conn) {
+// verifying passwords, &c. A message larger than maxMessageBytes closes the
+// connection.
+//
+// Commands are executed and answered in the order they arrive until the
+// connection sends PIPELINE. From then on each command executes as soon as
+// it's read and is answered as soon as it finishes, so responses can arrive
+// out of order and have to be matched up by their hash. AUTH, SELECT,
+// PIPELINE and the commands (un)subscribing the connection change its state,
+// so they wait for every command before them to finish first.
+func (ctx *ConnectionCtx) handleConnection(conn *net.Conn, maxMessageBytes int) {
 	defer (*conn).Close()
-	// TODO(ian): Implement authentication (new issue).
+	// Each connection gets its own context, so a SELECT only switches the
+	// namespace of the connection which sent it.
+	connCtx := *ctx
+	ctx = &connCtx
+
 	connProc := NewProcessorFSM(PROCESSING)
+	connProc.Permissions = acl.All
+	if ctx.Cache.RequiresAuth() {
+		connProc.ChangeState(UNAUTHENTICATED)
+		connProc.Permissions = nil
+	}
 	reader := bufio.NewReader(*conn)
-	password := "TestBcryptPassword"
+
+	// Pipelined commands answer from their own goroutines, so writes are
+	// serialized to keep responses whole.
+	var writeLock sync.Mutex
+	write := func(response string) {
+		writeLock.Lock()
+		defer writeLock.Unlock()
+		(*conn).Write([]byte(response))
+	}
+
+	// Keyspace events and channel messages are pushed through the same
+	// writes as responses.
+	watch := &connWatch{write: write}
+	defer watch.close()
+	channels := &connChannels{write: write}
+	defer channels.close()
+
+	pipelined := false
+	var inflight sync.WaitGroup
+	slots := make(chan struct{}, maxPipelinedRequests)
+	defer inflight.Wait()
 
 	for {
-		line, _, err := reader.ReadLine()
-		if err != nil {
+		line, payloads, err := parser.ReadFramedLimit(reader, maxMessageBytes)
+		if tooLarge, ok := err.(*parser.MessageTooLargeError); ok {
+			log.Printf(
+				"Closing connection from %v: %v",
+				(*conn).RemoteAddr().String(),
+				tooLarge,
+			)
+			inflight.Wait()
+			write(fmt.Sprintf("0:%v\n", tooLarge))
+			break
+		} else if err != nil {
+			inflight.Wait()
 			log.Printf("Connection %v failed to readline, closing connection.", *conn)
 			break
 		}
 
+		command, err := ctx.Parser.ParseFramed(line, payloads, conn)
+		if err != nil {
+			log.Println(err)
+		}
+
+		if strings.ToUpper(command.Command) == "AUTH" {
+			inflight.Wait()
+			write(ctx.authenticate(connProc, command))
+			continue
+		}
+
 		switch connProc.State {
 		case UNAUTHENTICATED:
-			connProc.Authenticate(password)
-			log.Println(
+			// PING is answered regardless, so health checks don't need the
+			// secret.
+			if strings.ToUpper(command.Command) == "PING" {
+				write(ctx.process(command, line, *conn))
+				break
+			}
+
+			log.Printf(
 				"Unauthenticated request from %v",
 				(*conn).RemoteAddr().String(),
 			)
+			write(fmt.Sprintf("%s:Unauthenticated.\n", command.Hash))
 			break
 		case PROCESSING:
-			command, err := ctx.Parser.Parse(string(line), conn)
-			if err != nil {
-				log.Println(err)
+			if !connProc.Permissions.Allows(command.Command) {
+				write(fmt.Sprintf(
+					"%s:Permission denied for %s.\n",
+					command.Hash,
+					strings.ToUpper(command.Command),
+				))
+				break
 			}
 
-			if command.Command != "PING" {
-				log.Printf("Received %v from %v", string(line),
-					(*conn).RemoteAddr().String(),
-				)
-			}
+			switch strings.ToUpper(command.Command) {
+			case "PIPELINE":
+				inflight.Wait()
+				pipelined = true
+				write(fmt.Sprintf("%s:PIPELINED OK\n", command.Hash))
+			case "SELECT":
+				inflight.Wait()
+				write(ctx.process(command, line, *conn))
+			case "WATCH", "UNWATCH":
+				inflight.Wait()
+				write(watch.handle(ctx, *command))
+			case "SUBSCRIBE", "UNSUBSCRIBE":
+				inflight.Wait()
+				write(channels.handle(ctx, *command))
+			default:
+				if !pipelined {
+					write(ctx.process(command, line, *conn))
+					break
+				}
 
-			response := ctx.ExecuteCommand(*command)
-
-			if _, ok := command.Args["BLOOMFILTER"]; ok {
-				log.Printf("Responding to %v with bloomfilter",
-					(*conn).RemoteAddr().String(),
-				)
-			} else if command.Command != "PING" {
-				log.Printf("Responding to %v %v with %v",
-					command.Command,
-					command.Args,
-					response,
-				)
+				slots <- struct{}{}
+				inflight.Add(1)
+				go func() {
+					defer inflight.Done()
+					write(ctx.process(command, line, *conn))
+					<-slots
+				}()
 			}
-
-			(*conn).Write([]byte(response))
 			break
 		}
 	}
 }
+
+// process executes a single command, logging it along with its response.
+func (ctx *ConnectionCtx) process(command *parser.CommandData, line string, conn net.Conn) string {
+	if command.Command != "PING" {
+		log.Printf("Received %v from %v", string(line),
+			conn.RemoteAddr().String(),
+		)
+	}
+
+	defer ctx.Cache.StartRequest()()
+
+	started := time.Now()
+	response := ctx.ExecuteCommand(*command)
+	metrics.ObserveRequest(command.Command, time.Since(started))
+
+	if _, ok := command.Args["BLOOMFILTER"]; ok {
+		log.Printf("Responding to %v with bloomfilter",
+			conn.RemoteAddr().String(),
+		)
+	} else if _, ok := command.Args["CUCKOOFILTER"]; ok {
+		log.Printf("Responding to %v with cuckoo filter",
+			conn.RemoteAddr().String(),
+		)
+	} else if command.Command != "PING" {
+		log.Printf("Responding to %v %v with %v",
+			command.Command,
+			command.Args,
+			response,
+		)
+	}
+
+	return response
+}
+
+// authenticate checks the secret sent with an AUTH command and upgrades the
+// connection if it matches. `AUTH secret` checks the cluster secret, which
+// allows every command, and `AUTH name:secret` user `name`'s, which allows
+// the commands their roles do.
+func (ctx *ConnectionCtx) authenticate(connProc *ConnProcessor, command *parser.CommandData) string {
+	for name, secret := range command.Args {
+		if secret == "" {
+			name, secret = "", name
+		}
+
+		if permissions, ok := ctx.Cache.Authenticate(name, secret); ok {
+			connProc.Authenticate(secret)
+			connProc.Permissions = permissions
+			return fmt.Sprintf("%s:AUTHED OK\n", command.Hash)
+		}
+	}
+
+	log.Printf("Failed authentication from %v", (*command.Conn).RemoteAddr().String())
+	return fmt.Sprintf("%s:Invalid secret.\n", command.Hash)
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/GrappigPanda/Olivia/cache"
 	"github.com/GrappigPanda/Olivia/config"
 	"github.com/GrappigPanda/Olivia/network/message_handler"
+	"github.com/GrappigPanda/Olivia/parser"
 	"net"
 	"os"
 	"strings"
@@ -107,3 +108,361 @@ func TestMain(m *testing.M) {
 
 	stopchan <- struct{}{}
 }
+
+func TestGetFramedValueFromRemoteNode(t *testing.T) {
+	key := "binarykey"
+	value := "has spaces: colons,\nand a newline"
+
+	conn, err := net.DialTimeout("tcp", BASENODE, 1*time.Second)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer conn.Close()
+
+	token, payload, framed := parser.FrameValue(value)
+	if !framed {
+		t.Fatalf("Expected %q to need framing", value)
+	}
+	conn.Write([]byte(parser.AppendPayloads(
+		fmt.Sprintf("SET %s:%s\n", key, token),
+		[]string{payload},
+	)))
+
+	line, payloads, err := parser.ReadFramed(bufio.NewReader(conn))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(payloads) != 1 || payloads[0] != value {
+		t.Fatalf("Expected SET to echo %q, got %v %q", value, line, payloads)
+	}
+
+	clientConfig := *CONFIG
+	clientConfig.IsTesting = true
+	clientConfig.RemotePeers = []string{BASENODE}
+	// The client is a separate node from the one listening on BASENODE.
+	clientConfig.ListenPort = 5456
+	client := cache.NewCache(message_handler.NewMessageHandler(), &clientConfig)
+
+	peer := client.PeerList.Peers[0]
+	if err := peer.Connect(); err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer peer.Disconnect()
+
+	// The remote bloom filter is fetched asynchronously after connecting.
+	for i := 0; ; i++ {
+		peer.Lock()
+		hasKey, _ := peer.BloomFilter.HasKey([]byte(key))
+		peer.Unlock()
+		if hasKey {
+			break
+		}
+		if i == 50 {
+			t.Fatalf("Never received a bloom filter containing %v", key)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	client.AddPeer(BASENODE)
+
+	retVal, err := client.Get(key)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if retVal != value {
+		t.Fatalf("Expected %q, got %q", value, retVal)
+	}
+}
+
+func TestConnectionRequiresAuthentication(t *testing.T) {
+	authConfig := *CONFIG
+	authConfig.IsTesting = true
+	authConfig.ClusterSecret = "secret"
+
+	ctx := &ConnectionCtx{
+		parser.NewParser(nil),
+		cache.NewCache(nil, &authConfig),
+	}
+
+	server, client := net.Pipe()
+	defer client.Close()
+	go ctx.handleConnection(&server, 0)
+
+	reader := bufio.NewReader(client)
+	send := func(command string) string {
+		client.Write([]byte(command))
+		response, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		return response
+	}
+
+	if response := send("hash:GET key1\n"); response != "hash:Unauthenticated.\n" {
+		t.Fatalf("Expected %v, got %v", "hash:Unauthenticated.\n", response)
+	}
+
+	if response := send("hash:SET key1:value1\n"); response != "hash:Unauthenticated.\n" {
+		t.Fatalf("Expected %v, got %v", "hash:Unauthenticated.\n", response)
+	}
+
+	// PING doesn't need the secret.
+	if response := send("hash:PING 1\n"); response != "0:PONG 1\n" {
+		t.Fatalf("Expected %v, got %v", "0:PONG 1\n", response)
+	}
+
+	if response := send("hash:AUTH wrong\n"); response != "hash:Invalid secret.\n" {
+		t.Fatalf("Expected %v, got %v", "hash:Invalid secret.\n", response)
+	}
+
+	if response := send("hash:AUTH secret\n"); response != "hash:AUTHED OK\n" {
+		t.Fatalf("Expected %v, got %v", "hash:AUTHED OK\n", response)
+	}
+
+	if response := send("hash:SET key1:value1\n"); response != "hash:SAT key1:value1\n" {
+		t.Fatalf("Expected %v, got %v", "hash:SAT key1:value1\n", response)
+	}
+}
+
+func TestConnectionClosedOnOversizedMessage(t *testing.T) {
+	testConfig := *CONFIG
+	testConfig.IsTesting = true
+
+	ctx := &ConnectionCtx{
+		parser.NewParser(nil),
+		cache.NewCache(nil, &testConfig),
+	}
+
+	server, client := net.Pipe()
+	defer client.Close()
+	go ctx.handleConnection(&server, 64)
+
+	go client.Write([]byte("hash:SET key1:" + strings.Repeat("a", 100) + "\n"))
+
+	reader := bufio.NewReader(client)
+	response, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if response != "0:Message exceeds the maximum of 64 bytes.\n" {
+		t.Fatalf("Expected %v, got %v", "0:Message exceeds the maximum of 64 bytes.\n", response)
+	}
+
+	if _, err := reader.ReadString('\n'); err == nil {
+		t.Fatalf("Expected the connection to be closed")
+	}
+
+	if _, err := ctx.Cache.Get("key1"); err == nil {
+		t.Fatalf("Expected the oversized SET to not be applied")
+	}
+
+	// Other connections are unaffected.
+	server, client = net.Pipe()
+	defer client.Close()
+	go ctx.handleConnection(&server, 64)
+
+	client.Write([]byte("hash:PING 1\n"))
+	if response, err := bufio.NewReader(client).ReadString('\n'); err != nil || response != "0:PONG 1\n" {
+		t.Fatalf("Expected %v, got %v (%v)", "0:PONG 1\n", response, err)
+	}
+}
+
+func TestPipelinedConnection(t *testing.T) {
+	testConfig := *CONFIG
+	testConfig.IsTesting = true
+	testConfig.MaxNamespaces = 1
+
+	ctx := &ConnectionCtx{
+		parser.NewParser(nil),
+		cache.NewCache(nil, &testConfig),
+	}
+
+	server, client := net.Pipe()
+	defer client.Close()
+	go ctx.handleConnection(&server, 0)
+
+	reader := bufio.NewReader(client)
+	readResponses := func(count int) map[string]string {
+		responses := make(map[string]string)
+		for i := 0; i < count; i++ {
+			response, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			hash, _, _ := strings.Cut(response, ":")
+			responses[hash] = response
+		}
+
+		return responses
+	}
+
+	go client.Write([]byte("pipe:PIPELINE 1\n"))
+	if response := readResponses(1)["pipe"]; response != "pipe:PIPELINED OK\n" {
+		t.Fatalf("Expected %v, got %v", "pipe:PIPELINED OK\n", response)
+	}
+
+	var commands strings.Builder
+	for i := 0; i < 50; i++ {
+		fmt.Fprintf(&commands, "set%d:SET key%d:value%d\n", i, i, i)
+	}
+	// SELECT waits for every SET before it, and the GETs run in the new
+	// namespace.
+	commands.WriteString("select:SELECT other\n")
+	commands.WriteString("get:GET key1\n")
+	go client.Write([]byte(commands.String()))
+
+	responses := readResponses(52)
+	for i := 0; i < 50; i++ {
+		hash := fmt.Sprintf("set%d", i)
+		expected := fmt.Sprintf("%s:SAT key%d:value%d\n", hash, i, i)
+		if responses[hash] != expected {
+			t.Fatalf("Expected %v, got %v", expected, responses[hash])
+		}
+	}
+
+	if responses["select"] != "select:SELECTED other\n" {
+		t.Fatalf("Expected %v, got %v", "select:SELECTED other\n", responses["select"])
+	}
+	if responses["get"] != "get:GOT \n" {
+		t.Fatalf("Expected %v, got %v", "get:GOT \n", responses["get"])
+	}
+
+	if value, err := ctx.Cache.Get("key49"); err != nil || value != "value49" {
+		t.Fatalf("Expected %v, got %v %v", "value49", value, err)
+	}
+}
+
+func TestUserPermissions(t *testing.T) {
+	authConfig := *CONFIG
+	authConfig.IsTesting = true
+	authConfig.ClusterSecret = "secret"
+	authConfig.Users = []config.User{
+		{Name: "reader", Secret: "pw", Roles: []string{"read-only"}},
+	}
+
+	ctx := &ConnectionCtx{
+		parser.NewParser(nil),
+		cache.NewCache(nil, &authConfig),
+	}
+	ctx.Cache.Set("key1", "value1")
+
+	server, client := net.Pipe()
+	defer client.Close()
+	go ctx.handleConnection(&server, 0)
+
+	reader := bufio.NewReader(client)
+	send := func(command string) string {
+		client.Write([]byte(command))
+		response, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		return response
+	}
+
+	var exchanges = [][2]string{
+		{"hash:AUTH reader:wrong\n", "hash:Invalid secret.\n"},
+		{"hash:AUTH reader:pw\n", "hash:AUTHED OK\n"},
+		{"hash:GET key1\n", "hash:GOT key1:value1\n"},
+		{"hash:SET key1:value2\n", "hash:Permission denied for SET.\n"},
+		{"hash:SAVE 1\n", "hash:Permission denied for SAVE.\n"},
+		// Authenticating with the cluster secret allows everything.
+		{"hash:AUTH secret\n", "hash:AUTHED OK\n"},
+		{"hash:SET key1:value2\n", "hash:SAT key1:value2\n"},
+	}
+
+	for _, exchange := range exchanges {
+		if response := send(exchange[0]); response != exchange[1] {
+			t.Fatalf("Expected %v, got %v", exchange[1], response)
+		}
+	}
+}
+
+func TestWatchingConnectionIsNotified(t *testing.T) {
+	testConfig := *CONFIG
+	testConfig.IsTesting = true
+
+	ctx := &ConnectionCtx{
+		parser.NewParser(nil),
+		cache.NewCache(nil, &testConfig),
+	}
+
+	server, client := net.Pipe()
+	defer client.Close()
+	go ctx.handleConnection(&server, 0)
+
+	reader := bufio.NewReader(client)
+	exchange := func(command string, expected string) {
+		go client.Write([]byte(command))
+		response, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if response != expected {
+			t.Fatalf("Expected %v, got %v", expected, response)
+		}
+	}
+
+	exchange("watch:WATCH user*\n", "watch:WATCHING user*\n")
+	exchange("watch:WATCH session*\n", "watch:WATCHING session*,user*\n")
+
+	ctx.Cache.Set("user1", "value1")
+	ctx.Cache.Set("other", "value1")
+	ctx.Cache.Delete("user1")
+	exchange("", "0:NOTIFIED user1:set\n")
+	exchange("", "0:NOTIFIED user1:del\n")
+
+	exchange("unwatch:UNWATCH user*,other*\n", "unwatch:UNWATCHED user*\n")
+	ctx.Cache.Set("user2", "value2")
+	ctx.Cache.Set("session1", "value1")
+	exchange("", "0:NOTIFIED session1:set\n")
+
+	exchange("unwatch:UNWATCH session*\n", "unwatch:UNWATCHED session*\n")
+	ctx.Cache.Set("session2", "value2")
+	exchange("ping:PING 1\n", "0:PONG 1\n")
+}
+
+func TestSubscribedConnectionReceivesMessages(t *testing.T) {
+	testConfig := *CONFIG
+	testConfig.IsTesting = true
+
+	ctx := &ConnectionCtx{
+		parser.NewParser(nil),
+		cache.NewCache(message_handler.NewMessageHandler(), &testConfig),
+	}
+
+	connect := func() (net.Conn, *bufio.Reader) {
+		server, client := net.Pipe()
+		go ctx.handleConnection(&server, 0)
+		return client, bufio.NewReader(client)
+	}
+	subscriber, subscriberReader := connect()
+	defer subscriber.Close()
+	publisher, publisherReader := connect()
+	defer publisher.Close()
+
+	exchange := func(conn net.Conn, reader *bufio.Reader, command string, expected string) {
+		go conn.Write([]byte(command))
+		var response strings.Builder
+		for response.Len() < len(expected) {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			response.WriteString(line)
+		}
+		if response.String() != expected {
+			t.Fatalf("Expected %v, got %v", expected, response.String())
+		}
+	}
+
+	exchange(subscriber, subscriberReader, "sub:SUBSCRIBE news,alerts\n", "sub:SUBSCRIBED alerts,news\n")
+	exchange(publisher, publisherReader, "pub:PUBLISH news:hello\n", "pub:PUBLISHED 1\n")
+	exchange(subscriber, subscriberReader, "", "0:MESSAGE news:hello\n")
+
+	exchange(publisher, publisherReader, "pub:PUBLISH alerts:$11\nhello world\n", "pub:PUBLISHED 1\n")
+	exchange(subscriber, subscriberReader, "", "0:MESSAGE alerts:$11\nhello world\n")
+
+	exchange(subscriber, subscriberReader, "unsub:UNSUBSCRIBE news,other\n", "unsub:UNSUBSCRIBED news\n")
+	exchange(publisher, publisherReader, "pub:PUBLISH news:hello\n", "pub:PUBLISHED 0\n")
+}
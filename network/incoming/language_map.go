@@ -2,11 +2,18 @@ package incomingNetwork
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"github.com/GrappigPanda/Olivia/cache"
+	"github.com/GrappigPanda/Olivia/config"
+	"github.com/GrappigPanda/Olivia/dht"
 	"github.com/GrappigPanda/Olivia/parser"
 	"log"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // ExecuteCommand Is a function that makes me terribly sad, as
@@ -24,60 +31,621 @@ func (ctx *ConnectionCtx) ExecuteCommand(requestData parser.CommandData) string
 			// which will return to the parser to the command
 			// processor.
 			retVals := make([]string, len(args))
+			var payloads []string
 
 			index := 0
 			for k := range args {
 				val, err := ctx.Cache.Get(k)
 				if err == nil {
-					retVals[index] = fmt.Sprintf("%s:%s", k, val)
+					retVals[index] = formatKeyValue(k, val, &payloads)
 					index++
 				}
 			}
 
-			return createResponse(command, retVals[0:index], requestData.Hash)
+			return parser.AppendPayloads(
+				createResponse(command, retVals[0:index], requestData.Hash),
+				payloads,
+			)
+		}
+	case "MGET":
+		{
+			keys := make([]string, 0, len(args))
+			for k := range args {
+				keys = append(keys, k)
+			}
+
+			var retVals []string
+			var payloads []string
+			for k, val := range ctx.Cache.GetMany(keys) {
+				retVals = append(retVals, formatKeyValue(k, val, &payloads))
+			}
+
+			return parser.AppendPayloads(
+				createResponse(command, retVals, requestData.Hash),
+				payloads,
+			)
 		}
 	case "SET":
 		{
-			retVals := make([]string, len(args))
+			if err := ctx.Cache.MSet(args); err != nil {
+				return fmt.Sprintf("%s:%v\n", requestData.Hash, err)
+			}
 
-			index := 0
+			retVals := make([]string, 0, len(args))
+			var payloads []string
 			for k, v := range args {
-				ctx.Cache.Set(k, v)
+				retVals = append(retVals, formatKeyValue(k, v, &payloads))
+			}
+
+			return parser.AppendPayloads(
+				createResponse(command, retVals, requestData.Hash),
+				payloads,
+			)
+		}
+	case "SETNX":
+		{
+			retVals := make([]string, 0, len(args))
+			for k, v := range args {
+				// Like SETEX, a key can carry an expiration, i.e.
+				// "key:value:exp".
+				timeout := -1
+				if expString, ok := requestData.Expiration[k]; ok {
+					expInt, err := strconv.Atoi(expString)
+					if err != nil {
+						return "Invalid command sent in. Bad expiration.\n"
+					}
+					timeout = expInt
+				}
+
+				written, err := ctx.Cache.SetIf(k, v, false, timeout)
+				if err != nil {
+					return fmt.Sprintf("%s:%v\n", requestData.Hash, err)
+				}
+				if written {
+					retVals = append(retVals, k)
+				}
+			}
 
-				retVals[index] = fmt.Sprintf("%s:%s", k, v)
-				index++
+			return createResponse(command, retVals, requestData.Hash)
+		}
+	case "MSET":
+		{
+			var retVals []string
+			for k, err := range ctx.Cache.SetMany(args) {
+				status := "OK"
+				if err != nil {
+					log.Println(err)
+					status = "ERR"
+				}
+
+				retVals = append(retVals, fmt.Sprintf("%s:%s", k, status))
 			}
 
 			return createResponse(command, retVals, requestData.Hash)
 		}
 	case "SETEX":
 		{
-			retVals := make([]string, len(args))
-			expirations := requestData.Expiration
+			expirations := make(map[string]int, len(requestData.Expiration))
 
-			if len(args) != len(expirations) {
+			if len(args) != len(requestData.Expiration) {
 				return "Invalid command sent in. Unbalanced keys:expirations.\n"
 			}
 
-			index := 0
-			for k, v := range args {
-				expInt, err := strconv.Atoi(expirations[k])
+			for k, expString := range requestData.Expiration {
+				expInt, err := strconv.Atoi(expString)
 				if err != nil {
-					continue
+					return "Invalid command sent in. Bad expiration.\n"
 				}
+				expirations[k] = expInt
+			}
 
-				log.Println(k, v, expInt)
-				(*ctx.Cache).SetExpiration(k, v, expInt)
+			if err := ctx.Cache.MSetEx(args, expirations); err != nil {
+				return fmt.Sprintf("%s:%v\n", requestData.Hash, err)
+			}
 
-				retVals[index] = fmt.Sprintf("%s:%s:%d", k, v, expInt)
-				index++
+			retVals := make([]string, 0, len(args))
+			var payloads []string
+			for k, v := range args {
+				retVals = append(retVals, fmt.Sprintf(
+					"%s:%d",
+					formatKeyValue(k, v, &payloads),
+					expirations[k],
+				))
 				// Please note: Expiration keys are not added to the bloom
 				// filter, as the bloom filter only tracks the immutable state
 				// of Olivia.
 			}
 
+			return parser.AppendPayloads(
+				createResponse(command, retVals, requestData.Hash),
+				payloads,
+			)
+		}
+	case "REPLICATE", "REPLICATELIST", "REPLICATEHASH":
+		{
+			kind, _ := cache.ReplicatedKind(command)
+			entries := make([]cache.ReplicationEntry, 0, len(args))
+			for k, v := range args {
+				expiration := 0
+				if expString, ok := requestData.Expiration[k]; ok {
+					expInt, err := strconv.Atoi(expString)
+					if err != nil {
+						return "Invalid command sent in. Bad expiration.\n"
+					}
+					expiration = expInt
+				}
+
+				var version uint64
+				if versionString, ok := requestData.Versions[k]; ok {
+					parsed, err := strconv.ParseUint(versionString, 10, 64)
+					if err != nil {
+						return "Invalid command sent in. Bad version.\n"
+					}
+					version = parsed
+				}
+
+				entries = append(
+					entries,
+					cache.ReplicationEntry{
+						Key:        k,
+						Value:      v,
+						Expiration: expiration,
+						Version:    version,
+						Kind:       kind,
+					},
+				)
+			}
+
+			acks := ctx.Cache.ApplyReplicationBatch(entries)
+			return createResponse(
+				command,
+				cache.FormatReplicationAck(acks),
+				requestData.Hash,
+			)
+		}
+	case "TOMBSTONE":
+		{
+			entries := make([]cache.ReplicationEntry, 0, len(args))
+			for k, versionString := range args {
+				version, err := strconv.ParseUint(versionString, 10, 64)
+				if err != nil {
+					return "Invalid command sent in. Bad version.\n"
+				}
+
+				entries = append(
+					entries,
+					cache.ReplicationEntry{
+						Key:     k,
+						Version: version,
+						Deleted: true,
+					},
+				)
+			}
+
+			acks := ctx.Cache.ApplyReplicationBatch(entries)
+			return createResponse(
+				command,
+				cache.FormatReplicationAck(acks),
+				requestData.Hash,
+			)
+		}
+	case "VGET":
+		{
+			// Our own copies along with their versions, for a
+			// coordinator repairing replicas, as
+			// `key:value:0:version`.
+			var retVals []string
+			var payloads []string
+			for k := range args {
+				val, version, ok, err := ctx.Cache.GetLocalVersioned(k)
+				if err == nil && ok {
+					retVals = append(retVals, fmt.Sprintf("%s:0:%d", formatKeyValue(k, val, &payloads), version))
+				}
+			}
+
+			return parser.AppendPayloads(
+				createResponse(command, retVals, requestData.Hash),
+				payloads,
+			)
+		}
+	case "MEMORY":
+		{
+			retVals := make([]string, len(args))
+
+			index := 0
+			for k := range args {
+				usage, err := ctx.Cache.MemoryUsage(k)
+				if err == nil {
+					retVals[index] = fmt.Sprintf("%s:%d", k, usage)
+					index++
+				}
+			}
+
+			return createResponse(command, retVals[0:index], requestData.Hash)
+		}
+	case "TTL":
+		{
+			retVals := make([]string, len(args))
+
+			index := 0
+			for k := range args {
+				ttl, err := ctx.Cache.GetTTL(k)
+				if err == nil {
+					retVals[index] = fmt.Sprintf("%s:%d", k, ttl)
+					index++
+				}
+			}
+
+			return createResponse(command, retVals[0:index], requestData.Hash)
+		}
+	case "EXPIRE":
+		{
+			retVals := make([]string, 0, len(args))
+			for k, timeoutString := range args {
+				timeout, err := strconv.Atoi(timeoutString)
+				if err != nil {
+					return "Invalid command sent in. Bad expiration.\n"
+				}
+
+				if err := ctx.Cache.Expire(k, timeout); err == nil {
+					retVals = append(retVals, k)
+				}
+			}
+
+			return createResponse(command, retVals, requestData.Hash)
+		}
+	case "PERSIST":
+		{
+			retVals := make([]string, 0, len(args))
+			for k := range args {
+				if removed, err := ctx.Cache.Persist(k); err == nil && removed {
+					retVals = append(retVals, k)
+				}
+			}
+
+			return createResponse(command, retVals, requestData.Hash)
+		}
+	case "INCR", "DECR":
+		{
+			adjust := ctx.Cache.Increment
+			if strings.ToUpper(command) == "DECR" {
+				adjust = ctx.Cache.Decrement
+			}
+
+			retVals := make([]string, 0, len(args))
+			for k, deltaString := range args {
+				// A key without a delta is adjusted by one.
+				delta := int64(1)
+				if deltaString != "" {
+					parsed, err := strconv.ParseInt(deltaString, 10, 64)
+					if err != nil {
+						return "Invalid command sent in. Bad delta.\n"
+					}
+					delta = parsed
+				}
+
+				value, err := adjust(k, delta)
+				if err != nil {
+					log.Println(err)
+					retVals = append(retVals, fmt.Sprintf("%s:ERR", k))
+					continue
+				}
+
+				retVals = append(retVals, fmt.Sprintf("%s:%d", k, value))
+			}
+
+			return createResponse(command, retVals, requestData.Hash)
+		}
+	case "CAS":
+		{
+			retVals := make([]string, 0, len(args))
+			for k, expected := range args {
+				// The new value takes the place of SETEX's expiration,
+				// i.e. "key:expected:new".
+				value, ok := requestData.Expiration[k]
+				if !ok {
+					return "Invalid command sent in. Expected key:expected:new.\n"
+				}
+
+				status := "OK"
+				if err := ctx.Cache.CompareAndSwap(k, expected, value); err == cache.ErrValueMismatch {
+					status = "MISMATCH"
+				} else if err != nil {
+					log.Println(err)
+					status = "ERR"
+				}
+
+				retVals = append(retVals, fmt.Sprintf("%s:%s", k, status))
+			}
+
 			return createResponse(command, retVals, requestData.Hash)
+		}
+	case "LPUSH", "RPUSH":
+		{
+			push := ctx.Cache.LPush
+			if strings.ToUpper(command) == "RPUSH" {
+				push = ctx.Cache.RPush
+			}
+
+			retVals := make([]string, 0, len(args))
+			for k, v := range args {
+				// The list's maximum length takes the place of SETEX's
+				// expiration, i.e. "key:value:maxlen".
+				maxLen := 0
+				if maxLenString, ok := requestData.Expiration[k]; ok {
+					parsed, err := strconv.Atoi(maxLenString)
+					if err != nil || parsed < 0 {
+						return "Invalid command sent in. Bad maximum length.\n"
+					}
+					maxLen = parsed
+				}
 
+				length, err := push(k, maxLen, v)
+				if err != nil {
+					log.Println(err)
+					retVals = append(retVals, fmt.Sprintf("%s:ERR", k))
+					continue
+				}
+
+				retVals = append(retVals, fmt.Sprintf("%s:%d", k, length))
+			}
+
+			return createResponse(command, retVals, requestData.Hash)
+		}
+	case "LPOP":
+		{
+			retVals := make([]string, 0, len(args))
+			var payloads []string
+			for k := range args {
+				if value, err := ctx.Cache.LPop(k); err == nil {
+					retVals = append(retVals, formatKeyValue(k, value, &payloads))
+				}
+			}
+
+			return parser.AppendPayloads(
+				createResponse(command, retVals, requestData.Hash),
+				payloads,
+			)
+		}
+	case "LRANGE":
+		{
+			return ctx.handleListRange(requestData)
+		}
+	case "HSET":
+		{
+			retVals := make([]string, 0, len(args))
+			for k, field := range args {
+				// The field's value takes the place of SETEX's
+				// expiration, i.e. "key:field:value".
+				value, ok := requestData.Expiration[k]
+				if !ok {
+					return "Invalid command sent in. Expected key:field:value.\n"
+				}
+
+				added, err := ctx.Cache.HSet(k, map[string]string{field: value})
+				if err != nil {
+					log.Println(err)
+					retVals = append(retVals, fmt.Sprintf("%s:ERR", k))
+					continue
+				}
+
+				retVals = append(retVals, fmt.Sprintf("%s:%d", k, added))
+			}
+
+			return createResponse(command, retVals, requestData.Hash)
+		}
+	case "HGET":
+		{
+			retVals := make([]string, 0, len(args))
+			var payloads []string
+			for k, field := range args {
+				if value, err := ctx.Cache.HGet(k, field); err == nil {
+					retVals = append(retVals, formatKeyValue(k, value, &payloads))
+				}
+			}
+
+			return parser.AppendPayloads(
+				createResponse(command, retVals, requestData.Hash),
+				payloads,
+			)
+		}
+	case "HGETALL":
+		{
+			if len(args) != 1 {
+				return "Invalid command sent in. Expected a single key.\n"
+			}
+
+			for k := range args {
+				fields, err := ctx.Cache.HGetAll(k)
+				if err != nil {
+					return fmt.Sprintf("%s:%v\n", requestData.Hash, err)
+				}
+
+				names := make([]string, 0, len(fields))
+				for field := range fields {
+					names = append(names, field)
+				}
+				sort.Strings(names)
+
+				// Each field is keyed by its position, like LRANGE's
+				// items, so field names are framed like values are:
+				// "position:field:value".
+				retVals := make([]string, 0, len(fields))
+				var payloads []string
+				for i, field := range names {
+					position := fmt.Sprintf("%d:%s", i, frameSlot(field, &payloads))
+					retVals = append(retVals, formatKeyValue(position, fields[field], &payloads))
+				}
+
+				return parser.AppendPayloads(
+					createResponse(command, retVals, requestData.Hash),
+					payloads,
+				)
+			}
+		}
+	case "LOCK":
+		{
+			retVals := make([]string, 0, len(args))
+			for k, ttlString := range args {
+				ttl, err := strconv.Atoi(ttlString)
+				if err != nil || ttl <= 0 {
+					return "Invalid command sent in. Bad lease.\n"
+				}
+
+				token, err := ctx.Cache.AcquireLock(k, ttl)
+				if err == cache.ErrLockHeld {
+					retVals = append(retVals, fmt.Sprintf("%s:HELD", k))
+					continue
+				} else if err != nil {
+					log.Println(err)
+					retVals = append(retVals, fmt.Sprintf("%s:ERR", k))
+					continue
+				}
+
+				retVals = append(retVals, fmt.Sprintf("%s:%d", k, token))
+			}
+
+			return createResponse(command, retVals, requestData.Hash)
+		}
+	case "UNLOCK":
+		{
+			retVals := make([]string, 0, len(args))
+			for k, tokenString := range args {
+				token, err := strconv.ParseUint(tokenString, 10, 64)
+				if err != nil {
+					return "Invalid command sent in. Bad token.\n"
+				}
+
+				status := "OK"
+				if err := ctx.Cache.ReleaseLock(k, token); err == cache.ErrLockNotHeld {
+					status = "NOTHELD"
+				} else if err != nil {
+					log.Println(err)
+					status = "ERR"
+				}
+
+				retVals = append(retVals, fmt.Sprintf("%s:%s", k, status))
+			}
+
+			return createResponse(command, retVals, requestData.Hash)
+		}
+	case "DEL":
+		{
+			retVals := make([]string, 0, len(args))
+			for k := range args {
+				if err := ctx.Cache.Delete(k); err == nil {
+					retVals = append(retVals, k)
+				}
+			}
+
+			return createResponse(command, retVals, requestData.Hash)
+		}
+	case "REPAIR":
+		{
+			retVals := make([]string, 0, len(args))
+			for k := range args {
+				summary, err := ctx.Cache.RepairKey(k)
+				if err != nil {
+					log.Println(err)
+					continue
+				}
+
+				retVals = append(retVals, fmt.Sprintf("%s:%d", k, len(summary.Repaired)))
+			}
+
+			return createResponse(command, retVals, requestData.Hash)
+		}
+	case "GOSSIP":
+		{
+			members, err := cache.ParseMembers(&requestData)
+			if err != nil {
+				return fmt.Sprintf("%s:%v\n", requestData.Hash, err)
+			}
+
+			var retVals []string
+			for _, member := range ctx.Cache.MergeGossip(members) {
+				retVals = append(retVals, member.Format())
+			}
+
+			return createResponse(command, retVals, requestData.Hash)
+		}
+	case "PROBE":
+		{
+			retVals := make([]string, 0, len(args))
+			for k := range args {
+				status := "FAIL"
+				if ctx.Cache.Probe(dht.UnescapeAddress(k)) {
+					status = "OK"
+				}
+				retVals = append(retVals, fmt.Sprintf("%s:%s", k, status))
+			}
+
+			return createResponse(command, retVals, requestData.Hash)
+		}
+	case "BLOOMADD":
+		{
+			retVals := make([]string, 0, len(args))
+			for address, encoded := range args {
+				indices, err := cache.ParseBloomDelta(encoded)
+				if err != nil {
+					return fmt.Sprintf("%s:%v\n", requestData.Hash, err)
+				}
+
+				status := "UNKNOWN"
+				if ctx.Cache.ApplyBloomDelta(dht.UnescapeAddress(address), indices) {
+					status = "OK"
+				}
+				retVals = append(retVals, fmt.Sprintf("%s:%s", address, status))
+			}
+
+			return createResponse(command, retVals, requestData.Hash)
+		}
+	case "MIGRATE":
+		{
+			if len(args) != 1 {
+				return "Invalid command sent in. Expected a single pattern:destination.\n"
+			}
+
+			for pattern, destination := range args {
+				moved, err := ctx.Cache.Migrate(pattern, dht.UnescapeAddress(destination))
+				if err != nil {
+					return fmt.Sprintf("%s:%v\n", requestData.Hash, err)
+				}
+
+				return createResponse(command, moved, requestData.Hash)
+			}
+		}
+	case "RANGE":
+		{
+			return ctx.handleRange(requestData)
+		}
+	case "SELECT":
+		{
+			if len(args) != 1 {
+				return "Invalid command sent in. Expected a single namespace.\n"
+			}
+
+			for name := range args {
+				namespace, err := ctx.Cache.Namespace(name)
+				if err != nil {
+					return fmt.Sprintf("%s:%v\n", requestData.Hash, err)
+				}
+				ctx.Cache = namespace
+
+				return createResponse(command, []string{name}, requestData.Hash)
+			}
+		}
+	case "SCAN":
+		{
+			return ctx.handleScan(requestData)
+		}
+	case "BGET":
+		{
+			return ctx.handleBlockingGet(requestData)
+		}
+	case "PUBLISH", "RELAY":
+		{
+			return ctx.handlePublish(requestData)
 		}
 	case "REQUEST":
 		{
@@ -87,17 +655,113 @@ func (ctx *ConnectionCtx) ExecuteCommand(requestData parser.CommandData) string
 		{
 			return "0:PONG 1\n"
 		}
+	case "SAVE":
+		{
+			if err := ctx.Cache.Snapshot(); err != nil {
+				return fmt.Sprintf("%s:%v\n", requestData.Hash, err)
+			}
+
+			return createResponse(command, []string{"OK"}, requestData.Hash)
+		}
+	case "STATS":
+		{
+			return createResponse(
+				command,
+				formatStats(ctx.Cache.Stats()),
+				requestData.Hash,
+			)
+		}
+	case "BGSAVE":
+		{
+			lastSaved, err := ctx.Cache.BackgroundSnapshot()
+			if err != nil {
+				return fmt.Sprintf("%s:%v\n", requestData.Hash, err)
+			}
+
+			// The unix timestamp of the previous snapshot, zero if there's
+			// none, so callers can tell when this one has landed.
+			timestamp := int64(0)
+			if !lastSaved.IsZero() {
+				timestamp = lastSaved.Unix()
+			}
+
+			return createResponse(
+				command,
+				[]string{strconv.FormatInt(timestamp, 10)},
+				requestData.Hash,
+			)
+		}
 	}
 
 	return "[]Invalid command sent in.\n"
 }
 
+// formatKeyValue formats a `key:value` response argument. Values which aren't
+// safe to send as text are framed, with their payload appended to `payloads`.
+func formatKeyValue(key string, value string, payloads *[]string) string {
+	return fmt.Sprintf("%s:%s", key, frameSlot(value, payloads))
+}
+
+// frameSlot returns the token standing in for `value` in a response,
+// appending its payload to `payloads` if it has to be framed.
+func frameSlot(value string, payloads *[]string) string {
+	token, payload, framed := parser.FrameValue(value)
+	if framed {
+		*payloads = append(*payloads, payload)
+	}
+
+	return token
+}
+
 func createResponse(command string, retVals []string, hash string) string {
 	CommandMap := make(map[string]string)
 	CommandMap["GET"] = "GOT "
+	CommandMap["MGET"] = "GOT "
+	CommandMap["BGET"] = "GOT "
 	CommandMap["SET"] = "SAT "
 	CommandMap["SETEX"] = "SATEX "
+	CommandMap["SETNX"] = "SATNX "
+	CommandMap["LOCK"] = "LOCKED "
+	CommandMap["LPUSH"] = "LPUSHED "
+	CommandMap["RPUSH"] = "RPUSHED "
+	CommandMap["LPOP"] = "LPOPPED "
+	CommandMap["LRANGE"] = "LRANGED "
+	CommandMap["HSET"] = "HSAT "
+	CommandMap["HGET"] = "HGOT "
+	CommandMap["HGETALL"] = "HGOT "
+	CommandMap["UNLOCK"] = "UNLOCKED "
+	CommandMap["MSET"] = "MSAT "
+	CommandMap["REPLICATE"] = "REPLICATED "
+	CommandMap["REPLICATELIST"] = "REPLICATED "
+	CommandMap["REPLICATEHASH"] = "REPLICATED "
+	CommandMap["TOMBSTONE"] = "TOMBSTONED "
+	CommandMap["VGET"] = "VGOT "
+	CommandMap["MEMORY"] = "MEASURED "
+	CommandMap["DEL"] = "DELETED "
+	CommandMap["INCR"] = "INCREMENTED "
+	CommandMap["DECR"] = "DECREMENTED "
+	CommandMap["CAS"] = "SWAPPED "
 	CommandMap["REQUEST"] = "FULFILLED "
+	CommandMap["RANGE"] = "RANGED "
+	CommandMap["REPAIR"] = "REPAIRED "
+	CommandMap["GOSSIP"] = "GOSSIPED "
+	CommandMap["PROBE"] = "PROBED "
+	CommandMap["MIGRATE"] = "MIGRATED "
+	CommandMap["BLOOMADD"] = "BLOOMADDED "
+	CommandMap["SAVE"] = "SAVED "
+	CommandMap["BGSAVE"] = "BGSAVING "
+	CommandMap["STATS"] = "COUNTED "
+	CommandMap["TTL"] = "TTL "
+	CommandMap["EXPIRE"] = "EXPIRING "
+	CommandMap["PERSIST"] = "PERSISTED "
+	CommandMap["SCAN"] = "SCANNED "
+	CommandMap["SELECT"] = "SELECTED "
+	CommandMap["WATCH"] = "WATCHING "
+	CommandMap["UNWATCH"] = "UNWATCHED "
+	CommandMap["SUBSCRIBE"] = "SUBSCRIBED "
+	CommandMap["UNSUBSCRIBE"] = "UNSUBSCRIBED "
+	CommandMap["PUBLISH"] = "PUBLISHED "
+	CommandMap["RELAY"] = "RELAYED "
 
 	var buffer bytes.Buffer
 	buffer.WriteString(hash)
@@ -127,22 +791,73 @@ func (ctx *ConnectionCtx) handleRequest(requestData parser.CommandData) string {
 	switch strings.ToUpper(requestItem) {
 	case "BLOOMFILTER":
 		{
-			bfString := ctx.Cache.GetBloomFilter().Serialize()
+			// "BLOOMFILTER:<partition>" requests a single partition's
+			// filter.
+			if partitionString := requestData.Args[requestItem]; partitionString != "" {
+				return ctx.handlePartitionRequest(requestData, partitionString)
+			}
+
+			bfString := ctx.Cache.SerializeForPeers(ctx.Cache.GetBloomFilter())
 			return createResponse(
 				requestData.Command,
 				[]string{bfString},
 				requestData.Hash,
 			)
 		}
+	case "CUCKOOFILTER":
+		{
+			cfString, err := ctx.Cache.SerializedCuckooFilter()
+			if err != nil {
+				return fmt.Sprintf("%s:%v\n", requestData.Hash, err)
+			}
+
+			return createResponse(
+				requestData.Command,
+				[]string{cfString},
+				requestData.Hash,
+			)
+		}
 	case "CONNECT":
 		{
 			ctx.Cache.AddPeer((*requestData.Conn).RemoteAddr().String())
 			return createResponse(
 				requestData.Command,
-				[]string{ctx.Cache.GetBloomFilter().Serialize()},
+				[]string{ctx.Cache.SerializeForPeers(ctx.Cache.GetBloomFilter())},
 				"",
 			)
 		}
+	case "BLOOMSTATS":
+		{
+			// The fill is worked out from the same snapshot, so it
+			// matches the counts it's answered alongside.
+			_, size, setBits := ctx.Cache.BloomSnapshot()
+			fill := 0.0
+			if size > 0 {
+				fill = float64(setBits) / float64(size)
+			}
+
+			return createResponse(
+				requestData.Command,
+				[]string{
+					fmt.Sprintf("size:%d", size),
+					fmt.Sprintf("set:%d", setBits),
+					fmt.Sprintf("fill:%.4f", fill),
+				},
+				requestData.Hash,
+			)
+		}
+	case "PEERSTATS":
+		{
+			var retVals []string
+			for _, info := range ctx.Cache.PeerInfo() {
+				retVals = append(retVals, formatPeerInfo(info))
+			}
+			return createResponse(
+				requestData.Command,
+				retVals,
+				requestData.Hash,
+			)
+		}
 	case "PEERS":
 		{
 			return ctx.Cache.ListPeers(requestData.Hash)
@@ -151,7 +866,250 @@ func (ctx *ConnectionCtx) handleRequest(requestData parser.CommandData) string {
 		{
 			return ctx.Cache.DisconnectPeer((*requestData.Conn).RemoteAddr().String())
 		}
+	case "CONFIG":
+		{
+			return createResponse(
+				requestData.Command,
+				formatConfig(ctx.Cache.EffectiveConfig()),
+				requestData.Hash,
+			)
+		}
+	}
+
+	return "Invalid command sent in.\n"
+}
+
+// formatPeerInfo formats a peer's metrics for a PEERSTATS response. The
+// metrics are `name=value` pairs, as the peer's IPPort already has a colon.
+func formatPeerInfo(info dht.PeerInfo) string {
+	return fmt.Sprintf(
+		"%s sent=%d received=%d requests=%d errors=%d reconnects=%d",
+		info.IPPort,
+		info.Metrics.BytesSent,
+		info.Metrics.BytesReceived,
+		info.Metrics.Requests,
+		info.Metrics.Errors,
+		info.Metrics.Reconnects,
+	)
+}
+
+// formatStats formats the cache's counters for a STATS response as `name:value`
+// pairs.
+func formatStats(stats cache.Stats) []string {
+	return []string{
+		fmt.Sprintf("hits:%d", stats.Hits),
+		fmt.Sprintf("misses:%d", stats.Misses),
+		fmt.Sprintf("sets:%d", stats.Sets),
+		fmt.Sprintf("expired:%d", stats.Expirations),
+		fmt.Sprintf("evicted:%d", stats.LRUEvictions),
+		fmt.Sprintf("remotefetches:%d", stats.RemoteFetches),
+		fmt.Sprintf("keys:%d", stats.Keys),
+		fmt.Sprintf("bloombits:%d", stats.BloomfilterSetBits),
+		fmt.Sprintf("bloomkeys:%d", stats.BloomfilterEstimatedKeys),
+		fmt.Sprintf("bloomfprate:%.6f", stats.BloomfilterFPRate),
+	}
+}
+
+// formatConfig formats every field of a config as a `Name=value` pair, in the
+// order they're declared.
+func formatConfig(cfg config.Cfg) []string {
+	value := reflect.ValueOf(cfg)
+	fields := make([]string, value.NumField())
+	for i := range fields {
+		fields[i] = fmt.Sprintf("%s=%v", value.Type().Field(i).Name, value.Field(i).Interface())
+	}
+
+	return fields
+}
+
+// handlePartitionRequest answers a request for a single partition's bloom
+// filter.
+func (ctx *ConnectionCtx) handlePartitionRequest(requestData parser.CommandData, partitionString string) string {
+	partition, err := strconv.Atoi(partitionString)
+	if err != nil {
+		return "Invalid command sent in. Bad partition.\n"
+	}
+
+	bf, err := ctx.Cache.GetPartitionBloomFilter(partition)
+	if err != nil {
+		return fmt.Sprintf("%s:%v\n", requestData.Hash, err)
+	}
+
+	return createResponse(
+		requestData.Command,
+		[]string{ctx.Cache.SerializeForPeers(bf)},
+		requestData.Hash,
+	)
+}
+
+// handleRange answers `RANGE start:end` with the keys whose hash falls in
+// [start, end), as `key:hash` pairs ordered by hash. At most MaxRangeKeys are
+// sent: a full page means the caller should ask again, starting after the
+// last hash it received.
+func (ctx *ConnectionCtx) handleRange(requestData parser.CommandData) string {
+	if len(requestData.Args) != 1 {
+		return "Invalid command sent in. Expected a single start:end.\n"
+	}
+
+	var start, end uint64
+	for startString, endString := range requestData.Args {
+		var startErr, endErr error
+		start, startErr = strconv.ParseUint(startString, 10, 64)
+		end, endErr = strconv.ParseUint(endString, 10, 64)
+		if startErr != nil || endErr != nil {
+			return "Invalid command sent in. Bad hash range.\n"
+		}
+	}
+
+	keys := cache.PageKeys(
+		ctx.Cache.KeysInRange(start, end),
+		ctx.Cache.MaxRangeKeys(),
+	)
+
+	retVals := make([]string, len(keys))
+	for i, key := range keys {
+		retVals[i] = fmt.Sprintf("%s:%d", key, dht.KeyHash(key))
+	}
+
+	return createResponse(
+		requestData.Command,
+		retVals,
+		requestData.Hash,
+	)
+}
+
+// handlePublish answers `PUBLISH channel:message` with how many of this
+// node's subscribers received the message; it's relayed to every peer, which
+// deliver it to their own with RELAY.
+func (ctx *ConnectionCtx) handlePublish(requestData parser.CommandData) string {
+	if len(requestData.Args) != 1 {
+		return "Invalid command sent in. Expected a single channel:message.\n"
+	}
+
+	for channel, message := range requestData.Args {
+		if strings.ToUpper(requestData.Command) == "RELAY" {
+			received := ctx.Cache.Relay(channel, message)
+			return createResponse("RELAY", []string{strconv.Itoa(received)}, requestData.Hash)
+		}
+
+		received, err := ctx.Cache.Publish(channel, message)
+		if err != nil {
+			return fmt.Sprintf("%s:%v\n", requestData.Hash, err)
+		}
+
+		return createResponse("PUBLISH", []string{strconv.Itoa(received)}, requestData.Hash)
 	}
 
 	return "Invalid command sent in.\n"
 }
+
+// handleBlockingGet answers `BGET key:timeout`, waiting up to `timeout`
+// seconds for the key to be set if it isn't already. Like GET, it answers
+// with nothing if the key never turns up.
+func (ctx *ConnectionCtx) handleBlockingGet(requestData parser.CommandData) string {
+	if len(requestData.Args) != 1 {
+		return "Invalid command sent in. Expected a single key:timeout.\n"
+	}
+
+	for key, timeoutString := range requestData.Args {
+		timeout, err := strconv.Atoi(timeoutString)
+		if err != nil || timeout <= 0 {
+			return "Invalid command sent in. Bad timeout.\n"
+		}
+
+		waitCtx, cancel := context.WithTimeout(
+			context.Background(),
+			time.Duration(timeout)*time.Second,
+		)
+		defer cancel()
+
+		var retVals []string
+		var payloads []string
+		if value, err := ctx.Cache.BlockingGet(waitCtx, key); err == nil {
+			retVals = append(retVals, formatKeyValue(key, value, &payloads))
+		}
+
+		return parser.AppendPayloads(
+			createResponse("BGET", retVals, requestData.Hash),
+			payloads,
+		)
+	}
+
+	return "Invalid command sent in.\n"
+}
+
+// handleListRange answers `LRANGE key:start:stop` with the list's items from
+// `start` to `stop`, inclusive, each keyed by its position in the range so
+// they can be put back in order (e.g., "LRANGED 0:first,1:second").
+func (ctx *ConnectionCtx) handleListRange(requestData parser.CommandData) string {
+	if len(requestData.Args) != 1 {
+		return "Invalid command sent in. Expected a single key:start:stop.\n"
+	}
+
+	for key, startString := range requestData.Args {
+		start, err := strconv.Atoi(startString)
+		if err != nil {
+			return "Invalid command sent in. Bad start.\n"
+		}
+		stop, err := strconv.Atoi(requestData.Expiration[key])
+		if err != nil {
+			return "Invalid command sent in. Bad stop.\n"
+		}
+
+		items, err := ctx.Cache.LRange(key, start, stop)
+		if err != nil {
+			return fmt.Sprintf("%s:%v\n", requestData.Hash, err)
+		}
+
+		retVals := make([]string, 0, len(items))
+		var payloads []string
+		for i, item := range items {
+			retVals = append(retVals, formatKeyValue(strconv.Itoa(i), item, &payloads))
+		}
+
+		return parser.AppendPayloads(
+			createResponse("LRANGE", retVals, requestData.Hash),
+			payloads,
+		)
+	}
+
+	return "Invalid command sent in.\n"
+}
+
+// handleScan answers a SCAN of "cursor:pattern", optionally followed by how
+// many keys to aim for, i.e. "cursor:pattern:count". The response starts with
+// the cursor to continue from, zero once the scan is done, followed by the
+// matching keys.
+func (ctx *ConnectionCtx) handleScan(requestData parser.CommandData) string {
+	if len(requestData.Args) != 1 {
+		return "Invalid command sent in. Expected a single cursor:pattern.\n"
+	}
+
+	var cursor uint64
+	var pattern string
+	count := 0
+	for cursorString, patternString := range requestData.Args {
+		var err error
+		if cursor, err = strconv.ParseUint(cursorString, 10, 64); err != nil {
+			return "Invalid command sent in. Bad cursor.\n"
+		}
+		pattern = patternString
+
+		if countString, ok := requestData.Expiration[cursorString]; ok {
+			if count, err = strconv.Atoi(countString); err != nil {
+				return "Invalid command sent in. Bad count.\n"
+			}
+		}
+	}
+
+	keys, next, err := ctx.Cache.Scan(cursor, pattern, count)
+	if err != nil {
+		return fmt.Sprintf("%s:%v\n", requestData.Hash, err)
+	}
+
+	return createResponse(
+		requestData.Command,
+		append([]string{strconv.FormatUint(next, 10)}, keys...),
+		requestData.Hash,
+	)
+}
@@ -1,10 +1,17 @@
 package incomingNetwork
 
 import (
+	"fmt"
 	"github.com/GrappigPanda/Olivia/bloomfilter"
 	"github.com/GrappigPanda/Olivia/cache"
+	"github.com/GrappigPanda/Olivia/dht"
 	"github.com/GrappigPanda/Olivia/parser"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 var CTX = &ConnectionCtx{
@@ -19,7 +26,7 @@ func TestExecuteGetAllSucceed(t *testing.T) {
 	CTX.Cache.Set("key1", "test1")
 	CTX.Cache.Set("key2", "test14")
 
-	command := parser.CommandData{"hash", "GET", map[string]string{"key1": "", "key2": ""}, make(map[string]string), nil}
+	command := parser.CommandData{"hash", "GET", map[string]string{"key1": "", "key2": ""}, make(map[string]string), make(map[string]string), nil}
 	result := CTX.ExecuteCommand(command)
 
 	if expectedReturn != result {
@@ -36,7 +43,7 @@ func TestExecuteGetAllSkipNonexistingKey(t *testing.T) {
 	CTX.Cache.Set("key1", "test1")
 	CTX.Cache.Set("key2", "test14")
 
-	command := parser.CommandData{"hash", "GET", map[string]string{"key1": "", "key2": ""}, make(map[string]string), nil}
+	command := parser.CommandData{"hash", "GET", map[string]string{"key1": "", "key2": ""}, make(map[string]string), make(map[string]string), nil}
 	result := CTX.ExecuteCommand(command)
 
 	if expectedReturn != result {
@@ -50,7 +57,7 @@ func TestExecuteSetKey(t *testing.T) {
 	expectedReturn := "hash:SAT key4:test4,key7:test126654\n"
 	expectedReturn2 := "hash:SAT key7:test126654,key4:test4\n"
 
-	command := parser.CommandData{"hash", "SET", map[string]string{"key4": "test4", "key7": "test126654"}, make(map[string]string), nil}
+	command := parser.CommandData{"hash", "SET", map[string]string{"key4": "test4", "key7": "test126654"}, make(map[string]string), make(map[string]string), nil}
 	result := CTX.ExecuteCommand(command)
 
 	if expectedReturn != result {
@@ -64,7 +71,7 @@ func TestExecuteSetKeyWithExpiration(t *testing.T) {
 	expectedReturn := "hash:SATEX key1:test1:30,key2:test2:30\n"
 	expectedReturn2 := "hash:SATEX key2:test2:30,key1:test1:30\n"
 
-	command := parser.CommandData{"hash", "SETEX", map[string]string{"key1": "test1", "key2": "test2"}, map[string]string{"key1": "30", "key2": "30"}, nil}
+	command := parser.CommandData{"hash", "SETEX", map[string]string{"key1": "test1", "key2": "test2"}, map[string]string{"key1": "30", "key2": "30"}, make(map[string]string), nil}
 	result := CTX.ExecuteCommand(command)
 
 	if expectedReturn != result {
@@ -95,7 +102,7 @@ func TestRequestBloomFilter(t *testing.T) {
 		testCache,
 	}
 
-	command := parser.CommandData{"hash", "REQUEST", map[string]string{"bloomfilter": ""}, make(map[string]string), nil}
+	command := parser.CommandData{"hash", "REQUEST", map[string]string{"bloomfilter": ""}, make(map[string]string), make(map[string]string), nil}
 	newBfStr := ctx.ExecuteCommand(command)
 	if newBfStr == "Invalid command sent in.\n" {
 		t.Fatalf("Sending in a bad command :(")
@@ -123,3 +130,877 @@ func TestRequestBloomFilter(t *testing.T) {
 		t.Fatalf("Two bfs are not equal")
 	}
 }
+
+func TestExecuteReplicateFlagsFailedEntry(t *testing.T) {
+	testConfig := *CONFIG
+	testConfig.IsTesting = true
+	testConfig.MaxValueBytes = 8
+
+	ctx := &ConnectionCtx{
+		nil,
+		cache.NewCache(nil, &testConfig),
+	}
+
+	expectedReturn := "hash:REPLICATED key1:OK,key2:ERR\n"
+	expectedReturn2 := "hash:REPLICATED key2:ERR,key1:OK\n"
+
+	command := parser.CommandData{"hash", "REPLICATE", map[string]string{"key1": "test1", "key2": "waytoolongvalue"}, make(map[string]string), make(map[string]string), nil}
+	result := ctx.ExecuteCommand(command)
+
+	if expectedReturn != result {
+		if result != expectedReturn2 {
+			t.Fatalf("Expected [%s] or [%s], got [%s]", expectedReturn, expectedReturn2, result)
+		}
+	}
+
+	if _, err := ctx.Cache.Get("key2"); err == nil {
+		t.Fatalf("Expected key2 to not be replicated")
+	}
+}
+
+func TestExecuteTombstoneDeletesKeys(t *testing.T) {
+	testConfig := *CONFIG
+	testConfig.IsTesting = true
+
+	ctx := &ConnectionCtx{
+		nil,
+		cache.NewCache(nil, &testConfig),
+	}
+	ctx.Cache.ApplyReplicationBatch([]cache.ReplicationEntry{{Key: "key1", Value: "test1", Version: 10}})
+
+	expectedReturn := "hash:TOMBSTONED key1:OK\n"
+
+	command := parser.CommandData{"hash", "TOMBSTONE", map[string]string{"key1": "20"}, make(map[string]string), make(map[string]string), nil}
+	result := ctx.ExecuteCommand(command)
+
+	if expectedReturn != result {
+		t.Fatalf("Expected [%s], got [%s]", expectedReturn, result)
+	}
+
+	if _, err := ctx.Cache.Get("key1"); err == nil {
+		t.Fatalf("Expected key1 to be deleted")
+	}
+}
+
+func TestExecuteVGetAnswersVersions(t *testing.T) {
+	testConfig := *CONFIG
+	testConfig.IsTesting = true
+
+	ctx := &ConnectionCtx{
+		nil,
+		cache.NewCache(nil, &testConfig),
+	}
+	ctx.Cache.ApplyReplicationBatch([]cache.ReplicationEntry{{Key: "key1", Value: "test1", Version: 10}})
+
+	expectedReturn := "hash:VGOT key1:test1:0:10\n"
+
+	command := parser.CommandData{"hash", "VGET", map[string]string{"key1": "", "key2": ""}, make(map[string]string), make(map[string]string), nil}
+	result := ctx.ExecuteCommand(command)
+
+	if expectedReturn != result {
+		t.Fatalf("Expected [%s], got [%s]", expectedReturn, result)
+	}
+}
+
+func TestExecuteReplicateListStoresLists(t *testing.T) {
+	testConfig := *CONFIG
+	testConfig.IsTesting = true
+
+	ctx := &ConnectionCtx{
+		nil,
+		cache.NewCache(nil, &testConfig),
+	}
+
+	expectedReturn := "hash:REPLICATED list:OK\n"
+
+	command := parser.CommandData{"hash", "REPLICATELIST", map[string]string{"list": "1:a3:b c"}, make(map[string]string), make(map[string]string), nil}
+	result := ctx.ExecuteCommand(command)
+
+	if expectedReturn != result {
+		t.Fatalf("Expected [%s], got [%s]", expectedReturn, result)
+	}
+
+	items, err := ctx.Cache.LRange("list", 0, -1)
+	if err != nil || len(items) != 2 || items[0] != "a" || items[1] != "b c" {
+		t.Fatalf("Expected %v, got %v (%v)", []string{"a", "b c"}, items, err)
+	}
+}
+
+func TestExecuteSetWritesNothingOnAnOversizeValue(t *testing.T) {
+	testConfig := *CONFIG
+	testConfig.IsTesting = true
+	testConfig.MaxValueBytes = 8
+
+	ctx := &ConnectionCtx{
+		nil,
+		cache.NewCache(nil, &testConfig),
+	}
+
+	expectedReturn := "hash:Invalid entry key2: Value exceeds the maximum value size\n"
+
+	command := parser.CommandData{"hash", "SET", map[string]string{"key1": "test1", "key2": "waytoolongvalue"}, make(map[string]string), make(map[string]string), nil}
+	result := ctx.ExecuteCommand(command)
+
+	if expectedReturn != result {
+		t.Fatalf("Expected [%s], got [%s]", expectedReturn, result)
+	}
+
+	if _, err := ctx.Cache.Get("key1"); err == nil {
+		t.Fatalf("Expected key1 to not be set")
+	}
+}
+
+func TestExecuteMsetFlagsFailedEntry(t *testing.T) {
+	testConfig := *CONFIG
+	testConfig.IsTesting = true
+	testConfig.MaxValueBytes = 8
+
+	ctx := &ConnectionCtx{
+		nil,
+		cache.NewCache(nil, &testConfig),
+	}
+
+	expectedReturn := "hash:MSAT key1:OK,key2:ERR\n"
+	expectedReturn2 := "hash:MSAT key2:ERR,key1:OK\n"
+
+	command := parser.CommandData{"hash", "MSET", map[string]string{"key1": "test1", "key2": "waytoolongvalue"}, make(map[string]string), make(map[string]string), nil}
+	result := ctx.ExecuteCommand(command)
+
+	if expectedReturn != result && expectedReturn2 != result {
+		t.Fatalf("Expected [%s] or [%s], got [%s]", expectedReturn, expectedReturn2, result)
+	}
+
+	if value, err := ctx.Cache.Get("key1"); err != nil || value != "test1" {
+		t.Fatalf("Expected key1 to be set, got %v (%v)", value, err)
+	}
+}
+
+func TestExecuteMemorySkipsMissingKey(t *testing.T) {
+	CTX.Cache.Set("key1", "test1")
+	usage, _ := CTX.Cache.MemoryUsage("key1")
+
+	expectedReturn := fmt.Sprintf("hash:MEASURED key1:%d\n", usage)
+
+	command := parser.CommandData{"hash", "MEMORY", map[string]string{"key1": "", "missing": ""}, make(map[string]string), make(map[string]string), nil}
+	result := CTX.ExecuteCommand(command)
+
+	if expectedReturn != result {
+		t.Fatalf("Expected [%s], got [%s]", expectedReturn, result)
+	}
+}
+
+func TestExecuteTTL(t *testing.T) {
+	CTX.Cache.Set("ttlforever", "test1")
+	CTX.Cache.SetExpiration("ttlexpiring", "test1", 30)
+
+	for key, expectedReturn := range map[string]string{
+		"ttlforever":  "hash:TTL ttlforever:-1\n",
+		"ttlexpiring": "hash:TTL ttlexpiring:30\n",
+		"missing":     "hash:TTL \n",
+	} {
+		command := parser.CommandData{"hash", "TTL", map[string]string{key: ""}, make(map[string]string), make(map[string]string), nil}
+		result := CTX.ExecuteCommand(command)
+
+		if expectedReturn != result {
+			t.Fatalf("Expected [%s], got [%s]", expectedReturn, result)
+		}
+	}
+}
+
+func TestExecuteExpireAndPersist(t *testing.T) {
+	CTX.Cache.Set("toexpire", "test1")
+
+	command := parser.CommandData{"hash", "EXPIRE", map[string]string{"toexpire": "45", "missing": "45"}, make(map[string]string), make(map[string]string), nil}
+	if result := CTX.ExecuteCommand(command); result != "hash:EXPIRING toexpire\n" {
+		t.Fatalf("Expected [%s], got [%s]", "hash:EXPIRING toexpire\n", result)
+	}
+	if ttl, _ := CTX.Cache.GetTTL("toexpire"); ttl != 45 {
+		t.Fatalf("Expected %v, got %v", 45, ttl)
+	}
+
+	command = parser.CommandData{"hash", "EXPIRE", map[string]string{"toexpire": "soon"}, make(map[string]string), make(map[string]string), nil}
+	if result := CTX.ExecuteCommand(command); result != "Invalid command sent in. Bad expiration.\n" {
+		t.Fatalf("Expected a bad expiration to be refused, got [%s]", result)
+	}
+
+	command = parser.CommandData{"hash", "PERSIST", map[string]string{"toexpire": "", "missing": ""}, make(map[string]string), make(map[string]string), nil}
+	if result := CTX.ExecuteCommand(command); result != "hash:PERSISTED toexpire\n" {
+		t.Fatalf("Expected [%s], got [%s]", "hash:PERSISTED toexpire\n", result)
+	}
+	if ttl, _ := CTX.Cache.GetTTL("toexpire"); ttl != cache.NoExpiration {
+		t.Fatalf("Expected %v, got %v", cache.NoExpiration, ttl)
+	}
+}
+
+func TestExecuteScan(t *testing.T) {
+	testConfig := *CONFIG
+	testConfig.IsTesting = true
+	ctx := &ConnectionCtx{nil, cache.NewCache(nil, &testConfig)}
+	ctx.Cache.Set("scanned", "test1")
+	ctx.Cache.Set("skipped", "test1")
+
+	command := parser.CommandData{"hash", "SCAN", map[string]string{"0": "scan*"}, map[string]string{"0": "1000"}, make(map[string]string), nil}
+	if result := ctx.ExecuteCommand(command); result != "hash:SCANNED 0,scanned\n" {
+		t.Fatalf("Expected [%s], got [%s]", "hash:SCANNED 0,scanned\n", result)
+	}
+
+	command = parser.CommandData{"hash", "SCAN", map[string]string{"0": "scan["}, make(map[string]string), make(map[string]string), nil}
+	if result := ctx.ExecuteCommand(command); !strings.HasPrefix(result, "hash:Invalid pattern") {
+		t.Fatalf("Expected a malformed pattern to be refused, got [%s]", result)
+	}
+
+	command = parser.CommandData{"hash", "SCAN", map[string]string{"next": "*"}, make(map[string]string), make(map[string]string), nil}
+	if result := ctx.ExecuteCommand(command); result != "Invalid command sent in. Bad cursor.\n" {
+		t.Fatalf("Expected a bad cursor to be refused, got [%s]", result)
+	}
+}
+
+func TestExecuteSelect(t *testing.T) {
+	testConfig := *CONFIG
+	testConfig.IsTesting = true
+	testConfig.MaxNamespaces = 1
+	ctx := &ConnectionCtx{nil, cache.NewCache(nil, &testConfig)}
+	root := ctx.Cache
+	root.Set("key", "default")
+
+	command := parser.CommandData{"hash", "SELECT", map[string]string{"app": ""}, make(map[string]string), make(map[string]string), nil}
+	if result := ctx.ExecuteCommand(command); result != "hash:SELECTED app\n" {
+		t.Fatalf("Expected [%s], got [%s]", "hash:SELECTED app\n", result)
+	}
+
+	command = parser.CommandData{"hash", "GET", map[string]string{"key": ""}, make(map[string]string), make(map[string]string), nil}
+	if result := ctx.ExecuteCommand(command); result != "hash:GOT \n" {
+		t.Fatalf("Expected the default keyspace's key to be out of reach, got [%s]", result)
+	}
+
+	command = parser.CommandData{"hash", "SELECT", map[string]string{"other": ""}, make(map[string]string), make(map[string]string), nil}
+	if result := ctx.ExecuteCommand(command); !strings.HasPrefix(result, "hash:Can't open namespace") {
+		t.Fatalf("Expected opening past MaxNamespaces to fail, got [%s]", result)
+	}
+
+	command = parser.CommandData{"hash", "SELECT", map[string]string{cache.DefaultNamespace: ""}, make(map[string]string), make(map[string]string), nil}
+	ctx.ExecuteCommand(command)
+	if ctx.Cache != root {
+		t.Fatalf("Expected selecting %v to return to the default keyspace", cache.DefaultNamespace)
+	}
+}
+
+func TestExecuteDelSkipsMissingKey(t *testing.T) {
+	CTX.Cache.Set("deleted", "test1")
+
+	expectedReturn := "hash:DELETED deleted\n"
+
+	command := parser.CommandData{"hash", "DEL", map[string]string{"deleted": "", "missing": ""}, make(map[string]string), make(map[string]string), nil}
+	result := CTX.ExecuteCommand(command)
+
+	if expectedReturn != result {
+		t.Fatalf("Expected [%s], got [%s]", expectedReturn, result)
+	}
+
+	if _, err := CTX.Cache.Get("deleted"); err == nil {
+		t.Fatalf("Expected the key to be deleted")
+	}
+
+	if hasKey, _ := CTX.Cache.GetBloomFilter().HasKey([]byte("deleted")); hasKey {
+		t.Fatalf("Expected the key to be taken out of the bloom filter")
+	}
+}
+
+func TestExecuteIncrAndDecr(t *testing.T) {
+	ctx := &ConnectionCtx{
+		nil,
+		cache.NewCache(nil, CONFIG),
+	}
+	ctx.Cache.Set("text", "value")
+
+	expectedReturn := "hash:INCREMENTED counter:5\n"
+	command := parser.CommandData{"hash", "INCR", map[string]string{"counter": "5"}, make(map[string]string), make(map[string]string), nil}
+	if result := ctx.ExecuteCommand(command); result != expectedReturn {
+		t.Fatalf("Expected [%s], got [%s]", expectedReturn, result)
+	}
+
+	expectedReturn = "hash:DECREMENTED counter:4\n"
+	command = parser.CommandData{"hash", "DECR", map[string]string{"counter": ""}, make(map[string]string), make(map[string]string), nil}
+	if result := ctx.ExecuteCommand(command); result != expectedReturn {
+		t.Fatalf("Expected [%s], got [%s]", expectedReturn, result)
+	}
+
+	expectedReturn = "hash:INCREMENTED text:ERR\n"
+	command = parser.CommandData{"hash", "INCR", map[string]string{"text": ""}, make(map[string]string), make(map[string]string), nil}
+	if result := ctx.ExecuteCommand(command); result != expectedReturn {
+		t.Fatalf("Expected [%s], got [%s]", expectedReturn, result)
+	}
+}
+
+func TestExecuteCas(t *testing.T) {
+	ctx := &ConnectionCtx{
+		nil,
+		cache.NewCache(nil, CONFIG),
+	}
+	ctx.Cache.Set("key1", "old")
+
+	expectedReturn := "hash:SWAPPED key1:MISMATCH\n"
+	command := parser.CommandData{"hash", "CAS", map[string]string{"key1": "other"}, map[string]string{"key1": "new"}, make(map[string]string), nil}
+	if result := ctx.ExecuteCommand(command); result != expectedReturn {
+		t.Fatalf("Expected [%s], got [%s]", expectedReturn, result)
+	}
+
+	expectedReturn = "hash:SWAPPED key1:OK\n"
+	command = parser.CommandData{"hash", "CAS", map[string]string{"key1": "old"}, map[string]string{"key1": "new"}, make(map[string]string), nil}
+	if result := ctx.ExecuteCommand(command); result != expectedReturn {
+		t.Fatalf("Expected [%s], got [%s]", expectedReturn, result)
+	}
+
+	if value, _ := ctx.Cache.Get("key1"); value != "new" {
+		t.Fatalf("Expected new, got %v", value)
+	}
+}
+
+func TestExecuteCasFramedValues(t *testing.T) {
+	ctx := &ConnectionCtx{
+		parser.NewParser(nil),
+		cache.NewCache(nil, CONFIG),
+	}
+	ctx.Cache.Set("key1", "old: value")
+
+	command, err := ctx.Parser.Parse("hash:CAS key1:$10:$14\nold: value\nnew:value,here\n", nil)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	expectedReturn := "hash:SWAPPED key1:OK\n"
+	if result := ctx.ExecuteCommand(*command); result != expectedReturn {
+		t.Fatalf("Expected [%s], got [%s]", expectedReturn, result)
+	}
+
+	if value, _ := ctx.Cache.Get("key1"); value != "new:value,here" {
+		t.Fatalf("Expected %v, got %v", "new:value,here", value)
+	}
+}
+
+func TestExecuteMgetSkipsMissingKey(t *testing.T) {
+	CTX.Cache.Set("mget1", "test1")
+
+	expectedReturn := "hash:GOT mget1:test1\n"
+
+	command := parser.CommandData{"hash", "MGET", map[string]string{"mget1": "", "missing": ""}, make(map[string]string), make(map[string]string), nil}
+	result := CTX.ExecuteCommand(command)
+
+	if expectedReturn != result {
+		t.Fatalf("Expected [%s], got [%s]", expectedReturn, result)
+	}
+}
+
+func TestRequestPartitionBloomFilter(t *testing.T) {
+	testConfig := *CONFIG
+	testConfig.BloomfilterPartitions = 4
+
+	ctx := &ConnectionCtx{
+		nil,
+		cache.NewCache(nil, &testConfig),
+	}
+	ctx.Cache.Set("key1", "value1")
+
+	expectedBf, _ := ctx.Cache.GetPartitionBloomFilter(1)
+	expectedReturn := fmt.Sprintf("hash:FULFILLED %s\n", expectedBf.Serialize())
+
+	command := parser.CommandData{"hash", "REQUEST", map[string]string{"bloomfilter": "1"}, make(map[string]string), make(map[string]string), nil}
+	result := ctx.ExecuteCommand(command)
+
+	if expectedReturn != result {
+		t.Fatalf("Expected [%s], got [%s]", expectedReturn, result)
+	}
+
+	command = parser.CommandData{"hash", "REQUEST", map[string]string{"bloomfilter": "4"}, make(map[string]string), make(map[string]string), nil}
+	if result := ctx.ExecuteCommand(command); result != "hash:4 is not a valid partition\n" {
+		t.Fatalf("Expected an invalid partition error, got [%s]", result)
+	}
+}
+
+func TestExecuteRange(t *testing.T) {
+	testCache := cache.NewCache(nil, CONFIG)
+	testCache.Set("key1", "value1")
+	testCache.Set("key2", "value2")
+
+	hash := dht.KeyHash("key1")
+	expectedReturn := fmt.Sprintf("hash:RANGED key1:%d\n", hash)
+
+	ctx := &ConnectionCtx{
+		nil,
+		testCache,
+	}
+
+	command := parser.CommandData{"hash", "RANGE", map[string]string{fmt.Sprintf("%d", hash): fmt.Sprintf("%d", hash+1)}, make(map[string]string), make(map[string]string), nil}
+	result := ctx.ExecuteCommand(command)
+
+	if expectedReturn != result {
+		t.Fatalf("Expected [%s], got [%s]", expectedReturn, result)
+	}
+}
+
+func TestRequestBloomStats(t *testing.T) {
+	testCache := cache.NewCache(nil, CONFIG)
+	testCache.Set("key1", "value1")
+
+	_, size, setBits := testCache.BloomSnapshot()
+	expectedReturn := fmt.Sprintf(
+		"hash:FULFILLED size:%d,set:%d,fill:%.4f\n",
+		size,
+		setBits,
+		float64(setBits)/float64(size),
+	)
+
+	ctx := &ConnectionCtx{
+		nil,
+		testCache,
+	}
+
+	command := parser.CommandData{"hash", "REQUEST", map[string]string{"bloomstats": ""}, make(map[string]string), make(map[string]string), nil}
+	result := ctx.ExecuteCommand(command)
+
+	if expectedReturn != result {
+		t.Fatalf("Expected [%s], got [%s]", expectedReturn, result)
+	}
+}
+
+func TestExecuteRepairLocalOnlyKey(t *testing.T) {
+	testCache := cache.NewCache(nil, CONFIG)
+	testCache.Set("key1", "value1")
+
+	ctx := &ConnectionCtx{
+		nil,
+		testCache,
+	}
+
+	expectedReturn := "hash:REPAIRED key1:0\n"
+
+	command := parser.CommandData{"hash", "REPAIR", map[string]string{"key1": "", "missing": ""}, make(map[string]string), make(map[string]string), nil}
+	result := ctx.ExecuteCommand(command)
+
+	if expectedReturn != result {
+		t.Fatalf("Expected [%s], got [%s]", expectedReturn, result)
+	}
+}
+
+func TestRequestPeerStats(t *testing.T) {
+	testCache := cache.NewCache(nil, CONFIG)
+	testCache.PeerList.BackupPeers[0] = dht.NewPeerByIP("127.0.0.1:1", nil, *CONFIG)
+
+	var stats []string
+	for _, info := range testCache.PeerInfo() {
+		stats = append(stats, fmt.Sprintf(
+			"%s sent=0 received=0 requests=0 errors=0 reconnects=0",
+			info.IPPort,
+		))
+	}
+	expectedReturn := fmt.Sprintf("hash:FULFILLED %s\n", strings.Join(stats, ","))
+
+	if !strings.Contains(expectedReturn, "127.0.0.1:1 ") {
+		t.Fatalf("Expected the backup peer in %v", expectedReturn)
+	}
+
+	ctx := &ConnectionCtx{
+		nil,
+		testCache,
+	}
+
+	command := parser.CommandData{"hash", "REQUEST", map[string]string{"peerstats": ""}, make(map[string]string), make(map[string]string), nil}
+	result := ctx.ExecuteCommand(command)
+
+	if expectedReturn != result {
+		t.Fatalf("Expected [%s], got [%s]", expectedReturn, result)
+	}
+}
+
+func TestRequestConfig(t *testing.T) {
+	testConfig := *CONFIG
+	testConfig.ClusterSecret = "s3cret"
+
+	ctx := &ConnectionCtx{
+		nil,
+		cache.NewCache(nil, &testConfig),
+	}
+
+	command := parser.CommandData{"hash", "REQUEST", map[string]string{"config": ""}, make(map[string]string), make(map[string]string), nil}
+	result := ctx.ExecuteCommand(command)
+
+	if !strings.HasPrefix(result, "hash:FULFILLED HeartbeatInterval=") {
+		t.Fatalf("Expected the config's fields, got [%s]", result)
+	}
+
+	expected := fmt.Sprintf(",ListenPort=%d,", testConfig.ListenPort)
+	if !strings.Contains(result, expected) {
+		t.Fatalf("Expected %v in [%s]", expected, result)
+	}
+
+	if strings.Contains(result, "s3cret") {
+		t.Fatalf("Expected the secret to be redacted, got [%s]", result)
+	}
+}
+
+func TestExecuteSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "olivia-save")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	testConfig := *CONFIG
+	testConfig.SnapshotPath = filepath.Join(dir, "olivia.snapshot")
+
+	ctx := &ConnectionCtx{
+		nil,
+		cache.NewCache(nil, &testConfig),
+	}
+	ctx.Cache.Set("key1", "test1")
+
+	expectedReturn := "hash:SAVED OK\n"
+
+	command := parser.CommandData{"hash", "SAVE", map[string]string{"1": ""}, make(map[string]string), make(map[string]string), nil}
+	result := ctx.ExecuteCommand(command)
+
+	if expectedReturn != result {
+		t.Fatalf("Expected [%s], got [%s]", expectedReturn, result)
+	}
+
+	if _, err := os.Stat(testConfig.SnapshotPath); err != nil {
+		t.Fatalf("Expected the snapshot on disk, got %v", err)
+	}
+}
+
+func TestExecuteBgsave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "olivia-bgsave")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	testConfig := *CONFIG
+	testConfig.SnapshotPath = filepath.Join(dir, "olivia.snapshot")
+
+	ctx := &ConnectionCtx{
+		nil,
+		cache.NewCache(nil, &testConfig),
+	}
+
+	expectedReturn := "hash:BGSAVING 0\n"
+
+	command := parser.CommandData{"hash", "BGSAVE", map[string]string{"1": ""}, make(map[string]string), make(map[string]string), nil}
+	result := ctx.ExecuteCommand(command)
+
+	if expectedReturn != result {
+		t.Fatalf("Expected [%s], got [%s]", expectedReturn, result)
+	}
+
+	for attempt := 0; ctx.Cache.LastSnapshot().IsZero(); attempt++ {
+		if attempt == 100 {
+			t.Fatalf("Expected the background snapshot to land")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestExecuteStats(t *testing.T) {
+	testConfig := *CONFIG
+	ctx := &ConnectionCtx{nil, cache.NewCache(nil, &testConfig)}
+	ctx.Cache.Set("key1", "value1")
+	ctx.Cache.Get("key1")
+
+	stats := ctx.Cache.Stats()
+	if stats.BloomfilterSetBits == 0 || stats.BloomfilterEstimatedKeys != 1 {
+		t.Fatalf("Expected the bloom filter to be estimated to hold 1 key, got %+v", stats)
+	}
+	expectedReturn := fmt.Sprintf(
+		"hash:COUNTED hits:1,misses:0,sets:1,expired:0,evicted:0,remotefetches:0,keys:1,bloombits:%d,bloomkeys:1,bloomfprate:%.6f\n",
+		stats.BloomfilterSetBits,
+		stats.BloomfilterFPRate,
+	)
+
+	command := parser.CommandData{"hash", "STATS", map[string]string{"1": ""}, make(map[string]string), make(map[string]string), nil}
+	result := ctx.ExecuteCommand(command)
+
+	if expectedReturn != result {
+		t.Fatalf("Expected [%s], got [%s]", expectedReturn, result)
+	}
+}
+
+func TestExecuteGossipMergesMembers(t *testing.T) {
+	testConfig := *CONFIG
+	testConfig.IsTesting = true
+
+	ctx := &ConnectionCtx{
+		nil,
+		cache.NewCache(nil, &testConfig),
+	}
+
+	command := parser.CommandData{"hash", "GOSSIP", map[string]string{"10.0.0.2_5454": "suspect"}, map[string]string{"10.0.0.2_5454": "2"}, make(map[string]string), nil}
+	result := ctx.ExecuteCommand(command)
+
+	if !strings.Contains(result, "10.0.0.2_5454:suspect:2") {
+		t.Fatalf("Expected the gossiped member to be answered, got [%s]", result)
+	}
+}
+
+func TestExecuteMigrateReportsUnreachableDestination(t *testing.T) {
+	testConfig := *CONFIG
+	testConfig.IsTesting = true
+
+	ctx := &ConnectionCtx{
+		nil,
+		cache.NewCache(nil, &testConfig),
+	}
+
+	command := parser.CommandData{"hash", "MIGRATE", map[string]string{"user*": "127.0.0.1_1"}, make(map[string]string), make(map[string]string), nil}
+	result := ctx.ExecuteCommand(command)
+
+	if !strings.HasPrefix(result, "hash:Failed to connect to 127.0.0.1:1") {
+		t.Fatalf("Expected the destination to be unreachable, got [%s]", result)
+	}
+}
+
+func TestExecuteBloomAddReportsUnknownPeers(t *testing.T) {
+	testConfig := *CONFIG
+	testConfig.IsTesting = true
+
+	ctx := &ConnectionCtx{
+		nil,
+		cache.NewCache(nil, &testConfig),
+	}
+
+	command := parser.CommandData{"hash", "BLOOMADD", map[string]string{"127.0.0.1_1": "3-17"}, make(map[string]string), make(map[string]string), nil}
+	result := ctx.ExecuteCommand(command)
+	if result != "hash:BLOOMADDED 127.0.0.1_1:UNKNOWN\n" {
+		t.Fatalf("Expected %v, got %v", "hash:BLOOMADDED 127.0.0.1_1:UNKNOWN\n", result)
+	}
+
+	command.Args["127.0.0.1_1"] = "3-x"
+	result = ctx.ExecuteCommand(command)
+	if !strings.HasPrefix(result, "hash:Invalid bloom filter index x") {
+		t.Fatalf("Expected the delta to be refused, got [%s]", result)
+	}
+}
+
+func TestExecuteRequestCuckooFilter(t *testing.T) {
+	testConfig := *CONFIG
+	testConfig.PeerFilter = "cuckoo"
+
+	testCache := cache.NewCache(nil, &testConfig)
+	testCache.Set("key1", "value1")
+
+	ctx := &ConnectionCtx{
+		nil,
+		testCache,
+	}
+
+	command := parser.CommandData{"hash", "REQUEST", map[string]string{"cuckoofilter": ""}, make(map[string]string), make(map[string]string), nil}
+	requestData, err := parser.NewParser(nil).Parse(ctx.ExecuteCommand(command), nil)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	var cfToParse string
+	for k := range requestData.Args {
+		cfToParse = k
+		break
+	}
+
+	cf, err := bloomfilter.DeserializeCuckoo(cfToParse)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if !cf.Lookup([]byte("key1")) {
+		t.Fatalf("Expected key1 to be in the cuckoo filter")
+	}
+
+	ctx.Cache = cache.NewCache(nil, CONFIG)
+	if result := ctx.ExecuteCommand(command); !strings.HasPrefix(result, "hash:No cuckoo filter is kept") {
+		t.Fatalf("Expected no cuckoo filter to be kept, got [%s]", result)
+	}
+}
+
+func TestExecuteRequestBloomFilterGzipped(t *testing.T) {
+	testConfig := *CONFIG
+	testConfig.BloomfilterEncoding = "gzip"
+
+	testCache := cache.NewCache(nil, &testConfig)
+	testCache.Set("key1", "value1")
+
+	ctx := &ConnectionCtx{
+		nil,
+		testCache,
+	}
+
+	command := parser.CommandData{"hash", "REQUEST", map[string]string{"bloomfilter": ""}, make(map[string]string), make(map[string]string), nil}
+	requestData, err := parser.NewParser(nil).Parse(ctx.ExecuteCommand(command), nil)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	var bfToParse string
+	for k := range requestData.Args {
+		bfToParse = k
+		break
+	}
+	if !strings.HasPrefix(bfToParse, "v1b.") {
+		t.Fatalf("Expected a binary bloom filter, got [%s]", bfToParse)
+	}
+
+	bf, err := bloomfilter.Deserialize(bfToParse, testConfig.BloomfilterSize)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if !bf.GetStorage().Compare(testCache.GetBloomFilter().GetStorage()) {
+		t.Fatalf("Expected the received bloom filter to match ours")
+	}
+}
+
+func TestExecuteBlockingGet(t *testing.T) {
+	ctx := &ConnectionCtx{
+		nil,
+		cache.NewCache(nil, nil),
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		ctx.Cache.Set("job1", "done")
+	}()
+
+	command := parser.CommandData{"hash", "BGET", map[string]string{"job1": "5"}, make(map[string]string), make(map[string]string), nil}
+	if result := ctx.ExecuteCommand(command); result != "hash:GOT job1:done\n" {
+		t.Fatalf("Expected %v, got %v", "hash:GOT job1:done\n", result)
+	}
+
+	command = parser.CommandData{"hash", "BGET", map[string]string{"job2": "1"}, make(map[string]string), make(map[string]string), nil}
+	if result := ctx.ExecuteCommand(command); result != "hash:GOT \n" {
+		t.Fatalf("Expected %v, got %v", "hash:GOT \n", result)
+	}
+
+	command = parser.CommandData{"hash", "BGET", map[string]string{"job2": "0"}, make(map[string]string), make(map[string]string), nil}
+	if result := ctx.ExecuteCommand(command); !strings.HasPrefix(result, "Invalid command") {
+		t.Fatalf("Expected an invalid timeout, got %v", result)
+	}
+}
+
+func TestExecuteSetNXAndLocks(t *testing.T) {
+	ctx := &ConnectionCtx{
+		nil,
+		cache.NewCache(nil, nil),
+	}
+
+	command := parser.CommandData{"hash", "SETNX", map[string]string{"key1": "value1"}, make(map[string]string), make(map[string]string), nil}
+	if result := ctx.ExecuteCommand(command); result != "hash:SATNX key1\n" {
+		t.Fatalf("Expected %v, got %v", "hash:SATNX key1\n", result)
+	}
+	command = parser.CommandData{"hash", "SETNX", map[string]string{"key1": "value2"}, make(map[string]string), make(map[string]string), nil}
+	if result := ctx.ExecuteCommand(command); result != "hash:SATNX \n" {
+		t.Fatalf("Expected %v, got %v", "hash:SATNX \n", result)
+	}
+
+	command = parser.CommandData{"hash", "LOCK", map[string]string{"job1": "30"}, make(map[string]string), make(map[string]string), nil}
+	result := ctx.ExecuteCommand(command)
+	if !strings.HasPrefix(result, "hash:LOCKED job1:") {
+		t.Fatalf("Expected the lock to be taken, got %v", result)
+	}
+	token := strings.TrimSpace(strings.TrimPrefix(result, "hash:LOCKED job1:"))
+
+	if result := ctx.ExecuteCommand(command); result != "hash:LOCKED job1:HELD\n" {
+		t.Fatalf("Expected %v, got %v", "hash:LOCKED job1:HELD\n", result)
+	}
+
+	command = parser.CommandData{"hash", "UNLOCK", map[string]string{"job1": token}, make(map[string]string), make(map[string]string), nil}
+	if result := ctx.ExecuteCommand(command); result != "hash:UNLOCKED job1:OK\n" {
+		t.Fatalf("Expected %v, got %v", "hash:UNLOCKED job1:OK\n", result)
+	}
+	if result := ctx.ExecuteCommand(command); result != "hash:UNLOCKED job1:NOTHELD\n" {
+		t.Fatalf("Expected %v, got %v", "hash:UNLOCKED job1:NOTHELD\n", result)
+	}
+}
+
+func TestExecuteListCommands(t *testing.T) {
+	ctx := &ConnectionCtx{
+		nil,
+		cache.NewCache(nil, nil),
+	}
+
+	var exchanges = []struct {
+		command  string
+		args     map[string]string
+		exp      map[string]string
+		expected string
+	}{
+		{"RPUSH", map[string]string{"jobs": "job1"}, map[string]string{}, "hash:RPUSHED jobs:1\n"},
+		{"RPUSH", map[string]string{"jobs": "job2"}, map[string]string{}, "hash:RPUSHED jobs:2\n"},
+		{"LPUSH", map[string]string{"jobs": "job0"}, map[string]string{"jobs": "2"}, "hash:LPUSHED jobs:2\n"},
+		{"LRANGE", map[string]string{"jobs": "0"}, map[string]string{"jobs": "-1"}, "hash:LRANGED 0:job0,1:job1\n"},
+		{"LPOP", map[string]string{"jobs": ""}, map[string]string{}, "hash:LPOPPED jobs:job0\n"},
+		{"GET", map[string]string{"jobs": ""}, map[string]string{}, "hash:GOT \n"},
+	}
+	for _, exchange := range exchanges {
+		command := parser.CommandData{"hash", exchange.command, exchange.args, exchange.exp, make(map[string]string), nil}
+		if result := ctx.ExecuteCommand(command); result != exchange.expected {
+			t.Fatalf("Expected %v, got %v", exchange.expected, result)
+		}
+	}
+}
+
+func TestExecuteHashCommands(t *testing.T) {
+	ctx := &ConnectionCtx{
+		nil,
+		cache.NewCache(nil, nil),
+	}
+
+	var exchanges = []struct {
+		command  string
+		args     map[string]string
+		exp      map[string]string
+		expected string
+	}{
+		{"HSET", map[string]string{"user1": "name"}, map[string]string{"user1": "ian"}, "hash:HSAT user1:1\n"},
+		{"HSET", map[string]string{"user1": "name"}, map[string]string{"user1": "bob"}, "hash:HSAT user1:0\n"},
+		{"HGET", map[string]string{"user1": "name"}, map[string]string{}, "hash:HGOT user1:bob\n"},
+		{"HGET", map[string]string{"user1": "missing"}, map[string]string{}, "hash:HGOT \n"},
+		{"HGETALL", map[string]string{"user1": ""}, map[string]string{}, "hash:HGOT 0:name:bob\n"},
+		{"GET", map[string]string{"user1": ""}, map[string]string{}, "hash:GOT \n"},
+	}
+	for _, exchange := range exchanges {
+		command := parser.CommandData{"hash", exchange.command, exchange.args, exchange.exp, make(map[string]string), nil}
+		if result := ctx.ExecuteCommand(command); result != exchange.expected {
+			t.Fatalf("Expected %v, got %v", exchange.expected, result)
+		}
+	}
+}
+
+func TestExecuteHashCommandsFrameSeparators(t *testing.T) {
+	ctx := &ConnectionCtx{
+		parser.NewParser(nil),
+		cache.NewCache(nil, CONFIG),
+	}
+
+	command, err := ctx.Parser.Parse("hash:HSET user1:$10:$11\nname, full\nian:\nsmith,\n", nil)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if result := ctx.ExecuteCommand(*command); result != "hash:HSAT user1:1\n" {
+		t.Fatalf("Expected %v, got %v", "hash:HSAT user1:1\n", result)
+	}
+	ctx.Cache.HSet("user1", map[string]string{"age": "30"})
+
+	command, err = ctx.Parser.Parse("hash:HGETALL user1", nil)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	expectedReturn := "hash:HGOT 0:age:30,1:$10:$11\nname, full\nian:\nsmith,\n"
+	result := ctx.ExecuteCommand(*command)
+	if result != expectedReturn {
+		t.Fatalf("Expected [%s], got [%s]", expectedReturn, result)
+	}
+
+	response, err := parser.NewParser(nil).Parse(result, nil)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if response.Args["1"] != "name, full" || response.Expiration["1"] != "ian:\nsmith," {
+		t.Fatalf("Expected %q:%q, got %q:%q", "name, full", "ian:\nsmith,", response.Args["1"], response.Expiration["1"])
+	}
+}
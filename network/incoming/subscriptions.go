@@ -0,0 +1,219 @@
+package incomingNetwork
+
+import (
+	"fmt"
+	"github.com/GrappigPanda/Olivia/cache"
+	"github.com/GrappigPanda/Olivia/network/message_handler"
+	"github.com/GrappigPanda/Olivia/parser"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// connWatch is a connection's keyspace subscription, whose events are pushed
+// to the connection as they happen, between the responses to its commands. A
+// connection has at most one, on the namespace it started watching in.
+type connWatch struct {
+	cache        *cache.Cache
+	subscription *cache.Subscription
+	write        func(string)
+	done         chan struct{}
+	pushing      sync.WaitGroup
+}
+
+// handle answers WATCH and UNWATCH. `WATCH user*,session*` subscribes to the
+// keys matching the patterns, answering with every pattern the connection now
+// watches, and `UNWATCH user*` answers with the patterns which were dropped.
+func (s *connWatch) handle(ctx *ConnectionCtx, requestData parser.CommandData) string {
+	patterns := make([]string, 0, len(requestData.Args))
+	for pattern := range requestData.Args {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	if strings.ToUpper(requestData.Command) == "UNWATCH" {
+		if s.subscription == nil {
+			return createResponse("UNWATCH", nil, requestData.Hash)
+		}
+
+		removed := s.subscription.RemovePatterns(patterns...)
+		if len(s.subscription.Patterns()) == 0 {
+			s.close()
+		}
+
+		return createResponse("UNWATCH", removed, requestData.Hash)
+	}
+
+	if s.subscription != nil && s.cache != ctx.Cache {
+		return fmt.Sprintf("%s:Already watching another namespace\n", requestData.Hash)
+	}
+
+	if s.subscription != nil {
+		if err := s.subscription.AddPatterns(patterns...); err != nil {
+			return fmt.Sprintf("%s:%v\n", requestData.Hash, err)
+		}
+	} else {
+		subscription, err := ctx.Cache.Subscribe(patterns...)
+		if err != nil {
+			return fmt.Sprintf("%s:%v\n", requestData.Hash, err)
+		}
+		s.open(ctx.Cache, subscription)
+	}
+
+	return createResponse("WATCH", s.subscription.Patterns(), requestData.Hash)
+}
+
+// open starts pushing a new subscription's events.
+func (s *connWatch) open(c *cache.Cache, subscription *cache.Subscription) {
+	s.cache = c
+	s.subscription = subscription
+	s.done = make(chan struct{})
+
+	s.pushing.Add(1)
+	go func(events <-chan cache.KeyspaceEvent, done chan struct{}) {
+		defer s.pushing.Done()
+
+		for {
+			select {
+			case event := <-events:
+				s.write(formatKeyspaceEvent(event))
+			case <-done:
+				return
+			}
+		}
+	}(subscription.Events(), s.done)
+}
+
+// close unsubscribes, waiting for the events being pushed to stop. It does
+// nothing without a subscription.
+func (s *connWatch) close() {
+	if s.subscription == nil {
+		return
+	}
+
+	s.cache.Unsubscribe(s.subscription)
+	close(s.done)
+	s.pushing.Wait()
+
+	s.cache, s.subscription = nil, nil
+}
+
+// formatKeyspaceEvent formats an event pushed to a watching connection, e.g.
+// "0:NOTIFIED user1:set". Like PING's, its hash is 0 as it answers no
+// command.
+func formatKeyspaceEvent(event cache.KeyspaceEvent) string {
+	return fmt.Sprintf("0:NOTIFIED %s:%s\n", event.Key, event.Op)
+}
+
+// channelBuffer is how many published messages a connection holds before it
+// starts missing them.
+const channelBuffer = 256
+
+// connChannels are the named channels a connection subscribed to, whose
+// messages are pushed to it as they're published, like keyspace events.
+type connChannels struct {
+	bus      *message_handler.MessageHandler
+	messages chan message_handler.ChannelMessage
+	channels map[string]bool
+	write    func(string)
+	done     chan struct{}
+	pushing  sync.WaitGroup
+}
+
+// handle answers SUBSCRIBE and UNSUBSCRIBE. `SUBSCRIBE news,alerts` answers
+// with every channel the connection is now subscribed to, and `UNSUBSCRIBE
+// news` with the channels which were unsubscribed from.
+func (s *connChannels) handle(ctx *ConnectionCtx, requestData parser.CommandData) string {
+	channels := make([]string, 0, len(requestData.Args))
+	for channel := range requestData.Args {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+
+	if strings.ToUpper(requestData.Command) == "UNSUBSCRIBE" {
+		var removed []string
+		for _, channel := range channels {
+			if s.channels[channel] {
+				s.bus.Unsubscribe(channel, s.messages)
+				delete(s.channels, channel)
+				removed = append(removed, channel)
+			}
+		}
+		if len(s.channels) == 0 {
+			s.close()
+		}
+
+		return createResponse("UNSUBSCRIBE", removed, requestData.Hash)
+	}
+
+	if ctx.Cache.MessageBus == nil {
+		return fmt.Sprintf("%s:Channels aren't available\n", requestData.Hash)
+	}
+
+	if s.channels == nil {
+		s.open(ctx.Cache.MessageBus)
+	}
+	for _, channel := range channels {
+		if !s.channels[channel] {
+			s.bus.Subscribe(channel, s.messages)
+			s.channels[channel] = true
+		}
+	}
+
+	subscribed := make([]string, 0, len(s.channels))
+	for channel := range s.channels {
+		subscribed = append(subscribed, channel)
+	}
+	sort.Strings(subscribed)
+
+	return createResponse("SUBSCRIBE", subscribed, requestData.Hash)
+}
+
+// open starts pushing the messages of the channels about to be subscribed
+// to.
+func (s *connChannels) open(bus *message_handler.MessageHandler) {
+	s.bus = bus
+	s.messages = make(chan message_handler.ChannelMessage, channelBuffer)
+	s.channels = make(map[string]bool)
+	s.done = make(chan struct{})
+
+	s.pushing.Add(1)
+	go func(messages <-chan message_handler.ChannelMessage, done chan struct{}) {
+		defer s.pushing.Done()
+
+		for {
+			select {
+			case message := <-messages:
+				s.write(formatChannelMessage(message))
+			case <-done:
+				return
+			}
+		}
+	}(s.messages, s.done)
+}
+
+// close unsubscribes from every channel, waiting for the messages being
+// pushed to stop. It does nothing without a subscription.
+func (s *connChannels) close() {
+	if s.channels == nil {
+		return
+	}
+
+	for channel := range s.channels {
+		s.bus.Unsubscribe(channel, s.messages)
+	}
+	close(s.done)
+	s.pushing.Wait()
+
+	s.bus, s.messages, s.channels = nil, nil, nil
+}
+
+// formatChannelMessage formats a message pushed to a subscribed connection,
+// e.g. "0:MESSAGE news:hello", framing messages which aren't safe to send as
+// text.
+func formatChannelMessage(message message_handler.ChannelMessage) string {
+	var payloads []string
+	line := fmt.Sprintf("0:MESSAGE %s\n", formatKeyValue(message.Channel, message.Message, &payloads))
+
+	return parser.AppendPayloads(line, payloads)
+}
@@ -0,0 +1,244 @@
+package memcache
+
+import (
+	"fmt"
+	"github.com/GrappigPanda/Olivia/cache"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRelativeExptime is the largest exptime taken as seconds from now;
+// anything larger is a unix timestamp, like memcached's.
+const maxRelativeExptime = 60 * 60 * 24 * 30
+
+// maxKeyLength is memcached's limit on key length.
+const maxKeyLength = 250
+
+// storageCommands send a data block after their command line.
+var storageCommands = map[string]bool{
+	"set":     true,
+	"add":     true,
+	"replace": true,
+}
+
+// execute runs a single command and returns its response.
+func (s *server) execute(req *request) string {
+	switch req.name {
+	case "get", "gets":
+		return s.get(req)
+	case "set", "add", "replace":
+		return s.store(req)
+	case "delete":
+		return s.delete(req)
+	case "incr", "decr":
+		return s.adjust(req)
+	case "touch":
+		return s.touch(req)
+	case "version":
+		return "VERSION olivia\r\n"
+	}
+
+	return "ERROR\r\n"
+}
+
+// get answers get and gets. Olivia has no cas uniques, so gets answers like
+// get.
+func (s *server) get(req *request) string {
+	if len(req.args) == 0 {
+		return "ERROR\r\n"
+	}
+
+	var response strings.Builder
+	for _, key := range req.args {
+		if err := validateKey(key); err != nil {
+			return err.Error()
+		}
+
+		value, err := s.cache.Get(key)
+		if err != nil {
+			continue
+		}
+
+		fmt.Fprintf(&response, "VALUE %s %d %d\r\n%s\r\n", key, s.flags.get(key, value), len(value), value)
+	}
+	response.WriteString("END\r\n")
+
+	return response.String()
+}
+
+// store answers set, add and replace: `<key> <flags> <exptime> <bytes>`.
+func (s *server) store(req *request) string {
+	key := req.args[0]
+	if err := validateKey(key); err != nil {
+		return err.Error()
+	}
+
+	flags, flagsErr := strconv.ParseUint(req.args[1], 10, 32)
+	exptime, exptimeErr := strconv.ParseInt(req.args[2], 10, 64)
+	if flagsErr != nil || exptimeErr != nil {
+		return clientError{"bad command line format", false}.Error()
+	}
+
+	ttl, expired := ttlOf(exptime, time.Now())
+	if expired {
+		// Like memcached, an item stored already expired is gone right
+		// away.
+		s.cache.Delete(key)
+		s.flags.remove(key)
+		return "STORED\r\n"
+	}
+
+	var err error
+	written := true
+	switch req.name {
+	case "set":
+		err = s.set(key, req.data, ttl)
+	case "add":
+		written, err = s.cache.SetIf(key, req.data, false, ttl)
+	case "replace":
+		written, err = s.cache.SetIf(key, req.data, true, ttl)
+		if written && err == nil && ttl < 0 {
+			_, err = s.cache.Persist(key)
+		}
+	}
+
+	if err != nil {
+		return fmt.Sprintf("SERVER_ERROR %v\r\n", err)
+	}
+	if !written {
+		return "NOT_STORED\r\n"
+	}
+
+	s.flags.set(key, req.data, uint32(flags))
+	return "STORED\r\n"
+}
+
+// set stores `value`, replacing whatever expiration `key` had with `ttl`
+// seconds, or none if it's negative.
+func (s *server) set(key string, value string, ttl int) error {
+	if ttl >= 0 {
+		return s.cache.SetExpiration(key, value, ttl)
+	}
+
+	if err := s.cache.Set(key, value); err != nil {
+		return err
+	}
+
+	_, err := s.cache.Persist(key)
+	return err
+}
+
+func (s *server) delete(req *request) string {
+	if len(req.args) != 1 {
+		return "ERROR\r\n"
+	}
+
+	if err := validateKey(req.args[0]); err != nil {
+		return err.Error()
+	}
+
+	if err := s.cache.Delete(req.args[0]); err != nil {
+		return "NOT_FOUND\r\n"
+	}
+	s.flags.remove(req.args[0])
+
+	return "DELETED\r\n"
+}
+
+// adjust answers incr and decr: `<key> <value>`.
+func (s *server) adjust(req *request) string {
+	if len(req.args) != 2 {
+		return "ERROR\r\n"
+	}
+
+	key := req.args[0]
+	if err := validateKey(key); err != nil {
+		return err.Error()
+	}
+
+	delta, err := strconv.ParseUint(req.args[1], 10, 64)
+	if err != nil {
+		return clientError{"invalid numeric delta argument", false}.Error()
+	}
+
+	// The flags are kept along with the new value.
+	old, _ := s.cache.Get(key)
+	flags := s.flags.get(key, old)
+
+	next, found, err := s.cache.AdjustUnsigned(key, delta, req.name == "decr")
+	if !found {
+		return "NOT_FOUND\r\n"
+	}
+	if err == cache.ErrNotAnInteger {
+		return clientError{"cannot increment or decrement non-numeric value", false}.Error()
+	} else if err != nil {
+		return fmt.Sprintf("SERVER_ERROR %v\r\n", err)
+	}
+
+	s.flags.set(key, strconv.FormatUint(next, 10), flags)
+	return fmt.Sprintf("%d\r\n", next)
+}
+
+// touch answers touch: `<key> <exptime>`.
+func (s *server) touch(req *request) string {
+	if len(req.args) != 2 {
+		return "ERROR\r\n"
+	}
+
+	key := req.args[0]
+	exptime, err := strconv.ParseInt(req.args[1], 10, 64)
+	if err != nil {
+		return clientError{"bad command line format", false}.Error()
+	}
+
+	ttl, expired := ttlOf(exptime, time.Now())
+	switch {
+	case expired:
+		err = s.cache.Delete(key)
+	case ttl < 0:
+		_, err = s.cache.Persist(key)
+	default:
+		err = s.cache.Expire(key, ttl)
+	}
+	if err != nil {
+		return "NOT_FOUND\r\n"
+	}
+
+	return "TOUCHED\r\n"
+}
+
+// ttlOf converts a memcached exptime into seconds from `now`, negative for
+// none. Exptimes up to 30 days are relative, larger ones unix timestamps. It
+// also reports whether the exptime has already passed.
+func ttlOf(exptime int64, now time.Time) (int, bool) {
+	switch {
+	case exptime == 0:
+		return -1, false
+	case exptime < 0:
+		return 0, true
+	case exptime <= maxRelativeExptime:
+		return int(exptime), false
+	}
+
+	remaining := exptime - now.Unix()
+	if remaining <= 0 {
+		return 0, true
+	}
+
+	return int(remaining), false
+}
+
+func validateKey(key string) error {
+	if len(key) > maxKeyLength {
+		return clientError{"key is too long", false}
+	}
+
+	for _, char := range []byte(key) {
+		if char <= ' ' || char == 0x7f {
+			return clientError{"key contains control characters", false}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package memcache
+
+import (
+	"github.com/GrappigPanda/Olivia/cache"
+	"hash/fnv"
+	"sync"
+)
+
+// expireEventBuffer is how many expirations can queue up before the flags
+// stop hearing about them. Missed ones are caught by the value fingerprint.
+const expireEventBuffer = 1024
+
+// flagged is the flags a memcached client stored along with a value.
+type flagged struct {
+	flags uint32
+	// fingerprint identifies the value the flags were stored with, so a
+	// value overwritten through another protocol loses them.
+	fingerprint uint64
+}
+
+// flagStore keeps the client flags of values, which the cache itself doesn't
+// store. Values without flags (zero) aren't kept, so they stay plain values
+// any protocol can read and write.
+type flagStore struct {
+	flags map[string]flagged
+	sync.Mutex
+}
+
+// newFlagStore creates a flag store which drops the flags of keys `c`
+// expires or evicts.
+func newFlagStore(c *cache.Cache) *flagStore {
+	store := &flagStore{flags: make(map[string]flagged)}
+
+	events := make(chan cache.ExpireEvent, expireEventBuffer)
+	c.OnExpireStream(events)
+	go func() {
+		for event := range events {
+			store.remove(event.Key)
+		}
+	}()
+
+	return store
+}
+
+// set stores the flags of `value`, stored at `key`.
+func (f *flagStore) set(key string, value string, flags uint32) {
+	f.Lock()
+	defer f.Unlock()
+
+	if flags == 0 {
+		delete(f.flags, key)
+		return
+	}
+
+	f.flags[key] = flagged{flags, fingerprint(value)}
+}
+
+// get returns the flags stored along with `value`, zero if there are none
+// or `key` was since overwritten with another value.
+func (f *flagStore) get(key string, value string) uint32 {
+	f.Lock()
+	defer f.Unlock()
+
+	stored, ok := f.flags[key]
+	if !ok {
+		return 0
+	}
+
+	if stored.fingerprint != fingerprint(value) {
+		delete(f.flags, key)
+		return 0
+	}
+
+	return stored.flags
+}
+
+func (f *flagStore) remove(key string) {
+	f.Lock()
+	defer f.Unlock()
+
+	delete(f.flags, key)
+}
+
+func fingerprint(value string) uint64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(value))
+
+	return hash.Sum64()
+}
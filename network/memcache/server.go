@@ -0,0 +1,200 @@
+package memcache
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/GrappigPanda/Olivia/cache"
+	"github.com/GrappigPanda/Olivia/config"
+	"github.com/GrappigPanda/Olivia/network/metrics"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxLineBytes caps a command line, leaving the data block of a storage
+// command out.
+const maxLineBytes = 2048
+
+// Listen accepts memcached clients on `address` in the background,
+// translating their commands into operations on `c`. Closing the returned
+// listener stops accepting connections. The memcached text protocol has no
+// way to authenticate, so unless the config's MemcacheUnauthenticated is set,
+// it refuses to listen when clients have to authenticate.
+func Listen(address string, c *cache.Cache, config *config.Cfg) (net.Listener, error) {
+	if c.RequiresAuth() && !config.MemcacheUnauthenticated {
+		return nil, errors.New("Memcached clients can't authenticate; set MemcacheUnauthenticated to serve them anyway")
+	}
+
+	listener, err := config.Listen(address)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Accepting memcached connections on %v", listener.Addr())
+
+	server := &server{c, newFlagStore(c), config.MaxMessageBytes}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				log.Printf("Stopped accepting memcached connections: %v", err)
+				return
+			}
+
+			go server.serve(conn)
+		}
+	}()
+
+	return listener, nil
+}
+
+type server struct {
+	cache *cache.Cache
+	flags *flagStore
+	// maxValueBytes caps a storage command's data block. Zero means no cap.
+	maxValueBytes int
+}
+
+// request is a single command, along with the data block storage commands
+// send after their line.
+type request struct {
+	name    string
+	args    []string
+	data    string
+	noreply bool
+}
+
+// serve answers the commands sent over `conn` until it's closed, it sends
+// quit, or it sends a line which is too long to be a command.
+func (s *server) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+
+	for {
+		req, err := s.readRequest(reader)
+		if clientErr, ok := err.(clientError); ok {
+			writer.WriteString(clientErr.Error())
+			writer.Flush()
+			if clientErr.fatal {
+				return
+			}
+			continue
+		} else if err != nil {
+			if err != io.EOF {
+				log.Printf("Memcached connection %v failed to read: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+
+		if req.name == "" {
+			continue
+		}
+		if req.name == "quit" {
+			writer.Flush()
+			return
+		}
+
+		done := s.cache.StartRequest()
+		started := time.Now()
+		response := s.execute(req)
+		metrics.ObserveRequest(req.name, time.Since(started))
+		done()
+
+		if !req.noreply {
+			writer.WriteString(response)
+		}
+
+		// Pipelined commands are answered together.
+		if reader.Buffered() == 0 {
+			if err := writer.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// clientError is answered with a CLIENT_ERROR. A fatal one leaves the
+// connection out of sync, so it's closed.
+type clientError struct {
+	reason string
+	fatal  bool
+}
+
+func (e clientError) Error() string {
+	return fmt.Sprintf("CLIENT_ERROR %s\r\n", e.reason)
+}
+
+// readRequest reads a command line and, for storage commands, the data block
+// following it.
+func (s *server) readRequest(reader *bufio.Reader) (*request, error) {
+	line, err := readLine(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return &request{}, nil
+	}
+
+	req := &request{name: strings.ToLower(fields[0]), args: fields[1:]}
+	// Retrievals are always answered, so a key named noreply can be read.
+	retrieval := req.name == "get" || req.name == "gets"
+	if !retrieval && len(req.args) > 0 && req.args[len(req.args)-1] == "noreply" {
+		req.noreply = true
+		req.args = req.args[:len(req.args)-1]
+	}
+
+	if !storageCommands[req.name] {
+		return req, nil
+	}
+
+	if len(req.args) < 4 {
+		return nil, clientError{"bad command line format", false}
+	}
+
+	length, err := strconv.ParseUint(req.args[3], 10, 32)
+	if err != nil {
+		return nil, clientError{"bad data chunk", true}
+	}
+	if s.maxValueBytes > 0 && int(length) > s.maxValueBytes {
+		return nil, clientError{"object too large for cache", true}
+	}
+
+	data := make([]byte, length+2)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return nil, err
+	}
+	if string(data[length:]) != "\r\n" {
+		return nil, clientError{"bad data chunk", true}
+	}
+	req.data = string(data[:length])
+
+	return req, nil
+}
+
+// readLine reads a line, without its line ending.
+func readLine(reader *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if len(line)+len(chunk) > maxLineBytes {
+			return "", clientError{"line is too long", true}
+		}
+		line = append(line, chunk...)
+
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		return strings.TrimRight(string(line), "\r\n"), nil
+	}
+}
@@ -0,0 +1,211 @@
+package memcache
+
+import (
+	"bufio"
+	"github.com/GrappigPanda/Olivia/cache"
+	"github.com/GrappigPanda/Olivia/config"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	cache  *cache.Cache
+}
+
+func newTestClient(t *testing.T) (*testClient, func()) {
+	cfg := &config.Cfg{BloomfilterSize: 1000, IsTesting: true, MaxMessageBytes: 64}
+	c := cache.NewCache(nil, cfg)
+	listener, err := Listen("127.0.0.1:0", c, cfg)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	return &testClient{conn, bufio.NewReader(conn), c}, func() {
+		conn.Close()
+		listener.Close()
+		c.Stop()
+	}
+}
+
+// expect sends `command` and checks the response is exactly `expected`.
+func (c *testClient) expect(t *testing.T, command string, expected string) {
+	if _, err := c.conn.Write([]byte(command)); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	response := make([]byte, len(expected))
+	if _, err := io.ReadFull(c.reader, response); err != nil {
+		t.Fatalf("Expected %q, got %q (%v)", expected, response, err)
+	}
+
+	if string(response) != expected {
+		t.Fatalf("Expected %q, got %q", expected, response)
+	}
+}
+
+func TestSetAndGetKeepFlags(t *testing.T) {
+	client, stop := newTestClient(t)
+	defer stop()
+
+	client.expect(t, "set key1 42 0 5\r\nhello\r\n", "STORED\r\n")
+	client.expect(t, "set key2 0 0 7\r\nwo\r\nrld\r\n", "STORED\r\n")
+	client.expect(t,
+		"get key1 missing key2\r\n",
+		"VALUE key1 42 5\r\nhello\r\nVALUE key2 0 7\r\nwo\r\nrld\r\nEND\r\n")
+	client.expect(t, "gets key1\r\n", "VALUE key1 42 5\r\nhello\r\nEND\r\n")
+
+	// A value written through another protocol loses its flags.
+	client.cache.Set("key1", "other")
+	client.expect(t, "get key1\r\n", "VALUE key1 0 5\r\nother\r\nEND\r\n")
+}
+
+func TestAddAndReplace(t *testing.T) {
+	client, stop := newTestClient(t)
+	defer stop()
+
+	client.expect(t, "replace key1 0 0 1\r\na\r\n", "NOT_STORED\r\n")
+	client.expect(t, "add key1 3 0 1\r\nb\r\n", "STORED\r\n")
+	client.expect(t, "add key1 0 0 1\r\nc\r\n", "NOT_STORED\r\n")
+	client.expect(t, "replace key1 5 0 1\r\nd\r\n", "STORED\r\n")
+	client.expect(t, "get key1\r\n", "VALUE key1 5 1\r\nd\r\nEND\r\n")
+}
+
+func TestDelete(t *testing.T) {
+	client, stop := newTestClient(t)
+	defer stop()
+
+	client.expect(t, "set key1 0 0 1\r\na\r\n", "STORED\r\n")
+	client.expect(t, "delete key1\r\n", "DELETED\r\n")
+	client.expect(t, "delete key1\r\n", "NOT_FOUND\r\n")
+	client.expect(t, "get key1\r\n", "END\r\n")
+}
+
+func TestIncrAndDecr(t *testing.T) {
+	client, stop := newTestClient(t)
+	defer stop()
+
+	client.expect(t, "incr key1 1\r\n", "NOT_FOUND\r\n")
+	client.expect(t, "set key1 7 0 2\r\n10\r\n", "STORED\r\n")
+	client.expect(t, "incr key1 5\r\n", "15\r\n")
+	client.expect(t, "decr key1 20\r\n", "0\r\n")
+	client.expect(t, "get key1\r\n", "VALUE key1 7 1\r\n0\r\nEND\r\n")
+
+	client.expect(t, "set key2 0 0 20\r\n18446744073709551615\r\n", "STORED\r\n")
+	client.expect(t, "incr key2 2\r\n", "1\r\n")
+
+	client.expect(t, "set key3 0 0 3\r\nabc\r\n", "STORED\r\n")
+	client.expect(t,
+		"incr key3 1\r\n",
+		"CLIENT_ERROR cannot increment or decrement non-numeric value\r\n")
+	client.expect(t, "incr key1 -1\r\n", "CLIENT_ERROR invalid numeric delta argument\r\n")
+}
+
+func TestExptimeAndTouch(t *testing.T) {
+	client, stop := newTestClient(t)
+	defer stop()
+
+	client.expect(t, "set key1 0 100 1\r\na\r\n", "STORED\r\n")
+	if ttl, _ := client.cache.GetTTL("key1"); ttl != 100 {
+		t.Fatalf("Expected %v, got %v", 100, ttl)
+	}
+
+	// Plain set drops the expiration, like memcached's.
+	client.expect(t, "set key1 0 0 1\r\nb\r\n", "STORED\r\n")
+	if ttl, _ := client.cache.GetTTL("key1"); ttl != cache.NoExpiration {
+		t.Fatalf("Expected %v, got %v", cache.NoExpiration, ttl)
+	}
+
+	client.expect(t, "touch key1 50\r\n", "TOUCHED\r\n")
+	if ttl, _ := client.cache.GetTTL("key1"); ttl != 50 {
+		t.Fatalf("Expected %v, got %v", 50, ttl)
+	}
+	client.expect(t, "touch missing 50\r\n", "NOT_FOUND\r\n")
+
+	// A negative exptime expires the item right away.
+	client.expect(t, "set key1 0 -1 1\r\nc\r\n", "STORED\r\n")
+	client.expect(t, "get key1\r\n", "END\r\n")
+}
+
+func TestTTLOf(t *testing.T) {
+	now := time.Unix(1000000000, 0)
+
+	var tests = []struct {
+		exptime int64
+		ttl     int
+		expired bool
+	}{
+		{0, -1, false},
+		{-1, 0, true},
+		{60, 60, false},
+		{maxRelativeExptime, maxRelativeExptime, false},
+		{now.Unix() + 90, 90, false},
+		{now.Unix() - 90, 0, true},
+	}
+
+	for _, test := range tests {
+		ttl, expired := ttlOf(test.exptime, now)
+		if ttl != test.ttl || expired != test.expired {
+			t.Fatalf("Expected %v %v, got %v %v", test.ttl, test.expired, ttl, expired)
+		}
+	}
+}
+
+func TestNoreply(t *testing.T) {
+	client, stop := newTestClient(t)
+	defer stop()
+
+	client.conn.Write([]byte("set key1 0 0 1 noreply\r\na\r\ndelete missing noreply\r\n"))
+	client.expect(t, "get key1\r\n", "VALUE key1 0 1\r\na\r\nEND\r\n")
+}
+
+func TestClientErrors(t *testing.T) {
+	client, stop := newTestClient(t)
+	defer stop()
+
+	client.expect(t, "bogus\r\n", "ERROR\r\n")
+	client.expect(t, "version\r\n", "VERSION olivia\r\n")
+	client.expect(t, "get "+strings.Repeat("k", maxKeyLength+1)+"\r\n", "CLIENT_ERROR key is too long\r\n")
+
+	// A data block which doesn't match its length closes the connection.
+	client.expect(t, "set key1 0 0 1\r\nabc\r\n", "CLIENT_ERROR bad data chunk\r\n")
+	if _, err := client.reader.ReadByte(); err != io.EOF {
+		t.Fatalf("Expected %v, got %v", io.EOF, err)
+	}
+}
+
+func TestValueTooLarge(t *testing.T) {
+	client, stop := newTestClient(t)
+	defer stop()
+
+	client.expect(t, "set key1 0 0 65\r\n", "CLIENT_ERROR object too large for cache\r\n")
+}
+
+func TestListenRefusesWhenClientsAuthenticate(t *testing.T) {
+	cfg := &config.Cfg{BloomfilterSize: 1000, IsTesting: true}
+	c := cache.NewCache(nil, cfg)
+	defer c.Stop()
+	c.SetClusterSecrets("secret", "")
+
+	if listener, err := Listen("127.0.0.1:0", c, cfg); err == nil {
+		listener.Close()
+		t.Fatalf("Expected an error serving memcached clients without authentication")
+	}
+
+	cfg.MemcacheUnauthenticated = true
+	listener, err := Listen("127.0.0.1:0", c, cfg)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	listener.Close()
+}
@@ -0,0 +1,62 @@
+package message_handler
+
+// ChannelMessage is a message published to a named channel.
+type ChannelMessage struct {
+	Channel string
+	Message string
+}
+
+// Subscribe registers `subscriber` to receive every message published to
+// `channel` on this node. Subscribing it twice still delivers each message
+// once.
+func (m *MessageHandler) Subscribe(channel string, subscriber chan<- ChannelMessage) {
+	m.channelLock.Lock()
+	defer m.channelLock.Unlock()
+
+	if m.channels == nil {
+		m.channels = make(map[string]map[chan<- ChannelMessage]struct{})
+	}
+	if m.channels[channel] == nil {
+		m.channels[channel] = make(map[chan<- ChannelMessage]struct{})
+	}
+	m.channels[channel][subscriber] = struct{}{}
+}
+
+// Unsubscribe stops `subscriber` from receiving the messages published to
+// `channel`, reporting whether it was subscribed.
+func (m *MessageHandler) Unsubscribe(channel string, subscriber chan<- ChannelMessage) bool {
+	m.channelLock.Lock()
+	defer m.channelLock.Unlock()
+
+	if _, ok := m.channels[channel][subscriber]; !ok {
+		return false
+	}
+
+	delete(m.channels[channel], subscriber)
+	if len(m.channels[channel]) == 0 {
+		delete(m.channels, channel)
+	}
+
+	return true
+}
+
+// Publish sends a message to every subscriber of `channel` on this node,
+// returning how many received it. Subscribers are never waited on: one whose
+// channel is full misses the message.
+func (m *MessageHandler) Publish(channel string, message string) int {
+	m.channelLock.RLock()
+	defer m.channelLock.RUnlock()
+
+	published := ChannelMessage{Channel: channel, Message: message}
+
+	received := 0
+	for subscriber := range m.channels[channel] {
+		select {
+		case subscriber <- published:
+			received++
+		default:
+		}
+	}
+
+	return received
+}
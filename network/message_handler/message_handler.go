@@ -8,6 +8,9 @@ type MessageHandler struct {
 	AddKeyChannel        chan *KeyValPair
 	RemoveKeyChannel     chan *KeyValPair
 	messageResponseStore *map[string]chan string
+	// channels holds the subscribers of each named channel, see Publish.
+	channels    map[string]map[chan<- ChannelMessage]struct{}
+	channelLock sync.RWMutex
 	sync.RWMutex
 }
 
@@ -53,18 +56,22 @@ func (m *MessageHandler) handleKeyAdds() {
 
 	for {
 		kvPair = <-m.AddKeyChannel
+		m.AddKey(kvPair)
+	}
+}
 
-		m.Lock()
-		if _, keyExists := (*m.messageResponseStore)[kvPair.Key]; keyExists {
-			m.Unlock()
-			m.handleKeyConflict(kvPair)
-			continue
-		} else {
-			(*m.messageResponseStore)[kvPair.Key] = kvPair.Value
-		}
+// AddKey stores a key's response channel right away. Unlike sending on
+// AddKeyChannel, the key is guaranteed to be stored once AddKey returns, so
+// a request can't be answered before its response channel is known.
+func (m *MessageHandler) AddKey(kvPair *KeyValPair) {
+	m.Lock()
+	if _, keyExists := (*m.messageResponseStore)[kvPair.Key]; keyExists {
 		m.Unlock()
-
+		m.handleKeyConflict(kvPair)
+		return
 	}
+	(*m.messageResponseStore)[kvPair.Key] = kvPair.Value
+	m.Unlock()
 }
 
 // HandleKeyDeletions Handles everything associated with having to delete a
@@ -114,3 +114,48 @@ func TestRemoveKeyKeyNoExistsRespondsNil(t *testing.T) {
 		t.Fatalf("Expected nil, got %v\n", endChannel)
 	}
 }
+
+func TestAddKeyIsStoredImmediately(t *testing.T) {
+	endResponseChannel := make(chan string)
+	callbackChan := make(chan chan string)
+
+	key := NewKeyValPair("keyAddedDirectly", endResponseChannel, callbackChan)
+	MESSAGEHANDLER.AddKey(key)
+
+	// No waiting: the removal has to find the key straight away.
+	MESSAGEHANDLER.RemoveKeyChannel <- key
+
+	if endChannel := <-callbackChan; endChannel != endResponseChannel {
+		t.Fatalf("Expected %v, got %v", endResponseChannel, endChannel)
+	}
+}
+
+func TestPublishReachesSubscribers(t *testing.T) {
+	mh := NewMessageHandler()
+	news := make(chan ChannelMessage, 1)
+	alerts := make(chan ChannelMessage, 1)
+
+	mh.Subscribe("news", news)
+	mh.Subscribe("news", news)
+	mh.Subscribe("alerts", alerts)
+
+	if received := mh.Publish("news", "hello"); received != 1 {
+		t.Fatalf("Expected 1, got %v", received)
+	}
+	if message := <-news; message.Channel != "news" || message.Message != "hello" {
+		t.Fatalf("Expected news:hello, got %v", message)
+	}
+
+	// A full subscriber misses the message rather than blocking.
+	mh.Publish("alerts", "first")
+	if received := mh.Publish("alerts", "second"); received != 0 {
+		t.Fatalf("Expected 0, got %v", received)
+	}
+
+	if !mh.Unsubscribe("news", news) || mh.Unsubscribe("news", news) {
+		t.Fatalf("Expected news to be unsubscribed once")
+	}
+	if received := mh.Publish("news", "hello"); received != 0 {
+		t.Fatalf("Expected 0, got %v", received)
+	}
+}
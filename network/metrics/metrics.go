@@ -0,0 +1,203 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/GrappigPanda/Olivia/cache"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the request latency
+// histogram's buckets. Most requests are answered from memory, so they start
+// well under a millisecond.
+var latencyBuckets = []float64{
+	0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1,
+}
+
+// maxCommandLabels caps how many distinct commands get their own latency
+// histogram, so clients sending garbage can't grow the metrics without end.
+// Any command past the cap is counted as "OTHER".
+const maxCommandLabels = 64
+
+// histogram counts observations into latencyBuckets. Every field is only ever
+// touched atomically.
+type histogram struct {
+	// buckets are per bucket, not cumulative; they're summed up when
+	// written.
+	buckets []uint64
+	count   uint64
+	sumNS   uint64
+}
+
+func newHistogram() *histogram {
+	return &histogram{buckets: make([]uint64, len(latencyBuckets))}
+}
+
+func (h *histogram) observe(elapsed time.Duration) {
+	seconds := elapsed.Seconds()
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			atomic.AddUint64(&h.buckets[i], 1)
+			break
+		}
+	}
+
+	atomic.AddUint64(&h.count, 1)
+	atomic.AddUint64(&h.sumNS, uint64(elapsed.Nanoseconds()))
+}
+
+// requestLatencies holds a histogram per command.
+type requestLatencies struct {
+	histograms map[string]*histogram
+	sync.RWMutex
+}
+
+var latencies = &requestLatencies{histograms: make(map[string]*histogram)}
+
+// ObserveRequest records how long answering a `command` took.
+func ObserveRequest(command string, elapsed time.Duration) {
+	latencies.histogramOf(strings.ToUpper(command)).observe(elapsed)
+}
+
+func (l *requestLatencies) histogramOf(command string) *histogram {
+	l.RLock()
+	h, ok := l.histograms[command]
+	l.RUnlock()
+	if ok {
+		return h
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	if h, ok := l.histograms[command]; ok {
+		return h
+	}
+
+	if len(l.histograms) >= maxCommandLabels {
+		command = "OTHER"
+		if h, ok := l.histograms[command]; ok {
+			return h
+		}
+	}
+
+	h = newHistogram()
+	l.histograms[command] = h
+	return h
+}
+
+// commands returns every command with a histogram, sorted.
+func (l *requestLatencies) commands() []string {
+	l.RLock()
+	defer l.RUnlock()
+
+	commands := make([]string, 0, len(l.histograms))
+	for command := range l.histograms {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+
+	return commands
+}
+
+// Handler serves `c`'s metrics in the Prometheus text exposition format.
+func Handler(c *cache.Cache) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+		out := bufio.NewWriter(w)
+		writeCacheMetrics(out, c)
+		writeLatencies(out)
+		out.Flush()
+	})
+}
+
+// Serve serves `c`'s metrics under /metrics on `address` in the background.
+func Serve(address string, c *cache.Cache) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler(c))
+
+	go func() {
+		log.Printf("Serving metrics on %v", address)
+		if err := http.ListenAndServe(address, mux); err != nil {
+			log.Printf("Failed to serve metrics: %v", err)
+		}
+	}()
+}
+
+func writeCacheMetrics(out *bufio.Writer, c *cache.Cache) {
+	stats := c.Stats()
+
+	hitRatio := 0.0
+	if reads := stats.Hits + stats.Misses; reads > 0 {
+		hitRatio = float64(stats.Hits) / float64(reads)
+	}
+
+	writeMetric(out, "olivia_cache_hits_total", "counter", "Reads which found their key.", stats.Hits)
+	writeMetric(out, "olivia_cache_misses_total", "counter", "Reads which didn't find their key.", stats.Misses)
+	writeMetric(out, "olivia_cache_hit_ratio", "gauge", "Fraction of reads which found their key.", hitRatio)
+	writeMetric(out, "olivia_cache_sets_total", "counter", "Writes which stored a value.", stats.Sets)
+	writeMetric(out, "olivia_cache_expirations_total", "counter", "Keys removed because their TTL ran out.", stats.Expirations)
+	writeMetric(out, "olivia_cache_evictions_total", "counter", "Keys evicted to stay within the cache's limits.", stats.LRUEvictions)
+	writeMetric(out, "olivia_cache_keys", "gauge", "Keys the cache holds.", stats.Keys)
+	writeMetric(out, "olivia_cache_expiration_heap_size", "gauge", "Keys waiting to expire.", c.ExpirationCount())
+	writeMetric(out, "olivia_bloomfilter_fill_ratio", "gauge", "Fraction of the bloom filter's bits which are set.", c.BloomFillRatio())
+	writeMetric(out, "olivia_bloomfilter_estimated_keys", "gauge", "Keys the bloom filter is estimated to hold.", stats.BloomfilterEstimatedKeys)
+	writeMetric(out, "olivia_bloomfilter_fp_rate", "gauge", "Estimated false-positive rate of the bloom filter.", stats.BloomfilterFPRate)
+
+	peerStates := make(map[string]int)
+	for _, info := range c.PeerInfo() {
+		peerStates[info.Status.String()]++
+	}
+
+	states := make([]string, 0, len(peerStates))
+	for state := range peerStates {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+
+	writeHeader(out, "olivia_peers", "gauge", "Known peers by connection state.")
+	for _, state := range states {
+		fmt.Fprintf(out, "olivia_peers{state=%q} %d\n", state, peerStates[state])
+	}
+}
+
+func writeLatencies(out *bufio.Writer) {
+	const name = "olivia_request_duration_seconds"
+	writeHeader(out, name, "histogram", "Time taken to answer requests, by command.")
+
+	for _, command := range latencies.commands() {
+		h := latencies.histogramOf(command)
+
+		cumulative := uint64(0)
+		for i, bound := range latencyBuckets {
+			cumulative += atomic.LoadUint64(&h.buckets[i])
+			fmt.Fprintf(out, "%s_bucket{command=%q,le=\"%g\"} %d\n", name, command, bound, cumulative)
+		}
+
+		// An observation may land in its bucket before it's counted.
+		count := atomic.LoadUint64(&h.count)
+		if count < cumulative {
+			count = cumulative
+		}
+		sum := time.Duration(atomic.LoadUint64(&h.sumNS)).Seconds()
+		fmt.Fprintf(out, "%s_bucket{command=%q,le=\"+Inf\"} %d\n", name, command, count)
+		fmt.Fprintf(out, "%s_sum{command=%q} %g\n", name, command, sum)
+		fmt.Fprintf(out, "%s_count{command=%q} %d\n", name, command, count)
+	}
+}
+
+func writeHeader(out *bufio.Writer, name string, kind string, help string) {
+	fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func writeMetric(out *bufio.Writer, name string, kind string, help string, value interface{}) {
+	writeHeader(out, name, kind, help)
+	fmt.Fprintf(out, "%s %v\n", name, value)
+}
@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"fmt"
+	"github.com/GrappigPanda/Olivia/cache"
+	"github.com/GrappigPanda/Olivia/config"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func scrape(t *testing.T, c *cache.Cache) string {
+	server := httptest.NewServer(Handler(c))
+	defer server.Close()
+
+	response, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	return string(body)
+}
+
+func TestHandlerPublishesCacheMetrics(t *testing.T) {
+	c := cache.NewCache(nil, &config.Cfg{BloomfilterSize: 1000, IsTesting: true})
+	c.Set("key", "value")
+	c.SetExpiration("expiring", "value", 60)
+	c.Get("key")
+	c.Get("missing")
+
+	body := scrape(t, c)
+	for _, expected := range []string{
+		"# TYPE olivia_cache_hits_total counter\nolivia_cache_hits_total 1\n",
+		"olivia_cache_misses_total 1\n",
+		"olivia_cache_hit_ratio 0.5\n",
+		"# TYPE olivia_cache_keys gauge\nolivia_cache_keys 2\n",
+		"olivia_cache_expiration_heap_size 1\n",
+		"# TYPE olivia_bloomfilter_fill_ratio gauge\n",
+		"olivia_bloomfilter_estimated_keys 2\n",
+		"# TYPE olivia_peers gauge\n",
+		"# TYPE olivia_request_duration_seconds histogram\n",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Fatalf("Expected %q in %v", expected, body)
+		}
+	}
+}
+
+func TestObserveRequestFillsBuckets(t *testing.T) {
+	ObserveRequest("ping", 200*time.Microsecond)
+	ObserveRequest("PING", 2*time.Second)
+
+	body := scrape(t, cache.NewCache(nil, &config.Cfg{BloomfilterSize: 1000, IsTesting: true}))
+	for _, expected := range []string{
+		`olivia_request_duration_seconds_bucket{command="PING",le="0.0001"} 0`,
+		`olivia_request_duration_seconds_bucket{command="PING",le="0.00025"} 1`,
+		`olivia_request_duration_seconds_bucket{command="PING",le="1"} 1`,
+		`olivia_request_duration_seconds_bucket{command="PING",le="+Inf"} 2`,
+		`olivia_request_duration_seconds_sum{command="PING"} 2.0002`,
+		`olivia_request_duration_seconds_count{command="PING"} 2`,
+	} {
+		if !strings.Contains(body, expected+"\n") {
+			t.Fatalf("Expected %q in %v", expected, body)
+		}
+	}
+}
+
+func TestCommandLabelsAreCapped(t *testing.T) {
+	for i := 0; i < 2*maxCommandLabels; i++ {
+		ObserveRequest(fmt.Sprintf("GARBAGE%d", i), time.Millisecond)
+	}
+
+	if commands := latencies.commands(); len(commands) > maxCommandLabels+1 {
+		t.Fatalf("Expected at most %v commands, got %v", maxCommandLabels+1, len(commands))
+	}
+
+	if _, ok := latencies.histograms["OTHER"]; !ok {
+		t.Fatalf("Expected commands past the cap to be counted as OTHER")
+	}
+}
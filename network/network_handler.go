@@ -7,8 +7,9 @@ import (
 	"github.com/GrappigPanda/Olivia/network/message_handler"
 )
 
-// doing any error checking (in the future) as well as ensuring that it
-// continues running.
+// StartIncomingNetwork starts the incoming network router and runs until
+// `mainStopChan` is signalled or closed, at which point the router stops
+// accepting connections and it returns. A nil `mainStopChan` runs it forever.
 func StartIncomingNetwork(
 	mh *message_handler.MessageHandler,
 	cache *cache.Cache,
@@ -16,14 +17,7 @@ func StartIncomingNetwork(
 	mainStopChan chan struct{},
 ) {
 	networkRouterStopChan := incomingNetwork.StartNetworkRouter(mh, cache, config)
-	// TODO(ian): Clean up this for statement, it's technical debt.
-	for {
-		select {
-		default:
-			continue
-		case <-mainStopChan:
-			networkRouterStopChan <- struct{}{}
-			break
-		}
-	}
+
+	<-mainStopChan
+	networkRouterStopChan <- struct{}{}
 }
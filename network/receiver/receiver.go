@@ -2,7 +2,9 @@ package network_receiver
 
 import (
 	"bufio"
+	"fmt"
 	. "github.com/GrappigPanda/Olivia/network/message_handler"
+	"github.com/GrappigPanda/Olivia/parser"
 	"log"
 	"net"
 	"strings"
@@ -25,16 +27,22 @@ func NewReceiver(messageStore *MessageHandler, conn *net.Conn) *Receiver {
 	}
 }
 
+// Run reads responses off of the connection until it's closed. Framed values
+// are read in full and handed along with their response line.
 func (r *Receiver) Run() {
 	reader := bufio.NewReader(*r.conn)
 	for {
-		buffer, _, err := reader.ReadLine()
+		line, payloads, err := parser.ReadFramed(reader)
 		if err != nil {
-			(*r.conn).Write([]byte("Invalid Command"))
-			continue
+			log.Printf("Receiver stopping, failed to read: %v", err)
+			return
 		}
 
-		go r.processIncomingString(string(buffer))
+		if len(payloads) > 0 {
+			line = parser.AppendPayloads(fmt.Sprintf("%s\n", line), payloads)
+		}
+
+		go r.processIncomingString(line)
 	}
 }
 
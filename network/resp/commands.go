@@ -0,0 +1,528 @@
+package resp
+
+import (
+	"github.com/GrappigPanda/Olivia/cache"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// command is a Redis command Olivia understands. `arity` counts the command's
+// name too, like Redis's: positive means exactly that many arguments,
+// negative at least that many.
+type command struct {
+	run        func(s *session, args []string) reply
+	arity      int
+	beforeAuth bool
+}
+
+var commands = map[string]command{
+	"PING":    {ping, -1, true},
+	"ECHO":    {echo, 2, false},
+	"QUIT":    {quit, 1, true},
+	"AUTH":    {auth, -2, true},
+	"COMMAND": {commandInfo, -1, false},
+	"CLIENT":  {client, -2, false},
+	"SELECT":  {selectNamespace, 2, false},
+	"GET":     {get, 2, false},
+	"MGET":    {mget, -2, false},
+	"SET":     {set, -3, false},
+	"SETEX":   {setex, 4, false},
+	"SETNX":   {setnx, 3, false},
+	"MSET":    {mset, -3, false},
+	"DEL":     {del, -2, false},
+	"EXISTS":  {exists, -2, false},
+	"EXPIRE":  {expire, 3, false},
+	"TTL":     {ttl, 2, false},
+	"PERSIST": {persist, 2, false},
+	"INCR":    {incrBy(1), 2, false},
+	"DECR":    {incrBy(-1), 2, false},
+	"INCRBY":  {incrBy(1), 3, false},
+	"DECRBY":  {incrBy(-1), 3, false},
+	"SCAN":    {scan, -2, false},
+	"KEYS":    {keys, 2, false},
+	"DBSIZE":  {dbsize, 1, false},
+	"LPUSH":   {push(true), -3, false},
+	"RPUSH":   {push(false), -3, false},
+	"LPOP":    {lpop, 2, false},
+	"LRANGE":  {lrange, 4, false},
+	"HSET":    {hset, -4, false},
+	"HGET":    {hget, 3, false},
+	"HGETALL": {hgetall, 2, false},
+}
+
+func ping(s *session, args []string) reply {
+	if len(args) > 0 {
+		return bulkString(args[0])
+	}
+
+	return simpleString("PONG")
+}
+
+func echo(s *session, args []string) reply {
+	return bulkString(args[0])
+}
+
+func quit(s *session, args []string) reply {
+	return ok
+}
+
+// auth checks the password against the cluster secrets, or, when a username
+// precedes it, against that user's secret. The "default" username is the
+// same as giving none, as with Redis.
+func auth(s *session, args []string) reply {
+	if !s.cache.RequiresAuth() {
+		return errorf("AUTH called without any password configured")
+	}
+
+	name := ""
+	if len(args) > 1 && args[0] != "default" {
+		name = args[0]
+	}
+
+	permissions, authed := s.cache.Authenticate(name, args[len(args)-1])
+	if !authed {
+		return errorReply("WRONGPASS invalid password")
+	}
+
+	s.permissions = permissions
+	return ok
+}
+
+// commandInfo answers the COMMAND introspection clients send on connecting
+// with an empty list, which they take as there being nothing to learn.
+func commandInfo(s *session, args []string) reply {
+	return array{}
+}
+
+// client accepts the CLIENT SETNAME/SETINFO clients send on connecting
+// without acting on them.
+func client(s *session, args []string) reply {
+	return ok
+}
+
+// selectNamespace switches the session to a namespace. Redis clients select
+// databases by number, so database 0 is the default namespace and any other
+// is the namespace named after it.
+func selectNamespace(s *session, args []string) reply {
+	name := args[0]
+	if name == "0" {
+		name = cache.DefaultNamespace
+	}
+
+	namespace, err := s.cache.Namespace(name)
+	if err != nil {
+		return errorf("%v", err)
+	}
+
+	s.cache = namespace
+	return ok
+}
+
+func get(s *session, args []string) reply {
+	value, err := s.cache.Get(args[0])
+	if err == cache.ErrWrongType {
+		return wrongType
+	}
+	if err != nil {
+		return nullBulk{}
+	}
+
+	return bulkString(value)
+}
+
+func mget(s *session, args []string) reply {
+	found := s.cache.GetMany(args)
+
+	values := make(array, len(args))
+	for i, key := range args {
+		if value, ok := found[key]; ok {
+			values[i] = bulkString(value)
+		} else {
+			values[i] = nullBulk{}
+		}
+	}
+
+	return values
+}
+
+// set supports SET's EX, PX, NX and XX options.
+func set(s *session, args []string) reply {
+	key, value := args[0], args[1]
+
+	timeout := -1
+	onlyIfMissing, onlyIfExists := false, false
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			onlyIfMissing = true
+		case "XX":
+			onlyIfExists = true
+		case "EX", "PX":
+			if i+1 == len(args) {
+				return errorf("syntax error")
+			}
+
+			amount, err := strconv.Atoi(args[i+1])
+			if err != nil || amount <= 0 {
+				return errorf("invalid expire time in 'set' command")
+			}
+
+			timeout = amount
+			if strings.ToUpper(args[i]) == "PX" {
+				// TTLs are kept in whole seconds.
+				timeout = (amount + 999) / 1000
+			}
+			i++
+		default:
+			return errorf("syntax error")
+		}
+	}
+
+	if onlyIfMissing && onlyIfExists {
+		return errorf("syntax error")
+	}
+
+	if onlyIfMissing || onlyIfExists {
+		written, err := s.cache.SetIf(key, value, onlyIfExists, timeout)
+		if err != nil {
+			return errorf("%v", err)
+		}
+		if !written {
+			return nullBulk{}
+		}
+
+		return ok
+	}
+
+	var err error
+	if timeout >= 0 {
+		err = s.cache.SetExpiration(key, value, timeout)
+	} else {
+		err = s.cache.Set(key, value)
+	}
+	if err != nil {
+		return errorf("%v", err)
+	}
+
+	return ok
+}
+
+// setnx sets a key only if it's missing, answering 1 if it was set and 0 if
+// it wasn't.
+func setnx(s *session, args []string) reply {
+	written, err := s.cache.SetIf(args[0], args[1], false, -1)
+	if err != nil {
+		return errorf("%v", err)
+	}
+	if !written {
+		return integer(0)
+	}
+
+	return integer(1)
+}
+
+func setex(s *session, args []string) reply {
+	timeout, err := strconv.Atoi(args[1])
+	if err != nil || timeout <= 0 {
+		return errorf("invalid expire time in 'setex' command")
+	}
+
+	if err := s.cache.SetExpiration(args[0], args[2], timeout); err != nil {
+		return errorf("%v", err)
+	}
+
+	return ok
+}
+
+func mset(s *session, args []string) reply {
+	if len(args)%2 != 0 {
+		return errorf("wrong number of arguments for 'mset' command")
+	}
+
+	entries := make(map[string]string, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		entries[args[i]] = args[i+1]
+	}
+
+	if err := s.cache.MSet(entries); err != nil {
+		return errorf("%v", err)
+	}
+
+	return ok
+}
+
+func del(s *session, args []string) reply {
+	deleted := 0
+	for _, key := range args {
+		if err := s.cache.Delete(key); err == nil {
+			deleted++
+		}
+	}
+
+	return integer(deleted)
+}
+
+func exists(s *session, args []string) reply {
+	found := 0
+	for _, key := range args {
+		if _, err := s.cache.Get(key); err == nil {
+			found++
+		}
+	}
+
+	return integer(found)
+}
+
+func expire(s *session, args []string) reply {
+	timeout, err := strconv.Atoi(args[1])
+	if err != nil {
+		return errorf("value is not an integer or out of range")
+	}
+
+	// Redis deletes keys given a TTL in the past right away.
+	if timeout <= 0 {
+		if err := s.cache.Delete(args[0]); err != nil {
+			return integer(0)
+		}
+
+		return integer(1)
+	}
+
+	if err := s.cache.Expire(args[0], timeout); err != nil {
+		return integer(0)
+	}
+
+	return integer(1)
+}
+
+// ttl answers like Redis: -2 for a missing key, -1 for one which never
+// expires.
+func ttl(s *session, args []string) reply {
+	seconds, err := s.cache.GetTTL(args[0])
+	if err != nil {
+		return integer(-2)
+	}
+
+	return integer(seconds)
+}
+
+func persist(s *session, args []string) reply {
+	if removed, err := s.cache.Persist(args[0]); err != nil || !removed {
+		return integer(0)
+	}
+
+	return integer(1)
+}
+
+// incrBy builds INCR/DECR and INCRBY/DECRBY, `sign` telling which way.
+func incrBy(sign int64) func(s *session, args []string) reply {
+	return func(s *session, args []string) reply {
+		delta := int64(1)
+		if len(args) > 1 {
+			parsed, err := strconv.ParseInt(args[1], 10, 64)
+			if err != nil {
+				return errorf("value is not an integer or out of range")
+			}
+			delta = parsed
+		}
+
+		next, err := s.cache.Increment(args[0], sign*delta)
+		if err == cache.ErrNotAnInteger {
+			return errorf("value is not an integer or out of range")
+		} else if err != nil {
+			return errorf("%v", err)
+		}
+
+		return integer(next)
+	}
+}
+
+// scan supports SCAN's MATCH and COUNT options.
+func scan(s *session, args []string) reply {
+	cursor, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return errorf("invalid cursor")
+	}
+
+	pattern, count := "", 0
+	for i := 1; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			return errorf("syntax error")
+		}
+
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			pattern = args[i+1]
+		case "COUNT":
+			if count, err = strconv.Atoi(args[i+1]); err != nil || count <= 0 {
+				return errorf("value is not an integer or out of range")
+			}
+		default:
+			return errorf("syntax error")
+		}
+	}
+
+	matched, next, err := s.cache.Scan(cursor, pattern, count)
+	if err != nil {
+		return errorf("%v", err)
+	}
+
+	keys := make(array, len(matched))
+	for i, key := range matched {
+		keys[i] = bulkString(key)
+	}
+
+	return array{bulkString(strconv.FormatUint(next, 10)), keys}
+}
+
+// keys scans every key at once. Like Redis's KEYS, it's meant for debugging
+// rather than production use.
+func keys(s *session, args []string) reply {
+	var matched array
+	cursor := uint64(0)
+	for {
+		batch, next, err := s.cache.Scan(cursor, args[0], 0)
+		if err != nil {
+			return errorf("%v", err)
+		}
+
+		for _, key := range batch {
+			matched = append(matched, bulkString(key))
+		}
+
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+
+	if matched == nil {
+		return array{}
+	}
+
+	return matched
+}
+
+func dbsize(s *session, args []string) reply {
+	return integer(s.cache.Stats().Keys)
+}
+
+// wrongType is Redis's error for a command run against a key of another type.
+var wrongType = errorReply("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+// push builds LPUSH and RPUSH, `head` telling which end to push onto.
+func push(head bool) func(s *session, args []string) reply {
+	return func(s *session, args []string) reply {
+		pushList := s.cache.RPush
+		if head {
+			pushList = s.cache.LPush
+		}
+
+		length, err := pushList(args[0], 0, args[1:]...)
+		if err == cache.ErrWrongType {
+			return wrongType
+		}
+		if err != nil {
+			return errorf("%v", err)
+		}
+
+		return integer(length)
+	}
+}
+
+func lpop(s *session, args []string) reply {
+	value, err := s.cache.LPop(args[0])
+	if err == cache.ErrWrongType {
+		return wrongType
+	}
+	if err != nil {
+		return nullBulk{}
+	}
+
+	return bulkString(value)
+}
+
+func lrange(s *session, args []string) reply {
+	start, err := strconv.Atoi(args[1])
+	if err != nil {
+		return errorf("value is not an integer or out of range")
+	}
+	stop, err := strconv.Atoi(args[2])
+	if err != nil {
+		return errorf("value is not an integer or out of range")
+	}
+
+	items, err := s.cache.LRange(args[0], start, stop)
+	if err == cache.ErrWrongType {
+		return wrongType
+	}
+	if err != nil {
+		return errorf("%v", err)
+	}
+
+	values := make(array, len(items))
+	for i, item := range items {
+		values[i] = bulkString(item)
+	}
+
+	return values
+}
+
+func hset(s *session, args []string) reply {
+	if len(args)%2 != 1 {
+		return errorf("wrong number of arguments for 'hset' command")
+	}
+
+	fields := make(map[string]string, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		fields[args[i]] = args[i+1]
+	}
+
+	added, err := s.cache.HSet(args[0], fields)
+	if err == cache.ErrWrongType {
+		return wrongType
+	}
+	if err != nil {
+		return errorf("%v", err)
+	}
+
+	return integer(added)
+}
+
+func hget(s *session, args []string) reply {
+	fields, err := s.cache.HGetAll(args[0])
+	if err == cache.ErrWrongType {
+		return wrongType
+	}
+
+	value, ok := fields[args[1]]
+	if err != nil || !ok {
+		return nullBulk{}
+	}
+
+	return bulkString(value)
+}
+
+// hgetall answers with every field followed by its value, sorted by field.
+func hgetall(s *session, args []string) reply {
+	fields, err := s.cache.HGetAll(args[0])
+	if err == cache.ErrWrongType {
+		return wrongType
+	}
+	if err != nil {
+		return errorf("%v", err)
+	}
+
+	names := make([]string, 0, len(fields))
+	for field := range fields {
+		names = append(names, field)
+	}
+	sort.Strings(names)
+
+	values := make(array, 0, 2*len(names))
+	for _, field := range names {
+		values = append(values, bulkString(field), bulkString(fields[field]))
+	}
+
+	return values
+}
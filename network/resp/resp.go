@@ -0,0 +1,154 @@
+package resp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxArrayLength caps how many arguments a single command can have.
+const maxArrayLength = 1024 * 1024
+
+// ProtocolError is returned for input which isn't valid RESP. The connection
+// can't be resynchronized afterwards, so it's closed.
+type ProtocolError struct {
+	Reason string
+}
+
+func (e *ProtocolError) Error() string {
+	return fmt.Sprintf("Protocol error: %s", e.Reason)
+}
+
+// readCommand reads a single command, either an array of bulk strings (what
+// Redis clients send) or an inline command (what a person typing into telnet
+// sends). `maxBytes` caps the command's size; non-positive means no cap.
+func readCommand(reader *bufio.Reader, maxBytes int) ([]string, error) {
+	line, err := readLine(reader, maxBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+
+	count, err := strconv.Atoi(line[1:])
+	if err != nil || count < 0 || count > maxArrayLength {
+		return nil, &ProtocolError{"invalid multibulk length"}
+	}
+
+	// The count comes from the client, so the arguments are only allocated
+	// as they arrive.
+	size := len(line)
+	var args []string
+	for i := 0; i < count; i++ {
+		header, err := readLine(reader, maxBytes)
+		if err != nil {
+			return nil, err
+		}
+
+		if !strings.HasPrefix(header, "$") {
+			return nil, &ProtocolError{fmt.Sprintf("expected '$', got %q", header)}
+		}
+
+		length, err := strconv.Atoi(header[1:])
+		if err != nil || length < 0 {
+			return nil, &ProtocolError{"invalid bulk length"}
+		}
+
+		size += len(header) + length
+		if maxBytes > 0 && size > maxBytes {
+			return nil, &ProtocolError{fmt.Sprintf("command exceeds the maximum of %d bytes", maxBytes)}
+		}
+
+		bulk := make([]byte, length+2)
+		if _, err := io.ReadFull(reader, bulk); err != nil {
+			return nil, err
+		}
+		if string(bulk[length:]) != "\r\n" {
+			return nil, &ProtocolError{"bulk string isn't terminated by CRLF"}
+		}
+
+		args = append(args, string(bulk[:length]))
+	}
+
+	return args, nil
+}
+
+// readLine reads a line, without its line ending, failing once more than
+// `maxBytes` have been read without finding one.
+func readLine(reader *bufio.Reader, maxBytes int) (string, error) {
+	var line []byte
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if maxBytes > 0 && len(line)+len(chunk) > maxBytes {
+			return "", &ProtocolError{fmt.Sprintf("command exceeds the maximum of %d bytes", maxBytes)}
+		}
+		line = append(line, chunk...)
+
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		return strings.TrimRight(string(line), "\r\n"), nil
+	}
+}
+
+// reply is a RESP value sent in response to a command.
+type reply interface {
+	writeTo(w *bufio.Writer)
+}
+
+type simpleString string
+
+func (s simpleString) writeTo(w *bufio.Writer) {
+	fmt.Fprintf(w, "+%s\r\n", string(s))
+}
+
+// errorReply is sent as is, so it should start with an error code such as
+// "ERR".
+type errorReply string
+
+func (e errorReply) writeTo(w *bufio.Writer) {
+	fmt.Fprintf(w, "-%s\r\n", strings.NewReplacer("\r", " ", "\n", " ").Replace(string(e)))
+}
+
+type integer int64
+
+func (i integer) writeTo(w *bufio.Writer) {
+	fmt.Fprintf(w, ":%d\r\n", int64(i))
+}
+
+type bulkString string
+
+func (b bulkString) writeTo(w *bufio.Writer) {
+	fmt.Fprintf(w, "$%d\r\n%s\r\n", len(b), string(b))
+}
+
+// nullBulk is the reply for a missing value.
+type nullBulk struct{}
+
+func (nullBulk) writeTo(w *bufio.Writer) {
+	w.WriteString("$-1\r\n")
+}
+
+type array []reply
+
+func (a array) writeTo(w *bufio.Writer) {
+	fmt.Fprintf(w, "*%d\r\n", len(a))
+	for _, item := range a {
+		item.writeTo(w)
+	}
+}
+
+var ok = simpleString("OK")
+
+// errorf builds an "ERR" error reply.
+func errorf(format string, args ...interface{}) errorReply {
+	return errorReply("ERR " + fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,69 @@
+package resp
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestReadCommandArray(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader("*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$12\r\nvalue\r\nwith:\r\n"))
+
+	args, err := readCommand(reader, 0)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	expected := []string{"SET", "key", "value\r\nwith:"}
+	if len(args) != len(expected) {
+		t.Fatalf("Expected %q, got %q", expected, args)
+	}
+	for i := range expected {
+		if args[i] != expected[i] {
+			t.Fatalf("Expected %q, got %q", expected, args)
+		}
+	}
+}
+
+func TestReadCommandInline(t *testing.T) {
+	args, err := readCommand(bufio.NewReader(strings.NewReader("GET  key\r\n")), 0)
+	if err != nil || len(args) != 2 || args[0] != "GET" || args[1] != "key" {
+		t.Fatalf("Expected [GET key], got %q (%v)", args, err)
+	}
+}
+
+func TestReadCommandRefusesBadInput(t *testing.T) {
+	for _, input := range []string{
+		"*x\r\n",
+		"*-1\r\n",
+		"*1\r\n:1\r\n",
+		"*1\r\n$-3\r\n",
+		"*1\r\n$3\r\nkeyXX",
+		"*1\r\n$100\r\n",
+	} {
+		_, err := readCommand(bufio.NewReader(strings.NewReader(input)), 64)
+		if _, ok := err.(*ProtocolError); !ok {
+			t.Fatalf("Expected a protocol error for %q, got %v", input, err)
+		}
+	}
+}
+
+func TestReplies(t *testing.T) {
+	var buffer strings.Builder
+	writer := bufio.NewWriter(&buffer)
+
+	array{
+		ok,
+		errorf("bad\r\nthing"),
+		integer(-2),
+		bulkString("a\r\nb"),
+		nullBulk{},
+		array{},
+	}.writeTo(writer)
+	writer.Flush()
+
+	expected := "*6\r\n+OK\r\n-ERR bad  thing\r\n:-2\r\n$4\r\na\r\nb\r\n$-1\r\n*0\r\n"
+	if buffer.String() != expected {
+		t.Fatalf("Expected %q, got %q", expected, buffer.String())
+	}
+}
@@ -0,0 +1,126 @@
+package resp
+
+import (
+	"bufio"
+	"github.com/GrappigPanda/Olivia/acl"
+	"github.com/GrappigPanda/Olivia/cache"
+	"github.com/GrappigPanda/Olivia/config"
+	"github.com/GrappigPanda/Olivia/network/metrics"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+// Listen accepts Redis clients on `address` in the background, translating
+// their commands into operations on `c`. Closing the returned listener stops
+// accepting connections.
+func Listen(address string, c *cache.Cache, config *config.Cfg) (net.Listener, error) {
+	listener, err := config.Listen(address)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Accepting RESP connections on %v", listener.Addr())
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				log.Printf("Stopped accepting RESP connections: %v", err)
+				return
+			}
+
+			go newSession(c).serve(conn, config.MaxMessageBytes)
+		}
+	}()
+
+	return listener, nil
+}
+
+// session is a single client connection's state.
+type session struct {
+	// cache is the namespace SELECT last picked.
+	cache *cache.Cache
+	// permissions are the commands the client may run, nil until it
+	// authenticates.
+	permissions *acl.Permissions
+}
+
+func newSession(c *cache.Cache) *session {
+	s := &session{cache: c}
+	if !c.RequiresAuth() {
+		s.permissions = acl.All
+	}
+
+	return s
+}
+
+// serve answers the commands sent over `conn` until it's closed, it sends
+// QUIT, or it sends something which isn't RESP.
+func (s *session) serve(conn net.Conn, maxMessageBytes int) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+
+	for {
+		args, err := readCommand(reader, maxMessageBytes)
+		if protocolErr, ok := err.(*ProtocolError); ok {
+			errorReply("ERR " + protocolErr.Error()).writeTo(writer)
+			writer.Flush()
+			return
+		} else if err != nil {
+			if err != io.EOF {
+				log.Printf("RESP connection %v failed to read: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+
+		if len(args) == 0 {
+			continue
+		}
+
+		done := s.cache.StartRequest()
+		started := time.Now()
+		s.execute(args).writeTo(writer)
+		metrics.ObserveRequest(args[0], time.Since(started))
+		done()
+
+		// Pipelined commands are answered together.
+		if reader.Buffered() == 0 {
+			if err := writer.Flush(); err != nil {
+				return
+			}
+		}
+
+		if strings.ToUpper(args[0]) == "QUIT" {
+			writer.Flush()
+			return
+		}
+	}
+}
+
+// execute runs a single command, `args[0]` being its name.
+func (s *session) execute(args []string) reply {
+	name := strings.ToUpper(args[0])
+
+	command, ok := commands[name]
+	if !ok {
+		return errorf("unknown command '%s'", args[0])
+	}
+
+	if command.arity > 0 && len(args) != command.arity ||
+		command.arity < 0 && len(args) < -command.arity {
+		return errorf("wrong number of arguments for '%s' command", strings.ToLower(name))
+	}
+
+	if s.permissions == nil && !command.beforeAuth {
+		return errorReply("NOAUTH Authentication required.")
+	}
+	if !command.beforeAuth && !s.permissions.Allows(name) {
+		return errorReply("NOPERM this user has no permissions to run the '" + strings.ToLower(name) + "' command")
+	}
+
+	return command.run(s, args[1:])
+}
@@ -0,0 +1,263 @@
+package resp
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/GrappigPanda/Olivia/cache"
+	"github.com/GrappigPanda/Olivia/config"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type testClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func newTestClient(t *testing.T, cfg *config.Cfg) (*testClient, func()) {
+	c := cache.NewCache(nil, cfg)
+	listener, err := Listen("127.0.0.1:0", c, cfg)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	return &testClient{conn, bufio.NewReader(conn)}, func() {
+		conn.Close()
+		listener.Close()
+		c.Stop()
+	}
+}
+
+func testConfig() *config.Cfg {
+	return &config.Cfg{BloomfilterSize: 1000, IsTesting: true, MaxNamespaces: 2}
+}
+
+// do sends a command and returns its reply as raw RESP.
+func (c *testClient) do(t *testing.T, args ...string) string {
+	command := fmt.Sprintf("*%d\r\n", len(args))
+	for _, arg := range args {
+		command += fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	if _, err := c.conn.Write([]byte(command)); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	return c.readReply(t)
+}
+
+func (c *testClient) readReply(t *testing.T) string {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	switch line[0] {
+	case '$':
+		length, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if length < 0 {
+			return line
+		}
+
+		bulk := make([]byte, length+2)
+		if _, err := io.ReadFull(c.reader, bulk); err != nil {
+			t.Fatalf("%v", err)
+		}
+		return line + string(bulk)
+	case '*':
+		count, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		for i := 0; i < count; i++ {
+			line += c.readReply(t)
+		}
+	}
+
+	return line
+}
+
+func expectReply(t *testing.T, expected string, reply string) {
+	if reply != expected {
+		t.Fatalf("Expected %q, got %q", expected, reply)
+	}
+}
+
+func TestGetSetDelOverRESP(t *testing.T) {
+	client, cleanup := newTestClient(t, testConfig())
+	defer cleanup()
+
+	expectReply(t, "+PONG\r\n", client.do(t, "PING"))
+	expectReply(t, "+OK\r\n", client.do(t, "SET", "key", "a value:\r\nwith, everything"))
+	expectReply(t, "$26\r\na value:\r\nwith, everything\r\n", client.do(t, "GET", "key"))
+	expectReply(t, "$-1\r\n", client.do(t, "GET", "missing"))
+	expectReply(t, "*2\r\n$26\r\na value:\r\nwith, everything\r\n$-1\r\n", client.do(t, "MGET", "key", "missing"))
+	expectReply(t, ":1\r\n", client.do(t, "EXISTS", "key", "missing"))
+	expectReply(t, ":1\r\n", client.do(t, "DEL", "key", "missing"))
+	expectReply(t, "$-1\r\n", client.do(t, "GET", "key"))
+	expectReply(t, "-ERR unknown command 'SADD'\r\n", client.do(t, "SADD", "key", "member"))
+	expectReply(t, "-ERR wrong number of arguments for 'get' command\r\n", client.do(t, "GET"))
+}
+
+func TestExpireOverRESP(t *testing.T) {
+	client, cleanup := newTestClient(t, testConfig())
+	defer cleanup()
+
+	expectReply(t, ":-2\r\n", client.do(t, "TTL", "key"))
+	expectReply(t, "+OK\r\n", client.do(t, "SET", "key", "value", "EX", "100"))
+	expectReply(t, ":100\r\n", client.do(t, "TTL", "key"))
+	expectReply(t, ":1\r\n", client.do(t, "EXPIRE", "key", "50"))
+	expectReply(t, ":50\r\n", client.do(t, "TTL", "key"))
+	expectReply(t, ":1\r\n", client.do(t, "PERSIST", "key"))
+	expectReply(t, ":-1\r\n", client.do(t, "TTL", "key"))
+	expectReply(t, ":0\r\n", client.do(t, "EXPIRE", "missing", "50"))
+	expectReply(t, "+OK\r\n", client.do(t, "SETEX", "other", "10", "value"))
+	expectReply(t, ":10\r\n", client.do(t, "TTL", "other"))
+}
+
+func TestSetOptionsOverRESP(t *testing.T) {
+	client, cleanup := newTestClient(t, testConfig())
+	defer cleanup()
+
+	expectReply(t, "$-1\r\n", client.do(t, "SET", "key", "value", "XX"))
+	expectReply(t, "+OK\r\n", client.do(t, "SET", "key", "first", "NX"))
+	expectReply(t, "$-1\r\n", client.do(t, "SET", "key", "second", "NX"))
+	expectReply(t, "$5\r\nfirst\r\n", client.do(t, "GET", "key"))
+	expectReply(t, "+OK\r\n", client.do(t, "SET", "key", "third", "XX", "PX", "1500"))
+	expectReply(t, ":2\r\n", client.do(t, "TTL", "key"))
+	expectReply(t, "-ERR syntax error\r\n", client.do(t, "SET", "key", "value", "NX", "XX"))
+	expectReply(t, "-ERR syntax error\r\n", client.do(t, "SET", "key", "value", "EX"))
+
+	expectReply(t, ":1\r\n", client.do(t, "SETNX", "other", "first"))
+	expectReply(t, ":0\r\n", client.do(t, "SETNX", "other", "second"))
+	expectReply(t, "$5\r\nfirst\r\n", client.do(t, "GET", "other"))
+}
+
+func TestListsOverRESP(t *testing.T) {
+	client, cleanup := newTestClient(t, testConfig())
+	defer cleanup()
+
+	expectReply(t, ":2\r\n", client.do(t, "RPUSH", "jobs", "job1", "job2"))
+	expectReply(t, ":3\r\n", client.do(t, "LPUSH", "jobs", "job0"))
+	expectReply(t, "*2\r\n$4\r\njob1\r\n$4\r\njob2\r\n", client.do(t, "LRANGE", "jobs", "1", "-1"))
+	expectReply(t, "$4\r\njob0\r\n", client.do(t, "LPOP", "jobs"))
+	expectReply(t, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n", client.do(t, "GET", "jobs"))
+	expectReply(t, "+OK\r\n", client.do(t, "SET", "key", "value"))
+	expectReply(t, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n", client.do(t, "LPUSH", "key", "value"))
+	expectReply(t, "$-1\r\n", client.do(t, "LPOP", "missing"))
+}
+
+func TestHashesOverRESP(t *testing.T) {
+	client, cleanup := newTestClient(t, testConfig())
+	defer cleanup()
+
+	expectReply(t, ":2\r\n", client.do(t, "HSET", "user1", "name", "ian", "age", "29"))
+	expectReply(t, ":0\r\n", client.do(t, "HSET", "user1", "age", "30"))
+	expectReply(t, "$2\r\n30\r\n", client.do(t, "HGET", "user1", "age"))
+	expectReply(t, "$-1\r\n", client.do(t, "HGET", "user1", "missing"))
+	expectReply(t, "*4\r\n$3\r\nage\r\n$2\r\n30\r\n$4\r\nname\r\n$3\r\nian\r\n", client.do(t, "HGETALL", "user1"))
+	expectReply(t, "*0\r\n", client.do(t, "HGETALL", "missing"))
+	expectReply(t, "-ERR wrong number of arguments for 'hset' command\r\n", client.do(t, "HSET", "user1", "name", "ian", "age"))
+	expectReply(t, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n", client.do(t, "GET", "user1"))
+}
+
+func TestCountersOverRESP(t *testing.T) {
+	client, cleanup := newTestClient(t, testConfig())
+	defer cleanup()
+
+	expectReply(t, ":1\r\n", client.do(t, "INCR", "counter"))
+	expectReply(t, ":11\r\n", client.do(t, "INCRBY", "counter", "10"))
+	expectReply(t, ":8\r\n", client.do(t, "DECRBY", "counter", "3"))
+	expectReply(t, "+OK\r\n", client.do(t, "MSET", "a", "1", "b", "text"))
+	expectReply(t, "-ERR value is not an integer or out of range\r\n", client.do(t, "INCR", "b"))
+	expectReply(t, ":3\r\n", client.do(t, "DBSIZE"))
+	expectReply(t, "*2\r\n$1\r\na\r\n$1\r\nb\r\n", sortedKeys(client.do(t, "KEYS", "[ab]")))
+}
+
+// sortedKeys sorts a KEYS reply, as keys come back in shard order.
+func sortedKeys(reply string) string {
+	lines := strings.Split(strings.TrimSuffix(reply, "\r\n"), "\r\n")
+	header, items := lines[0], lines[1:]
+
+	var keys []string
+	for i := 1; i < len(items); i += 2 {
+		keys = append(keys, items[i])
+	}
+	sort.Strings(keys)
+
+	sorted := header + "\r\n"
+	for _, key := range keys {
+		sorted += fmt.Sprintf("$%d\r\n%s\r\n", len(key), key)
+	}
+	return sorted
+}
+
+func TestScanOverRESP(t *testing.T) {
+	client, cleanup := newTestClient(t, testConfig())
+	defer cleanup()
+
+	client.do(t, "SET", "only", "value")
+	expectReply(t, "*2\r\n$1\r\n0\r\n*1\r\n$4\r\nonly\r\n", client.do(t, "SCAN", "0", "MATCH", "on*", "COUNT", "1000"))
+	expectReply(t, "-ERR syntax error\r\n", client.do(t, "SCAN", "0", "MATCH"))
+}
+
+func TestSelectOverRESP(t *testing.T) {
+	client, cleanup := newTestClient(t, testConfig())
+	defer cleanup()
+
+	client.do(t, "SET", "key", "default")
+	expectReply(t, "+OK\r\n", client.do(t, "SELECT", "1"))
+	expectReply(t, "$-1\r\n", client.do(t, "GET", "key"))
+	expectReply(t, "+OK\r\n", client.do(t, "SELECT", "0"))
+	expectReply(t, "$7\r\ndefault\r\n", client.do(t, "GET", "key"))
+}
+
+func TestAuthOverRESP(t *testing.T) {
+	cfg := testConfig()
+	cfg.ClusterSecret = "secret"
+	client, cleanup := newTestClient(t, cfg)
+	defer cleanup()
+
+	expectReply(t, "-NOAUTH Authentication required.\r\n", client.do(t, "GET", "key"))
+	expectReply(t, "-WRONGPASS invalid password\r\n", client.do(t, "AUTH", "wrong"))
+	expectReply(t, "+OK\r\n", client.do(t, "AUTH", "default", "secret"))
+	expectReply(t, "$-1\r\n", client.do(t, "GET", "key"))
+}
+
+func TestUserPermissionsOverRESP(t *testing.T) {
+	cfg := testConfig()
+	cfg.Users = []config.User{{Name: "reader", Secret: "pw", Roles: []string{"read-only"}}}
+	client, cleanup := newTestClient(t, cfg)
+	defer cleanup()
+
+	expectReply(t, "-WRONGPASS invalid password\r\n", client.do(t, "AUTH", "reader", "wrong"))
+	expectReply(t, "+OK\r\n", client.do(t, "AUTH", "reader", "pw"))
+	expectReply(t, "$-1\r\n", client.do(t, "GET", "key"))
+	expectReply(
+		t,
+		"-NOPERM this user has no permissions to run the 'set' command\r\n",
+		client.do(t, "SET", "key", "value"),
+	)
+	expectReply(t, "+PONG\r\n", client.do(t, "PING"))
+}
+
+func TestPipelinedAndInlineCommands(t *testing.T) {
+	client, cleanup := newTestClient(t, testConfig())
+	defer cleanup()
+
+	client.conn.Write([]byte("SET key value\r\nGET key\r\n*1\r\n$4\r\nPING\r\n"))
+	expectReply(t, "+OK\r\n", client.readReply(t))
+	expectReply(t, "$5\r\nvalue\r\n", client.readReply(t))
+	expectReply(t, "+PONG\r\n", client.readReply(t))
+
+	expectReply(t, "+OK\r\n", client.do(t, "QUIT"))
+	if _, err := client.reader.ReadByte(); err != io.EOF {
+		t.Fatalf("Expected QUIT to close the connection, got %v", err)
+	}
+}
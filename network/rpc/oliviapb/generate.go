@@ -0,0 +1,5 @@
+// Package oliviapb holds the messages and service of Olivia's gRPC API,
+// generated from olivia.proto.
+package oliviapb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative olivia.proto
@@ -0,0 +1,331 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: olivia.proto
+
+package oliviapb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Olivia_Get_FullMethodName      = "/olivia.v1.Olivia/Get"
+	Olivia_Set_FullMethodName      = "/olivia.v1.Olivia/Set"
+	Olivia_Delete_FullMethodName   = "/olivia.v1.Olivia/Delete"
+	Olivia_MGet_FullMethodName     = "/olivia.v1.Olivia/MGet"
+	Olivia_Watch_FullMethodName    = "/olivia.v1.Olivia/Watch"
+	Olivia_PeerList_FullMethodName = "/olivia.v1.Olivia/PeerList"
+)
+
+// OliviaClient is the client API for Olivia service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Olivia is a node's cache. Every request may name a namespace; an empty one
+// is the default namespace. If the node has a cluster secret, calls must carry
+// it in the `authorization` metadata.
+type OliviaClient interface {
+	// Get fails with NOT_FOUND if the key isn't in the cache.
+	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error)
+	Set(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*SetResponse, error)
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error)
+	// MGet answers with the keys which were found, leaving the others out.
+	MGet(ctx context.Context, in *MGetRequest, opts ...grpc.CallOption) (*MGetResponse, error)
+	// Watch streams every change to the watched keys until the call is
+	// cancelled. Changes are watched from when the response headers arrive.
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WatchEvent], error)
+	PeerList(ctx context.Context, in *PeerListRequest, opts ...grpc.CallOption) (*PeerListResponse, error)
+}
+
+type oliviaClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewOliviaClient(cc grpc.ClientConnInterface) OliviaClient {
+	return &oliviaClient{cc}
+}
+
+func (c *oliviaClient) Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetResponse)
+	err := c.cc.Invoke(ctx, Olivia_Get_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *oliviaClient) Set(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*SetResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SetResponse)
+	err := c.cc.Invoke(ctx, Olivia_Set_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *oliviaClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteResponse)
+	err := c.cc.Invoke(ctx, Olivia_Delete_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *oliviaClient) MGet(ctx context.Context, in *MGetRequest, opts ...grpc.CallOption) (*MGetResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(MGetResponse)
+	err := c.cc.Invoke(ctx, Olivia_MGet_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *oliviaClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WatchEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Olivia_ServiceDesc.Streams[0], Olivia_Watch_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchRequest, WatchEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Olivia_WatchClient = grpc.ServerStreamingClient[WatchEvent]
+
+func (c *oliviaClient) PeerList(ctx context.Context, in *PeerListRequest, opts ...grpc.CallOption) (*PeerListResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PeerListResponse)
+	err := c.cc.Invoke(ctx, Olivia_PeerList_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// OliviaServer is the server API for Olivia service.
+// All implementations must embed UnimplementedOliviaServer
+// for forward compatibility.
+//
+// Olivia is a node's cache. Every request may name a namespace; an empty one
+// is the default namespace. If the node has a cluster secret, calls must carry
+// it in the `authorization` metadata.
+type OliviaServer interface {
+	// Get fails with NOT_FOUND if the key isn't in the cache.
+	Get(context.Context, *GetRequest) (*GetResponse, error)
+	Set(context.Context, *SetRequest) (*SetResponse, error)
+	Delete(context.Context, *DeleteRequest) (*DeleteResponse, error)
+	// MGet answers with the keys which were found, leaving the others out.
+	MGet(context.Context, *MGetRequest) (*MGetResponse, error)
+	// Watch streams every change to the watched keys until the call is
+	// cancelled. Changes are watched from when the response headers arrive.
+	Watch(*WatchRequest, grpc.ServerStreamingServer[WatchEvent]) error
+	PeerList(context.Context, *PeerListRequest) (*PeerListResponse, error)
+	mustEmbedUnimplementedOliviaServer()
+}
+
+// UnimplementedOliviaServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedOliviaServer struct{}
+
+func (UnimplementedOliviaServer) Get(context.Context, *GetRequest) (*GetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedOliviaServer) Set(context.Context, *SetRequest) (*SetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Set not implemented")
+}
+func (UnimplementedOliviaServer) Delete(context.Context, *DeleteRequest) (*DeleteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedOliviaServer) MGet(context.Context, *MGetRequest) (*MGetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MGet not implemented")
+}
+func (UnimplementedOliviaServer) Watch(*WatchRequest, grpc.ServerStreamingServer[WatchEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedOliviaServer) PeerList(context.Context, *PeerListRequest) (*PeerListResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PeerList not implemented")
+}
+func (UnimplementedOliviaServer) mustEmbedUnimplementedOliviaServer() {}
+func (UnimplementedOliviaServer) testEmbeddedByValue()                {}
+
+// UnsafeOliviaServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to OliviaServer will
+// result in compilation errors.
+type UnsafeOliviaServer interface {
+	mustEmbedUnimplementedOliviaServer()
+}
+
+func RegisterOliviaServer(s grpc.ServiceRegistrar, srv OliviaServer) {
+	// If the following call pancis, it indicates UnimplementedOliviaServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Olivia_ServiceDesc, srv)
+}
+
+func _Olivia_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OliviaServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Olivia_Get_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OliviaServer).Get(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Olivia_Set_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OliviaServer).Set(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Olivia_Set_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OliviaServer).Set(ctx, req.(*SetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Olivia_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OliviaServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Olivia_Delete_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OliviaServer).Delete(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Olivia_MGet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MGetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OliviaServer).MGet(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Olivia_MGet_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OliviaServer).MGet(ctx, req.(*MGetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Olivia_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(OliviaServer).Watch(m, &grpc.GenericServerStream[WatchRequest, WatchEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Olivia_WatchServer = grpc.ServerStreamingServer[WatchEvent]
+
+func _Olivia_PeerList_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PeerListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OliviaServer).PeerList(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Olivia_PeerList_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OliviaServer).PeerList(ctx, req.(*PeerListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Olivia_ServiceDesc is the grpc.ServiceDesc for Olivia service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Olivia_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "olivia.v1.Olivia",
+	HandlerType: (*OliviaServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Get",
+			Handler:    _Olivia_Get_Handler,
+		},
+		{
+			MethodName: "Set",
+			Handler:    _Olivia_Set_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _Olivia_Delete_Handler,
+		},
+		{
+			MethodName: "MGet",
+			Handler:    _Olivia_MGet_Handler,
+		},
+		{
+			MethodName: "PeerList",
+			Handler:    _Olivia_PeerList_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _Olivia_Watch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "olivia.proto",
+}
@@ -0,0 +1,173 @@
+package rpc
+
+import (
+	"context"
+	"github.com/GrappigPanda/Olivia/cache"
+	"github.com/GrappigPanda/Olivia/config"
+	"github.com/GrappigPanda/Olivia/network/metrics"
+	"github.com/GrappigPanda/Olivia/network/rpc/oliviapb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"log"
+	"net"
+	"path"
+	"strings"
+	"time"
+)
+
+// Listen serves the gRPC API on `address` in the background, translating
+// calls into operations on `c`. Closing the returned listener stops serving,
+// ending the calls in progress.
+func Listen(address string, c *cache.Cache, config *config.Cfg) (net.Listener, error) {
+	tlsConfig, err := config.ServerTLS()
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Accepting gRPC connections on %v", listener.Addr())
+
+	options := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(observeUnary, authorizeUnary(c), honorDeadline, trackUnary(c)),
+		grpc.StreamInterceptor(authorizeStream(c)),
+	}
+	if config.MaxMessageBytes > 0 {
+		options = append(options, grpc.MaxRecvMsgSize(config.MaxMessageBytes))
+	}
+	if tlsConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	server := grpc.NewServer(options...)
+	oliviapb.RegisterOliviaServer(server, &service{cache: c})
+
+	go func() {
+		err := server.Serve(listener)
+		log.Printf("Stopped accepting gRPC connections: %v", err)
+		server.Stop()
+	}()
+
+	return listener, nil
+}
+
+// observeUnary records every call's latency under its method's name.
+func observeUnary(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	started := time.Now()
+	defer func() {
+		metrics.ObserveRequest(strings.ToUpper(path.Base(info.FullMethod)), time.Since(started))
+	}()
+
+	return handler(ctx, req)
+}
+
+// trackUnary counts calls as requests in flight until their operation
+// finishes, which can be after honorDeadline answered them, for the cache to
+// wait on when shutting down.
+func trackUnary(c *cache.Cache) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		defer c.StartRequest()()
+
+		return handler(ctx, req)
+	}
+}
+
+// authorizeUnary and authorizeStream turn away calls which don't carry the
+// cluster secret, if there is one.
+func authorizeUnary(c *cache.Cache) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		if err := authorize(ctx, c); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func authorizeStream(c *cache.Cache) grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		if err := authorize(stream.Context(), c); err != nil {
+			return err
+		}
+
+		return handler(srv, stream)
+	}
+}
+
+// authorize checks the `authorization` metadata, which holds the secret,
+// optionally prefixed with "Bearer ".
+func authorize(ctx context.Context, c *cache.Cache) error {
+	if !c.RequiresAuth() {
+		return nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, secret := range md.Get("authorization") {
+		if c.AuthenticatePeer(strings.TrimPrefix(secret, "Bearer ")) {
+			return nil
+		}
+	}
+
+	return status.Error(codes.Unauthenticated, "Authentication required")
+}
+
+// honorDeadline answers once the caller's deadline passes or it cancels the
+// call, even if the cache is still waiting on a peer. The operation itself
+// still runs to completion.
+func honorDeadline(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	if ctx.Done() == nil {
+		return handler(ctx, req)
+	}
+
+	type result struct {
+		resp interface{}
+		err  error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		resp, err := handler(ctx, req)
+		done <- result{resp, err}
+	}()
+
+	select {
+	case result := <-done:
+		return result.resp, result.err
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+}
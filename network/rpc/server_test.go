@@ -0,0 +1,248 @@
+package rpc
+
+import (
+	"context"
+	"github.com/GrappigPanda/Olivia/cache"
+	"github.com/GrappigPanda/Olivia/config"
+	"github.com/GrappigPanda/Olivia/network/rpc/oliviapb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T, cfg *config.Cfg) (oliviapb.OliviaClient, *cache.Cache, func()) {
+	c := cache.NewCache(nil, cfg)
+	listener, err := Listen("127.0.0.1:0", c, cfg)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	conn, err := grpc.NewClient(
+		listener.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	return oliviapb.NewOliviaClient(conn), c, func() {
+		conn.Close()
+		listener.Close()
+		c.Stop()
+	}
+}
+
+func testConfig() *config.Cfg {
+	return &config.Cfg{BloomfilterSize: 1000, IsTesting: true, MaxNamespaces: 2}
+}
+
+func TestGetSetAndDelete(t *testing.T) {
+	client, c, stop := newTestClient(t, testConfig())
+	defer stop()
+	ctx := context.Background()
+
+	if _, err := client.Set(ctx, &oliviapb.SetRequest{Key: "key1", Value: []byte("a\x00b")}); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	resp, err := client.Get(ctx, &oliviapb.GetRequest{Key: "key1"})
+	if err != nil || string(resp.Value) != "a\x00b" {
+		t.Fatalf("Expected %q, got %v %v", "a\x00b", resp, err)
+	}
+
+	deleted, err := client.Delete(ctx, &oliviapb.DeleteRequest{Key: "key1"})
+	if err != nil || !deleted.Deleted {
+		t.Fatalf("Expected %v, got %v %v", true, deleted, err)
+	}
+
+	deleted, err = client.Delete(ctx, &oliviapb.DeleteRequest{Key: "key1"})
+	if err != nil || deleted.Deleted {
+		t.Fatalf("Expected %v, got %v %v", false, deleted, err)
+	}
+
+	_, err = client.Get(ctx, &oliviapb.GetRequest{Key: "key1"})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("Expected %v, got %v", codes.NotFound, err)
+	}
+
+	if _, err := client.Set(ctx, &oliviapb.SetRequest{Key: "key2", Value: []byte("b"), TtlSeconds: 60}); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if ttl, _ := c.GetTTL("key2"); ttl != 60 {
+		t.Fatalf("Expected %v, got %v", 60, ttl)
+	}
+
+	_, err = client.Set(ctx, &oliviapb.SetRequest{Key: "key2", TtlSeconds: -1})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Expected %v, got %v", codes.InvalidArgument, err)
+	}
+}
+
+func TestMGet(t *testing.T) {
+	client, c, stop := newTestClient(t, testConfig())
+	defer stop()
+
+	c.Set("key1", "value1")
+	c.Set("key2", "value2")
+
+	resp, err := client.MGet(context.Background(), &oliviapb.MGetRequest{Keys: []string{"key1", "key2", "key3"}})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(resp.Values) != 2 || string(resp.Values["key1"]) != "value1" || string(resp.Values["key2"]) != "value2" {
+		t.Fatalf("Expected key1 and key2, got %v", resp.Values)
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	client, c, stop := newTestClient(t, testConfig())
+	defer stop()
+	ctx := context.Background()
+
+	if _, err := client.Set(ctx, &oliviapb.SetRequest{Key: "key1", Value: []byte("a"), Namespace: "other"}); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if _, err := c.Get("key1"); err == nil {
+		t.Fatalf("Expected the default namespace not to have key1")
+	}
+
+	resp, err := client.Get(ctx, &oliviapb.GetRequest{Key: "key1", Namespace: "other"})
+	if err != nil || string(resp.Value) != "a" {
+		t.Fatalf("Expected %v, got %v %v", "a", resp, err)
+	}
+
+	_, err = client.Get(ctx, &oliviapb.GetRequest{Key: "key1", Namespace: "bad name"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Expected %v, got %v", codes.InvalidArgument, err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	client, c, stop := newTestClient(t, testConfig())
+	defer stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := client.Watch(ctx, &oliviapb.WatchRequest{Keys: []string{"key1"}, Pattern: "user:*"})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if _, err := stream.Header(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	c.Set("key1", "value1")
+	c.Set("key2", "value2")
+	c.Set("user:1", "value3")
+	c.Delete("key1")
+
+	var expected = []struct {
+		key       string
+		eventType oliviapb.WatchEvent_Type
+		value     string
+	}{
+		{"key1", oliviapb.WatchEvent_SET, "value1"},
+		{"user:1", oliviapb.WatchEvent_SET, "value3"},
+		{"key1", oliviapb.WatchEvent_DELETE, ""},
+	}
+
+	for _, want := range expected {
+		event, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		if event.Key != want.key || event.Type != want.eventType || string(event.Value) != want.value {
+			t.Fatalf("Expected %v, got %v", want, event)
+		}
+	}
+
+	cancel()
+	if _, err := stream.Recv(); status.Code(err) != codes.Canceled {
+		t.Fatalf("Expected %v, got %v", codes.Canceled, err)
+	}
+}
+
+func TestWatchRejectsBadPattern(t *testing.T) {
+	client, _, stop := newTestClient(t, testConfig())
+	defer stop()
+
+	stream, err := client.Watch(context.Background(), &oliviapb.WatchRequest{Pattern: "[a"})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if _, err := stream.Recv(); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Expected %v, got %v", codes.InvalidArgument, err)
+	}
+}
+
+func TestPeerList(t *testing.T) {
+	client, _, stop := newTestClient(t, testConfig())
+	defer stop()
+
+	resp, err := client.PeerList(context.Background(), &oliviapb.PeerListRequest{})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(resp.Peers) != 0 {
+		t.Fatalf("Expected no peers, got %v", resp.Peers)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	client, c, stop := newTestClient(t, testConfig())
+	defer stop()
+	c.SetClusterSecrets("secret", "")
+
+	_, err := client.PeerList(context.Background(), &oliviapb.PeerListRequest{})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("Expected %v, got %v", codes.Unauthenticated, err)
+	}
+
+	stream, err := client.Watch(context.Background(), &oliviapb.WatchRequest{})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("Expected %v, got %v", codes.Unauthenticated, err)
+	}
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer secret")
+	if _, err := client.PeerList(ctx, &oliviapb.PeerListRequest{}); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
+
+func TestHonorDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	release := make(chan struct{})
+	defer close(release)
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		<-release
+		return "late", nil
+	}
+
+	resp, err := honorDeadline(ctx, nil, &grpc.UnaryServerInfo{}, handler)
+	if resp != nil || status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("Expected %v, got %v %v", codes.DeadlineExceeded, resp, err)
+	}
+
+	resp, err = honorDeadline(context.Background(), nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "done", nil
+	})
+	if resp != "done" || err != nil {
+		t.Fatalf("Expected %v, got %v %v", "done", resp, err)
+	}
+}
@@ -0,0 +1,184 @@
+package rpc
+
+import (
+	"context"
+	"github.com/GrappigPanda/Olivia/cache"
+	"github.com/GrappigPanda/Olivia/network/rpc/oliviapb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// watchBuffer is how many changes can queue up for a watcher before it
+// misses some.
+const watchBuffer = 256
+
+// service implements oliviapb.OliviaServer on top of a cache.
+type service struct {
+	oliviapb.UnimplementedOliviaServer
+	cache *cache.Cache
+}
+
+// namespace returns the cache of the namespace a request names, the default
+// namespace if it names none.
+func (s *service) namespace(name string) (*cache.Cache, error) {
+	if name == "" {
+		return s.cache, nil
+	}
+
+	c, err := s.cache.Namespace(name)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+
+	return c, nil
+}
+
+func (s *service) Get(ctx context.Context, req *oliviapb.GetRequest) (*oliviapb.GetResponse, error) {
+	c, err := s.namespace(req.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := c.GetContext(ctx, req.Key)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "%v", err)
+	}
+
+	return &oliviapb.GetResponse{Value: []byte(value)}, nil
+}
+
+func (s *service) Set(ctx context.Context, req *oliviapb.SetRequest) (*oliviapb.SetResponse, error) {
+	c, err := s.namespace(req.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.TtlSeconds < 0 {
+		return nil, status.Error(codes.InvalidArgument, "TTL can't be negative")
+	}
+
+	if req.TtlSeconds > 0 {
+		err = c.SetExpiration(req.Key, string(req.Value), int(req.TtlSeconds))
+	} else {
+		err = c.SetContext(ctx, req.Key, string(req.Value))
+	}
+
+	if err == cache.ErrValueTooLarge {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	} else if err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	}
+
+	return &oliviapb.SetResponse{}, nil
+}
+
+func (s *service) Delete(ctx context.Context, req *oliviapb.DeleteRequest) (*oliviapb.DeleteResponse, error) {
+	c, err := s.namespace(req.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	return &oliviapb.DeleteResponse{Deleted: c.Delete(req.Key) == nil}, nil
+}
+
+func (s *service) MGet(ctx context.Context, req *oliviapb.MGetRequest) (*oliviapb.MGetResponse, error) {
+	c, err := s.namespace(req.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	found := c.GetMany(req.Keys)
+
+	values := make(map[string][]byte, len(found))
+	for key, value := range found {
+		values[key] = []byte(value)
+	}
+
+	return &oliviapb.MGetResponse{Values: values}, nil
+}
+
+// Watch streams the changes to the watched keys until the caller cancels
+// the call. A watcher which falls more than watchBuffer changes behind misses
+// the changes in between, which Stats().DroppedChangeEvents counts.
+func (s *service) Watch(req *oliviapb.WatchRequest, stream oliviapb.Olivia_WatchServer) error {
+	c, err := s.namespace(req.Namespace)
+	if err != nil {
+		return err
+	}
+
+	if _, err := cache.MatchGlob(req.Pattern, ""); err != nil {
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+
+	keys := make(map[string]bool, len(req.Keys))
+	for _, key := range req.Keys {
+		keys[key] = true
+	}
+
+	events := make(chan cache.ChangeEvent, watchBuffer)
+	c.OnChangeStream(events)
+	defer c.RemoveChangeStream(events)
+
+	// The headers tell the caller it's now watching.
+	if err := stream.SendHeader(nil); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		case event := <-events:
+			if !watches(keys, req.Pattern, event.Key) {
+				continue
+			}
+
+			if err := stream.Send(watchEvent(event)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// watches checks whether a change to `key` is wanted by a watcher of `keys`
+// and `pattern`. A watcher of neither watches every key.
+func watches(keys map[string]bool, pattern string, key string) bool {
+	if keys[key] {
+		return true
+	}
+
+	if pattern == "" {
+		return len(keys) == 0
+	}
+
+	ok, _ := cache.MatchGlob(pattern, key)
+	return ok
+}
+
+func watchEvent(event cache.ChangeEvent) *oliviapb.WatchEvent {
+	watched := &oliviapb.WatchEvent{
+		Key:       event.Key,
+		Type:      oliviapb.WatchEvent_SET,
+		Value:     []byte(event.Value),
+		Timestamp: event.At.UnixNano(),
+	}
+
+	if event.Op == cache.ChangeDelete {
+		watched.Type = oliviapb.WatchEvent_DELETE
+		watched.Value = nil
+	}
+
+	return watched
+}
+
+func (s *service) PeerList(ctx context.Context, req *oliviapb.PeerListRequest) (*oliviapb.PeerListResponse, error) {
+	var peers []*oliviapb.Peer
+	for _, info := range s.cache.PeerInfo() {
+		peers = append(peers, &oliviapb.Peer{
+			Address: info.IPPort,
+			State:   info.Status.String(),
+		})
+	}
+
+	return &oliviapb.PeerListResponse{Peers: peers}, nil
+}
@@ -1,4 +1,5 @@
 package parser
 
 var GET_REMOTE_BLOOMFILTER = "REQUEST Bloomfilter"
+var GET_REMOTE_CUCKOOFILTER = "REQUEST Cuckoofilter"
 var GET_REMOTE_PEERLIST = "REQUEST PEERS"
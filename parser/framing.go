@@ -0,0 +1,217 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// FrameMarker prefixes the byte length of a length-prefixed value. A framed
+// value is sent as `key:$<length>` in the command line and its raw bytes
+// follow the line, each payload terminated by a newline:
+//
+//	SET key1:$11,key2:value2
+//	hello:
+//	you
+//
+// Only values which can't be represented in the text protocol need framing,
+// so simple text values keep working with older clients.
+const FrameMarker = "$"
+
+// NeedsFraming reports whether a value has to be sent length-prefixed rather
+// than as plain text. Empty values are framed (`key:$0`) so that a key holding
+// an empty string can't be mistaken for a bare key without a value.
+func NeedsFraming(value string) bool {
+	return value == "" ||
+		strings.ContainsAny(value, " ,:\r\n") ||
+		strings.HasPrefix(value, FrameMarker)
+}
+
+// FrameValue returns the token which stands in for `value` in a command line
+// along with the payload which has to follow the line. Values which don't
+// need framing are returned as-is with an empty payload.
+func FrameValue(value string) (string, string, bool) {
+	if !NeedsFraming(value) {
+		return value, "", false
+	}
+
+	return fmt.Sprintf("%s%d", FrameMarker, len(value)), value, true
+}
+
+// AppendPayloads writes the framed payloads after an already newline
+// terminated command line.
+func AppendPayloads(line string, payloads []string) string {
+	if len(payloads) == 0 {
+		return line
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString(line)
+	for _, payload := range payloads {
+		buffer.WriteString(payload)
+		buffer.WriteString("\n")
+	}
+
+	return buffer.String()
+}
+
+// FrameCommand joins a command line and its framed payloads into a single
+// message for senders which terminate messages with a newline themselves
+// (e.g. dht.Peer.SendRequest): the line's own newline is added, the last
+// payload's is left off.
+func FrameCommand(line string, payloads []string) string {
+	if len(payloads) == 0 {
+		return line
+	}
+
+	return strings.TrimSuffix(AppendPayloads(fmt.Sprintf("%s\n", line), payloads), "\n")
+}
+
+// MessageTooLargeError is returned when a single message (its command line
+// plus every framed payload) is larger than the reader allows.
+type MessageTooLargeError struct {
+	Limit int
+}
+
+func (e *MessageTooLargeError) Error() string {
+	return fmt.Sprintf("Message exceeds the maximum of %d bytes.", e.Limit)
+}
+
+// ReadFramed reads a single command line and any framed payloads it
+// announces. The line is returned without its trailing newline.
+func ReadFramed(reader *bufio.Reader) (string, []string, error) {
+	return ReadFramedLimit(reader, 0)
+}
+
+// ReadFramedLimit works like ReadFramed, but gives up with a
+// MessageTooLargeError as soon as the message is known to be larger than
+// `maxBytes`, rather than buffering all of it. A non-positive `maxBytes`
+// means no limit.
+func ReadFramedLimit(reader *bufio.Reader, maxBytes int) (string, []string, error) {
+	line, err := readLine(reader, maxBytes)
+	if err != nil {
+		return "", nil, err
+	}
+	size := len(line)
+	line = strings.TrimRight(line, "\r\n")
+
+	lengths, err := frameLengths(line)
+	if err != nil {
+		return line, nil, err
+	}
+
+	if maxBytes > 0 {
+		// Payloads are announced up front, so an oversized message is
+		// refused before any of it is allocated.
+		for _, length := range lengths {
+			size += length + 1
+			if size > maxBytes {
+				return line, nil, &MessageTooLargeError{maxBytes}
+			}
+		}
+	}
+
+	payloads := make([]string, len(lengths))
+	for i, length := range lengths {
+		// Each payload is followed by a newline so the stream stays line
+		// aligned for the next command.
+		payload := make([]byte, length+1)
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			return line, nil, err
+		}
+
+		payloads[i] = string(payload[:length])
+	}
+
+	return line, payloads, nil
+}
+
+// readLine reads up to and including the next newline, failing once more
+// than `maxBytes` have been read without finding one.
+func readLine(reader *bufio.Reader, maxBytes int) (string, error) {
+	if maxBytes <= 0 {
+		return reader.ReadString('\n')
+	}
+
+	var line []byte
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if len(line)+len(chunk) > maxBytes {
+			return "", &MessageTooLargeError{maxBytes}
+		}
+		line = append(line, chunk...)
+
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		return string(line), nil
+	}
+}
+
+// SplitFramed splits an already fully read message (a command line plus its
+// payloads) back into the line and the payloads.
+func SplitFramed(message string) (string, []string, error) {
+	if !strings.HasSuffix(message, "\n") {
+		message = fmt.Sprintf("%s\n", message)
+	}
+
+	return ReadFramed(bufio.NewReader(strings.NewReader(message)))
+}
+
+// framedSlots are the slots of a `key:value:third` argument which can be
+// framed: the value, and the third slot for commands carrying a second value
+// there (e.g. CAS's new value). Expirations and versions are numbers, so they
+// never look like a frame token.
+var framedSlots = []int{1, 2}
+
+// frameLengths returns the payload lengths announced by a command line, in
+// the order the payloads follow the line: argument by argument, the value's
+// before the third slot's.
+func frameLengths(line string) ([]int, error) {
+	var lengths []int
+
+	splitCommand := strings.SplitN(line, " ", 2)
+	if len(splitCommand) != 2 {
+		return lengths, nil
+	}
+
+	for _, arg := range strings.Split(splitCommand[1], ",") {
+		subCommand := strings.Split(arg, ":")
+		for _, slot := range framedSlots {
+			if len(subCommand) <= slot || !isFrameToken(subCommand[slot]) {
+				continue
+			}
+
+			length, err := strconv.Atoi(subCommand[slot][len(FrameMarker):])
+			if err != nil || length < 0 {
+				return nil, fmt.Errorf("%v is an invalid frame length.", subCommand[slot])
+			}
+
+			lengths = append(lengths, length)
+		}
+	}
+
+	return lengths, nil
+}
+
+// isFrameToken checks if a value is a `$<length>` frame token.
+func isFrameToken(value string) bool {
+	if !strings.HasPrefix(value, FrameMarker) || len(value) == len(FrameMarker) {
+		return false
+	}
+
+	for _, char := range value[len(FrameMarker):] {
+		if char < '0' || char > '9' {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,168 @@
+package parser
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestNeedsFraming(t *testing.T) {
+	for _, value := range []string{"a b", "a:b", "a,b", "a\nb", "$12", ""} {
+		if !NeedsFraming(value) {
+			t.Errorf("Expected %q to need framing", value)
+		}
+	}
+
+	if NeedsFraming("value1") {
+		t.Errorf("Expected a simple value to be sent as plain text")
+	}
+}
+
+func TestFrameCommandLeavesLastNewlineToSender(t *testing.T) {
+	if message := FrameCommand("SET key1:value1", nil); message != "SET key1:value1" {
+		t.Fatalf("Expected an unframed command as-is, got %q", message)
+	}
+
+	message := FrameCommand("SET key1:$3", []string{"a b"})
+	if message != "SET key1:$3\na b" {
+		t.Fatalf("Expected %q, got %q", "SET key1:$3\na b", message)
+	}
+}
+
+func TestParseFramedEmptyValue(t *testing.T) {
+	token, payload, _ := FrameValue("")
+	message := AppendPayloads(fmt.Sprintf("hash:GOT key1:%s\n", token), []string{payload})
+
+	line, payloads, err := SplitFramed(message)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	command, err := NewParser(MESSAGEHANDLER).ParseFramed(line, payloads, nil)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if value, ok := command.Args["key1"]; !ok || value != "" {
+		t.Fatalf("Expected an empty value for key1, got %q (%v)", value, ok)
+	}
+}
+
+func TestReadFramedRoundTrip(t *testing.T) {
+	value := "spaces, colons: and\na newline"
+	token, payload, framed := FrameValue(value)
+	if !framed {
+		t.Fatalf("Expected %q to be framed", value)
+	}
+
+	message := AppendPayloads("SET key1:"+token+",key2:value2\n", []string{payload}) + "GET key1\n"
+
+	reader := bufio.NewReader(strings.NewReader(message))
+
+	line, payloads, err := ReadFramed(reader)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if line != "SET key1:"+token+",key2:value2" {
+		t.Fatalf("Unexpected line %q", line)
+	}
+
+	if len(payloads) != 1 || payloads[0] != value {
+		t.Fatalf("Expected payload %q, got %q", value, payloads)
+	}
+
+	line, payloads, err = ReadFramed(reader)
+	if err != nil || line != "GET key1" || len(payloads) != 0 {
+		t.Fatalf("Expected the stream to stay line aligned, got %q %q %v", line, payloads, err)
+	}
+}
+
+func TestParseFramedValue(t *testing.T) {
+	value := "a: b,\nc"
+	token, payload, _ := FrameValue(value)
+
+	retval, err := NewParser(MESSAGEHANDLER).Parse(
+		AppendPayloads("SETEX key1:"+token+":30,key2:value2\n", []string{payload}),
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if retval.Args["key1"] != value {
+		t.Fatalf("Expected %q, got %q", value, retval.Args["key1"])
+	}
+
+	if retval.Args["key2"] != "value2" {
+		t.Fatalf("Expected value2, got %q", retval.Args["key2"])
+	}
+
+	if retval.Expiration["key1"] != "30" {
+		t.Fatalf("Expected an expiration of 30, got %q", retval.Expiration["key1"])
+	}
+}
+
+func TestParseFramedThirdSlot(t *testing.T) {
+	expected := "old: value"
+	value := "new, value:\nhere"
+	expectedToken, expectedPayload, _ := FrameValue(expected)
+	token, payload, _ := FrameValue(value)
+
+	retval, err := NewParser(MESSAGEHANDLER).Parse(
+		AppendPayloads(
+			"CAS key1:"+expectedToken+":"+token+",key2:plain:$3\n",
+			[]string{expectedPayload, payload, "a,b"},
+		),
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if retval.Args["key1"] != expected || retval.Expiration["key1"] != value {
+		t.Fatalf("Expected %q and %q, got %q and %q", expected, value, retval.Args["key1"], retval.Expiration["key1"])
+	}
+	if retval.Args["key2"] != "plain" || retval.Expiration["key2"] != "a,b" {
+		t.Fatalf("Expected %q and %q, got %q and %q", "plain", "a,b", retval.Args["key2"], retval.Expiration["key2"])
+	}
+}
+
+func TestParseFramedMissingPayload(t *testing.T) {
+	_, err := NewParser(MESSAGEHANDLER).ParseFramed("SET key1:$5", nil, nil)
+	if err == nil {
+		t.Fatalf("Expected an error for a frame without a payload")
+	}
+}
+
+func TestReadFramedLimit(t *testing.T) {
+	token, payload, _ := FrameValue("a value: with, bits")
+	message := AppendPayloads(fmt.Sprintf("SET key1:%s\n", token), []string{payload})
+
+	if _, _, err := ReadFramedLimit(bufio.NewReader(strings.NewReader(message)), len(message)); err != nil {
+		t.Fatalf("Expected a message at the limit to be read, got %v", err)
+	}
+
+	for _, tooLarge := range []string{
+		message,
+		// A command line without framed values.
+		"SET key1:" + strings.Repeat("a", 100) + "\n",
+	} {
+		_, _, err := ReadFramedLimit(bufio.NewReader(strings.NewReader(tooLarge)), 20)
+		if _, ok := err.(*MessageTooLargeError); !ok {
+			t.Fatalf("Expected a MessageTooLargeError, got %v", err)
+		}
+	}
+}
+
+func TestReadFramedLimitRefusesHugeFrame(t *testing.T) {
+	// The announced payload never arrives: the frame length alone has to be
+	// enough to refuse the message.
+	reader := bufio.NewReader(strings.NewReader("SET key1:$999999999999\n"))
+
+	_, _, err := ReadFramedLimit(reader, 1024)
+	if _, ok := err.(*MessageTooLargeError); !ok {
+		t.Fatalf("Expected a MessageTooLargeError, got %v", err)
+	}
+}
@@ -19,7 +19,9 @@ type CommandData struct {
 	Command    string
 	Args       map[string]string
 	Expiration map[string]string
-	Conn       *net.Conn
+	// Versions holds the versions replicated writes carry, by key.
+	Versions map[string]string
+	Conn     *net.Conn
 }
 
 // NewParser handles creating a new parser (mostly just initializing a new LRU
@@ -31,8 +33,20 @@ func NewParser(mh *message_handler.MessageHandler) *Parser {
 }
 
 // Parse handles parsing the grammer into a `CommandData` struct to be later
-// processed.
+// processed. The command string may carry framed payloads after its first
+// line (see FrameMarker).
 func (p *Parser) Parse(commandString string, conn *net.Conn) (*CommandData, error) {
+	line, payloads, err := SplitFramed(commandString)
+	if err != nil {
+		return &CommandData{}, err
+	}
+
+	return p.ParseFramed(line, payloads, conn)
+}
+
+// ParseFramed parses a single command line whose framed values have already
+// been read off of the connection.
+func (p *Parser) ParseFramed(commandString string, payloads []string, conn *net.Conn) (*CommandData, error) {
 	splitCommand := strings.SplitN(commandString, " ", 2)
 	if len(splitCommand) == 1 {
 		return &CommandData{}, fmt.Errorf("%v is an Invalid command.", commandString)
@@ -50,37 +64,68 @@ func (p *Parser) Parse(commandString string, conn *net.Conn) (*CommandData, erro
 		command = hashAndCommand[0]
 	}
 
-	args, expirations := parseArgs(strings.Split(splitCommand[1], ","))
+	args, expirations, versions, err := parseArgs(strings.Split(splitCommand[1], ","), payloads)
+	if err != nil {
+		return &CommandData{}, err
+	}
 
 	return &CommandData{
 		hash,
 		command,
 		args,
 		expirations,
+		versions,
 		conn,
 	}, nil
 }
 
 // parseArgs handles filtering commands based on the command grammer.
-// Essentially seperates commands delimited by colons and commands not.
-func parseArgs(args []string) (map[string]string, map[string]string) {
+// Essentially seperates commands delimited by colons and commands not, which
+// are `key:value[:expiration[:version]]`. Framed values, and framed third
+// slots (see framedSlots), are swapped out for their payloads, in order.
+func parseArgs(args []string, payloads []string) (map[string]string, map[string]string, map[string]string, error) {
 	argMap := make(map[string]string)
 	expirationMap := make(map[string]string)
+	versionMap := make(map[string]string)
+
+	// setSlot sets a slot of `key`'s argument, swapping a frame token for
+	// the next payload, which is kept byte-for-byte.
+	setSlot := func(dict *map[string]string, key string, token string) error {
+		if !isFrameToken(token) {
+			setKeyValue(dict, key, token)
+			return nil
+		}
+
+		if len(payloads) == 0 {
+			return fmt.Errorf("%v is missing its framed value.", key)
+		}
+
+		(*dict)[strings.Replace(key, "\n", "", -1)] = payloads[0]
+		payloads = payloads[1:]
+		return nil
+	}
 
 	for arg := range args {
 		if strings.Contains(args[arg], ":") {
 			subCommand := strings.Split(args[arg], ":")
-			setKeyValue(&argMap, subCommand[0], subCommand[1])
 
+			if err := setSlot(&argMap, subCommand[0], subCommand[1]); err != nil {
+				return nil, nil, nil, err
+			}
 			if len(subCommand) > 2 {
-				setKeyValue(&expirationMap, subCommand[0], subCommand[2])
+				if err := setSlot(&expirationMap, subCommand[0], subCommand[2]); err != nil {
+					return nil, nil, nil, err
+				}
+			}
+			if len(subCommand) > 3 {
+				setKeyValue(&versionMap, subCommand[0], subCommand[3])
 			}
 		} else {
 			setKeyValue(&argMap, args[arg], "")
 		}
 	}
 
-	return argMap, expirationMap
+	return argMap, expirationMap, versionMap, nil
 }
 
 // setKeyValue sets a key-value  to a capitalized(key) = value
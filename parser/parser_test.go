@@ -28,6 +28,7 @@ func TestParseStringOfCommas(t *testing.T) {
 		"GET",
 		args,
 		exps,
+		make(map[string]string),
 		nil,
 	}
 
@@ -60,6 +61,7 @@ func TestParseSetKeysWithColon(t *testing.T) {
 		"SET",
 		args,
 		make(map[string]string),
+		make(map[string]string),
 		nil,
 	}
 
@@ -88,6 +90,7 @@ func TestParseCommandWithHash(t *testing.T) {
 		"SET",
 		args,
 		make(map[string]string),
+		make(map[string]string),
 		nil,
 	}
 
@@ -21,16 +21,26 @@ type Node struct {
 	Timeout time.Time
 }
 
-// Heap represents our binary heap object.
+// Heap represents our binary heap object. Its methods take the heap's lock
+// themselves, so it's safe for concurrent use on its own.
 type Heap struct {
 	Tree          []*Node
 	currentSize   int
 	index         int
 	allocStrategy HeapAllocationStrategy
 	keyLookup     map[string]int
+	// growthFactor is how much of the current size is added to the tree
+	// each time a `Realloc` heap runs out of room.
+	growthFactor float64
+	// reallocations counts how many times the tree has been grown.
+	reallocations int
 	sync.Mutex
 }
 
+// DefaultGrowthFactor is the growth factor used by NewHeapReallocate, growing
+// the tree by half its size whenever it's full.
+const DefaultGrowthFactor = 0.5
+
 // keyLookup helps our LRU cache find nodes quicker than traversing the
 // entire binary heap. Allows o(1) lookup rather than o(n)
 
@@ -59,19 +69,35 @@ func NewHeap(maxSize int) *Heap {
 // NewHeapReallocate handles intiailizing a new heap object which is able to
 // reallocate itself.
 func NewHeapReallocate(maxSize int) *Heap {
+	return NewHeapReallocateWithGrowth(maxSize, DefaultGrowthFactor)
+}
+
+// NewHeapReallocateWithGrowth handles initializing a reallocating heap which
+// grows by `growthFactor` times its size whenever it's full. Growing copies
+// the whole tree, so a heap with a known load should rather be pre-sized
+// through `initialSize` than grown. A non-positive `growthFactor` falls back
+// to DefaultGrowthFactor.
+func NewHeapReallocateWithGrowth(initialSize int, growthFactor float64) *Heap {
+	if growthFactor <= 0 {
+		growthFactor = DefaultGrowthFactor
+	}
+
 	return &Heap{
 		index:         0,
-		Tree:          make([]*Node, maxSize),
+		Tree:          make([]*Node, initialSize),
 		currentSize:   0,
 		allocStrategy: Realloc,
 		keyLookup:     make(map[string]int),
+		growthFactor:  growthFactor,
 	}
 }
 
-// Copy handles taking in a binary heap and making a copy of it.
-func (h *Heap) Copy() Heap {
+// Copy handles taking in a binary heap and making a copy of it, with a lock
+// of its own.
+func (h *Heap) Copy() *Heap {
 	h.Lock()
 	defer h.Unlock()
+
 	newHeap := NewHeap(len(h.Tree))
 
 	for index, element := range h.Tree {
@@ -84,13 +110,19 @@ func (h *Heap) Copy() Heap {
 
 	newHeap.index = h.index
 	newHeap.currentSize = h.currentSize
+	newHeap.allocStrategy = h.allocStrategy
+	newHeap.growthFactor = h.growthFactor
+	newHeap.reallocations = h.reallocations
 
-	return *newHeap
+	return newHeap
 }
 
 // MinNode returns the root node. In this implementation, we opted for a
 // minimum binary heap instead of a generic implementation.
 func (h *Heap) MinNode() *Node {
+	h.Lock()
+	defer h.Unlock()
+
 	if h.currentSize == 0 {
 		return nil
 	}
@@ -98,35 +130,56 @@ func (h *Heap) MinNode() *Node {
 	return h.Tree[0]
 }
 
+// PeekMin returns a copy of the root node, the one with the soonest timeout,
+// and whether the heap holds any node. Unlike MinNode's, the copy is safe to
+// read while the heap is updated.
+func (h *Heap) PeekMin() (Node, bool) {
+	h.Lock()
+	defer h.Unlock()
+
+	if h.currentSize == 0 {
+		return Node{}, false
+	}
+
+	return *h.Tree[0], true
+}
+
 // Insert handles placing a new node into the heap. If the allocation strategy
 // is set to `Maintain`, then and only then will `Insert` return a *Node.
 // Moreover, a *Node is only returned if the binary heap is full and can no
-// longer place new nodes into it.
+// longer place new nodes into it. Inserting a key the heap already holds
+// moves its node to the new node's timeout instead of adding a second one.
 func (h *Heap) Insert(node *Node) *Node {
+	h.Lock()
+	defer h.Unlock()
+
+	if _, ok := h.keyLookup[node.Key]; ok {
+		h.updateKey(node.Key, node.Timeout)
+		return nil
+	}
+
 	if h.index >= len(h.Tree) {
 		// If we run into the bounds of our heap, we need to either
 		// reallocate (if that's what we're wanting to do, or
 		// maintain the size and
 		if h.allocStrategy == Realloc {
-			// The default behavior is to expand the heap by
-			// 0.5 times.
-			h.ReAllocate(h.index + len(h.Tree)/2)
+			h.reAllocate(h.growthSize())
 		} else {
 			// Otherwise, if we're maintaining, we want to evict
 			// the root node (The Min Node).
-			return h.EvictMinNode()
+			return h.evictMinNode()
 		}
 	}
 
 	h.Tree[h.index] = node
 	h.keyLookup[node.Key] = h.index
+	h.index++
+	h.currentSize++
+
 	// It's unlikely that percolating up is ever necessary, as we don't
 	// typically insert nodes with an expiration time sooner than nodes already
 	// living in the binary heap, but it's important to have, regardless.
-	h.percolateUp(h.index)
-
-	h.index++
-	h.currentSize++
+	h.percolateUp(h.index - 1)
 
 	return nil
 }
@@ -135,27 +188,69 @@ func (h *Heap) Insert(node *Node) *Node {
 // heap. It then reorganizes the binary heap so that everything stays in order
 // correctly.
 func (h *Heap) EvictMinNode() *Node {
+	h.Lock()
+	defer h.Unlock()
+
+	return h.evictMinNode()
+}
+
+// evictMinNode is EvictMinNode for a caller holding the lock.
+func (h *Heap) evictMinNode() *Node {
 	if h.index == 0 {
 		return nil
 	}
 
-	retVal := h.Tree[0]
-	h.Tree[0] = nil
+	return h.removeAt(0)
+}
+
+// Remove takes the node for `key` out of the heap, shifting the nodes after it
+// up so the tree stays in order. It returns the removed node, or nil if the
+// key has no node.
+func (h *Heap) Remove(key string) *Node {
+	return h.DeleteKey(key)
+}
+
+// DeleteKey takes the node for `key` out of the heap, found through the key
+// lookup. It returns the removed node, or nil if the key has no node.
+func (h *Heap) DeleteKey(key string) *Node {
+	h.Lock()
+	defer h.Unlock()
+
+	index, ok := h.keyLookup[key]
+	if !ok {
+		return nil
+	}
+
+	return h.removeAt(index)
+}
+
+// removeAt takes out the node at `index`, found through the key lookup rather
+// than by scanning the tree. Only the nodes after it are shifted up, leaving
+// the tree's unused capacity alone. The caller must hold the lock.
+func (h *Heap) removeAt(index int) *Node {
+	removed := h.Tree[index]
+
+	copy(h.Tree[index:h.index-1], h.Tree[index+1:h.index])
+	for i := index; i < h.index-1; i++ {
+		if h.Tree[i] != nil {
+			h.keyLookup[h.Tree[i].Key] = i
+		}
+	}
+	h.Tree[h.index-1] = nil
 
-	// Decrement the current size specifically before percolating down, as
-	// percolating down needs bounds checking against the end of the binary
-	// heap.
-	h.currentSize--
 	h.index--
-	delete(h.keyLookup, retVal.Key)
-	h.percolateDown(0)
+	h.currentSize--
+	delete(h.keyLookup, removed.Key)
 
-	return retVal
+	return removed
 }
 
 // Peek handles looking at the index of the tree.
 func (h *Heap) Peek(index int) (*Node, error) {
-	if index >= h.currentSize {
+	h.Lock()
+	defer h.Unlock()
+
+	if index < 0 || index >= h.currentSize {
 		return nil, fmt.Errorf("Index greater than size of heap.")
 	}
 
@@ -164,45 +259,100 @@ func (h *Heap) Peek(index int) (*Node, error) {
 
 // IsEmpty Notifies the caller if the binary heap is empty.
 func (h *Heap) IsEmpty() bool {
+	h.Lock()
+	defer h.Unlock()
+
 	return h.currentSize == 0
 }
 
+// Size returns how many nodes the heap holds.
+func (h *Heap) Size() int {
+	h.Lock()
+	defer h.Unlock()
+
+	return h.currentSize
+}
+
 // ReAllocate Handles increasing the size of the underlying binary heap.
 func (h *Heap) ReAllocate(maxSize int) {
 	h.Lock()
 	defer h.Unlock()
 
+	h.reAllocate(maxSize)
+}
+
+// reAllocate is ReAllocate for a caller holding the lock.
+func (h *Heap) reAllocate(maxSize int) {
 	h.Tree = append(h.Tree, make([]*Node, maxSize)...)
+	h.reallocations++
 }
 
-// UpdateNodeTimeout allows changing of the keys Timeout in the
+// Reallocations returns how many times the heap has had to grow its tree.
+func (h *Heap) Reallocations() int {
+	h.Lock()
+	defer h.Unlock()
+
+	return h.reallocations
+}
+
+// growthSize is how many nodes are added to a full tree. It's always at least
+// one so tiny heaps still grow.
+func (h *Heap) growthSize() int {
+	growthFactor := h.growthFactor
+	if growthFactor <= 0 {
+		growthFactor = DefaultGrowthFactor
+	}
+
+	growth := int(float64(len(h.Tree)) * growthFactor)
+	if growth < 1 {
+		return 1
+	}
+
+	return growth
+}
+
+// UpdateNodeTimeout moves the key's node to the current time, as the LRU cache
+// does whenever a key is used. It returns the node, or nil if the key has no
+// node.
 func (h *Heap) UpdateNodeTimeout(key string) *Node {
-	nodeIndex, ok := h.keyLookup[key]
+	return h.UpdateKey(key, time.Now().UTC())
+}
+
+// UpdateKey changes the timeout of the key's node in place, moving the node
+// to where its new timeout sorts rather than removing and re-inserting it. It
+// returns the node, or nil if the key has no node.
+func (h *Heap) UpdateKey(key string, timeout time.Time) *Node {
+	h.Lock()
+	defer h.Unlock()
+
+	return h.updateKey(key, timeout)
+}
+
+// updateKey is UpdateKey for a caller holding the lock.
+func (h *Heap) updateKey(key string, timeout time.Time) *Node {
+	index, ok := h.keyLookup[key]
 	if !ok {
 		return nil
 	}
 
-	h.Tree[nodeIndex].Timeout = time.Now().UTC()
+	node := h.Tree[index]
+	node.Timeout = timeout
 
-	if nodeIndex+1 < h.currentSize {
-		fmt.Println("0")
-		if h.compareTwoTimes(nodeIndex, nodeIndex+1) {
-			fmt.Println("1")
-			h.percolateDown(nodeIndex)
-			fmt.Println("2")
-		} else if h.compareTwoTimes(nodeIndex-1, nodeIndex) {
-			h.percolateUp(nodeIndex)
-		}
+	if index > 0 && h.compareTwoTimes(index-1, index) {
+		h.percolateUp(index)
+	} else if index+1 < h.index && h.compareTwoTimes(index, index+1) {
+		h.percolateDown(index)
 	}
 
-	node, _ := h.Get(key)
 	return node
-
 }
 
 // Get handles retrieving a Node by its key. Not extensively used, but it was a
 // nice-to-have.
 func (h *Heap) Get(key string) (*Node, bool) {
+	h.Lock()
+	defer h.Unlock()
+
 	if index, ok := h.keyLookup[key]; ok {
 		return h.Tree[index], ok
 	} else {
@@ -210,94 +360,34 @@ func (h *Heap) Get(key string) (*Node, bool) {
 	}
 }
 
-// percolateUp handles sorting a newly inserted node into its correct position.
-// It's very unlikely this function actually ever does anything, as it's only
-// called by `Insert`, so newly inserted nodes don't typically have an
-// expiration time sooner than nodes already living in the heap.
-func (h *Heap) percolateUp(newNodeIndex int) {
-	if newNodeIndex == 0 {
-		return
-	}
-
-	tmpHeap := h.Copy()
-
-	// Unlikely to ever do anyttmpHeap.ng.
-	for {
-		if newNodeIndex == 0 {
-			break
-		}
-
-		newlyInsertedNode := tmpHeap.Tree[newNodeIndex]
-		preExistingNode := tmpHeap.Tree[newNodeIndex-1]
-
-		if preExistingNode.Timeout.Sub(newlyInsertedNode.Timeout) > 0 {
-			tmpHeap.swapTwoNodes(newNodeIndex, newNodeIndex-1)
-			newNodeIndex--
-		} else {
-			break
-		}
+// percolateUp moves the node at `index` towards the root until no node before
+// it has a later timeout. The caller must hold the lock.
+func (h *Heap) percolateUp(index int) {
+	for index > 0 && h.compareTwoTimes(index-1, index) {
+		h.swapTwoNodes(index-1, index)
+		index--
 	}
-
-	h.swapTrees(&tmpHeap)
 }
 
-// percolateDown handles moving a node starting at index `fromIndex` down into
-// its correct spot in the binary heap.
-func (h *Heap) percolateDown(fromIndex int) {
-	if fromIndex == len(h.Tree)-1 {
-		return
+// percolateDown moves the node at `index` away from the root until no node
+// after it has an earlier timeout. The caller must hold the lock.
+func (h *Heap) percolateDown(index int) {
+	for index+1 < h.index && h.compareTwoTimes(index, index+1) {
+		h.swapTwoNodes(index, index+1)
+		index++
 	}
-
-	tmpHeap := h.Copy()
-
-	for {
-		if fromIndex == len(tmpHeap.Tree)-1 {
-			break
-		}
-
-		// trackerNode is the node which we're currently tracking as it percolates
-		// down the binary heap.
-		trackerNode := tmpHeap.Tree[fromIndex]
-
-		// If our tracker node is nil (meaning it was the slot of the recently
-		// evited min node) we want to automatically percolate it to the bottom of
-		// the binary heap.
-		if trackerNode == nil {
-			for i := 0; i < len(h.Tree)-1; i++ {
-				tmpHeap.swapTwoNodes(i, i+1)
-			}
-			break
-		}
-
-		// preExistingNode is _any_ node which we're not currently tracking.
-		preExistingNode := tmpHeap.Tree[fromIndex+1]
-		// NOTE: I'm not using `compareTwoTimes` here because I think it makes it
-		// more readable. I know this is an aggregious abuse of intermediary state
-		// or some other nonsense, but it makes it easier for me to read.
-
-		// Unlikely to ever do anything. But it asserts that the minimum
-		if trackerNode.Timeout.Sub(preExistingNode.Timeout) > 0 {
-			tmpHeap.swapTwoNodes(fromIndex, fromIndex+1)
-			fromIndex++
-			continue
-		} else {
-			break
-		}
-	}
-
-	h.swapTrees(&tmpHeap)
 }
 
+// swapTrees replaces the heap's tree with `newHeap`'s.
 func (h *Heap) swapTrees(newHeap *Heap) {
 	h.Lock()
+	defer h.Unlock()
 
 	h.Tree = newHeap.Tree
 	h.keyLookup = newHeap.keyLookup
 
 	h.index = newHeap.index
 	h.currentSize = newHeap.currentSize
-
-	h.Unlock()
 }
 
 // swapTwoNodes swaps j into i and vice versa. Moreover, it handles updating
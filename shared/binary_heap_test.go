@@ -2,6 +2,8 @@ package shared
 
 import (
 	"fmt"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 )
@@ -151,6 +153,17 @@ func TestIsEmptyHasNode(t *testing.T) {
 	}
 }
 
+func TestSize(t *testing.T) {
+	testHeap := NewHeapReallocate(1)
+	testHeap.Insert(NewNode("first", time.Now().UTC()))
+	testHeap.Insert(NewNode("second", time.Now().UTC()))
+	testHeap.Remove("first")
+
+	if testHeap.Size() != 1 {
+		t.Errorf("Expected 1, got %v", testHeap.Size())
+	}
+}
+
 func TestPercolateDown(t *testing.T) {
 	testHeap := NewHeapReallocate(25)
 
@@ -359,6 +372,10 @@ func TestCopy(t *testing.T) {
 			t.Errorf("Expected %v, got %v", testHeap.Tree[i], copyHeap.Tree[i])
 		}
 	}
+
+	if copyHeap.Reallocations() != testHeap.Reallocations() {
+		t.Errorf("Expected %v reallocations, got %v", testHeap.Reallocations(), copyHeap.Reallocations())
+	}
 }
 
 func TestSwapTrees(t *testing.T) {
@@ -381,7 +398,7 @@ func TestSwapTrees(t *testing.T) {
 		}
 	}
 
-	testHeap.swapTrees(&copyHeap)
+	testHeap.swapTrees(copyHeap)
 
 	for i := 0; i < 10; i++ {
 		if copyHeap.Tree[i] != testHeap.Tree[i] {
@@ -395,3 +412,296 @@ func TestSwapTrees(t *testing.T) {
 		}
 	}
 }
+
+func TestHeapReallocateGrowthFactor(t *testing.T) {
+	testHeap := NewHeapReallocateWithGrowth(10, 1.0)
+
+	for i := 0; i < 11; i++ {
+		testHeap.Insert(NewNode(fmt.Sprintf("key%d", i), time.Now().UTC()))
+	}
+
+	if len(testHeap.Tree) != 20 {
+		t.Fatalf("Expected %v, got %v", 20, len(testHeap.Tree))
+	}
+
+	if testHeap.Reallocations() != 1 {
+		t.Fatalf("Expected %v, got %v", 1, testHeap.Reallocations())
+	}
+}
+
+func TestPresizedHeapDoesntReallocate(t *testing.T) {
+	testHeap := NewHeapReallocateWithGrowth(1000, DefaultGrowthFactor)
+
+	for i := 0; i < 1000; i++ {
+		testHeap.Insert(NewNode(fmt.Sprintf("key%d", i), time.Now().UTC()))
+	}
+
+	if testHeap.Reallocations() != 0 {
+		t.Fatalf("Expected %v, got %v", 0, testHeap.Reallocations())
+	}
+}
+
+func benchmarkHeapInsert(b *testing.B, initialSize int) {
+	now := time.Now().UTC()
+	for n := 0; n < b.N; n++ {
+		testHeap := NewHeapReallocateWithGrowth(initialSize, DefaultGrowthFactor)
+		for i := 0; i < 10000; i++ {
+			testHeap.Insert(NewNode(strconv.Itoa(i), now.Add(time.Duration(i))))
+		}
+	}
+}
+
+func BenchmarkHeapInsertGrowing(b *testing.B) {
+	benchmarkHeapInsert(b, 100)
+}
+
+func BenchmarkHeapInsertPresized(b *testing.B) {
+	benchmarkHeapInsert(b, 10000)
+}
+
+func TestRemove(t *testing.T) {
+	testHeap := NewHeapReallocate(10)
+
+	now := time.Now().UTC()
+	for i := 0; i < 5; i++ {
+		testHeap.Insert(NewNode(fmt.Sprintf("Node-%v", i), now.Add(time.Duration(i)*time.Second)))
+	}
+
+	removed := testHeap.Remove("Node-2")
+	if removed == nil || removed.Key != "Node-2" {
+		t.Fatalf("Expected Node-2 to be removed, got %v", removed)
+	}
+
+	if _, ok := testHeap.Get("Node-2"); ok {
+		t.Fatalf("Expected Node-2 to no longer be in the heap")
+	}
+
+	for i, key := range []string{"Node-0", "Node-1", "Node-3", "Node-4"} {
+		node, err := testHeap.Peek(i)
+		if err != nil || node.Key != key {
+			t.Fatalf("Expected %v at %v, got %v (%v)", key, i, node, err)
+		}
+		if testHeap.keyLookup[key] != i {
+			t.Fatalf("Expected %v to have an index of %v, got %v", key, i, testHeap.keyLookup[key])
+		}
+	}
+
+	if _, err := testHeap.Peek(4); err == nil {
+		t.Fatalf("Expected the heap to have shrunk")
+	}
+
+	if testHeap.Remove("Node-2") != nil {
+		t.Fatalf("Expected removing a missing key to return nil")
+	}
+}
+
+func TestEvictMinNodeDrainsHeap(t *testing.T) {
+	testHeap := NewHeapReallocateWithGrowth(100, DefaultGrowthFactor)
+
+	now := time.Now().UTC()
+	for i := 0; i < 10; i++ {
+		testHeap.Insert(NewNode(fmt.Sprintf("Node-%v", i), now.Add(time.Duration(i)*time.Second)))
+	}
+	testHeap.Remove("Node-5")
+
+	for i := 0; i < 10; i++ {
+		if i == 5 {
+			continue
+		}
+
+		expected := fmt.Sprintf("Node-%v", i)
+		if node := testHeap.EvictMinNode(); node == nil || node.Key != expected {
+			t.Fatalf("Expected %v, got %v", expected, node)
+		}
+	}
+
+	if !testHeap.IsEmpty() || testHeap.EvictMinNode() != nil || len(testHeap.keyLookup) != 0 {
+		t.Fatalf("Expected the heap to be drained, got %v", testHeap.Tree)
+	}
+}
+
+func BenchmarkHeapEvictMinNode(b *testing.B) {
+	now := time.Now().UTC()
+	for n := 0; n < b.N; n++ {
+		b.StopTimer()
+		testHeap := NewHeapReallocateWithGrowth(1000, DefaultGrowthFactor)
+		for i := 0; i < 1000; i++ {
+			testHeap.Insert(NewNode(strconv.Itoa(i), now.Add(time.Duration(i))))
+		}
+		b.StartTimer()
+
+		for !testHeap.IsEmpty() {
+			testHeap.EvictMinNode()
+		}
+	}
+}
+
+// heapKeys returns the heap's keys in order, checking the key lookup agrees.
+func heapKeys(t *testing.T, testHeap *Heap) []string {
+	var keys []string
+	for i := 0; i < testHeap.Size(); i++ {
+		node, err := testHeap.Peek(i)
+		if err != nil {
+			t.Fatalf("Expected a node at %v, got %v", i, err)
+		}
+		if testHeap.keyLookup[node.Key] != i {
+			t.Fatalf("Expected %v to have an index of %v, got %v", node.Key, i, testHeap.keyLookup[node.Key])
+		}
+		keys = append(keys, node.Key)
+	}
+
+	return keys
+}
+
+func TestUpdateKey(t *testing.T) {
+	testHeap := NewHeapReallocate(10)
+
+	now := time.Now().UTC()
+	for i := 0; i < 5; i++ {
+		testHeap.Insert(NewNode(fmt.Sprintf("Node-%v", i), now.Add(time.Duration(i)*time.Second)))
+	}
+
+	node := testHeap.UpdateKey("Node-1", now.Add(10*time.Second))
+	if node == nil || !node.Timeout.Equal(now.Add(10*time.Second)) {
+		t.Fatalf("Expected Node-1 to be updated, got %v", node)
+	}
+	testHeap.UpdateKey("Node-4", now.Add(-time.Second))
+	testHeap.UpdateKey("Node-2", now.Add(2*time.Second))
+
+	expected := fmt.Sprint([]string{"Node-4", "Node-0", "Node-2", "Node-3", "Node-1"})
+	if keys := fmt.Sprint(heapKeys(t, testHeap)); keys != expected {
+		t.Fatalf("Expected %v, got %v", expected, keys)
+	}
+
+	if testHeap.UpdateKey("Node-5", now) != nil {
+		t.Fatalf("Expected updating a missing key to return nil")
+	}
+}
+
+func TestUpdateNodeTimeoutOfRootNode(t *testing.T) {
+	testHeap := NewHeap(5)
+
+	now := time.Now().UTC()
+	testHeap.Insert(NewNode("first", now.Add(-time.Minute)))
+	testHeap.Insert(NewNode("second", now.Add(-time.Second)))
+
+	if node := testHeap.UpdateNodeTimeout("first"); node == nil {
+		t.Fatalf("Expected first to be updated")
+	}
+
+	if min := testHeap.MinNode(); min.Key != "second" {
+		t.Fatalf("Expected second, got %v", min.Key)
+	}
+}
+
+func TestInsertExistingKeyUpdatesIt(t *testing.T) {
+	testHeap := NewHeap(5)
+
+	now := time.Now().UTC()
+	testHeap.Insert(NewNode("first", now))
+	testHeap.Insert(NewNode("second", now.Add(time.Second)))
+	testHeap.Insert(NewNode("first", now.Add(time.Minute)))
+
+	expected := fmt.Sprint([]string{"second", "first"})
+	if keys := fmt.Sprint(heapKeys(t, testHeap)); keys != expected {
+		t.Fatalf("Expected %v, got %v", expected, keys)
+	}
+}
+
+func TestDeleteKey(t *testing.T) {
+	testHeap := NewHeap(5)
+
+	now := time.Now().UTC()
+	for i := 0; i < 3; i++ {
+		testHeap.Insert(NewNode(fmt.Sprintf("Node-%v", i), now.Add(time.Duration(i)*time.Second)))
+	}
+
+	if node := testHeap.DeleteKey("Node-0"); node == nil || node.Key != "Node-0" {
+		t.Fatalf("Expected Node-0 to be deleted, got %v", node)
+	}
+	if testHeap.DeleteKey("Node-0") != nil {
+		t.Fatalf("Expected deleting a missing key to return nil")
+	}
+
+	expected := fmt.Sprint([]string{"Node-1", "Node-2"})
+	if keys := fmt.Sprint(heapKeys(t, testHeap)); keys != expected {
+		t.Fatalf("Expected %v, got %v", expected, keys)
+	}
+}
+
+func TestConcurrentHeapUse(t *testing.T) {
+	testHeap := NewHeapReallocate(1)
+
+	now := time.Now().UTC()
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+
+			for i := 0; i < 200; i++ {
+				key := fmt.Sprintf("%v-%v", worker, i%20)
+				timeout := now.Add(time.Duration(worker*1000+i) * time.Millisecond)
+
+				switch i % 4 {
+				case 0, 1:
+					testHeap.Insert(NewNode(key, timeout))
+				case 2:
+					testHeap.UpdateKey(key, timeout)
+				default:
+					testHeap.DeleteKey(key)
+					testHeap.MinNode()
+					testHeap.Peek(0)
+				}
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	var last time.Time
+	for _, key := range heapKeys(t, testHeap) {
+		node, _ := testHeap.Get(key)
+		if node.Timeout.Before(last) {
+			t.Fatalf("Expected the heap to stay sorted, got %v before %v", last, node.Timeout)
+		}
+		last = node.Timeout
+	}
+}
+
+func BenchmarkHeapUpdateKey(b *testing.B) {
+	testHeap := NewHeapReallocateWithGrowth(1000, DefaultGrowthFactor)
+
+	now := time.Now().UTC()
+	for i := 0; i < 1000; i++ {
+		testHeap.Insert(NewNode(strconv.Itoa(i), now.Add(time.Duration(i))))
+	}
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		testHeap.UpdateKey(strconv.Itoa(n%1000), now.Add(time.Duration(1000+n)))
+	}
+}
+
+func TestPeekMin(t *testing.T) {
+	testHeap := NewHeap(5)
+	if _, ok := testHeap.PeekMin(); ok {
+		t.Fatalf("Expected an empty heap to have no min node")
+	}
+
+	now := time.Now().UTC()
+	testHeap.Insert(NewNode("later", now.Add(time.Minute)))
+	testHeap.Insert(NewNode("sooner", now))
+
+	node, ok := testHeap.PeekMin()
+	if !ok || node.Key != "sooner" || !node.Timeout.Equal(now) {
+		t.Fatalf("Expected sooner, got %v (%v)", node, ok)
+	}
+
+	testHeap.UpdateKey("sooner", now.Add(time.Hour))
+	if !node.Timeout.Equal(now) {
+		t.Fatalf("Expected the peeked node to be a copy, got %v", node.Timeout)
+	}
+	if node, _ := testHeap.PeekMin(); node.Key != "later" || testHeap.Size() != 2 {
+		t.Fatalf("Expected later without removing any node, got %v", node.Key)
+	}
+}
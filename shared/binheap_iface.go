@@ -1,5 +1,9 @@
 package shared
 
+import (
+	"time"
+)
+
 type BinHeap interface {
 	// Return a copy of the current BinHeap
 	// Copy() BinHeap
@@ -9,6 +13,8 @@ type BinHeap interface {
 	// MinNode Returns the root node.
 	// NOTE: This is a minimum binheap.
 	MinNode() *Node
+	// PeekMin returns a copy of the root node and whether there's one.
+	PeekMin() (Node, bool)
 	// Insert inserts a new BinHeapNode into the BinHeap.
 	// Moreover, if no realloc strategy is declared, it returns the
 	// node to the caller. Verify correct insertion against `nil`.
@@ -25,6 +31,10 @@ type BinHeap interface {
 	// evict according to however the implementation sees fit.
 	ReAllocate(int)
 	UpdateNodeTimeout(string) *Node
+	// UpdateKey moves a key's node to a new timeout in place.
+	UpdateKey(string, time.Time) *Node
+	// DeleteKey removes a key's node, wherever it is.
+	DeleteKey(string) *Node
 	Get(string) (*Node, bool)
 	// NOTE: Percolate methods are not required, as a ring-buffer
 	// implementation will allow for non-tree-based operations for the